@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	annotate         bool
+	annotateTemplate string
+	annotateBuild    string
+)
+
+// defaultAnnotateTemplate is the provenance comment written by --annotate.
+const defaultAnnotateTemplate = `bumped to {{.Version}} by flux-helpers on {{.Date}}{{with .Build}} (build {{.}}){{end}}`
+
+// annotateBuildEnv provides the default for --annotate-build.
+const annotateBuildEnv = "FLUX_HELPERS_BUILD"
+
+// annotationData is what an --annotate-template is executed with.
+type annotationData struct {
+	// Image is the bumped image repository.
+	Image string
+	// Path is the .spec.values path of the changed value.
+	Path string
+	// OldValue and NewValue are the value before and after the bump; for
+	// "repo:tag" strings they include the repository.
+	OldValue string
+	NewValue string
+	// Version is the new tag.
+	Version string
+	// Date is the day of the bump, as YYYY-MM-DD (UTC).
+	Date string
+	// Build is the CI build identifier from --annotate-build.
+	Build string
+}
+
+// changeAnnotator writes a provenance comment after every value a bump
+// changes.
+type changeAnnotator struct {
+	tmpl  *template.Template
+	date  string
+	build string
+}
+
+// newChangeAnnotator parses text as a text/template over annotationData. The
+// template may also call `env "NAME"` to read an environment variable.
+func newChangeAnnotator(text, build string, now time.Time) (*changeAnnotator, error) {
+	tmpl, err := template.New("annotate").Option("missingkey=error").
+		Funcs(template.FuncMap{"env": os.Getenv}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --annotate-template: %w", err)
+	}
+	return &changeAnnotator{tmpl: tmpl, date: now.UTC().Format("2006-01-02"), build: build}, nil
+}
+
+// comment renders the annotation for change as a single line.
+func (a *changeAnnotator) comment(change tagChange) (string, error) {
+	var buf bytes.Buffer
+	err := a.tmpl.Execute(&buf, annotationData{
+		Image:    change.Image,
+		Path:     change.Path,
+		OldValue: change.OldValue,
+		NewValue: change.NewValue,
+		Version:  strings.TrimPrefix(change.NewValue, change.Image+":"),
+		Date:     a.date,
+		Build:    a.build,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render annotation for %s: %w", change.Path, err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
+
+// annotateManifest appends the provenance comment of each change to the line
+// of the changed value under .spec.values in the HelmRelease YAML data,
+// replacing any comment already on that line. Only those lines are modified.
+func annotateManifest(data []byte, changes []tagChange, a *changeAnnotator) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest for annotation: %w", err)
+	}
+	values := yamlMappingValue(yamlMappingValue(yamlDocumentRoot(&doc), "spec"), "values")
+	if values == nil {
+		return data, nil
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	for _, change := range changes {
+		comment, err := a.comment(change)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range yamlScalarsAtPath(values, splitValuesPath(change.Path), change.NewValue) {
+			if imagePolicyOf(node.LineComment) != "" {
+				// The marker must stay the line comment for Flux to find it.
+				continue
+			}
+			setLineComment(lines, node, comment)
+		}
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// setLineComment sets the comment at the end of the line of node in lines
+// (split after "\n"), replacing the line comment node already has.
+func setLineComment(lines []string, node *yamlv3.Node, comment string) {
+	i := node.Line - 1
+	if i < 0 || i >= len(lines) {
+		return
+	}
+	line := strings.TrimRight(lines[i], "\r\n")
+	eol := lines[i][len(line):]
+	if node.LineComment != "" {
+		if at := strings.LastIndex(line, node.LineComment); at >= 0 {
+			line = strings.TrimRight(line[:at], " \t")
+		}
+	}
+	lines[i] = line + " # " + comment + eol
+}
+
+// yamlDocumentRoot returns the top-level node of a parsed document.
+func yamlDocumentRoot(doc *yamlv3.Node) *yamlv3.Node {
+	if doc.Kind == yamlv3.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// yamlMappingValue returns the value of key in a mapping node, or nil.
+func yamlMappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlScalarsAtPath returns the scalar nodes equal to value at the path
+// below node, split with splitValuesPath. Like replaceValueAtPath, lists
+// along the path are descended into at the index the path gives, or item by
+// item.
+func yamlScalarsAtPath(node *yamlv3.Node, path []string, value string) []*yamlv3.Node {
+	if node == nil || len(path) == 0 {
+		return nil
+	}
+	if node.Kind == yamlv3.SequenceNode {
+		if i, ok := listIndex(path[0]); ok {
+			if i >= len(node.Content) {
+				return nil
+			}
+			if len(path) > 1 {
+				return yamlScalarsAtPath(node.Content[i], path[1:], value)
+			}
+			if child := node.Content[i]; child.Kind == yamlv3.ScalarNode && child.Value == value {
+				return []*yamlv3.Node{child}
+			}
+			return nil
+		}
+		var found []*yamlv3.Node
+		for _, item := range node.Content {
+			found = append(found, yamlScalarsAtPath(item, path, value)...)
+		}
+		return found
+	}
+	child := yamlMappingValue(node, path[0])
+	if len(path) > 1 {
+		return yamlScalarsAtPath(child, path[1:], value)
+	}
+	if child != nil && child.Kind == yamlv3.ScalarNode && child.Value == value {
+		return []*yamlv3.Node{child}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAnnotateManifest verifies that each changed line gets a provenance
+// comment, that nothing else changes, and that re-annotating replaces the
+// comment.
+func TestAnnotateManifest(t *testing.T) {
+	data := []byte(`apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.99
+    images:
+      web: ghcr.io/my-org/web-app:1.7.99
+`)
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "ghcr.io/my-org/web-app": "1.8.0"}
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	annotator, err := newChangeAnnotator(defaultAnnotateTemplate, "1234", day)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plain, err := bumpHelmReleaseData(data, updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err := bumpHelmReleaseData(data, updates, bumpOptions{Annotate: annotator})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	out := string(result.Output)
+	for _, want := range []string{
+		"tag: 1.8.0 # bumped to 1.8.0 by flux-helpers on 2024-05-01 (build 1234)\n",
+		"web: ghcr.io/my-org/web-app:1.8.0 # bumped to 1.8.0 by flux-helpers on 2024-05-01 (build 1234)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if stripped := strings.ReplaceAll(out, " # bumped to 1.8.0 by flux-helpers on 2024-05-01 (build 1234)", ""); stripped != string(plain.Output) {
+		t.Errorf("Expected only the changed lines to be annotated, got:\n%s", out)
+	}
+
+	later, _ := newChangeAnnotator("{{.OldValue}} -> {{.NewValue}} at {{.Path}}", "", day)
+	again, err := annotateManifest(result.Output, result.Changes[:1], later)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(again), "tag: 1.8.0 # 1.7.99 -> 1.8.0 at image.tag\n") || strings.Count(string(again), "#") != 2 {
+		t.Errorf("Expected the annotation to be replaced, got:\n%s", again)
+	}
+
+	if _, err := newChangeAnnotator("{{.Version", "", day); err == nil {
+		t.Error("Expected an invalid template to be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockTimeout is how long to wait for another flux-helpers process to release
+// the advisory lock on a file before giving up (set with --lock-timeout).
+var lockTimeout = 30 * time.Second
+
+// lockPollInterval is how often a held lock is re-checked while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// writeFileAtomic replaces path with data without ever exposing a partially
+// written file: the data is written and synced to a temporary file in the same
+// directory, which is then renamed over path. An existing file keeps its mode;
+// new files are created with perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// lockFileFor returns the path of the advisory lock file guarding path.
+func lockFileFor(path string) string {
+	return path + ".lock"
+}
+
+// acquireFileLock takes the advisory lock for path by exclusively creating
+// "<path>.lock", waiting up to lockTimeout while another process holds it.
+// The lock file records the holder's host, PID and start time so a stale lock
+// left by a killed process can be identified and removed by hand.
+//
+// Returns a function that releases the lock.
+func acquireFileLock(path string) (func(), error) {
+	lockPath := lockFileFor(path)
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "host=%s pid=%d since=%s\n", host, os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", lockPath, err)
+		}
+
+		if time.Now().After(deadline) {
+			holder, _ := os.ReadFile(lockPath)
+			return nil, fmt.Errorf("timed out after %s waiting for lock %s (held by %s); remove it if the holder is gone",
+				lockTimeout, lockPath, strings.TrimSpace(string(holder)))
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// withFileLock runs fn while holding the advisory lock for path.
+func withFileLock(path string, fn func() error) error {
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// acquireFileLocks takes the advisory locks for all paths, in sorted order so
+// that concurrent invocations locking overlapping sets cannot deadlock.
+//
+// Returns a function that releases every lock taken.
+func acquireFileLocks(paths []string) (func(), error) {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range sorted {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+
+		unlock, err := acquireFileLock(p)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestWriteFileAtomic verifies that writeFileAtomic replaces the content of an
+// existing file, keeps its permissions and leaves no temporary files behind.
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("Expected content to be replaced, got: %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be preserved, got: %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no leftover temporary files, got: %d entries", len(entries))
+	}
+}
+
+// TestFileLockTimeout verifies that a held lock makes other acquirers wait and
+// time out with --lock-timeout, and that it can be taken again once released.
+func TestFileLockTimeout(t *testing.T) {
+	defer func(old time.Duration) { lockTimeout = old }(lockTimeout)
+	lockTimeout = 200 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "hr.yaml")
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := acquireFileLock(path); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a lock timeout, got: %v", err)
+	}
+
+	unlock()
+	unlock, err = acquireFileLock(path)
+	if err != nil {
+		t.Fatalf("Expected lock to be free after release, got: %v", err)
+	}
+	unlock()
+}
+
+// TestConcurrentBumpsSerialize runs several bumps of different images against
+// the same file concurrently and checks that none of the updates is lost.
+func TestConcurrentBumpsSerialize(t *testing.T) {
+	data, err := os.ReadFile("test_files/multiple-bump.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "hr.yaml")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write fixture copy: %v", err)
+	}
+
+	updates := map[string]string{
+		"busybox":               "1.46.0",
+		"alpine":                "6.0.0",
+		"envoyproxy/envoy":      "1.27.0",
+		"ghcr.io/my-org/my-api": "1.8.0",
+	}
+
+	var wg sync.WaitGroup
+	for repo, version := range updates {
+		wg.Add(1)
+		go func(repo, version string) {
+			defer wg.Done()
+			if _, err := bumpHelmReleaseFile(path, map[string]string{repo: version}, bumpOptions{}); err != nil {
+				t.Errorf("Unexpected error bumping %s: %v", repo, err)
+			}
+		}(repo, version)
+	}
+	wg.Wait()
+
+	out, _ := os.ReadFile(path)
+	for _, version := range updates {
+		if !strings.Contains(string(out), "tag: "+version) {
+			t.Errorf("Expected tag %s to survive concurrent bumps, got:\n%s", version, out)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// auditSchemaVersion is the version of the audit record schema. Fields are
+// only ever added to commandAuditRecord; renaming or removing one bumps it.
+const auditSchemaVersion = 1
+
+// auditLogEnv provides a default for --audit-log, so a pipeline can audit
+// every command without changing each invocation.
+const auditLogEnv = "FLUX_HELPERS_AUDIT_LOG"
+
+var (
+	// auditLogPath is the --audit-log file; empty disables auditing.
+	auditLogPath string
+	// auditCommand is the command path of the running command, e.g.
+	// "flux-helpers bump", set before it runs.
+	auditCommand string
+	// auditCmd is the running command, set before it runs.
+	auditCmd *cobra.Command
+)
+
+// auditedCommands are the commands that change files or a cluster, by command
+// path. A failed run of one is recorded even when it wrote nothing, unless it
+// was a dry run; serve and webhook record every request or event instead.
+var auditedCommands = map[string]bool{
+	"flux-helpers apply":                     true,
+	"flux-helpers apply-lock":                true,
+	"flux-helpers bump":                      true,
+	"flux-helpers bump aspire":               true,
+	"flux-helpers bump chart":                true,
+	"flux-helpers bump chart-deps":           true,
+	"flux-helpers bump compose":              true,
+	"flux-helpers bump source":               true,
+	"flux-helpers bump values":               true,
+	"flux-helpers chart inject":              true,
+	"flux-helpers chart inject-labels":       true,
+	"flux-helpers chart inject-pull-secrets": true,
+	"flux-helpers chart inject-resources":    true,
+	"flux-helpers chart lint":                true,
+	"flux-helpers promote":                   true,
+	"flux-helpers rollback":                  true,
+	"flux-helpers set":                       true,
+	"flux-helpers train":                     true,
+}
+
+// auditedRun reports whether the running command is one of auditedCommands
+// that was asked to change something: not a dry run and, for commands with a
+// --fix flag, run with it. It is checked once the command is done, so a dry
+// run requested by a config file counts too.
+func auditedRun() bool {
+	if auditCmd == nil || !auditedCommands[auditCmd.CommandPath()] {
+		return false
+	}
+	if f := auditCmd.Flags().Lookup("dry-run"); f != nil && f.Value.String() != "false" {
+		return false
+	}
+	if f := auditCmd.Flags().Lookup("fix"); f != nil && f.Value.String() != "true" {
+		return false
+	}
+	return true
+}
+
+// auditRedactedFlags are the flags whose values are replaced in the recorded
+// arguments, as they hold credentials, besides the secrets in unsettableFlags.
+var auditRedactedFlags = map[string]bool{"notify": true}
+
+// auditRedacted reports whether the value of flag is replaced in the recorded
+// arguments.
+func auditRedacted(flag string) bool {
+	return auditRedactedFlags[flag] || (unsettableFlags[flag] && flag != "help")
+}
+
+// auditedFile is a file written by a command, with the SHA-256 checksums of
+// its content before (empty for a new file) and after the write.
+type auditedFile struct {
+	Path         string `json:"path"`
+	SHA256Before string `json:"sha256Before"`
+	SHA256After  string `json:"sha256After"`
+}
+
+// commandAuditRecord is a line of the audit log, describing one command that
+// changed files or a cluster, or failed to.
+type commandAuditRecord struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Time          time.Time     `json:"time"`
+	User          string        `json:"user"`
+	Host          string        `json:"host"`
+	Command       string        `json:"command"`
+	Args          []string      `json:"args"`
+	Files         []auditedFile `json:"files"`
+	// Outcome is "success" or "failure"; Error holds the error of a failure.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// auditTrail collects the files written by the running command. Files are
+// written concurrently by bump --concurrency.
+var auditTrail struct {
+	sync.Mutex
+	files []auditedFile
+}
+
+// writeFileAudited is writeFileAtomic for files whose changes are audited:
+// with --audit-log, the write is recorded with the checksums of the old and
+// new content.
+func writeFileAudited(path string, data []byte, perm os.FileMode) error {
+	if auditLogPath == "" {
+		return writeFileAtomic(path, data, perm)
+	}
+	old, _ := os.ReadFile(path)
+	if err := writeFileAtomic(path, data, perm); err != nil {
+		return err
+	}
+	recordAuditedFile(path, old, data)
+	return nil
+}
+
+// recordAuditedFile adds a write of the file at path from before (nil for a
+// new file) to after to the audit trail, for files written by other means
+// than writeFileAudited, such as sops.
+func recordAuditedFile(path string, before, after []byte) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	recordAudited(path, before, after)
+}
+
+// recordAudited adds a change of what path names, a file or a kube:// object,
+// from before (nil when it is new) to after to the audit trail.
+func recordAudited(path string, before, after []byte) {
+	if auditLogPath == "" {
+		return
+	}
+	file := auditedFile{Path: path, SHA256After: fileSHA256(after)}
+	if before != nil {
+		file.SHA256Before = fileSHA256(before)
+	}
+	auditTrail.Lock()
+	defer auditTrail.Unlock()
+	auditTrail.files = append(auditTrail.files, file)
+}
+
+// redactAuditArgs returns args with the values of the flags auditRedacted
+// reports replaced, in both the --flag=value and --flag value forms.
+func redactAuditArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 0; i < len(redacted); i++ {
+		if !strings.HasPrefix(redacted[i], "--") {
+			continue
+		}
+		flag, _, hasValue := strings.Cut(redacted[i][2:], "=")
+		switch {
+		case !auditRedacted(flag):
+		case hasValue:
+			redacted[i] = "--" + flag + "=REDACTED"
+		case i+1 < len(redacted):
+			i++
+			redacted[i] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+// newAuditRecord describes the run of the current command with args, which
+// ended with runErr, or returns nil when it wrote no audited file and, with
+// mutating, did not fail either. The trail is cleared, so serve and webhook
+// record the files of each request or event once.
+func newAuditRecord(args []string, runErr error, mutating bool, now time.Time) *commandAuditRecord {
+	auditTrail.Lock()
+	files := auditTrail.files
+	auditTrail.files = nil
+	auditTrail.Unlock()
+	if len(files) == 0 && (runErr == nil || !mutating) {
+		return nil
+	}
+	host, _ := os.Hostname()
+	record := &commandAuditRecord{
+		SchemaVersion: auditSchemaVersion,
+		Time:          now.UTC(),
+		User:          defaultBumpedBy(),
+		Host:          host,
+		Command:       auditCommand,
+		Args:          redactAuditArgs(args),
+		Files:         files,
+		Outcome:       "success",
+	}
+	if runErr != nil {
+		record.Outcome, record.Error = "failure", runErr.Error()
+	}
+	return record
+}
+
+// appendAuditRecord appends record as a single JSON line to the audit log at
+// path, which is created if needed and never rewritten. The log's advisory
+// lock is held while appending, so concurrent commands do not interleave
+// their lines.
+func appendAuditRecord(path string, record *commandAuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// writeAuditLog records the run of the current command in --audit-log when
+// it wrote any audited file, whether it succeeded or not, or when it failed
+// although mutating, i.e. it was about to change something (see auditedRun).
+func writeAuditLog(args []string, runErr error, mutating bool) error {
+	if auditLogPath == "" {
+		return nil
+	}
+	record := newAuditRecord(args, runErr, mutating, time.Now())
+	if record == nil {
+		return nil
+	}
+	return appendAuditRecord(auditLogPath, record)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&auditLogPath, "audit-log", os.Getenv(auditLogEnv), "Append a JSON line describing every command that changes files (user, host, arguments, checksums, outcome) to this file (default: $"+auditLogEnv+")")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// TestAuditLog verifies that audited writes are recorded with their
+// checksums and appended to the audit log as one JSON line per run, and that
+// a record only lists the files written since the previous one. Failed runs
+// are recorded without writes when they were to change something.
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, oldCommand := auditLogPath, auditCommand
+	auditLogPath, auditCommand = filepath.Join(dir, "audit", "log.jsonl"), "flux-helpers bump"
+	auditTrail.files = nil
+	defer func() {
+		auditLogPath, auditCommand = oldPath, oldCommand
+		auditTrail.files = nil
+	}()
+
+	if newAuditRecord(nil, nil, true, time.Now()) != nil {
+		t.Fatal("Expected no record for a run without writes")
+	}
+	if newAuditRecord(nil, errors.New("boom"), false, time.Now()) != nil {
+		t.Fatal("Expected no record for a failed run that changes nothing")
+	}
+	if record := newAuditRecord(nil, errors.New("boom"), true, time.Now()); record == nil || record.Outcome != "failure" || len(record.Files) != 0 {
+		t.Fatalf("Expected a failed run that was to change files to be recorded, got %+v", record)
+	}
+
+	file := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(file, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileWithBackup(file, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	created := filepath.Join(dir, "created.yaml")
+	if err := writeFileAudited(created, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	args := []string{"bump", "-f", file, "--registry-password", "hunter2", "--notify=slack://hooks.slack.com/x", "--token", "sup3rsecret", "--secret=s3cret", "--help"}
+	if err := writeAuditLog(args, nil, true); err != nil {
+		t.Fatalf("Unexpected error writing the first record: %v", err)
+	}
+	if err := writeAuditLog(args, nil, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := writeFileAudited(created, []byte("newer\n"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := writeAuditLog(args, errors.New("boom"), true); err != nil {
+		t.Fatalf("Unexpected error writing the second record: %v", err)
+	}
+
+	f, err := os.Open(auditLogPath)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	var records []commandAuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record commandAuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d", len(records))
+	}
+
+	first := records[0]
+	if first.SchemaVersion != auditSchemaVersion || first.Command != "flux-helpers bump" || first.Outcome != "success" || first.User == "" {
+		t.Errorf("Unexpected record: %+v", first)
+	}
+	wantArgs := []string{"bump", "-f", file, "--registry-password", "REDACTED", "--notify=REDACTED", "--token", "REDACTED", "--secret=REDACTED", "--help"}
+	if !reflect.DeepEqual(first.Args, wantArgs) {
+		t.Errorf("Expected args %v, got %v", wantArgs, first.Args)
+	}
+	wantFiles := []auditedFile{
+		{Path: file, SHA256Before: fileSHA256([]byte("old\n")), SHA256After: fileSHA256([]byte("new\n"))},
+		{Path: created, SHA256After: fileSHA256([]byte("new\n"))},
+	}
+	if !reflect.DeepEqual(first.Files, wantFiles) {
+		t.Errorf("Expected files %+v, got %+v", wantFiles, first.Files)
+	}
+	if records[1].Outcome != "failure" || records[1].Error != "boom" || len(records[1].Files) != 1 {
+		t.Errorf("Expected a failed run to be recorded, got %+v", records[1])
+	}
+}
+
+// TestAuditedRun verifies which runs are recorded when they fail without
+// changing anything.
+func TestAuditedRun(t *testing.T) {
+	defer func(cmd *cobra.Command, dry, fix bool) { auditCmd, dryRun, lintFix = cmd, dry, fix }(auditCmd, dryRun, lintFix)
+	dryRun, lintFix = false, false
+
+	tests := []struct {
+		name string
+		cmd  *cobra.Command
+		set  func()
+		want bool
+	}{
+		{"bump", bumpCmd, func() {}, true},
+		{"bump --dry-run", bumpCmd, func() { dryRun = true }, false},
+		{"chart lint", chartLintCmd, func() {}, false},
+		{"chart lint --fix", chartLintCmd, func() { lintFix = true }, true},
+		{"list images", listImagesCmd, func() {}, false},
+	}
+	for _, tt := range tests {
+		dryRun, lintFix = false, false
+		auditCmd = tt.cmd
+		tt.set()
+		if got := auditedRun(); got != tt.want {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultBackupSuffix is appended to backups when --backup is given without a
+// suffix.
+const defaultBackupSuffix = ".bak"
+
+var (
+	backupSuffix string
+	backupDir    string
+)
+
+// backedUp records the files backed up in this run, so a file rewritten
+// several times keeps the backup of its original content.
+var (
+	backedUp   = map[string]bool{}
+	backedUpMu sync.Mutex
+)
+
+// backupPath returns where the backup of path is written: next to it, or
+// with --backup-dir at the same relative path below that directory, so files
+// of the same name in different directories do not collide.
+func backupPath(path, suffix, dir string) string {
+	if dir == "" {
+		return path + suffix
+	}
+	rel := filepath.Clean(path)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		if abs, err := filepath.Abs(path); err == nil {
+			rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+		}
+		rel = strings.TrimLeft(rel, string(filepath.Separator))
+	}
+	return filepath.Join(dir, rel) + suffix
+}
+
+// backupFile copies path to its backup when --backup or --backup-dir is set.
+// Files that do not exist yet, and files already backed up in this run, are
+// skipped.
+func backupFile(path string) error {
+	if backupSuffix == "" && backupDir == "" {
+		return nil
+	}
+	backedUpMu.Lock()
+	defer backedUpMu.Unlock()
+	if backedUp[path] {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %w", path, err)
+	}
+
+	suffix := backupSuffix
+	if suffix == "" {
+		suffix = defaultBackupSuffix
+	}
+	target := backupPath(path, suffix, backupDir)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := writeFileAtomic(target, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write backup %s: %w", target, err)
+	}
+	backedUp[path] = true
+	logf("💾 Backed up %s to %s\n", path, target)
+	return nil
+}
+
+// writeFileWithBackup is writeFileAtomic for files a command rewrites: the
+// original is backed up first, as configured by --backup and --backup-dir,
+// its line endings and byte-order mark are kept (see keepTextFormat), and the
+// write is audited (see writeFileAudited). The new content must pass
+// checkRewrite against the original, or nothing is written.
+func writeFileWithBackup(path string, data []byte, perm os.FileMode) error {
+	if original, err := os.ReadFile(path); err == nil {
+		if err := checkRewrite(original, data); err != nil {
+			return fmt.Errorf("refusing to rewrite %s: %w", path, err)
+		}
+	}
+	if err := backupFile(path); err != nil {
+		return err
+	}
+	return writeFileAudited(path, keepTextFormat(path, data), perm)
+}
+
+// addBackupFlags registers --backup and --backup-dir on cmd and its
+// subcommands.
+func addBackupFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&backupSuffix, "backup", "", "Back up each file before rewriting it, as <file><suffix> (--backup=SUFFIX; default suffix "+defaultBackupSuffix+")")
+	cmd.PersistentFlags().Lookup("backup").NoOptDefVal = defaultBackupSuffix
+	cmd.PersistentFlags().StringVar(&backupDir, "backup-dir", "", "Write backups below this directory instead of next to the files (implies --backup)")
+}
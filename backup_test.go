@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBackupPath verifies where backups are written, with and without
+// --backup-dir.
+func TestBackupPath(t *testing.T) {
+	tests := []struct {
+		path, suffix, dir, want string
+	}{
+		{"clusters/prod/app.yaml", ".bak", "", "clusters/prod/app.yaml.bak"},
+		{"clusters/prod/app.yaml", ".orig", "backups", "backups/clusters/prod/app.yaml.orig"},
+		{"./app.yaml", ".bak", "backups", "backups/app.yaml.bak"},
+		{"/srv/gitops/app.yaml", ".bak", "backups", "backups/srv/gitops/app.yaml.bak"},
+	}
+	for _, tt := range tests {
+		if got := backupPath(tt.path, tt.suffix, tt.dir); got != filepath.FromSlash(tt.want) {
+			t.Errorf("backupPath(%q, %q, %q) = %q, want %q", tt.path, tt.suffix, tt.dir, got, tt.want)
+		}
+	}
+}
+
+// TestBumpBackup verifies that --backup keeps the original content of a file
+// rewritten by bump, even when it is rewritten again in the same run.
+func TestBumpBackup(t *testing.T) {
+	defer func(suffix, dir string) { backupSuffix, backupDir, backedUp = suffix, dir, map[string]bool{} }(backupSuffix, backupDir)
+	backupSuffix, backupDir, backedUp = defaultBackupSuffix, "", map[string]bool{}
+
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	if err := os.WriteFile(file, original, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, version := range []string{"1.8.0", "1.9.0"} {
+		if _, err := bumpHelmReleaseFile(file, map[string]string{"ghcr.io/my-org/my-api": version}, bumpOptions{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	backup, err := os.ReadFile(file + ".bak")
+	if err != nil {
+		t.Fatalf("Expected a backup: %v", err)
+	}
+	if string(backup) != string(original) {
+		t.Errorf("Expected the backup to hold the original content, got:\n%s", backup)
+	}
+	if info, _ := os.Stat(file + ".bak"); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the backup to keep the file mode, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Annotations written by --annotate-metadata.
+const (
+	// lastBumpAnnotation holds the time of the last bump, in RFC 3339.
+	lastBumpAnnotation = "flux-helpers.io/last-bump"
+	// bumpedByAnnotation names who or what ran the last bump.
+	bumpedByAnnotation = "flux-helpers.io/bumped-by"
+	// imageChangesAnnotation holds the changes of the last bump as a JSON
+	// list.
+	imageChangesAnnotation = "flux-helpers.io/image-changes"
+)
+
+var (
+	annotateMetadata bool
+	bumpedBy         string
+)
+
+// defaultBumpedBy is the default of --bumped-by: $GITHUB_ACTOR in GitHub
+// Actions, otherwise the name of the local user.
+func defaultBumpedBy() string {
+	if actor := os.Getenv("GITHUB_ACTOR"); actor != "" {
+		return actor
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "flux-helpers"
+}
+
+// metadataChange is an entry of the image-changes annotation.
+type metadataChange struct {
+	Image string `json:"image"`
+	Path  string `json:"path"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// provenanceAnnotator writes the provenance of a bump into the annotations
+// of the HelmRelease, so that it travels with the object into the cluster.
+type provenanceAnnotator struct {
+	now      time.Time
+	bumpedBy string
+}
+
+// annotations returns the provenance annotations for a bump making changes.
+func (a *provenanceAnnotator) annotations(changes []tagChange) (map[string]string, error) {
+	list := make([]metadataChange, 0, len(changes))
+	for _, c := range changes {
+		list = append(list, metadataChange{Image: c.Image, Path: c.Path, From: c.OldValue, To: c.NewValue})
+	}
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image changes: %w", err)
+	}
+	return map[string]string{
+		lastBumpAnnotation:     a.now.UTC().Format(time.RFC3339),
+		bumpedByAnnotation:     a.bumpedBy,
+		imageChangesAnnotation: string(encoded),
+	}, nil
+}
+
+// annotate sets the provenance annotations of changes on the HelmRelease
+// data (see setManifestAnnotations).
+func (a *provenanceAnnotator) annotate(data []byte, changes []tagChange) ([]byte, error) {
+	annotations, err := a.annotations(changes)
+	if err != nil {
+		return nil, err
+	}
+	return setManifestAnnotations(data, annotations)
+}
+
+// setManifestAnnotations adds or updates annotations in the metadata of the
+// manifest data. Existing annotations are rewritten in place and new ones
+// are inserted, in sorted order, as the first entries of the block mapping
+// metadata.annotations, which is created as the first key of metadata if
+// needed; the rest of the file is left as it is. Manifests whose metadata is
+// not written in block style, including JSON ones, are re-encoded instead.
+func setManifestAnnotations(data []byte, annotations map[string]string) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	root := yamlDocumentRoot(&doc)
+	metadata := yamlMappingValue(root, "metadata")
+	existing := yamlMappingValue(metadata, "annotations")
+	inPlace := metadata != nil && metadata.Style&yamlv3.FlowStyle == 0 && len(metadata.Content) > 0 &&
+		(existing == nil || (existing.Kind == yamlv3.MappingNode && existing.Style&yamlv3.FlowStyle == 0 && len(existing.Content) > 0))
+	if !inPlace {
+		return reencodeAnnotations(&doc, data, annotations)
+	}
+
+	var patches []scalarPatch
+	var added []string
+	for _, key := range sortedKeys(annotations) {
+		node := yamlMappingValue(existing, key)
+		switch {
+		case node == nil:
+			added = append(added, key)
+		case node.Kind != yamlv3.ScalarNode:
+			return reencodeAnnotations(&doc, data, annotations)
+		case node.Value != annotations[key]:
+			patches = append(patches, scalarPatch{node: node, value: annotations[key]})
+		}
+	}
+	out, err := applyScalarPatches(data, patches)
+	if err != nil {
+		return reencodeAnnotations(&doc, data, annotations)
+	}
+	if len(added) == 0 {
+		return out, nil
+	}
+
+	// Patched values stay on their line, so the parsed positions still hold.
+	lines := strings.SplitAfter(string(out), "\n")
+	first := metadata.Content[0]
+	if existing != nil {
+		first = existing.Content[0]
+	}
+	at := first.Line - 1
+	eol := "\n"
+	if strings.HasSuffix(lines[at], "\r\n") {
+		eol = "\r\n"
+	}
+	indent := strings.Repeat(" ", first.Column-1)
+	var block []string
+	if existing == nil {
+		step := first.Column - 1
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i+1] == metadata {
+				step -= root.Content[i].Column - 1
+			}
+		}
+		if step <= 0 {
+			step = 2
+		}
+		block = append(block, indent+"annotations:"+eol)
+		indent += strings.Repeat(" ", step)
+	}
+	for _, key := range added {
+		value := formatScalar(&yamlv3.Node{Style: yamlv3.SingleQuotedStyle}, annotations[key])
+		block = append(block, indent+key+": "+value+eol)
+	}
+	lines = append(lines[:at], append(block, lines[at:]...)...)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// reencodeAnnotations is setManifestAnnotations for manifests that cannot
+// be edited in place: the annotations are set on the parsed document, which
+// is encoded again as YAML, or as JSON for a JSON manifest.
+func reencodeAnnotations(doc *yamlv3.Node, data []byte, annotations map[string]string) ([]byte, error) {
+	root := yamlDocumentRoot(doc)
+	if root.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("manifest is not a mapping")
+	}
+	metadata := ensureYAMLMapping(root, "metadata")
+	existing := ensureYAMLMapping(metadata, "annotations")
+	for _, key := range sortedKeys(annotations) {
+		if node := yamlMappingValue(existing, key); node != nil {
+			*node = yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: annotations[key], Line: node.Line, Column: node.Column}
+			continue
+		}
+		existing.Content = append(existing.Content,
+			&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key},
+			&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: annotations[key]})
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if isJSONManifest(data) {
+		return encodeJSONManifest(buf.Bytes(), data)
+	}
+	logln("⚠️ metadata is not a block mapping, so the manifest is re-encoded to annotate it")
+	return detectTextFormat(data).apply(buf.Bytes()), nil
+}
+
+// ensureYAMLMapping returns the value of key in the mapping node, replacing
+// it (or adding it) with an empty block mapping unless it is a mapping.
+func ensureYAMLMapping(node *yamlv3.Node, key string) *yamlv3.Node {
+	if value := yamlMappingValue(node, key); value != nil {
+		if value.Kind != yamlv3.MappingNode {
+			*value = yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		}
+		value.Style &^= yamlv3.FlowStyle
+		return value
+	}
+	value := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TestBumpAnnotateMetadata verifies that --annotate-metadata records the
+// bump in the HelmRelease annotations, inserting them without touching the
+// rest of the file and updating them on later bumps.
+func TestBumpAnnotateMetadata(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	a := &provenanceAnnotator{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), bumpedBy: "ci-bot"}
+
+	result, err := bumpHelmReleaseData(data, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{Provenance: a})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := string(result.Output)
+	want := "metadata:\n  annotations:\n    flux-helpers.io/bumped-by: 'ci-bot'\n" +
+		"    flux-helpers.io/image-changes: '[{\"image\":\"ghcr.io/my-org/my-api\",\"path\":\"image.tag\",\"from\":\"1.7.99\",\"to\":\"1.8.0\"}]'\n" +
+		"    flux-helpers.io/last-bump: '2024-05-01T12:00:00Z'\n  name: my-app\n"
+	if !strings.Contains(out, want) {
+		t.Fatalf("Expected annotations inserted under metadata, got:\n%s", out)
+	}
+	if rest := strings.Replace(out, "  annotations:\n", "", 1); strings.Count(rest, "\n") != strings.Count(string(data), "\n")+3 {
+		t.Errorf("Expected only the annotation lines to be added, got:\n%s", out)
+	}
+
+	// A second bump updates the annotations in place.
+	a.now = a.now.Add(24 * time.Hour)
+	result, err = bumpHelmReleaseData(result.Output, map[string]string{"ghcr.io/my-org/my-api": "1.9.0"}, bumpOptions{Provenance: a})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var hr struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(result.Output, &hr); err != nil {
+		t.Fatal(err)
+	}
+	var changes []metadataChange
+	if err := json.Unmarshal([]byte(hr.Metadata.Annotations[imageChangesAnnotation]), &changes); err != nil || len(changes) != 1 || changes[0].From != "1.8.0" || changes[0].To != "1.9.0" {
+		t.Errorf("Unexpected image changes %q: %v", hr.Metadata.Annotations[imageChangesAnnotation], err)
+	}
+	if hr.Metadata.Annotations[lastBumpAnnotation] != "2024-05-02T12:00:00Z" || len(hr.Metadata.Annotations) != 3 {
+		t.Errorf("Unexpected annotations %v", hr.Metadata.Annotations)
+	}
+}
+
+// TestSetManifestAnnotations verifies annotations are added next to existing
+// ones, and that flow-style and JSON manifests are re-encoded.
+func TestSetManifestAnnotations(t *testing.T) {
+	annotations := map[string]string{lastBumpAnnotation: "2024-05-01T12:00:00Z"}
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{
+			"existing",
+			"kind: HelmRelease\r\nmetadata:\r\n    annotations:\r\n        team: payments # owner\r\n    name: my-app\r\n",
+			"kind: HelmRelease\r\nmetadata:\r\n    annotations:\r\n        flux-helpers.io/last-bump: '2024-05-01T12:00:00Z'\r\n        team: payments # owner\r\n    name: my-app\r\n",
+		},
+		{
+			"flow",
+			"kind: HelmRelease\nmetadata: {name: my-app}\n",
+			"kind: HelmRelease\nmetadata:\n  name: my-app\n  annotations:\n    flux-helpers.io/last-bump: \"2024-05-01T12:00:00Z\"\n",
+		},
+		{
+			"json",
+			"{\n  \"kind\": \"HelmRelease\",\n  \"metadata\": {\"name\": \"my-app\"}\n}\n",
+			"{\n  \"kind\": \"HelmRelease\",\n  \"metadata\": {\n    \"annotations\": {\n      \"flux-helpers.io/last-bump\": \"2024-05-01T12:00:00Z\"\n    },\n    \"name\": \"my-app\"\n  }\n}\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := setManifestAnnotations([]byte(tc.data), annotations)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Expected:\n%q\ngot:\n%q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// Sources of the changes a changelog lists.
+const (
+	changelogSourceJournal = "journal"
+	changelogSourceGit     = "git"
+)
+
+// defaultEnvironmentPattern finds the environment in a manifest path such as
+// clusters/prod/my-app.yaml or environments/staging/apps/my-app.yaml.
+const defaultEnvironmentPattern = `(?:^|/)(?:clusters|environments|envs?)/([^/]+)/`
+
+var (
+	changelogSince      string
+	changelogSource     string
+	changelogEnvPattern string
+	changelogTitle      string
+)
+
+// changelogEntry is the net change of an image in one environment of a
+// service between the start of a changelog and now.
+type changelogEntry struct {
+	// Service is the name of the HelmRelease, or the file name when the file
+	// cannot be read.
+	Service     string
+	Environment string
+	Image       string
+	From        string
+	To          string
+}
+
+// changelogNamer derives the service and environment of the changes in a
+// manifest from its name and path.
+type changelogNamer struct {
+	envPattern *regexp.Regexp
+	// read returns the content of a manifest, for its HelmRelease name.
+	read     func(file string) ([]byte, error)
+	services map[string]string
+}
+
+// newChangelogNamer returns a changelogNamer that finds the environment with
+// the first capture group of envPattern, falling back to the name of the
+// manifest's directory.
+func newChangelogNamer(envPattern string, read func(string) ([]byte, error)) (*changelogNamer, error) {
+	re, err := regexp.Compile(envPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --env-pattern: %w", err)
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("invalid --env-pattern %q: it needs a capture group for the environment", envPattern)
+	}
+	return &changelogNamer{envPattern: re, read: read, services: map[string]string{}}, nil
+}
+
+// environment returns the environment of the manifest file.
+func (n *changelogNamer) environment(file string) string {
+	file = filepath.ToSlash(file)
+	if m := n.envPattern.FindStringSubmatch(file); m != nil && m[1] != "" {
+		return m[1]
+	}
+	if dir := path.Base(path.Dir(file)); dir != "." && dir != "/" {
+		return dir
+	}
+	return "default"
+}
+
+// service returns the HelmRelease name of the manifest file, or its file
+// name without the extension.
+func (n *changelogNamer) service(file string) string {
+	if name, ok := n.services[file]; ok {
+		return name
+	}
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if data, err := n.read(file); err == nil {
+		var meta struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if yaml.Unmarshal(data, &meta) == nil && meta.Metadata.Name != "" {
+			name = meta.Metadata.Name
+		}
+	}
+	n.services[file] = name
+	return name
+}
+
+// journalChangelog returns the net image changes of the journal runs after
+// since that were not rolled back. A value changed by several runs is listed
+// once, from its first old value to its last new value, and values changed
+// back to where they started are left out.
+func journalChangelog(j *changeJournal, since time.Time, namer *changelogNamer) []changelogEntry {
+	type location struct{ file, object, path string }
+	var order []location
+	net := map[location]*journalChange{}
+	for _, run := range j.Runs {
+		if run.RolledBackAt != nil || !run.Timestamp.After(since) {
+			continue
+		}
+		for _, c := range run.Changes {
+			loc := location{c.File, c.Object, c.Path}
+			if prev, ok := net[loc]; ok {
+				prev.NewValue = c.NewValue
+				continue
+			}
+			change := c
+			net[loc] = &change
+			order = append(order, loc)
+		}
+	}
+
+	var entries []changelogEntry
+	for _, loc := range order {
+		c := net[loc]
+		entries = append(entries, changelogEntry{
+			Service:     namer.service(c.File),
+			Environment: namer.environment(c.File),
+			Image:       c.Image,
+			From:        strings.TrimPrefix(c.OldValue, c.Image+":"),
+			To:          strings.TrimPrefix(c.NewValue, c.Image+":"),
+		})
+	}
+	return entries
+}
+
+// gitChangelog returns the image changes of the HelmRelease manifests that
+// differ between the commit since and HEAD of the git repository containing
+// dir, comparing the tag of every reference found at both commits.
+//
+// Parameters:
+//   - dir: A directory of the repository.
+//   - since: The git ref to compare HEAD with, e.g. a release tag.
+//   - matchers: The image matchers to find references with.
+//   - envPattern: Finds the environment in a manifest path, see
+//     newChangelogNamer.
+//
+// Returns:
+//   - The changes, in file order.
+//   - An error if git fails or a manifest cannot be parsed.
+func gitChangelog(dir, since string, matchers []imageMatcher, envPattern string) ([]changelogEntry, error) {
+	top, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %w", err)
+	}
+	show := func(rev string) func(string) ([]byte, error) {
+		return func(file string) ([]byte, error) {
+			out, err := runGit(top, "show", rev+":"+file)
+			return []byte(out), err
+		}
+	}
+	namer, err := newChangelogNamer(envPattern, show("HEAD"))
+	if err != nil {
+		return nil, err
+	}
+	changed, err := runGit(top, "diff", "--name-only", "--diff-filter=M", since, "HEAD", "--", "*.yaml", "*.yml", "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+
+	var entries []changelogEntry
+	for _, file := range strings.Fields(changed) {
+		refsAt := func(rev string) (map[string]imageReference, error) {
+			data, err := show(rev)(file)
+			if err != nil || manifestKind(data) != "HelmRelease" {
+				return nil, nil
+			}
+			refs, err := listImageReferences(file, data, matchers)
+			if err != nil {
+				return nil, fmt.Errorf("%s at %s: %w", file, rev, err)
+			}
+			byPath := map[string]imageReference{}
+			for _, ref := range refs {
+				byPath[ref.Path+"\x00"+ref.Image] = ref
+			}
+			return byPath, nil
+		}
+		before, err := refsAt(since)
+		if err != nil {
+			return nil, err
+		}
+		after, err := refsAt("HEAD")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(after) {
+			ref, old := after[key], before[key]
+			if old.Tag == "" || old.Tag == ref.Tag {
+				continue
+			}
+			entries = append(entries, changelogEntry{
+				Service:     namer.service(file),
+				Environment: namer.environment(file),
+				Image:       ref.Image,
+				From:        old.Tag,
+				To:          ref.Tag,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// resolveChangelogSince returns the time a journal changelog starts at: that
+// of the journal run with the ID since, the date or RFC 3339 time since, or
+// the commit time of the git ref since.
+func resolveChangelogSince(j *changeJournal, since string) (time.Time, error) {
+	if run := j.findRun(since); run != nil {
+		return run.Timestamp, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, since); err == nil {
+			return t, nil
+		}
+	}
+	out, err := runGit(".", "log", "-1", "--format=%cI", since, "--")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--since %q is not a journal run, date or git ref: %w", since, err)
+	}
+	return time.Parse(time.RFC3339, out)
+}
+
+// writeChangelog writes entries as a Markdown changelog with the heading
+// title: a section per service listing the image changes per environment.
+// Identical changes of several references are listed once.
+func writeChangelog(w io.Writer, title string, entries []changelogEntry) error {
+	services := map[string][]string{}
+	seen := map[changelogEntry]bool{}
+	for _, e := range entries {
+		if e.From == e.To || seen[e] {
+			continue
+		}
+		seen[e] = true
+		line := fmt.Sprintf("- **%s**: `%s` %s → %s", e.Environment, e.Image, e.From, e.To)
+		services[e.Service] = append(services[e.Service], line)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	if len(services) == 0 {
+		b.WriteString("\nNo image updates.\n")
+	}
+	for _, service := range sortedKeys(services) {
+		lines := services[service]
+		sort.Strings(lines)
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", service, strings.Join(lines, "\n"))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var changelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "Write a Markdown changelog of the image updates since a release",
+	Long: `Summarise the image updates made since --since as a Markdown changelog, with a
+section per service (HelmRelease) listing the changes per environment, ready to
+paste into a release announcement.
+
+With --source journal (the default), the changes are read from the change
+journal written by bump, apply and promote; runs that were rolled back are left
+out. --since is a journal run ID, a date (2024-05-01), an RFC 3339 time or a
+git ref, whose commit time is used.
+
+With --source git, --since is a git ref, and the image tags of the HelmRelease
+manifests changed between it and HEAD are compared.
+
+The environment of a manifest is the first capture group of --env-pattern
+matched against its path (by default the directory below clusters/,
+environments/ or envs/), or the name of its directory.`,
+	Example: `  flux-helpers changelog --since v1.4.0
+  flux-helpers changelog --since v1.4.0 --source git > RELEASE_NOTES.md`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if changelogSince == "" {
+			return fmt.Errorf("--since is required")
+		}
+		title := changelogTitle
+		if title == "" {
+			title = "Image updates since " + changelogSince
+		}
+
+		var entries []changelogEntry
+		switch changelogSource {
+		case changelogSourceJournal:
+			if _, err := os.Stat(journalPath); err != nil {
+				return fmt.Errorf("no change journal at %s: %w", journalPath, err)
+			}
+			j, err := loadChangeJournal(journalPath)
+			if err != nil {
+				return err
+			}
+			since, err := resolveChangelogSince(j, changelogSince)
+			if err != nil {
+				return err
+			}
+			namer, err := newChangelogNamer(changelogEnvPattern, os.ReadFile)
+			if err != nil {
+				return err
+			}
+			entries = journalChangelog(j, since, namer)
+		case changelogSourceGit:
+			matchers, err := setMatchers(matcherProfile, nil)
+			if err != nil {
+				return err
+			}
+			if entries, err = gitChangelog(".", changelogSince, matchers, changelogEnvPattern); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid --source %q (expected %s or %s)", changelogSource, changelogSourceJournal, changelogSourceGit)
+		}
+		return writeChangelog(os.Stdout, title, entries)
+	},
+}
+
+func init() {
+	flags := changelogCmd.Flags()
+	flags.StringVar(&changelogSince, "since", "", "Start of the changelog: a git ref such as a release tag, a date, or a journal run ID")
+	flags.StringVar(&changelogSource, "source", changelogSourceJournal, "Where to read the changes from: journal or git")
+	flags.StringVar(&journalPath, "journal", defaultJournalPath, "Path to the change journal")
+	flags.StringVar(&changelogEnvPattern, "env-pattern", defaultEnvironmentPattern, "Regular expression whose first capture group is the environment of a manifest path")
+	flags.StringVar(&changelogTitle, "title", "", "Heading of the changelog (default: \"Image updates since <since>\")")
+	flags.StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise with --source git: default, extended or none")
+	rootCmd.AddCommand(changelogCmd)
+}
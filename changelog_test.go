@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestJournalChangelog verifies that the changelog lists the net change of
+// each value across the runs after since, leaving out rolled-back runs and
+// values changed back.
+func TestJournalChangelog(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rolledBack := since.Add(72 * time.Hour)
+	change := func(file, path, image, from, to string) journalChange {
+		return journalChange{File: file, tagChange: tagChange{Image: image, Path: path, OldValue: from, NewValue: to}}
+	}
+	j := &changeJournal{Runs: []journalRun{
+		{ID: "old", Timestamp: since.Add(-time.Hour), Changes: []journalChange{
+			change("clusters/prod/api.yaml", "image.tag", "ghcr.io/acme/api", "0.9.0", "1.0.0"),
+		}},
+		{ID: "r1", Timestamp: since.Add(time.Hour), Changes: []journalChange{
+			change("clusters/prod/api.yaml", "image.tag", "ghcr.io/acme/api", "1.0.0", "1.1.0"),
+			change("apps/staging/web.yaml", "images.web", "ghcr.io/acme/web", "ghcr.io/acme/web:2.0.0", "ghcr.io/acme/web:2.1.0"),
+			change("clusters/prod/worker.yaml", "image.tag", "ghcr.io/acme/worker", "3.0.0", "3.1.0"),
+		}},
+		{ID: "r2", Timestamp: since.Add(2 * time.Hour), Changes: []journalChange{
+			change("clusters/prod/api.yaml", "image.tag", "ghcr.io/acme/api", "1.1.0", "1.2.0"),
+			change("clusters/prod/worker.yaml", "image.tag", "ghcr.io/acme/worker", "3.1.0", "3.0.0"),
+		}},
+		{ID: "r3", Timestamp: since.Add(3 * time.Hour), RolledBackAt: &rolledBack, Changes: []journalChange{
+			change("clusters/prod/api.yaml", "image.tag", "ghcr.io/acme/api", "1.2.0", "9.9.9"),
+		}},
+	}}
+	namer, err := newChangelogNamer(defaultEnvironmentPattern, func(string) ([]byte, error) { return nil, os.ErrNotExist })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := journalChangelog(j, since, namer)
+	want := []changelogEntry{
+		{Service: "api", Environment: "prod", Image: "ghcr.io/acme/api", From: "1.0.0", To: "1.2.0"},
+		{Service: "web", Environment: "staging", Image: "ghcr.io/acme/web", From: "2.0.0", To: "2.1.0"},
+		{Service: "worker", Environment: "prod", Image: "ghcr.io/acme/worker", From: "3.0.0", To: "3.0.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected changelog entries:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := writeChangelog(&buf, "Image updates since v1.4.0", got); err != nil {
+		t.Fatal(err)
+	}
+	wantMarkdown := "# Image updates since v1.4.0\n\n" +
+		"## api\n\n- **prod**: `ghcr.io/acme/api` 1.0.0 → 1.2.0\n\n" +
+		"## web\n\n- **staging**: `ghcr.io/acme/web` 2.0.0 → 2.1.0\n"
+	if buf.String() != wantMarkdown {
+		t.Errorf("Unexpected changelog:\n%s", buf.String())
+	}
+}
+
+// TestGitChangelog verifies that the changelog compares the image tags of the
+// HelmReleases changed since a git ref, named after the HelmRelease.
+func TestGitChangelog(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "clusters", "prod", "api.yaml")
+	release := func(tag string) {
+		data := "apiVersion: helm.toolkit.fluxcd.io/v2\nkind: HelmRelease\nmetadata:\n  name: api-server\nspec:\n  values:\n    image:\n      repository: ghcr.io/acme/api\n      tag: " + tag + "\n"
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	git("init", "--quiet")
+	git("config", "user.name", "Test")
+	git("config", "user.email", "test@example.com")
+	git("config", "commit.gpgSign", "false")
+	release("1.0.0")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "initial")
+	git("tag", "v1.4.0")
+	release("1.1.0")
+	git("commit", "--quiet", "-am", "bump api")
+
+	matchers, err := setMatchers(defaultMatcherProfile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := gitChangelog(dir, "v1.4.0", matchers, defaultEnvironmentPattern)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []changelogEntry{{Service: "api-server", Environment: "prod", Image: "ghcr.io/acme/api", From: "1.0.0", To: "1.1.0"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected changelog entries:\n got: %+v\nwant: %+v", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+var (
+	chartVersion         string
+	chartName            string
+	chartSourceKind      string
+	chartSourceName      string
+	chartSourceNamespace string
+)
+
+// chartBump describes an update of a HelmRelease's .spec.chart.spec. Empty
+// fields are left unchanged.
+type chartBump struct {
+	Version         string
+	Chart           string
+	SourceKind      string
+	SourceName      string
+	SourceNamespace string
+}
+
+// isValidChartVersion reports whether version is an exact semantic version or
+// a semver range (e.g. "4.x" or ">=4.0.0 <5.0.0"), the two forms Flux accepts
+// for .spec.chart.spec.version.
+func isValidChartVersion(version string) bool {
+	if isValidSemver(version) {
+		return true
+	}
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
+
+// BumpHelmReleaseChart updates the chart version (and optionally the chart
+// name and sourceRef) of the HelmRelease in filePath. For a HelmRelease that
+// uses .spec.chartRef, the version is set on the referenced OCIRepository or
+// HelmChart instead, see bumpChartRefSource.
+//
+// The file is written atomically under its advisory lock, unless dryRun is set
+// or nothing changes.
+//
+// Parameters:
+//   - filePath: The path to the HelmRelease YAML file.
+//   - bump: The new values; empty fields are left unchanged.
+//   - dryRun: If true, changes are only reported.
+//
+// Returns:
+//   - The changes made (or that would be made), with paths relative to the
+//     HelmRelease, e.g. "spec.chart.spec.version", or to its chartRef source.
+//   - An error if the version is not valid semver, the file is not a
+//     HelmRelease with .spec.chart or .spec.chartRef, or it cannot be read or
+//     written.
+func BumpHelmReleaseChart(filePath string, bump chartBump, dryRun bool) ([]tagChange, error) {
+	if bump.Version != "" && !isValidChartVersion(bump.Version) {
+		return nil, fmt.Errorf("invalid chart version %q (expected a semver version or range)", bump.Version)
+	}
+
+	unlock := func() {}
+	if !dryRun {
+		var err error
+		if unlock, err = acquireFileLock(filePath); err != nil {
+			return nil, err
+		}
+	}
+	defer func() { unlock() }()
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	ref := hr.ChartSpec()
+	if ref == nil {
+		chartRef := hr.ChartRef()
+		if chartRef == nil {
+			return nil, fmt.Errorf("%s has no .spec.chart or .spec.chartRef", filePath)
+		}
+		// The HelmRelease is left as it is; its source may live in the same file.
+		unlock()
+		unlock = func() {}
+		return bumpChartRefSource(filePath, *chartRef, bump, dryRun)
+	}
+
+	var changes []tagChange
+	set := func(field *string, value, path string) {
+		if value == "" || *field == value {
+			return
+		}
+		changes = append(changes, tagChange{Image: *ref.Chart, Path: path, OldValue: *field, NewValue: value})
+		*field = value
+	}
+	set(ref.Version, bump.Version, "spec.chart.spec.version")
+	set(ref.SourceKind, bump.SourceKind, "spec.chart.spec.sourceRef.kind")
+	set(ref.SourceName, bump.SourceName, "spec.chart.spec.sourceRef.name")
+	set(ref.SourceNamespace, bump.SourceNamespace, "spec.chart.spec.sourceRef.namespace")
+	set(ref.Chart, bump.Chart, "spec.chart.spec.chart")
+
+	if len(changes) == 0 {
+		logf("✅ Chart %s already at %s, skipping\n", *ref.Chart, *ref.Version)
+		return nil, nil
+	}
+
+	for _, c := range changes {
+		if dryRun {
+			logf("[dry-run] Would set %s: %s → %s\n", c.Path, c.OldValue, c.NewValue)
+		} else {
+			logf("🔁 Set %s: %s → %s\n", c.Path, c.OldValue, c.NewValue)
+		}
+	}
+	if dryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", len(changes))
+		return changes, nil
+	}
+
+	values, err := helmReleaseValues(hr)
+	if err != nil {
+		return nil, err
+	}
+	out, err := encodeHelmRelease(hr, values)
+	if err != nil {
+		return nil, err
+	}
+	if isJSONManifest(data) {
+		if out, err = encodeJSONManifest(out, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFileWithBackup(filePath, out, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+
+	logf("✅ Updated chart %s in %s\n", *ref.Chart, filePath)
+	return changes, nil
+}
+
+var bumpChartCmd = &cobra.Command{
+	Use:   "chart",
+	Short: "Bump the chart version of a HelmRelease file",
+	Long: "Update .spec.chart.spec.version of a HelmRelease, and optionally the chart " +
+		"name and .spec.chart.spec.sourceRef. The version must be a semver version " +
+		"or range. For a HelmRelease using .spec.chartRef, the referenced " +
+		"OCIRepository or HelmChart manifest is found in the same repository and " +
+		"its .spec.ref or .spec.version is updated.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" || chartVersion == "" {
+			return fmt.Errorf("you must specify --file and --version")
+		}
+
+		changes, err := BumpHelmReleaseChart(filePath, chartBump{
+			Version:         chartVersion,
+			Chart:           chartName,
+			SourceKind:      chartSourceKind,
+			SourceName:      chartSourceName,
+			SourceNamespace: chartSourceNamespace,
+		}, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to bump chart: %w", err)
+		}
+		noChangesMade = len(changes) == 0
+		return nil
+	},
+}
+
+func init() {
+	bumpChartCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
+	bumpChartCmd.Flags().StringVar(&chartVersion, "version", "", "New chart version (semver version or range)")
+	bumpChartCmd.Flags().StringVar(&chartName, "chart", "", "Also change the chart name")
+	bumpChartCmd.Flags().StringVar(&chartSourceKind, "source-kind", "", "Also change .spec.chart.spec.sourceRef.kind")
+	bumpChartCmd.Flags().StringVar(&chartSourceName, "source-name", "", "Also change .spec.chart.spec.sourceRef.name")
+	bumpChartCmd.Flags().StringVar(&chartSourceNamespace, "source-namespace", "", "Also change .spec.chart.spec.sourceRef.namespace")
+	bumpChartCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+
+	bumpCmd.AddCommand(bumpChartCmd)
+}
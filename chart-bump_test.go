@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpHelmReleaseChart verifies that the chart version and sourceRef are
+// updated for every supported API version, that dry-run leaves the file alone
+// and that invalid versions are rejected.
+func TestBumpHelmReleaseChart(t *testing.T) {
+	for _, fixture := range []string{"helmrelease-v2.yaml", "helmrelease-v2beta2.yaml"} {
+		t.Run(fixture, func(t *testing.T) {
+			original, err := os.ReadFile(filepath.Join("test_files", fixture))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			file := filepath.Join(t.TempDir(), fixture)
+			if err := os.WriteFile(file, original, 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			bump := chartBump{Version: "4.2.0", SourceName: "other-repo"}
+			changes, err := BumpHelmReleaseChart(file, bump, true)
+			if err != nil || len(changes) != 2 {
+				t.Fatalf("Expected 2 dry-run changes, got %v, err %v", changes, err)
+			}
+			if data, _ := os.ReadFile(file); string(data) != string(original) {
+				t.Errorf("Expected dry-run to leave the file untouched")
+			}
+
+			if _, err := BumpHelmReleaseChart(file, bump, false); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			data, _ := os.ReadFile(file)
+			if !strings.Contains(string(data), "version: 4.2.0") || !strings.Contains(string(data), "name: other-repo") {
+				t.Errorf("Expected chart version and sourceRef to be updated, got:\n%s", data)
+			}
+			if !strings.Contains(string(data), "tag: 1.7.99") {
+				t.Errorf("Expected values to be preserved, got:\n%s", data)
+			}
+
+			changes, err = BumpHelmReleaseChart(file, chartBump{Version: "4.2.0"}, false)
+			if err != nil || len(changes) != 0 {
+				t.Errorf("Expected no changes on re-run, got %v, err %v", changes, err)
+			}
+		})
+	}
+
+	if _, err := BumpHelmReleaseChart("test_files/helmrelease-v2.yaml", chartBump{Version: "latest"}, true); err == nil {
+		t.Errorf("Expected an error for an invalid chart version")
+	}
+	if _, err := BumpHelmReleaseChart("test_files/helmrelease-v2.yaml", chartBump{Version: ">=4.0.0 <5.0.0"}, true); err != nil {
+		t.Errorf("Expected a semver range to be accepted, got: %v", err)
+	}
+}
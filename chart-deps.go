@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	chartDepsDiff       bool
+	chartDepsUpdateLock bool
+)
+
+// chartDependenciesFile returns the file of the chart in chartDir that lists
+// its dependencies: Chart.yaml, or requirements.yaml for apiVersion v1 charts
+// that keep them there.
+func chartDependenciesFile(chartDir string) (string, error) {
+	chartFile := filepath.Join(chartDir, "Chart.yaml")
+	data, err := os.ReadFile(chartFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Chart.yaml: %w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("invalid YAML in Chart.yaml: %w", err)
+	}
+	if yamlMappingValue(yamlDocumentRoot(&doc), "dependencies") == nil {
+		requirements := filepath.Join(chartDir, "requirements.yaml")
+		if _, err := os.Stat(requirements); err == nil {
+			return requirements, nil
+		}
+	}
+	return chartFile, nil
+}
+
+// dependencyVersion returns the version of updates for the chart dependency
+// with the given name and alias: an update of its alias takes precedence over
+// one of its name, and both over glob patterns (matched with path.Match).
+func dependencyVersion(updates map[string]string, name, alias string) (string, bool) {
+	for _, key := range []string{alias, name} {
+		if version, ok := updates[key]; ok && key != "" {
+			return version, true
+		}
+	}
+	for _, pattern := range sortedKeys(updates) {
+		if !isImageGlob(pattern) {
+			continue
+		}
+		if matchesGlob(pattern, alias) || matchesGlob(pattern, name) {
+			return updates[pattern], true
+		}
+	}
+	return "", false
+}
+
+// BumpChartDependencies updates the versions of the dependencies of the Helm
+// chart in chartDir, such as an umbrella chart's subcharts. Dependencies are
+// selected by name or alias, or by a glob matching either.
+//
+// Only the changed versions are rewritten, so comments and formatting are
+// kept. The file is written atomically under its advisory lock, unless dryRun
+// is set or nothing changes; Chart.lock is left to `helm dependency update`.
+//
+// Parameters:
+//   - chartDir: The path to the Helm chart directory.
+//   - updates: A map from dependency name, alias or glob to the new version,
+//     a semver version or range.
+//   - dryRun: If true, changes are only reported.
+//   - diff: If true, a unified diff of the file is printed when it changes.
+//
+// Returns:
+//   - The changes made (or that would be made), with paths such as
+//     "dependencies.0.version" and the dependency name (or alias) as image.
+//   - An error if a version is invalid, the chart has no dependencies, or the
+//     file cannot be read, parsed or written.
+func BumpChartDependencies(chartDir string, updates map[string]string, dryRun, diff bool) ([]tagChange, error) {
+	for key, version := range updates {
+		if !isValidChartVersion(version) {
+			return nil, fmt.Errorf("invalid version %q for %s (expected a semver version or range)", version, key)
+		}
+	}
+
+	file, err := chartDependenciesFile(chartDir)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		unlock, err := acquireFileLock(file)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML in %s: %w", filepath.Base(file), err)
+	}
+	deps := yamlMappingValue(yamlDocumentRoot(&doc), "dependencies")
+	if deps == nil || deps.Kind != yamlv3.SequenceNode || len(deps.Content) == 0 {
+		return nil, fmt.Errorf("%s lists no dependencies", file)
+	}
+
+	var changes []tagChange
+	var patches []scalarPatch
+	matched := map[string]bool{}
+	for i, dep := range deps.Content {
+		var name, alias string
+		if node := yamlMappingValue(dep, "name"); node != nil {
+			name = node.Value
+		}
+		if node := yamlMappingValue(dep, "alias"); node != nil {
+			alias = node.Value
+		}
+		version, ok := dependencyVersion(updates, name, alias)
+		if !ok {
+			continue
+		}
+		for key := range updates {
+			if matchesGlob(key, name) || matchesGlob(key, alias) {
+				matched[key] = true
+			}
+		}
+		label := name
+		if alias != "" {
+			label = alias
+		}
+		node := yamlMappingValue(dep, "version")
+		if node == nil || node.Kind != yamlv3.ScalarNode {
+			logf("⚠️ Dependency %s has no version, skipping\n", label)
+			continue
+		}
+		if node.Value == version {
+			logf("✅ Dependency %s already at %s, skipping\n", label, version)
+			continue
+		}
+		changes = append(changes, tagChange{Image: label, Path: "dependencies." + strconv.Itoa(i) + ".version", OldValue: node.Value, NewValue: version})
+		patches = append(patches, scalarPatch{node: node, value: version})
+	}
+	for _, key := range sortedKeys(updates) {
+		if !matched[key] {
+			logf("⚠️ No dependency %s in %s\n", key, file)
+		}
+	}
+
+	for _, c := range changes {
+		if dryRun {
+			logf("[dry-run] Would set %s (%s): %s → %s\n", c.Path, c.Image, c.OldValue, c.NewValue)
+		} else {
+			logf("🔁 Set %s (%s): %s → %s\n", c.Path, c.Image, c.OldValue, c.NewValue)
+		}
+	}
+	if len(changes) == 0 {
+		logln("ℹ️ No dependency versions were updated.")
+		return nil, nil
+	}
+
+	out, err := applyScalarPatches(data, patches)
+	if err != nil {
+		if errors.Is(err, errNotPatchable) {
+			return nil, fmt.Errorf("cannot update the dependency versions of %s in place (are they block scalars?)", file)
+		}
+		return nil, err
+	}
+	if diff {
+		fmt.Print(unifiedDiff("a/"+filepath.Base(file), "b/"+filepath.Base(file), data, out))
+	}
+	if dryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", len(changes))
+		return changes, nil
+	}
+	if err := writeFileWithBackup(file, out, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Updated %d dependency version(s) in %s\n", len(changes), file)
+	return changes, nil
+}
+
+// matchesGlob reports whether name is non-empty and matches pattern.
+func matchesGlob(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok && name != ""
+}
+
+// updateChartLock runs `helm dependency update` for the chart in chartDir,
+// refreshing Chart.lock and the charts/ directory.
+func updateChartLock(chartDir string) error {
+	helm, err := exec.LookPath("helm")
+	if err != nil {
+		return fmt.Errorf("--update-lock needs helm on the PATH: %w", err)
+	}
+	logf("🔒 Running helm dependency update %s\n", chartDir)
+	cmd := exec.Command(helm, "dependency", "update", chartDir)
+	var stderr bytes.Buffer
+	cmd.Stdout = logOut
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("helm dependency update failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+var bumpChartDepsCmd = &cobra.Command{
+	Use:   "chart-deps",
+	Short: "Bump the dependency versions of a Helm chart",
+	Long: "Update the versions of the dependencies in a chart's Chart.yaml (or " +
+		"requirements.yaml), such as the subcharts of an umbrella chart, selected " +
+		"by name, alias or glob. With --update-lock, `helm dependency update` is " +
+		"run afterwards to refresh Chart.lock.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if chartPath == "" || len(tagArgs) == 0 {
+			return fmt.Errorf("you must specify --chart and at least one --set name=version")
+		}
+		if chartDepsUpdateLock && dryRun {
+			return fmt.Errorf("--update-lock cannot be combined with --dry-run")
+		}
+		updates, _, err := parseUpdateArgs(tagArgs, nil)
+		if err != nil {
+			return err
+		}
+
+		changes, err := BumpChartDependencies(chartPath, updates, dryRun, chartDepsDiff)
+		if err != nil {
+			return fmt.Errorf("failed to bump chart dependencies: %w", err)
+		}
+		noChangesMade = len(changes) == 0
+		if chartDepsUpdateLock && len(changes) > 0 {
+			return updateChartLock(chartPath)
+		}
+		return nil
+	},
+}
+
+func init() {
+	bumpChartDepsCmd.Flags().StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	bumpChartDepsCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Dependency update(s) in the form name=version; name may be an alias or a glob (repeatable)")
+	bumpChartDepsCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+	bumpChartDepsCmd.Flags().BoolVar(&chartDepsDiff, "diff", false, "Print a unified diff of the dependencies file when it changes")
+	bumpChartDepsCmd.Flags().BoolVar(&chartDepsUpdateLock, "update-lock", false, "Run helm dependency update afterwards to refresh Chart.lock")
+
+	bumpCmd.AddCommand(bumpChartDepsCmd)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const umbrellaChart = `apiVersion: v2
+name: umbrella
+version: 0.1.0
+dependencies:
+  # cache for the API
+  - name: redis
+    version: 18.1.0
+    repository: https://charts.bitnami.com/bitnami
+  - name: redis
+    alias: queue
+    version: "18.1.0"
+    repository: https://charts.bitnami.com/bitnami
+  - name: postgresql
+    version: ~13.2.0 # patch releases only
+    repository: oci://registry-1.docker.io/bitnamicharts
+`
+
+// TestBumpChartDependencies verifies that dependency versions are selected by
+// name, alias or glob and rewritten in place.
+func TestBumpChartDependencies(t *testing.T) {
+	dir := t.TempDir()
+	chartFile := filepath.Join(dir, "Chart.yaml")
+	if err := os.WriteFile(chartFile, []byte(umbrellaChart), 0644); err != nil {
+		t.Fatalf("Failed to write Chart.yaml: %v", err)
+	}
+
+	changes, err := BumpChartDependencies(dir, map[string]string{
+		"redis":     "18.4.0",
+		"queue":     "18.5.0",
+		"postgres*": "~13.4.0",
+		"mysql":     "9.0.0",
+	}, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got: %+v", changes)
+	}
+	if changes[1].Image != "queue" || changes[1].Path != "dependencies.1.version" || changes[1].NewValue != "18.5.0" {
+		t.Errorf("Expected the aliased dependency to get its own version, got: %+v", changes[1])
+	}
+
+	data, err := os.ReadFile(chartFile)
+	if err != nil {
+		t.Fatalf("Failed to read Chart.yaml: %v", err)
+	}
+	want := strings.NewReplacer(
+		"version: 18.1.0", "version: 18.4.0",
+		`version: "18.1.0"`, `version: "18.5.0"`,
+		"version: ~13.2.0", "version: ~13.4.0",
+	).Replace(umbrellaChart)
+	if string(data) != want {
+		t.Errorf("Unexpected Chart.yaml:\n%s", data)
+	}
+
+	if _, err := BumpChartDependencies(dir, map[string]string{"redis": "latest"}, true, false); err == nil {
+		t.Errorf("Expected an invalid version to be rejected")
+	}
+}
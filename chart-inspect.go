@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// ociScheme prefixes chart references in OCI registries, as in Helm.
+const ociScheme = "oci://"
+
+// ociManifestMediaType is the media type of the manifest of a chart pushed
+// with `helm push`.
+const ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+var inspectVersion string
+
+// chartImage is an image a chart references in its default values.
+type chartImage struct {
+	// Path is the values path of the image block or string.
+	Path  string `json:"path"`
+	Image string `json:"image"`
+	// Tag is the default tag; empty when the chart falls back to its
+	// appVersion, as most charts do.
+	Tag  string `json:"tag"`
+	Kind string `json:"kind"`
+	// Key is the values key holding the tag, e.g. image.tag.
+	Key string `json:"key"`
+	// Set is the --set argument that bumps the image in a HelmRelease.
+	Set string `json:"set"`
+}
+
+// chartInspection is the result of chart inspect.
+type chartInspection struct {
+	Chart      string       `json:"chart"`
+	Version    string       `json:"version"`
+	AppVersion string       `json:"appVersion,omitempty"`
+	Images     []chartImage `json:"images"`
+}
+
+// parseOCIChartRef splits an oci:// chart reference into its registry
+// repository and version. The version comes from version or from a tag on
+// the reference (oci://ghcr.io/org/charts/app:1.2.3); giving both is only
+// accepted if they agree.
+func parseOCIChartRef(ref, version string) (imageRegistryRef, string, error) {
+	if !strings.HasPrefix(ref, ociScheme) {
+		return imageRegistryRef{}, "", fmt.Errorf("chart %q is not an %s reference", ref, ociScheme)
+	}
+	repo := strings.TrimPrefix(ref, ociScheme)
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		tag := repo[i+1:]
+		repo = repo[:i]
+		if version != "" && version != tag {
+			return imageRegistryRef{}, "", fmt.Errorf("chart %q conflicts with --version %s", ref, version)
+		}
+		version = tag
+	}
+	if version == "" {
+		return imageRegistryRef{}, "", fmt.Errorf("chart %q needs a version (--version or %s:<version>)", ref, repo)
+	}
+	if !strings.Contains(repo, "/") {
+		return imageRegistryRef{}, "", fmt.Errorf("chart %q has no registry host", ref)
+	}
+	// Helm stores "+" in versions as "_" in OCI tags, which cannot hold it.
+	return parseImageRepository(repo), strings.ReplaceAll(version, "+", "_"), nil
+}
+
+// pullChart downloads the chart archive tagged version from its OCI
+// repository, as `helm pull` does, and checks it against the digest in the
+// manifest.
+func (c *registryClient) pullChart(ref imageRegistryRef, version string) ([]byte, error) {
+	auth, err := c.initialAuthorization(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.registryGet(ref, fmt.Sprintf("%s/v2/%s/manifests/%s", ref.baseURL(), ref.Name, url.PathEscape(version)), ociManifestMediaType, &auth)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != helmChartLayerType {
+			continue
+		}
+		archive, err := c.registryGet(ref, fmt.Sprintf("%s/v2/%s/blobs/%s", ref.baseURL(), ref.Name, layer.Digest), "", &auth)
+		if err != nil {
+			return nil, err
+		}
+		if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(archive)); digest != layer.Digest {
+			return nil, fmt.Errorf("chart archive digest %s does not match the manifest (%s)", digest, layer.Digest)
+		}
+		return archive, nil
+	}
+	return nil, fmt.Errorf("%s/%s:%s is not a Helm chart (no %s layer)", ref.Host, ref.Name, version, helmChartLayerType)
+}
+
+// registryGet returns the body of a registry API request (see
+// registryRequest).
+func (c *registryClient) registryGet(ref imageRegistryRef, target, accept string, auth *string) ([]byte, error) {
+	resp, err := c.registryRequest(ref, target, accept, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// registryRequest sends a GET request to the registry API with the
+// Authorization header *auth, authenticating into *auth when the registry
+// asks for it, and returns the response if it is a success.
+func (c *registryClient) registryRequest(ref imageRegistryRef, target, accept string, auth *string) (*http.Response, error) {
+	get := func() (*http.Response, error) {
+		resp, err := doHTTP(c.ctx, c.http, "registry request", func(ctx context.Context) (*http.Request, error) {
+			if err := c.throttle.wait(ctx, ref.Host); err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				return nil, err
+			}
+			if accept != "" {
+				req.Header.Set("Accept", accept)
+			}
+			if *auth != "" {
+				req.Header.Set("Authorization", *auth)
+			}
+			return req, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query registry: %w", err)
+		}
+		return resp, nil
+	}
+	resp, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && *auth == "" {
+		resp.Body.Close()
+		if *auth, err = c.authorize(resp.Header.Get("WWW-Authenticate"), ref); err != nil {
+			return nil, err
+		}
+		if resp, err = get(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s not found in %s", ref.Name, ref.Host)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("%s denied access to %s (%s)", ref.Host, ref.Name, resp.Status)
+	default:
+		return nil, fmt.Errorf("unexpected response from %s: %s", ref.Host, resp.Status)
+	}
+}
+
+// InspectChart lists the images a chart references in its default values,
+// with the values key that sets each tag and the --set argument that bumps
+// it in a HelmRelease overriding that key.
+//
+// Parameters:
+//   - ch: The loaded chart.
+//   - matchers: The image matchers to find references with.
+//
+// Returns:
+//   - The chart's images, sorted by image and path.
+func InspectChart(ch *chart.Chart, matchers []imageMatcher) chartInspection {
+	result := chartInspection{Chart: ch.Name(), Version: ch.Metadata.Version, AppVersion: ch.Metadata.AppVersion, Images: []chartImage{}}
+	for _, repo := range collectImageRepositories(ch.Values, matchers) {
+		for _, m := range findImageBlocks(ch.Values, repo, matchers) {
+			image := chartImage{Path: m.Path, Image: repo, Kind: "string", Key: m.Path}
+			if m.Block != nil {
+				image.Kind = "block"
+				image.Key = joinValuesPath(m.Path, m.TagKey)
+				if tag, ok := m.Block[m.TagKey]; ok && tag != nil {
+					image.Tag = fmt.Sprint(tag)
+				}
+			} else {
+				image.Tag = strings.TrimPrefix(m.Value, repo+":")
+			}
+			version := image.Tag
+			if version == "" {
+				version = ch.Metadata.AppVersion
+			}
+			image.Set = repo + "=" + version
+			result.Images = append(result.Images, image)
+		}
+	}
+	return result
+}
+
+// writeChartInspection prints the images of a chart as a table, followed by
+// the --set arguments that bump them.
+func writeChartInspection(w io.Writer, result chartInspection) error {
+	fmt.Fprintf(w, "%s %s (appVersion %s)\n\n", result.Chart, result.Version, dashIfEmpty(result.AppVersion))
+	if len(result.Images) == 0 {
+		fmt.Fprintln(w, "No image references found in the default values.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tIMAGE\tDEFAULT TAG\tTAG KEY\tKIND")
+	for _, image := range result.Images {
+		tag := image.Tag
+		if tag == "" {
+			tag = "(appVersion)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", dashIfEmpty(image.Path), image.Image, tag, dashIfEmpty(image.Key), image.Kind)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "\nBump them in a HelmRelease that sets these keys in .spec.values with:")
+	var sets []string
+	for _, image := range result.Images {
+		if set := "--set " + image.Set; !slices.Contains(sets, set) {
+			sets = append(sets, set)
+		}
+	}
+	fmt.Fprintf(w, "  flux-helpers bump -f <helmrelease.yaml> %s\n", strings.Join(sets, " "))
+	return nil
+}
+
+// loadInspectedChart loads a chart from an oci:// reference, or from a local
+// chart directory or archive.
+func loadInspectedChart(ctx context.Context, ref, version string) (*chart.Chart, error) {
+	if !strings.HasPrefix(ref, ociScheme) {
+		if _, err := os.Stat(ref); err != nil {
+			return nil, fmt.Errorf("chart %q is neither an %s reference nor a local chart: %w", ref, ociScheme, err)
+		}
+		return loader.Load(ref)
+	}
+	repo, tag, err := parseOCIChartRef(ref, version)
+	if err != nil {
+		return nil, err
+	}
+	logf("⬇️ Pulling %s%s/%s:%s\n", ociScheme, repo.Host, repo.Name, tag)
+	archive, err := newRegistryClient(ctx).pullChart(repo, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+	ch, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", ref, err)
+	}
+	return ch, nil
+}
+
+var chartInspectCmd = &cobra.Command{
+	Use:   "inspect <oci://registry/repository/chart | chart dir>",
+	Short: "List the images of a chart and the --set arguments that bump them",
+	Long: `Pull a chart from an OCI registry (or load a local chart), list the images its
+default values reference with the values keys that set their tags, and suggest
+the --set arguments that bump them in a HelmRelease.`,
+	Example: `  flux-helpers chart inspect oci://ghcr.io/my-org/charts/my-app --version 1.2.3
+  flux-helpers chart inspect oci://ghcr.io/my-org/charts/my-app:1.2.3 -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+		ch, err := loadInspectedChart(cmd.Context(), args[0], inspectVersion)
+		if err != nil {
+			return err
+		}
+		result := InspectChart(ch, matchers)
+		if outputFormat == outputJSON {
+			return writeJSON(os.Stdout, result)
+		}
+		return writeChartInspection(os.Stdout, result)
+	},
+}
+
+func init() {
+	chartInspectCmd.Flags().StringVar(&inspectVersion, "version", "", "Chart version to pull (or append :<version> to the reference)")
+	chartInspectCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	chartInspectCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	chartCmd.AddCommand(chartInspectCmd)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// newTestChartRegistry serves test_files/test_chart, with an extra image
+// that defaults to the appVersion, as my-org/charts/test-chart:0.1.0,
+// requiring a token like ghcr.io does.
+func newTestChartRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+	ch, err := loader.Load("test_files/test_chart")
+	if err != nil {
+		t.Fatalf("Failed to load chart: %v", err)
+	}
+	for _, f := range ch.Raw {
+		if f.Name == "values.yaml" {
+			f.Data = append(f.Data, "sidecar:\n  repository: ghcr.io/my-org/sidecar\n  tag: \"\"\n"...)
+		}
+	}
+	archivePath, err := chartutil.Save(ch, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(archive))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token":"secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/my-org/charts/test-chart/manifests/0.1.0":
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"mediaType":%q,"digest":%q}]}`, helmChartLayerType, digest)
+		case "/v2/my-org/charts/test-chart/blobs/" + digest:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestInspectOCIChart verifies that a chart is pulled from an OCI registry
+// and its default images are listed with their tag keys and --set
+// arguments.
+func TestInspectOCIChart(t *testing.T) {
+	srv := newTestChartRegistry(t)
+	ref := "oci://" + strings.Replace(strings.TrimPrefix(srv.URL, "http://"), "127.0.0.1", "localhost", 1) + "/my-org/charts/test-chart"
+
+	ch, err := loadInspectedChart(context.Background(), ref, "0.1.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result := InspectChart(ch, nil)
+	if result.Chart != "test-chart" || len(result.Images) != 2 {
+		t.Fatalf("Expected 2 images of test-chart, got %+v", result)
+	}
+	want := map[string]chartImage{
+		"ghcr.io/my-org/sidecar": {Path: "sidecar", Image: "ghcr.io/my-org/sidecar", Kind: "block", Key: "sidecar.tag", Set: "ghcr.io/my-org/sidecar=" + ch.Metadata.AppVersion},
+		"nginx":                  {Path: "image", Image: "nginx", Tag: "latest", Kind: "block", Key: "image.tag", Set: "nginx=latest"},
+	}
+	for _, image := range result.Images {
+		if image != want[image.Image] {
+			t.Errorf("Expected %+v, got %+v", want[image.Image], image)
+		}
+	}
+
+	if _, err := loadInspectedChart(context.Background(), ref+":0.2.0", ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a missing version to fail, got %v", err)
+	}
+}
+
+// TestParseOCIChartRef verifies version handling of oci:// references.
+func TestParseOCIChartRef(t *testing.T) {
+	ref, version, err := parseOCIChartRef("oci://ghcr.io/my-org/charts/app:1.2.3+build.1", "")
+	if err != nil || ref != (imageRegistryRef{Host: "ghcr.io", Name: "my-org/charts/app"}) || version != "1.2.3_build.1" {
+		t.Errorf("Unexpected result %+v, %q, %v", ref, version, err)
+	}
+	for _, tc := range [][2]string{
+		{"oci://ghcr.io/my-org/charts/app", ""},
+		{"oci://ghcr.io/my-org/charts/app:1.2.3", "1.2.4"},
+		{"https://charts.example.com/app", "1.0.0"},
+	} {
+		if _, _, err := parseOCIChartRef(tc[0], tc[1]); err == nil {
+			t.Errorf("Expected %s --version %q to be rejected", tc[0], tc[1])
+		}
+	}
+	if _, err := loadInspectedChart(context.Background(), filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("Expected a missing local chart to be rejected")
+	}
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/lint"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+var (
+	lintFix    bool
+	lintStrict bool
+)
+
+// apiDeprecation describes a deprecated apiVersion of a Kubernetes kind.
+type apiDeprecation struct {
+	Kind       string
+	APIVersion string
+	// Replacement is the apiVersion to use instead; empty if the kind was
+	// removed without one.
+	Replacement string
+	// DeprecatedIn and RemovedIn are Kubernetes minor versions, e.g. "1.21".
+	DeprecatedIn string
+	RemovedIn    string
+	// Fixable reports whether rewriting the apiVersion is enough, i.e. the
+	// replacement accepts the old schema. Requires names a path the manifest
+	// must set for that to hold.
+	Fixable  bool
+	Requires string
+}
+
+// apiDeprecations lists the deprecated apiVersions of built-in kinds.
+var apiDeprecations = []apiDeprecation{
+	{Kind: "PodDisruptionBudget", APIVersion: "policy/v1beta1", Replacement: "policy/v1", DeprecatedIn: "1.21", RemovedIn: "1.25", Fixable: true},
+	{Kind: "PodSecurityPolicy", APIVersion: "policy/v1beta1", DeprecatedIn: "1.21", RemovedIn: "1.25"},
+	{Kind: "CronJob", APIVersion: "batch/v1beta1", Replacement: "batch/v1", DeprecatedIn: "1.21", RemovedIn: "1.25", Fixable: true},
+	{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2beta1", Replacement: "autoscaling/v2", DeprecatedIn: "1.22", RemovedIn: "1.25"},
+	{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v2beta2", Replacement: "autoscaling/v2", DeprecatedIn: "1.23", RemovedIn: "1.26", Fixable: true},
+	{Kind: "Ingress", APIVersion: "extensions/v1beta1", Replacement: "networking.k8s.io/v1", DeprecatedIn: "1.14", RemovedIn: "1.22"},
+	{Kind: "Ingress", APIVersion: "networking.k8s.io/v1beta1", Replacement: "networking.k8s.io/v1", DeprecatedIn: "1.19", RemovedIn: "1.22"},
+	{Kind: "IngressClass", APIVersion: "networking.k8s.io/v1beta1", Replacement: "networking.k8s.io/v1", DeprecatedIn: "1.19", RemovedIn: "1.22", Fixable: true},
+	{Kind: "NetworkPolicy", APIVersion: "extensions/v1beta1", Replacement: "networking.k8s.io/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true},
+	{Kind: "Deployment", APIVersion: "extensions/v1beta1", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true, Requires: "spec.selector"},
+	{Kind: "Deployment", APIVersion: "apps/v1beta1", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true, Requires: "spec.selector"},
+	{Kind: "Deployment", APIVersion: "apps/v1beta2", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true},
+	{Kind: "DaemonSet", APIVersion: "extensions/v1beta1", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true, Requires: "spec.selector"},
+	{Kind: "DaemonSet", APIVersion: "apps/v1beta2", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true},
+	{Kind: "StatefulSet", APIVersion: "apps/v1beta1", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true, Requires: "spec.selector"},
+	{Kind: "StatefulSet", APIVersion: "apps/v1beta2", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true},
+	{Kind: "ReplicaSet", APIVersion: "extensions/v1beta1", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true, Requires: "spec.selector"},
+	{Kind: "ReplicaSet", APIVersion: "apps/v1beta2", Replacement: "apps/v1", DeprecatedIn: "1.9", RemovedIn: "1.16", Fixable: true},
+	{Kind: "Role", APIVersion: "rbac.authorization.k8s.io/v1beta1", Replacement: "rbac.authorization.k8s.io/v1", DeprecatedIn: "1.17", RemovedIn: "1.22", Fixable: true},
+	{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1beta1", Replacement: "rbac.authorization.k8s.io/v1", DeprecatedIn: "1.17", RemovedIn: "1.22", Fixable: true},
+	{Kind: "RoleBinding", APIVersion: "rbac.authorization.k8s.io/v1beta1", Replacement: "rbac.authorization.k8s.io/v1", DeprecatedIn: "1.17", RemovedIn: "1.22", Fixable: true},
+	{Kind: "ClusterRoleBinding", APIVersion: "rbac.authorization.k8s.io/v1beta1", Replacement: "rbac.authorization.k8s.io/v1", DeprecatedIn: "1.17", RemovedIn: "1.22", Fixable: true},
+	{Kind: "PriorityClass", APIVersion: "scheduling.k8s.io/v1beta1", Replacement: "scheduling.k8s.io/v1", DeprecatedIn: "1.14", RemovedIn: "1.22", Fixable: true},
+	{Kind: "StorageClass", APIVersion: "storage.k8s.io/v1beta1", Replacement: "storage.k8s.io/v1", DeprecatedIn: "1.19", RemovedIn: "1.22", Fixable: true},
+	{Kind: "CSIStorageCapacity", APIVersion: "storage.k8s.io/v1beta1", Replacement: "storage.k8s.io/v1", DeprecatedIn: "1.24", RemovedIn: "1.27", Fixable: true},
+	{Kind: "RuntimeClass", APIVersion: "node.k8s.io/v1beta1", Replacement: "node.k8s.io/v1", DeprecatedIn: "1.20", RemovedIn: "1.25", Fixable: true},
+	{Kind: "EndpointSlice", APIVersion: "discovery.k8s.io/v1beta1", Replacement: "discovery.k8s.io/v1", DeprecatedIn: "1.21", RemovedIn: "1.25"},
+	{Kind: "CustomResourceDefinition", APIVersion: "apiextensions.k8s.io/v1beta1", Replacement: "apiextensions.k8s.io/v1", DeprecatedIn: "1.16", RemovedIn: "1.22"},
+	{Kind: "MutatingWebhookConfiguration", APIVersion: "admissionregistration.k8s.io/v1beta1", Replacement: "admissionregistration.k8s.io/v1", DeprecatedIn: "1.16", RemovedIn: "1.22"},
+	{Kind: "ValidatingWebhookConfiguration", APIVersion: "admissionregistration.k8s.io/v1beta1", Replacement: "admissionregistration.k8s.io/v1", DeprecatedIn: "1.16", RemovedIn: "1.22"},
+	{Kind: "FlowSchema", APIVersion: "flowcontrol.apiserver.k8s.io/v1beta2", Replacement: "flowcontrol.apiserver.k8s.io/v1", DeprecatedIn: "1.26", RemovedIn: "1.29", Fixable: true},
+	{Kind: "FlowSchema", APIVersion: "flowcontrol.apiserver.k8s.io/v1beta3", Replacement: "flowcontrol.apiserver.k8s.io/v1", DeprecatedIn: "1.29", RemovedIn: "1.32", Fixable: true},
+	{Kind: "PriorityLevelConfiguration", APIVersion: "flowcontrol.apiserver.k8s.io/v1beta2", Replacement: "flowcontrol.apiserver.k8s.io/v1", DeprecatedIn: "1.26", RemovedIn: "1.29", Fixable: true},
+	{Kind: "PriorityLevelConfiguration", APIVersion: "flowcontrol.apiserver.k8s.io/v1beta3", Replacement: "flowcontrol.apiserver.k8s.io/v1", DeprecatedIn: "1.29", RemovedIn: "1.32", Fixable: true},
+}
+
+// findAPIDeprecation returns the deprecation of apiVersion for kind, or nil.
+func findAPIDeprecation(kind, apiVersion string) *apiDeprecation {
+	for i, d := range apiDeprecations {
+		if d.Kind == kind && d.APIVersion == apiVersion {
+			return &apiDeprecations[i]
+		}
+	}
+	return nil
+}
+
+// chartLintFix is a change made (or proposed) by chart lint --fix.
+type chartLintFix struct {
+	File        string `json:"file"`
+	Description string `json:"description"`
+	// Manual is set for problems that were found but need a manual change.
+	Manual bool `json:"manual,omitempty"`
+}
+
+// chartLintMessage is a finding of helm lint.
+type chartLintMessage struct {
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+// chartLintReport is the machine-readable result of chart lint.
+type chartLintReport struct {
+	Chart    string             `json:"chart"`
+	DryRun   bool               `json:"dryRun,omitempty"`
+	Fixes    []chartLintFix     `json:"fixes,omitempty"`
+	Messages []chartLintMessage `json:"messages"`
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+}
+
+// lintSeverityNames names the severities of helm lint messages.
+var lintSeverityNames = map[int]string{
+	support.UnknownSev: "unknown",
+	support.InfoSev:    "info",
+	support.WarningSev: "warning",
+	support.ErrorSev:   "error",
+}
+
+// lintChart runs the helm lint rules on the chart in chartDir with its
+// default values and records the findings in report.
+func lintChart(chartDir string, report *chartLintReport) {
+	linter := lint.All(chartDir, nil, "default", false)
+	report.Messages, report.Errors, report.Warnings = nil, 0, 0
+	for _, msg := range linter.Messages {
+		report.Messages = append(report.Messages, chartLintMessage{
+			Severity: lintSeverityNames[msg.Severity],
+			Path:     msg.Path,
+			Message:  msg.Err.Error(),
+		})
+		switch msg.Severity {
+		case support.ErrorSev:
+			report.Errors++
+		case support.WarningSev:
+			report.Warnings++
+		}
+	}
+}
+
+// chartMetadataDefaults are the Chart.yaml fields chart lint --fix adds when
+// they are missing, with the chart directory name standing in for "NAME".
+var chartMetadataDefaults = []struct{ key, value string }{
+	{"apiVersion", "v2"},
+	{"name", "NAME"},
+	{"description", "A Helm chart for Kubernetes"},
+	{"version", "0.1.0"},
+}
+
+// fixChartMetadata adds the missing fields of chartMetadataDefaults to the
+// Chart.yaml data and normalises a version that is not strict SemVer 2 (e.g.
+// "1.2" becomes "1.2.0"). Missing fields are appended so the rest of the
+// file is left as it is.
+//
+// Returns:
+//   - The updated Chart.yaml data.
+//   - The fixes made.
+//   - An error if the data is not a YAML mapping.
+func fixChartMetadata(data []byte, chartName string) ([]byte, []string, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid YAML in Chart.yaml: %w", err)
+	}
+	root := yamlDocumentRoot(&doc)
+	if doc.Kind != 0 && root.Kind != yamlv3.MappingNode {
+		return nil, nil, fmt.Errorf("Chart.yaml is not a mapping")
+	}
+
+	var fixes []string
+	var patches []scalarPatch
+	if version := yamlMappingValue(root, "version"); version != nil && version.Kind == yamlv3.ScalarNode {
+		if _, err := semver.StrictNewVersion(version.Value); err != nil {
+			if v, err := semver.NewVersion(version.Value); err == nil {
+				patches = append(patches, scalarPatch{node: version, value: v.String()})
+				fixes = append(fixes, fmt.Sprintf("normalised version %q to %q", version.Value, v.String()))
+			}
+		}
+	}
+	out, err := applyScalarPatches(data, patches)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eol := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	for _, field := range chartMetadataDefaults {
+		if yamlMappingValue(root, field.key) != nil {
+			continue
+		}
+		value := strings.ReplaceAll(field.value, "NAME", chartName)
+		if len(out) > 0 && !bytes.HasSuffix(out, []byte("\n")) {
+			out = append(out, eol...)
+		}
+		out = append(out, fmt.Sprintf("%s: %s%s", field.key, value, eol)...)
+		fixes = append(fixes, fmt.Sprintf("added missing %s: %s", field.key, value))
+	}
+	return out, fixes, nil
+}
+
+// manifestDocumentSeparator matches the line separating YAML documents.
+var manifestDocumentSeparator = regexp.MustCompile(`^---\s*$`)
+
+// apiVersionLine matches a top-level apiVersion set literally.
+var apiVersionLine = regexp.MustCompile(`^apiVersion:\s*["']?([A-Za-z0-9./-]+)["']?\s*$`)
+
+// fixTemplateAPIVersions rewrites the literal top-level apiVersion of every
+// document of a chart template that uses a fixable deprecated apiVersion of
+// its kind, see apiDeprecations.
+//
+// Returns:
+//   - The updated template data.
+//   - The fixes made.
+//   - The deprecations that need a manual change.
+func fixTemplateAPIVersions(data []byte) ([]byte, []string, []string) {
+	lines := strings.Split(string(data), "\n")
+	var fixes, manual []string
+
+	start := 0
+	for start < len(lines) {
+		end := start
+		for end < len(lines) && (end == start || !manifestDocumentSeparator.MatchString(lines[end])) {
+			end++
+		}
+		doc := lines[start:end]
+		kind := templateKind([]byte(strings.Join(doc, "\n")))
+		for i, line := range doc {
+			match := apiVersionLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+			if match == nil {
+				continue
+			}
+			d := findAPIDeprecation(kind, match[1])
+			if d == nil {
+				break
+			}
+			if d.Requires != "" && !templateHasPath(doc, d.Requires) {
+				manual = append(manual, fmt.Sprintf("%s %s is removed in Kubernetes %s; %s requires %s", kind, d.APIVersion, d.RemovedIn, d.Replacement, d.Requires))
+				break
+			}
+			if !d.Fixable {
+				to := "it has no replacement"
+				if d.Replacement != "" {
+					to = "migrate to " + d.Replacement + ", whose schema differs"
+				}
+				manual = append(manual, fmt.Sprintf("%s %s is removed in Kubernetes %s; %s", kind, d.APIVersion, d.RemovedIn, to))
+				break
+			}
+			doc[i] = strings.Replace(line, d.APIVersion, d.Replacement, 1)
+			fixes = append(fixes, fmt.Sprintf("%s apiVersion %s -> %s (removed in Kubernetes %s)", kind, d.APIVersion, d.Replacement, d.RemovedIn))
+			break
+		}
+		start = end
+	}
+	return []byte(strings.Join(lines, "\n")), fixes, manual
+}
+
+// templateHasPath reports whether the template lines set the dotted path.
+func templateHasPath(lines []string, path string) bool {
+	for _, l := range scanTemplateLines(lines) {
+		if l != nil && l.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// templateValuesRef matches a reference to a values key in a template action,
+// e.g. `.Values.image.tag` or `$.Values.image.tag`.
+var templateValuesRef = regexp.MustCompile(`\$?\.Values((?:\.[A-Za-z_][A-Za-z0-9_]*)+)`)
+
+// rangeAction, mapAction and toYamlPipe match the template action around a
+// values reference that ranges over it, uses it as a map, or pipes it to
+// toYaml.
+var (
+	rangeAction = regexp.MustCompile(`\brange\s+(\$\w+\s*(,\s*\$\w+\s*)?:=\s*)?$`)
+	mapAction   = regexp.MustCompile(`\b(toYaml|with)\s+$`)
+	toYamlPipe  = regexp.MustCompile(`^\s*\|\s*toYaml\b`)
+)
+
+// templateValuesReferences returns the values keys the templates reference,
+// each with the default chart lint --fix gives it: an empty list for keys
+// ranged over, an empty map for keys passed to toYaml or with and an empty
+// string otherwise. Keys that are a prefix of another reference are left out,
+// as the longer reference implies they are maps.
+func templateValuesReferences(templates map[string][]byte) map[string]interface{} {
+	refs := map[string]interface{}{}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := string(templates[name])
+		for _, loc := range templateValuesRef.FindAllStringSubmatchIndex(data, -1) {
+			key := strings.TrimPrefix(data[loc[2]:loc[3]], ".")
+			action := data[:loc[0]]
+			if open := strings.LastIndex(action, "{{"); open >= 0 {
+				action = action[open:]
+			}
+			rest := data[loc[1]:]
+			if end := strings.Index(rest, "}}"); end >= 0 {
+				rest = rest[:end]
+			}
+
+			var def interface{} = ""
+			switch {
+			case rangeAction.MatchString(action):
+				def = []interface{}{}
+			case mapAction.MatchString(action), toYamlPipe.MatchString(rest):
+				def = map[string]interface{}{}
+			}
+			if _, seen := refs[key]; !seen {
+				refs[key] = def
+			} else if _, isString := refs[key].(string); isString {
+				refs[key] = def
+			}
+		}
+	}
+	for key := range refs {
+		for other := range refs {
+			if strings.HasPrefix(other, key+".") {
+				delete(refs, key)
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// addMissingValues adds the keys of refs that the values.yaml data does not
+// define, with their defaults, keeping its comments. Keys below a value that
+// is not a map are left alone.
+//
+// Returns:
+//   - The updated values.yaml data.
+//   - The keys added, in order.
+//   - An error if the data cannot be parsed or encoded.
+func addMissingValues(data []byte, refs map[string]interface{}) ([]byte, []string, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid YAML in values.yaml: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}}}
+	}
+	root := yamlDocumentRoot(&doc)
+	if root.Kind != yamlv3.MappingNode {
+		return nil, nil, fmt.Errorf("values.yaml is not a mapping")
+	}
+
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var added []string
+	for _, key := range keys {
+		node := root
+		parts := strings.Split(key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			value := yamlMappingValue(node, part)
+			if value != nil && value.Kind == yamlv3.ScalarNode && value.Tag == "!!null" {
+				*value = yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+			}
+			if value == nil {
+				value = ensureYAMLMapping(node, part)
+			}
+			if value.Kind != yamlv3.MappingNode {
+				node = nil
+				break
+			}
+			value.Style &^= yamlv3.FlowStyle
+			node = value
+		}
+		leaf := parts[len(parts)-1]
+		if node == nil || yamlMappingValue(node, leaf) != nil {
+			continue
+		}
+		var value yamlv3.Node
+		if err := value.Encode(refs[key]); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode default of %s: %w", key, err)
+		}
+		node.Content = append(node.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: leaf}, &value)
+		added = append(added, key)
+	}
+	if len(added) == 0 {
+		return data, nil, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode values.yaml: %w", err)
+	}
+	return detectTextFormat(data).apply(buf.Bytes()), added, nil
+}
+
+// fixChart fixes the problems chart lint --fix understands in the chart in
+// chartDir: missing Chart.yaml fields and a non-SemVer version, deprecated
+// apiVersions of templates, and values keys the templates reference but
+// values.yaml lacks.
+//
+// Parameters:
+//   - chartDir: The path to the Helm chart directory.
+//   - opts: Dry-run and diff settings.
+//
+// Returns:
+//   - The fixes made (or that would be made), and the problems found that
+//     need a manual change.
+//   - An error if the chart cannot be read or a file cannot be written.
+func fixChart(chartDir string, opts chartInjectOptions) ([]chartLintFix, error) {
+	var fixes []chartLintFix
+	updates := map[string][]byte{}
+	originals := map[string][]byte{}
+
+	data, err := os.ReadFile(filepath.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Chart.yaml: %w", err)
+	}
+	absDir, err := filepath.Abs(chartDir)
+	if err != nil {
+		return nil, err
+	}
+	updated, metadataFixes, err := fixChartMetadata(data, filepath.Base(absDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, fix := range metadataFixes {
+		fixes = append(fixes, chartLintFix{File: "Chart.yaml", Description: fix})
+	}
+	if len(metadataFixes) > 0 {
+		originals["Chart.yaml"], updates["Chart.yaml"] = data, updated
+	}
+
+	// The templates are read directly, as loading the chart fails on the
+	// metadata problems fixed above.
+	templates, err := readChartTemplates(chartDir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		updated, apiFixes, manual := fixTemplateAPIVersions(templates[name])
+		for _, fix := range apiFixes {
+			fixes = append(fixes, chartLintFix{File: name, Description: fix})
+		}
+		for _, problem := range manual {
+			fixes = append(fixes, chartLintFix{File: name, Description: problem, Manual: true})
+		}
+		if len(apiFixes) > 0 {
+			originals[name], updates[name] = templates[name], updated
+		}
+	}
+
+	valuesFile := filepath.Join(chartDir, "values.yaml")
+	data, err = os.ReadFile(valuesFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read values.yaml: %w", err)
+	}
+	updated, added, err := addMissingValues(data, templateValuesReferences(templates))
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range added {
+		fixes = append(fixes, chartLintFix{File: "values.yaml", Description: "added " + key + " referenced by the templates"})
+	}
+	if len(added) > 0 {
+		originals["values.yaml"], updates["values.yaml"] = data, updated
+	}
+
+	files := make([]string, 0, len(updates))
+	for name := range updates {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		path := filepath.Join(chartDir, name)
+		if opts.Diff {
+			logf("%s", unifiedDiff("a/"+name, "b/"+name, originals[name], updates[name]))
+		}
+		if opts.DryRun {
+			logf("[dry-run] Would write fixed %s to %s\n", name, path)
+			continue
+		}
+		if err := writeFileAudited(path, updates[name], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write fixed %s: %w", name, err)
+		}
+		logf("💾 Wrote fixed %s to %s\n", name, path)
+	}
+	return fixes, nil
+}
+
+// readChartTemplates reads the files below the templates directory of the
+// chart in chartDir, keyed by their slash-separated path relative to chartDir,
+// e.g. "templates/deployment.yaml".
+func readChartTemplates(chartDir string) (map[string][]byte, error) {
+	templates := map[string][]byte{}
+	err := filepath.WalkDir(filepath.Join(chartDir, "templates"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(chartDir, path)
+		if err != nil {
+			return err
+		}
+		templates[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the templates of %s: %w", chartDir, err)
+	}
+	return templates, nil
+}
+
+// writeChartLintReport prints the findings and fixes of report as text.
+func writeChartLintReport(report *chartLintReport) {
+	for _, fix := range report.Fixes {
+		if fix.Manual {
+			logf("⚠️ %s: %s (fix manually)\n", fix.File, fix.Description)
+		} else {
+			logf("🔧 %s: %s\n", fix.File, fix.Description)
+		}
+	}
+	for _, msg := range report.Messages {
+		logf("[%s] %s: %s\n", strings.ToUpper(msg.Severity), msg.Path, msg.Message)
+	}
+	logf("🔎 %s: %d error(s), %d warning(s)\n", report.Chart, report.Errors, report.Warnings)
+}
+
+var chartLintCmd = &cobra.Command{
+	Use:   "lint [CHART]",
+	Short: "Lint a Helm chart and fix the problems flux-helpers understands",
+	Long: `Run the helm lint rules on a Helm chart and, with --fix, fix the problems
+flux-helpers understands before linting:
+
+  - Chart.yaml fields that are missing (apiVersion, name, description and
+    version) are added, and a version that is not strict SemVer 2 (e.g. 1.2)
+    is normalised;
+  - deprecated apiVersions whose replacement accepts the same manifest (e.g.
+    policy/v1beta1 PodDisruptionBudget or batch/v1beta1 CronJob) are rewritten,
+    and the others (e.g. extensions/v1beta1 Ingress) are reported for a manual
+    change;
+  - values keys the templates reference but values.yaml lacks are added with
+    an empty default.
+
+The command fails if the lint finds errors, or warnings with --strict.`,
+	Example: `  flux-helpers chart lint ./charts/my-app
+  flux-helpers chart lint --fix --dry-run --diff ./charts/my-app`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := chartPath
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if dir == "" {
+			return fmt.Errorf("you must specify a chart directory")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+
+		report := &chartLintReport{Chart: dir, DryRun: injectDryRun}
+		if lintFix {
+			fixes, err := fixChart(dir, chartInjectOptions{DryRun: injectDryRun, Diff: injectDiff})
+			if err != nil {
+				return fmt.Errorf("failed to fix %s: %w", dir, err)
+			}
+			report.Fixes = fixes
+			changed := false
+			for _, fix := range fixes {
+				changed = changed || !fix.Manual
+			}
+			noChangesMade = !changed
+		}
+		lintChart(dir, report)
+
+		if outputFormat == outputJSON {
+			if err := writeJSON(os.Stdout, report); err != nil {
+				return err
+			}
+		} else {
+			writeChartLintReport(report)
+		}
+		if report.Errors > 0 || (lintStrict && report.Warnings > 0) {
+			return fmt.Errorf("chart %s failed linting: %d error(s), %d warning(s)", dir, report.Errors, report.Warnings)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := chartLintCmd.Flags()
+	flags.StringVar(&chartPath, "chart", "", "Path to Helm chart directory (alternative to the argument)")
+	flags.BoolVar(&lintFix, "fix", false, "Fix the problems flux-helpers understands before linting")
+	flags.BoolVar(&lintStrict, "strict", false, "Fail on lint warnings too")
+	flags.BoolVar(&injectDryRun, "dry-run", false, "With --fix, report the fixes without writing them")
+	flags.BoolVar(&injectDiff, "diff", false, "With --fix, print a unified diff of every file that changes")
+	flags.StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	chartCmd.AddCommand(chartLintCmd)
+}
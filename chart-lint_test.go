@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFixChart verifies that chart lint --fix completes Chart.yaml, rewrites
+// fixable deprecated apiVersions, reports the others and adds the values keys
+// the templates reference, after which the chart lints clean.
+func TestFixChart(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "legacy")
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: legacy\nversion: \"1.2\"\n",
+		"values.yaml": "# Image settings\nimage:\n  repository: nginx # upstream\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  selector:
+    matchLabels:
+      app: legacy
+  template:
+    metadata:
+      labels:
+        app: legacy
+    spec:
+      containers:
+        - name: app
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+          resources:
+            {{- toYaml .Values.resources | nindent 12 }}
+          env:
+            {{- range .Values.extraEnv }}
+            - name: {{ .name }}
+              value: {{ .value | quote }}
+            {{- end }}
+`,
+		"templates/pdb.yaml": `apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      app: legacy
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  backend:
+    serviceName: legacy
+    servicePort: 80
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixes, err := fixChart(dir, chartInjectOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var manual []string
+	for _, fix := range fixes {
+		if fix.Manual {
+			manual = append(manual, fix.File+": "+fix.Description)
+		}
+	}
+	if len(manual) != 1 || !strings.Contains(manual[0], "Ingress extensions/v1beta1") {
+		t.Errorf("Expected the Ingress to need a manual fix, got %v", manual)
+	}
+
+	chartYAML, _ := os.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if want := "apiVersion: v2\nname: legacy\nversion: \"1.2.0\"\ndescription: A Helm chart for Kubernetes\n"; string(chartYAML) != want {
+		t.Errorf("Expected Chart.yaml:\n%s\ngot:\n%s", want, chartYAML)
+	}
+	pdb, _ := os.ReadFile(filepath.Join(dir, "templates", "pdb.yaml"))
+	if !strings.HasPrefix(string(pdb), "apiVersion: policy/v1\n") || !strings.Contains(string(pdb), "apiVersion: extensions/v1beta1\nkind: Ingress") {
+		t.Errorf("Expected only the PodDisruptionBudget apiVersion to be rewritten, got:\n%s", pdb)
+	}
+	values, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	want := "# Image settings\nimage:\n  repository: nginx # upstream\n  tag: \"\"\nextraEnv: []\nresources: {}\n"
+	if string(values) != want {
+		t.Errorf("Expected values.yaml:\n%s\ngot:\n%s", want, values)
+	}
+
+	report := &chartLintReport{Chart: dir}
+	lintChart(dir, report)
+	if report.Errors > 0 {
+		t.Errorf("Expected the fixed chart to lint without errors, got %+v", report.Messages)
+	}
+
+	fixes, err = fixChart(dir, chartInjectOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error on second run: %v", err)
+	}
+	if len(fixes) != 1 || !fixes[0].Manual {
+		t.Errorf("Expected only the manual Ingress fix on the second run, got %+v", fixes)
+	}
+}
+
+// TestTemplateValuesReferences verifies the defaults given to referenced
+// values keys and that keys implied by longer references are left out.
+func TestTemplateValuesReferences(t *testing.T) {
+	refs := templateValuesReferences(map[string][]byte{
+		"templates/a.yaml": []byte(`{{- with .Values.nodeSelector }}{{ $.Values.image.tag }}{{ .Values.image | quote }}{{- range $i, $v := .Values.hosts }}{{ end }}{{ end }}`),
+	})
+	if len(refs) != 3 {
+		t.Fatalf("Expected 3 references, got %v", refs)
+	}
+	if _, ok := refs["nodeSelector"].(map[string]interface{}); !ok {
+		t.Errorf("Expected nodeSelector to default to a map, got %#v", refs["nodeSelector"])
+	}
+	if _, ok := refs["hosts"].([]interface{}); !ok {
+		t.Errorf("Expected hosts to default to a list, got %#v", refs["hosts"])
+	}
+	if refs["image.tag"] != "" {
+		t.Errorf("Expected image.tag to default to an empty string, got %#v", refs["image.tag"])
+	}
+}
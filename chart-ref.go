@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+)
+
+// chartRefKinds are the source kinds a HelmRelease's .spec.chartRef may
+// reference.
+var chartRefKinds = []string{"OCIRepository", "HelmChart"}
+
+// chartSourceRef is the .spec.chartRef of a HelmRelease: the OCIRepository
+// or HelmChart holding its chart.
+type chartSourceRef struct {
+	Kind string
+	Name string
+	// Namespace defaults to the namespace of the HelmRelease.
+	Namespace string
+}
+
+// String returns the reference as Kind/namespace/name, or Kind/name without
+// a namespace.
+func (r chartSourceRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// validateChartSource checks the chart fields of a decoded HelmRelease the
+// way the Flux API server does: .spec.chart and .spec.chartRef are mutually
+// exclusive, and a chartRef names an OCIRepository or HelmChart.
+func validateChartSource(m *helmReleaseManifest) error {
+	ref := m.ChartRef()
+	if ref == nil {
+		return nil
+	}
+	if m.ChartSpec() != nil {
+		return fmt.Errorf("HelmRelease sets both .spec.chart and .spec.chartRef (Flux accepts only one)")
+	}
+	if !slices.Contains(chartRefKinds, ref.Kind) {
+		return fmt.Errorf("unsupported .spec.chartRef kind %q (expected %s)", ref.Kind, strings.Join(chartRefKinds, " or "))
+	}
+	if ref.Name == "" {
+		return fmt.Errorf(".spec.chartRef has no name")
+	}
+	return nil
+}
+
+// sourceManifest is a Flux source object found in a manifest file.
+type sourceManifest struct {
+	File   string
+	Object map[string]interface{}
+}
+
+// spec returns the .spec of the source object, or an empty map.
+func (s *sourceManifest) spec() map[string]interface{} {
+	spec, _ := s.Object["spec"].(map[string]interface{})
+	if spec == nil {
+		return map[string]interface{}{}
+	}
+	return spec
+}
+
+// findChartSource looks up the source object ref points at in the
+// repository of the HelmRelease at hrPath: the git work tree holding it, or
+// its directory outside of git. Documents without a namespace match any
+// namespace. When several files define the object, as with one copy per
+// environment, the one closest to the HelmRelease wins.
+//
+// Returns:
+//   - The source object and the file defining it.
+//   - An error if it is not found, or found at the same distance more than
+//     once.
+func findChartSource(hrPath string, ref chartSourceRef) (*sourceManifest, error) {
+	hrDir, err := filepath.Abs(filepath.Dir(hrPath))
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(hrDir); err == nil {
+		hrDir = resolved
+	}
+	root := hrDir
+	if top, err := runGit(hrDir, "rev-parse", "--show-toplevel"); err == nil {
+		root = filepath.FromSlash(strings.TrimSpace(top))
+	}
+
+	var matches []*sourceManifest
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, doc := range splitYAMLDocuments(data) {
+			var obj map[string]interface{}
+			if err := yaml.Unmarshal(doc, &obj); err != nil || obj == nil {
+				continue
+			}
+			apiVersion, _ := obj["apiVersion"].(string)
+			metadata, _ := obj["metadata"].(map[string]interface{})
+			namespace, _ := metadata["namespace"].(string)
+			if !strings.HasPrefix(apiVersion, sourceAPIGroup+"/") || obj["kind"] != ref.Kind || metadata["name"] != ref.Name ||
+				(namespace != "" && ref.Namespace != "" && namespace != ref.Namespace) {
+				continue
+			}
+			matches = append(matches, &sourceManifest{File: path, Object: obj})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for %s: %w", ref, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s referenced by %s not found in %s", ref, hrPath, root)
+	}
+
+	closest, best := []*sourceManifest{}, -1
+	for _, m := range matches {
+		switch depth := commonPathDepth(hrDir, filepath.Dir(m.File)); {
+		case depth > best:
+			closest, best = []*sourceManifest{m}, depth
+		case depth == best:
+			closest = append(closest, m)
+		}
+	}
+	if len(closest) > 1 {
+		var files []string
+		for _, m := range closest {
+			files = append(files, m.File)
+		}
+		return nil, fmt.Errorf("%s referenced by %s is defined more than once: %s", ref, hrPath, strings.Join(files, ", "))
+	}
+	return closest[0], nil
+}
+
+// commonPathDepth returns the number of leading path elements a and b share.
+func commonPathDepth(a, b string) int {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return n
+}
+
+// bumpChartRefSource bumps the chart version of a HelmRelease that uses
+// .spec.chartRef, which is set by its source rather than the HelmRelease: the
+// .spec.ref of an OCIRepository (the semver range if it uses one or version
+// is a range, the tag otherwise) or the .spec.version of a HelmChart.
+//
+// Returns:
+//   - The changes made to the source manifest, see BumpSourceFile.
+//   - An error if bump changes fields only .spec.chart has, or the source
+//     cannot be found or bumped.
+func bumpChartRefSource(filePath string, ref chartSourceRef, bump chartBump, dryRun bool) ([]tagChange, error) {
+	if bump.Chart != "" || bump.SourceKind != "" || bump.SourceName != "" || bump.SourceNamespace != "" {
+		return nil, fmt.Errorf("%s uses .spec.chartRef; --chart and --source-* only apply to .spec.chart", filePath)
+	}
+	source, err := findChartSource(filePath, ref)
+	if err != nil {
+		return nil, err
+	}
+	logf("🔗 Following .spec.chartRef %s to %s\n", ref, source.File)
+
+	update := sourceBump{Kind: ref.Kind, Name: ref.Name, Tag: bump.Version}
+	if ref.Kind == "OCIRepository" {
+		specRef, _ := source.spec()["ref"].(map[string]interface{})
+		if semver, _ := specRef["semver"].(string); semver != "" || !isValidSemver(bump.Version) {
+			update.Tag, update.Semver = "", bump.Version
+		}
+	}
+	return BumpSourceFile(source.File, update, dryRun)
+}
+
+// loadChartRefChart loads the chart of a HelmRelease that references an
+// OCIRepository with .spec.chartRef, pulling the artifact at the tag of its
+// .spec.ref ("latest" without one). Sources pinned by semver range or digest
+// cannot be resolved offline.
+//
+// Returns:
+//   - The chart.
+//   - An error if the HelmRelease has no such chartRef, the source cannot be
+//     found, or the chart cannot be pulled.
+func loadChartRefChart(ctx context.Context, hrPath string, hr *helmReleaseManifest) (*chart.Chart, error) {
+	ref := hr.ChartRef()
+	if ref == nil {
+		return nil, fmt.Errorf("%s has no .spec.chartRef, specify the chart with --chart-dir", hrPath)
+	}
+	if ref.Kind != "OCIRepository" {
+		return nil, fmt.Errorf("%s references a %s, specify the chart with --chart-dir", hrPath, ref.Kind)
+	}
+	source, err := findChartSource(hrPath, *ref)
+	if err != nil {
+		return nil, err
+	}
+	spec := source.spec()
+	url, _ := spec["url"].(string)
+	specRef, _ := spec["ref"].(map[string]interface{})
+	tag, _ := specRef["tag"].(string)
+	for _, field := range refPrecedence["OCIRepository"] {
+		if v, _ := specRef[field].(string); v != "" && field != "tag" {
+			return nil, fmt.Errorf("%s in %s pins its chart with .spec.ref.%s, specify the chart with --chart-dir", ref, source.File, field)
+		}
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	logf("🔗 Following .spec.chartRef %s to %s\n", ref, source.File)
+	return loadInspectedChart(ctx, url, tag)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chartRefHelmRelease is a HelmRelease whose chart comes from an
+// OCIRepository referenced with .spec.chartRef.
+const chartRefHelmRelease = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app
+  namespace: apps
+spec:
+  interval: 10m
+  chartRef:
+    kind: OCIRepository
+    name: app
+  values:
+    image:
+      repository: nginx
+      tag: "1.25.0"
+`
+
+// writeTestFiles writes files, keyed by path relative to dir.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ociRepositoryManifest returns an OCIRepository named app in namespace apps.
+func ociRepositoryManifest(url, ref string) string {
+	return "apiVersion: source.toolkit.fluxcd.io/v1beta2\nkind: OCIRepository\nmetadata:\n  name: app\n  namespace: apps\nspec:\n  interval: 10m\n  url: " + url + "\n  ref:\n    " + ref + "\n"
+}
+
+// TestDecodeHelmReleaseChartRef verifies that .spec.chartRef is read with its
+// namespace defaulted, and validated like the Flux API server does.
+func TestDecodeHelmReleaseChartRef(t *testing.T) {
+	hr, err := decodeHelmRelease([]byte(chartRefHelmRelease))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ref := hr.ChartRef(); ref == nil || *ref != (chartSourceRef{Kind: "OCIRepository", Name: "app", Namespace: "apps"}) {
+		t.Errorf("Unexpected chartRef: %+v", ref)
+	}
+	if hr.ChartSpec() != nil {
+		t.Error("Expected no chart spec")
+	}
+
+	invalid := map[string]string{
+		"both chart fields": strings.Replace(chartRefHelmRelease, "  chartRef:", "  chart:\n    spec:\n      chart: app\n      sourceRef: {kind: HelmRepository, name: charts}\n  chartRef:", 1),
+		"unsupported kind":  strings.Replace(chartRefHelmRelease, "kind: OCIRepository", "kind: GitRepository", 1),
+		"missing name":      strings.Replace(chartRefHelmRelease, "    name: app\n", "", 1),
+	}
+	for name, manifest := range invalid {
+		if _, err := decodeHelmRelease([]byte(manifest)); err == nil || !strings.Contains(err.Error(), "chartRef") {
+			t.Errorf("%s: expected a chartRef error, got %v", name, err)
+		}
+	}
+}
+
+// TestFindChartSource verifies that the closest definition of a source wins
+// and that equally close copies are reported.
+func TestFindChartSource(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"apps/prod/hr.yaml":                 chartRefHelmRelease,
+		"apps/prod/sources/oci.yaml":        ociRepositoryManifest("oci://ghcr.io/my-org/charts/app", "tag: 1.0.0"),
+		"apps/staging/oci.yaml":             ociRepositoryManifest("oci://ghcr.io/my-org/charts/app", "tag: 1.1.0"),
+		"apps/staging/other-namespace.yaml": strings.Replace(ociRepositoryManifest("oci://x/y", "tag: 2.0.0"), "namespace: apps", "namespace: other", 1),
+	})
+	ref := chartSourceRef{Kind: "OCIRepository", Name: "app", Namespace: "apps"}
+
+	source, err := findChartSource(filepath.Join(dir, "apps/prod/hr.yaml"), ref)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(source.File, filepath.FromSlash("apps/prod/sources/oci.yaml")) {
+		t.Errorf("Expected the prod source, got %s", source.File)
+	}
+
+	writeTestFiles(t, dir, map[string]string{"apps/prod/sources/copy.yaml": ociRepositoryManifest("oci://x/z", "tag: 1.0.0")})
+	if _, err := findChartSource(filepath.Join(dir, "apps/prod/hr.yaml"), ref); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("Expected an ambiguity error, got %v", err)
+	}
+	if _, err := findChartSource(filepath.Join(dir, "apps/prod/hr.yaml"), chartSourceRef{Kind: "HelmChart", Name: "app"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a missing source to fail, got %v", err)
+	}
+}
+
+// TestBumpHelmReleaseChartRef verifies that bump chart sets the version on
+// the source a chartRef points at, leaving the HelmRelease untouched.
+func TestBumpHelmReleaseChartRef(t *testing.T) {
+	tests := []struct {
+		name, ref, version, want string
+	}{
+		{"tag", "tag: 1.0.0", "1.1.0", "tag: 1.1.0"},
+		{"semver source", "semver: 1.0.x", "1.1.0", "semver: 1.1.0"},
+		{"range", "tag: 1.0.0", ">=1.1.0 <2.0.0", "semver: '>=1.1.0 <2.0.0'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFiles(t, dir, map[string]string{
+				"hr.yaml":     chartRefHelmRelease,
+				"source.yaml": ociRepositoryManifest("oci://ghcr.io/my-org/charts/app", tt.ref),
+			})
+			changes, err := BumpHelmReleaseChart(filepath.Join(dir, "hr.yaml"), chartBump{Version: tt.version}, false)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(changes) != 1 || changes[0].Image != "OCIRepository/app" {
+				t.Errorf("Unexpected changes: %+v", changes)
+			}
+			source, _ := os.ReadFile(filepath.Join(dir, "source.yaml"))
+			if !strings.Contains(string(source), tt.want) {
+				t.Errorf("Expected %q in:\n%s", tt.want, source)
+			}
+			if hr, _ := os.ReadFile(filepath.Join(dir, "hr.yaml")); string(hr) != chartRefHelmRelease {
+				t.Errorf("Expected the HelmRelease to be left untouched, got:\n%s", hr)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"hr.yaml": chartRefHelmRelease})
+	if _, err := BumpHelmReleaseChart(filepath.Join(dir, "hr.yaml"), chartBump{Version: "1.1.0", Chart: "other"}, true); err == nil || !strings.Contains(err.Error(), "only apply to .spec.chart") {
+		t.Errorf("Expected --chart to be rejected for a chartRef, got %v", err)
+	}
+}
+
+// TestRenderHelmReleaseChartRef verifies that render pulls the chart of an
+// OCIRepository chartRef when no chart directory is given.
+func TestRenderHelmReleaseChartRef(t *testing.T) {
+	srv := newTestChartRegistry(t)
+	url := "oci://" + strings.Replace(strings.TrimPrefix(srv.URL, "http://"), "127.0.0.1", "localhost", 1) + "/my-org/charts/test-chart"
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"hr.yaml":     chartRefHelmRelease,
+		"source.yaml": ociRepositoryManifest(url, "tag: 0.1.0"),
+	})
+	manifests, err := renderHelmRelease(context.Background(), filepath.Join(dir, "hr.yaml"), "", "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rendered := ""
+	for _, m := range manifests {
+		rendered += m.Content
+	}
+	if !strings.Contains(rendered, "nginx:1.25.0") {
+		t.Errorf("Expected the HelmRelease values in the rendered chart, got:\n%s", rendered)
+	}
+
+	writeTestFiles(t, dir, map[string]string{"source.yaml": ociRepositoryManifest(url, "semver: 0.1.x")})
+	if _, err := renderHelmRelease(context.Background(), filepath.Join(dir, "hr.yaml"), "", "", nil); err == nil || !strings.Contains(err.Error(), "--chart-dir") {
+		t.Errorf("Expected a semver source to need --chart-dir, got %v", err)
+	}
+}
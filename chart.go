@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	injectValuesKey  string
+	injectTemplates  []string
+	injectDryRun     bool
+	injectDiff       bool
+	injectShowRender bool
+	injectionNames   []string
+	injectSpecPath   string
+)
+
+// chartCmd groups the commands that inspect and mutate Helm charts.
+var chartCmd = &cobra.Command{
+	Use:   "chart",
+	Short: "Helm chart inspection and mutations",
+}
+
+var chartInjectPullSecretsCmd = &cobra.Command{
+	Use:   "inject-pull-secrets",
+	Short: "Inject a conditional imagePullSecrets block into a Helm chart",
+	Long: `Inject a conditional imagePullSecrets block into the selected templates of a
+Helm chart (by default every deployment, statefulset, daemonset, job and cronjob
+template) and make sure the referenced key exists in the chart's values.yaml.
+
+Templates that already contain the block are left untouched, so the command can
+be run repeatedly. Use --dry-run to compute the changes without writing them,
+--diff to print a unified diff of every file that changes and --show-render to
+print the rendered manifests of the changed templates.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if chartPath == "" {
+			return fmt.Errorf("you must specify --chart pointing to a Helm chart directory")
+		}
+
+		changed, err := injectImagePullSecrets(chartPath, injectOptions{
+			ValuesKey:  injectValuesKey,
+			Templates:  injectTemplates,
+			DryRun:     injectDryRun,
+			Diff:       injectDiff,
+			ShowRender: injectShowRender,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to inject: %w", err)
+		}
+		noChangesMade = !changed
+		return nil
+	},
+}
+
+var chartInjectCmd = &cobra.Command{
+	Use:   "inject",
+	Short: "Inject standard blocks into Helm chart templates",
+	Long: `Inject blocks such as securityContext, resources, nodeSelector or
+topologySpreadConstraints into the templates of a Helm chart.
+
+Injections are declarative: each one names the template kinds it targets, the
+YAML path it is inserted below, an optional guard condition and the snippet to
+insert, plus values.yaml defaults. Use --injection to pick built-in injections
+(` + "`" + `flux-helpers chart inject --help` + "`" + ` lists them) and --spec to load your own from a
+file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if chartPath == "" {
+			return fmt.Errorf("you must specify --chart pointing to a Helm chart directory")
+		}
+		if len(injectionNames) == 0 && injectSpecPath == "" {
+			return fmt.Errorf("you must specify at least one --injection or --spec")
+		}
+
+		var specs []injectionSpec
+		for _, name := range injectionNames {
+			spec, ok := builtinInjections[name]
+			if !ok {
+				return fmt.Errorf("unknown injection %q (available: %s)", name, strings.Join(builtinInjectionNames(), ", "))
+			}
+			specs = append(specs, spec)
+		}
+		if injectSpecPath != "" {
+			loaded, err := loadInjectionSpecs(injectSpecPath)
+			if err != nil {
+				return err
+			}
+			specs = append(specs, loaded...)
+		}
+
+		changed, err := injectChart(chartPath, specs, chartInjectOptions{DryRun: injectDryRun, Diff: injectDiff, ShowRender: injectShowRender})
+		if err != nil {
+			return fmt.Errorf("failed to inject: %w", err)
+		}
+		noChangesMade = !changed
+		return nil
+	},
+}
+
+func init() {
+	chartInjectPullSecretsCmd.Flags().StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	chartInjectPullSecretsCmd.Flags().StringVar(&injectValuesKey, "values-key", defaultPullSecretValuesKey, "Dotted values.yaml key holding the pull secret name")
+	chartInjectPullSecretsCmd.Flags().StringArrayVar(&injectTemplates, "template", nil, "Glob selecting the templates to inject into, matched against the template path or file name (repeatable, default: "+strings.Join(defaultInjectTemplates, ", ")+")")
+	chartInjectPullSecretsCmd.Flags().BoolVar(&injectDryRun, "dry-run", false, "Preview changes without modifying the chart")
+	chartInjectPullSecretsCmd.Flags().BoolVar(&injectDiff, "diff", false, "Print a unified diff of every file that changes")
+	chartInjectPullSecretsCmd.Flags().BoolVar(&injectShowRender, "show-render", false, "Print the rendered manifests of the changed templates")
+
+	chartInjectCmd.Flags().StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	chartInjectCmd.Flags().StringArrayVar(&injectionNames, "injection", nil, "Built-in injection to apply: "+strings.Join(builtinInjectionNames(), ", ")+" (repeatable)")
+	chartInjectCmd.Flags().StringVar(&injectSpecPath, "spec", "", "Path to a file of injection specs to apply")
+	chartInjectCmd.Flags().BoolVar(&injectDryRun, "dry-run", false, "Preview changes without modifying the chart")
+	chartInjectCmd.Flags().BoolVar(&injectDiff, "diff", false, "Print a unified diff of every file that changes")
+	chartInjectCmd.Flags().BoolVar(&injectShowRender, "show-render", false, "Print the rendered manifests of the changed templates")
+
+	chartCmd.AddCommand(chartInjectPullSecretsCmd)
+	chartCmd.AddCommand(chartInjectCmd)
+	rootCmd.AddCommand(chartCmd)
+}
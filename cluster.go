@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterFieldManager is the server-side apply field manager used for
+// HelmReleases bumped in a live cluster.
+const clusterFieldManager = "flux-helpers"
+
+var (
+	kubeconfigPath  string
+	kubeContext     string
+	kubeNamespace   string
+	helmReleaseName string
+	serverDryRun    bool
+	reconcile       bool
+)
+
+// reconcileRequestAnnotation is the annotation Flux controllers watch to
+// reconcile an object immediately instead of waiting for its interval.
+const reconcileRequestAnnotation = "reconcile.fluxcd.io/requestedAt"
+
+// dryRunFlag is the value of bump's --dry-run flag. It behaves like a boolean
+// flag (`--dry-run`, `--dry-run=false`) and also accepts "client" (the same as
+// true) and "server", which in cluster mode sends the change to the API
+// server with dryRun=All instead of only computing it locally.
+type dryRunFlag struct {
+	enabled *bool
+	server  *bool
+}
+
+func (f *dryRunFlag) String() string {
+	switch {
+	case f.enabled == nil || !*f.enabled:
+		return "false"
+	case *f.server:
+		return "server"
+	default:
+		return "true"
+	}
+}
+
+func (f *dryRunFlag) Set(s string) error {
+	switch s {
+	case "client":
+		*f.enabled, *f.server = true, false
+	case "server":
+		*f.enabled, *f.server = true, true
+	default:
+		enabled, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true, false, client or server")
+		}
+		*f.enabled, *f.server = enabled, false
+	}
+	return nil
+}
+
+func (f *dryRunFlag) Type() string {
+	return "string"
+}
+
+// kubeClient bundles a dynamic client with the context and namespace it was
+// configured for.
+type kubeClient struct {
+	Client    dynamic.Interface
+	Context   string
+	Namespace string
+}
+
+// newKubeClient loads the kubeconfig the way kubectl does: --kubeconfig if
+// set, otherwise $KUBECONFIG or ~/.kube/config, with --kube-context selecting
+// the context and --namespace overriding the context's namespace.
+func newKubeClient(kubeconfig, kubeContext, namespace string) (*kubeClient, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	overrides.Context.Namespace = namespace
+
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	config.Timeout = kubeTimeout
+	ns, _, err := loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine namespace: %w", err)
+	}
+	if kubeContext == "" {
+		raw, err := loader.RawConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		kubeContext = raw.CurrentContext
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return &kubeClient{Client: client, Context: kubeContext, Namespace: ns}, nil
+}
+
+// helmReleaseResource returns the resource of HelmReleases in the newest
+// supported API version; the API server converts from the stored version.
+func helmReleaseResource() schema.GroupVersionResource {
+	return helmv2.GroupVersion.WithResource("helmreleases")
+}
+
+// BumpHelmReleaseInCluster bumps image tags in the .spec.values of a
+// HelmRelease in a live cluster.
+//
+// The HelmRelease is read, the updates are applied to its values with the
+// same logic as for files, and the new values are sent with a forced
+// server-side apply as the "flux-helpers" field manager. Note that Flux will
+// revert the change on its next reconciliation if the HelmRelease is also
+// managed from Git.
+//
+// Parameters:
+//   - ctx: The context for the API requests.
+//   - kc: The Kubernetes client and namespace to use.
+//   - name: The name of the HelmRelease.
+//   - updates: A map where the keys are image names and the values are the new tags to apply.
+//   - opts: The bump options. With DryRun, nothing is sent unless serverDryRun is set.
+//   - serverDryRun: With opts.DryRun, send the apply with dryRun=All so the
+//     API server validates it without persisting it.
+//
+// Returns:
+//   - A fileReport for the HelmRelease listing the changes.
+//   - An error if the HelmRelease cannot be read, its values cannot be
+//     updated or violate opts.Schema, or the apply is rejected.
+func BumpHelmReleaseInCluster(ctx context.Context, kc *kubeClient, name string, updates map[string]string, opts bumpOptions, serverDryRun bool) (*fileReport, error) {
+	resource := kc.Client.Resource(helmReleaseResource()).Namespace(kc.Namespace)
+	var obj *unstructured.Unstructured
+	err := kubeCall(ctx, "get HelmRelease", func(ctx context.Context) (err error) {
+		obj, err = resource.Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HelmRelease %s/%s: %w", kc.Namespace, name, err)
+	}
+
+	if ignored, _ := strconv.ParseBool(obj.GetAnnotations()[ignoreAnnotation]); ignored {
+		logf("📌 HelmRelease %s/%s is pinned with the %s annotation, skipping\n", kc.Namespace, name, ignoreAnnotation)
+		return &fileReport{File: "kube://" + kc.Context, Object: "HelmRelease/" + name, Namespace: kc.Namespace}, nil
+	}
+
+	values, _, err := unstructured.NestedMap(obj.Object, "spec", "values")
+	if err != nil {
+		return nil, fmt.Errorf("HelmRelease %s/%s has invalid .spec.values: %w", kc.Namespace, name, err)
+	}
+
+	before, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("HelmRelease %s/%s has invalid .spec.values: %w", kc.Namespace, name, err)
+	}
+
+	// A server-side dry-run needs the updated values, so apply the updates
+	// to the local copy even though nothing is persisted.
+	localOpts := opts
+	localOpts.DryRun = opts.DryRun && !serverDryRun
+	localOpts.Skips = &skipLog{}
+	report := &fileReport{File: "kube://" + kc.Context, Object: "HelmRelease/" + name, Namespace: kc.Namespace}
+	report.Updated, report.Changes, err = applyImageUpdates(values, updates, localOpts)
+	if err != nil {
+		return nil, err
+	}
+	report.Skipped = localOpts.Skips.list()
+	if err := opts.Policy.check(report.File, report.Changes); err != nil {
+		return nil, err
+	}
+	if err := opts.Registry.checkChangesExist(report.File, report.Changes); err != nil {
+		return nil, err
+	}
+	if len(report.Changes) == 0 || (opts.DryRun && !serverDryRun) {
+		return report, nil
+	}
+	if err := checkValuesSchema(values, opts); err != nil {
+		return nil, err
+	}
+
+	patch, err := helmReleaseApplyPatch(obj, values)
+	if err != nil {
+		return nil, err
+	}
+	err = kubeCall(ctx, "apply HelmRelease", func(ctx context.Context) error {
+		_, err := resource.Patch(ctx, name, types.ApplyPatchType, patch, clusterApplyOptions(serverDryRun))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply HelmRelease %s/%s: %w", kc.Namespace, name, err)
+	}
+
+	if serverDryRun {
+		logf("🧪 Server-side dry-run accepted %d change(s) to HelmRelease %s/%s\n", len(report.Changes), kc.Namespace, name)
+	} else {
+		after, _ := json.Marshal(values)
+		recordAudited(clusterAuditPath(kc, name), before, after)
+		logf("✅ Applied %d change(s) to HelmRelease %s/%s in %s\n", len(report.Changes), kc.Namespace, name, kc.Context)
+	}
+	return report, nil
+}
+
+// clusterAuditPath names the HelmRelease name of kc in the audit log, whose
+// checksums are those of its .spec.values in JSON.
+func clusterAuditPath(kc *kubeClient, name string) string {
+	return fmt.Sprintf("kube://%s/%s/HelmRelease/%s", kc.Context, kc.Namespace, name)
+}
+
+// helmReleaseApplyPatch builds the server-side apply configuration that sets
+// the .spec.values of the HelmRelease obj to values.
+func helmReleaseApplyPatch(obj *unstructured.Unstructured, values map[string]interface{}) ([]byte, error) {
+	patch := map[string]interface{}{
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"metadata": map[string]interface{}{
+			"name":      obj.GetName(),
+			"namespace": obj.GetNamespace(),
+		},
+		"spec": map[string]interface{}{
+			"values": values,
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal apply patch: %w", err)
+	}
+	return data, nil
+}
+
+// RequestHelmReleaseReconcile asks helm-controller to reconcile a HelmRelease
+// now by setting the reconcile.fluxcd.io/requestedAt annotation to the current
+// time, like `flux reconcile helmrelease` does.
+//
+// Parameters:
+//   - ctx: The context for the API request.
+//   - kc: The Kubernetes client and namespace to use.
+//   - name: The name of the HelmRelease.
+//
+// Returns:
+//   - An error if the annotation cannot be set.
+func RequestHelmReleaseReconcile(ctx context.Context, kc *kubeClient, name string) error {
+	return requestReconcile(ctx, kc, helmReleaseResource(), "HelmRelease", kc.Namespace, name)
+}
+
+// requestReconcile sets the reconcile.fluxcd.io/requestedAt annotation of the
+// Flux object of kind name in namespace, of resource gvr, to the current time.
+func requestReconcile(ctx context.Context, kc *kubeClient, gvr schema.GroupVersionResource, kind, namespace, name string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				reconcileRequestAnnotation: time.Now().Format(time.RFC3339Nano),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reconcile request: %w", err)
+	}
+
+	resource := kc.Client.Resource(gvr).Namespace(namespace)
+	err = kubeCall(ctx, "reconcile request", func(ctx context.Context) error {
+		_, err := resource.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: clusterFieldManager})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to request reconciliation of %s %s/%s: %w", kind, namespace, name, err)
+	}
+	logf("🔄 Requested reconciliation of %s %s/%s\n", kind, namespace, name)
+	return nil
+}
+
+// Labels kustomize-controller sets on the objects a Kustomization applies.
+const (
+	kustomizationNameLabel      = "kustomize.toolkit.fluxcd.io/name"
+	kustomizationNamespaceLabel = "kustomize.toolkit.fluxcd.io/namespace"
+)
+
+// kustomizationResource returns the resource of Flux Kustomizations.
+func kustomizationResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Resource: "kustomizations"}
+}
+
+// fluxSourceResources are the resources of the Flux sources a Kustomization
+// can apply from, by kind.
+var fluxSourceResources = map[string]schema.GroupVersionResource{
+	"GitRepository": {Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "gitrepositories"},
+	"OCIRepository": {Group: "source.toolkit.fluxcd.io", Version: "v1beta2", Resource: "ocirepositories"},
+	"Bucket":        {Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "buckets"},
+}
+
+// RequestGitBumpReconcile asks Flux to roll out a bump that was pushed to Git
+// now instead of at the next interval. For each HelmRelease of files, the
+// source and the Kustomization that apply it (found through the labels
+// kustomize-controller sets) are asked to reconcile, as `flux reconcile
+// kustomization --with-source` does, and then the HelmRelease itself.
+// HelmReleases that are not in the cluster are skipped with a warning.
+//
+// Parameters:
+//   - ctx: The context for the API requests.
+//   - kc: The Kubernetes client; HelmReleases without a namespace are looked
+//     up in its namespace.
+//   - files: The reports of the bump.
+//
+// Returns:
+//   - An error if a HelmRelease cannot be read or a request cannot be made.
+func RequestGitBumpReconcile(ctx context.Context, kc *kubeClient, files []fileReport) error {
+	targets, err := trainTargets(nil, files, kc.Namespace, nil)
+	if err != nil {
+		return err
+	}
+	requested := map[string]bool{}
+	request := func(gvr schema.GroupVersionResource, kind, namespace, name string) error {
+		key := kind + "/" + namespace + "/" + name
+		if requested[key] {
+			return nil
+		}
+		requested[key] = true
+		return requestReconcile(ctx, kc, gvr, kind, namespace, name)
+	}
+
+	for _, target := range targets {
+		var hr *unstructured.Unstructured
+		err := kubeCall(ctx, "get HelmRelease", func(ctx context.Context) (err error) {
+			hr, err = kc.Client.Resource(helmReleaseResource()).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			logf("⚠️ HelmRelease %s is not in the cluster, not requesting its reconciliation\n", target)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get HelmRelease %s: %w", target, err)
+		}
+
+		labels := hr.GetLabels()
+		if ksName, ksNamespace := labels[kustomizationNameLabel], labels[kustomizationNamespaceLabel]; ksName != "" && ksNamespace != "" {
+			var ks *unstructured.Unstructured
+			err := kubeCall(ctx, "get Kustomization", func(ctx context.Context) (err error) {
+				ks, err = kc.Client.Resource(kustomizationResource()).Namespace(ksNamespace).Get(ctx, ksName, metav1.GetOptions{})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get Kustomization %s/%s of HelmRelease %s: %w", ksNamespace, ksName, target, err)
+			}
+			kind, _, _ := unstructured.NestedString(ks.Object, "spec", "sourceRef", "kind")
+			name, _, _ := unstructured.NestedString(ks.Object, "spec", "sourceRef", "name")
+			namespace, _, _ := unstructured.NestedString(ks.Object, "spec", "sourceRef", "namespace")
+			if namespace == "" {
+				namespace = ksNamespace
+			}
+			if gvr, ok := fluxSourceResources[kind]; ok && name != "" {
+				if err := request(gvr, kind, namespace, name); err != nil {
+					return err
+				}
+			}
+			if err := request(kustomizationResource(), "Kustomization", ksNamespace, ksName); err != nil {
+				return err
+			}
+		}
+		if err := request(helmReleaseResource(), "HelmRelease", target.Namespace, target.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterApplyOptions returns the options of the forced server-side apply
+// sent by BumpHelmReleaseInCluster.
+func clusterApplyOptions(serverDryRun bool) metav1.PatchOptions {
+	opts := metav1.PatchOptions{FieldManager: clusterFieldManager, Force: boolPtr(true)}
+	if serverDryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	return opts
+}
+
+// runClusterBump implements `bump --name` (cluster mode).
+func runClusterBump(cmd *cobra.Command) error {
+	for _, flag := range []string{"file", "config", "follow-values-from", "strict", "watch", "verify-render", "verify-render-warn", "commit", "annotate", "backup", "backup-dir", "selector", "target-name", "target-namespace"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--%s cannot be combined with --name (cluster mode)", flag)
+		}
+	}
+	if len(tagArgs)+len(regexArgs) == 0 {
+		return fmt.Errorf("you must specify at least one --set repo=version (or --set-regex) with --name")
+	}
+	updates, regexUpdates, err := parseUpdateArgs(tagArgs, regexArgs)
+	if err != nil {
+		return err
+	}
+	if err := validateBumpOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	if outputFormat == outputJSON {
+		logOut = os.Stderr
+	}
+	rewritten := []updateSet{{Images: updates, ImagesRegex: regexUpdates}}
+	if err := applyRewrites(rewritten, rewritesPath); err != nil {
+		return err
+	}
+	updates, regexUpdates = rewritten[0].Images, rewritten[0].ImagesRegex
+
+	kc, err := newKubeClient(kubeconfigPath, kubeContext, kubeNamespace)
+	if err != nil {
+		return err
+	}
+
+	matchers, err := setMatchers(matcherProfile, nil)
+	if err != nil {
+		return err
+	}
+
+	opts := bumpOptions{DryRun: dryRun, Paths: pathArgs, RegexUpdates: regexUpdates, Force: force, Matchers: matchers}
+	if interactive {
+		opts.Select = newMatchPrompter(os.Stdin, logOut).Select
+	}
+	if valuesSchemaPath != "" {
+		if opts.Schema, err = loadValuesSchema(valuesSchemaPath); err != nil {
+			return err
+		}
+	}
+	if opts.Policy, err = loadBumpPolicy(policyPath, allowMajor); err != nil {
+		return err
+	}
+	if checkExists {
+		opts.Registry = newRegistryClient(cmd.Context())
+	}
+	startedAt := time.Now()
+	fileRep, err := BumpHelmReleaseInCluster(cmd.Context(), kc, helmReleaseName, updates, opts, serverDryRun)
+	if fileRep != nil {
+		runStats.applied = len(fileRep.Changes)
+	}
+	if reportPath != "" || reportMDPath != "" || outputFormat == outputGitHub {
+		var files []fileReport
+		if fileRep != nil {
+			files = []fileReport{*fileRep}
+		}
+		rep := newRunReport("bump", dryRun, startedAt, files, err)
+		if rErr := writeRunReport(rep, reportPath, reportMDPath); rErr != nil && err == nil {
+			return rErr
+		}
+		if outputFormat == outputGitHub {
+			if sErr := appendGitHubStepSummary(rep); sErr != nil && err == nil {
+				return sErr
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bump tags: %w", err)
+	}
+	noChangesMade = len(fileRep.Changes) == 0
+	if dryRun && outputFormat == outputText {
+		if err := writeDryRunSummary(logWriter(), []fileReport{*fileRep}); err != nil {
+			return err
+		}
+	}
+
+	if reconcile {
+		switch {
+		case dryRun:
+			logf("[dry-run] Would request reconciliation of HelmRelease %s/%s\n", kc.Namespace, helmReleaseName)
+		case noChangesMade:
+			logf("ℹ️ Nothing changed, not requesting reconciliation of HelmRelease %s/%s\n", kc.Namespace, helmReleaseName)
+		default:
+			if err := RequestHelmReleaseReconcile(cmd.Context(), kc, helmReleaseName); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		return writeJSON(os.Stdout, &bumpReport{DryRun: dryRun, Files: []fileReport{*fileRep}})
+	case outputGitHub:
+		return writeGitHubAnnotations(os.Stdout, []fileReport{*fileRep}, dryRun)
+	}
+	return nil
+}
+
+// boolPtr returns a pointer to b.
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestBumpHelmReleaseInCluster verifies that cluster mode sends a forced
+// server-side apply of the bumped values, honours --dry-run=server, and sends
+// nothing on a client-side dry-run. Applies are audited.
+func TestBumpHelmReleaseInCluster(t *testing.T) {
+	oldPath := auditLogPath
+	auditLogPath = filepath.Join(t.TempDir(), "audit.jsonl")
+	auditTrail.files = nil
+	t.Cleanup(func() {
+		auditLogPath = oldPath
+		auditTrail.files = nil
+	})
+
+	hr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata":   map[string]interface{}{"name": "my-app", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"values": map[string]interface{}{
+				"image": map[string]interface{}{"repository": "ghcr.io/my-org/my-api", "tag": "1.0.0"},
+			},
+		},
+	}}
+
+	newClient := func() (*kubeClient, *[]k8stesting.PatchAction) {
+		scheme := runtime.NewScheme()
+		client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+			map[schema.GroupVersionResource]string{helmReleaseResource(): "HelmReleaseList"}, hr.DeepCopy())
+		var patches []k8stesting.PatchAction
+		client.PrependReactor("patch", "helmreleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patches = append(patches, action.(k8stesting.PatchAction))
+			return true, hr.DeepCopy(), nil
+		})
+		return &kubeClient{Client: client, Context: "test", Namespace: "apps"}, &patches
+	}
+	updates := map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}
+
+	kc, patches := newClient()
+	report, err := BumpHelmReleaseInCluster(context.Background(), kc, "my-app", updates, bumpOptions{}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].NewValue != "2.0.0" {
+		t.Errorf("Expected one change to 2.0.0, got: %v", report.Changes)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("Expected one patch, got %d", len(*patches))
+	}
+	patch := (*patches)[0]
+	if patch.GetPatchType() != types.ApplyPatchType {
+		t.Errorf("Expected a server-side apply, got %s", patch.GetPatchType())
+	}
+	var applied map[string]interface{}
+	if err := json.Unmarshal(patch.GetPatch(), &applied); err != nil {
+		t.Fatalf("Invalid patch: %v", err)
+	}
+	if tag, _, _ := unstructured.NestedString(applied, "spec", "values", "image", "tag"); tag != "2.0.0" {
+		t.Errorf("Expected the patch to set the new tag, got: %s", patch.GetPatch())
+	}
+	if files := auditTrail.files; len(files) != 1 || files[0].Path != "kube://test/apps/HelmRelease/my-app" || files[0].SHA256Before == files[0].SHA256After {
+		t.Errorf("Expected the apply to be audited, got %+v", files)
+	}
+	auditTrail.files = nil
+
+	kc, patches = newClient()
+	if _, err := BumpHelmReleaseInCluster(context.Background(), kc, "my-app", updates, bumpOptions{DryRun: true}, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(*patches) != 0 {
+		t.Errorf("Expected no patch on a client-side dry-run, got %d", len(*patches))
+	}
+
+	kc, patches = newClient()
+	if _, err := BumpHelmReleaseInCluster(context.Background(), kc, "my-app", updates, bumpOptions{DryRun: true}, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("Expected one patch on a server-side dry-run, got %d", len(*patches))
+	}
+	if len(auditTrail.files) != 0 {
+		t.Errorf("Expected dry runs not to be audited, got %+v", auditTrail.files)
+	}
+	opts := clusterApplyOptions(true)
+	if len(opts.DryRun) != 1 || opts.DryRun[0] != metav1.DryRunAll || opts.FieldManager != clusterFieldManager || !*opts.Force {
+		t.Errorf("Expected a dryRun=All apply by %s, got: %+v", clusterFieldManager, opts)
+	}
+}
+
+// TestDryRunFlag verifies the values accepted by bump's --dry-run flag.
+func TestDryRunFlag(t *testing.T) {
+	var enabled, server bool
+	flag := &dryRunFlag{enabled: &enabled, server: &server}
+
+	for _, tc := range []struct {
+		value           string
+		enabled, server bool
+	}{
+		{"true", true, false},
+		{"server", true, true},
+		{"client", true, false},
+		{"false", false, false},
+	} {
+		if err := flag.Set(tc.value); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", tc.value, err)
+		}
+		if enabled != tc.enabled || server != tc.server {
+			t.Errorf("--dry-run=%s: expected enabled=%v server=%v, got %v %v", tc.value, tc.enabled, tc.server, enabled, server)
+		}
+	}
+	if err := flag.Set("sometimes"); err == nil {
+		t.Errorf("Expected an error for an invalid value")
+	}
+}
+
+// TestRequestHelmReleaseReconcile verifies that a reconcile request sets the
+// reconcile.fluxcd.io/requestedAt annotation with a merge patch.
+func TestRequestHelmReleaseReconcile(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{helmReleaseResource(): "HelmReleaseList"})
+	var patches []k8stesting.PatchAction
+	client.PrependReactor("patch", "helmreleases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, action.(k8stesting.PatchAction))
+		return true, &unstructured.Unstructured{}, nil
+	})
+
+	kc := &kubeClient{Client: client, Context: "test", Namespace: "apps"}
+	if err := RequestHelmReleaseReconcile(context.Background(), kc, "my-app"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(patches) != 1 || patches[0].GetPatchType() != types.MergePatchType {
+		t.Fatalf("Expected one merge patch, got: %v", patches)
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal(patches[0].GetPatch(), &patch); err != nil {
+		t.Fatalf("Invalid patch: %v", err)
+	}
+	if at, _, _ := unstructured.NestedString(patch, "metadata", "annotations", reconcileRequestAnnotation); at == "" {
+		t.Errorf("Expected %s to be set, got: %s", reconcileRequestAnnotation, patches[0].GetPatch())
+	}
+}
+
+// TestRequestGitBumpReconcile verifies that after a Git bump the source, the
+// Kustomization and the HelmRelease are each asked to reconcile once, and
+// that HelmReleases missing from the cluster are skipped.
+func TestRequestGitBumpReconcile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"app.yaml":     chartRefHelmRelease,
+		"missing.yaml": strings.Replace(chartRefHelmRelease, "name: app", "name: missing", 1),
+	})
+	change := []tagChange{{Image: "nginx", Path: "image.tag", OldValue: "1.25.0", NewValue: "1.26.0"}}
+	files := []fileReport{
+		{File: filepath.Join(dir, "app.yaml"), Updated: 1, Changes: change},
+		{File: filepath.Join(dir, "missing.yaml"), Updated: 1, Changes: change},
+		{File: filepath.Join(dir, "app.yaml"), Updated: 1, Changes: change},
+	}
+
+	hr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata": map[string]interface{}{"name": "app", "namespace": "apps", "labels": map[string]interface{}{
+			kustomizationNameLabel: "apps", kustomizationNamespaceLabel: "flux-system",
+		}},
+	}}
+	ks := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+		"kind":       "Kustomization",
+		"metadata":   map[string]interface{}{"name": "apps", "namespace": "flux-system"},
+		"spec":       map[string]interface{}{"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "flux-system"}},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		helmReleaseResource():                "HelmReleaseList",
+		kustomizationResource():              "KustomizationList",
+		fluxSourceResources["GitRepository"]: "GitRepositoryList",
+	}, hr, ks)
+	var patched []string
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		patched = append(patched, patch.GetResource().Resource+" "+patch.GetNamespace()+"/"+patch.GetName())
+		return true, &unstructured.Unstructured{}, nil
+	})
+
+	kc := &kubeClient{Client: client, Context: "test", Namespace: "default"}
+	if err := RequestGitBumpReconcile(context.Background(), kc, files); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{"gitrepositories flux-system/flux-system", "kustomizations flux-system/apps", "helmreleases apps/app"}
+	if !reflect.DeepEqual(patched, want) {
+		t.Errorf("Expected reconcile requests %v, got %v", want, patched)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	messageTemplate string
+	branchTemplate  string
+	prTitleTemplate string
+	prBodyTemplate  string
+)
+
+// commitTemplateData is what the --message-template, --branch-template,
+// --pr-title-template and --pr-body-template templates are executed with.
+type commitTemplateData struct {
+	// Images lists every bumped image with its new version, in the order
+	// they were changed. An entry prints as "image:version".
+	Images []bumpedImage
+	// Image and Version are those of the first bumped image, for the common
+	// single-image bump.
+	Image   string
+	Version string
+	// File is the first changed file, and Files all of them.
+	File  string
+	Files []string
+	// Changes lists every change with the file it was made in.
+	Changes []fileChange
+	// Date is the day of the run, as YYYY-MM-DD (UTC).
+	Date string
+	// Message is the commit message; it is only set for the pull request
+	// templates.
+	Message string
+}
+
+// bumpedImage is an image and the version it was bumped to.
+type bumpedImage struct {
+	Image   string
+	Version string
+}
+
+func (b bumpedImage) String() string {
+	return b.Image + ":" + b.Version
+}
+
+// fileChange is a tagChange together with its file.
+type fileChange struct {
+	File string
+	tagChange
+}
+
+// newCommitTemplateData describes the changes in files for the commit
+// templates.
+func newCommitTemplateData(files []fileReport, now time.Time) commitTemplateData {
+	data := commitTemplateData{Files: changedFiles(files), Date: now.UTC().Format("2006-01-02")}
+	seen := map[string]bool{}
+	for _, f := range files {
+		for _, c := range f.Changes {
+			data.Changes = append(data.Changes, fileChange{File: f.File, tagChange: c})
+			if !seen[c.Image] {
+				seen[c.Image] = true
+				data.Images = append(data.Images, bumpedImage{Image: c.Image, Version: strings.TrimPrefix(c.NewValue, c.Image+":")})
+			}
+		}
+	}
+	if len(data.Images) > 0 {
+		data.Image, data.Version = data.Images[0].Image, data.Images[0].Version
+	}
+	if len(data.Files) > 0 {
+		data.File = data.Files[0]
+	}
+	return data
+}
+
+// commitTemplates are the parsed commit, branch and pull request templates;
+// nil templates keep the default behavior.
+type commitTemplates struct {
+	message *template.Template
+	branch  *template.Template
+	prTitle *template.Template
+	prBody  *template.Template
+}
+
+// templateFuncs are available in every commit template: env reads an
+// environment variable, join joins the items of a list with a separator and
+// slug turns text into a lowercase, branch-name-safe string.
+var templateFuncs = template.FuncMap{
+	"env":  os.Getenv,
+	"join": joinItems,
+	"slug": slugify,
+}
+
+// loadCommitTemplates parses the templates given with the template flags. A
+// flag value starting with "@" names a file to read the template from.
+func loadCommitTemplates() (*commitTemplates, error) {
+	var t commitTemplates
+	for _, tc := range []struct {
+		flag string
+		text string
+		dst  **template.Template
+	}{
+		{"message-template", messageTemplate, &t.message},
+		{"branch-template", branchTemplate, &t.branch},
+		{"pr-title-template", prTitleTemplate, &t.prTitle},
+		{"pr-body-template", prBodyTemplate, &t.prBody},
+	} {
+		if tc.text == "" {
+			continue
+		}
+		text := tc.text
+		if file, ok := strings.CutPrefix(text, "@"); ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read --%s: %w", tc.flag, err)
+			}
+			text = string(data)
+		}
+		tmpl, err := template.New(tc.flag).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s: %w", tc.flag, err)
+		}
+		*tc.dst = tmpl
+	}
+	return &t, nil
+}
+
+// renderCommitTemplate executes tmpl with data. It returns fallback if tmpl
+// is nil.
+func renderCommitTemplate(tmpl *template.Template, data commitTemplateData, fallback string) (string, error) {
+	if tmpl == nil {
+		return fallback, nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render --%s: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// joinItems joins the items of a slice, formatted with fmt, with sep.
+func joinItems(sep string, items interface{}) (string, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", items)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9._/-]+`)
+
+// slugify lowercases s and replaces every run of characters that are not
+// letters, digits, ".", "_", "/" or "-" with a single "-".
+func slugify(s string) string {
+	return strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var templateFiles = []fileReport{
+	{File: "dev/app.yaml", Changes: []tagChange{{Image: "ghcr.io/my-org/api", Path: "image.tag", OldValue: "1.0.0", NewValue: "1.1.0"}}},
+	{File: "prod/app.yaml", Changes: []tagChange{
+		{Image: "ghcr.io/my-org/api", Path: "images.api", OldValue: "ghcr.io/my-org/api:1.0.0", NewValue: "ghcr.io/my-org/api:1.1.0"},
+		{Image: "envoyproxy/envoy", Path: "sidecar.image.tag", OldValue: "1.26.5", NewValue: "1.27.0"},
+	}},
+	{File: "staging/app.yaml"},
+}
+
+// TestCommitTemplates verifies the template fields and functions.
+func TestCommitTemplates(t *testing.T) {
+	defer func(m, b string) { messageTemplate, branchTemplate = m, b }(messageTemplate, branchTemplate)
+	messageTemplate = `Bump {{join ", " .Images}} on {{.Date}}{{range .Changes}}
+- {{.File}}: {{.Path}}{{end}}`
+	branchTemplate = `bump/{{slug .Image}}-{{.Version}}`
+
+	templates, err := loadCommitTemplates()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := newCommitTemplateData(templateFiles, time.Date(2024, 5, 1, 23, 0, 0, 0, time.FixedZone("", -3600)))
+	if data.File != "dev/app.yaml" || len(data.Files) != 2 {
+		t.Errorf("Unexpected files: %q %q", data.File, data.Files)
+	}
+
+	message, err := renderCommitTemplate(templates.message, data, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "Bump ghcr.io/my-org/api:1.1.0, envoyproxy/envoy:1.27.0 on 2024-05-02\n" +
+		"- dev/app.yaml: image.tag\n- prod/app.yaml: images.api\n- prod/app.yaml: sidecar.image.tag"
+	if message != want {
+		t.Errorf("Unexpected message:\n%s\nwant:\n%s", message, want)
+	}
+	if branch, _ := renderCommitTemplate(templates.branch, data, ""); branch != "bump/ghcr.io/my-org/api-1.1.0" {
+		t.Errorf("Unexpected branch: %q", branch)
+	}
+	if title, _ := renderCommitTemplate(templates.prTitle, data, "fallback"); title != "fallback" {
+		t.Errorf("Expected the fallback without a template, got %q", title)
+	}
+
+	messageTemplate = "{{.Imgs}}"
+	if templates, err = loadCommitTemplates(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := renderCommitTemplate(templates.message, data, ""); err == nil || !strings.Contains(err.Error(), "--message-template") {
+		t.Errorf("Expected an unknown field to fail, got: %v", err)
+	}
+	messageTemplate = "{{.Images"
+	if _, err := loadCommitTemplates(); err == nil {
+		t.Errorf("Expected an invalid template to be rejected")
+	}
+}
+
+// TestCommitRunTemplates verifies that a template read from a file becomes
+// the commit message.
+func TestCommitRunTemplates(t *testing.T) {
+	defer func(c bool, m string) { commitChanges, messageTemplate = c, m }(commitChanges, messageTemplate)
+	file := initTestRepo(t)
+	dir := filepath.Dir(file)
+	os.WriteFile(file, []byte("tag: 1.1.0\n"), 0644)
+	tmplFile := filepath.Join(t.TempDir(), "message.tmpl")
+	os.WriteFile(tmplFile, []byte("chore({{slug .Image}}): {{.Version}}\n\nFiles: {{join \" \" .Files}}\n"), 0644)
+
+	commitChanges, messageTemplate = true, "@"+tmplFile
+	templates, err := loadCommitTemplates()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files := []fileReport{{File: file, Changes: []tagChange{{Image: "My-Org/API", Path: "tag", OldValue: "1.0.0", NewValue: "1.1.0"}}}}
+	if err := commitRun(context.Background(), files, templates); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, _ := exec.Command("git", "-C", dir, "log", "-1", "--format=%B").Output()
+	if want := "chore(my-org/api): 1.1.0\n\nFiles: " + file; strings.TrimSpace(string(out)) != want {
+		t.Errorf("Unexpected commit message:\n%s", out)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// manDir is where `docs man` writes the man pages.
+var manDir string
+
+// completeSetRepositories completes the repository part of --set values with
+// the image repositories referenced in the --file target (or, without
+// --file, the files of ./flux-helpers.yaml), so `--set ghcr.io/<TAB>` offers
+// the repositories that can actually be bumped.
+func completeSetRepositories(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.Contains(toComplete, "=") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	files := []string{filePath}
+	var custom []imageMatcher
+	if filePath == "" {
+		cfg, err := loadBumpConfig(defaultConfigFile)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		files = nil
+		for _, set := range cfg.Updates {
+			files = append(files, set.Files...)
+		}
+		custom = cfg.Matchers
+	}
+	matchers, err := setMatchers(matcherProfile, custom)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, repo := range imageRepositoriesInFiles(files, matchers) {
+		if strings.HasPrefix(repo, toComplete) {
+			completions = append(completions, repo+"=")
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// imageRepositoriesInFiles returns the sorted image repositories referenced in
+// the .spec.values and .spec.postRenderers of the HelmReleases in files
+// (globs are expanded), as recognised by matchers. Files that cannot be read
+// or parsed are skipped: completion must not fail.
+func imageRepositoriesInFiles(files []string, matchers []imageMatcher) []string {
+	paths, err := expandFileGlobs(files)
+	if err != nil {
+		return nil
+	}
+
+	var repos []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		_, _ = rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+			for _, repo := range collectImageRepositories(values, matchers) {
+				repos = appendUnique(repos, repo)
+			}
+			if postRenderers != nil {
+				for _, repo := range postRenderers.repositories(matchers) {
+					repos = appendUnique(repos, repo)
+				}
+			}
+			return nil
+		})
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate documentation for flux-helpers",
+}
+
+var docsManCmd = &cobra.Command{
+	Use:   "man",
+	Short: "Generate man pages for flux-helpers and all of its commands",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.MkdirAll(manDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", manDir, err)
+		}
+		header := &doc.GenManHeader{Title: "FLUX-HELPERS", Section: "1", Source: "flux-helpers"}
+		if err := doc.GenManTree(rootCmd, header, manDir); err != nil {
+			return fmt.Errorf("failed to generate man pages: %w", err)
+		}
+		pages, _ := os.ReadDir(manDir)
+		count := 0
+		for _, p := range pages {
+			if strings.HasSuffix(p.Name(), ".1") {
+				count++
+			}
+		}
+		logf("📖 Wrote %d man page(s) to %s\n", count, manDir)
+		return nil
+	},
+}
+
+func init() {
+	docsManCmd.Flags().StringVar(&manDir, "dir", "man", "Directory to write the man pages to")
+	docsCmd.AddCommand(docsManCmd)
+	rootCmd.AddCommand(docsCmd)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestCompleteSetRepositories verifies that --set completes the image
+// repositories referenced in the --file target.
+func TestCompleteSetRepositories(t *testing.T) {
+	defer func(old string) { filePath = old }(filePath)
+	filePath = "test_files/helmrelease-v2.yaml"
+
+	completions, directive := completeSetRepositories(bumpCmd, nil, "ghcr.io/my-org/w")
+	if fmt.Sprint(completions) != "[ghcr.io/my-org/web-app=]" {
+		t.Errorf("Unexpected completions: %v", completions)
+	}
+	if directive != cobra.ShellCompDirectiveNoSpace|cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("Unexpected directive: %v", directive)
+	}
+
+	if completions, _ := completeSetRepositories(bumpCmd, nil, "ghcr.io/my-org/web-app="); completions != nil {
+		t.Errorf("Expected no completions for the version, got %v", completions)
+	}
+
+	filePath = "test_files/does-not-exist.yaml"
+	if completions, _ := completeSetRepositories(bumpCmd, nil, ""); completions != nil {
+		t.Errorf("Expected no completions for a missing file, got %v", completions)
+	}
+}
+
+// TestDocsMan verifies that man pages are written for every command.
+func TestDocsMan(t *testing.T) {
+	defer func(old string) { manDir = old }(manDir)
+	manDir = filepath.Join(t.TempDir(), "man")
+
+	if err := docsManCmd.RunE(docsManCmd, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, page := range []string{"flux-helpers.1", "flux-helpers-bump.1", "flux-helpers-docs-man.1"} {
+		if _, err := os.Stat(filepath.Join(manDir, page)); err != nil {
+			t.Errorf("Expected man page %s: %v", page, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// imageArtifact describes a kind of file whose image references are "image"
+// strings of the entries of a top-level map: Docker Compose services and
+// Aspire manifest resources.
+type imageArtifact struct {
+	// Name names the kind of file in messages.
+	Name string
+	// Section is the top-level key holding the entries, e.g. "services".
+	Section string
+	// JSON is set for JSON files, which are re-encoded as indented JSON when
+	// they cannot be patched in place.
+	JSON bool
+}
+
+var (
+	composeArtifact = imageArtifact{Name: "Compose file", Section: "services"}
+	aspireArtifact  = imageArtifact{Name: "Aspire manifest", Section: "resources", JSON: true}
+)
+
+// encode marshals the document in the artifact's format.
+func (a imageArtifact) encode(doc interface{}) ([]byte, error) {
+	if !a.JSON {
+		return yaml.Marshal(doc)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// BumpArtifactFile updates the "repository:tag" image strings of the entries
+// in an artifact's section, e.g. services.api.image in a docker-compose.yaml,
+// like the Aspire-style strings of HelmRelease values. Image strings with a
+// digest (repo:tag@sha256:...) or variables (${TAG}) are left alone.
+//
+// Only the changed strings are rewritten when possible. The file is written
+// atomically under its advisory lock, unless opts.DryRun is set or nothing
+// changes.
+//
+// Parameters:
+//   - filePath: The path to the file.
+//   - artifact: The kind of file.
+//   - updates: A map where the keys are image names and the values are the new tags to apply.
+//   - opts: The bump options; opts.Paths select entries by paths such as
+//     "services.api.image".
+//
+// Returns:
+//   - The result of the bump, with change paths such as "services.api.image".
+//   - An error if the file cannot be read, parsed or written, has no section,
+//     or a change is rejected by opts.Policy or opts.Registry.
+func BumpArtifactFile(filePath string, artifact imageArtifact, updates map[string]string, opts bumpOptions) (*bumpResult, error) {
+	if !opts.DryRun {
+		unlock, err := acquireFileLock(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", artifact.Name, err)
+	}
+	entries, ok := doc[artifact.Section].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a %s: no %s map", filePath, artifact.Name, artifact.Section)
+	}
+
+	// Bump a view holding only the image strings, so that nothing else in the
+	// entries (environment variables, labels, ...) is mistaken for an image.
+	images := map[string]interface{}{}
+	for name, entry := range entries {
+		fields, _ := entry.(map[string]interface{})
+		image, _ := fields["image"].(string)
+		if image == "" {
+			continue
+		}
+		if strings.Contains(image, "@") || strings.Contains(image, "$") {
+			logf("⚠️ %s.%s.image %s is pinned by digest or uses variables, skipping\n", artifact.Section, name, image)
+			continue
+		}
+		images[name] = map[string]interface{}{"image": image}
+	}
+	view := map[string]interface{}{artifact.Section: images}
+	opts.Matchers = []imageMatcher{imageStringMatcher}
+
+	result := &bumpResult{}
+	result.Updated, result.Changes, err = applyImageUpdates(view, updates, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Policy.check(filePath, result.Changes); err != nil {
+		return nil, err
+	}
+	if err := opts.Registry.checkChangesExist(filePath, result.Changes); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", result.Updated)
+		return result, nil
+	}
+	if result.Updated == 0 {
+		logln("ℹ️ No image tags were updated.")
+		return result, nil
+	}
+
+	for name, image := range images {
+		entries[name].(map[string]interface{})["image"] = image.(map[string]interface{})["image"]
+	}
+	if result.Output, err = writeValues(data, doc, artifact.encode); err != nil {
+		return nil, err
+	}
+	if err := writeFileWithBackup(filePath, result.Output, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Updated %d image(s) in %s\n", result.Updated, filePath)
+	return result, nil
+}
+
+// newArtifactBumpCommand returns the bump subcommand for artifact.
+func newArtifactBumpCommand(use, short, long string, artifact imageArtifact) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if filePath == "" || len(tagArgs)+len(regexArgs) == 0 {
+				return fmt.Errorf("you must specify --file and at least one --set repo=version (or --set-regex)")
+			}
+			updates, regexUpdates, err := parseUpdateArgs(tagArgs, regexArgs)
+			if err != nil {
+				return err
+			}
+			opts := bumpOptions{DryRun: dryRun, Paths: pathArgs, RegexUpdates: regexUpdates}
+			if opts.Policy, err = loadBumpPolicy(policyPath, allowMajor); err != nil {
+				return err
+			}
+			if checkExists {
+				opts.Registry = newRegistryClient(cmd.Context())
+			}
+
+			result, err := BumpArtifactFile(filePath, artifact, updates, opts)
+			if err != nil {
+				return fmt.Errorf("failed to bump %s: %w", artifact.Name, err)
+			}
+			noChangesMade = len(result.Changes) == 0
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to the "+artifact.Name)
+	cmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version; repo may be a glob like ghcr.io/my-org/* (repeatable)")
+	cmd.Flags().StringArrayVar(&regexArgs, "set-regex", nil, "Image update(s) in the form regex=version, matched against whole repository names (repeatable)")
+	cmd.Flags().StringArrayVar(&pathArgs, "path", nil, "Only update the image at this path, e.g. "+artifact.Section+".api.image (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+	cmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a new image tag does not exist in its registry, before the file is changed")
+	addPolicyFlags(cmd)
+	return cmd
+}
+
+func init() {
+	bumpCmd.AddCommand(newArtifactBumpCommand("compose",
+		"Bump image tags in a Docker Compose file",
+		"Update the services.<name>.image strings of a docker-compose.yaml.",
+		composeArtifact))
+	bumpCmd.AddCommand(newArtifactBumpCommand("aspire",
+		"Bump image tags in an Aspire manifest",
+		"Update the resources.<name>.image strings of an Aspire manifest JSON file "+
+			"(aspire-manifest.json), such as those of container.v0 resources.",
+		aspireArtifact))
+}
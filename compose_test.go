@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const composeFile = `services:
+  api:
+    image: ghcr.io/my-org/my-api:1.7.99 # built by CI
+    environment:
+      UPSTREAM: ghcr.io/my-org/my-api:1.7.99
+  web:
+    image: "ghcr.io/my-org/web-app:1.7.99"
+  proxy:
+    image: ghcr.io/my-org/my-api:1.7.99@sha256:0123456789abcdef
+  db:
+    image: postgres:16
+  worker:
+    build: ./worker
+`
+
+const aspireManifest = `{
+  "$schema": "https://json.schemastore.org/aspire-8.0.json",
+  "resources": {
+    "cache": {
+      "type": "container.v0",
+      "image": "docker.io/library/redis:7.2.4"
+    },
+    "api": {
+      "type": "project.v0",
+      "path": "../Api/Api.csproj"
+    },
+    "web": {
+      "type": "container.v0",
+      "image": "ghcr.io/my-org/web-app:1.7.99",
+      "env": {
+        "IMAGE": "ghcr.io/my-org/web-app:1.7.99"
+      }
+    }
+  }
+}
+`
+
+// TestBumpComposeFile verifies that only services.*.image strings are bumped,
+// in place, and that digest-pinned images are left alone.
+func TestBumpComposeFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "docker-compose.yaml")
+	if err := os.WriteFile(file, []byte(composeFile), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := BumpArtifactFile(file, composeArtifact, map[string]string{
+		"ghcr.io/my-org/my-api":  "1.8.0",
+		"ghcr.io/my-org/web-app": "1.8.0",
+	}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var paths []string
+	for _, c := range result.Changes {
+		paths = append(paths, c.Path)
+	}
+	if strings.Join(paths, ",") != "services.api.image,services.web.image" {
+		t.Errorf("Unexpected changes: %v", paths)
+	}
+
+	want := strings.Replace(composeFile, "image: ghcr.io/my-org/my-api:1.7.99 #", "image: ghcr.io/my-org/my-api:1.8.0 #", 1)
+	want = strings.Replace(want, `"ghcr.io/my-org/web-app:1.7.99"`, `"ghcr.io/my-org/web-app:1.8.0"`, 1)
+	if data, _ := os.ReadFile(file); string(data) != want {
+		t.Errorf("Unexpected compose file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+// TestBumpAspireManifest verifies that resource images of an Aspire manifest
+// are bumped in place, keeping the JSON formatting.
+func TestBumpAspireManifest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "aspire-manifest.json")
+	if err := os.WriteFile(file, []byte(aspireManifest), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := BumpArtifactFile(file, aspireArtifact, map[string]string{
+		"ghcr.io/my-org/web-app":  "1.8.0",
+		"docker.io/library/redis": "7.2.5",
+	}, bumpOptions{Paths: []string{"resources.web.image"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 1 {
+		t.Errorf("Expected 1 updated image, got %d", result.Updated)
+	}
+
+	want := strings.Replace(aspireManifest, `"image": "ghcr.io/my-org/web-app:1.7.99"`, `"image": "ghcr.io/my-org/web-app:1.8.0"`, 1)
+	if data, _ := os.ReadFile(file); string(data) != want {
+		t.Errorf("Unexpected manifest:\n%s\nwant:\n%s", data, want)
+	}
+
+	if _, err := BumpArtifactFile(file, composeArtifact, map[string]string{"ghcr.io/my-org/web-app": "1.9.0"}, bumpOptions{}); err == nil {
+		t.Errorf("Expected an error for a file without services")
+	}
+}
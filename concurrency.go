@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// bumpConcurrency is how many files runBumpSets bumps at the same time (set
+// with --concurrency).
+var bumpConcurrency = 1
+
+// forEachConcurrently calls fn(i) for every i in [0, n) on up to workers
+// goroutines and waits for all calls to return. With one worker the calls
+// are made in order on the calling goroutine.
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// lockedWriter serializes writes to w, so log lines of concurrent bumps do
+// not interleave mid-line.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestForEachConcurrently verifies that every index is visited exactly once.
+func TestForEachConcurrently(t *testing.T) {
+	for _, workers := range []int{1, 4, 100} {
+		var calls [50]int32
+		forEachConcurrently(len(calls), workers, func(i int) { atomic.AddInt32(&calls[i], 1) })
+		for i, n := range calls {
+			if n != 1 {
+				t.Errorf("workers=%d: index %d visited %d times", workers, i, n)
+			}
+		}
+	}
+}
+
+// TestRunBumpSetsConcurrently verifies that concurrent bumps change every
+// file and report them in file order, and that the first failure in file
+// order is returned. Files skipped after the failure still count towards the
+// progress.
+func TestRunBumpSetsConcurrently(t *testing.T) {
+	defer func(old int) { bumpConcurrency = old }(bumpConcurrency)
+	bumpConcurrency = 8
+
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 30; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("hr-%02d.yaml", i))
+		if err := os.WriteFile(file, original, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	sets := []updateSet{{Files: []string{filepath.Join(dir, "hr-*.yaml")}, Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}}}
+	report, err := runBumpSets(sets, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.Files) != len(files) {
+		t.Fatalf("Expected %d file reports, got %d", len(files), len(report.Files))
+	}
+	for i, f := range report.Files {
+		if f.File != files[i] || f.Updated != 1 {
+			t.Errorf("Report %d: expected %s with 1 update, got %s with %d", i, files[i], f.File, f.Updated)
+		}
+		if data, _ := os.ReadFile(files[i]); !strings.Contains(string(data), "tag: 1.8.0") {
+			t.Errorf("Expected %s to be bumped", files[i])
+		}
+	}
+
+	if err := os.WriteFile(files[3], []byte("kind: HelmRelease\napiVersion: example.com/v1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(files[20], []byte("kind: HelmRelease\napiVersion: example.com/v1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	sets[0].Images["ghcr.io/my-org/my-api"] = "1.9.0"
+	var buf bytes.Buffer
+	out := logOut
+	logOut = &buf
+	_, err = runBumpSets(sets, false, false)
+	logOut = out
+	if err == nil || !strings.HasPrefix(err.Error(), files[3]+":") {
+		t.Errorf("Expected the error of %s, got: %v", files[3], err)
+	}
+	if want := fmt.Sprintf("⏱️ bump: %d file(s) in ", len(files)); !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected the progress to count skipped files, got %q", buf.String())
+	}
+}
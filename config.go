@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultConfigFile is read by bump when it is run without --config, --file
+// or --set and the file exists in the working directory.
+const defaultConfigFile = "flux-helpers.yaml"
+
+// bumpConfig is the declarative form of a bump invocation, e.g.:
+//
+//	dryRun: false
+//	output: text
+//	followValuesFrom: true
+//	strict: true
+//	concurrency: 8
+//	policy: policy.yaml
+//	checkExists: true
+//	rewrites: rewrites.yaml
+//	postHooks:
+//	  - kustomize build ./clusters/prod | kubeconform -strict
+//	matchers:
+//	  - name: container-image
+//	    keys: [containerImage]
+//	updates:
+//	  - files: [clusters/*/my-app.yaml]
+//	    images:
+//	      ghcr.io/my-org/my-api: 1.4.0
+//
+// The updates list has the same format as a plan updates file, and matchers
+// (see imageMatcher) extend the image reference shapes recognised in every
+// update set. Flags passed on the command line take precedence over the
+// defaults set here, which in turn only replace the values of the settings
+// file and FLUX_HELPERS_* variables for the keys the file sets.
+type bumpConfig struct {
+	DryRun           bool           `json:"dryRun,omitempty"`
+	Output           string         `json:"output,omitempty"`
+	FollowValuesFrom bool           `json:"followValuesFrom,omitempty"`
+	Strict           bool           `json:"strict,omitempty"`
+	Concurrency      int            `json:"concurrency,omitempty"`
+	Policy           string         `json:"policy,omitempty"`
+	CheckExists      bool           `json:"checkExists,omitempty"`
+	Rewrites         string         `json:"rewrites,omitempty"`
+	PostHooks        []string       `json:"postHooks,omitempty"`
+	Matchers         []imageMatcher `json:"matchers,omitempty"`
+	Updates          []updateSet    `json:"updates"`
+
+	// keys are the top-level keys set in the file.
+	keys map[string]bool
+}
+
+// has reports whether the config file sets the top-level key.
+func (c *bumpConfig) has(key string) bool {
+	return c.keys[key]
+}
+
+// loadBumpConfig reads and validates a bump config file.
+func loadBumpConfig(path string) (*bumpConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg bumpConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	cfg.keys = map[string]bool{}
+	for key := range keys {
+		cfg.keys[key] = true
+	}
+	if len(cfg.Updates) == 0 {
+		return nil, fmt.Errorf("invalid config file %s: no updates defined", path)
+	}
+	shareMatchers(cfg.Updates, cfg.Matchers)
+	if err := validateUpdateSets(cfg.Updates); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if cfg.Output != "" {
+		if err := validateBumpOutputFormat(cfg.Output); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// applyBumpConfig sets the bump flags that were not given on the command line
+// from the keys cfg sets. Keys the file leaves out keep the value of their
+// flag, which may come from the settings file or a FLUX_HELPERS_* variable
+// (see applySettings).
+//
+// postHooks are shell commands, so they are only taken from a file named with
+// --config (explicit); those of a flux-helpers.yaml found in the working
+// directory, which may come from an untrusted checkout, are ignored.
+func applyBumpConfig(flags *pflag.FlagSet, cfg *bumpConfig, explicit bool) {
+	unset := func(flag, key string) bool {
+		return !flags.Changed(flag) && cfg.has(key)
+	}
+	if unset("dry-run", "dryRun") {
+		dryRun = cfg.DryRun
+	}
+	if unset("output", "output") && cfg.Output != "" {
+		outputFormat = cfg.Output
+	}
+	if unset("follow-values-from", "followValuesFrom") {
+		followValuesFrom = cfg.FollowValuesFrom
+	}
+	if unset("strict", "strict") {
+		strict = cfg.Strict
+	}
+	if unset("concurrency", "concurrency") && cfg.Concurrency != 0 {
+		bumpConcurrency = cfg.Concurrency
+	}
+	if unset("policy", "policy") {
+		policyPath = cfg.Policy
+	}
+	if unset("check-exists", "checkExists") {
+		checkExists = cfg.CheckExists
+	}
+	if unset("rewrites", "rewrites") {
+		rewritesPath = cfg.Rewrites
+	}
+	if unset("post-hook", "postHooks") {
+		if explicit {
+			postHooks = cfg.PostHooks
+		} else if len(cfg.PostHooks) > 0 {
+			logf("⚠️ Ignoring the postHooks of %s; pass it with --config to run them\n", defaultConfigFile)
+		}
+	}
+}
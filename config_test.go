@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpConfig verifies that a config file is loaded with its defaults and
+// that every update set in it is applied in a single run.
+func TestBumpConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"multiple-bump.yaml", "aspire-test.yaml"} {
+		data, err := os.ReadFile(filepath.Join("test_files", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write fixture copy: %v", err)
+		}
+	}
+
+	config := `output: json
+updates:
+  - files: [` + filepath.Join(dir, "*.yaml") + `]
+    images:
+      ghcr.io/my-org/web-app: 1.8.0
+  - files: [` + filepath.Join(dir, "multiple-bump.yaml") + `]
+    paths: [sidecar.image]
+    images:
+      envoyproxy/envoy: 1.27.0
+`
+	configPath := filepath.Join(dir, "release.yml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := loadBumpConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error loading config: %v", err)
+	}
+	if cfg.Output != outputJSON || cfg.DryRun {
+		t.Errorf("Unexpected defaults: output=%q dryRun=%v", cfg.Output, cfg.DryRun)
+	}
+
+	report, err := runBumpSets(cfg.Updates, cfg.DryRun, cfg.FollowValuesFrom)
+	if err != nil {
+		t.Fatalf("Unexpected error running config: %v", err)
+	}
+
+	updated := 0
+	for _, f := range report.Files {
+		updated += f.Updated
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 image updates, got: %d", updated)
+	}
+
+	aspire, _ := os.ReadFile(filepath.Join(dir, "aspire-test.yaml"))
+	structured, _ := os.ReadFile(filepath.Join(dir, "multiple-bump.yaml"))
+	if !strings.Contains(string(aspire), "ghcr.io/my-org/web-app:1.8.0") {
+		t.Errorf("Expected web-app to be bumped, got:\n%s", aspire)
+	}
+	if !strings.Contains(string(structured), "tag: 1.27.0") {
+		t.Errorf("Expected envoy to be bumped, got:\n%s", structured)
+	}
+
+	t.Run("invalid output", func(t *testing.T) {
+		bad := filepath.Join(dir, "bad.yml")
+		_ = os.WriteFile(bad, []byte(strings.Replace(config, "output: json", "output: xml", 1)), 0644)
+		if _, err := loadBumpConfig(bad); err == nil {
+			t.Errorf("Expected an error for an unsupported output format")
+		}
+	})
+}
+
+// TestApplyBumpConfig verifies that a config file only overrides the settings
+// and FLUX_HELPERS_* variables for the keys it sets.
+func TestApplyBumpConfig(t *testing.T) {
+	savedPolicy, savedCheck, savedStrict, savedDryRun := policyPath, checkExists, strict, dryRun
+	t.Cleanup(func() {
+		policyPath, checkExists, strict, dryRun = savedPolicy, savedCheck, savedStrict, savedDryRun
+	})
+
+	env := map[string]string{"FLUX_HELPERS_POLICY": "policy.yaml", "FLUX_HELPERS_CHECK_EXISTS": "true"}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := applySettings(bumpCmd, nil, lookupEnv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "flux-helpers.yaml")
+	config := "strict: true\ncheckExists: false\nupdates:\n  - files: [app.yaml]\n    images: {nginx: 1.26.0}\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadBumpConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	applyBumpConfig(bumpCmd.Flags(), cfg, true)
+	if policyPath != "policy.yaml" {
+		t.Errorf("Expected $FLUX_HELPERS_POLICY to be kept, got %q", policyPath)
+	}
+	if checkExists || !strict || dryRun {
+		t.Errorf("Expected the keys of the config file to apply, got checkExists=%v strict=%v dryRun=%v", checkExists, strict, dryRun)
+	}
+}
+
+// TestApplyBumpConfigPostHooks verifies that post hooks are only taken from a
+// config file passed with --config, not from one found in the working
+// directory.
+func TestApplyBumpConfigPostHooks(t *testing.T) {
+	saved := postHooks
+	t.Cleanup(func() { postHooks = saved })
+
+	configPath := filepath.Join(t.TempDir(), defaultConfigFile)
+	config := "postHooks: [touch pwned]\nupdates:\n  - files: [app.yaml]\n    images: {nginx: 1.26.0}\n"
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadBumpConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	postHooks = nil
+	applyBumpConfig(bumpCmd.Flags(), cfg, false)
+	if len(postHooks) != 0 {
+		t.Errorf("Expected the post hooks of a discovered config file to be ignored, got %q", postHooks)
+	}
+	applyBumpConfig(bumpCmd.Flags(), cfg, true)
+	if len(postHooks) != 1 || postHooks[0] != "touch pwned" {
+		t.Errorf("Expected the post hooks of an explicit config file, got %q", postHooks)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseCreateValuesPaths parses --create-values-path arguments of the form
+// repo=path, or a bare path when exactly one image is bumped, into a map of
+// image repository to the values path its block is created at.
+//
+// Parameters:
+//   - args: The --create-values-path arguments.
+//   - images: The requested image updates (--set), used to resolve a bare path.
+//
+// Returns:
+//   - The map, or nil when args is empty.
+//   - An error if an argument is malformed or a bare path is ambiguous.
+func parseCreateValuesPaths(args []string, images map[string]string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	paths := map[string]string{}
+	for _, arg := range args {
+		repo, path, ok := strings.Cut(arg, "=")
+		if !ok {
+			if len(images) != 1 {
+				return nil, fmt.Errorf("invalid --create-values-path %q: use repo=path when bumping more than one image", arg)
+			}
+			repo, path = sortedKeys(images)[0], arg
+		}
+		if repo == "" || path == "" {
+			return nil, fmt.Errorf("invalid --create-values-path %q (expected repo=path or path)", arg)
+		}
+		paths[repo] = path
+	}
+	return paths, nil
+}
+
+// validateCreateValuesPaths checks that every image of paths is a plain image
+// requested in images (globs and path-scoped updates are not created) and
+// that every path is a dotted path of map keys.
+func validateCreateValuesPaths(paths, images map[string]string) error {
+	for _, repo := range sortedKeys(paths) {
+		if isImageGlob(repo) || strings.Contains(repo, scopedImageSeparator) {
+			return fmt.Errorf("cannot create a values path for %q: only plain image repositories can be created", repo)
+		}
+		if _, ok := images[repo]; !ok {
+			return fmt.Errorf("cannot create a values path for %s: the image is not bumped", repo)
+		}
+		for _, part := range splitValuesPath(paths[repo]) {
+			if part == "" || strings.HasPrefix(part, "[") {
+				return fmt.Errorf("invalid values path %q for %s: only map keys can be created", paths[repo], repo)
+			}
+		}
+	}
+	return nil
+}
+
+// createImageBlock adds a repository/tag block for imageName at path in
+// values, for an image the values do not reference yet:
+//
+//	path:
+//	  repository: <imageName>
+//	  tag: <newVersion>
+//
+// Missing parent maps are created. The change is reported with an empty
+// OldValue. In dry-run mode values are left as they are.
+//
+// Returns:
+//   - The change, or none if it was deselected or newVersion is not a version.
+//   - An error if path, or one of its parents, holds something other than a
+//     map, or the block at path already has a repository or tag.
+func createImageBlock(values map[string]interface{}, imageName, newVersion, path string, opts bumpOptions) ([]tagChange, error) {
+	parts := splitValuesPath(path)
+	var block map[string]interface{}
+	node := values
+	for i, key := range parts {
+		existing, ok := node[key]
+		if !ok || existing == nil {
+			block = nil
+			break
+		}
+		child, isMap := existing.(map[string]interface{})
+		if !isMap {
+			return nil, &valuesPathError{Path: strings.Join(parts[:i+1], "."), Err: fmt.Errorf("cannot create an image block for %s at %s: %s is not a map", imageName, path, strings.Join(parts[:i+1], "."))}
+		}
+		node, block = child, child
+	}
+	for _, key := range []string{repositoryTagMatcher.RepositoryKey, repositoryTagMatcher.TagKey} {
+		if _, ok := block[key]; ok {
+			return nil, &valuesPathError{Path: joinValuesPath(path, key), Err: fmt.Errorf("cannot create an image block for %s at %s: it already has a %s", imageName, path, key)}
+		}
+	}
+
+	skipped := skippedMatch{Image: imageName, Path: path, Wanted: newVersion}
+	if format := opts.tagFormatFor(imageName); !format.valid(newVersion) {
+		logf("⚠️ Invalid version: %s is not a %s tag (skipping %s)\n", newVersion, format, imageName)
+		opts.Skips.record(skipped.because(skipInvalidVersion))
+		return nil, nil
+	}
+	change := tagChange{
+		Image:    imageName,
+		Path:     joinValuesPath(path, repositoryTagMatcher.TagKey),
+		NewValue: newVersion,
+	}
+	if opts.Select != nil && !opts.Select(change) {
+		logf("⏭️ Skipped %s at %s\n", imageName, path)
+		opts.Skips.record(skipped.because(skipDeselected))
+		return nil, nil
+	}
+
+	if opts.DryRun {
+		logf("[dry-run] Would create %s at %s with tag %s\n", imageName, path, newVersion)
+		return []tagChange{change}, nil
+	}
+	for key, value := range map[string]string{
+		repositoryTagMatcher.RepositoryKey: imageName,
+		repositoryTagMatcher.TagKey:        newVersion,
+	} {
+		if _, err := ensureValuesKey(values, append(parts[:len(parts):len(parts)], key), value); err != nil {
+			return nil, err
+		}
+	}
+	logf("➕ Created %s at %s with tag %s\n", imageName, path, newVersion)
+	return []tagChange{change}, nil
+}
+
+// createPlannedImageBlock replays a change createImageBlock reported, for a
+// plan: the repository/tag block its path ends in is created, provided the
+// block has neither key yet.
+//
+// Returns:
+//   - Whether the change creates a block and the block was created.
+func createPlannedImageBlock(values map[string]interface{}, c tagChange) bool {
+	blockPath, ok := strings.CutSuffix(c.Path, "."+repositoryTagMatcher.TagKey)
+	if c.OldValue != "" || !ok {
+		return false
+	}
+	parts := splitValuesPath(blockPath)
+	node := values
+	for _, key := range parts {
+		if key == "" || strings.HasPrefix(key, "[") {
+			return false
+		}
+		existing, ok := node[key]
+		if !ok || existing == nil {
+			node = nil
+			break
+		}
+		if node, ok = existing.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	for _, key := range []string{repositoryTagMatcher.RepositoryKey, repositoryTagMatcher.TagKey} {
+		if _, ok := node[key]; ok {
+			return false
+		}
+	}
+	for key, value := range map[string]string{
+		repositoryTagMatcher.RepositoryKey: c.Image,
+		repositoryTagMatcher.TagKey:        c.NewValue,
+	} {
+		if _, err := ensureValuesKey(values, append(parts[:len(parts):len(parts)], key), value); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBumpWithoutValues verifies that HelmReleases with missing, null, empty
+// or block scalar .spec.values are bumped without errors, and that
+// CreatePaths adds a block for an image the values do not reference.
+func TestBumpWithoutValues(t *testing.T) {
+	header := "apiVersion: helm.toolkit.fluxcd.io/v2\nkind: HelmRelease\nmetadata:\n  name: app\nspec:\n  interval: 5m\n"
+	updates := map[string]string{"ghcr.io/acme/api": "1.2.0"}
+	for name, values := range map[string]string{
+		"missing":      "",
+		"null":         "  values:\n",
+		"empty string": "  values: \"\"\n",
+		"empty map":    "  values: {}\n",
+		"block scalar": "  values: |\n    replicas: 2\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := bumpHelmReleaseData([]byte(header+values), updates, bumpOptions{})
+			if err != nil || result.Updated != 0 {
+				t.Fatalf("Expected nothing to be bumped, got %v, %v", result, err)
+			}
+
+			opts := bumpOptions{CreatePaths: map[string]string{"ghcr.io/acme/api": "api.image"}}
+			result, err = bumpHelmReleaseData([]byte(header+values), updates, opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			want := []tagChange{{Image: "ghcr.io/acme/api", Path: "api.image.tag", NewValue: "1.2.0"}}
+			if !reflect.DeepEqual(result.Changes, want) {
+				t.Errorf("Unexpected changes: %+v", result.Changes)
+			}
+			if !strings.Contains(string(result.Output), "    api:\n      image:\n        repository: ghcr.io/acme/api\n        tag: 1.2.0\n") {
+				t.Errorf("Expected the created block in:\n%s", result.Output)
+			}
+			if name == "block scalar" && !strings.Contains(string(result.Output), "    replicas: 2\n") {
+				t.Errorf("Expected the block scalar values to be kept as a mapping:\n%s", result.Output)
+			}
+		})
+	}
+}
+
+// TestCreateImageBlockConflicts verifies that blocks are not created over
+// values that are not maps or over another image's block, and that existing
+// references are bumped instead of created.
+func TestCreateImageBlockConflicts(t *testing.T) {
+	values := map[string]interface{}{
+		"image":   "nginx:1.0.0",
+		"sidecar": map[string]interface{}{"repository": "envoy", "tag": "1.0.0"},
+	}
+	for _, path := range []string{"image.api", "sidecar"} {
+		if _, err := createImageBlock(values, "ghcr.io/acme/api", "1.2.0", path, bumpOptions{}); err == nil {
+			t.Errorf("Expected creating a block at %s to fail", path)
+		}
+	}
+
+	opts := bumpOptions{CreatePaths: map[string]string{"nginx": "web.image"}}
+	changes, err := bumpTagInValues(values, "nginx", "1.1.0", opts)
+	if err != nil || len(changes) != 1 || changes[0].OldValue != "nginx:1.0.0" {
+		t.Errorf("Expected the existing reference to be bumped, got %+v, %v", changes, err)
+	}
+	if _, ok := values["web"]; ok {
+		t.Error("Expected no block to be created for a referenced image")
+	}
+}
+
+// TestParseCreateValuesPaths verifies the repo=path and bare path forms of
+// --create-values-path.
+func TestParseCreateValuesPaths(t *testing.T) {
+	one := map[string]string{"nginx": "1.2.3"}
+	two := map[string]string{"nginx": "1.2.3", "redis": "7.0.0"}
+
+	got, err := parseCreateValuesPaths([]string{"image"}, one)
+	if err != nil || !reflect.DeepEqual(got, map[string]string{"nginx": "image"}) {
+		t.Errorf("Unexpected result for a bare path: %v, %v", got, err)
+	}
+	got, err = parseCreateValuesPaths([]string{"nginx=web.image", "redis=cache.image"}, two)
+	if err != nil || !reflect.DeepEqual(got, map[string]string{"nginx": "web.image", "redis": "cache.image"}) {
+		t.Errorf("Unexpected result for repo=path: %v, %v", got, err)
+	}
+	if _, err := parseCreateValuesPaths([]string{"image"}, two); err == nil {
+		t.Error("Expected a bare path with several images to be rejected")
+	}
+	for _, paths := range []map[string]string{{"postgres": "db.image"}, {"nginx": "containers[0].image"}, {"ghcr.io/*": "image"}} {
+		if err := validateCreateValuesPaths(paths, two); err == nil {
+			t.Errorf("Expected %v to be rejected", paths)
+		}
+	}
+}
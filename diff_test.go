@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// TestUnifiedDiff checks the hunk layout produced by unifiedDiff.
+func TestUnifiedDiff(t *testing.T) {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	to := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+
+	want := `--- old
++++ new
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if got := unifiedDiff("old", "new", []byte(from), []byte(to)); got != want {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+
+	if got := unifiedDiff("old", "new", []byte(from), []byte(from)); got != "" {
+		t.Errorf("Expected no diff for equal input, got:\n%s", got)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// driftMissing is reported as the cluster value of an image or HelmRelease
+// that is in git but not in the cluster.
+const driftMissing = "(missing)"
+
+// driftEntry is an image whose tag in git differs from the live cluster.
+type driftEntry struct {
+	File string `json:"file"`
+	// HelmRelease is the namespace/name of the HelmRelease.
+	HelmRelease string `json:"helmRelease"`
+	// Source is "helmrelease" for the values of the live HelmRelease and
+	// "pod" for an image a running pod of the release uses.
+	Source string `json:"source"`
+	// Path is the values path of the reference, or pod/container for a pod.
+	Path    string `json:"path"`
+	Image   string `json:"image"`
+	Git     string `json:"git"`
+	Cluster string `json:"cluster"`
+}
+
+var (
+	driftFiles []string
+	driftDir   string
+	driftPods  bool
+)
+
+// podResource is the GroupVersionResource of core/v1 pods.
+func podResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+}
+
+// DetectDrift compares the image tags of the HelmRelease manifests in files
+// with the HelmReleases of the same name and namespace in the cluster, and
+// optionally with the images the pods of each release run, to catch manual
+// kubectl edits and rollouts that did not happen.
+//
+// A HelmRelease without a namespace in git is looked up in the namespace of
+// the kubeconfig context. Pods are those of the release's target namespace
+// labelled app.kubernetes.io/instance=<release name>, as charts following the
+// Helm conventions label them.
+//
+// Parameters:
+//   - ctx: Cancels the Kubernetes API requests.
+//   - kc: The cluster to compare with.
+//   - files: The HelmRelease manifests in git.
+//   - matchers: The image matchers to find references with.
+//   - pods: If true, running pods are compared too.
+//
+// Returns:
+//   - The drifted images, in file order.
+//   - An error if a file cannot be read or parsed, or the cluster cannot be
+//     queried.
+func DetectDrift(ctx context.Context, kc *kubeClient, files []string, matchers []imageMatcher, pods bool) ([]driftEntry, error) {
+	drift := []driftEntry{}
+	bar := startProgress("drift", "file", len(files))
+	for _, file := range files {
+		entries, err := detectFileDrift(ctx, kc, file, matchers, pods)
+		if err != nil {
+			return drift, fmt.Errorf("%s: %w", file, err)
+		}
+		drift = append(drift, entries...)
+		bar.Increment()
+	}
+	bar.Done()
+	return drift, nil
+}
+
+// detectFileDrift is DetectDrift for a single manifest.
+func detectFileDrift(ctx context.Context, kc *kubeClient, file string, matchers []imageMatcher, pods bool) ([]driftEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		logf("⚠️ %s is SOPS-encrypted, skipping\n", file)
+		return nil, nil
+	}
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := hr.Object.(interface {
+		GetName() string
+		GetNamespace() string
+	})
+	if !ok || meta.GetName() == "" {
+		return nil, fmt.Errorf("HelmRelease has no name")
+	}
+	name, namespace := meta.GetName(), meta.GetNamespace()
+	if namespace == "" {
+		namespace = kc.Namespace
+	}
+	gitRefs, err := listImageReferences(file, data, matchers)
+	if err != nil {
+		return nil, err
+	}
+	id := namespace + "/" + name
+
+	var obj *unstructured.Unstructured
+	err = kubeCall(ctx, "get HelmRelease", func(ctx context.Context) (err error) {
+		obj, err = kc.Client.Resource(helmReleaseResource()).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		logf("❓ HelmRelease %s is not in the cluster\n", id)
+		return []driftEntry{{File: file, HelmRelease: id, Source: "helmrelease", Git: "present", Cluster: driftMissing}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HelmRelease %s: %w", id, err)
+	}
+	live, err := json.Marshal(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode HelmRelease %s: %w", id, err)
+	}
+	liveRefs, err := listImageReferences(file, live, matchers)
+	if err != nil {
+		return nil, fmt.Errorf("live HelmRelease %s: %w", id, err)
+	}
+
+	var drift []driftEntry
+	liveTags := map[string]string{}
+	for _, ref := range liveRefs {
+		liveTags[ref.Path+"\x00"+ref.Image] = ref.Tag
+	}
+	for _, ref := range gitRefs {
+		tag, ok := liveTags[ref.Path+"\x00"+ref.Image]
+		if !ok {
+			tag = driftMissing
+		}
+		if tag != ref.Tag {
+			drift = append(drift, driftEntry{File: file, HelmRelease: id, Source: "helmrelease", Path: ref.Path, Image: ref.Image, Git: ref.Tag, Cluster: tag})
+		}
+	}
+	if !pods {
+		return drift, nil
+	}
+
+	liveHR, err := decodeHelmRelease(live)
+	if err != nil {
+		return nil, fmt.Errorf("live HelmRelease %s: %w", id, err)
+	}
+	releaseName, targetNamespace := liveHR.ReleaseIdentity()
+	podDrift, err := detectPodDrift(ctx, kc, file, id, releaseName, targetNamespace, gitRefs)
+	if err != nil {
+		return nil, err
+	}
+	return append(drift, podDrift...), nil
+}
+
+// detectPodDrift reports the containers of the pods of a release that run
+// one of the images of refs with a tag git does not have for it.
+func detectPodDrift(ctx context.Context, kc *kubeClient, file, id, releaseName, namespace string, refs []imageReference) ([]driftEntry, error) {
+	gitTags := map[string][]string{}
+	for _, ref := range refs {
+		repo := normalizeImageRepository(ref.Image)
+		gitTags[repo] = append(gitTags[repo], ref.Tag)
+	}
+
+	var list *unstructured.UnstructuredList
+	err := kubeCall(ctx, "list pods", func(ctx context.Context) (err error) {
+		list, err = kc.Client.Resource(podResource()).Namespace(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "app.kubernetes.io/instance=" + releaseName,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of %s: %w", id, err)
+	}
+
+	var drift []driftEntry
+	for _, pod := range list.Items {
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", field)
+			for _, c := range containers {
+				container, _ := c.(map[string]interface{})
+				image, _ := container["image"].(string)
+				repo, tag := splitRunningImage(image)
+				tags, ok := gitTags[repo]
+				if !ok || slices.Contains(tags, tag) {
+					continue
+				}
+				drift = append(drift, driftEntry{
+					File: file, HelmRelease: id, Source: "pod",
+					Path:  namespace + "/" + pod.GetName() + "/" + fmt.Sprint(container["name"]),
+					Image: repo, Git: strings.Join(tags, ","), Cluster: dashIfEmpty(tag),
+				})
+			}
+		}
+	}
+	sort.SliceStable(drift, func(i, j int) bool { return drift[i].Path < drift[j].Path })
+	return drift, nil
+}
+
+// normalizeImageRepository drops the docker.io registry and library/
+// namespace Docker Hub images may be written with or without.
+func normalizeImageRepository(repo string) string {
+	repo = strings.TrimPrefix(repo, "docker.io/")
+	return strings.TrimPrefix(repo, "library/")
+}
+
+// splitRunningImage splits the image of a container into its normalized
+// repository and its tag, ignoring a pinned digest. The tag is empty for an
+// image referenced by digest only.
+func splitRunningImage(image string) (repo, tag string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, tag = image[:i], image[i+1:]
+	}
+	return normalizeImageRepository(image), tag
+}
+
+// writeDriftTable prints drift as an aligned table.
+func writeDriftTable(w io.Writer, drift []driftEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HELMRELEASE\tSOURCE\tPATH\tIMAGE\tGIT\tCLUSTER")
+	for _, d := range drift {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.HelmRelease, d.Source, dashIfEmpty(d.Path), dashIfEmpty(d.Image), d.Git, d.Cluster)
+	}
+	return tw.Flush()
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Compare the image tags in git with the HelmReleases and pods in a cluster",
+	Long: `Compare the image tags of HelmRelease manifests in git with the HelmReleases of
+the same name in a live cluster (and, with --pods, with the images their pods
+run), and fail if any differs: a check for manual kubectl edits and stuck
+rollouts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(driftFiles) == 0 && driftDir == "" {
+			return fmt.Errorf("--file or --dir is required")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		files, err := expandFileGlobs(driftFiles)
+		if err != nil {
+			return err
+		}
+		if driftDir != "" {
+			found, err := helmReleaseFilesInDir(driftDir)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", driftDir, err)
+			}
+			for _, f := range found {
+				files = appendUnique(files, f)
+			}
+		}
+
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+		kc, err := newKubeClient(kubeconfigPath, kubeContext, kubeNamespace)
+		if err != nil {
+			return err
+		}
+		drift, err := DetectDrift(cmd.Context(), kc, files, matchers, driftPods)
+		if err != nil {
+			return fmt.Errorf("failed to detect drift: %w", err)
+		}
+		if outputFormat == outputJSON {
+			if err := writeJSON(os.Stdout, drift); err != nil {
+				return err
+			}
+		} else if len(drift) > 0 {
+			if err := writeDriftTable(os.Stdout, drift); err != nil {
+				return err
+			}
+		}
+		if len(drift) > 0 {
+			return fmt.Errorf("%d image(s) drifted from git in context %s", len(drift), kc.Context)
+		}
+		logf("🎉 %d HelmRelease(s) match context %s\n", len(files), kc.Context)
+		return nil
+	},
+}
+
+func init() {
+	driftCmd.Flags().StringArrayVarP(&driftFiles, "file", "f", nil, "HelmRelease YAML file(s) to compare; globs are expanded (repeatable)")
+	driftCmd.Flags().StringVar(&driftDir, "dir", "", "Compare every HelmRelease YAML file below this directory")
+	driftCmd.Flags().BoolVar(&driftPods, "pods", false, "Also compare the images the pods of each release run")
+	driftCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text (a table) or json")
+	driftCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	driftCmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubeconfig context to compare with (default: the current context)")
+	driftCmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to the kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
+	driftCmd.Flags().StringVarP(&kubeNamespace, "namespace", "n", "", "Namespace of HelmReleases that have none in git (default: the kubeconfig context's namespace)")
+	rootCmd.AddCommand(driftCmd)
+}
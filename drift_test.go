@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// TestDetectDrift verifies that tags edited in the cluster and pods running
+// other tags are reported, and a missing HelmRelease is reported as such.
+func TestDetectDrift(t *testing.T) {
+	hr := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata":   map[string]interface{}{"name": "my-app", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"chart": map[string]interface{}{"spec": map[string]interface{}{"chart": "my-chart"}},
+			"values": map[string]interface{}{
+				"image":  map[string]interface{}{"repository": "ghcr.io/my-org/my-api", "tag": "1.8.0"},
+				"images": map[string]interface{}{"web": "ghcr.io/my-org/web-app:1.7.99"},
+			},
+		},
+	}}
+	pod := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name": "my-app-web-1", "namespace": "apps",
+			"labels": map[string]interface{}{"app.kubernetes.io/instance": "my-app"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "ghcr.io/my-org/web-app:1.7.98@sha256:abc"},
+				map[string]interface{}{"name": "proxy", "image": "envoyproxy/envoy:v1.30"},
+			},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		helmReleaseResource(): "HelmReleaseList",
+		podResource():         "PodList",
+	}, hr, pod)
+	kc := &kubeClient{Client: client, Context: "test", Namespace: "default"}
+
+	drift, err := DetectDrift(context.Background(), kc, []string{"test_files/helmrelease-v2.yaml"}, nil, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []driftEntry{
+		{Source: "helmrelease", Path: "image", Image: "ghcr.io/my-org/my-api", Git: "1.7.99", Cluster: "1.8.0"},
+		{Source: "pod", Path: "apps/my-app-web-1/web", Image: "ghcr.io/my-org/web-app", Git: "1.7.99", Cluster: "1.7.98"},
+	}
+	if len(drift) != len(want) {
+		t.Fatalf("Expected %d drifted images, got: %+v", len(want), drift)
+	}
+	for i, w := range want {
+		d := drift[i]
+		if d.HelmRelease != "apps/my-app" || d.Source != w.Source || d.Path != w.Path || d.Image != w.Image || d.Git != w.Git || d.Cluster != w.Cluster {
+			t.Errorf("Expected %+v, got %+v", w, d)
+		}
+	}
+
+	empty := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		helmReleaseResource(): "HelmReleaseList",
+	})
+	drift, err = DetectDrift(context.Background(), &kubeClient{Client: empty, Context: "test"}, []string{"test_files/helmrelease-v2.yaml"}, nil, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(drift) != 1 || drift[0].Cluster != driftMissing {
+		t.Errorf("Expected the HelmRelease to be reported missing, got: %+v", drift)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultE2ECluster is the name of the kind cluster test e2e creates.
+const defaultE2ECluster = "flux-helpers-e2e"
+
+var (
+	e2eKind      bool
+	e2eCluster   string
+	e2eKeep      bool
+	e2eTimeout   = 5 * time.Minute
+	e2eManifests []string
+)
+
+// e2ePollInterval is how often the pods are checked for the new images.
+var e2ePollInterval = 5 * time.Second
+
+// e2eRun runs an external command of the e2e harness (kind, flux, kubectl)
+// with stdin, returning its stdout; tests replace it.
+var e2eRun = func(stdin []byte, name string, args ...string) ([]byte, error) {
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("test e2e needs %s on the PATH: %w", name, err)
+	}
+	cmd := exec.Command(bin, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// e2eHarness is a kind cluster with Flux installed, reached through its own
+// kubeconfig so the user's contexts are never touched.
+type e2eHarness struct {
+	Cluster    string
+	Kubeconfig string
+	// created is set when the harness created the cluster, which is then the
+	// one it deletes.
+	created bool
+}
+
+// up creates the kind cluster, or reuses it if it exists, and installs Flux.
+func (h *e2eHarness) up() error {
+	clusters, err := e2eRun(nil, "kind", "get", "clusters")
+	if err != nil {
+		return err
+	}
+	if slices.Contains(strings.Fields(string(clusters)), h.Cluster) {
+		logf("♻️ Reusing kind cluster %s\n", h.Cluster)
+		if _, err := e2eRun(nil, "kind", "export", "kubeconfig", "--name", h.Cluster, "--kubeconfig", h.Kubeconfig); err != nil {
+			return err
+		}
+	} else {
+		logf("🚀 Creating kind cluster %s\n", h.Cluster)
+		if _, err := e2eRun(nil, "kind", "create", "cluster", "--name", h.Cluster, "--kubeconfig", h.Kubeconfig, "--wait", "2m"); err != nil {
+			return err
+		}
+		h.created = true
+	}
+	logln("📦 Installing Flux")
+	_, err = e2eRun(nil, "flux", "install", "--kubeconfig", h.Kubeconfig)
+	return err
+}
+
+// down deletes the kind cluster if the harness created it.
+func (h *e2eHarness) down() error {
+	if !h.created {
+		return nil
+	}
+	logf("🧹 Deleting kind cluster %s\n", h.Cluster)
+	_, err := e2eRun(nil, "kind", "delete", "cluster", "--name", h.Cluster)
+	return err
+}
+
+// kubectl runs kubectl against the harness cluster.
+func (h *e2eHarness) kubectl(stdin []byte, args ...string) ([]byte, error) {
+	return e2eRun(stdin, "kubectl", append([]string{"--kubeconfig", h.Kubeconfig}, args...)...)
+}
+
+// podImages returns the container and init container images of the pods in
+// namespace.
+func (h *e2eHarness) podImages(namespace string) ([]string, error) {
+	out, err := h.kubectl(nil, "get", "pods", "-n", namespace, "-o",
+		"jsonpath={.items[*].spec.containers[*].image} {.items[*].spec.initContainers[*].image}")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// expectedImage returns the image reference a pod runs after change: the new
+// string of a "repo:tag" value, or the repository with the new tag.
+func expectedImage(change tagChange) string {
+	if strings.HasPrefix(change.NewValue, change.Image+":") {
+		return change.NewValue
+	}
+	return change.Image + ":" + change.NewValue
+}
+
+// runsImage reports whether images holds ref, allowing for a pinned digest
+// and for the docker.io registry left out of ref.
+func runsImage(images []string, ref string) bool {
+	for _, image := range images {
+		image = strings.TrimPrefix(image, "docker.io/")
+		if image == ref || strings.HasPrefix(image, ref+"@") || strings.TrimPrefix(image, "library/") == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// RunE2E verifies a bump end to end: it applies the HelmRelease at hrFile,
+// bumped with updates, to a kind cluster with Flux installed, waits for the
+// release to become ready and checks that its pods run the new images. The
+// file itself is not modified.
+//
+// Parameters:
+//   - hrFile: The HelmRelease manifest to bump and apply.
+//   - updates: A map from image repository to the new tag, as for bump.
+//   - manifests: Files applied before the HelmRelease, such as its
+//     HelmRepository or OCIRepository.
+//   - h: The harness cluster, created (or reused) and, unless keep is set,
+//     deleted afterwards.
+//   - timeout: How long to wait for the release and for the new images.
+//
+// Returns:
+//   - The changes the bump made to the HelmRelease.
+//   - An error if nothing is bumped, a command fails, the release does not
+//     become ready, or the pods do not run every new image in time.
+func RunE2E(hrFile string, updates map[string]string, manifests []string, h *e2eHarness, keep bool, timeout time.Duration) (changes []tagChange, err error) {
+	data, err := os.ReadFile(hrFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hrFile, err)
+	}
+	meta, ok := hr.Object.(interface {
+		GetName() string
+		GetNamespace() string
+	})
+	if !ok || meta.GetName() == "" {
+		return nil, fmt.Errorf("%s: HelmRelease has no name", hrFile)
+	}
+	name, namespace := meta.GetName(), meta.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	_, targetNamespace := hr.ReleaseIdentity()
+
+	result, err := bumpHelmReleaseData(data, updates, bumpOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hrFile, err)
+	}
+	if result.Updated == 0 {
+		return nil, fmt.Errorf("%s: no image was bumped, nothing to verify", hrFile)
+	}
+
+	if err := h.up(); err != nil {
+		return nil, err
+	}
+	if !keep {
+		defer func() {
+			if downErr := h.down(); err == nil {
+				err = downErr
+			}
+		}()
+	}
+
+	namespaces := []string{namespace}
+	if targetNamespace != namespace {
+		namespaces = append(namespaces, targetNamespace)
+	}
+	for _, ns := range namespaces {
+		manifest := fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n", ns)
+		if _, err := h.kubectl([]byte(manifest), "apply", "-f", "-"); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range manifests {
+		logf("📄 Applying %s\n", file)
+		if _, err := h.kubectl(nil, "apply", "-f", file); err != nil {
+			return nil, err
+		}
+	}
+	logf("📄 Applying bumped HelmRelease %s/%s\n", namespace, name)
+	if _, err := h.kubectl(result.Output, "apply", "-f", "-"); err != nil {
+		return nil, err
+	}
+
+	logf("⏳ Waiting for HelmRelease %s/%s to become ready\n", namespace, name)
+	if _, err := h.kubectl(nil, "wait", "helmrelease/"+name, "-n", namespace, "--for=condition=Ready", "--timeout="+timeout.String()); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		images, err := h.podImages(targetNamespace)
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for _, c := range result.Changes {
+			if ref := expectedImage(c); !runsImage(images, ref) {
+				missing = append(missing, ref)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("pods in namespace %s do not run %s after %s (running: %s)",
+				targetNamespace, strings.Join(missing, ", "), timeout, dashIfEmpty(strings.Join(images, ", ")))
+		}
+		time.Sleep(e2ePollInterval)
+	}
+	for _, c := range result.Changes {
+		logf("✅ %s is running %s\n", targetNamespace, expectedImage(c))
+	}
+	return result.Changes, nil
+}
+
+// testCmd groups the commands that verify automation end to end.
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Verification harnesses for image automation",
+}
+
+var testE2ECmd = &cobra.Command{
+	Use:   "e2e",
+	Short: "Verify a bump end to end against a kind cluster running Flux",
+	Long: `Create a kind cluster (or reuse one of the same name), install Flux, apply
+the --apply manifests and the HelmRelease bumped with --set, wait for it to
+become ready and check that its pods run the new images. The HelmRelease file
+is not modified, and the cluster is deleted afterwards unless --keep is set.
+
+kind, flux and kubectl must be on the PATH.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !e2eKind {
+			return fmt.Errorf("test e2e needs --kind (kind is the only supported cluster)")
+		}
+		if filePath == "" || len(tagArgs) == 0 {
+			return fmt.Errorf("you must specify --file and at least one --set")
+		}
+		updates, _, err := parseUpdateArgs(tagArgs, nil)
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "flux-helpers-e2e-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		h := &e2eHarness{Cluster: e2eCluster, Kubeconfig: filepath.Join(dir, "kubeconfig")}
+		if _, err := RunE2E(filePath, updates, e2eManifests, h, e2eKeep, e2eTimeout); err != nil {
+			return fmt.Errorf("end-to-end test failed: %w", err)
+		}
+		if e2eKeep {
+			logf("ℹ️ Kept kind cluster %s (kind export kubeconfig --name %s)\n", h.Cluster, h.Cluster)
+		}
+		return nil
+	},
+}
+
+func init() {
+	testE2ECmd.Flags().BoolVar(&e2eKind, "kind", false, "Run against a kind cluster with Flux installed")
+	testE2ECmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
+	testE2ECmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version; repo may be a glob like ghcr.io/my-org/* (repeatable)")
+	testE2ECmd.Flags().StringArrayVar(&e2eManifests, "apply", nil, "Manifest file or directory applied before the HelmRelease, e.g. its HelmRepository (repeatable)")
+	testE2ECmd.Flags().StringVar(&e2eCluster, "cluster-name", defaultE2ECluster, "Name of the kind cluster")
+	testE2ECmd.Flags().BoolVar(&e2eKeep, "keep", false, "Keep the kind cluster afterwards")
+	testE2ECmd.Flags().DurationVar(&e2eTimeout, "wait-timeout", e2eTimeout, "How long to wait for the release to become ready and run the new images")
+
+	testCmd.AddCommand(testE2ECmd)
+	rootCmd.AddCommand(testCmd)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeE2ERun replaces e2eRun for the test with one that records the commands
+// and answers kubectl get pods with images.
+func fakeE2ERun(t *testing.T, images string) *[]string {
+	t.Helper()
+	var calls []string
+	old := e2eRun
+	e2eRun = func(stdin []byte, name string, args ...string) ([]byte, error) {
+		call := name + " " + strings.Join(args, " ")
+		calls = append(calls, call)
+		switch {
+		case strings.HasPrefix(call, "kind get clusters"):
+			return []byte("other\n"), nil
+		case strings.Contains(call, "get pods"):
+			return []byte(images), nil
+		case strings.Contains(call, "apply -f -") && strings.Contains(string(stdin), "kind: HelmRelease") &&
+			!strings.Contains(string(stdin), "tag: 1.8.0"):
+			t.Errorf("Expected the bumped HelmRelease to be applied, got:\n%s", stdin)
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { e2eRun = old })
+	return &calls
+}
+
+// TestRunE2E verifies the harness: the cluster is created, Flux installed,
+// the bumped HelmRelease applied and waited for, the pods checked for the new
+// image, and the cluster deleted.
+func TestRunE2E(t *testing.T) {
+	calls := fakeE2ERun(t, "ghcr.io/my-org/my-api:1.8.0 busybox:1.36")
+	h := &e2eHarness{Cluster: defaultE2ECluster, Kubeconfig: "kubeconfig"}
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+
+	changes, err := RunE2E("test_files/helmrelease-v2.yaml", updates, []string{"sources.yaml"}, h, false, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].NewValue != "1.8.0" {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+	want := []string{
+		"kind get clusters",
+		"kind create cluster --name flux-helpers-e2e --kubeconfig kubeconfig --wait 2m",
+		"flux install --kubeconfig kubeconfig",
+		"kubectl --kubeconfig kubeconfig apply -f -",
+		"kubectl --kubeconfig kubeconfig apply -f sources.yaml",
+		"kubectl --kubeconfig kubeconfig apply -f -",
+		"kubectl --kubeconfig kubeconfig wait helmrelease/my-app -n apps --for=condition=Ready --timeout=1m0s",
+		"kubectl --kubeconfig kubeconfig get pods -n apps -o jsonpath={.items[*].spec.containers[*].image} {.items[*].spec.initContainers[*].image}",
+		"kind delete cluster --name flux-helpers-e2e",
+	}
+	if got := strings.Join(*calls, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Expected commands:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+}
+
+// TestRunE2EMissingImage verifies that the harness fails when the pods do not
+// pick up the new image in time, and still deletes the cluster.
+func TestRunE2EMissingImage(t *testing.T) {
+	calls := fakeE2ERun(t, "ghcr.io/my-org/my-api:1.7.99")
+	old := e2ePollInterval
+	e2ePollInterval = time.Millisecond
+	t.Cleanup(func() { e2ePollInterval = old })
+	h := &e2eHarness{Cluster: defaultE2ECluster, Kubeconfig: "kubeconfig"}
+
+	_, err := RunE2E("test_files/helmrelease-v2.yaml", map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, nil, h, false, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "do not run ghcr.io/my-org/my-api:1.8.0") {
+		t.Errorf("Expected the missing image to be reported, got: %v", err)
+	}
+	if last := (*calls)[len(*calls)-1]; last != "kind delete cluster --name flux-helpers-e2e" {
+		t.Errorf("Expected the cluster to be deleted, last command: %s", last)
+	}
+}
+
+// TestRunsImage verifies the image reference comparison.
+func TestRunsImage(t *testing.T) {
+	for _, tc := range []struct {
+		image, ref string
+		want       bool
+	}{
+		{"ghcr.io/my-org/my-api:1.8.0", "ghcr.io/my-org/my-api:1.8.0", true},
+		{"ghcr.io/my-org/my-api:1.8.0@sha256:abc", "ghcr.io/my-org/my-api:1.8.0", true},
+		{"docker.io/library/nginx:1.27.0", "nginx:1.27.0", true},
+		{"docker.io/bitnami/redis:7.4.0", "bitnami/redis:7.4.0", true},
+		{"ghcr.io/my-org/my-api:1.8.0", "ghcr.io/my-org/my-api:1.8", false},
+	} {
+		if got := runsImage([]string{tc.image}, tc.ref); got != tc.want {
+			t.Errorf("runsImage(%q, %q) = %v, want %v", tc.image, tc.ref, got, tc.want)
+		}
+	}
+}
@@ -1,16 +1,191 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	helmv2 "github.com/fluxcd/helm-controller/api/v2beta1"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	helmv2beta1 "github.com/fluxcd/helm-controller/api/v2beta1"
+	helmv2beta2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	"io"
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
-	"os"
+	"k8s.io/apimachinery/pkg/labels"
+	"path"
+	"reflect"
 	"regexp"
 	"sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
+// supportedHelmReleaseVersions lists the helm.toolkit.fluxcd.io API versions
+// that can be parsed and written back, oldest first.
+var supportedHelmReleaseVersions = []string{
+	helmv2beta1.GroupVersion.String(),
+	helmv2beta2.GroupVersion.String(),
+	helmv2.GroupVersion.String(),
+}
+
+// helmReleaseManifest wraps a HelmRelease decoded with the API types that match
+// its apiVersion, together with the unstructured document it was decoded from.
+// The typed Object is read and edited through accessors; the manifest is
+// written back from the unstructured document (see encodeHelmRelease), so
+// fields the vendored API types do not know, such as those of a newer
+// helm-controller, and the whole status survive a rewrite.
+type helmReleaseManifest struct {
+	APIVersion string
+	Object     interface{}
+	values     **apiextv1.JSON
+	// document is the manifest as generic JSON values, with numbers kept as
+	// json.Number so they are written back exactly.
+	document map[string]interface{}
+}
+
+// Values returns the raw .spec.values of the HelmRelease.
+func (m *helmReleaseManifest) Values() *apiextv1.JSON {
+	return *m.values
+}
+
+// SetValues replaces the raw .spec.values of the HelmRelease.
+func (m *helmReleaseManifest) SetValues(values *apiextv1.JSON) {
+	*m.values = values
+}
+
+// helmChartRef points at the fields of a HelmRelease's .spec.chart.spec, which
+// have the same shape in every supported API version.
+type helmChartRef struct {
+	Chart           *string
+	Version         *string
+	SourceKind      *string
+	SourceName      *string
+	SourceNamespace *string
+}
+
+// ChartSpec returns pointers to the .spec.chart.spec fields of the
+// HelmRelease, or nil if it has no .spec.chart (e.g. it uses .spec.chartRef).
+func (m *helmReleaseManifest) ChartSpec() *helmChartRef {
+	switch hr := m.Object.(type) {
+	case *helmv2beta1.HelmRelease:
+		if c := hr.Spec.Chart; c != nil {
+			s := &c.Spec
+			return &helmChartRef{&s.Chart, &s.Version, &s.SourceRef.Kind, &s.SourceRef.Name, &s.SourceRef.Namespace}
+		}
+	case *helmv2beta2.HelmRelease:
+		if c := hr.Spec.Chart; c != nil {
+			s := &c.Spec
+			return &helmChartRef{&s.Chart, &s.Version, &s.SourceRef.Kind, &s.SourceRef.Name, &s.SourceRef.Namespace}
+		}
+	case *helmv2.HelmRelease:
+		if c := hr.Spec.Chart; c != nil {
+			s := &c.Spec
+			return &helmChartRef{&s.Chart, &s.Version, &s.SourceRef.Kind, &s.SourceRef.Name, &s.SourceRef.Namespace}
+		}
+	}
+	return nil
+}
+
+// ChartRef returns the .spec.chartRef of the HelmRelease, with the namespace
+// defaulted to the HelmRelease's, or nil if it has none (e.g. it uses
+// .spec.chart, or is a v2beta1 HelmRelease, which cannot reference a chart).
+func (m *helmReleaseManifest) ChartRef() *chartSourceRef {
+	var ref chartSourceRef
+	var namespace string
+	switch hr := m.Object.(type) {
+	case *helmv2beta2.HelmRelease:
+		r := hr.Spec.ChartRef
+		if r == nil {
+			return nil
+		}
+		ref, namespace = chartSourceRef{Kind: r.Kind, Name: r.Name, Namespace: r.Namespace}, hr.Namespace
+	case *helmv2.HelmRelease:
+		r := hr.Spec.ChartRef
+		if r == nil {
+			return nil
+		}
+		ref, namespace = chartSourceRef{Kind: r.Kind, Name: r.Name, Namespace: r.Namespace}, hr.Namespace
+	default:
+		return nil
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = namespace
+	}
+	return &ref
+}
+
+// decodeHelmRelease detects the apiVersion of a HelmRelease manifest and
+// unmarshals it into the matching helm-controller API type.
+//
+// Parameters:
+//   - data: The raw YAML (or JSON) bytes of the HelmRelease manifest.
+//
+// Returns:
+//   - A helmReleaseManifest holding the typed object for the detected version.
+//   - An error if the document is not a HelmRelease, its apiVersion is not one of
+//     supportedHelmReleaseVersions, it cannot be unmarshaled, or its chart
+//     fields are invalid (see validateChartSource).
+func decodeHelmRelease(data []byte) (*helmReleaseManifest, error) {
+	var typeMeta struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return nil, locateDecodeError(data, &typeMeta, fmt.Errorf("failed to unmarshal HelmRelease: %w", err))
+	}
+	if typeMeta.Kind != "HelmRelease" {
+		return nil, fmt.Errorf("unexpected kind %q (expected HelmRelease)", typeMeta.Kind)
+	}
+
+	m := &helmReleaseManifest{APIVersion: typeMeta.APIVersion}
+	switch typeMeta.APIVersion {
+	case helmv2beta1.GroupVersion.String():
+		hr := &helmv2beta1.HelmRelease{}
+		m.Object, m.values = hr, &hr.Spec.Values
+	case helmv2beta2.GroupVersion.String():
+		hr := &helmv2beta2.HelmRelease{}
+		m.Object, m.values = hr, &hr.Spec.Values
+	case helmv2.GroupVersion.String():
+		hr := &helmv2.HelmRelease{}
+		m.Object, m.values = hr, &hr.Spec.Values
+	default:
+		return nil, fmt.Errorf("unsupported HelmRelease apiVersion %q (supported: %s)",
+			typeMeta.APIVersion, strings.Join(supportedHelmReleaseVersions, ", "))
+	}
+
+	if err := yaml.Unmarshal(data, m.Object); err != nil {
+		return nil, locateDecodeError(data, m.Object, fmt.Errorf("failed to unmarshal HelmRelease %s: %w", typeMeta.APIVersion, err))
+	}
+	document, err := decodeUnstructured(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HelmRelease: %w", err)
+	}
+	m.document = document
+	if err := validateChartSource(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// decodeUnstructured parses a YAML or JSON document into generic JSON values,
+// keeping numbers as json.Number.
+func decodeUnstructured(data []byte) (map[string]interface{}, error) {
+	raw, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var document map[string]interface{}
+	if err := dec.Decode(&document); err != nil {
+		return nil, err
+	}
+	if document == nil {
+		document = map[string]interface{}{}
+	}
+	return document, nil
+}
+
 // isValidSemver validates whether a given string conforms to the semantic versioning (SemVer) format.
 // The function uses a regular expression to check for the following structure:
 // - An optional "v" prefix (e.g., "v1.2.3" or "1.2.3").
@@ -28,25 +203,41 @@ func isValidSemver(tag string) bool {
 	return semverRegex.MatchString(tag)
 }
 
-// sanitizeHelmRelease removes specific fields from a Kubernetes Helm release object
-// represented as a map. It performs the following sanitizations:
+// sanitizeHelmRelease removes the fields selected by --sanitize and
+// --sanitize-path from a Kubernetes Helm release object represented as a map.
+// By default it performs the following sanitizations:
 // 1. Removes the "creationTimestamp" field from the "metadata" section, if it exists.
 // 2. Removes the "status" field if it exists and is an empty map.
 //
 // Parameters:
 //   - obj: A map[string]interface{} representing the Helm release object to sanitize.
 func sanitizeHelmRelease(obj map[string]interface{}) {
-	// Remove .metadata.creationTimestamp
-	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
-		delete(metadata, "creationTimestamp")
+	rules, err := activeSanitizeRules()
+	if err != nil {
+		// The flags are validated before any command runs.
+		rules = defaultSanitizeRules
 	}
+	applySanitizeRules(obj, rules)
+}
 
-	// Remove empty .status
-	if status, ok := obj["status"]; ok {
-		if m, isMap := status.(map[string]interface{}); isMap && len(m) == 0 {
-			delete(obj, "status")
-		}
-	}
+// imageMatch is a single reference to an image found in a values tree.
+//
+// Structured matches set Block (the map holding the repository and the tag)
+// and TagKey (the key of the tag within Block, usually "tag").
+// Aspire-style matches set Parent, Key and Value, where Parent[Key] is the
+// "image:tag" string.
+type imageMatch struct {
+	// Path is the dotted location of the match within .spec.values, e.g.
+	// "sidecar.image" for a structured block or "images.api" for an
+	// Aspire-style string. Items of a list share the path of the list.
+	Path string
+
+	Block  map[string]interface{}
+	TagKey string
+
+	Parent map[string]interface{}
+	Key    string
+	Value  string
 }
 
 // findImageBlocksUniversal searches through a nested map structure to find blocks
@@ -58,39 +249,243 @@ func sanitizeHelmRelease(obj map[string]interface{}) {
 //   - imageName: A string representing the image name to match.
 //
 // Returns:
-//   - A slice of map[string]interface{} containing the matched blocks. Each match
-//     can either be a structured block or a map containing the key, value, and
-//     parent path for Aspire-style matches.
+//   - A slice of imageMatch describing each match and its dotted path. Each match
+//     is either a structured block or the key, value, and parent map of an
+//     Aspire-style string.
 //
 // The function recursively traverses the input structure, handling both maps and
-// slices, and collects matches based on the specified criteria.
-func findImageBlocksUniversal(values map[string]interface{}, imageName string) []map[string]interface{} {
-	var matches []map[string]interface{}
+// slices, and collects matches in a stable (key-sorted) order.
+func findImageBlocksUniversal(values map[string]interface{}, imageName string) []imageMatch {
+	return findImageBlocks(values, imageName, nil)
+}
 
-	var walk func(interface{})
-	walk = func(node interface{}) {
+// findImageBlocks is findImageBlocksUniversal with an explicit list of
+// matchers (see imageMatcher); nil selects the default matcher profile.
+func findImageBlocks(values map[string]interface{}, imageName string, matchers []imageMatcher) []imageMatch {
+	matchers = matchersOrDefault(matchers)
+	var matches []imageMatch
+
+	var walk func(node interface{}, path string)
+	walk = func(node interface{}, path string) {
 		switch typed := node.(type) {
 
 		case map[string]interface{}:
-			// Match structured block
-			if repo, ok := typed["repository"].(string); ok && repo == imageName {
-				matches = append(matches, typed)
+			// Match structured blocks, at most once per tag key
+			matchedTags := map[string]bool{}
+			for _, m := range matchers {
+				if m.isBlock() && !matchedTags[m.TagKey] && m.blockImage(typed) == imageName {
+					matchedTags[m.TagKey] = true
+					matches = append(matches, imageMatch{Path: path, Block: typed, TagKey: m.TagKey})
+				}
 			}
 
 			// Check each key/value recursively
-			for key, val := range typed {
+			keys := make([]string, 0, len(typed))
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				val := typed[key]
 				// Also match Aspire-style string: "image:tag"
-				if strVal, ok := val.(string); ok && strings.HasPrefix(strVal, imageName+":") {
-					matches = append(matches, map[string]interface{}{
-						"key":   key,
-						"value": strVal,
-						"path":  typed, // parent map so we can update it later
+				if strVal, ok := val.(string); ok && strings.HasPrefix(strVal, imageName+":") && stringMatcherAccepts(matchers, key) {
+					matches = append(matches, imageMatch{
+						Path:   joinValuesPath(path, key),
+						Parent: typed, // parent map so we can update it later
+						Key:    key,
+						Value:  strVal,
 					})
 				} else {
-					walk(val)
+					walk(val, joinValuesPath(path, key))
 				}
 			}
 
+		case []interface{}:
+			for i, item := range typed {
+				walk(item, indexValuesPath(path, i))
+			}
+		}
+	}
+
+	walk(values, "")
+	return matches
+}
+
+// stringMatcherAccepts reports whether any string matcher in matchers applies
+// to a value stored under key.
+func stringMatcherAccepts(matchers []imageMatcher, key string) bool {
+	for _, m := range matchers {
+		if !m.isBlock() && m.acceptsKey(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinValuesPath appends key to a dotted values path.
+func joinValuesPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexValuesPath appends the index of a list item to a values path, as in
+// "containers[1]".
+func indexValuesPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// splitValuesPath splits a values path into its keys and list indexes, e.g.
+// "containers[1].image" into "containers", "[1]" and "image".
+func splitValuesPath(path string) []string {
+	var parts []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			open := strings.IndexByte(part, '[')
+			if open < 0 {
+				parts = append(parts, part)
+				break
+			}
+			if open > 0 {
+				parts = append(parts, part[:open])
+			}
+			end := strings.IndexByte(part[open:], ']')
+			if end < 0 {
+				parts = append(parts, part[open:])
+				break
+			}
+			parts = append(parts, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+	}
+	return parts
+}
+
+// listIndex returns the index of a "[i]" part of a values path.
+func listIndex(part string) (int, bool) {
+	if !strings.HasPrefix(part, "[") || !strings.HasSuffix(part, "]") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(part[1 : len(part)-1])
+	return i, err == nil && i >= 0
+}
+
+// valuesPathMatches reports whether the --path selector (in normalized form)
+// selects the values path. A selector may leave out list indexes, so
+// "containers.image" selects "containers[1].image" while "containers[0].image"
+// does not.
+func valuesPathMatches(selector, path string) bool {
+	want := splitValuesPath(selector)
+	i := 0
+	for _, part := range splitValuesPath(path) {
+		if i < len(want) && want[i] == part {
+			i++
+			continue
+		}
+		if _, ok := listIndex(part); ok {
+			continue
+		}
+		return false
+	}
+	return i == len(want)
+}
+
+// normalizeValuesPath turns a user-supplied --path selector into the dotted form
+// used by imageMatch.Path. It accepts plain dotted paths ("sidecar.image"),
+// JSONPath-style paths ("$.sidecar.image", ".sidecar.image") and paths rooted at
+// the HelmRelease (".spec.values.sidecar.image").
+func normalizeValuesPath(selector string) string {
+	p := strings.TrimSpace(selector)
+	p = strings.TrimPrefix(p, "$")
+	p = strings.TrimPrefix(p, ".")
+	p = strings.TrimPrefix(p, "spec.values.")
+	return p
+}
+
+// matchesPathSelectors reports whether m is selected by any of the given
+// --path selectors. With no selectors every match is selected. A structured
+// block is also selected by the path of its tag (e.g. "sidecar.image.tag").
+func matchesPathSelectors(m imageMatch, selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, selector := range selectors {
+		p := normalizeValuesPath(selector)
+		if valuesPathMatches(p, m.Path) || (m.Block != nil && valuesPathMatches(p, joinValuesPath(m.Path, m.TagKey))) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopedImageSeparator separates the image of an update key from the values
+// path the update is scoped to, as in --set 'repo@canary.image=2.0.0-rc.1'.
+const scopedImageSeparator = "@"
+
+// splitScopedImage splits an update key into its image and the values path
+// it is scoped to, which is empty for an update of every match.
+func splitScopedImage(key string) (image, scope string) {
+	image, scope, _ = strings.Cut(key, scopedImageSeparator)
+	return image, scope
+}
+
+// scopedPaths returns, per image, the values paths claimed by the
+// path-scoped keys of updates.
+func scopedPaths(updates map[string]string) map[string][]string {
+	scoped := map[string][]string{}
+	for key := range updates {
+		if image, scope := splitScopedImage(key); scope != "" {
+			scoped[image] = append(scoped[image], scope)
+		}
+	}
+	return scoped
+}
+
+// updateSelects reports whether the update with the given scope applies to
+// m: a path-scoped update only applies at its own path, regardless of
+// --path, while an update of the whole image applies at the paths selected
+// by selectors, except those claimed by a path-scoped update of the image.
+func updateSelects(m imageMatch, scope string, selectors, claimed []string) bool {
+	if scope != "" {
+		return matchesPathSelectors(m, []string{scope})
+	}
+	return matchesPathSelectors(m, selectors) && (len(claimed) == 0 || !matchesPathSelectors(m, claimed))
+}
+
+// collectImageRepositories returns the sorted, de-duplicated image repositories
+// referenced in a values tree: the "repository" of structured blocks that carry a
+// "tag", and the repository part of Aspire-style "image:tag" strings whose tag is
+// a valid semantic version. matchers selects the block and string shapes that
+// are recognised; nil selects the default matcher profile.
+func collectImageRepositories(values map[string]interface{}, matchers []imageMatcher) []string {
+	matchers = matchersOrDefault(matchers)
+	seen := map[string]bool{}
+
+	var walk func(interface{})
+	walk = func(node interface{}) {
+		switch typed := node.(type) {
+		case map[string]interface{}:
+			for _, m := range matchers {
+				if !m.isBlock() {
+					continue
+				}
+				if repo := m.blockImage(typed); repo != "" {
+					if _, hasTag := typed[m.TagKey]; hasTag {
+						seen[repo] = true
+					}
+				}
+			}
+			for key, val := range typed {
+				if strVal, ok := val.(string); ok {
+					if i := strings.LastIndex(strVal, ":"); i > 0 && isValidSemver(strVal[i+1:]) && stringMatcherAccepts(matchers, key) {
+						seen[strVal[:i]] = true
+					}
+					continue
+				}
+				walk(val)
+			}
 		case []interface{}:
 			for _, item := range typed {
 				walk(item)
@@ -99,12 +494,18 @@ func findImageBlocksUniversal(values map[string]interface{}, imageName string) [
 	}
 
 	walk(values)
-	return matches
+
+	repos := make([]string, 0, len(seen))
+	for repo := range seen {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
 }
 
 // BumpTagInValuesUniversal updates the version tag of a specified image in a given values map.
 // It supports two types of image blocks: structured blocks with "repository" and "tag" fields,
-// and Aspire-style string entries with "key", "value", and "path" fields.
+// and Aspire-style "image:tag" string entries.
 //
 // Parameters:
 //   - values: A map representing the values file where image blocks are defined.
@@ -119,7 +520,7 @@ func findImageBlocksUniversal(values map[string]interface{}, imageName string) [
 // Behavior:
 //   - If no matching image blocks are found, the function logs a warning and returns false.
 //   - For structured image blocks, it checks if the "repository" matches the imageName and updates the "tag".
-//   - For Aspire-style entries, it checks if the "value" starts with the imageName and updates the tag in the "path".
+//   - For Aspire-style entries, it checks if the string starts with the imageName and rewrites it in its parent map.
 //   - If the newVersion is not a valid semantic version, the function skips the update and logs a warning.
 //   - In dry-run mode, the function logs the intended changes without modifying the values map.
 //
@@ -130,81 +531,325 @@ func findImageBlocksUniversal(values map[string]interface{}, imageName string) [
 //	    log.Fatalf("Error updating image tag: %v", err)
 //	}
 //	if updated {
-//	    fmt.Println("Image tags updated successfully.")
+//	    logln("Image tags updated successfully.")
 //	} else {
-//	    fmt.Println("No updates were necessary.")
+//	    logln("No updates were necessary.")
+//	}
 func BumpTagInValuesUniversal(values map[string]interface{}, imageName, newVersion string, dryRun bool) (bool, error) {
-	matches := findImageBlocksUniversal(values, imageName)
+	changes, err := bumpTagInValues(values, imageName, newVersion, bumpOptions{DryRun: dryRun})
+	return len(changes) > 0, err
+}
+
+// tagChange records a single image reference update within a values tree.
+type tagChange struct {
+	Image string `json:"image"`
+	// Path is the dotted values path of the changed scalar: the "tag" of a
+	// structured block (e.g. "sidecar.image.tag") or the key of an Aspire-style
+	// string (e.g. "images.api").
+	Path     string `json:"path"`
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+// bumpOptions controls how image tags are bumped.
+type bumpOptions struct {
+	// DryRun logs intended changes without modifying the values.
+	DryRun bool
+	// Paths restricts updates to matches at these values paths (see
+	// matchesPathSelectors). Empty means every match is updated.
+	Paths []string
+	// RegexUpdates maps regular expressions over image repositories to the
+	// version to apply, in addition to the explicit updates (see
+	// resolveImageUpdates).
+	RegexUpdates map[string]string
+	// Schema, if set, is validated against the updated values before they
+	// are written (see checkValuesSchema).
+	Schema *valuesSchema
+	// Force writes values that violate Schema, with a warning.
+	Force bool
+	// Matchers are the image reference shapes to recognise (see
+	// imageMatcher). Empty selects the default matcher profile.
+	Matchers []imageMatcher
+	// Select, if set, is asked about every change before it is made; changes
+	// it rejects are skipped (see --interactive).
+	Select func(change tagChange) bool
+	// VerifyRender, if set, renders its chart with the old and new values and
+	// rejects bumps that change more than image references (see checkRender).
+	VerifyRender *renderVerifier
+	// Annotate, if set, appends a provenance comment to every changed line
+	// (see --annotate).
+	Annotate *changeAnnotator
+	// Provenance, if set, records the bump in the annotations of the
+	// HelmRelease (see --annotate-metadata).
+	Provenance *provenanceAnnotator
+	// PostRenderers, if set, is searched for image references along with the
+	// values (see postRendererView).
+	PostRenderers *postRendererView
+	// Ignore, if set, holds the references pinned with a flux-helpers:ignore
+	// comment, which are never changed (see findIgnoreMarkers).
+	Ignore *ignoreMarkers
+	// Anchors, if set, maps the values paths of scalars shared through YAML
+	// aliases to their anchor path, where a change to them is reported once
+	// (see findValueAnchors).
+	Anchors *valueAnchors
+	// ImagePolicies, if set, holds the references carrying an $imagepolicy
+	// marker, which are left to the image-automation-controller unless
+	// --image-policy-markers is update (see findImagePolicyMarkers).
+	ImagePolicies *imagePolicyMarkers
+	// Policy, if set, is checked against the changes to each file before it
+	// is written (see bumpPolicy).
+	Policy *bumpPolicy
+	// Registry, if set, must confirm that every new tag exists before a file
+	// is written (see --check-exists).
+	Registry *registryClient
+	// Skips, if set, records the matches that are not bumped and why (see
+	// skippedMatch).
+	Skips *skipLog
+	// Selector, if set, must match the labels or annotations of a
+	// HelmRelease for it to be bumped (see --selector).
+	Selector labels.Selector
+	// TargetName and TargetNamespace, if set, are globs the name and
+	// namespace of a HelmRelease must match for it to be bumped (see
+	// --target-name and --target-namespace).
+	TargetName      string
+	TargetNamespace string
+	// TagFormat validates new tags, and TagFormats overrides it per image
+	// repository (see --tag-format). The zero value is the semver profile.
+	TagFormat  tagFormat
+	TagFormats map[string]tagFormat
+	// Affixes selects the parts of the current tags that are carried over to
+	// the new ones (see tagAffixes).
+	Affixes tagAffixes
+	// CreatePaths maps image repositories to the values path at which a
+	// repository/tag block is created when the values do not reference the
+	// image yet (see --create-values-path).
+	CreatePaths map[string]string
+
+	// scope and claimed are set by applyImageUpdates for each update: the
+	// values path of a path-scoped update, or the paths claimed by the
+	// path-scoped updates of the same image (see updateSelects).
+	scope   string
+	claimed []string
+}
+
+// blockTagError describes the tag of the image block m, which is missing or
+// not a string, as a valuesPathError at the tag (or, when it is missing, at
+// the block).
+func blockTagError(imageName string, m imageMatch) error {
+	tag, ok := m.Block[m.TagKey]
+	if !ok || tag == nil {
+		return &valuesPathError{Path: m.Path, Err: fmt.Errorf("image block for %s at %s has no %s", imageName, dashIfEmpty(m.Path), m.TagKey)}
+	}
+	var problem string
+	switch tag.(type) {
+	case float64, bool:
+		problem = fmt.Sprintf("is %v, not a string; quote it", tag)
+	default:
+		problem = fmt.Sprintf("is a %s, not a string", reflect.TypeOf(tag).Kind())
+	}
+	return &valuesPathError{Path: joinValuesPath(m.Path, m.TagKey), Err: fmt.Errorf("%s of %s at %s %s", m.TagKey, imageName, dashIfEmpty(m.Path), problem)}
+}
+
+// bumpTagInValues is BumpTagInValuesUniversal with the full set of bumpOptions.
+// It returns one tagChange per value that was (or, in dry-run mode, would be)
+// changed. A value shared through YAML aliases (see opts.Anchors) is one
+// value: its uses are checked and reported once, at the anchor path, and the
+// others only follow the new value.
+func bumpTagInValues(values map[string]interface{}, imageName, newVersion string, opts bumpOptions) ([]tagChange, error) {
+	matches := findImageBlocks(values, imageName, opts.Matchers)
+	if opts.PostRenderers != nil {
+		matches = append(matches, opts.PostRenderers.findImages(imageName, opts.Matchers)...)
+	}
 	if len(matches) == 0 {
-		fmt.Printf("⚠️ No image block found for %s\n", imageName)
-		return false, nil
+		if path, ok := opts.CreatePaths[imageName]; ok && opts.scope == "" {
+			return createImageBlock(values, imageName, newVersion, path, opts)
+		}
+		logf("⚠️ No image block found for %s\n", imageName)
+		opts.Skips.record(skippedMatch{Image: imageName, Wanted: newVersion, Reason: skipNoMatch})
+		return nil, nil
+	}
+
+	if len(opts.claimed) > 0 {
+		unclaimed := matches[:0:0]
+		for _, m := range matches {
+			if !matchesPathSelectors(m, opts.claimed) {
+				unclaimed = append(unclaimed, m)
+			}
+		}
+		if len(unclaimed) == 0 {
+			// Every match is bumped by a path-scoped update instead.
+			return nil, nil
+		}
+		matches = unclaimed
+	}
+
+	selected := matches[:0:0]
+	for _, m := range matches {
+		if updateSelects(m, opts.scope, opts.Paths, nil) {
+			selected = append(selected, m)
+		}
+	}
+	if len(selected) == 0 {
+		if opts.scope != "" {
+			logf("⚠️ No image block for %s at %s\n", imageName, opts.scope)
+		} else {
+			logf("⚠️ No image block for %s matches --path %s\n", imageName, strings.Join(opts.Paths, ", "))
+		}
+		for _, m := range matches {
+			opts.Skips.record(skippedMatch{Image: imageName, Path: m.valuePath(), Current: m.currentValue(), Wanted: newVersion, Reason: skipPathFilter})
+		}
+		return nil, nil
+	}
+	unpinned := selected[:0:0]
+	for _, m := range selected {
+		if opts.Ignore.ignores(m) {
+			logf("📌 %s at %s is pinned with %s, skipping\n", imageName, m.Path, ignoreMarker)
+			opts.Skips.record(skippedMatch{Image: imageName, Path: m.valuePath(), Current: m.currentValue(), Wanted: newVersion, Reason: skipPinned})
+			continue
+		}
+		if policy := opts.ImagePolicies.policy(m); policy != "" {
+			if imagePolicyMode != imagePolicyUpdate {
+				logf("🤖 %s at %s is managed by the image-automation-controller (image policy %s), skipping; pass --image-policy-markers=update to bump it anyway\n", imageName, m.Path, policy)
+				opts.Skips.record(skippedMatch{Image: imageName, Path: m.valuePath(), Current: m.currentValue(), Wanted: newVersion, Reason: skipImagePolicy})
+				continue
+			}
+			logf("⚠️ %s at %s is managed by the image-automation-controller (image policy %s), which reverts this bump unless the policy selects it\n", imageName, m.Path, policy)
+		}
+		unpinned = append(unpinned, m)
+	}
+	selected = unpinned
+
+	// A block matched by several matchers only needs one of their tag keys.
+	tagged := map[uintptr]bool{}
+	for _, m := range selected {
+		if _, ok := m.Block[m.TagKey].(string); m.Block != nil && ok {
+			tagged[reflect.ValueOf(m.Block).Pointer()] = true
+		}
 	}
 
-	updated := false
+	var changes []tagChange
+	// shared holds the anchor paths handled so far and the value written
+	// there, if any.
+	shared := map[string]string{}
 
-	for _, image := range matches {
+	for _, image := range selected {
 		// Case 1: Structured image block (repository + tag)
-		if repo, ok := image["repository"].(string); ok && repo == imageName {
-			oldTag, _ := image["tag"].(string)
+		if image.Block != nil {
+			repo := imageName
+			oldTag, ok := image.Block[image.TagKey].(string)
+			if !ok {
+				if tagged[reflect.ValueOf(image.Block).Pointer()] {
+					continue
+				}
+				return nil, blockTagError(imageName, image)
+			}
+			path := opts.Anchors.resolve(joinValuesPath(image.Path, image.TagKey))
+			if newTag, ok := shared[path]; ok {
+				if newTag != "" {
+					image.Block[image.TagKey] = newTag
+				}
+				continue
+			}
+			shared[path] = ""
 
-			if oldTag == newVersion {
-				fmt.Printf("✅ %s already at %s, skipping\n", repo, newVersion)
+			newTag := opts.Affixes.apply(oldTag, newVersion)
+			skipped := skippedMatch{Image: imageName, Path: image.valuePath(), Current: oldTag, Wanted: newTag}
+			if oldTag == newTag {
+				logf("✅ %s already at %s, skipping\n", repo, newTag)
+				opts.Skips.record(skipped.because(skipUpToDate))
 				continue
 			}
-			if !isValidSemver(newVersion) {
-				fmt.Printf("⚠️ Invalid version: %s (skipping %s)\n", newVersion, repo)
+			if format := opts.tagFormatFor(imageName); !format.valid(newTag) {
+				logf("⚠️ Invalid version: %s is not a %s tag (skipping %s)\n", newTag, format, repo)
+				opts.Skips.record(skipped.because(skipInvalidVersion))
+				continue
+			}
+			change := tagChange{
+				Image:    imageName,
+				Path:     path,
+				OldValue: oldTag,
+				NewValue: newTag,
+			}
+			if opts.Select != nil && !opts.Select(change) {
+				logf("⏭️ Skipped %s at %s\n", repo, change.Path)
+				opts.Skips.record(skipped.because(skipDeselected))
 				continue
 			}
 
-			if dryRun {
-				fmt.Printf("[dry-run] Would bump %s:%s → %s\n", repo, oldTag, newVersion)
+			if opts.DryRun {
+				logf("[dry-run] Would bump %s:%s → %s\n", repo, oldTag, newTag)
 			} else {
-				image["tag"] = newVersion
-				fmt.Printf("🔁 Bumped %s:%s → %s\n", repo, oldTag, newVersion)
+				image.Block[image.TagKey] = newTag
+				shared[path] = newTag
+				logf("🔁 Bumped %s:%s → %s\n", repo, oldTag, newTag)
 			}
-			updated = true
+			changes = append(changes, change)
 			continue
 		}
 
 		// Case 2: Aspire-style string entry
-		key, kOk := image["key"].(string)
-		val, vOk := image["value"].(string)
-		path, pOk := image["path"].(map[string]interface{})
+		if image.Parent != nil && strings.HasPrefix(image.Value, imageName+":") {
+			path := opts.Anchors.resolve(image.Path)
+			if newImage, ok := shared[path]; ok {
+				if newImage != "" {
+					image.Parent[image.Key] = newImage
+				}
+				continue
+			}
+			shared[path] = ""
 
-		if kOk && vOk && pOk && strings.HasPrefix(val, imageName+":") {
+			val := image.Value
 			parts := strings.Split(val, ":")
 			oldTag := parts[len(parts)-1]
-			if oldTag == newVersion {
-				fmt.Printf("✅ %s already at %s, skipping\n", imageName, newVersion)
+			newTag := opts.Affixes.apply(oldTag, newVersion)
+			skipped := skippedMatch{Image: imageName, Path: image.Path, Current: val, Wanted: newTag}
+			if oldTag == newTag {
+				logf("✅ %s already at %s, skipping\n", imageName, newTag)
+				opts.Skips.record(skipped.because(skipUpToDate))
 				continue
 			}
-			if !isValidSemver(newVersion) {
-				fmt.Printf("⚠️ Invalid version: %s (skipping %s)\n", newVersion, imageName)
+			if format := opts.tagFormatFor(imageName); !format.valid(newTag) {
+				logf("⚠️ Invalid version: %s is not a %s tag (skipping %s)\n", newTag, format, imageName)
+				opts.Skips.record(skipped.because(skipInvalidVersion))
 				continue
 			}
 
-			newImage := fmt.Sprintf("%s:%s", imageName, newVersion)
+			newImage := fmt.Sprintf("%s:%s", imageName, newTag)
+			change := tagChange{
+				Image:    imageName,
+				Path:     path,
+				OldValue: val,
+				NewValue: newImage,
+			}
+			if opts.Select != nil && !opts.Select(change) {
+				logf("⏭️ Skipped %s at %s\n", imageName, change.Path)
+				opts.Skips.record(skipped.because(skipDeselected))
+				continue
+			}
 
-			if dryRun {
-				fmt.Printf("[dry-run] Would bump %s → %s\n", val, newImage)
+			if opts.DryRun {
+				logf("[dry-run] Would bump %s → %s\n", val, newImage)
 			} else {
-				path[key] = newImage
-				fmt.Printf("🔁 Bumped %s → %s\n", val, newImage)
+				image.Parent[image.Key] = newImage
+				shared[path] = newImage
+				logf("🔁 Bumped %s → %s\n", val, newImage)
 			}
-			updated = true
+			changes = append(changes, change)
 		}
 	}
 
-	return updated, nil
+	return changes, nil
 }
 
 // BumpMultipleTagsUniversalAndSanitize updates the image tags in a HelmRelease YAML file
 // based on the provided updates map, optionally performing a dry-run.
 //
-// This function reads a HelmRelease YAML file, parses its .spec.values field, and updates
+// This function reads a HelmRelease YAML file (helm.toolkit.fluxcd.io v2beta1, v2beta2
+// or v2), parses its .spec.values field, and updates
 // the image tags specified in the `updates` map. It supports a dry-run mode to preview
-// changes without modifying the file. After updating, the function sanitizes the HelmRelease
-// before writing it back to the file.
+// changes without modifying the file. Only the changed tags are rewritten in the
+// file (see writeHelmRelease); when that is not possible the HelmRelease is
+// re-encoded and sanitized before writing it back to the file.
 //
 // Parameters:
 //   - filePath: The path to the HelmRelease YAML file to be updated.
@@ -215,13 +860,14 @@ func BumpTagInValuesUniversal(values map[string]interface{}, imageName, newVersi
 //   - error: An error if any issues occur during file reading, parsing, updating, or writing.
 //
 // Behavior:
-//   - Reads the HelmRelease YAML file specified by `filePath`.
+//   - Reads the HelmRelease YAML file specified by `filePath` and decodes it with the
+//     API types matching its apiVersion.
 //   - Parses the .spec.values field into a generic map.
 //   - Iterates over the `updates` map to update image tags using the BumpTagInValuesUniversal function.
 //   - If dryRun is true, prints the number of potential updates and exits without modifying the file.
-//   - If updates are made, marshals the updated values back into the HelmRelease structure.
-//   - Sanitizes the HelmRelease to ensure compatibility and correctness.
-//   - Writes the updated and sanitized YAML back to the original file.
+//   - If updates are made, rewrites the changed scalars in place, or marshals the
+//     updated values back into the HelmRelease structure and sanitizes it.
+//   - Writes the updated YAML back to the original file.
 //
 // Example Usage:
 //
@@ -234,69 +880,675 @@ func BumpTagInValuesUniversal(values map[string]interface{}, imageName, newVersi
 //	    log.Fatalf("Error updating tags: %v", err)
 //	}
 func BumpMultipleTagsUniversalAndSanitize(filePath string, updates map[string]string, dryRun bool) error {
-	data, err := os.ReadFile(filePath)
+	_, err := bumpHelmReleaseFile(filePath, updates, bumpOptions{DryRun: dryRun})
+	return err
+}
+
+// bumpHelmReleaseFile is BumpMultipleTagsUniversalAndSanitize with the full set
+// of bumpOptions. It returns the bumpResult describing what was changed.
+//
+// Unless running in dry-run mode, the file is read and rewritten while holding
+// its advisory lock, and the new content replaces it atomically. When filePath
+// is stdioFile, the manifest is read from stdin and, unless running in dry-run
+// mode, written to stdout whether or not anything changed. SOPS-encrypted
+// files are refused, or with sopsMode decrypted and updated with `sops set`
+// (see readBumpTarget).
+func bumpHelmReleaseFile(filePath string, updates map[string]string, opts bumpOptions) (*bumpResult, error) {
+	if !opts.DryRun && filePath != stdioFile {
+		unlock, err := acquireFileLock(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, encrypted, err := readBumpTarget(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return nil, err
 	}
 
-	var hr helmv2.HelmRelease
-	if err := yaml.Unmarshal(data, &hr); err != nil {
-		return fmt.Errorf("failed to unmarshal HelmRelease: %w", err)
+	result, err := bumpHelmReleaseData(data, updates, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Policy.check(filePath, result.Changes); err != nil {
+		return nil, err
+	}
+	if err := opts.Registry.checkChangesExist(filePath, result.Changes); err != nil {
+		return nil, err
 	}
 
-	var values map[string]interface{}
-	if err := json.Unmarshal(hr.Spec.Values.Raw, &values); err != nil {
-		return fmt.Errorf("failed to parse .spec.values: %w", err)
+	if opts.DryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", result.Updated)
+		return result, nil
 	}
 
-	updatedCount := 0
-	for imageName, newVersion := range updates {
-		updated, err := BumpTagInValuesUniversal(values, imageName, newVersion, dryRun)
+	if filePath == stdioFile {
+		out := data
+		if result.Updated > 0 {
+			out = detectTextFormat(data).apply(result.Output)
+		}
+		if _, err := manifestOut.Write(out); err != nil {
+			return nil, fmt.Errorf("failed to write to stdout: %w", err)
+		}
+		logf("✅ Updated %d image(s) from stdin\n", result.Updated)
+		return result, nil
+	}
+
+	if result.Updated == 0 {
+		logln("ℹ️ No image tags were updated.")
+		return result, nil
+	}
+
+	if encrypted {
+		if err := writeSOPSChanges(filePath, data, result.Changes); err != nil {
+			return nil, fmt.Errorf("failed to write updated file: %w", err)
+		}
+		logf("🔐 Re-encrypted %s with sops\n", filePath)
+	} else if err := writeFileWithBackup(filePath, result.Output, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+
+	logf("✅ Updated %d image(s) in %s\n", result.Updated, filePath)
+	return result, nil
+}
+
+// bumpResult summarizes the outcome of bumping a single manifest.
+type bumpResult struct {
+	// Output is the updated manifest, or nil in dry-run mode or when nothing changed.
+	Output []byte
+	// Updated is the number of images that were (or would be) updated.
+	Updated int
+	// Changes lists every individual value change, in a stable order.
+	Changes []tagChange
+	// Pinned is set when the HelmRelease carries the ignoreAnnotation and was
+	// left alone.
+	Pinned bool
+	// Unselected is set when the HelmRelease does not match opts.Selector and
+	// was left alone.
+	Unselected bool
+	// Skipped lists the requested images that were not bumped, per match.
+	Skipped []skippedMatch
+}
+
+// bumpHelmReleaseData applies image tag updates to the raw bytes of a HelmRelease
+// manifest. It is the in-memory core of BumpMultipleTagsUniversalAndSanitize.
+//
+// Images are processed in sorted order so that the resulting changes are stable.
+// Manifests of another kind are handed to the bump plugin for that kind (see
+// runBumpPlugin).
+//
+// Returns:
+//   - A bumpResult holding the updated YAML, see writeHelmRelease (nil when running in
+//     dry-run mode or when no image was updated), the number of images that were
+//     (or, in dry-run mode, would be) updated, and the individual changes.
+//   - An error if the manifest cannot be parsed or re-encoded, if the
+//     updated values violate opts.Schema, or if they change more than image
+//     references in the chart rendered by opts.VerifyRender.
+func bumpHelmReleaseData(data []byte, updates map[string]string, opts bumpOptions) (*bumpResult, error) {
+	if kind := manifestKind(data); kind != "HelmRelease" && kind != "" {
+		if !pluginKindPattern.MatchString(kind) {
+			return nil, fmt.Errorf("unexpected kind %q (expected HelmRelease)", kind)
+		}
+		if plugin := lookupBumpPlugin(kind); plugin != "" {
+			return runBumpPlugin(plugin, data, updates, opts)
+		}
+		return nil, fmt.Errorf("unexpected kind %q (expected HelmRelease, or a %s plugin on PATH)", kind, bumpPluginName(kind))
+	}
+	skips := &skipLog{}
+	opts.Skips = skips
+	if helmReleaseIgnored(data) {
+		logf("📌 HelmRelease is pinned with the %s annotation, skipping\n", ignoreAnnotation)
+		for _, image := range sortedKeys(updates) {
+			skips.record(skippedMatch{Image: image, Wanted: updates[image], Reason: skipPinned})
+		}
+		return &bumpResult{Pinned: true, Skipped: skips.list()}, nil
+	}
+	if reason := opts.unselectedReason(helmReleaseMetadata(data)); reason != "" {
+		logf("⏭️ HelmRelease %s, skipping\n", reason)
+		for _, image := range sortedKeys(updates) {
+			skips.record(skippedMatch{Image: image, Wanted: updates[image], Reason: skipUnselected})
+		}
+		return &bumpResult{Unselected: true, Skipped: skips.list()}, nil
+	}
+
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := helmReleaseValues(hr)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil && len(opts.CreatePaths) > 0 {
+		values = map[string]interface{}{}
+	}
+	if opts.PostRenderers, err = newPostRendererView(hr); err != nil {
+		return nil, err
+	}
+	opts.Ignore = findIgnoreMarkers(data, values)
+	opts.Anchors = findValueAnchors(data, helmReleaseValuesNode)
+	opts.ImagePolicies = findImagePolicyMarkers(data, values, helmReleaseValuesNode)
+
+	result := &bumpResult{}
+	result.Updated, result.Changes, err = applyImageUpdates(values, updates, opts)
+	if err != nil {
+		return nil, locateValuesError(data, err, helmReleaseValuesNode)
+	}
+	result.Skipped = skips.list()
+	if result.Updated > 0 && opts.VerifyRender != nil {
+		if err := verifyBumpRender(hr, result.Changes, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.DryRun || result.Updated == 0 {
+		return result, nil
+	}
+	if err := checkValuesSchema(values, opts); err != nil {
+		return nil, err
+	}
+	if opts.PostRenderers != nil {
+		if err := opts.PostRenderers.sync(hr); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Output, err = writeHelmRelease(data, hr, values)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Annotate != nil && isJSONManifest(data) {
+		logf("⚠️ JSON manifests cannot hold comments, not annotating the changes\n")
+	} else if opts.Annotate != nil {
+		if result.Output, err = annotateManifest(result.Output, result.Changes, opts.Annotate); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Provenance != nil {
+		if result.Output, err = opts.Provenance.annotate(result.Output, result.Changes); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// applyImageUpdates bumps every image in updates (after resolving glob and
+// regex patterns with resolveImageUpdates) within a values tree, in sorted
+// image order.
+//
+// Returns the number of images updated and the individual changes.
+func applyImageUpdates(values map[string]interface{}, updates map[string]string, opts bumpOptions) (int, []tagChange, error) {
+	repositories := func() []string { return collectImageRepositories(values, opts.Matchers) }
+	if v := opts.PostRenderers; v != nil {
+		repositories = func() []string {
+			return append(collectImageRepositories(values, opts.Matchers), v.repositories(opts.Matchers)...)
+		}
+	}
+	resolved, err := resolveImagePatterns(updates, opts.RegexUpdates, repositories)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	updated := 0
+	var all []tagChange
+	claimed := scopedPaths(resolved)
+	for _, key := range sortedKeys(resolved) {
+		imageName, scope := splitScopedImage(key)
+		keyOpts := opts
+		keyOpts.scope = scope
+		if scope == "" {
+			keyOpts.claimed = claimed[imageName]
+		}
+		changes, err := bumpTagInValues(values, imageName, resolved[key], keyOpts)
 		if err != nil {
-			return fmt.Errorf("error updating image %s: %w", imageName, err)
+			return 0, nil, fmt.Errorf("error updating image %s: %w", key, err)
 		}
-		if updated {
-			updatedCount++
+		if len(changes) > 0 {
+			updated++
+			all = append(all, changes...)
 		}
 	}
+	return updated, all, nil
+}
 
-	if dryRun {
-		fmt.Printf("🧪 Dry-run complete. %d potential updates found.\n", updatedCount)
-		return nil
+// isImageGlob reports whether an image name given to --set is a glob pattern.
+// The values path of a path-scoped key (see splitScopedImage) is ignored.
+func isImageGlob(imageName string) bool {
+	image, _ := splitScopedImage(imageName)
+	return strings.ContainsAny(image, "*?[")
+}
+
+// resolveImageUpdates expands glob patterns in updates (e.g. "ghcr.io/my-org/*",
+// matched with path.Match so "*" does not cross "/") and the regular
+// expressions in regexUpdates (matched against the whole repository name)
+// into concrete repositories found in values.
+//
+// Explicit repositories take precedence over patterns, and glob patterns over
+// regular expressions. A pattern that matches no repository is reported with a
+// warning.
+//
+// Returns:
+//   - A map of concrete image names to versions.
+//   - An error if a glob or regular expression is malformed.
+func resolveImageUpdates(values map[string]interface{}, updates, regexUpdates map[string]string, matchers []imageMatcher) (map[string]string, error) {
+	return resolveImagePatterns(updates, regexUpdates, func() []string { return collectImageRepositories(values, matchers) })
+}
+
+// resolveImagePatterns is resolveImageUpdates over the repositories returned
+// by repositories, which is only called when there are patterns to resolve.
+func resolveImagePatterns(updates, regexUpdates map[string]string, repositories func() []string) (map[string]string, error) {
+	resolved := map[string]string{}
+	hasPatterns := len(regexUpdates) > 0
+	for key, version := range updates {
+		if isImageGlob(key) {
+			hasPatterns = true
+			continue
+		}
+		resolved[key] = version
+	}
+	if !hasPatterns {
+		return resolved, nil
 	}
 
-	if updatedCount == 0 {
-		fmt.Println("ℹ️ No image tags were updated.")
-		return nil
+	repos := repositories()
+
+	for _, key := range sortedKeys(updates) {
+		if !isImageGlob(key) {
+			continue
+		}
+		pattern, scope := splitScopedImage(key)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid image pattern %q: %w", pattern, err)
+		}
+		matched := false
+		for _, repo := range repos {
+			if ok, _ := path.Match(pattern, repo); ok {
+				matched = true
+				if scope != "" {
+					repo += scopedImageSeparator + scope
+				}
+				if _, exists := resolved[repo]; !exists {
+					resolved[repo] = updates[key]
+				}
+			}
+		}
+		if !matched {
+			logf("⚠️ No image matches pattern %s\n", pattern)
+		}
+	}
+
+	for _, expr := range sortedKeys(regexUpdates) {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid image regex %q: %w", expr, err)
+		}
+		matched := false
+		for _, repo := range repos {
+			if re.MatchString(repo) {
+				matched = true
+				if _, exists := resolved[repo]; !exists {
+					resolved[repo] = regexUpdates[expr]
+				}
+			}
+		}
+		if !matched {
+			logf("⚠️ No image matches regex %s\n", expr)
+		}
+	}
+
+	return resolved, nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// helmReleaseValues parses the .spec.values of hr. It returns nil if the
+// HelmRelease has no values, or empty ones (null or a blank string). Values
+// written as a YAML block scalar (values: |) are parsed from the string, and
+// are written back as a mapping if they are changed.
+func helmReleaseValues(hr *helmReleaseManifest) (map[string]interface{}, error) {
+	raw := hr.Values()
+	if raw == nil || len(raw.Raw) == 0 {
+		return nil, nil
+	}
+	var parsed interface{}
+	if err := json.Unmarshal(raw.Raw, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse .spec.values: %w", err)
+	}
+	switch v := parsed.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal([]byte(v), &values); err != nil {
+			return nil, fmt.Errorf("failed to parse .spec.values block scalar: %w", err)
+		}
+		if values == nil {
+			return nil, fmt.Errorf(".spec.values block scalar does not hold a mapping")
+		}
+		return values, nil
 	}
+	return nil, fmt.Errorf(".spec.values must be a mapping, not a %T", parsed)
+}
+
+// rewriteHelmReleaseValues decodes a HelmRelease manifest, passes its parsed
+// .spec.values and a view of its .spec.postRenderers (nil when it has none)
+// to edit and returns the manifest with the edits written by writeHelmRelease.
+func rewriteHelmReleaseValues(data []byte, edit func(values map[string]interface{}, postRenderers *postRendererView) error) ([]byte, error) {
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := helmReleaseValues(hr)
+	if err != nil {
+		return nil, err
+	}
+	postRenderers, err := newPostRendererView(hr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := edit(values, postRenderers); err != nil {
+		return nil, err
+	}
+	if postRenderers != nil {
+		if err := postRenderers.sync(hr); err != nil {
+			return nil, err
+		}
+	}
+	return writeHelmRelease(data, hr, values)
+}
 
+// encodeHelmRelease stores values as the .spec.values of hr, marshals the
+// HelmRelease to YAML and sanitizes the result with sanitizeHelmRelease.
+//
+// The manifest is written from its unstructured document: only the fields
+// flux-helpers edits (.spec.values, .spec.postRenderers and the
+// .spec.chart.spec fields of ChartSpec) are taken from hr, so every other
+// field is written back as it was read, whether the API types know it or not.
+func encodeHelmRelease(hr *helmReleaseManifest, values map[string]interface{}) ([]byte, error) {
+	spec, ok := hr.document["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		hr.document["spec"] = spec
+	}
 	// Update .spec.values
-	raw, _ := json.Marshal(values)
-	hr.Spec.Values = &apiextv1.JSON{Raw: raw}
+	if values != nil {
+		raw, _ := json.Marshal(values)
+		hr.SetValues(&apiextv1.JSON{Raw: raw})
+		spec["values"] = values
+	}
+	if ref := hr.ChartSpec(); ref != nil {
+		chart, _ := spec["chart"].(map[string]interface{})
+		chartSpec, _ := chart["spec"].(map[string]interface{})
+		sourceRef, _ := chartSpec["sourceRef"].(map[string]interface{})
+		if sourceRef != nil {
+			setOptionalField(chartSpec, "chart", *ref.Chart)
+			setOptionalField(chartSpec, "version", *ref.Version)
+			setOptionalField(sourceRef, "kind", *ref.SourceKind)
+			setOptionalField(sourceRef, "name", *ref.SourceName)
+			setOptionalField(sourceRef, "namespace", *ref.SourceNamespace)
+		}
+	}
+
+	sanitizeHelmRelease(hr.document)
 
-	// Marshal to YAML, then sanitize before final write
-	yamlBytes, err := yaml.Marshal(&hr)
+	newYAML, err := yaml.Marshal(hr.document)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated HelmRelease: %w", err)
+		return nil, fmt.Errorf("failed to marshal updated HelmRelease: %w", err)
 	}
+	return newYAML, nil
+}
 
-	// Re-unmarshal to generic map to sanitize
-	var hrMap map[string]interface{}
-	if err := yaml.Unmarshal(yamlBytes, &hrMap); err != nil {
-		return fmt.Errorf("failed to unmarshal for sanitization: %w", err)
+// setOptionalField sets obj[key] to value, or removes the key when value is
+// empty, as the omitempty fields of the API types are written.
+func setOptionalField(obj map[string]interface{}, key, value string) {
+	if value == "" {
+		delete(obj, key)
+		return
 	}
+	obj[key] = value
+}
 
-	sanitizeHelmRelease(hrMap)
+// runBumpSets applies each update set to its files in order and collects a
+// report of every change. Globs in Files are expanded with expandFileGlobs.
+// With followValuesFrom, the ConfigMaps and Secrets referenced by each
+// HelmRelease's .spec.valuesFrom are bumped as well.
+//
+// The files of a set are bumped by up to bumpConcurrency workers. The report
+// lists them in file order regardless; once a file fails, files after it
+// that have not started yet are skipped and the first failure in file order
+// is returned, as in a sequential run.
+func runBumpSets(sets []updateSet, dryRun, followValuesFrom bool) (*bumpReport, error) {
+	report := &bumpReport{DryRun: dryRun}
 
-	newYAML, err := yaml.Marshal(&hrMap)
+	for _, set := range sets {
+		files, err := expandFileGlobs(set.Files)
+		if err != nil {
+			return report, err
+		}
+
+		opts := set.options(dryRun)
+		if set.ValuesSchema != "" {
+			if opts.Schema, err = loadValuesSchema(set.ValuesSchema); err != nil {
+				return report, err
+			}
+		}
+		if set.VerifyRender != "" {
+			if opts.VerifyRender, err = loadRenderVerifier(set.VerifyRender, set.VerifyRenderWarn); err != nil {
+				return report, err
+			}
+		}
+
+		type fileOutcome struct {
+			reports []fileReport
+			err     error
+		}
+		outcomes := make([]fileOutcome, len(files))
+		// firstFailed is the lowest index of a failed file; files after it
+		// are skipped, the ones before it still run as they would in order.
+		var firstFailed atomic.Int64
+		firstFailed.Store(int64(len(files)))
+		out := logOut
+		if bumpConcurrency > 1 && len(files) > 1 {
+			logOut = &lockedWriter{w: out}
+		}
+		bar := startProgress("bump", "file", len(files))
+		forEachConcurrently(len(files), bumpConcurrency, func(i int) {
+			defer bar.Increment()
+			if int64(i) > firstFailed.Load() {
+				return
+			}
+			file := &outcomes[i]
+			file.reports, file.err = bumpFileWithReferences(files[i], set.Images, opts, followValuesFrom)
+			if file.err != nil {
+				for {
+					at := firstFailed.Load()
+					if int64(i) >= at || firstFailed.CompareAndSwap(at, int64(i)) {
+						break
+					}
+				}
+			}
+		})
+		bar.Done()
+		logOut = out
+
+		for _, outcome := range outcomes {
+			report.Files = append(report.Files, outcome.reports...)
+		}
+		for _, outcome := range outcomes {
+			if outcome.err != nil {
+				return report, outcome.err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// bumpFileWithReferences bumps a single file of an update set and, with
+// followValuesFrom, the valuesFrom objects it references. The reports of
+// what was changed are returned even when a later step fails.
+func bumpFileWithReferences(file string, updates map[string]string, opts bumpOptions, followValuesFrom bool) ([]fileReport, error) {
+	result, err := bumpHelmReleaseFile(file, updates, opts)
 	if err != nil {
-		return fmt.Errorf("failed to marshal sanitized HelmRelease: %w", err)
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	reports := []fileReport{{File: file, Updated: result.Updated, Changes: result.Changes, Skipped: result.Skipped}}
+
+	if followValuesFrom && !result.Pinned && !result.Unselected {
+		refReports, err := BumpValuesFromReferences(file, updates, opts)
+		if err != nil {
+			return reports, fmt.Errorf("%s: failed to bump valuesFrom references: %w", file, err)
+		}
+		reports = append(reports, refReports...)
 	}
+	return reports, nil
+}
+
+// findUnmatchedImages checks, without modifying anything, which requested
+// images of the update sets do not match a single image block in any of their
+// files (honouring the sets' path selectors). Globs and regular expressions
+// count as matched when at least one repository they select has a matching
+// block. With followValuesFrom, the values of referenced ConfigMaps and Secrets
+// are searched too.
+//
+// Returns:
+//   - The unmatched requests, in the form they were given (regular expressions
+//     prefixed with "regex "), in set order.
+//   - An error if a file cannot be read or parsed.
+func findUnmatchedImages(sets []updateSet, followValuesFrom bool) ([]string, error) {
+	out := logOut
+	logOut = io.Discard
+	defer func() { logOut = out }()
+
+	var unmatched []string
+	for _, set := range sets {
+		files, err := expandFileGlobs(set.Files)
+		if err != nil {
+			return nil, err
+		}
+
+		matched := map[string]bool{}
+		check := func(values map[string]interface{}, postRenderers *postRendererView) error {
+			for key := range matchedImageRequests(values, postRenderers, set) {
+				matched[key] = true
+			}
+			return nil
+		}
+
+		opts := set.options(true)
+		for _, file := range files {
+			data, _, err := readBumpTarget(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if opts.unselectedReason(helmReleaseMetadata(data)) != "" {
+				continue
+			}
+			if plugin := lookupBumpPlugin(manifestKind(data)); plugin != "" {
+				pluginMatched, err := pluginMatchedRequests(plugin, data, set)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				for key := range pluginMatched {
+					matched[key] = true
+				}
+				continue
+			}
+			if _, err := rewriteHelmReleaseValues(data, check); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if followValuesFrom {
+				_, err := editValuesFromReferences(file, true, func(values map[string]interface{}, _ *fileReport) error {
+					return check(values, nil)
+				})
+				if err != nil {
+					return nil, fmt.Errorf("%s: failed to read valuesFrom references: %w", file, err)
+				}
+			}
+		}
 
-	if err := os.WriteFile(filePath, newYAML, 0644); err != nil {
-		return fmt.Errorf("failed to write updated file: %w", err)
+		for _, image := range sortedKeys(set.Images) {
+			if _, created := set.CreateValuesPaths[image]; !matched[image] && !created {
+				unmatched = append(unmatched, image)
+			}
+		}
+		for _, expr := range sortedKeys(set.ImagesRegex) {
+			if !matched["regex "+expr] {
+				unmatched = append(unmatched, "regex "+expr)
+			}
+		}
 	}
+	return unmatched, nil
+}
 
-	fmt.Printf("✅ Updated %d image(s) in %s\n", updatedCount, filePath)
-	return nil
+// matchedImageRequests returns the keys of set.Images, and of set.ImagesRegex
+// prefixed with "regex ", that select at least one image block in values or
+// in postRenderers (which may be nil).
+func matchedImageRequests(values map[string]interface{}, postRenderers *postRendererView, set updateSet) map[string]bool {
+	opts := set.options(true)
+	claimed := scopedPaths(set.Images)
+	hasBlock := func(key string) bool {
+		repo, scope := splitScopedImage(key)
+		matches := findImageBlocks(values, repo, opts.Matchers)
+		if postRenderers != nil {
+			matches = append(matches, postRenderers.findImages(repo, opts.Matchers)...)
+		}
+		for _, m := range matches {
+			if updateSelects(m, scope, set.Paths, claimed[repo]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	matched := map[string]bool{}
+	repos := collectImageRepositories(values, opts.Matchers)
+	if postRenderers != nil {
+		repos = append(repos, postRenderers.repositories(opts.Matchers)...)
+	}
+	for image := range set.Images {
+		if !isImageGlob(image) {
+			if hasBlock(image) {
+				matched[image] = true
+			}
+			continue
+		}
+		pattern, scope := splitScopedImage(image)
+		for _, repo := range repos {
+			if ok, _ := path.Match(pattern, repo); ok && hasBlock(repo+scopedImageSeparator+scope) {
+				matched[image] = true
+				break
+			}
+		}
+	}
+	for expr := range set.ImagesRegex {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			continue
+		}
+		for _, repo := range repos {
+			if re.MatchString(repo) && hasBlock(repo) {
+				matched["regex "+expr] = true
+				break
+			}
+		}
+	}
+	return matched
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sigs.k8s.io/yaml"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -147,3 +149,282 @@ func TestBumpTagInValuesUniversalTwo(t *testing.T) {
 		t.Errorf("Expected tag to be updated to 1.2.4, got: %s", tag)
 	}
 }
+
+// TestBumpMultipleTagsPreservesAPIVersion verifies that HelmReleases written with
+// each supported helm.toolkit.fluxcd.io API version are bumped and written back
+// under the same apiVersion, and that unsupported versions are rejected.
+func TestBumpMultipleTagsPreservesAPIVersion(t *testing.T) {
+	fixtures := map[string]string{
+		"test_files/multiple-bump.yaml":       "helm.toolkit.fluxcd.io/v2beta1",
+		"test_files/helmrelease-v2beta2.yaml": "helm.toolkit.fluxcd.io/v2beta2",
+		"test_files/helmrelease-v2.yaml":      "helm.toolkit.fluxcd.io/v2",
+	}
+
+	for fixture, apiVersion := range fixtures {
+		t.Run(apiVersion, func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "hr.yaml")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("Failed to write fixture copy: %v", err)
+			}
+
+			updates := map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}
+			if err := BumpMultipleTagsUniversalAndSanitize(path, updates, false); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			out, _ := os.ReadFile(path)
+			var hr map[string]interface{}
+			if err := yaml.Unmarshal(out, &hr); err != nil {
+				t.Fatalf("Failed to parse output: %v", err)
+			}
+			if hr["apiVersion"] != apiVersion {
+				t.Errorf("Expected apiVersion %s, got: %v", apiVersion, hr["apiVersion"])
+			}
+			if !strings.Contains(string(out), "tag: 2.0.0") {
+				t.Errorf("Expected tag to be bumped to 2.0.0, got:\n%s", out)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := decodeHelmRelease([]byte("apiVersion: helm.toolkit.fluxcd.io/v1\nkind: HelmRelease\n"))
+		if err == nil {
+			t.Errorf("Expected an error for an unsupported apiVersion")
+		}
+	})
+}
+
+// TestBumpTagInValuesPathSelector verifies that --path selectors restrict which
+// matches of a repository are updated when it appears in several places.
+func TestBumpTagInValuesPathSelector(t *testing.T) {
+	newValues := func() map[string]interface{} {
+		return map[string]interface{}{
+			"image": map[string]interface{}{"repository": "ghcr.io/my-org/app", "tag": "1.0.0"},
+			"sidecars": map[string]interface{}{
+				"logging": map[string]interface{}{
+					"image": map[string]interface{}{"repository": "ghcr.io/my-org/app", "tag": "1.0.0"},
+				},
+			},
+			"images": map[string]interface{}{"app": "ghcr.io/my-org/app:1.0.0"},
+		}
+	}
+
+	tests := []struct {
+		selector     string
+		expectUpdate bool
+		expectMain   string
+		expectSide   string
+		expectAspire string
+	}{
+		{"sidecars.logging.image", true, "1.0.0", "2.0.0", "ghcr.io/my-org/app:1.0.0"},
+		{".spec.values.sidecars.logging.image.tag", true, "1.0.0", "2.0.0", "ghcr.io/my-org/app:1.0.0"},
+		{"$.image", true, "2.0.0", "1.0.0", "ghcr.io/my-org/app:1.0.0"},
+		{"images.app", true, "1.0.0", "1.0.0", "ghcr.io/my-org/app:2.0.0"},
+		{"sidecars.missing.image", false, "1.0.0", "1.0.0", "ghcr.io/my-org/app:1.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			values := newValues()
+			changes, err := bumpTagInValues(values, "ghcr.io/my-org/app", "2.0.0", bumpOptions{Paths: []string{tt.selector}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if updated := len(changes) > 0; updated != tt.expectUpdate {
+				t.Errorf("Expected update: %v, got: %v", tt.expectUpdate, updated)
+			}
+
+			mainTag := values["image"].(map[string]interface{})["tag"]
+			sideTag := values["sidecars"].(map[string]interface{})["logging"].(map[string]interface{})["image"].(map[string]interface{})["tag"]
+			aspire := values["images"].(map[string]interface{})["app"]
+			if mainTag != tt.expectMain || sideTag != tt.expectSide || aspire != tt.expectAspire {
+				t.Errorf("Unexpected result: image=%v sidecar=%v images.app=%v", mainTag, sideTag, aspire)
+			}
+		})
+	}
+}
+
+// TestResolveImageUpdates verifies that glob and regex patterns expand to the
+// repositories present in the values, and that explicit entries win.
+func TestResolveImageUpdates(t *testing.T) {
+	values := map[string]interface{}{
+		"image": map[string]interface{}{"repository": "ghcr.io/my-org/api", "tag": "1.0.0"},
+		"images": map[string]interface{}{
+			"web":    "ghcr.io/my-org/web:1.0.0",
+			"worker": "ghcr.io/my-org/team/worker:1.0.0",
+			"nginx":  "nginx:1.25.0",
+		},
+	}
+
+	resolved, err := resolveImageUpdates(values,
+		map[string]string{"ghcr.io/my-org/*": "2.0.0", "ghcr.io/my-org/web": "2.1.0"},
+		map[string]string{"(nginx|ghcr.io/my-org/team/.*)": "3.0.0"},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"ghcr.io/my-org/api":         "2.0.0",
+		"ghcr.io/my-org/web":         "2.1.0",
+		"ghcr.io/my-org/team/worker": "3.0.0",
+		"nginx":                      "3.0.0",
+	}
+	if fmt.Sprint(resolved) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got: %v", want, resolved)
+	}
+
+	if _, err := resolveImageUpdates(values, nil, map[string]string{"(unclosed": "1.0.0"}, nil); err == nil {
+		t.Errorf("Expected an error for an invalid regex")
+	}
+}
+
+// TestFindUnmatchedImages verifies that --strict reports exactly the requested
+// images, globs and regexes that match no image block, honouring --path, and
+// that the check leaves the file untouched.
+func TestFindUnmatchedImages(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	sets := []updateSet{{
+		Files: []string{file},
+		Images: map[string]string{
+			"ghcr.io/my-org/my-api": "2.0.0",
+			"ghcr.io/my-org/my-ap1": "2.0.0",
+			"ghcr.io/my-org/*":      "2.0.0",
+			"docker.io/*":           "2.0.0",
+		},
+		ImagesRegex: map[string]string{"ghcr.io/my-org/web-.*": "2.0.0", "quay.io/.*": "2.0.0"},
+	}}
+	unmatched, err := findUnmatchedImages(sets, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []string{"docker.io/*", "ghcr.io/my-org/my-ap1", "regex quay.io/.*"}
+	if fmt.Sprint(unmatched) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got: %v", want, unmatched)
+	}
+
+	sets = []updateSet{{Files: []string{file}, Paths: []string{"images.web"}, Images: map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}}}
+	if unmatched, _ := findUnmatchedImages(sets, false); fmt.Sprint(unmatched) != "[ghcr.io/my-org/my-api]" {
+		t.Errorf("Expected image outside --path to be unmatched, got: %v", unmatched)
+	}
+
+	if data, _ := os.ReadFile(file); string(data) != string(original) {
+		t.Errorf("Expected the strict check to leave the file untouched")
+	}
+}
+
+// TestPathScopedUpdates verifies that repo@path updates bump the match at
+// their path to their own version, and updates of the whole repository leave
+// that match alone.
+func TestPathScopedUpdates(t *testing.T) {
+	manifest := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.0
+    canary:
+      image:
+        repository: ghcr.io/my-org/my-api
+        tag: 1.7.0
+    worker:
+      image: ghcr.io/my-org/my-api:1.7.0
+`
+	result, err := bumpHelmReleaseData([]byte(manifest), map[string]string{
+		"ghcr.io/my-org/my-api":              "1.8.0",
+		"ghcr.io/my-org/my-api@canary.image": "2.0.0-rc.1",
+		"ghcr.io/my-org/*@worker.image":      "1.9.0",
+	}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{"image.tag": "1.8.0", "canary.image.tag": "2.0.0-rc.1", "worker.image": "ghcr.io/my-org/my-api:1.9.0"}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("Expected %d changes, got: %+v", len(want), result.Changes)
+	}
+	for _, c := range result.Changes {
+		if want[c.Path] != c.NewValue {
+			t.Errorf("Expected %s to become %s, got %s", c.Path, want[c.Path], c.NewValue)
+		}
+	}
+
+	if err := validateUpdateSets([]updateSet{{Files: []string{"hr.yaml"}, Images: map[string]string{"ghcr.io/my-org/my-api@": "1.0.0"}}}); err == nil {
+		t.Errorf("Expected an empty path scope to be rejected")
+	}
+}
+
+// TestListIndexPaths verifies that matches inside lists are reported and
+// selected by their list index, and that selectors without indexes still
+// select every item.
+func TestListIndexPaths(t *testing.T) {
+	manifest := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    containers:
+      - name: app
+        image:
+          repository: ghcr.io/my-org/my-api
+          tag: 1.7.0
+      - name: migrations
+        image:
+          repository: ghcr.io/my-org/my-api
+          tag: 1.7.0
+`
+	tests := []struct {
+		name    string
+		updates map[string]string
+		paths   []string
+		want    string
+	}{
+		{"all items", map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, nil, "containers[0].image.tag=1.8.0 containers[1].image.tag=1.8.0"},
+		{"selector without index", map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, []string{".spec.values.containers.image"}, "containers[0].image.tag=1.8.0 containers[1].image.tag=1.8.0"},
+		{"indexed selector", map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, []string{"containers[1].image"}, "containers[1].image.tag=1.8.0"},
+		{"indexed scope", map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "ghcr.io/my-org/my-api@containers[1].image": "2.0.0"}, nil, "containers[0].image.tag=1.8.0 containers[1].image.tag=2.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := bumpHelmReleaseData([]byte(manifest), tt.updates, bumpOptions{Paths: tt.paths})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, c := range result.Changes {
+				got = append(got, c.Path+"="+c.NewValue)
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+
+	values := map[string]interface{}{"containers": []interface{}{
+		map[string]interface{}{"image": "a:1"},
+		map[string]interface{}{"image": "a:1"},
+	}}
+	if n := replaceValueAtPath(values, "containers[1].image", "a:1", "a:2"); n != 1 {
+		t.Errorf("Expected an indexed path to replace one value, replaced %d", n)
+	}
+	if n := replaceValueAtPath(values, "containers.image", "a:1", "a:3"); n != 1 {
+		t.Errorf("Expected a path without index to replace the remaining value, replaced %d", n)
+	}
+}
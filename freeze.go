@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ignoreAnnotation on a HelmRelease set to "true" makes bump leave the
+	// whole file alone.
+	ignoreAnnotation = "flux-helpers.io/ignore"
+	// ignoreMarker in a comment next to an image reference in .spec.values
+	// makes bump leave that reference alone.
+	ignoreMarker = "flux-helpers:ignore"
+)
+
+// helmReleaseIgnored reports whether the HelmRelease YAML data carries the
+// ignoreAnnotation with a true value.
+func helmReleaseIgnored(data []byte) bool {
+	var meta struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return false
+	}
+	ignored, _ := strconv.ParseBool(meta.Metadata.Annotations[ignoreAnnotation])
+	return ignored
+}
+
+// ignoreMarkers records which parts of a values tree are pinned with an
+// ignoreMarker comment. Maps are identified by their address, so the markers
+// only apply to the values tree they were collected from.
+type ignoreMarkers struct {
+	// subtrees are maps below a pinned key or list item; every reference
+	// inside them is ignored.
+	subtrees map[uintptr]bool
+	// blocks are maps with a pinned scalar, e.g. a marker on the tag line of
+	// an image block.
+	blocks map[uintptr]bool
+	// keys are pinned scalars, e.g. a marker after a "repository:tag" string.
+	keys map[ignoredKey]bool
+}
+
+// ignoredKey is a scalar in a values map.
+type ignoredKey struct {
+	parent uintptr
+	key    string
+}
+
+// findIgnoreMarkers collects the ignoreMarker comments in the .spec.values of
+// the HelmRelease YAML data, mapped onto values (the same .spec.values after
+// decoding). A marker applies to:
+//   - a scalar line, e.g. `tag: 1.2.3 # flux-helpers:ignore`: the image block
+//     holding the scalar, or the "repository:tag" string itself;
+//   - a key followed by a nested map or list, as a line comment or on the line
+//     above it: every reference below the key;
+//   - a list item, on the line above it: every reference in the item.
+//
+// It returns nil if there are no markers.
+func findIgnoreMarkers(data []byte, values map[string]interface{}) *ignoreMarkers {
+	return findIgnoreMarkersAt(data, values, helmReleaseValuesNode)
+}
+
+// findIgnoreMarkersAt is findIgnoreMarkers for the values found at the node
+// that locate returns for the root of the YAML data.
+func findIgnoreMarkersAt(data []byte, values map[string]interface{}, locate func(root *yamlv3.Node) *yamlv3.Node) *ignoreMarkers {
+	if !strings.Contains(string(data), ignoreMarker) {
+		return nil
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	m := &ignoreMarkers{subtrees: map[uintptr]bool{}, blocks: map[uintptr]bool{}, keys: map[ignoredKey]bool{}}
+	m.collect(locate(yamlDocumentRoot(&doc)), values, false)
+	if len(m.subtrees)+len(m.blocks)+len(m.keys) == 0 {
+		return nil
+	}
+	return m
+}
+
+// collect walks node together with its decoded value and records the markers
+// found. pinned is set below a marked key or list item.
+func (m *ignoreMarkers) collect(node *yamlv3.Node, value interface{}, pinned bool) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	pinned = pinned || hasIgnoreMarker(node.HeadComment, node.LineComment)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node.Kind != yamlv3.MappingNode {
+			return
+		}
+		addr := reflect.ValueOf(v).Pointer()
+		if pinned {
+			m.subtrees[addr] = true
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, child := node.Content[i], node.Content[i+1]
+			childValue, ok := v[key.Value]
+			if !ok {
+				continue
+			}
+			marked := hasIgnoreMarker(key.HeadComment, key.LineComment)
+			if child.Kind == yamlv3.ScalarNode {
+				if marked || hasIgnoreMarker(child.HeadComment, child.LineComment) {
+					m.blocks[addr] = true
+					m.keys[ignoredKey{parent: addr, key: key.Value}] = true
+				}
+				continue
+			}
+			m.collect(child, childValue, pinned || marked)
+		}
+
+	case []interface{}:
+		if node.Kind != yamlv3.SequenceNode || len(node.Content) != len(v) {
+			return
+		}
+		for i, item := range v {
+			m.collect(node.Content[i], item, pinned)
+		}
+	}
+}
+
+// hasIgnoreMarker reports whether any of the comments holds ignoreMarker.
+func hasIgnoreMarker(comments ...string) bool {
+	for _, c := range comments {
+		if strings.Contains(c, ignoreMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignores reports whether the image reference match is pinned. A nil
+// ignoreMarkers ignores nothing.
+func (m *ignoreMarkers) ignores(match imageMatch) bool {
+	if m == nil {
+		return false
+	}
+	if match.Block != nil {
+		addr := reflect.ValueOf(match.Block).Pointer()
+		return m.subtrees[addr] || m.blocks[addr]
+	}
+	if match.Parent != nil {
+		addr := reflect.ValueOf(match.Parent).Pointer()
+		return m.subtrees[addr] || m.keys[ignoredKey{parent: addr, key: match.Key}]
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pinnedManifest pins some image references with flux-helpers:ignore
+// comments in the ways findIgnoreMarkers recognises.
+const pinnedManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  interval: 5m
+  chart:
+    spec:
+      chart: my-chart
+  values:
+    image:
+      repository: ghcr.io/my-org/api
+      tag: 1.0.0 # flux-helpers:ignore during incident
+    sidecar:
+      image:
+        repository: ghcr.io/my-org/api
+        tag: 1.0.0
+    # flux-helpers:ignore
+    jobs:
+      migrate:
+        image:
+          repository: ghcr.io/my-org/api
+          tag: 1.0.0
+    workers:
+      # flux-helpers:ignore
+      - image:
+          repository: ghcr.io/my-org/worker
+          tag: 1.0.0
+      - image:
+          repository: ghcr.io/my-org/worker
+          tag: 1.0.0
+    images:
+      web: ghcr.io/my-org/web:1.0.0 # flux-helpers:ignore
+      cron: ghcr.io/my-org/cron:1.0.0
+`
+
+// TestBumpSkipsPinnedReferences verifies that references pinned with a
+// comment keep their tag while the other references are bumped.
+func TestBumpSkipsPinnedReferences(t *testing.T) {
+	updates := map[string]string{
+		"ghcr.io/my-org/api":    "2.0.0",
+		"ghcr.io/my-org/worker": "2.0.0",
+		"ghcr.io/my-org/web":    "2.0.0",
+		"ghcr.io/my-org/cron":   "2.0.0",
+	}
+	result, err := bumpHelmReleaseData([]byte(pinnedManifest), updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, c := range result.Changes {
+		paths = append(paths, c.Path)
+	}
+	want := []string{"sidecar.image.tag", "images.cron", "workers[1].image.tag"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected changes at %v, got %v", want, paths)
+	}
+
+	out := string(result.Output)
+	for _, kept := range []string{
+		"tag: 1.0.0 # flux-helpers:ignore during incident",
+		"web: ghcr.io/my-org/web:1.0.0 # flux-helpers:ignore",
+	} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Expected %q to be kept, got:\n%s", kept, out)
+		}
+	}
+	if got := strings.Count(out, "tag: 1.0.0"); got != 3 {
+		t.Errorf("Expected 3 pinned block tags to be kept, got %d:\n%s", got, out)
+	}
+}
+
+// TestBumpSkipsPinnedHelmRelease verifies that the ignore annotation leaves
+// the whole HelmRelease unchanged.
+func TestBumpSkipsPinnedHelmRelease(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		pinned bool
+	}{
+		{`"true"`, true},
+		{`"false"`, false},
+	} {
+		data := strings.Replace(pinnedManifest, "  name: my-app\n",
+			"  name: my-app\n  annotations:\n    flux-helpers.io/ignore: "+tc.value+"\n", 1)
+		result, err := bumpHelmReleaseData([]byte(data), map[string]string{"ghcr.io/my-org/cron": "2.0.0"}, bumpOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Pinned != tc.pinned || (result.Updated == 0) != tc.pinned {
+			t.Errorf("ignore %s: expected pinned=%v, got pinned=%v with %d update(s)", tc.value, tc.pinned, result.Pinned, result.Updated)
+		}
+	}
+}
+
+// TestBuildBumpPlanSkipsPinned verifies that plans honour pins as well.
+func TestBuildBumpPlanSkipsPinned(t *testing.T) {
+	dir := t.TempDir()
+	pinned := strings.Replace(pinnedManifest, "  name: my-app\n",
+		"  name: my-app\n  annotations:\n    flux-helpers.io/ignore: \"true\"\n", 1)
+	for name, data := range map[string]string{"a.yaml": pinnedManifest, "b.yaml": pinned} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write manifest: %v", err)
+		}
+	}
+
+	plan, err := BuildBumpPlan([]updateSet{{
+		Files:  []string{filepath.Join(dir, "*.yaml")},
+		Images: map[string]string{"ghcr.io/my-org/web": "2.0.0", "ghcr.io/my-org/cron": "2.0.0"},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error building plan: %v", err)
+	}
+	if len(plan.Files) != 1 || filepath.Base(plan.Files[0].File) != "a.yaml" {
+		t.Fatalf("Expected only a.yaml to be planned, got: %+v", plan.Files)
+	}
+	if changes := plan.Files[0].Changes; len(changes) != 1 || changes[0].Path != "images.cron" {
+		t.Errorf("Expected only images.cron to change, got: %+v", changes)
+	}
+}
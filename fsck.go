@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var fsckDir string
+
+// Checks reported by fsck.
+const (
+	fsckSyntax               = "syntax"
+	fsckDuplicateKey         = "duplicate-key"
+	fsckTabIndent            = "tab-indent"
+	fsckDuplicateHelmRelease = "duplicate-helmrelease"
+)
+
+// fsckFinding is a problem found in a YAML file.
+type fsckFinding struct {
+	File string `json:"file"`
+	// Line is 0 when the problem has no position, e.g. a syntax error the
+	// parser reports without one.
+	Line    int    `json:"line,omitempty"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// fsckReport is the machine-readable result of fsck.
+type fsckReport struct {
+	Dir      string        `json:"dir"`
+	Files    int           `json:"files"`
+	Findings []fsckFinding `json:"findings"`
+}
+
+// yamlErrorLine matches the position yaml.v3 puts in its syntax errors.
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// fsckFiles returns the YAML files below dir, in lexical order. Hidden
+// directories such as .git are skipped, and so are the templates of Helm
+// charts, which are Go templates rather than YAML.
+func fsckFiles(dir string) ([]string, error) {
+	var files []string
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if d.Name() == "templates" {
+				if _, err := os.Stat(filepath.Join(filepath.Dir(path), "Chart.yaml")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// FsckDir checks every YAML file below dir, see fsckFile.
+//
+// Returns:
+//   - The report, with the findings in file and line order.
+//   - An error if dir cannot be walked or a file cannot be read.
+func FsckDir(dir string) (*fsckReport, error) {
+	files, err := fsckFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	report := &fsckReport{Dir: dir, Files: len(files), Findings: []fsckFinding{}}
+	bar := startProgress("fsck", "file", len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		report.Findings = append(report.Findings, fsckFile(file, data)...)
+		bar.Increment()
+	}
+	bar.Done()
+	return report, nil
+}
+
+// fsckFile checks the YAML data of file:
+//
+//   - every document must parse;
+//   - no mapping may define a key twice, which most parsers accept silently,
+//     keeping one of the values;
+//   - lines must not be indented with tabs, outside of block scalars;
+//   - no two HelmReleases may share a name and namespace.
+//
+// Returns:
+//   - The findings, in line order.
+func fsckFile(file string, data []byte) []fsckFinding {
+	var findings []fsckFinding
+	add := func(line int, check, format string, args ...interface{}) {
+		findings = append(findings, fsckFinding{File: file, Line: line, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var docs []*yamlv3.Node
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yamlv3.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			line, message := 0, err.Error()
+			if m := yamlErrorLine.FindStringSubmatch(message); m != nil {
+				line, _ = strconv.Atoi(m[1])
+				message = m[2]
+			}
+			add(line, fsckSyntax, "%s", strings.TrimPrefix(message, "yaml: "))
+			// Documents after a syntax error cannot be read.
+			docs = nil
+			break
+		}
+		docs = append(docs, &doc)
+	}
+
+	nodeLines := map[int]bool{}
+	var blockScalars []*yamlv3.Node
+	var walk func(n *yamlv3.Node)
+	walk = func(n *yamlv3.Node) {
+		nodeLines[n.Line] = true
+		if n.Kind == yamlv3.ScalarNode && n.Style&(yamlv3.LiteralStyle|yamlv3.FoldedStyle) != 0 {
+			blockScalars = append(blockScalars, n)
+		}
+		if n.Kind == yamlv3.MappingNode {
+			seen := map[string]int{}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := n.Content[i]
+				if key.Kind != yamlv3.ScalarNode || key.Value == "<<" {
+					continue
+				}
+				if first, ok := seen[key.Value]; ok {
+					add(key.Line, fsckDuplicateKey, "key %q is already defined at line %d", key.Value, first)
+					continue
+				}
+				seen[key.Value] = key.Line
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	for _, doc := range docs {
+		walk(doc)
+	}
+
+	// The content of a block scalar runs up to the next node, and may hold
+	// tabs.
+	lines := strings.Split(string(data), "\n")
+	inBlockScalar := map[int]bool{}
+	for _, n := range blockScalars {
+		for line := n.Line + 1; line <= len(lines) && !nodeLines[line]; line++ {
+			inBlockScalar[line] = true
+		}
+	}
+	for i, text := range lines {
+		indent := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+		rest := strings.TrimSpace(text)
+		if !strings.Contains(indent, "\t") || rest == "" || strings.HasPrefix(rest, "#") || inBlockScalar[i+1] {
+			continue
+		}
+		add(i+1, fsckTabIndent, "indented with a tab; YAML only allows spaces")
+	}
+
+	releases := map[string]int{}
+	for _, doc := range docs {
+		root := yamlDocumentRoot(doc)
+		if kind := yamlMappingValue(root, "kind"); kind == nil || kind.Value != "HelmRelease" {
+			continue
+		}
+		metadata := yamlMappingValue(root, "metadata")
+		var name, namespace string
+		if n := yamlMappingValue(metadata, "name"); n != nil {
+			name = n.Value
+		}
+		if n := yamlMappingValue(metadata, "namespace"); n != nil {
+			namespace = n.Value
+		}
+		id := name
+		if namespace != "" {
+			id = namespace + "/" + name
+		}
+		if first, ok := releases[id]; ok {
+			add(root.Line, fsckDuplicateHelmRelease, "HelmRelease %s is already defined at line %d", id, first)
+			continue
+		}
+		releases[id] = root.Line
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// writeFsckTable prints findings as an aligned table.
+func writeFsckTable(w io.Writer, findings []fsckFinding) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tLINE\tCHECK\tPROBLEM")
+	for _, f := range findings {
+		line := "-"
+		if f.Line > 0 {
+			line = strconv.Itoa(f.Line)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.File, line, f.Check, f.Message)
+	}
+	return tw.Flush()
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check that every YAML file of a repository is well-formed",
+	Long: `Parse every YAML file below a directory and report, before Flux ever sees the
+commit:
+
+  - syntax errors;
+  - keys defined twice in the same mapping, which parsers accept silently,
+    keeping one of the values;
+  - lines indented with tabs (outside of block scalars);
+  - files holding several HelmReleases with the same name and namespace.
+
+Hidden directories such as .git and the templates of Helm charts are skipped.
+The command fails if any problem is found.`,
+	Example: `  flux-helpers fsck --dir .
+  flux-helpers fsck --dir clusters -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+
+		report, err := FsckDir(fsckDir)
+		if err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			if err := writeJSON(os.Stdout, report); err != nil {
+				return err
+			}
+		} else if len(report.Findings) > 0 {
+			if err := writeFsckTable(os.Stdout, report.Findings); err != nil {
+				return err
+			}
+		}
+		if len(report.Findings) > 0 {
+			files := map[string]bool{}
+			for _, f := range report.Findings {
+				files[f.File] = true
+			}
+			return fmt.Errorf("%d problem(s) found in %d of %d YAML file(s)", len(report.Findings), len(files), report.Files)
+		}
+		logf("🎉 %d YAML file(s) are well-formed\n", report.Files)
+		return nil
+	},
+}
+
+func init() {
+	fsckCmd.Flags().StringVar(&fsckDir, "dir", ".", "Check every YAML file below this directory")
+	fsckCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text (a table) or json")
+	rootCmd.AddCommand(fsckCmd)
+}
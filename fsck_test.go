@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestFsckFile verifies every check of fsck, and that tabs inside block
+// scalars are accepted.
+func TestFsckFile(t *testing.T) {
+	data := "apiVersion: helm.toolkit.fluxcd.io/v2\n" +
+		"kind: HelmRelease\n" +
+		"metadata:\n" +
+		"  name: app\n" +
+		"  namespace: apps\n" +
+		"spec:\n" +
+		"  interval: 5m\n" +
+		"  interval: 10m\n" +
+		"  values:\n" +
+		"    script: |\n" +
+		"      all:\n" +
+		"      \tmake build\n" +
+		"    defaults: &defaults {a: 1}\n" +
+		"    merged:\n" +
+		"      <<: *defaults\n" +
+		"      <<: *defaults\n" +
+		"---\n" +
+		"apiVersion: helm.toolkit.fluxcd.io/v2\n" +
+		"kind: HelmRelease\n" +
+		"metadata: {name: app, namespace: apps}\n" +
+		"---\n" +
+		"apiVersion: helm.toolkit.fluxcd.io/v2\n" +
+		"kind: HelmRelease\n" +
+		"metadata: {name: app, namespace: other}\n"
+	want := []fsckFinding{
+		{File: "hr.yaml", Line: 8, Check: fsckDuplicateKey, Message: `key "interval" is already defined at line 7`},
+		{File: "hr.yaml", Line: 18, Check: fsckDuplicateHelmRelease, Message: "HelmRelease apps/app is already defined at line 1"},
+	}
+	if got := fsckFile("hr.yaml", []byte(data)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	got := fsckFile("bad.yaml", []byte("a: 1\nb:\n\tc: 2\n"))
+	if len(got) != 2 || got[0].Check != fsckSyntax || got[0].Line != 3 || got[1].Check != fsckTabIndent || got[1].Line != 3 {
+		t.Errorf("Expected a syntax error and a tab at line 3, got %+v", got)
+	}
+}
+
+// TestFsckDir verifies that hidden directories and chart templates are
+// skipped.
+func TestFsckDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"clusters/prod/app.yaml":           "a: 1\n",
+		"clusters/prod/broken.yml":         "a: [1\n",
+		".git/config.yaml":                 "a: [\n",
+		"charts/app/Chart.yaml":            "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"charts/app/templates/deploy.yaml": "{{- if .Values.enabled }}\nkind: Deployment\n",
+		"charts/app/values.yaml":           "enabled: true\n",
+		"clusters/prod/notes.txt":          "a: [\n",
+	})
+
+	report, err := FsckDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Files != 4 {
+		t.Errorf("Expected 4 checked files, got %d", report.Files)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].File != filepath.Join(dir, "clusters/prod/broken.yml") || report.Findings[0].Check != fsckSyntax {
+		t.Errorf("Expected one syntax error in broken.yml, got %+v", report.Findings)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"testing"
 
@@ -72,3 +73,30 @@ func FuzzBumpTagInValuesUniversal(f *testing.F) {
 		}
 	})
 }
+
+// FuzzVerifyRoundTrip drives VerifyRoundTrip with arbitrary manifests and
+// updates. Inputs that are not bumpable HelmReleases are skipped; any structural
+// difference between the expected and the written document fails the test.
+func FuzzVerifyRoundTrip(f *testing.F) {
+	seedFiles := []string{
+		"test_files/multiple-bump.yaml",
+		"test_files/aspire-test.yaml",
+		"test_files/helmrelease-v2.yaml",
+	}
+
+	for _, file := range seedFiles {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			f.Add(string(data), "ghcr.io/my-org/my-api", "1.3.999")
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, yamlInput, repo, tag string) {
+		err := VerifyRoundTrip([]byte(yamlInput), map[string]string{repo: tag})
+
+		var rtErr *RoundTripError
+		if errors.As(err, &rtErr) {
+			t.Errorf("❌ Round-trip corrupted the manifest: %v", err)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitChanges bool
+	commitMessage string
+	commitSign    string
+	commitKey     string
+	gitAuthor     string
+)
+
+// Environment variables providing defaults for --sign and --signing-key, so
+// CI can supply the signing key without putting it on the command line.
+const (
+	commitSignEnv = "FLUX_HELPERS_SIGN"
+	commitKeyEnv  = "FLUX_HELPERS_SIGNING_KEY"
+)
+
+// commitSigning selects how git signs the commits flux-helpers makes.
+type commitSigning struct {
+	// Format is "gpg", "ssh", or empty for an unsigned commit (unless the
+	// repository's git config signs commits anyway).
+	Format string
+	// Key is the GPG key ID, or the SSH private or public key file. Empty
+	// uses git's user.signingKey.
+	Key string
+}
+
+// validate checks the signing format and that a key is only given together
+// with a format.
+func (s commitSigning) validate() error {
+	switch s.Format {
+	case "", "gpg", "ssh":
+	default:
+		return fmt.Errorf("invalid signing format %q: use gpg or ssh", s.Format)
+	}
+	if s.Format == "" && s.Key != "" {
+		return fmt.Errorf("a signing key requires a signing format (--sign gpg or --sign ssh)")
+	}
+	return nil
+}
+
+// gitArgs returns the `git -c` options that configure signing for a single
+// command, leaving the repository's config untouched.
+func (s commitSigning) gitArgs() []string {
+	if s.Format == "" {
+		return nil
+	}
+	format := "openpgp"
+	if s.Format == "ssh" {
+		format = "ssh"
+	}
+	args := []string{"-c", "gpg.format=" + format}
+	if s.Key != "" {
+		args = append(args, "-c", "user.signingKey="+s.Key)
+	}
+	return args
+}
+
+// gitAuthorPattern matches a git identity, "Name <email>".
+var gitAuthorPattern = regexp.MustCompile(`^\s*([^<>]*[^<>\s])\s*<([^<>\s]+)>\s*$`)
+
+// parseGitAuthor splits a --git-author identity such as "CI Bot
+// <ci@example.com>" into its name and email. Both are empty for an empty
+// author, which leaves the identity to git's config.
+func parseGitAuthor(author string) (name, email string, err error) {
+	if author == "" {
+		return "", "", nil
+	}
+	match := gitAuthorPattern.FindStringSubmatch(author)
+	if match == nil {
+		return "", "", fmt.Errorf("invalid --git-author %q (expected \"Name <email>\")", author)
+	}
+	return match[1], match[2], nil
+}
+
+// gitAuthorArgs returns the `git -c` options that commit as --git-author,
+// leaving the repository's config untouched.
+func gitAuthorArgs() ([]string, error) {
+	name, email, err := parseGitAuthor(gitAuthor)
+	if err != nil || name == "" {
+		return nil, err
+	}
+	return []string{"-c", "user.name=" + name, "-c", "user.email=" + email}, nil
+}
+
+// changedFiles returns the files of a report that were changed, in order and
+// without duplicates.
+func changedFiles(files []fileReport) []string {
+	var changed []string
+	for _, f := range files {
+		if len(f.Changes) > 0 {
+			changed = appendUnique(changed, f.File)
+		}
+	}
+	return changed
+}
+
+// defaultCommitMessage describes the changes in files: the subject names the
+// image and version when a single image was bumped, and the body lists every
+// change.
+func defaultCommitMessage(files []fileReport) string {
+	var images []string
+	var body strings.Builder
+	for _, f := range files {
+		for _, c := range f.Changes {
+			images = appendUnique(images, c.Image)
+			fmt.Fprintf(&body, "- %s: %s %s → %s\n", f.File, c.Path, c.OldValue, c.NewValue)
+		}
+	}
+
+	subject := fmt.Sprintf("Bump %d images", len(images))
+	if len(images) == 1 {
+		version := ""
+		for _, f := range files {
+			if len(f.Changes) > 0 {
+				version = f.Changes[0].NewValue
+				break
+			}
+		}
+		version = strings.TrimPrefix(version, images[0]+":")
+		subject = fmt.Sprintf("Bump %s to %s", images[0], version)
+	}
+	return subject + "\n\n" + body.String()
+}
+
+// gitCommitFiles stages files and commits them, and nothing else, with
+// message, signing the commit as configured by signing. Git runs in the
+// repository containing the first file, and commits as --git-author when set.
+//
+// Parameters:
+//   - files: The files to commit; they must belong to one repository.
+//   - message: The commit message.
+//   - signing: How to sign the commit.
+//
+// Returns:
+//   - The SHA of the new commit.
+//   - An error if git fails, e.g. when signing fails or the key is missing.
+func gitCommitFiles(files []string, message string, signing commitSigning) (string, error) {
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files to commit")
+	}
+	paths := make([]string, len(files))
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return "", err
+		}
+		paths[i] = abs
+	}
+	dir := filepath.Dir(paths[0])
+
+	if _, err := runGit(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		return "", fmt.Errorf("git add failed: %w", err)
+	}
+	author, err := gitAuthorArgs()
+	if err != nil {
+		return "", err
+	}
+	commit := append(append(author, signing.gitArgs()...), "commit", "--quiet", "-m", message)
+	if signing.Format != "" {
+		commit = append(commit, "--gpg-sign")
+	}
+	commit = append(commit, "--")
+	if _, err := runGit(dir, append(commit, paths...)...); err != nil {
+		return "", fmt.Errorf("git commit failed: %w", err)
+	}
+	return runGit(dir, "rev-parse", "HEAD")
+}
+
+// runGit runs git in dir and returns its trimmed output. Errors include what
+// git printed on stderr.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commitRun commits the files changed by a run when --commit is set. With
+// --branch (or --branch-template) the commit is pushed to that branch of
+// origin, and with --pull-request a pull request is opened from it. templates
+// customize the commit message, branch name and pull request.
+func commitRun(ctx context.Context, files []fileReport, templates *commitTemplates) error {
+	return commitReports(ctx, "", files, templates)
+}
+
+// commitReports is commitRun for files in the checkout at root: when root is
+// set, the commit message and templates name the files relative to it.
+func commitReports(ctx context.Context, root string, files []fileReport, templates *commitTemplates) error {
+	changed := changedFiles(files)
+	if !commitChanges || len(changed) == 0 {
+		return nil
+	}
+	described := files
+	if root != "" {
+		described = relativeReports(root, files)
+	}
+	data := newCommitTemplateData(described, time.Now())
+	message := commitMessage
+	if message == "" {
+		var err error
+		if message, err = renderCommitTemplate(templates.message, data, defaultCommitMessage(described)); err != nil {
+			return err
+		}
+	}
+	branch, err := renderCommitTemplate(templates.branch, data, commitBranch)
+	if err != nil {
+		return err
+	}
+	if branch = strings.TrimSpace(branch); templates.branch != nil && (branch == "" || strings.ContainsAny(branch, " \t\n")) {
+		return fmt.Errorf("--branch-template rendered an invalid branch name %q", branch)
+	}
+	title, description, _ := strings.Cut(message, "\n")
+	data.Message = message
+	if title, err = renderCommitTemplate(templates.prTitle, data, title); err != nil {
+		return err
+	}
+	if description, err = renderCommitTemplate(templates.prBody, data, description); err != nil {
+		return err
+	}
+	dir := filepath.Dir(changed[0])
+
+	// Resolve the provider and target branch first, so a missing token fails
+	// before anything is committed or pushed.
+	var provider PullRequestProvider
+	base := pullRequestBase
+	if pullRequestOpen {
+		if provider, err = remotePullRequestProvider(dir, pullRequestVendor); err != nil {
+			return err
+		}
+		if base == "" {
+			if base, err = currentBranch(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	signing := commitSigning{Format: commitSign, Key: commitKey}
+	sha, err := gitCommitFiles(changed, message, signing)
+	if err != nil {
+		return err
+	}
+	if signing.Format != "" {
+		logf("🔏 Committed %d file(s) as %s (signed with %s)\n", len(changed), shortSHA(sha), signing.Format)
+	} else {
+		logf("📦 Committed %d file(s) as %s\n", len(changed), shortSHA(sha))
+	}
+
+	if branch == "" {
+		return nil
+	}
+	if _, err := runGitRemote(ctx, dir, "push", "--quiet", "origin", "HEAD:refs/heads/"+branch); err != nil {
+		return fmt.Errorf("git push failed: %w", err)
+	}
+	logf("⬆️ Pushed %s to origin/%s\n", shortSHA(sha), branch)
+
+	if provider == nil {
+		return nil
+	}
+	prURL, err := provider.CreatePullRequest(ctx, pullRequest{
+		SourceBranch: branch,
+		TargetBranch: base,
+		Title:        title,
+		Description:  strings.TrimSpace(description),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open pull request: %w", err)
+	}
+	logf("🔀 Opened pull request %s\n", prURL)
+	return nil
+}
+
+// addCommitFlags registers the --commit flags and those of the branch and
+// pull request it can push and open, shared by bump and apply.
+func addCommitFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.BoolVar(&commitChanges, "commit", false, "Commit the changed files with git")
+	flags.StringVar(&commitMessage, "commit-message", "", "Message for --commit (default: describes the bumped images)")
+	flags.StringVar(&commitSign, "sign", os.Getenv(commitSignEnv), "Sign the --commit commit: gpg or ssh (default: $"+commitSignEnv+")")
+	flags.StringVar(&commitKey, "signing-key", os.Getenv(commitKeyEnv), "GPG key ID or SSH key file for --sign (default: $"+commitKeyEnv+", then git's user.signingKey)")
+	flags.StringVar(&commitBranch, "branch", "", "Push the --commit commit to this branch of origin")
+	flags.StringVar(&messageTemplate, "message-template", "", "Go template for the --commit message (fields: .Images, .Image, .Version, .File, .Files, .Changes, .Date; funcs: env, join, slug); @file reads it from a file")
+	flags.StringVar(&branchTemplate, "branch-template", "", "Go template for the --commit branch, e.g. bump/{{slug .Image}}-{{.Version}}; @file reads it from a file")
+	flags.StringVar(&prTitleTemplate, "pr-title-template", "", "Go template for the pull request title (also .Message); @file reads it from a file")
+	flags.StringVar(&prBodyTemplate, "pr-body-template", "", "Go template for the pull request description (also .Message); @file reads it from a file")
+	flags.BoolVar(&pullRequestOpen, "pull-request", false, "Open a pull request from --branch (token from $GITHUB_TOKEN, $GITLAB_TOKEN, $AZURE_DEVOPS_TOKEN or $BITBUCKET_TOKEN)")
+	flags.StringVar(&pullRequestBase, "base", "", "Target branch of the pull request (default: the checked out branch)")
+	flags.StringVar(&pullRequestVendor, "pr-provider", "", "Pull request provider: github, gitlab, azure-devops or bitbucket (default: detected from the origin remote)")
+}
+
+// validateCommitFlags checks the flags registered by addCommitFlags: the
+// signing settings, that commit and pull request options are only given
+// together with --commit and --pull-request, and that a pull request has a
+// branch to be opened from.
+//
+// Returns:
+//   - The parsed commit templates.
+//   - An error if the flags are inconsistent or a template is invalid.
+func validateCommitFlags(cmd *cobra.Command) (*commitTemplates, error) {
+	signing := commitSigning{Format: commitSign, Key: commitKey}
+	if err := signing.validate(); err != nil {
+		return nil, err
+	}
+	for _, flag := range []string{"commit-message", "sign", "signing-key", "branch", "message-template", "branch-template", "pr-title-template", "pr-body-template"} {
+		if cmd.Flags().Changed(flag) && !commitChanges {
+			return nil, fmt.Errorf("--%s requires --commit", flag)
+		}
+	}
+	if commitMessage != "" && messageTemplate != "" {
+		return nil, fmt.Errorf("--commit-message and --message-template cannot be combined")
+	}
+	if commitBranch != "" && branchTemplate != "" {
+		return nil, fmt.Errorf("--branch and --branch-template cannot be combined")
+	}
+	if pullRequestOpen && commitBranch == "" && branchTemplate == "" {
+		return nil, fmt.Errorf("--pull-request requires --branch or --branch-template")
+	}
+	for _, flag := range []string{"base", "pr-provider", "pr-title-template", "pr-body-template"} {
+		if cmd.Flags().Changed(flag) && !pullRequestOpen {
+			return nil, fmt.Errorf("--%s requires --pull-request", flag)
+		}
+	}
+	return loadCommitTemplates()
+}
+
+// shortSHA abbreviates a commit SHA for log messages.
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&gitAuthor, "git-author", "", "Identity of the commits flux-helpers makes, as \"Name <email>\" (default: git's user.name and user.email)")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// initTestRepo creates a git repository with one committed file and returns
+// the path of that file.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	if err := os.WriteFile(file, []byte("tag: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgSign", "false"},
+		{"add", "app.yaml"},
+		{"commit", "--quiet", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	return file
+}
+
+// TestGitCommitFiles verifies that only the given files are committed, with
+// the given message.
+func TestGitCommitFiles(t *testing.T) {
+	file := initTestRepo(t)
+	dir := filepath.Dir(file)
+	os.WriteFile(file, []byte("tag: 1.1.0\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "unrelated.yaml"), []byte("x: 1\n"), 0644)
+
+	sha, err := gitCommitFiles([]string{file}, "Bump app to 1.1.0", commitSigning{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, _ := exec.Command("git", "-C", dir, "show", "--name-only", "--format=%H %s", "HEAD").Output()
+	if !strings.HasPrefix(string(out), sha+" Bump app to 1.1.0") || !strings.Contains(string(out), "app.yaml") || strings.Contains(string(out), "unrelated.yaml") {
+		t.Errorf("Unexpected commit:\n%s", out)
+	}
+}
+
+// TestGitCommitFilesSSHSigned verifies that commits are signed with the given
+// SSH key.
+func TestGitCommitFilesSSHSigned(t *testing.T) {
+	file := initTestRepo(t)
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	os.WriteFile(file, []byte("tag: 1.1.0\n"), 0644)
+
+	if _, err := gitCommitFiles([]string{file}, "Bump app", commitSigning{Format: "ssh", Key: key}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, _ := exec.Command("git", "-C", filepath.Dir(file), "cat-file", "commit", "HEAD").Output()
+	if !strings.Contains(string(out), "-----BEGIN SSH SIGNATURE-----") {
+		t.Errorf("Expected an SSH signature, got:\n%s", out)
+	}
+
+	if err := (commitSigning{Key: key}).validate(); err == nil {
+		t.Error("Expected a key without a format to be rejected")
+	}
+	if err := (commitSigning{Format: "x509"}).validate(); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+// TestDefaultCommitMessage verifies the generated subject and body.
+func TestDefaultCommitMessage(t *testing.T) {
+	files := []fileReport{
+		{File: "dev/app.yaml", Changes: []tagChange{{Image: "ghcr.io/my-org/api", Path: "image.tag", OldValue: "1.0.0", NewValue: "1.1.0"}}},
+		{File: "prod/app.yaml", Changes: []tagChange{{Image: "ghcr.io/my-org/api", Path: "images.api", OldValue: "ghcr.io/my-org/api:1.0.0", NewValue: "ghcr.io/my-org/api:1.1.0"}}},
+	}
+	want := "Bump ghcr.io/my-org/api to 1.1.0\n\n" +
+		"- dev/app.yaml: image.tag 1.0.0 → 1.1.0\n" +
+		"- prod/app.yaml: images.api ghcr.io/my-org/api:1.0.0 → ghcr.io/my-org/api:1.1.0\n"
+	if got := defaultCommitMessage(files); got != want {
+		t.Errorf("Unexpected message:\n%s", got)
+	}
+	files[1].Changes[0].Image = "envoyproxy/envoy"
+	if got := defaultCommitMessage(files); !strings.HasPrefix(got, "Bump 2 images\n") {
+		t.Errorf("Unexpected message:\n%s", got)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// outputGitHub is the --output format of bump for GitHub Actions: workflow
+// commands annotating every change and skipped match, and a Markdown table of
+// the changes appended to the job's step summary.
+const outputGitHub = "github"
+
+// githubStepSummaryEnv names the file GitHub Actions renders as the step
+// summary.
+const githubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+
+// validateBumpOutputFormat is validateOutputFormat for bump, which also
+// accepts the github format.
+func validateBumpOutputFormat(format string) error {
+	if format == outputGitHub {
+		return nil
+	}
+	if err := validateOutputFormat(format); err != nil {
+		return fmt.Errorf("unsupported output format %q (expected %s, %s or %s)", format, outputText, outputJSON, outputGitHub)
+	}
+	return nil
+}
+
+// githubWarnedSkips are the skip reasons annotated as warnings; the others
+// (up-to-date, pinned, deselected) are expected and not annotated.
+var githubWarnedSkips = map[string]bool{
+	skipNoMatch:        true,
+	skipPathFilter:     true,
+	skipInvalidVersion: true,
+}
+
+// writeGitHubAnnotations writes a ::notice workflow command for every change
+// in files and a ::warning for every match skipped for an unexpected reason,
+// anchored to the file when it is a local path.
+func writeGitHubAnnotations(w io.Writer, files []fileReport, dryRun bool) error {
+	verb := "Bumped"
+	if dryRun {
+		verb = "Would bump"
+	}
+	for _, f := range files {
+		props := ""
+		if f.File != stdioFile && !strings.Contains(f.File, "://") {
+			props = "file=" + githubEscapeProperty(f.File) + ","
+		}
+		where := ""
+		if f.Object != "" {
+			where = f.Object + " "
+		}
+		for _, c := range f.Changes {
+			if _, err := fmt.Fprintf(w, "::notice %stitle=%s::%s\n", props,
+				githubEscapeProperty(verb+" "+c.Image),
+				githubEscapeData(fmt.Sprintf("%s%s: %s → %s", where, c.Path, c.OldValue, c.NewValue))); err != nil {
+				return err
+			}
+		}
+		for _, m := range f.Skipped {
+			if !githubWarnedSkips[m.Reason] {
+				continue
+			}
+			message := fmt.Sprintf("%snot bumped to %s (%s)", where, m.Wanted, m.Reason)
+			if m.Path != "" {
+				message = fmt.Sprintf("%s%s: %s not bumped to %s (%s)", where, m.Path, m.Current, m.Wanted, m.Reason)
+			}
+			if _, err := fmt.Fprintf(w, "::warning %stitle=%s::%s\n", props,
+				githubEscapeProperty("Skipped "+m.Image), githubEscapeData(message)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeGitHubError writes err as an ::error workflow command.
+func writeGitHubError(w io.Writer, err error) {
+	fmt.Fprintf(w, "::error title=flux-helpers::%s\n", githubEscapeData(err.Error()))
+}
+
+// appendGitHubStepSummary appends the Markdown form of r to the step summary
+// file, if the run is a GitHub Actions step.
+func appendGitHubStepSummary(r *runReport) error {
+	path := os.Getenv(githubStepSummaryEnv)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	_, err = io.WriteString(f, r.markdown()+"\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	return nil
+}
+
+// githubEscapeData escapes the message of a workflow command.
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command.
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
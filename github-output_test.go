@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGitHubOutput verifies the workflow commands written for changes,
+// skipped matches and errors, and the step summary.
+func TestGitHubOutput(t *testing.T) {
+	files := []fileReport{
+		{
+			File:    "clusters/prod/my-app.yaml",
+			Changes: []tagChange{{Image: "ghcr.io/my-org/my-api", Path: "image.tag", OldValue: "1.7.0", NewValue: "1.8.0"}},
+			Skipped: []skippedMatch{
+				{Image: "ghcr.io/my-org/web", Wanted: "2.0.0", Reason: skipNoMatch},
+				{Image: "ghcr.io/my-org/my-api", Path: "canary.image.tag", Current: "1.8.0", Wanted: "1.8.0", Reason: skipUpToDate},
+			},
+		},
+		{File: "kube://prod", Object: "HelmRelease/my-app", Changes: []tagChange{{Image: "redis", Path: "redis.tag", OldValue: "7.0", NewValue: "7.2"}}},
+	}
+
+	var out bytes.Buffer
+	if err := writeGitHubAnnotations(&out, files, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "::notice file=clusters/prod/my-app.yaml,title=Would bump ghcr.io/my-org/my-api::image.tag: 1.7.0 → 1.8.0\n" +
+		"::warning file=clusters/prod/my-app.yaml,title=Skipped ghcr.io/my-org/web::not bumped to 2.0.0 (no-match)\n" +
+		"::notice title=Would bump redis::HelmRelease/my-app redis.tag: 7.0 → 7.2\n"
+	if out.String() != want {
+		t.Errorf("Unexpected annotations:\n%s", out.String())
+	}
+
+	out.Reset()
+	writeGitHubError(&out, errors.New("failed: 100%\nsee above"))
+	if got := out.String(); got != "::error title=flux-helpers::failed: 100%25%0Asee above\n" {
+		t.Errorf("Unexpected error annotation: %q", got)
+	}
+
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv(githubStepSummaryEnv, summary)
+	if err := appendGitHubStepSummary(newRunReport("bump", false, time.Now(), files, nil)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(summary)
+	if err != nil {
+		t.Fatalf("Failed to read step summary: %v", err)
+	}
+	if !strings.Contains(string(data), "| `clusters/prod/my-app.yaml` | `ghcr.io/my-org/my-api` | `image.tag` | `1.7.0` | `1.8.0` |") {
+		t.Errorf("Expected the change in the step summary, got:\n%s", data)
+	}
+
+	if err := validateBumpOutputFormat(outputGitHub); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateOutputFormat(outputGitHub); err == nil {
+		t.Errorf("Expected the github format to be specific to bump")
+	}
+}
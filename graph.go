@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+// Output formats of graph images besides text and json.
+const (
+	outputDOT     = "dot"
+	outputMermaid = "mermaid"
+)
+
+var (
+	graphFiles      []string
+	graphDir        string
+	graphImages     []string
+	graphEnvPattern string
+)
+
+// imageUse is a HelmRelease using an image at a tag.
+type imageUse struct {
+	Environment string `json:"environment"`
+	// Service is the name of the HelmRelease.
+	Service string `json:"service"`
+	File    string `json:"file"`
+	// Paths are the locations of the references, as listed by list images.
+	Paths []string `json:"paths"`
+	Tag   string   `json:"tag"`
+	// Behind is set when the tag is a lower version than the image's Latest.
+	Behind bool `json:"behind,omitempty"`
+}
+
+// imageUsage is an image with every HelmRelease using it, the blast radius of
+// a bump of the image.
+type imageUsage struct {
+	Image string `json:"image"`
+	// Latest is the highest version among the tags in use, if they are
+	// versions.
+	Latest string     `json:"latest,omitempty"`
+	Uses   []imageUse `json:"uses"`
+}
+
+// buildImageGraph groups refs by image and, within an image, by file and
+// tag, naming the environment and service of each file with namer. Uses of a
+// version tag lower than the highest one in use are marked Behind.
+//
+// Returns:
+//   - The images, sorted by name, with their uses sorted by environment and
+//     file.
+func buildImageGraph(refs []imageReference, namer *changelogNamer) []imageUsage {
+	type useKey struct{ image, file, tag string }
+	uses := map[useKey]*imageUse{}
+	byImage := map[string][]*imageUse{}
+	for _, ref := range refs {
+		key := useKey{ref.Image, ref.File, ref.Tag}
+		if use, ok := uses[key]; ok {
+			use.Paths = appendUnique(use.Paths, ref.Path)
+			continue
+		}
+		use := &imageUse{Environment: namer.environment(ref.File), Service: namer.service(ref.File), File: ref.File, Paths: []string{ref.Path}, Tag: ref.Tag}
+		uses[key] = use
+		byImage[ref.Image] = append(byImage[ref.Image], use)
+	}
+
+	graph := []imageUsage{}
+	for _, image := range sortedKeys(byImage) {
+		usage := imageUsage{Image: image}
+		var latest *semver.Version
+		for _, use := range byImage[image] {
+			if v := tagVersion(use.Tag); v != nil && (latest == nil || v.GreaterThan(latest)) {
+				latest = v
+				usage.Latest = use.Tag
+			}
+		}
+		for _, use := range byImage[image] {
+			if v := tagVersion(use.Tag); v != nil && latest != nil && v.LessThan(latest) {
+				use.Behind = true
+			}
+			usage.Uses = append(usage.Uses, *use)
+		}
+		sort.SliceStable(usage.Uses, func(i, j int) bool {
+			a, b := usage.Uses[i], usage.Uses[j]
+			if a.Environment != b.Environment {
+				return a.Environment < b.Environment
+			}
+			return a.File < b.File
+		})
+		graph = append(graph, usage)
+	}
+	return graph
+}
+
+// tagVersion parses an image tag, without a digest, as a semantic version, or
+// returns nil if it is not one.
+func tagVersion(tag string) *semver.Version {
+	tag, _, _ = strings.Cut(tag, "@")
+	if !isValidSemver(tag) {
+		return nil
+	}
+	v, err := semver.NewVersion(tag)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// filterImageGraph keeps the images matching one of patterns (path.Match
+// globs, e.g. ghcr.io/my-org/*); all images when patterns is empty.
+func filterImageGraph(graph []imageUsage, patterns []string) ([]imageUsage, error) {
+	if len(patterns) == 0 {
+		return graph, nil
+	}
+	filtered := []imageUsage{}
+	for _, usage := range graph {
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, usage.Image)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --image pattern %q: %w", pattern, err)
+			}
+			if ok {
+				filtered = append(filtered, usage)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// writeImageGraphTable prints graph as an aligned table, one row per use.
+func writeImageGraphTable(w io.Writer, graph []imageUsage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tENVIRONMENT\tSERVICE\tTAG\tSTATUS\tFILE")
+	for _, usage := range graph {
+		for _, use := range usage.Uses {
+			status := "-"
+			if use.Behind {
+				status = "behind " + usage.Latest
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", usage.Image, use.Environment, use.Service, use.Tag, status, use.File)
+		}
+	}
+	return tw.Flush()
+}
+
+// graphServices returns the files of the HelmReleases in graph, grouped by
+// environment, with the label of each file's node.
+func graphServices(graph []imageUsage) (map[string][]string, map[string]string) {
+	byEnv := map[string][]string{}
+	labels := map[string]string{}
+	for _, usage := range graph {
+		for _, use := range usage.Uses {
+			if _, ok := labels[use.File]; !ok {
+				labels[use.File] = use.Service
+				byEnv[use.Environment] = append(byEnv[use.Environment], use.File)
+			}
+		}
+	}
+	for _, files := range byEnv {
+		sort.Strings(files)
+	}
+	return byEnv, labels
+}
+
+// writeImageGraphDOT prints graph in the Graphviz DOT language: an ellipse
+// per image, linked to a box per HelmRelease, grouped in a cluster per
+// environment. Edges are labelled with the tag, and drawn red when the tag is
+// behind the latest version in use.
+func writeImageGraphDOT(w io.Writer, graph []imageUsage) {
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"` }
+	byEnv, labels := graphServices(graph)
+
+	fmt.Fprintln(w, "digraph images {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, usage := range graph {
+		label := usage.Image
+		if usage.Latest != "" {
+			label += "\\nlatest " + usage.Latest
+		}
+		fmt.Fprintf(w, "  %s [shape=ellipse, label=%s];\n", quote("image:"+usage.Image), quote(label))
+	}
+	for i, env := range sortedKeys(byEnv) {
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n    label=%s;\n", i, quote(env))
+		for _, file := range byEnv[env] {
+			fmt.Fprintf(w, "    %s [label=%s, tooltip=%s];\n", quote(file), quote(labels[file]), quote(file))
+		}
+		fmt.Fprintln(w, "  }")
+	}
+	for _, usage := range graph {
+		for _, use := range usage.Uses {
+			attrs := "label=" + quote(use.Tag)
+			if use.Behind {
+				attrs += ", color=red, fontcolor=red"
+			}
+			fmt.Fprintf(w, "  %s -> %s [%s];\n", quote("image:"+usage.Image), quote(use.File), attrs)
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// writeImageGraphMermaid prints graph as a Mermaid flowchart, laid out like
+// the DOT graph, for rendering in Markdown on GitHub or GitLab.
+func writeImageGraphMermaid(w io.Writer, graph []imageUsage) {
+	label := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"` }
+	byEnv, labels := graphServices(graph)
+
+	fmt.Fprintln(w, "flowchart LR")
+	imageIDs := map[string]string{}
+	for i, usage := range graph {
+		imageIDs[usage.Image] = fmt.Sprintf("img%d", i)
+		text := usage.Image
+		if usage.Latest != "" {
+			text += "<br/>latest " + usage.Latest
+		}
+		fmt.Fprintf(w, "  %s([%s])\n", imageIDs[usage.Image], label(text))
+	}
+	fileIDs := map[string]string{}
+	for i, env := range sortedKeys(byEnv) {
+		fmt.Fprintf(w, "  subgraph env%d[%s]\n", i, label(env))
+		for _, file := range byEnv[env] {
+			fileIDs[file] = fmt.Sprintf("hr%d", len(fileIDs))
+			fmt.Fprintf(w, "    %s[%s]\n", fileIDs[file], label(labels[file]))
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	var behind []string
+	edge := 0
+	for _, usage := range graph {
+		for _, use := range usage.Uses {
+			fmt.Fprintf(w, "  %s -->|%s| %s\n", imageIDs[usage.Image], label(use.Tag), fileIDs[use.File])
+			if use.Behind {
+				behind = append(behind, fmt.Sprint(edge))
+			}
+			edge++
+		}
+	}
+	if len(behind) > 0 {
+		fmt.Fprintf(w, "  linkStyle %s stroke:red,color:red\n", strings.Join(behind, ","))
+	}
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Graph the relations between the manifests of a GitOps repository",
+}
+
+var graphImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Map every image to the HelmReleases and environments using it",
+	Long: `Build a graph of every image referenced by the HelmReleases of a repository
+and the services and environments using it, to see the blast radius of a bump
+and spot environments stuck on old versions.
+
+The environment of a manifest is the first capture group of --env-pattern
+(by default the directory after clusters/, environments/, envs/ or env/), or
+the name of its directory. Uses of a version tag lower than the highest one in
+use are marked as behind.
+
+The graph is printed as a table, as JSON, or for rendering with Graphviz
+(-o dot) or Mermaid (-o mermaid).`,
+	Example: `  flux-helpers graph images --dir .
+  flux-helpers graph images --dir clusters --image 'ghcr.io/my-org/*' -o dot | dot -Tsvg > images.svg
+  flux-helpers graph images --dir . -o mermaid`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(graphFiles) == 0 && graphDir == "" {
+			return fmt.Errorf("--file or --dir is required")
+		}
+		switch outputFormat {
+		case outputText, outputJSON, outputDOT, outputMermaid:
+		default:
+			return fmt.Errorf("unsupported output format %q (expected %s, %s, %s or %s)", outputFormat, outputText, outputJSON, outputDOT, outputMermaid)
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		namer, err := newChangelogNamer(graphEnvPattern, os.ReadFile)
+		if err != nil {
+			return err
+		}
+
+		files, err := expandFileGlobs(graphFiles)
+		if err != nil {
+			return err
+		}
+		if graphDir != "" {
+			found, err := helmReleaseFilesInDir(graphDir)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", graphDir, err)
+			}
+			for _, f := range found {
+				files = appendUnique(files, f)
+			}
+		}
+
+		// stdout carries the graph.
+		logOut = os.Stderr
+		var refs []imageReference
+		bar := startProgress("graph images", "file", len(files))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			fileRefs, err := listImageReferences(file, data, matchers)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			refs = append(refs, fileRefs...)
+			bar.Increment()
+		}
+		bar.Done()
+
+		graph, err := filterImageGraph(buildImageGraph(refs, namer), graphImages)
+		if err != nil {
+			return err
+		}
+		switch outputFormat {
+		case outputJSON:
+			return writeJSON(os.Stdout, graph)
+		case outputDOT:
+			writeImageGraphDOT(os.Stdout, graph)
+		case outputMermaid:
+			writeImageGraphMermaid(os.Stdout, graph)
+		default:
+			return writeImageGraphTable(os.Stdout, graph)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := graphImagesCmd.Flags()
+	flags.StringArrayVarP(&graphFiles, "file", "f", nil, "HelmRelease YAML file(s) to include; globs are expanded (repeatable)")
+	flags.StringVar(&graphDir, "dir", "", "Include every HelmRelease YAML file below this directory")
+	flags.StringArrayVar(&graphImages, "image", nil, "Only graph images matching this name or glob, e.g. ghcr.io/my-org/* (repeatable)")
+	flags.StringVar(&graphEnvPattern, "env-pattern", defaultEnvironmentPattern, "Regular expression whose first capture group is the environment of a manifest path")
+	flags.StringVarP(&outputFormat, "output", "o", outputText, "Output format: text (a table), json, dot (Graphviz) or mermaid")
+	flags.StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	graphCmd.AddCommand(graphImagesCmd)
+	rootCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestBuildImageGraph verifies that references are grouped per image, file
+// and tag, and that uses of older versions are marked as behind.
+func TestBuildImageGraph(t *testing.T) {
+	refs := []imageReference{
+		{File: "clusters/prod/api.yaml", Path: "image", Image: "ghcr.io/my-org/api", Tag: "1.2.0"},
+		{File: "clusters/prod/api.yaml", Path: "migrations.image", Image: "ghcr.io/my-org/api", Tag: "1.2.0"},
+		{File: "clusters/staging/api.yaml", Path: "image", Image: "ghcr.io/my-org/api", Tag: "1.10.0@sha256:abc"},
+		{File: "clusters/dev/api.yaml", Path: "image", Image: "ghcr.io/my-org/api", Tag: "main"},
+		{File: "clusters/prod/web.yaml", Path: "image", Image: "nginx", Tag: "stable"},
+	}
+	namer, err := newChangelogNamer(defaultEnvironmentPattern, func(string) ([]byte, error) { return nil, errors.New("not read") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := buildImageGraph(refs, namer)
+	if len(graph) != 2 || graph[0].Image != "ghcr.io/my-org/api" || graph[1].Image != "nginx" {
+		t.Fatalf("Unexpected graph: %+v", graph)
+	}
+
+	api := graph[0]
+	if api.Latest != "1.10.0@sha256:abc" || len(api.Uses) != 3 {
+		t.Fatalf("Unexpected usage of the api image: %+v", api)
+	}
+	var envs []string
+	for _, use := range api.Uses {
+		envs = append(envs, use.Environment)
+	}
+	if strings.Join(envs, ",") != "dev,prod,staging" {
+		t.Errorf("Expected the uses sorted by environment, got %v", envs)
+	}
+	dev, prod, staging := api.Uses[0], api.Uses[1], api.Uses[2]
+	if dev.Behind || !prod.Behind || staging.Behind {
+		t.Errorf("Expected only prod to be behind, got %+v", api.Uses)
+	}
+	if len(prod.Paths) != 2 || prod.Service != "api" {
+		t.Errorf("Expected one prod use of service api with both paths, got %+v", prod)
+	}
+	if graph[1].Latest != "" || graph[1].Uses[0].Behind {
+		t.Errorf("Expected no latest version for non-version tags, got %+v", graph[1])
+	}
+
+	filtered, err := filterImageGraph(graph, []string{"ghcr.io/my-org/*"})
+	if err != nil || len(filtered) != 1 || filtered[0].Image != "ghcr.io/my-org/api" {
+		t.Errorf("Expected only the api image with --image, got %+v, %v", filtered, err)
+	}
+}
+
+// TestWriteImageGraph verifies the DOT and Mermaid renderings.
+func TestWriteImageGraph(t *testing.T) {
+	graph := []imageUsage{{
+		Image:  "ghcr.io/my-org/api",
+		Latest: "1.3.0",
+		Uses: []imageUse{
+			{Environment: "prod", Service: "api", File: "clusters/prod/api.yaml", Tag: "1.2.0", Behind: true},
+			{Environment: "staging", Service: "api", File: "clusters/staging/api.yaml", Tag: "1.3.0"},
+		},
+	}}
+
+	var dot bytes.Buffer
+	writeImageGraphDOT(&dot, graph)
+	for _, want := range []string{
+		`"image:ghcr.io/my-org/api" [shape=ellipse, label="ghcr.io/my-org/api\nlatest 1.3.0"];`,
+		"subgraph cluster_0 {\n    label=\"prod\";\n    \"clusters/prod/api.yaml\" [label=\"api\"",
+		`"image:ghcr.io/my-org/api" -> "clusters/prod/api.yaml" [label="1.2.0", color=red, fontcolor=red];`,
+		`"image:ghcr.io/my-org/api" -> "clusters/staging/api.yaml" [label="1.3.0"];`,
+	} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected %q in the DOT graph:\n%s", want, dot.String())
+		}
+	}
+
+	var mermaid bytes.Buffer
+	writeImageGraphMermaid(&mermaid, graph)
+	want := `flowchart LR
+  img0(["ghcr.io/my-org/api<br/>latest 1.3.0"])
+  subgraph env0["prod"]
+    hr0["api"]
+  end
+  subgraph env1["staging"]
+    hr1["api"]
+  end
+  img0 -->|"1.2.0"| hr0
+  img0 -->|"1.3.0"| hr1
+  linkStyle 0 stroke:red,color:red
+`
+	if mermaid.String() != want {
+		t.Errorf("Expected the Mermaid graph:\n%s\ngot:\n%s", want, mermaid.String())
+	}
+}
@@ -1,26 +1,44 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"helm.sh/helm/v3/pkg/chart/loader"
-	"helm.sh/helm/v3/pkg/chartutil"
-	"helm.sh/helm/v3/pkg/engine"
-	"os"
-	"path/filepath"
-	"sigs.k8s.io/yaml"
+	"path"
 	"strings"
 )
 
-// InjectImagePullSecrets injects an optional imagePullSecrets configuration into a Helm chart's deployment.yaml
-// template and ensures the corresponding field exists in the chart's values.yaml file.
+// defaultPullSecretValuesKey is the values.yaml key that holds the pull secret name.
+const defaultPullSecretValuesKey = "image.imagePullSecret"
+
+// defaultInjectTemplates selects the chart templates that are injected into
+// when no --template is given.
+var defaultInjectTemplates = []string{"*deployment.yaml", "*statefulset.yaml", "*daemonset.yaml", "*job.yaml"}
+
+// injectOptions controls InjectImagePullSecrets-style chart mutations.
+type injectOptions struct {
+	// ValuesKey is the dotted values.yaml key holding the pull secret name.
+	ValuesKey string
+	// Templates are glob patterns selecting the templates to inject into. A
+	// pattern is matched against both the template path within the chart
+	// (e.g. "templates/deployment.yaml") and its base name.
+	Templates []string
+	// DryRun computes the changes without writing any file.
+	DryRun bool
+	// Diff prints a unified diff of every file that changes.
+	Diff bool
+	// ShowRender prints the rendered manifests of the changed templates.
+	ShowRender bool
+}
+
+// InjectImagePullSecrets injects an optional imagePullSecrets configuration into a Helm chart's workload
+// templates (deployment.yaml, statefulset.yaml, daemonset.yaml, job.yaml and cronjob.yaml) and ensures the
+// corresponding field exists in the chart's values.yaml file.
 //
 // This function performs the following steps:
-// 1. Loads the Helm chart from the specified directory.
-// 2. Searches for the deployment.yaml template in the chart and injects a conditional block for imagePullSecrets
-//    under the `spec` section if it doesn't already exist.
-// 3. Ensures the `image.imagePullSecret` field exists in the chart's values.yaml file, adding it if necessary.
-// 4. Renders the chart with the updated values for preview purposes.
+//  1. Loads the Helm chart from the specified directory.
+//  2. Searches for the workload templates in the chart and injects a conditional block for imagePullSecrets
+//     into their pod spec (spec.jobTemplate.spec.template.spec for CronJobs) if it doesn't already exist.
+//  3. Ensures the `image.imagePullSecret` field exists in the chart's values.yaml file, adding it if necessary.
+//  4. Renders the chart with the updated values to check that it still renders.
 //
 // Parameters:
 //   - chartDir: The path to the Helm chart directory.
@@ -29,112 +47,81 @@ import (
 //   - An error if any step fails, or nil if the operation completes successfully.
 //
 // Example usage:
-//   err := InjectImagePullSecrets("/path/to/chart")
-//   if err != nil {
-//       log.Fatalf("Failed to inject imagePullSecrets: %v", err)
-//   }
+//
+//	err := InjectImagePullSecrets("/path/to/chart")
+//	if err != nil {
+//	    log.Fatalf("Failed to inject imagePullSecrets: %v", err)
+//	}
 func InjectImagePullSecrets(chartDir string) error {
-	// Step 1: Load the chart
-	ch, err := loader.Load(chartDir)
-	if err != nil {
-		return fmt.Errorf("failed to load chart at %s: %w", chartDir, err)
-	}
-
-	// Step 2: Inject conditional into deployment.yaml
-	for _, tmpl := range ch.Templates {
-		if strings.Contains(tmpl.Name, "deployment.yaml") {
-			fmt.Printf("🔧 Injecting imagePullSecrets into %s\n", tmpl.Name)
-
-			lines := strings.Split(string(tmpl.Data), "\n")
-			var buf bytes.Buffer
-			injected := false
-			insideTemplate := false
+	_, err := injectImagePullSecrets(chartDir, injectOptions{})
+	return err
+}
 
-			for _, line := range lines {
-				buf.WriteString(line + "\n")
-				trimmed := strings.TrimSpace(line)
+// injectImagePullSecrets is InjectImagePullSecrets with the full set of
+// injectOptions. Empty ValuesKey and Templates fall back to
+// defaultPullSecretValuesKey and defaultInjectTemplates. It reports whether
+// any file changed.
+func injectImagePullSecrets(chartDir string, opts injectOptions) (bool, error) {
+	if opts.ValuesKey == "" {
+		opts.ValuesKey = defaultPullSecretValuesKey
+	}
+	if len(opts.Templates) == 0 {
+		opts.Templates = defaultInjectTemplates
+	}
+	if _, err := splitValuesKey(opts.ValuesKey); err != nil {
+		return false, err
+	}
 
-				if strings.HasPrefix(trimmed, "template:") {
-					insideTemplate = true
-					continue
-				}
+	spec := pullSecretsInjection(opts.ValuesKey, opts.Templates)
+	return injectChart(chartDir, []injectionSpec{spec}, chartInjectOptions{DryRun: opts.DryRun, Diff: opts.Diff, ShowRender: opts.ShowRender})
+}
 
-				// Only inject after entering template and finding its `spec:`
-				if insideTemplate && trimmed == "spec:" && !injected {
-					buf.WriteString(`      {{- if .Values.image.imagePullSecret }}
-      imagePullSecrets:
-        - name: {{ .Values.image.imagePullSecret }}
-      {{- end }}
-`)
-					injected = true
-				}
+// templateSelected reports whether the chart template name (e.g.
+// "templates/deployment.yaml") matches any of the glob patterns, either as a
+// whole or by base name.
+func templateSelected(name string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		for _, candidate := range []string{name, path.Base(name)} {
+			ok, err := path.Match(pattern, candidate)
+			if err != nil {
+				return false, fmt.Errorf("invalid template pattern %q: %w", pattern, err)
 			}
-
-			tmpl.Data = buf.Bytes()
-			outPath := filepath.Join(chartDir, tmpl.Name)
-			if err := os.WriteFile(outPath, tmpl.Data, 0644); err != nil {
-				return fmt.Errorf("failed to write updated deployment.yaml: %w", err)
+			if ok {
+				return true, nil
 			}
-			fmt.Printf("💾 Wrote updated deployment.yaml to %s\n", outPath)
 		}
 	}
+	return false, nil
+}
 
-	// Step 3: Ensure image.imagePullSecret in values.yaml
-	valuesPath := filepath.Join(chartDir, "values.yaml")
-	rawVals, err := os.ReadFile(valuesPath)
-	if err != nil {
-		return fmt.Errorf("failed to read values.yaml: %w", err)
-	}
-
-	var values map[string]interface{}
-	if err := yaml.Unmarshal(rawVals, &values); err != nil {
-		return fmt.Errorf("invalid YAML in values.yaml: %w", err)
-	}
-
-	imageBlock, ok := values["image"].(map[string]interface{})
-	if !ok {
-		imageBlock = make(map[string]interface{})
-	}
-
-	if _, exists := imageBlock["imagePullSecret"]; !exists {
-		fmt.Println("🔧 Adding image.imagePullSecret to values.yaml")
-		imageBlock["imagePullSecret"] = ""
-		values["image"] = imageBlock
-
-		updated, err := yaml.Marshal(values)
-		if err != nil {
-			return fmt.Errorf("failed to marshal updated values.yaml: %w", err)
+// ensureValuesKey makes sure the nested key described by keyPath exists in
+// values, creating intermediate maps and setting the leaf to defaultValue as
+// needed.
+//
+// Returns:
+//   - Whether values was modified.
+//   - An error if an intermediate key exists but does not hold a map.
+func ensureValuesKey(values map[string]interface{}, keyPath []string, defaultValue interface{}) (bool, error) {
+	node := values
+	for i, key := range keyPath[:len(keyPath)-1] {
+		existing, exists := node[key]
+		if !exists || existing == nil {
+			child := map[string]interface{}{}
+			node[key] = child
+			node = child
+			continue
 		}
-
-		if err := os.WriteFile(valuesPath, updated, 0644); err != nil {
-			return fmt.Errorf("failed to write values.yaml: %w", err)
+		child, ok := existing.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s is not a map", strings.Join(keyPath[:i+1], "."))
 		}
-	} else {
-		fmt.Println("✅ image.imagePullSecret already exists in values.yaml")
+		node = child
 	}
 
-	// Step 4: Render chart with values for preview
-	valsMerged, err := chartutil.ToRenderValues(ch, values, chartutil.ReleaseOptions{
-		Name:      "test-release",
-		Namespace: "default",
-	}, nil)
-	if err != nil {
-		return fmt.Errorf("failed to prepare render values: %w", err)
+	leaf := keyPath[len(keyPath)-1]
+	if _, exists := node[leaf]; exists {
+		return false, nil
 	}
-
-	rendered, err := engine.Render(ch, valsMerged)
-	if err != nil {
-		return fmt.Errorf("failed to render chart: %w", err)
-	}
-
-	fmt.Println("\n🖨️ Rendered Manifest (excerpt):")
-	for name, content := range rendered {
-		if strings.Contains(name, "deployment.yaml") {
-			fmt.Printf("\n--- %s ---\n%s\n", name, content)
-		}
-	}
-
-	fmt.Println("✅ Injection complete.")
-	return nil
+	node[leaf] = defaultValue
+	return true, nil
 }
-
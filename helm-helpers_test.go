@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyTestChart copies test_files/test_chart into a temporary directory with
+// the imagePullSecrets block removed from its deployment template, so tests
+// can inject into it without touching the fixture.
+func copyTestChart(t *testing.T) string {
+	t.Helper()
+	src := filepath.Join("test_files", "test_chart")
+	dir := filepath.Join(t.TempDir(), "chart")
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if rel == filepath.Join("templates", "deployment.yaml") {
+			var kept []string
+			for _, line := range strings.Split(string(data), "\n") {
+				if !strings.Contains(line, "imagePullSecret") && !strings.Contains(line, "{{- end }}") {
+					kept = append(kept, line)
+				}
+			}
+			data = []byte(strings.Join(kept, "\n"))
+		}
+		return os.WriteFile(filepath.Join(dir, rel), data, 0644)
+	})
+	if err != nil {
+		t.Fatalf("Failed to copy test chart: %v", err)
+	}
+	return dir
+}
+
+// TestInjectImagePullSecretsDryRun verifies that a dry-run leaves the chart
+// untouched.
+func TestInjectImagePullSecretsDryRun(t *testing.T) {
+	dir := copyTestChart(t)
+	deployment := filepath.Join(dir, "templates", "deployment.yaml")
+	before, _ := os.ReadFile(deployment)
+	beforeValues, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+
+	_, err := injectImagePullSecrets(dir, injectOptions{ValuesKey: "global.pullSecret", DryRun: true, Diff: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	after, _ := os.ReadFile(deployment)
+	afterValues, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if string(before) != string(after) || string(beforeValues) != string(afterValues) {
+		t.Errorf("Expected dry-run to leave the chart untouched")
+	}
+}
+
+// TestInjectImagePullSecretsValuesKey verifies that a custom values key is used
+// both in the injected block and in values.yaml, and that templates not
+// selected by --template are left alone.
+func TestInjectImagePullSecretsValuesKey(t *testing.T) {
+	dir := copyTestChart(t)
+	if _, err := injectImagePullSecrets(dir, injectOptions{ValuesKey: "global.pullSecret"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	deployment, _ := os.ReadFile(filepath.Join(dir, "templates", "deployment.yaml"))
+	if !strings.Contains(string(deployment), "- name: {{ .Values.global.pullSecret }}") {
+		t.Errorf("Expected block referencing .Values.global.pullSecret, got:\n%s", deployment)
+	}
+	values, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if !strings.Contains(string(values), "global:\n  pullSecret: \"\"") {
+		t.Errorf("Expected global.pullSecret in values.yaml, got:\n%s", values)
+	}
+
+	other := copyTestChart(t)
+	before, _ := os.ReadFile(filepath.Join(other, "templates", "deployment.yaml"))
+	if _, err := injectImagePullSecrets(other, injectOptions{Templates: []string{"statefulset.yaml"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(other, "templates", "deployment.yaml"))
+	if string(before) != string(after) {
+		t.Errorf("Expected unselected template to be left untouched")
+	}
+}
+
+// TestInjectImagePullSecretsIdempotent verifies that injecting into a chart
+// that already has the block leaves its templates untouched.
+func TestInjectImagePullSecretsIdempotent(t *testing.T) {
+	dir := copyTestChart(t)
+	if _, err := injectImagePullSecrets(dir, injectOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deployment := filepath.Join(dir, "templates", "deployment.yaml")
+	first, _ := os.ReadFile(deployment)
+
+	if _, err := injectImagePullSecrets(dir, injectOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, _ := os.ReadFile(deployment)
+	if string(first) != string(second) {
+		t.Errorf("Expected second run to leave the template untouched, got:\n%s", second)
+	}
+	if strings.Count(string(second), "imagePullSecrets:") != 1 {
+		t.Errorf("Expected exactly one imagePullSecrets block, got:\n%s", second)
+	}
+}
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+// TestInjectImagePullSecretsShowRender verifies that a dry-run diff shows
+// only the template and values.yaml diffs, and that the rendered manifests
+// are printed with ShowRender.
+func TestInjectImagePullSecretsShowRender(t *testing.T) {
+	dir := copyTestChart(t)
+	var err error
+	out := captureStdout(t, func() {
+		_, err = injectImagePullSecrets(dir, injectOptions{ValuesKey: "global.pullSecret", DryRun: true, Diff: true})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "+++ b/templates/deployment.yaml") || !strings.Contains(out, "+++ b/values.yaml") {
+		t.Errorf("Expected template and values diffs, got:\n%s", out)
+	}
+	if strings.Contains(out, "Rendered Manifest") {
+		t.Errorf("Expected no rendered manifests without ShowRender, got:\n%s", out)
+	}
+
+	out = captureStdout(t, func() {
+		_, err = injectImagePullSecrets(dir, injectOptions{DryRun: true, ShowRender: true})
+	})
+	if err != nil || !strings.Contains(out, "--- test-chart/templates/deployment.yaml ---") {
+		t.Errorf("Expected the rendered deployment with ShowRender, got %v:\n%s", err, out)
+	}
+}
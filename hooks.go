@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Environment variables a post-bump hook is run with.
+const (
+	// hookChangedFilesEnv lists the changed files, one per line.
+	hookChangedFilesEnv = "FLUX_HELPERS_HOOK_CHANGED_FILES"
+	// hookReportEnv is the path of a file holding the JSON report of the
+	// run, which is also written to the hook's stdin. It is not named
+	// FLUX_HELPERS_REPORT, which sets --report of a bump the hook runs.
+	hookReportEnv = "FLUX_HELPERS_HOOK_REPORT"
+)
+
+// postHooks are the --post-hook commands of bump.
+var postHooks []string
+
+// hookShell returns the shell command line that runs hook.
+func hookShell(hook string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", hook}
+	}
+	return []string{"sh", "-c", hook}
+}
+
+// runPostHooks runs each hook in order with the shell after a bump changed
+// files, for checks such as `kustomize build ./overlay | kubeconform` or to
+// regenerate derived files. Every hook gets the JSON report of the run on
+// stdin and in the file named by $FLUX_HELPERS_HOOK_REPORT, and the changed
+// files in $FLUX_HELPERS_HOOK_CHANGED_FILES. Its output is logged; a hook that
+// fails stops the run.
+//
+// Parameters:
+//   - ctx: Cancels a running hook.
+//   - hooks: The shell commands to run.
+//   - report: The report of the bump.
+//
+// Returns:
+//   - An error naming the first hook that fails, with its output.
+func runPostHooks(ctx context.Context, hooks []string, report *bumpReport) error {
+	changed := changedFiles(report.Files)
+	if len(hooks) == 0 || len(changed) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report for hooks: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "flux-helpers-hook-")
+	if err != nil {
+		return fmt.Errorf("failed to write report for hooks: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	reportFile := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(reportFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write report for hooks: %w", err)
+	}
+
+	for _, hook := range hooks {
+		logf("🪝 Running post-bump hook: %s\n", hook)
+		shell := hookShell(hook)
+		cmd := exec.CommandContext(ctx, shell[0], shell[1:]...)
+		cmd.Env = append(os.Environ(),
+			hookChangedFilesEnv+"="+strings.Join(changed, "\n"),
+			hookReportEnv+"="+reportFile)
+		cmd.Stdin = bytes.NewReader(data)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err := cmd.Run()
+		if out := strings.TrimSpace(output.String()); out != "" {
+			logln(out)
+		}
+		if err != nil {
+			return fmt.Errorf("post-bump hook %q failed: %w", hook, err)
+		}
+	}
+	return nil
+}
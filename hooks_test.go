@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestRunPostHooks verifies that hooks get the changed files and the report,
+// and that a failing hook stops the run.
+func TestRunPostHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks of this test use sh")
+	}
+	out := filepath.Join(t.TempDir(), "hook.out")
+	report := &bumpReport{Files: []fileReport{
+		{File: "apps/a.yaml", Updated: 1, Changes: []tagChange{{Image: "ghcr.io/my-org/my-api", Path: "image.tag", OldValue: "1.0.0", NewValue: "1.1.0"}}},
+		{File: "apps/b.yaml"},
+	}}
+	hooks := []string{
+		`echo "$FLUX_HELPERS_HOOK_CHANGED_FILES" > ` + out,
+		`grep -c '"newValue": "1.1.0"' >> ` + out + ` && grep -q image.tag "$FLUX_HELPERS_HOOK_REPORT"`,
+	}
+	if err := runPostHooks(context.Background(), hooks, report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if string(got) != "apps/a.yaml\n1\n" {
+		t.Errorf("Unexpected hook output %q", got)
+	}
+
+	err := runPostHooks(context.Background(), []string{"exit 3", "touch " + out + ".never"}, report)
+	if err == nil || !strings.Contains(err.Error(), `"exit 3"`) {
+		t.Errorf("Expected the failing hook to be reported, got: %v", err)
+	}
+	if _, err := os.Stat(out + ".never"); err == nil {
+		t.Error("Expected the hooks after a failure not to run")
+	}
+
+	if err := runPostHooks(context.Background(), []string{"exit 1"}, &bumpReport{}); err != nil {
+		t.Errorf("Expected no hook to run without changes, got: %v", err)
+	}
+}
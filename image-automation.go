@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// imageAPIVersion is the API version of the image-reflector-controller
+// objects written by `new image-automation`.
+const imageAPIVersion = "image.toolkit.fluxcd.io/v1beta2"
+
+// imagePolicyKinds are the ImagePolicy policies `new image-automation` can
+// write.
+var imagePolicyKinds = []string{"semver", "numerical", "alphabetical"}
+
+// Values of --image-policy-markers: what bump does with references that
+// carry an $imagepolicy marker.
+const (
+	// imagePolicySkip leaves them to the image-automation-controller.
+	imagePolicySkip = "skip"
+	// imagePolicyUpdate bumps them anyway, keeping the marker.
+	imagePolicyUpdate = "update"
+)
+
+var (
+	imagePolicyMode = imagePolicySkip
+
+	automationFile         string
+	automationPolicy       string
+	automationRange        string
+	automationWriteMarkers bool
+)
+
+// imageAutomationScaffold describes the ImageRepository and ImagePolicy
+// objects written by `new image-automation` for every image of a
+// HelmRelease.
+type imageAutomationScaffold struct {
+	Namespace string
+	Interval  string
+	// Policy is semver, numerical or alphabetical.
+	Policy string
+	// Range is the semver range of the semver policy. It defaults to
+	// ">=<current tag>", so only newer versions are selected.
+	Range string
+}
+
+// imagePolicyMarker is the Flux image automation setter comment for the
+// scalar at Path (a .spec.values path) that currently holds Value.
+type imagePolicyMarker struct {
+	Path  string
+	Value string
+	// Policy is the marker reference: "namespace:policy" for a "repo:tag"
+	// string, or "namespace:policy:tag" for the tag of an image block.
+	Policy string
+}
+
+// comment returns the marker as written after the scalar.
+func (m imagePolicyMarker) comment() string {
+	return fmt.Sprintf(`{"$imagepolicy": "%s"}`, m.Policy)
+}
+
+// imagePolicyModeFlag is the value of --image-policy-markers.
+type imagePolicyModeFlag struct {
+	mode *string
+}
+
+func (f *imagePolicyModeFlag) String() string {
+	if f.mode == nil {
+		return imagePolicySkip
+	}
+	return *f.mode
+}
+
+func (f *imagePolicyModeFlag) Set(s string) error {
+	if s != imagePolicySkip && s != imagePolicyUpdate {
+		return fmt.Errorf("expected %s or %s", imagePolicySkip, imagePolicyUpdate)
+	}
+	*f.mode = s
+	return nil
+}
+
+func (f *imagePolicyModeFlag) Type() string {
+	return "string"
+}
+
+// imagePolicyMarkerPattern matches a Flux image automation setter comment
+// and captures its policy reference.
+var imagePolicyMarkerPattern = regexp.MustCompile(`\{\s*"\$imagepolicy"\s*:\s*"([^"]+)"\s*\}`)
+
+// imagePolicyOf returns the policy reference of the first marker in
+// comments, or "".
+func imagePolicyOf(comments ...string) string {
+	for _, c := range comments {
+		if m := imagePolicyMarkerPattern.FindStringSubmatch(c); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// imagePolicyMarkers records which image references of a values tree carry
+// an $imagepolicy marker, and are therefore updated by the
+// image-automation-controller. Like ignoreMarkers, maps are identified by
+// their address.
+type imagePolicyMarkers struct {
+	// blocks are maps with a marked scalar, e.g. the tag of an image block.
+	blocks map[uintptr]string
+	// keys are marked scalars, e.g. a "repository:tag" string.
+	keys map[ignoredKey]string
+}
+
+// findImagePolicyMarkers collects the $imagepolicy markers after the scalars
+// of the values found at the node that locate returns for the root of the
+// YAML data, mapped onto values. It returns nil if there are none.
+func findImagePolicyMarkers(data []byte, values map[string]interface{}, locate func(root *yamlv3.Node) *yamlv3.Node) *imagePolicyMarkers {
+	if !strings.Contains(string(data), "$imagepolicy") {
+		return nil
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	m := &imagePolicyMarkers{blocks: map[uintptr]string{}, keys: map[ignoredKey]string{}}
+	m.collect(locate(yamlDocumentRoot(&doc)), values)
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return m
+}
+
+// collect walks node together with its decoded value and records the
+// markers found.
+func (m *imagePolicyMarkers) collect(node *yamlv3.Node, value interface{}) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node.Kind != yamlv3.MappingNode {
+			return
+		}
+		addr := reflect.ValueOf(v).Pointer()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, child := node.Content[i], node.Content[i+1]
+			childValue, ok := v[key.Value]
+			if !ok {
+				continue
+			}
+			if child.Kind == yamlv3.ScalarNode {
+				if policy := imagePolicyOf(child.LineComment, key.LineComment); policy != "" {
+					m.blocks[addr] = policy
+					m.keys[ignoredKey{parent: addr, key: key.Value}] = policy
+				}
+				continue
+			}
+			m.collect(child, childValue)
+		}
+	case []interface{}:
+		if node.Kind != yamlv3.SequenceNode || len(node.Content) != len(v) {
+			return
+		}
+		for i, item := range v {
+			m.collect(node.Content[i], item)
+		}
+	}
+}
+
+// policy returns the policy reference of the marker on the image reference
+// match, or "". A nil imagePolicyMarkers has no markers.
+func (m *imagePolicyMarkers) policy(match imageMatch) string {
+	if m == nil {
+		return ""
+	}
+	if match.Block != nil {
+		return m.blocks[reflect.ValueOf(match.Block).Pointer()]
+	}
+	if match.Parent != nil {
+		return m.keys[ignoredKey{parent: reflect.ValueOf(match.Parent).Pointer(), key: match.Key}]
+	}
+	return ""
+}
+
+// invalidNameChars matches runs of characters not allowed in object names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// imagePolicyName derives an object name from the last segment of repo,
+// e.g. "my-api" for ghcr.io/my-org/my-api, made unique among used.
+func imagePolicyName(repo string, used map[string]bool) string {
+	base := repo[strings.LastIndex(repo, "/")+1:]
+	base = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if base == "" {
+		base = "image"
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[name] = true
+	return name
+}
+
+// GenerateImageAutomation returns an ImageRepository and an ImagePolicy for
+// every image repository referenced in the .spec.values of the HelmRelease
+// YAML data, and the marker comments that let the image-automation-controller
+// update the references. Images whose tag is not a version are skipped with a
+// warning unless the policy does not need one (a --range is given, or the
+// policy is numerical or alphabetical).
+//
+// Parameters:
+//   - data: The HelmRelease manifest.
+//   - s: The namespace, interval and policy of the generated objects.
+//   - matchers: The image matchers to find references with.
+//
+// Returns:
+//   - The ImageRepository and ImagePolicy objects, in pairs.
+//   - The marker comments for the references of the generated policies.
+//   - An error if s is invalid or the manifest cannot be parsed.
+func GenerateImageAutomation(data []byte, s imageAutomationScaffold, matchers []imageMatcher) ([]map[string]interface{}, []imagePolicyMarker, error) {
+	if _, err := parseScaffoldInterval(s.Interval); err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(imagePolicyKinds, s.Policy) {
+		return nil, nil, fmt.Errorf("unsupported --policy %q (expected %s)", s.Policy, strings.Join(imagePolicyKinds, ", "))
+	}
+	if s.Range != "" {
+		if s.Policy != "semver" {
+			return nil, nil, fmt.Errorf("--range only applies to --policy semver")
+		}
+		if _, err := semver.NewConstraint(s.Range); err != nil {
+			return nil, nil, fmt.Errorf("invalid --range %q: %w", s.Range, err)
+		}
+	}
+
+	type reference struct {
+		path, value, tag string
+		block            bool
+	}
+	var repos []string
+	refs := map[string][]reference{}
+	_, err := rewriteHelmReleaseValues(data, func(values map[string]interface{}, _ *postRendererView) error {
+		for _, repo := range collectImageRepositories(values, matchers) {
+			for _, m := range findImageBlocks(values, repo, matchers) {
+				ref := reference{path: m.Path, value: m.Value, tag: strings.TrimPrefix(m.Value, repo+":")}
+				if m.Block != nil {
+					tag := fmt.Sprint(m.Block[m.TagKey])
+					ref = reference{path: joinValuesPath(m.Path, m.TagKey), value: tag, tag: tag, block: true}
+				}
+				if _, ok := refs[repo]; !ok {
+					repos = append(repos, repo)
+				}
+				refs[repo] = append(refs[repo], ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var objects []map[string]interface{}
+	var markers []imagePolicyMarker
+	used := map[string]bool{}
+	for _, repo := range repos {
+		var policy map[string]interface{}
+		switch s.Policy {
+		case "semver":
+			constraint := s.Range
+			if constraint == "" {
+				current := refs[repo][0].tag
+				if _, err := semver.NewVersion(current); err != nil {
+					logf("⚠️ %s has tag %q, which is not a version; pass --range or another --policy to generate its policy\n", repo, current)
+					continue
+				}
+				constraint = ">=" + current
+			}
+			policy = map[string]interface{}{"semver": map[string]interface{}{"range": constraint}}
+		default:
+			policy = map[string]interface{}{s.Policy: map[string]interface{}{"order": "asc"}}
+		}
+
+		name := imagePolicyName(repo, used)
+		objects = append(objects,
+			objectManifest(imageAPIVersion, "ImageRepository", name, s.Namespace, map[string]interface{}{
+				"image":    repo,
+				"interval": s.Interval,
+			}),
+			objectManifest(imageAPIVersion, "ImagePolicy", name, s.Namespace, map[string]interface{}{
+				"imageRepositoryRef": map[string]interface{}{"name": name},
+				"policy":             policy,
+			}))
+		for _, ref := range refs[repo] {
+			marker := imagePolicyMarker{Path: ref.path, Value: ref.value, Policy: s.Namespace + ":" + name}
+			if ref.block {
+				marker.Policy += ":tag"
+			}
+			markers = append(markers, marker)
+		}
+	}
+	return objects, markers, nil
+}
+
+// markImagePolicies writes the comment of each marker after its scalar in
+// the .spec.values of the HelmRelease YAML data, replacing any other line
+// comment. Scalars that already carry their marker are left alone.
+//
+// Returns:
+//   - The updated manifest.
+//   - The number of markers added.
+//   - An error if the manifest cannot be parsed.
+func markImagePolicies(data []byte, markers []imagePolicyMarker) ([]byte, int, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	values := helmReleaseValuesNode(yamlDocumentRoot(&doc))
+	lines := strings.SplitAfter(string(data), "\n")
+	added := 0
+	for _, m := range markers {
+		for _, node := range yamlScalarsAtPath(values, splitValuesPath(m.Path), m.Value) {
+			if strings.Contains(node.LineComment, m.comment()) {
+				continue
+			}
+			setLineComment(lines, node, m.comment())
+			added++
+		}
+	}
+	return []byte(strings.Join(lines, "")), added, nil
+}
+
+// writeImagePolicyMarkers adds markers to file under its advisory lock.
+func writeImagePolicyMarkers(file string, markers []imagePolicyMarker) error {
+	unlock, err := acquireFileLock(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if isJSONManifest(data) {
+		return fmt.Errorf("JSON manifests cannot hold $imagepolicy marker comments")
+	}
+	out, added, err := markImagePolicies(data, markers)
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		logf("✅ %s already has its image policy markers\n", file)
+		return nil
+	}
+	if err := writeFileWithBackup(file, out, 0644); err != nil {
+		return fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("🏷️ Added %d image policy marker(s) to %s\n", added, file)
+	return nil
+}
+
+var newImageAutomationCmd = &cobra.Command{
+	Use:   "image-automation",
+	Short: "Generate ImageRepository and ImagePolicy objects for the images of a HelmRelease",
+	Long: "Write a Flux ImageRepository and ImagePolicy for every image referenced in " +
+		"the values of a HelmRelease, and the $imagepolicy marker comments the " +
+		"image-automation-controller needs, which --write-markers adds to the file.",
+	Example: "  flux-helpers new image-automation -f apps/my-app.yaml --output apps/my-app-images.yaml --write-markers",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if msgs := validation.IsDNS1123Label(scaffoldNamespace); len(msgs) > 0 {
+			return fmt.Errorf("invalid --namespace %q: %s", scaffoldNamespace, strings.Join(msgs, "; "))
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(automationFile)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if err := refuseSOPS(automationFile, data); err != nil {
+			return err
+		}
+		objects, markers, err := GenerateImageAutomation(data, imageAutomationScaffold{
+			Namespace: scaffoldNamespace,
+			Interval:  scaffoldInterval,
+			Policy:    automationPolicy,
+			Range:     automationRange,
+		}, matchers)
+		if err != nil {
+			return fmt.Errorf("%s: %w", automationFile, err)
+		}
+		if len(objects) == 0 {
+			return fmt.Errorf("%s: no image to generate a policy for", automationFile)
+		}
+		if err := writeManifests(scaffoldOutput, objects); err != nil {
+			return err
+		}
+		if automationWriteMarkers {
+			return writeImagePolicyMarkers(automationFile, markers)
+		}
+		for _, m := range markers {
+			logf("🏷️ Mark %s in %s with # %s (or pass --write-markers)\n", m.Path, automationFile, m.comment())
+		}
+		return nil
+	},
+}
+
+func init() {
+	newImageAutomationCmd.Flags().StringVarP(&automationFile, "file", "f", "", "HelmRelease YAML file whose images to automate")
+	newImageAutomationCmd.Flags().StringVar(&scaffoldNamespace, "namespace", "flux-system", "Namespace of the ImageRepository and ImagePolicy objects")
+	newImageAutomationCmd.Flags().StringVar(&scaffoldInterval, "interval", "10m", "Scan interval of the ImageRepository objects")
+	newImageAutomationCmd.Flags().StringVar(&scaffoldOutput, "output", stdioFile, "File to write the manifests to, or - for stdout")
+	newImageAutomationCmd.Flags().StringVar(&automationPolicy, "policy", "semver", "Tag selection policy: "+strings.Join(imagePolicyKinds, ", "))
+	newImageAutomationCmd.Flags().StringVar(&automationRange, "range", "", "Semver range of the semver policy (default: >= the current tag)")
+	newImageAutomationCmd.Flags().BoolVar(&automationWriteMarkers, "write-markers", false, "Add the $imagepolicy marker comments to the HelmRelease file")
+	newImageAutomationCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	_ = markLocalSettings(newImageAutomationCmd, "output", "policy")
+	_ = newImageAutomationCmd.MarkFlagRequired("file")
+	newCmd.AddCommand(newImageAutomationCmd)
+}
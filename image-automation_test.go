@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGenerateImageAutomation verifies that every image of a HelmRelease
+// gets an ImageRepository and ImagePolicy, and that the markers are written
+// once after the referencing scalars.
+func TestGenerateImageAutomation(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	objects, markers, err := GenerateImageAutomation(data, imageAutomationScaffold{Namespace: "flux-system", Interval: "5m", Policy: "semver"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := encodeManifests(objects)
+	if err != nil {
+		t.Fatalf("Failed to encode manifests: %v", err)
+	}
+	for _, want := range []string{
+		"kind: ImageRepository\nmetadata:\n  name: my-api\n  namespace: flux-system\nspec:\n  image: ghcr.io/my-org/my-api\n",
+		"kind: ImagePolicy\nmetadata:\n  name: web-app\n  namespace: flux-system\nspec:\n  imageRepositoryRef:\n    name: web-app\n  policy:\n    semver:\n      range: '>=1.7.99'\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected the manifests to contain:\n%s\ngot:\n%s", want, out)
+		}
+	}
+	if len(objects) != 4 {
+		t.Errorf("Expected 4 objects, got %d", len(objects))
+	}
+
+	marked, added, err := markImagePolicies(data, markers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`      tag: 1.7.99 # {"$imagepolicy": "flux-system:my-api:tag"}` + "\n",
+		`      web: ghcr.io/my-org/web-app:1.7.99 # {"$imagepolicy": "flux-system:web-app"}`,
+	} {
+		if !strings.Contains(string(marked), want) {
+			t.Errorf("Expected the manifest to contain %q, got:\n%s", want, marked)
+		}
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 markers, got %d", added)
+	}
+	if _, added, _ := markImagePolicies(marked, markers); added != 0 {
+		t.Errorf("Expected existing markers to be kept, got %d added", added)
+	}
+
+	if _, _, err := GenerateImageAutomation(data, imageAutomationScaffold{Namespace: "flux-system", Interval: "5m", Policy: "numerical", Range: "1.x"}, nil); err == nil {
+		t.Error("Expected --range to be rejected for the numerical policy")
+	}
+}
+
+// TestImagePolicyName verifies that names are derived from the last
+// repository segment and made unique.
+func TestImagePolicyName(t *testing.T) {
+	used := map[string]bool{}
+	if got := imagePolicyName("ghcr.io/my-org/My_API", used); got != "my-api" {
+		t.Errorf("Expected my-api, got %s", got)
+	}
+	if got := imagePolicyName("docker.io/other/my-api", used); got != "my-api-2" {
+		t.Errorf("Expected my-api-2, got %s", got)
+	}
+}
+
+// TestBumpHonorsImagePolicyMarkers verifies that references with an
+// $imagepolicy marker are skipped by default, and bumped with the marker
+// kept with --image-policy-markers=update.
+func TestBumpHonorsImagePolicyMarkers(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	data := strings.Replace(string(original), "tag: 1.7.99", `tag: 1.7.99 # {"$imagepolicy": "flux-system:my-api:tag"}`, 1)
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "ghcr.io/my-org/web-app": "1.8.0"}
+
+	result, err := bumpHelmReleaseData([]byte(data), updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Image != "ghcr.io/my-org/web-app" {
+		t.Errorf("Expected only the unmarked image to change, got: %+v", result.Changes)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != skipImagePolicy {
+		t.Errorf("Expected the marked image to be skipped, got: %+v", result.Skipped)
+	}
+
+	imagePolicyMode = imagePolicyUpdate
+	t.Cleanup(func() { imagePolicyMode = imagePolicySkip })
+	annotator, err := newChangeAnnotator("bumped", "", time.Now())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, err = bumpHelmReleaseData([]byte(data), updates, bumpOptions{Annotate: annotator})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Changes) != 2 {
+		t.Errorf("Expected both images to change, got: %+v", result.Changes)
+	}
+	if want := `tag: 1.8.0 # {"$imagepolicy": "flux-system:my-api:tag"}`; !strings.Contains(string(result.Output), want) {
+		t.Errorf("Expected the marker to be kept, got:\n%s", result.Output)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// imageLockVersion is the format version of image lockfiles.
+const imageLockVersion = 1
+
+// imageLock pins every image of a manifest tree to the tag it had when the
+// lockfile was generated. apply-lock sets the manifests back to it.
+type imageLock struct {
+	Version     int              `json:"version"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+	Images      []imageReference `json:"images"`
+}
+
+var (
+	lockOutputPath string
+	lockDiff       bool
+)
+
+// BuildImageLock snapshots the image references of files, as `list images`
+// finds them with matchers, into an imageLock.
+//
+// Returns:
+//   - The lock, with the images in file, path and image order.
+//   - An error if a file cannot be read or parsed.
+func BuildImageLock(files []string, matchers []imageMatcher) (*imageLock, error) {
+	lock := &imageLock{Version: imageLockVersion, GeneratedAt: time.Now().UTC(), Images: []imageReference{}}
+	bar := startProgress("lock", "file", len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		refs, err := listImageReferences(file, data, matchers)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		lock.Images = append(lock.Images, refs...)
+		bar.Increment()
+	}
+	bar.Done()
+	return lock, nil
+}
+
+// loadImageLock reads an image lockfile.
+func loadImageLock(path string) (*imageLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	var lock imageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	if lock.Version != imageLockVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d (expected %d)", lock.Version, imageLockVersion)
+	}
+	return &lock, nil
+}
+
+// lockImagesInData sets the image references of the HelmRelease YAML data
+// to the tags of locked, whatever their current tags. A locked reference is
+// found by its image and path; references the manifest no longer has are
+// reported as missing.
+//
+// Returns:
+//   - The updated manifest (nil if nothing changed).
+//   - The changes made, with the paths of the changed scalars.
+//   - The locked references that were not found.
+//   - An error if the manifest cannot be parsed or re-encoded.
+func lockImagesInData(data []byte, locked []imageReference, matchers []imageMatcher) ([]byte, []tagChange, []imageReference, error) {
+	var changes []tagChange
+	var missing []imageReference
+	out, err := rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+		for _, ref := range locked {
+			matches := findImageBlocks(values, ref.Image, matchers)
+			if postRenderers != nil {
+				matches = append(matches, postRenderers.findImages(ref.Image, matchers)...)
+			}
+			found := false
+			for _, m := range matches {
+				if m.Path != ref.Path {
+					continue
+				}
+				found = true
+				if m.Block != nil {
+					if current := fmt.Sprint(m.Block[m.TagKey]); current != ref.Tag {
+						changes = append(changes, tagChange{Image: ref.Image, Path: joinValuesPath(m.Path, m.TagKey), OldValue: current, NewValue: ref.Tag})
+						m.Block[m.TagKey] = ref.Tag
+					}
+				} else if locked := ref.Image + ":" + ref.Tag; m.Value != locked {
+					changes = append(changes, tagChange{Image: ref.Image, Path: m.Path, OldValue: m.Value, NewValue: locked})
+					m.Parent[m.Key] = locked
+				}
+			}
+			if !found {
+				missing = append(missing, ref)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(changes) == 0 {
+		return nil, changes, missing, err
+	}
+	return out, changes, missing, nil
+}
+
+// ApplyImageLock sets the manifests of lock back to its tags, rewriting
+// every file whose images drifted under its advisory lock. Images the lock
+// records but a manifest no longer has are reported with a warning.
+//
+// Parameters:
+//   - lock: The lockfile to apply.
+//   - matchers: The image matchers the lockfile was generated with.
+//   - dryRun: If true, changes are only reported.
+//   - diff: If true, a unified diff of every changed file is printed.
+//
+// Returns:
+//   - A fileReport per changed file.
+//   - An error if a file cannot be read, parsed or written.
+func ApplyImageLock(lock *imageLock, matchers []imageMatcher, dryRun, diff bool) ([]fileReport, error) {
+	var files []string
+	byFile := map[string][]imageReference{}
+	for _, ref := range lock.Images {
+		if _, ok := byFile[ref.File]; !ok {
+			files = append(files, ref.File)
+		}
+		byFile[ref.File] = append(byFile[ref.File], ref)
+	}
+
+	var reports []fileReport
+	for _, file := range files {
+		report, err := applyImageLockToFile(file, byFile[file], matchers, dryRun, diff)
+		if err != nil {
+			return reports, fmt.Errorf("%s: %w", file, err)
+		}
+		if report != nil {
+			reports = append(reports, *report)
+		}
+	}
+	return reports, nil
+}
+
+// applyImageLockToFile is ApplyImageLock for the locked references of a
+// single file. It returns nil if the file already matches the lock.
+func applyImageLockToFile(file string, locked []imageReference, matchers []imageMatcher, dryRun, diff bool) (*fileReport, error) {
+	if !dryRun {
+		unlock, err := acquireFileLock(file)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+	out, changes, missing, err := lockImagesInData(data, locked, matchers)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range missing {
+		logf("⚠️ %s is no longer at %s in %s, skipping\n", ref.Image, ref.Path, file)
+	}
+	if len(changes) == 0 {
+		logf("✅ %s matches the lock\n", file)
+		return nil, nil
+	}
+	for _, c := range changes {
+		if dryRun {
+			logf("[dry-run] Would set %s (%s): %s → %s\n", c.Path, c.Image, c.OldValue, c.NewValue)
+		} else {
+			logf("🔁 Set %s (%s): %s → %s\n", c.Path, c.Image, c.OldValue, c.NewValue)
+		}
+	}
+	if diff {
+		fmt.Print(unifiedDiff("a/"+file, "b/"+file, data, out))
+	}
+	report := &fileReport{File: file, Updated: len(changes), Changes: changes}
+	if dryRun {
+		return report, nil
+	}
+	if err := writeFileWithBackup(file, out, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Restored %d image(s) in %s\n", len(changes), file)
+	return report, nil
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Snapshot every image and tag of a manifest tree into a lockfile",
+	Long: `Record the image references (file, values path, image and tag) of HelmRelease
+manifests in a JSON lockfile, so an environment can be recreated with exactly
+these tags, or repaired after drift, with apply-lock.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(listFiles) == 0 && listDir == "" {
+			return fmt.Errorf("--file or --dir is required")
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		files, err := expandFileGlobs(listFiles)
+		if err != nil {
+			return err
+		}
+		if listDir != "" {
+			found, err := helmReleaseFilesInDir(listDir)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", listDir, err)
+			}
+			for _, f := range found {
+				files = appendUnique(files, f)
+			}
+		}
+
+		if lockOutputPath == "" || lockOutputPath == stdioFile {
+			logOut = os.Stderr
+		}
+		lock, err := BuildImageLock(files, matchers)
+		if err != nil {
+			return err
+		}
+		if lockOutputPath == "" || lockOutputPath == stdioFile {
+			return writeJSON(os.Stdout, lock)
+		}
+		out, err := json.MarshalIndent(lock, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal lockfile: %w", err)
+		}
+		if err := writeFileAtomic(lockOutputPath, append(out, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write lockfile: %w", err)
+		}
+		logf("🔒 Locked %d image(s) of %d file(s) in %s\n", len(lock.Images), len(files), lockOutputPath)
+		return nil
+	},
+}
+
+var applyLockCmd = &cobra.Command{
+	Use:   "apply-lock LOCKFILE",
+	Short: "Set manifests back to the image tags recorded in a lockfile",
+	Long: `Force every image reference recorded in a lockfile written by lock back to
+its locked tag, whatever the manifest holds now (including tags that are not
+versions). Only the drifted tags are rewritten.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lock, err := loadImageLock(args[0])
+		if err != nil {
+			return err
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		reports, err := ApplyImageLock(lock, matchers, dryRun, lockDiff)
+		if err != nil {
+			return fmt.Errorf("failed to apply lockfile: %w", err)
+		}
+		noChangesMade = len(reports) == 0
+		return nil
+	},
+}
+
+func init() {
+	lockCmd.Flags().StringArrayVarP(&listFiles, "file", "f", nil, "HelmRelease YAML file(s) to lock; globs are expanded (repeatable)")
+	lockCmd.Flags().StringVar(&listDir, "dir", "", "Lock every HelmRelease YAML file below this directory")
+	lockCmd.Flags().StringVarP(&lockOutputPath, "output", "o", "", "Write the lockfile to this file (default: stdout)")
+	_ = markLocalSettings(lockCmd, "output")
+	lockCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+
+	applyLockCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the files")
+	applyLockCmd.Flags().BoolVar(&lockDiff, "diff", false, "Print a unified diff of every file that changes")
+	applyLockCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none (as used for lock)")
+
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(applyLockCmd)
+}
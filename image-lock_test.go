@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestImageLockRoundTrip verifies that a lockfile records the images of a
+// manifest and that applying it restores drifted tags, also ones that are
+// not versions, leaving the rest of the file as it was.
+func TestImageLockRoundTrip(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write fixture copy: %v", err)
+	}
+
+	lock, err := BuildImageLock([]string{file}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, ref := range lock.Images {
+		got = append(got, ref.Path+" "+ref.Image+":"+ref.Tag)
+	}
+	want := "image ghcr.io/my-org/my-api:1.7.99,images.web ghcr.io/my-org/web-app:1.7.99"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Expected locked images %s, got %s", want, strings.Join(got, ","))
+	}
+
+	drifted := strings.NewReplacer("tag: 1.7.99", "tag: latest", "web-app:1.7.99", "web-app:2.0.0").Replace(string(original))
+	if err := os.WriteFile(file, []byte(drifted), 0644); err != nil {
+		t.Fatalf("Failed to write drifted file: %v", err)
+	}
+	reports, err := ApplyImageLock(lock, nil, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Updated != 2 {
+		t.Errorf("Expected 2 restored images, got: %+v", reports)
+	}
+	if out, _ := os.ReadFile(file); string(out) != string(original) {
+		t.Errorf("Expected the original file back, got:\n%s", out)
+	}
+
+	reports, err = ApplyImageLock(lock, nil, false, false)
+	if err != nil || len(reports) != 0 {
+		t.Errorf("Expected nothing to change once locked, got %+v, %v", reports, err)
+	}
+}
+
+// TestLockImagesMissing verifies that locked references a manifest no longer
+// has are reported rather than added.
+func TestLockImagesMissing(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	locked := []imageReference{{Path: "sidecar.image", Image: "ghcr.io/my-org/sidecar", Tag: "1.0.0"}}
+	out, changes, missing, err := lockImagesInData(data, locked, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out != nil || len(changes) != 0 || len(missing) != 1 {
+		t.Errorf("Expected only a missing reference, got %q, %+v, %+v", out, changes, missing)
+	}
+}
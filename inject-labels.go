@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// helpersTemplate is the template file that holds the named templates of a
+// chart, as created by `helm create`.
+const helpersTemplate = "templates/_helpers.tpl"
+
+// standardLabelKeys are the labels the labels helper renders. Literal labels
+// with these keys are replaced by the helper, as the keys would otherwise be
+// duplicated.
+var standardLabelKeys = map[string]bool{
+	"helm.sh/chart":                true,
+	"app.kubernetes.io/name":       true,
+	"app.kubernetes.io/instance":   true,
+	"app.kubernetes.io/version":    true,
+	"app.kubernetes.io/managed-by": true,
+}
+
+// labelHelpers are the named templates the labels helper needs, in the order
+// they are added to _helpers.tpl, as written by `helm create` with "PREFIX"
+// standing for the helper prefix.
+var labelHelpers = []struct{ name, body string }{
+	{"name", `{{/*
+Expand the name of the chart.
+*/}}
+{{- define "PREFIX.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
+{{- end }}
+`},
+	{"chart", `{{/*
+Create chart name and version as used by the chart label.
+*/}}
+{{- define "PREFIX.chart" -}}
+{{- printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" }}
+{{- end }}
+`},
+	{"selectorLabels", `{{/*
+Selector labels
+*/}}
+{{- define "PREFIX.selectorLabels" -}}
+app.kubernetes.io/name: {{ include "PREFIX.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end }}
+`},
+	{"labels", `{{/*
+Common labels
+*/}}
+{{- define "PREFIX.labels" -}}
+helm.sh/chart: {{ include "PREFIX.chart" . }}
+{{ include "PREFIX.selectorLabels" . }}
+{{- if .Chart.AppVersion }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+{{- end }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end }}
+`},
+}
+
+// defineDirective matches the named templates a template file defines.
+var defineDirective = regexp.MustCompile(`\{\{-?\s*define\s+"([^"]+)"`)
+
+// labelsIncludePattern matches an include of a labels helper.
+var labelsIncludePattern = regexp.MustCompile(`include\s+"([^"]+)\.labels"`)
+
+var labelsHelperPrefix string
+
+// labelsHelperPrefixOf returns the prefix of the labels helper of ch: the
+// prefix of an existing <prefix>.labels template, or the chart name.
+func labelsHelperPrefixOf(ch *chart.Chart) string {
+	var prefixes []string
+	for _, tmpl := range ch.Templates {
+		for _, m := range defineDirective.FindAllSubmatch(tmpl.Data, -1) {
+			if name := string(m[1]); strings.HasSuffix(name, ".labels") {
+				prefixes = appendUnique(prefixes, strings.TrimSuffix(name, ".labels"))
+			}
+		}
+	}
+	if len(prefixes) == 1 {
+		return prefixes[0]
+	}
+	return ch.Name()
+}
+
+// ensureLabelHelpers adds the named templates of labelHelpers that no
+// template of ch defines to its _helpers.tpl, creating the file if needed. A
+// chart that already defines <prefix>.labels is left alone.
+//
+// Returns:
+//   - The names of the added templates.
+func ensureLabelHelpers(ch *chart.Chart, prefix string) []string {
+	defined := map[string]bool{}
+	var helpers *chart.File
+	for _, tmpl := range ch.Templates {
+		for _, m := range defineDirective.FindAllSubmatch(tmpl.Data, -1) {
+			defined[string(m[1])] = true
+		}
+		if tmpl.Name == helpersTemplate {
+			helpers = tmpl
+		}
+	}
+
+	if defined[prefix+".labels"] {
+		return nil
+	}
+
+	var added []string
+	var text strings.Builder
+	for _, helper := range labelHelpers {
+		name := prefix + "." + helper.name
+		if defined[name] {
+			continue
+		}
+		added = append(added, name)
+		text.WriteString("\n")
+		text.WriteString(strings.ReplaceAll(helper.body, "PREFIX", prefix))
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if helpers == nil {
+		helpers = &chart.File{Name: helpersTemplate}
+		ch.Templates = append(ch.Templates, helpers)
+	}
+	data := string(helpers.Data)
+	if data == "" {
+		data = strings.TrimPrefix(text.String(), "\n")
+	} else {
+		if !strings.HasSuffix(data, "\n") {
+			data += "\n"
+		}
+		data += text.String()
+	}
+	helpers.Data = []byte(data)
+	return added
+}
+
+// injectLabelsInclude wires the labels helper into the top-level metadata of
+// a template: a labels block including it is added to metadata, or the
+// include is added to the existing labels in place of their literal standard
+// labels. A template whose labels already include a labels helper is left
+// alone.
+//
+// Returns:
+//   - The updated template text.
+//   - What was done, as an injectAction.
+//   - The literal labels that were replaced.
+//   - An error if the template has no top-level metadata block.
+func injectLabelsInclude(data []byte, prefix string) ([]byte, injectAction, []string, error) {
+	include := `{{- include "` + prefix + `.labels" . | nindent ${childIndent} }}`
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	scanned := scanTemplateLines(lines)
+
+	labels := -1
+	for i, l := range scanned {
+		if l != nil && l.path == "metadata.labels" {
+			labels = i
+			break
+		}
+	}
+	if labels < 0 {
+		out, action, err := injectSnippet(data, injectionSpec{Name: "labels", Path: "metadata", Snippet: "labels:\n  " + include + "\n"})
+		return out, action, nil, err
+	}
+	if !scanned[labels].opens {
+		if labelsIncludePattern.MatchString(lines[labels]) {
+			return data, injectPresent, nil, nil
+		}
+		return data, injectSkipped, nil, nil
+	}
+
+	// The labels block runs until the next line at or left of its key.
+	end := labels + 1
+	for end < len(lines) {
+		trimmed := strings.TrimSpace(lines[end])
+		indent := len(lines[end]) - len(strings.TrimLeft(lines[end], " "))
+		if trimmed != "" && indent <= scanned[labels].indent {
+			break
+		}
+		end++
+	}
+	for _, line := range lines[labels+1 : end] {
+		if labelsIncludePattern.MatchString(line) {
+			return data, injectPresent, nil, nil
+		}
+	}
+
+	childIndent := scanned[labels].indent + 2
+	var kept, replaced []string
+	for i, line := range lines[labels+1 : end] {
+		if l := scanned[labels+1+i]; l != nil {
+			childIndent = l.indent
+			key := strings.TrimPrefix(l.path, "metadata.labels.")
+			if _, value, _ := splitYAMLKey(strings.TrimSpace(line)); standardLabelKeys[key] && value != "" {
+				replaced = append(replaced, key)
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	includeLine := strings.Repeat(" ", childIndent) + strings.ReplaceAll(include, "${childIndent}", strconv.Itoa(childIndent))
+
+	out := make([]string, 0, len(lines)+1)
+	out = append(out, lines[:labels+1]...)
+	out = append(out, includeLine)
+	out = append(out, kept...)
+	out = append(out, lines[end:]...)
+	return []byte(strings.Join(out, "\n") + "\n"), injectInserted, replaced, nil
+}
+
+// injectLabels wires the standard app.kubernetes.io/* labels into the
+// top-level metadata of the workload templates of the chart in chartDir
+// through a <prefix>.labels helper, adding the helper (and the helpers it
+// uses) to _helpers.tpl where the chart does not define them. Pod template
+// labels and selectors are left alone, since changing the selector of a
+// workload is not allowed.
+//
+// Parameters:
+//   - chartDir: The path to the Helm chart directory.
+//   - prefix: The helper prefix; empty derives it with labelsHelperPrefixOf.
+//   - templates: Glob patterns selecting the templates; empty selects every
+//     workload template.
+//   - opts: Dry-run, diff and render preview settings.
+//
+// Returns:
+//   - Whether any file changed (or would change in dry-run mode).
+//   - An error if the chart cannot be loaded, rendered or written.
+func injectLabels(chartDir, prefix string, templates []string, opts chartInjectOptions) (bool, error) {
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to load chart at %s: %w", chartDir, err)
+	}
+	if prefix == "" {
+		prefix = labelsHelperPrefixOf(ch)
+	}
+
+	spec := injectionSpec{Kinds: workloadKinds, Templates: templates, Path: "metadata"}
+	changedTemplates := map[string]bool{}
+	matched := 0
+	for _, tmpl := range ch.Templates {
+		selected, err := injectionSelects(spec, tmpl.Name, tmpl.Data)
+		if err != nil {
+			return false, err
+		}
+		if !selected {
+			continue
+		}
+		matched++
+		updated, action, replaced, err := injectLabelsInclude(tmpl.Data, prefix)
+		if err != nil {
+			return false, fmt.Errorf("failed to inject labels into %s: %w", tmpl.Name, err)
+		}
+		switch action {
+		case injectPresent:
+			logf("✅ labels helper already included in %s\n", tmpl.Name)
+			continue
+		case injectSkipped:
+			logf("⚠️ labels in %s are defined by the chart itself, leaving them untouched\n", tmpl.Name)
+			continue
+		}
+		logf("🔧 Including %s.labels in %s\n", prefix, tmpl.Name)
+		if len(replaced) > 0 {
+			sort.Strings(replaced)
+			logf("🔧 Replacing literal %s labels in %s\n", strings.Join(replaced, ", "), tmpl.Name)
+		}
+		tmpl.Data = updated
+		changedTemplates[tmpl.Name] = true
+	}
+	if matched == 0 {
+		logf("⚠️ No workload template in %s is selected\n", chartDir)
+	}
+
+	if len(changedTemplates) > 0 {
+		if added := ensureLabelHelpers(ch, prefix); len(added) > 0 {
+			logf("🔧 Adding %s to %s\n", strings.Join(added, ", "), helpersTemplate)
+			changedTemplates[helpersTemplate] = true
+		}
+	}
+
+	changed, err := writeChartTemplates(chartDir, ch, changedTemplates, opts)
+	if err != nil {
+		return false, err
+	}
+	if err := renderInjectedChart(ch, ch.Values, changedTemplates, opts); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+var chartInjectLabelsCmd = &cobra.Command{
+	Use:   "inject-labels",
+	Short: "Wire the standard app.kubernetes.io/* labels into a Helm chart",
+	Long: `Include a <prefix>.labels helper, which renders the standard helm.sh/chart and
+app.kubernetes.io/* labels, in the metadata of the selected workload templates
+of a Helm chart (by default every deployment, statefulset, daemonset, job and
+cronjob template), and add the helper, and the name, chart and selectorLabels
+helpers it uses, to templates/_helpers.tpl where the chart lacks them.
+
+The prefix is that of an existing <prefix>.labels helper, otherwise the chart
+name, unless --helper-prefix is given. Literal standard labels are replaced by
+the include and other labels are kept. Pod template labels and selectors are not
+touched, since the selector of a workload cannot be changed.`,
+	Example: `  flux-helpers chart inject-labels --chart ./charts/legacy-app --dry-run --diff`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if chartPath == "" {
+			return fmt.Errorf("you must specify --chart pointing to a Helm chart directory")
+		}
+		changed, err := injectLabels(chartPath, labelsHelperPrefix, injectTemplates, chartInjectOptions{DryRun: injectDryRun, Diff: injectDiff, ShowRender: injectShowRender})
+		if err != nil {
+			return fmt.Errorf("failed to inject: %w", err)
+		}
+		noChangesMade = !changed
+		return nil
+	},
+}
+
+func init() {
+	flags := chartInjectLabelsCmd.Flags()
+	flags.StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	flags.StringVar(&labelsHelperPrefix, "helper-prefix", "", "Prefix of the helpers, e.g. my-app for my-app.labels (default: that of an existing labels helper, or the chart name)")
+	flags.StringArrayVar(&injectTemplates, "template", nil, "Glob selecting the templates to inject into, matched against the template path or file name (repeatable, default: every workload template)")
+	flags.BoolVar(&injectDryRun, "dry-run", false, "Preview changes without modifying the chart")
+	flags.BoolVar(&injectDiff, "diff", false, "Print a unified diff of every file that changes")
+	flags.BoolVar(&injectShowRender, "show-render", false, "Print the rendered manifests of the changed templates")
+	chartCmd.AddCommand(chartInjectLabelsCmd)
+}
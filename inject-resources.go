@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultResourcesValuesKey is the values.yaml key that holds the resources
+// of the first container.
+const defaultResourcesValuesKey = "resources"
+
+// resourceDefaults are the requests and limits written to values.yaml by
+// chart inject-resources. Empty fields are left out.
+type resourceDefaults struct {
+	RequestsCPU    string
+	RequestsMemory string
+	LimitsCPU      string
+	LimitsMemory   string
+}
+
+// resourcePresets are the named resourceDefaults of --preset.
+var resourcePresets = map[string]resourceDefaults{
+	"small":  {RequestsCPU: "100m", RequestsMemory: "128Mi", LimitsCPU: "500m", LimitsMemory: "256Mi"},
+	"medium": {RequestsCPU: "250m", RequestsMemory: "256Mi", LimitsCPU: "1", LimitsMemory: "512Mi"},
+	"large":  {RequestsCPU: "500m", RequestsMemory: "512Mi", LimitsCPU: "2", LimitsMemory: "1Gi"},
+}
+
+var (
+	resourcesPreset       string
+	resourcesValuesKey    string
+	resourcesTemplates    []string
+	resourcesFlagDefaults resourceDefaults
+)
+
+// resourcePresetNames lists the names of resourcePresets in order.
+func resourcePresetNames() []string {
+	names := make([]string, 0, len(resourcePresets))
+	for name := range resourcePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// override returns d with the non-empty fields of o.
+func (d resourceDefaults) override(o resourceDefaults) resourceDefaults {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&d.RequestsCPU, o.RequestsCPU},
+		{&d.RequestsMemory, o.RequestsMemory},
+		{&d.LimitsCPU, o.LimitsCPU},
+		{&d.LimitsMemory, o.LimitsMemory},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return d
+}
+
+// values returns the values.yaml defaults of d below valuesKey, e.g.
+// "resources.requests.cpu", after checking that every field is a Kubernetes
+// quantity and that no request exceeds its limit.
+func (d resourceDefaults) values(valuesKey string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	quantities := map[string]resource.Quantity{}
+	for _, f := range []struct{ key, value string }{
+		{"requests.cpu", d.RequestsCPU},
+		{"requests.memory", d.RequestsMemory},
+		{"limits.cpu", d.LimitsCPU},
+		{"limits.memory", d.LimitsMemory},
+	} {
+		if f.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", f.key, f.value, err)
+		}
+		quantities[f.key] = q
+		values[valuesKey+"."+f.key] = f.value
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no requests or limits given (use --preset or --cpu-request, --memory-request, --cpu-limit, --memory-limit)")
+	}
+	for _, name := range []string{"cpu", "memory"} {
+		request, hasRequest := quantities["requests."+name]
+		limit, hasLimit := quantities["limits."+name]
+		if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			return nil, fmt.Errorf("%s request %s exceeds the limit %s", name, request.String(), limit.String())
+		}
+	}
+	return values, nil
+}
+
+// resourcesInjection returns the injection of a resources block into the
+// first container of the selected workload templates, guarded by and
+// reading from the dotted values key, with defaults as the values.yaml
+// defaults. Empty templates select every workload template.
+func resourcesInjection(valuesKey string, templates []string, defaults resourceDefaults) (injectionSpec, error) {
+	if _, err := splitValuesKey(valuesKey); err != nil {
+		return injectionSpec{}, err
+	}
+	values, err := defaults.values(valuesKey)
+	if err != nil {
+		return injectionSpec{}, err
+	}
+	valuesRef := ".Values." + valuesKey
+	return injectionSpec{
+		Name:      "resources",
+		Kinds:     workloadKinds,
+		Templates: templates,
+		Path:      podSpecPrefix + ".containers[0]",
+		Guard:     valuesRef,
+		Snippet:   "resources:\n  {{- toYaml " + valuesRef + " | nindent ${childIndent} }}\n",
+		Values:    values,
+	}, nil
+}
+
+var chartInjectResourcesCmd = &cobra.Command{
+	Use:   "inject-resources",
+	Short: "Inject a resources block with requests and limits defaults into a Helm chart",
+	Long: `Inject a resources block, guarded by ` + "`if .Values.resources`" + `, into the first
+container of the selected workload templates of a Helm chart (by default every
+deployment, statefulset, daemonset, job and cronjob template), and add the
+requests and limits of --preset, overridden by --cpu-request, --memory-request,
+--cpu-limit and --memory-limit, to the chart's values.yaml.
+
+Templates that already contain the block, or set resources themselves, are left
+untouched, and values.yaml keys that already exist keep their value, so the
+command can be run repeatedly.`,
+	Example: `  flux-helpers chart inject-resources --chart ./charts/my-app --preset small
+  flux-helpers chart inject-resources --chart ./charts/my-app --preset medium --memory-limit 1Gi --dry-run --diff`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if chartPath == "" {
+			return fmt.Errorf("you must specify --chart pointing to a Helm chart directory")
+		}
+		defaults := resourceDefaults{}
+		if resourcesPreset != "" {
+			preset, ok := resourcePresets[resourcesPreset]
+			if !ok {
+				return fmt.Errorf("unknown preset %q (available: %s)", resourcesPreset, strings.Join(resourcePresetNames(), ", "))
+			}
+			defaults = preset
+		}
+		spec, err := resourcesInjection(resourcesValuesKey, resourcesTemplates, defaults.override(resourcesFlagDefaults))
+		if err != nil {
+			return err
+		}
+
+		changed, err := injectChart(chartPath, []injectionSpec{spec}, chartInjectOptions{DryRun: injectDryRun, Diff: injectDiff, ShowRender: injectShowRender})
+		if err != nil {
+			return fmt.Errorf("failed to inject: %w", err)
+		}
+		noChangesMade = !changed
+		return nil
+	},
+}
+
+func init() {
+	flags := chartInjectResourcesCmd.Flags()
+	flags.StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	flags.StringVar(&resourcesPreset, "preset", "", "Requests and limits preset: "+strings.Join(resourcePresetNames(), ", "))
+	flags.StringVar(&resourcesFlagDefaults.RequestsCPU, "cpu-request", "", "CPU request, e.g. 100m (overrides --preset)")
+	flags.StringVar(&resourcesFlagDefaults.RequestsMemory, "memory-request", "", "Memory request, e.g. 128Mi (overrides --preset)")
+	flags.StringVar(&resourcesFlagDefaults.LimitsCPU, "cpu-limit", "", "CPU limit, e.g. 500m (overrides --preset)")
+	flags.StringVar(&resourcesFlagDefaults.LimitsMemory, "memory-limit", "", "Memory limit, e.g. 256Mi (overrides --preset)")
+	flags.StringVar(&resourcesValuesKey, "values-key", defaultResourcesValuesKey, "Dotted values.yaml key holding the resources")
+	flags.StringArrayVar(&resourcesTemplates, "template", nil, "Glob selecting the templates to inject into, matched against the template path or file name (repeatable, default: every workload template)")
+	flags.BoolVar(&injectDryRun, "dry-run", false, "Preview changes without modifying the chart")
+	flags.BoolVar(&injectDiff, "diff", false, "Print a unified diff of every file that changes")
+	flags.BoolVar(&injectShowRender, "show-render", false, "Print the rendered manifests of the changed templates")
+	chartCmd.AddCommand(chartInjectResourcesCmd)
+}
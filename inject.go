@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"sigs.k8s.io/yaml"
+)
+
+// injectionSpec declares a block to inject into chart templates, e.g.:
+//
+//	name: securityContext
+//	kinds: [Deployment, StatefulSet]
+//	path: podSpec
+//	guard: .Values.podSecurityContext
+//	snippet: |
+//	  securityContext:
+//	    {{- toYaml .Values.podSecurityContext | nindent ${childIndent} }}
+//	values:
+//	  podSecurityContext: {}
+//
+// The snippet is written as if it started at column 0; it is re-indented to
+// the children of path and wrapped in `{{- if <guard> }}` ... `{{- end }}` when
+// a guard is set. ${indent} and ${childIndent} in the snippet are replaced by
+// the column the snippet is inserted at and that column plus two, for use
+// with nindent.
+type injectionSpec struct {
+	// Name identifies the injection in messages.
+	Name string `json:"name"`
+	// Kinds restricts the injection to templates whose top-level kind is
+	// listed. Empty means any kind.
+	Kinds []string `json:"kinds,omitempty"`
+	// Templates are glob patterns selecting templates by path within the
+	// chart or by file name. Empty means every template.
+	Templates []string `json:"templates,omitempty"`
+	// Path is the dotted YAML path of the mapping (or list item, e.g.
+	// "spec.template.spec.containers[0]") the snippet is inserted into. A
+	// leading "podSpec" segment stands for the pod spec of the template's
+	// kind, e.g. "podSpec.containers[0]" is
+	// "spec.jobTemplate.spec.template.spec.containers[0]" for a CronJob.
+	Path string `json:"path"`
+	// Guard is the template condition the snippet is wrapped in, if any.
+	Guard string `json:"guard,omitempty"`
+	// Snippet is the YAML (template) text to insert.
+	Snippet string `json:"snippet"`
+	// Values maps dotted values.yaml keys to the defaults that are added
+	// when the key is missing.
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// injectionSpecFile is the file format read by `chart inject --spec`.
+type injectionSpecFile struct {
+	Injections []injectionSpec `json:"injections"`
+}
+
+// builtinInjections are the injections available by name to `chart inject`.
+var builtinInjections = map[string]injectionSpec{
+	"imagePullSecrets": pullSecretsInjection(defaultPullSecretValuesKey, nil),
+	"securityContext": {
+		Name:    "securityContext",
+		Kinds:   workloadKinds,
+		Path:    "podSpec",
+		Guard:   ".Values.podSecurityContext",
+		Snippet: "securityContext:\n  {{- toYaml .Values.podSecurityContext | nindent ${childIndent} }}\n",
+		Values:  map[string]interface{}{"podSecurityContext": map[string]interface{}{}},
+	},
+	"resources": {
+		Name:    "resources",
+		Kinds:   workloadKinds,
+		Path:    "podSpec.containers[0]",
+		Guard:   ".Values.resources",
+		Snippet: "resources:\n  {{- toYaml .Values.resources | nindent ${childIndent} }}\n",
+		Values:  map[string]interface{}{"resources": map[string]interface{}{}},
+	},
+	"nodeSelector": {
+		Name:    "nodeSelector",
+		Kinds:   workloadKinds,
+		Path:    "podSpec",
+		Guard:   ".Values.nodeSelector",
+		Snippet: "nodeSelector:\n  {{- toYaml .Values.nodeSelector | nindent ${childIndent} }}\n",
+		Values:  map[string]interface{}{"nodeSelector": map[string]interface{}{}},
+	},
+	"topologySpreadConstraints": {
+		Name:    "topologySpreadConstraints",
+		Kinds:   workloadKinds,
+		Path:    "podSpec",
+		Guard:   ".Values.topologySpreadConstraints",
+		Snippet: "topologySpreadConstraints:\n  {{- toYaml .Values.topologySpreadConstraints | nindent ${childIndent} }}\n",
+		Values:  map[string]interface{}{"topologySpreadConstraints": []interface{}{}},
+	},
+}
+
+// pullSecretsInjection returns the imagePullSecrets injection reading the
+// secret name from the dotted values key, restricted to the given templates.
+func pullSecretsInjection(valuesKey string, templates []string) injectionSpec {
+	valuesRef := ".Values." + valuesKey
+	return injectionSpec{
+		Name:      "imagePullSecrets",
+		Templates: templates,
+		Path:      podSpecPrefix,
+		Guard:     valuesRef,
+		Snippet:   "imagePullSecrets:\n  - name: {{ " + valuesRef + " }}\n",
+		Values:    map[string]interface{}{valuesKey: ""},
+	}
+}
+
+// builtinInjectionNames lists the names of builtinInjections in order.
+func builtinInjectionNames() []string {
+	names := make([]string, 0, len(builtinInjections))
+	for name := range builtinInjections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadInjectionSpecs reads and validates an injection spec file.
+func loadInjectionSpecs(path string) ([]injectionSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read injection spec file: %w", err)
+	}
+
+	var sf injectionSpecFile
+	if err := yaml.UnmarshalStrict(data, &sf); err != nil {
+		return nil, fmt.Errorf("invalid injection spec file %s: %w", path, err)
+	}
+	if len(sf.Injections) == 0 {
+		return nil, fmt.Errorf("invalid injection spec file %s: no injections defined", path)
+	}
+	for i, spec := range sf.Injections {
+		if err := spec.validate(); err != nil {
+			return nil, fmt.Errorf("invalid injection spec file %s: injections[%d]: %w", path, i, err)
+		}
+	}
+	return sf.Injections, nil
+}
+
+// validate checks that the spec has the fields needed to apply it.
+func (s injectionSpec) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Path == "" {
+		return fmt.Errorf("%s: path is required", s.Name)
+	}
+	if strings.TrimSpace(s.Snippet) == "" {
+		return fmt.Errorf("%s: snippet is required", s.Name)
+	}
+	for key := range s.Values {
+		if _, err := splitValuesKey(key); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// splitValuesKey splits a dotted values.yaml key into its parts.
+func splitValuesKey(key string) ([]string, error) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid values key %q", key)
+		}
+	}
+	return parts, nil
+}
+
+// chartInjectOptions controls how injectChart writes its results.
+type chartInjectOptions struct {
+	// DryRun computes the changes without writing any file.
+	DryRun bool
+	// Diff prints a unified diff of every file that changes.
+	Diff bool
+	// ShowRender prints the rendered manifests of the changed templates.
+	ShowRender bool
+}
+
+// injectChart applies the injection specs to the chart in chartDir.
+//
+// This function performs the following steps:
+//  1. Loads the Helm chart from the specified directory.
+//  2. Inserts every spec's snippet into the templates it selects, below the
+//     YAML path it targets.
+//  3. Ensures the values.yaml defaults declared by the specs exist.
+//  4. Renders the chart with the updated values, to check that the injected
+//     templates still render, and prints the changed templates if
+//     opts.ShowRender is set.
+//
+// Parameters:
+//   - chartDir: The path to the Helm chart directory.
+//   - specs: The injections to apply, in order.
+//   - opts: Dry-run, diff and render preview settings.
+//
+// Returns:
+//   - Whether any file changed (or would change in dry-run mode).
+//   - An error if the chart cannot be loaded, a template cannot be injected
+//     into, or a file cannot be written.
+func injectChart(chartDir string, specs []injectionSpec, opts chartInjectOptions) (bool, error) {
+	for _, spec := range specs {
+		if err := spec.validate(); err != nil {
+			return false, err
+		}
+	}
+
+	// Step 1: Load the chart
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to load chart at %s: %w", chartDir, err)
+	}
+
+	// Step 2: Inject the snippets into the selected templates
+	changedTemplates := map[string]bool{}
+	for _, spec := range specs {
+		matched := 0
+		for _, tmpl := range ch.Templates {
+			selected, err := injectionSelects(spec, tmpl.Name, tmpl.Data)
+			if err != nil {
+				return false, err
+			}
+			if !selected {
+				continue
+			}
+			matched++
+
+			updated, action, err := injectSnippet(tmpl.Data, spec)
+			if err != nil {
+				return false, fmt.Errorf("failed to inject %s into %s: %w", spec.Name, tmpl.Name, err)
+			}
+			switch action {
+			case injectInserted:
+				logf("🔧 Injecting %s into %s\n", spec.Name, tmpl.Name)
+			case injectUpdated:
+				logf("🔧 Updating existing %s block in %s\n", spec.Name, tmpl.Name)
+			case injectPresent:
+				logf("✅ %s already present in %s\n", spec.Name, tmpl.Name)
+				continue
+			case injectSkipped:
+				logf("⚠️ %s in %s is defined by the chart itself, leaving it untouched\n", spec.Name, tmpl.Name)
+				continue
+			}
+			tmpl.Data = updated
+			changedTemplates[tmpl.Name] = true
+		}
+		if matched == 0 {
+			logf("⚠️ No template in %s is selected by %s\n", chartDir, spec.Name)
+		}
+	}
+
+	changed, err := writeChartTemplates(chartDir, ch, changedTemplates, opts)
+	if err != nil {
+		return false, err
+	}
+
+	// Step 3: Ensure the values.yaml defaults
+	valuesPath := filepath.Join(chartDir, "values.yaml")
+	rawVals, err := os.ReadFile(valuesPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read values.yaml: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(rawVals, &values); err != nil {
+		return false, fmt.Errorf("invalid YAML in values.yaml: %w", err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	valuesChanged := false
+	for _, spec := range specs {
+		keys := make([]string, 0, len(spec.Values))
+		for key := range spec.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath, _ := splitValuesKey(key)
+			added, err := ensureValuesKey(values, keyPath, spec.Values[key])
+			if err != nil {
+				return false, fmt.Errorf("failed to add %s to values.yaml: %w", key, err)
+			}
+			if added {
+				logf("🔧 Adding %s to values.yaml\n", key)
+				valuesChanged = true
+			} else {
+				logf("✅ %s already exists in values.yaml\n", key)
+			}
+		}
+	}
+
+	if valuesChanged {
+		changed = true
+		updated, err := yaml.Marshal(values)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal updated values.yaml: %w", err)
+		}
+		updated = detectTextFormat(rawVals).apply(updated)
+		if opts.Diff {
+			fmt.Print(unifiedDiff("a/values.yaml", "b/values.yaml", rawVals, updated))
+		}
+		if opts.DryRun {
+			logf("[dry-run] Would write updated values.yaml to %s\n", valuesPath)
+		} else if err := writeFileAudited(valuesPath, updated, 0644); err != nil {
+			return false, fmt.Errorf("failed to write values.yaml: %w", err)
+		}
+	}
+
+	// Step 4: Render chart with values to check it, and for preview
+	if err := renderInjectedChart(ch, values, changedTemplates, opts); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// writeChartTemplates writes the templates of ch named in changedTemplates
+// that differ from the files in chartDir (which may not exist yet), printing
+// a diff and only reporting the writes as opts ask.
+//
+// Returns:
+//   - Whether any template differs.
+//   - An error if a file cannot be read or written.
+func writeChartTemplates(chartDir string, ch *chart.Chart, changedTemplates map[string]bool, opts chartInjectOptions) (bool, error) {
+	changed := false
+	for _, tmpl := range ch.Templates {
+		if !changedTemplates[tmpl.Name] {
+			continue
+		}
+
+		outPath := filepath.Join(chartDir, tmpl.Name)
+		original, err := os.ReadFile(outPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to read %s: %w", tmpl.Name, err)
+		}
+		if err == nil && bytes.Equal(original, tmpl.Data) {
+			logf("✅ %s unchanged\n", tmpl.Name)
+			continue
+		}
+		changed = true
+		if opts.Diff {
+			fmt.Print(unifiedDiff("a/"+tmpl.Name, "b/"+tmpl.Name, original, tmpl.Data))
+		}
+		if opts.DryRun {
+			logf("[dry-run] Would write updated %s to %s\n", tmpl.Name, outPath)
+			continue
+		}
+		if err := writeFileAudited(outPath, tmpl.Data, 0644); err != nil {
+			return false, fmt.Errorf("failed to write updated %s: %w", tmpl.Name, err)
+		}
+		logf("💾 Wrote updated %s to %s\n", tmpl.Name, outPath)
+	}
+	return changed, nil
+}
+
+// renderInjectedChart renders the injected chart with values, so a broken
+// injection fails the command, prints the changed templates if
+// opts.ShowRender is set, and reports completion.
+func renderInjectedChart(ch *chart.Chart, values map[string]interface{}, changedTemplates map[string]bool, opts chartInjectOptions) error {
+	valsMerged, err := chartutil.ToRenderValues(ch, values, chartutil.ReleaseOptions{
+		Name:      "test-release",
+		Namespace: "default",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to prepare render values: %w", err)
+	}
+
+	rendered, err := engine.Render(ch, valsMerged)
+	if err != nil {
+		return fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	if opts.ShowRender {
+		fmt.Println("\n🖨️ Rendered Manifest (excerpt):")
+		names := make([]string, 0, len(rendered))
+		for name := range rendered {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for tmplName := range changedTemplates {
+				if strings.HasSuffix(name, "/"+tmplName) {
+					fmt.Printf("\n--- %s ---\n%s\n", name, rendered[name])
+				}
+			}
+		}
+	}
+
+	if opts.DryRun {
+		logln("🧪 Dry-run complete. No files were written.")
+		return nil
+	}
+	logln("✅ Injection complete.")
+	return nil
+}
+
+// templateKindPattern matches the top-level kind of a template.
+var templateKindPattern = regexp.MustCompile(`(?m)^kind:\s*["']?([A-Za-z]+)`)
+
+// podSpecPrefix is the first segment of an injection path that stands for the
+// pod spec of the template's workload kind, see podSpecPaths.
+const podSpecPrefix = "podSpec"
+
+// podSpecPaths maps the workload kinds chart injection supports to the path of
+// their pod spec.
+var podSpecPaths = map[string]string{
+	"Deployment":  "spec.template.spec",
+	"StatefulSet": "spec.template.spec",
+	"DaemonSet":   "spec.template.spec",
+	"Job":         "spec.template.spec",
+	"CronJob":     "spec.jobTemplate.spec.template.spec",
+}
+
+// workloadKinds lists the keys of podSpecPaths.
+var workloadKinds = []string{"Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob"}
+
+// templateKind returns the top-level kind of a template, or "" if it is not
+// set literally.
+func templateKind(data []byte) string {
+	match := templateKindPattern.FindSubmatch(data)
+	if match == nil {
+		return ""
+	}
+	return string(match[1])
+}
+
+// resolveInjectionPath expands a leading podSpec segment of path to the pod
+// spec path of kind. Templates whose kind is not set literally are assumed to
+// have their pod spec at spec.template.spec.
+//
+// Returns:
+//   - The resolved path.
+//   - Whether path applies to kind; false if it uses podSpec and kind is a
+//     known kind without a pod spec.
+func resolveInjectionPath(path, kind string) (string, bool) {
+	if path != podSpecPrefix && !strings.HasPrefix(path, podSpecPrefix+".") && !strings.HasPrefix(path, podSpecPrefix+"[") {
+		return path, true
+	}
+	podSpec, ok := podSpecPaths[kind]
+	if !ok {
+		if kind != "" {
+			return "", false
+		}
+		podSpec = podSpecPaths["Deployment"]
+	}
+	return podSpec + strings.TrimPrefix(path, podSpecPrefix), true
+}
+
+// injectionSelects reports whether spec applies to the chart template with the
+// given name and content.
+func injectionSelects(spec injectionSpec, name string, data []byte) (bool, error) {
+	if !strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, ".yml") {
+		return false, nil
+	}
+	if len(spec.Templates) > 0 {
+		selected, err := templateSelected(name, spec.Templates)
+		if err != nil || !selected {
+			return false, err
+		}
+	}
+	kind := templateKind(data)
+	if _, ok := resolveInjectionPath(spec.Path, kind); !ok {
+		return false, nil
+	}
+	if len(spec.Kinds) == 0 {
+		return true, nil
+	}
+	for _, k := range spec.Kinds {
+		if k == kind {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// templateLine is a content line of a template as seen by the YAML path
+// tracker in injectSnippet.
+type templateLine struct {
+	// path is the YAML path of the mapping key or list item on the line.
+	path string
+	// opens reports whether the line opens a nested block, i.e. it is a key
+	// without an inline value or a list item.
+	opens bool
+	// indent is the column of the line's key (for list items, the column of
+	// the item's content).
+	indent int
+}
+
+// pathFrame is one level of the YAML path tracker.
+type pathFrame struct {
+	indent int
+	seg    string
+	item   bool
+	items  int
+}
+
+// scanTemplateLines tracks the YAML path of every line of a chart template.
+// Template directives on their own line, comments and blank lines are not
+// YAML content and yield a nil entry.
+func scanTemplateLines(lines []string) []*templateLine {
+	result := make([]*templateLine, len(lines))
+	var stack []*pathFrame
+
+	pathOf := func() string {
+		var b strings.Builder
+		for _, f := range stack {
+			if !f.item && b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(f.seg)
+		}
+		return b.String()
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "{{") || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if (top.item && top.indent >= indent) || (!top.item && top.indent > indent) {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+			index := 0
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				index = top.items
+				top.items++
+			}
+			stack = append(stack, &pathFrame{indent: indent, seg: "[" + strconv.Itoa(index) + "]", item: true})
+			result[i] = &templateLine{path: pathOf(), opens: true, indent: indent + 2}
+
+			rest := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if key, _, ok := splitYAMLKey(rest); ok {
+				keyIndent := indent + (len(trimmed) - len(rest))
+				stack = append(stack, &pathFrame{indent: keyIndent, seg: key})
+			}
+			continue
+		}
+
+		key, inline, ok := splitYAMLKey(trimmed)
+		if !ok {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, &pathFrame{indent: indent, seg: key})
+		result[i] = &templateLine{path: pathOf(), opens: inline == "", indent: indent}
+	}
+	return result
+}
+
+// splitYAMLKey splits a "key: value" line into its key and inline value.
+func splitYAMLKey(s string) (key, value string, ok bool) {
+	idx := strings.Index(s, ":")
+	if idx <= 0 || (idx+1 < len(s) && s[idx+1] != ' ') {
+		return "", "", false
+	}
+	key = strings.Trim(s[:idx], `"'`)
+	if strings.ContainsAny(key, "{} ") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(s[idx+1:]), true
+}
+
+// injectAction describes what injectSnippet did with a template.
+type injectAction int
+
+const (
+	// injectInserted means the snippet was inserted.
+	injectInserted injectAction = iota
+	// injectUpdated means a previously injected block was replaced.
+	injectUpdated
+	// injectPresent means the template already contains the snippet.
+	injectPresent
+	// injectSkipped means the chart defines the key itself and was left alone.
+	injectSkipped
+)
+
+// guardDirective matches the `{{- if ... }}` line opening a guarded block.
+var guardDirective = regexp.MustCompile(`^\{\{-?\s*if\s.*\}\}$`)
+
+// endDirective matches the `{{- end }}` line closing a guarded block.
+var endDirective = regexp.MustCompile(`^\{\{-?\s*end\s*-?\}\}$`)
+
+// injectSnippet inserts the spec's snippet into the template text as the first
+// children of the block at spec.Path.
+//
+// Injection is idempotent: if the block already has the snippet's top-level
+// key as a child, the template is returned unchanged when it holds exactly
+// the block that would be inserted. A block wrapped in an `{{- if }}` guard
+// (as injected by a previous run, possibly with another guard or values key)
+// is replaced with the current one. A key the chart defines literally or with
+// other template logic is left alone.
+//
+// Returns:
+//   - The updated template text.
+//   - What was done, as an injectAction.
+//   - An error if spec.Path is not found in the template.
+func injectSnippet(data []byte, spec injectionSpec) ([]byte, injectAction, error) {
+	targetPath, ok := resolveInjectionPath(spec.Path, templateKind(data))
+	if !ok {
+		return nil, injectSkipped, fmt.Errorf("%s has no pod spec", templateKind(data))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	scanned := scanTemplateLines(lines)
+
+	target := -1
+	for i, l := range scanned {
+		if l != nil && l.opens && l.path == targetPath {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		return nil, injectSkipped, fmt.Errorf("path %s not found", targetPath)
+	}
+
+	// The snippet goes at the indentation of the block's existing children,
+	// or two columns deeper than the target when it has none yet.
+	indent := scanned[target].indent + 2
+	if strings.HasPrefix(strings.TrimSpace(lines[target]), "-") {
+		indent = scanned[target].indent
+	}
+	for _, l := range scanned[target+1:] {
+		if l != nil {
+			if l.indent > scanned[target].indent {
+				indent = l.indent
+			}
+			break
+		}
+	}
+
+	snippet := strings.NewReplacer(
+		"${indent}", strconv.Itoa(indent),
+		"${childIndent}", strconv.Itoa(indent+2),
+	).Replace(strings.TrimRight(spec.Snippet, "\n"))
+	prefix := strings.Repeat(" ", indent)
+
+	var block []string
+	if spec.Guard != "" {
+		block = append(block, prefix+"{{- if "+spec.Guard+" }}")
+	}
+	for _, line := range strings.Split(snippet, "\n") {
+		if strings.TrimSpace(line) == "" {
+			block = append(block, "")
+			continue
+		}
+		block = append(block, prefix+line)
+	}
+	if spec.Guard != "" {
+		block = append(block, prefix+"{{- end }}")
+	}
+
+	start, end, guarded := existingSnippetBlock(lines, scanned, targetPath, snippet)
+	if start >= 0 {
+		if strings.Join(lines[start:end], "\n") == strings.Join(block, "\n") {
+			return data, injectPresent, nil
+		}
+		if !guarded {
+			return data, injectSkipped, nil
+		}
+
+		out := make([]string, 0, len(lines)-(end-start)+len(block))
+		out = append(out, lines[:start]...)
+		out = append(out, block...)
+		out = append(out, lines[end:]...)
+		return []byte(strings.Join(out, "\n") + "\n"), injectUpdated, nil
+	}
+
+	out := make([]string, 0, len(lines)+len(block))
+	out = append(out, lines[:target+1]...)
+	out = append(out, block...)
+	out = append(out, lines[target+1:]...)
+	return []byte(strings.Join(out, "\n") + "\n"), injectInserted, nil
+}
+
+// existingSnippetBlock looks for an existing child of the block at parentPath
+// with the same key as the first line of snippet.
+//
+// Returns:
+//   - The range [start, end) of lines holding the existing key and its
+//     content, including the surrounding `{{- if }}` / `{{- end }}` lines when
+//     the key is guarded; start is -1 if the key is not present.
+//   - Whether the key is wrapped in an `{{- if }}` guard.
+func existingSnippetBlock(lines []string, scanned []*templateLine, parentPath, snippet string) (start, end int, guarded bool) {
+	key, _, ok := splitYAMLKey(strings.TrimSpace(strings.SplitN(snippet, "\n", 2)[0]))
+	if !ok {
+		return -1, -1, false
+	}
+
+	keyLine := -1
+	for i, l := range scanned {
+		if l != nil && l.path == parentPath+"."+key {
+			keyLine = i
+			break
+		}
+	}
+	if keyLine < 0 {
+		return -1, -1, false
+	}
+
+	keyIndent := scanned[keyLine].indent
+	end = keyLine + 1
+	for end < len(lines) {
+		line := lines[end]
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.TrimSpace(line) != "" && lineIndent <= keyIndent {
+			break
+		}
+		end++
+	}
+
+	start = keyLine
+	if keyLine > 0 && end < len(lines) &&
+		guardDirective.MatchString(strings.TrimSpace(lines[keyLine-1])) &&
+		endDirective.MatchString(strings.TrimSpace(lines[end])) {
+		start, end, guarded = keyLine-1, end+1, true
+	}
+	return start, end, guarded
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestScanTemplateLines verifies the YAML path tracked for template lines,
+// including list items and lines mixed with template directives.
+func TestScanTemplateLines(t *testing.T) {
+	template := `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    metadata:
+      labels:
+        {{- include "labels" . | nindent 8 }}
+    spec:
+      containers:
+        - name: {{ .Chart.Name }}
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+        - name: sidecar
+      volumes:
+      - name: data
+`
+	scanned := scanTemplateLines(strings.Split(template, "\n"))
+
+	var paths []string
+	for _, l := range scanned {
+		if l != nil {
+			paths = append(paths, l.path)
+		}
+	}
+	expected := []string{
+		"apiVersion", "kind", "spec", "spec.template", "spec.template.metadata",
+		"spec.template.metadata.labels", "spec.template.spec", "spec.template.spec.containers",
+		"spec.template.spec.containers[0]", "spec.template.spec.containers[0].image",
+		"spec.template.spec.containers[1]", "spec.template.spec.volumes", "spec.template.spec.volumes[0]",
+	}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected paths:\n got: %v\nwant: %v", paths, expected)
+	}
+}
+
+// TestInjectSnippet verifies that a snippet is re-indented below its target
+// path, wrapped in its guard and that ${childIndent} is substituted.
+func TestInjectSnippet(t *testing.T) {
+	template := `kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx
+`
+	spec := builtinInjections["resources"]
+	out, _, err := injectSnippet([]byte(template), spec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          {{- if .Values.resources }}
+          resources:
+            {{- toYaml .Values.resources | nindent 12 }}
+          {{- end }}
+          image: nginx
+`
+	if string(out) != expected {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	spec.Path = "spec.missing"
+	if _, _, err := injectSnippet([]byte(template), spec); err == nil {
+		t.Errorf("Expected error for a missing path")
+	}
+}
+
+// TestInjectSnippetIdempotent verifies that re-running an injection leaves the
+// template unchanged, that a previously injected block is updated when the
+// guard changes, and that keys defined by the chart itself are left alone.
+func TestInjectSnippetIdempotent(t *testing.T) {
+	template := `kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+`
+	first, action, err := injectSnippet([]byte(template), pullSecretsInjection("image.imagePullSecret", nil))
+	if err != nil || action != injectInserted {
+		t.Fatalf("Expected insert, got action %v, err %v", action, err)
+	}
+
+	second, action, err := injectSnippet(first, pullSecretsInjection("image.imagePullSecret", nil))
+	if err != nil || action != injectPresent || string(second) != string(first) {
+		t.Errorf("Expected re-run to be a no-op, got action %v, err %v:\n%s", action, err, second)
+	}
+
+	updated, action, err := injectSnippet(first, pullSecretsInjection("global.pullSecret", nil))
+	if err != nil || action != injectUpdated {
+		t.Fatalf("Expected update, got action %v, err %v", action, err)
+	}
+	if strings.Count(string(updated), "imagePullSecrets:") != 1 || !strings.Contains(string(updated), ".Values.global.pullSecret") ||
+		strings.Contains(string(updated), ".Values.image.imagePullSecret") {
+		t.Errorf("Expected the block to be replaced, got:\n%s", updated)
+	}
+
+	literal := `kind: Deployment
+spec:
+  template:
+    spec:
+      imagePullSecrets:
+        - name: registry
+      containers:
+        - name: app
+`
+	out, action, err := injectSnippet([]byte(literal), pullSecretsInjection("image.imagePullSecret", nil))
+	if err != nil || action != injectSkipped || string(out) != literal {
+		t.Errorf("Expected literal imagePullSecrets to be left alone, got action %v, err %v:\n%s", action, err, out)
+	}
+}
+
+// TestLoadInjectionSpecs verifies that injection spec files are validated and
+// that custom specs are applied to a chart together with their values.
+func TestLoadInjectionSpecs(t *testing.T) {
+	dir := t.TempDir()
+	specPath := filepath.Join(dir, "injections.yaml")
+	if err := os.WriteFile(specPath, []byte(`injections:
+  - name: priorityClass
+    kinds: [Deployment]
+    path: spec.template.spec
+    guard: .Values.priorityClassName
+    snippet: |
+      priorityClassName: {{ .Values.priorityClassName }}
+    values:
+      priorityClassName: ""
+`), 0644); err != nil {
+		t.Fatalf("Failed to write spec file: %v", err)
+	}
+
+	specs, err := loadInjectionSpecs(specPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	chart := copyTestChart(t)
+	if _, err := injectChart(chart, specs, chartInjectOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(chart, "templates", "deployment.yaml"))
+	if !strings.Contains(string(deployment), "    spec:\n      {{- if .Values.priorityClassName }}\n      priorityClassName:") {
+		t.Errorf("Expected priorityClassName below the pod spec, got:\n%s", deployment)
+	}
+	values, _ := os.ReadFile(filepath.Join(chart, "values.yaml"))
+	if !strings.Contains(string(values), `priorityClassName: ""`) {
+		t.Errorf("Expected priorityClassName in values.yaml, got:\n%s", values)
+	}
+
+	if err := os.WriteFile(specPath, []byte("injections:\n  - name: broken\n    snippet: x\n"), 0644); err != nil {
+		t.Fatalf("Failed to write spec file: %v", err)
+	}
+	if _, err := loadInjectionSpecs(specPath); err == nil {
+		t.Errorf("Expected error for a spec without a path")
+	}
+}
+
+// TestInjectWorkloadKinds verifies that injections into the pod spec reach
+// StatefulSet and CronJob templates at their kind's pod spec path and skip
+// kinds without a pod spec.
+func TestInjectWorkloadKinds(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: workloads\nversion: 0.1.0\n",
+		"values.yaml": "image:\n  repository: nginx\n",
+		"templates/statefulset.yaml": `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    spec:
+      containers:
+        - name: db
+          image: postgres
+`,
+		"templates/cronjob.yaml": `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "0 0 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: OnFailure
+          containers:
+            - name: backup
+              image: busybox
+`,
+		"templates/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: db
+spec:
+  ports:
+    - port: 5432
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	specs := []injectionSpec{builtinInjections["imagePullSecrets"], builtinInjections["nodeSelector"]}
+	if _, err := injectChart(dir, specs, chartInjectOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cronjob, _ := os.ReadFile(filepath.Join(dir, "templates", "cronjob.yaml"))
+	if !strings.Contains(string(cronjob), "        spec:\n          {{- if .Values.nodeSelector }}\n          nodeSelector:\n            {{- toYaml .Values.nodeSelector | nindent 12 }}") {
+		t.Errorf("Expected nodeSelector in the CronJob pod spec, got:\n%s", cronjob)
+	}
+	statefulset, _ := os.ReadFile(filepath.Join(dir, "templates", "statefulset.yaml"))
+	if !strings.Contains(string(statefulset), "    spec:\n      {{- if .Values.nodeSelector }}") ||
+		!strings.Contains(string(statefulset), "imagePullSecrets:") {
+		t.Errorf("Expected injections in the StatefulSet pod spec, got:\n%s", statefulset)
+	}
+	service, _ := os.ReadFile(filepath.Join(dir, "templates", "service.yaml"))
+	if string(service) != files["templates/service.yaml"] {
+		t.Errorf("Expected Service template to be left untouched, got:\n%s", service)
+	}
+}
+
+// TestInjectResources verifies that inject-resources guards the resources
+// block of the first container and adds the preset requests and limits to
+// values.yaml, keeping values the chart already sets.
+func TestInjectResources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"values.yaml": "resources:\n  limits:\n    memory: 2Gi\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx
+        - name: sidecar
+          image: envoy
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spec, err := resourcesInjection("resources", nil, resourcePresets["small"].override(resourceDefaults{LimitsCPU: "1"}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := injectChart(dir, []injectionSpec{spec}, chartInjectOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(dir, "templates", "deployment.yaml"))
+	want := "        - name: app\n          {{- if .Values.resources }}\n          resources:\n            {{- toYaml .Values.resources | nindent 12 }}\n          {{- end }}\n          image: nginx\n        - name: sidecar\n          image: envoy\n"
+	if !strings.Contains(string(deployment), want) {
+		t.Errorf("Expected a guarded resources block in the first container, got:\n%s", deployment)
+	}
+	values, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	wantValues := "resources:\n  limits:\n    cpu: \"1\"\n    memory: 2Gi\n  requests:\n    cpu: 100m\n    memory: 128Mi\n"
+	if string(values) != wantValues {
+		t.Errorf("Expected values:\n%s\ngot:\n%s", wantValues, values)
+	}
+
+	for _, d := range []resourceDefaults{{}, {RequestsCPU: "lots"}, {RequestsMemory: "1Gi", LimitsMemory: "512Mi"}} {
+		if _, err := resourcesInjection("resources", nil, d); err == nil {
+			t.Errorf("Expected %+v to be rejected", d)
+		}
+	}
+}
+
+// TestInjectLabels verifies that inject-labels includes the labels helper in
+// workload metadata, replacing literal standard labels, adds the helpers to a
+// new _helpers.tpl and leaves the selector and pod labels alone.
+func TestInjectLabels(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: legacy\nversion: 0.1.0\nappVersion: \"1.2.3\"\n",
+		"values.yaml": "replicas: 1\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+`,
+		"templates/statefulset.yaml": `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+  labels:
+    app.kubernetes.io/name: db
+    team: storage
+spec:
+  template:
+    spec:
+      containers:
+        - name: db
+          image: postgres
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed, err := injectLabels(dir, "", nil, chartInjectOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("Expected the chart to change")
+	}
+
+	deployment, _ := os.ReadFile(filepath.Join(dir, "templates", "deployment.yaml"))
+	want := "metadata:\n  labels:\n    {{- include \"legacy.labels\" . | nindent 4 }}\n  name: web\n"
+	if !strings.Contains(string(deployment), want) {
+		t.Errorf("Expected the labels helper in the Deployment metadata, got:\n%s", deployment)
+	}
+	if !strings.Contains(string(deployment), "    matchLabels:\n      app: web\n  template:\n    metadata:\n      labels:\n        app: web\n") {
+		t.Errorf("Expected the selector and pod labels to be left alone, got:\n%s", deployment)
+	}
+	statefulset, _ := os.ReadFile(filepath.Join(dir, "templates", "statefulset.yaml"))
+	want = "  labels:\n    {{- include \"legacy.labels\" . | nindent 4 }}\n    team: storage\nspec:\n"
+	if !strings.Contains(string(statefulset), want) {
+		t.Errorf("Expected the literal standard label to be replaced by the helper, got:\n%s", statefulset)
+	}
+	helpers, _ := os.ReadFile(filepath.Join(dir, "templates", "_helpers.tpl"))
+	for _, name := range []string{"legacy.name", "legacy.chart", "legacy.selectorLabels", "legacy.labels"} {
+		if !strings.Contains(string(helpers), `{{- define "`+name+`" -}}`) {
+			t.Errorf("Expected %s in _helpers.tpl, got:\n%s", name, helpers)
+		}
+	}
+
+	changed, err = injectLabels(dir, "", nil, chartInjectOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error on second run: %v", err)
+	}
+	if changed {
+		t.Error("Expected the second run to leave the chart unchanged")
+	}
+}
+
+// TestInjectLabelsExistingHelper verifies that the prefix of an existing
+// labels helper is reused and that templates including it are left alone.
+func TestInjectLabelsExistingHelper(t *testing.T) {
+	dir := copyTestChart(t)
+	helpersBefore, _ := os.ReadFile(filepath.Join(dir, "templates", "_helpers.tpl"))
+
+	changed, err := injectLabels(dir, "", nil, chartInjectOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("Expected a chart already including mychart.labels to be left unchanged")
+	}
+	helpersAfter, _ := os.ReadFile(filepath.Join(dir, "templates", "_helpers.tpl"))
+	if string(helpersAfter) != string(helpersBefore) {
+		t.Errorf("Expected _helpers.tpl to be left alone, got:\n%s", helpersAfter)
+	}
+}
+
+// TestInjectQuiet verifies that injection status messages go to the log, so
+// --quiet suppresses them.
+func TestInjectQuiet(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"Chart.yaml":                "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"values.yaml":               "replicaCount: 1\n",
+		"templates/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\nspec:\n  template:\n    spec:\n      containers:\n        - name: app\n          image: nginx\n",
+	})
+	var buf bytes.Buffer
+	out := logOut
+	logOut = &buf
+	defer func() { logOut, quiet = out, false }()
+
+	spec := pullSecretsInjection("imagePullSecrets", nil)
+	if _, err := injectChart(dir, []injectionSpec{spec}, chartInjectOptions{DryRun: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "🔧 Injecting") || !strings.Contains(buf.String(), "Dry-run complete") {
+		t.Errorf("Expected the status messages in the log, got %q", buf.String())
+	}
+
+	buf.Reset()
+	quiet = true
+	if _, err := injectChart(dir, []injectionSpec{spec}, chartInjectOptions{DryRun: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected --quiet to suppress the status messages, got %q", buf.String())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var interactive bool
+
+// matchPrompter asks, for every change bump is about to make, whether to
+// make it, in the spirit of `git add -p`.
+type matchPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// all accepts every remaining change without asking.
+	all bool
+	// quit rejects every remaining change without asking.
+	quit bool
+}
+
+// newMatchPrompter returns a prompter that reads answers from in and writes
+// prompts to out.
+func newMatchPrompter(in io.Reader, out io.Writer) *matchPrompter {
+	return &matchPrompter{in: bufio.NewReader(in), out: out}
+}
+
+const matchPrompterHelp = `y - bump this match
+n - do not bump this match
+a - bump this match and all remaining matches
+q - quit; do not bump this match or any remaining match
+? - print help
+`
+
+// Select shows change and reads the answer. It is meant for
+// bumpOptions.Select. End of input counts as "q".
+func (p *matchPrompter) Select(change tagChange) bool {
+	if p.all || p.quit {
+		return p.all
+	}
+
+	for {
+		fmt.Fprintf(p.out, "\n%s at %s\n  %s → %s\nBump this match [y,n,a,q,?]? ", change.Image, change.Path, change.OldValue, change.NewValue)
+		line, err := p.in.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "" && err != nil {
+			fmt.Fprintln(p.out)
+			p.quit = true
+			return false
+		}
+
+		switch answer {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a":
+			p.all = true
+			return true
+		case "q":
+			p.quit = true
+			return false
+		default:
+			fmt.Fprint(p.out, matchPrompterHelp)
+		}
+	}
+}
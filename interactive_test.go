@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestMatchPrompter verifies that interactive answers select which matches
+// are bumped, that "a" and "q" apply to all remaining matches, and that end
+// of input bumps nothing more.
+func TestMatchPrompter(t *testing.T) {
+	newValues := func() map[string]interface{} {
+		return map[string]interface{}{
+			"api":     map[string]interface{}{"image": map[string]interface{}{"repository": "ghcr.io/my-org/api", "tag": "1.0.0"}},
+			"init":    map[string]interface{}{"image": map[string]interface{}{"repository": "ghcr.io/my-org/api", "tag": "1.0.0"}},
+			"migrate": map[string]interface{}{"image": "ghcr.io/my-org/api:1.0.0"},
+		}
+	}
+	bump := func(input string) ([]string, string) {
+		var out bytes.Buffer
+		opts := bumpOptions{Select: newMatchPrompter(strings.NewReader(input), &out).Select}
+		changes, err := bumpTagInValues(newValues(), "ghcr.io/my-org/api", "1.1.0", opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var paths []string
+		for _, c := range changes {
+			paths = append(paths, c.Path)
+		}
+		return paths, out.String()
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"n\ny\nn\n", "init.image.tag"},
+		{"?\ny\na\n", "api.image.tag,init.image.tag,migrate.image"},
+		{"y\nq\n", "api.image.tag"},
+		{"y\n", "api.image.tag"},
+	}
+	for _, tt := range tests {
+		paths, _ := bump(tt.input)
+		if got := strings.Join(paths, ","); got != tt.want {
+			t.Errorf("Input %q: expected %s, got %s", tt.input, tt.want, got)
+		}
+	}
+
+	_, out := bump("?\nq\n")
+	if !strings.Contains(out, "ghcr.io/my-org/api at api.image.tag\n  1.0.0 → 1.1.0") {
+		t.Errorf("Expected the prompt to show the path and tags, got:\n%s", out)
+	}
+	if !strings.Contains(out, matchPrompterHelp) {
+		t.Errorf("Expected help to be printed, got:\n%s", out)
+	}
+}
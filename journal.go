@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultJournalPath is where bump and apply record the changes they make.
+var defaultJournalPath = filepath.Join(".flux-helpers", "history.json")
+
+// changeJournal is the on-disk history of bump runs used by rollback.
+type changeJournal struct {
+	Runs []journalRun `json:"runs"`
+}
+
+// journalRun groups the changes written by a single bump or apply invocation.
+type journalRun struct {
+	ID           string          `json:"id"`
+	Command      string          `json:"command"`
+	Timestamp    time.Time       `json:"timestamp"`
+	RolledBackAt *time.Time      `json:"rolledBackAt,omitempty"`
+	Changes      []journalChange `json:"changes"`
+}
+
+// journalChange is a single value change within a file. Object, Namespace and
+// ValuesKey identify the ConfigMap or Secret for changes made through valuesFrom.
+type journalChange struct {
+	File      string `json:"file"`
+	Object    string `json:"object,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	ValuesKey string `json:"valuesKey,omitempty"`
+	tagChange
+}
+
+// loadChangeJournal reads the journal at path. A missing file yields an empty journal.
+func loadChangeJournal(path string) (*changeJournal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &changeJournal{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change journal: %w", err)
+	}
+
+	var j changeJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("invalid change journal %s: %w", path, err)
+	}
+	return &j, nil
+}
+
+// save writes the journal to path, creating its directory if needed.
+func (j *changeJournal) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal change journal: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write change journal: %w", err)
+	}
+	return nil
+}
+
+// recordJournalRun appends the changes listed in reports to the journal at path
+// as a new run. Nothing is recorded for dry runs or runs without changes.
+//
+// Returns the ID of the recorded run, or "" if nothing was recorded.
+func recordJournalRun(path, command string, reports []fileReport) (string, error) {
+	var changes []journalChange
+	for _, r := range reports {
+		for _, c := range r.Changes {
+			changes = append(changes, journalChange{
+				File:      r.File,
+				Object:    r.Object,
+				Namespace: r.Namespace,
+				ValuesKey: r.ValuesKey,
+				tagChange: c,
+			})
+		}
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	unlock, err := acquireFileLock(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	j, err := loadChangeJournal(path)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	id := now.Format("20060102T150405Z")
+	for n := 2; j.findRun(id) != nil; n++ {
+		id = fmt.Sprintf("%s-%d", now.Format("20060102T150405Z"), n)
+	}
+
+	j.Runs = append(j.Runs, journalRun{ID: id, Command: command, Timestamp: now, Changes: changes})
+	if err := j.save(path); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// findRun returns the run with the given ID, or nil.
+func (j *changeJournal) findRun(id string) *journalRun {
+	for i := range j.Runs {
+		if j.Runs[i].ID == id {
+			return &j.Runs[i]
+		}
+	}
+	return nil
+}
+
+// lastActiveRun returns the most recent run that has not been rolled back, or nil.
+func (j *changeJournal) lastActiveRun() *journalRun {
+	for i := len(j.Runs) - 1; i >= 0; i-- {
+		if j.Runs[i].RolledBackAt == nil {
+			return &j.Runs[i]
+		}
+	}
+	return nil
+}
+
+// RollbackRun restores the old values of every change recorded in run.
+//
+// Changes are reverted in reverse order. A value that no longer holds the tag
+// the run wrote (because it was changed again since) is left alone and
+// reported as skipped.
+//
+// Returns:
+//   - The number of values restored and skipped.
+//   - An error if a file cannot be read, parsed or written.
+func RollbackRun(run *journalRun, dryRun bool) (restored, skipped int, err error) {
+	type target struct {
+		file, object string
+	}
+	var order []target
+	grouped := map[target][]journalChange{}
+	for i := len(run.Changes) - 1; i >= 0; i-- {
+		c := run.Changes[i]
+		t := target{c.File, c.Object}
+		if _, ok := grouped[t]; !ok {
+			order = append(order, t)
+		}
+		grouped[t] = append(grouped[t], c)
+	}
+
+	revert := func(values map[string]interface{}, postRenderers *postRendererView, changes []journalChange, file string) []tagChange {
+		var reverted []tagChange
+		for _, c := range changes {
+			if replaceChangeValue(values, postRenderers, c.Path, c.NewValue, c.OldValue) == 0 {
+				logf("⚠️ %s %s no longer holds %s, skipping\n", file, c.Path, c.NewValue)
+				skipped++
+				continue
+			}
+			if dryRun {
+				logf("[dry-run] Would restore %s %s: %s → %s\n", file, c.Path, c.NewValue, c.OldValue)
+			} else {
+				logf("⏪ Restored %s %s: %s → %s\n", file, c.Path, c.NewValue, c.OldValue)
+			}
+			reverted = append(reverted, tagChange{Image: c.Image, Path: c.Path, OldValue: c.NewValue, NewValue: c.OldValue})
+		}
+		return reverted
+	}
+
+	for _, t := range order {
+		changes := grouped[t]
+
+		if t.object != "" {
+			kind, name, _ := strings.Cut(t.object, "/")
+			ref := valuesReference{Kind: kind, Name: name, ValuesKey: changes[0].ValuesKey}
+			report, err := editValuesReferenceInFile(t.file, changes[0].Namespace, ref, dryRun, func(values map[string]interface{}, report *fileReport) error {
+				report.Changes = revert(values, nil, changes, t.file)
+				restored += len(report.Changes)
+				return nil
+			})
+			if err != nil {
+				return restored, skipped, err
+			}
+			if report == nil {
+				logf("⚠️ %s not found in %s, skipping %d change(s)\n", t.object, t.file, len(changes))
+				skipped += len(changes)
+			}
+			continue
+		}
+
+		err := withFileLock(t.file, func() error {
+			data, err := os.ReadFile(t.file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", t.file, err)
+			}
+			if err := refuseSOPS(t.file, data); err != nil {
+				return err
+			}
+
+			var reverted []tagChange
+			out, err := rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+				reverted = revert(values, postRenderers, changes, t.file)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.file, err)
+			}
+			restored += len(reverted)
+
+			if dryRun || len(reverted) == 0 {
+				return nil
+			}
+			if err := writeFileWithBackup(t.file, detectTextFormat(data).apply(out), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", t.file, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return restored, skipped, err
+		}
+	}
+
+	return restored, skipped, nil
+}
+
+var (
+	journalPath   string
+	rollbackRunID string
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the tags changed by a previous bump from the change journal",
+	Long: "rollback reads the change journal written by bump and apply and restores " +
+		"the previous values of every change made by a run (by default the most " +
+		"recent run that has not been rolled back yet).",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(journalPath); err != nil {
+			return fmt.Errorf("no change journal at %s: %w", journalPath, err)
+		}
+		unlock, err := acquireFileLock(journalPath)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		j, err := loadChangeJournal(journalPath)
+		if err != nil {
+			return err
+		}
+
+		var run *journalRun
+		if rollbackRunID != "" {
+			if run = j.findRun(rollbackRunID); run == nil {
+				return fmt.Errorf("run %s not found in %s", rollbackRunID, journalPath)
+			}
+			if run.RolledBackAt != nil {
+				return fmt.Errorf("run %s was already rolled back at %s", run.ID, run.RolledBackAt.Format(time.RFC3339))
+			}
+		} else if run = j.lastActiveRun(); run == nil {
+			return fmt.Errorf("no run to roll back in %s", journalPath)
+		}
+
+		logf("⏪ Rolling back run %s (%s, %d change(s))\n", run.ID, run.Command, len(run.Changes))
+		restored, skipped, err := RollbackRun(run, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to roll back run %s: %w", run.ID, err)
+		}
+
+		noChangesMade = restored == 0
+		if dryRun {
+			logf("🧪 Dry-run complete. %d value(s) would be restored, %d skipped.\n", restored, skipped)
+			return nil
+		}
+
+		now := time.Now().UTC()
+		run.RolledBackAt = &now
+		if err := j.save(journalPath); err != nil {
+			return err
+		}
+		logf("✅ Restored %d value(s), %d skipped\n", restored, skipped)
+		return nil
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().StringVar(&journalPath, "journal", defaultJournalPath, "Path to the change journal")
+	rollbackCmd.Flags().StringVar(&rollbackRunID, "run", "", "ID of the run to roll back (default: the most recent one)")
+	rollbackCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview the rollback without modifying files")
+	addBackupFlags(rollbackCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestJournalRollback verifies that changes recorded in the change journal by a
+// bump run can be rolled back, restoring the original tags, and that values
+// changed again since the run are skipped.
+func TestJournalRollback(t *testing.T) {
+	dir := t.TempDir()
+	original, err := os.ReadFile("test_files/multiple-bump.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write fixture copy: %v", err)
+	}
+	journal := filepath.Join(dir, ".flux-helpers", "history.json")
+
+	sets := []updateSet{{Files: []string{file}, Images: map[string]string{"busybox": "1.46.0", "alpine": "6.0.0"}}}
+	report, err := runBumpSets(sets, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error bumping: %v", err)
+	}
+	id, err := recordJournalRun(journal, "bump", report.Files)
+	if err != nil || id == "" {
+		t.Fatalf("Expected run to be recorded, got id=%q err=%v", id, err)
+	}
+
+	// Change one of the bumped tags again by hand; rollback must leave it alone.
+	if _, err := runBumpSets([]updateSet{{Files: []string{file}, Images: map[string]string{"alpine": "6.0.1"}}}, false, false); err != nil {
+		t.Fatalf("Unexpected error bumping: %v", err)
+	}
+
+	j, err := loadChangeJournal(journal)
+	if err != nil {
+		t.Fatalf("Unexpected error loading journal: %v", err)
+	}
+	run := j.lastActiveRun()
+	if run == nil || run.ID != id || len(run.Changes) != 2 {
+		t.Fatalf("Unexpected journal run: %+v", run)
+	}
+
+	beforeRollback, _ := os.ReadFile(file)
+	backupSuffix = ".bak"
+	defer func() { backupSuffix = "" }()
+	restored, skipped, err := RollbackRun(run, false)
+	if err != nil {
+		t.Fatalf("Unexpected error rolling back: %v", err)
+	}
+	if restored != 1 || skipped != 1 {
+		t.Errorf("Expected 1 restored and 1 skipped, got: %d restored, %d skipped", restored, skipped)
+	}
+	if backup, err := os.ReadFile(file + ".bak"); err != nil || string(backup) != string(beforeRollback) {
+		t.Errorf("Expected the rolled back file to be backed up first, got err=%v", err)
+	}
+
+	var values map[string]interface{}
+	data, _ := os.ReadFile(file)
+	if _, err := rewriteHelmReleaseValues(data, func(v map[string]interface{}, _ *postRendererView) error { values = v; return nil }); err != nil {
+		t.Fatalf("Failed to parse rolled back file: %v", err)
+	}
+	busybox := values["initContainers"].([]interface{})[0].(map[string]interface{})["image"].(map[string]interface{})["tag"]
+	alpine := values["nested"].(map[string]interface{})["deeper"].(map[string]interface{})["evenDeeper"].(map[string]interface{})["image"].(map[string]interface{})["tag"]
+	if busybox != "1.45.0" || alpine != "6.0.1" {
+		t.Errorf("Unexpected tags after rollback: busybox=%v alpine=%v", busybox, alpine)
+	}
+}
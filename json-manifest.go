@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultJSONIndent is the indentation of re-encoded JSON manifests whose
+// original indentation cannot be detected.
+const defaultJSONIndent = "  "
+
+// isJSONManifest reports whether the manifest data is JSON rather than YAML,
+// whatever the file is called: some pipelines emit HelmReleases as JSON. As
+// JSON is YAML, such manifests are read like any other; only the way they
+// are written back differs.
+func isJSONManifest(data []byte) bool {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))
+	return len(data) > 0 && data[0] == '{'
+}
+
+// jsonManifestIndent returns the indentation of the JSON manifest data: ""
+// for a manifest on a single line, otherwise the leading whitespace of its
+// first indented line.
+func jsonManifestIndent(data []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM)), []byte("\n"))
+	if len(lines) < 2 {
+		return ""
+	}
+	for _, line := range lines[1:] {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]; len(indent) > 0 {
+			return string(indent)
+		}
+	}
+	return defaultJSONIndent
+}
+
+// encodeJSONManifest returns the YAML manifest out, re-encoded by
+// encodeHelmRelease, as JSON formatted like the original JSON manifest: with
+// its indentation (or on a single line), sorted keys, numbers as written and
+// no HTML escaping, and with a trailing newline if the original has one.
+// The output is the same for the same object, so repeated bumps only change
+// the values they update.
+func encodeJSONManifest(out, original []byte) ([]byte, error) {
+	var obj interface{}
+	err := yaml.Unmarshal(out, &obj, func(d *json.Decoder) *json.Decoder {
+		d.UseNumber()
+		return d
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert manifest to JSON: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent := jsonManifestIndent(original); indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(obj); err != nil {
+		return nil, fmt.Errorf("failed to convert manifest to JSON: %w", err)
+	}
+	encoded := buf.Bytes()
+	if !bytes.HasSuffix(bytes.TrimRight(original, " \t\r"), []byte("\n")) {
+		encoded = bytes.TrimSuffix(encoded, []byte("\n"))
+	}
+	return detectTextFormat(original).apply(encoded), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// jsonFixture returns test_files/helmrelease-v2.yaml as JSON indented with
+// indent (on a single line when indent is empty).
+func jsonFixture(t *testing.T, indent string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	var obj interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		t.Fatal(err)
+	}
+	var out []byte
+	if indent == "" {
+		out, err = json.Marshal(obj)
+	} else {
+		out, err = json.MarshalIndent(obj, "", indent)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(out, '\n')
+}
+
+// TestBumpJSONManifest verifies that JSON HelmReleases are bumped in place
+// and stay JSON, whatever their indentation.
+func TestBumpJSONManifest(t *testing.T) {
+	for _, indent := range []string{"", "  ", "\t"} {
+		data := jsonFixture(t, indent)
+		if !isJSONManifest(data) {
+			t.Fatalf("Expected %q to be detected as JSON", data[:10])
+		}
+		result, err := bumpHelmReleaseData(data, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Updated == 0 || !json.Valid(result.Output) {
+			t.Fatalf("Expected a JSON bump, got %d updates:\n%s", result.Updated, result.Output)
+		}
+		if want := strings.Replace(string(data), `"1.7.99"`, `"1.8.0"`, 1); string(result.Output) != want {
+			t.Errorf("Expected only the tag to change, got:\n%s", result.Output)
+		}
+	}
+}
+
+// TestEncodeJSONManifest verifies that re-encoded manifests are written as
+// JSON in the indentation, line endings and trailing newline of the original.
+func TestEncodeJSONManifest(t *testing.T) {
+	out := []byte("kind: HelmRelease\nspec:\n  values:\n    replicas: 12345678901234567890\n    url: https://example.com/?a=1&b=<x>\n")
+	for _, tc := range []struct {
+		name, original, want string
+	}{
+		{"compact", `{"kind":"HelmRelease"}`, `{"kind":"HelmRelease","spec":{"values":{"replicas":12345678901234567890,"url":"https://example.com/?a=1&b=<x>"}}}`},
+		{"indented", "{\r\n    \"kind\": \"HelmRelease\"\r\n}\r\n", "{\r\n    \"kind\": \"HelmRelease\",\r\n    \"spec\": {\r\n        \"values\": {\r\n            \"replicas\": 12345678901234567890,\r\n            \"url\": \"https://example.com/?a=1&b=<x>\"\r\n        }\r\n    }\r\n}\r\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeJSONManifest(out, []byte(tc.original))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Expected:\n%q\ngot:\n%q", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestHelmReleaseFilesInDirJSON verifies that directory scans pick up JSON
+// HelmReleases.
+func TestHelmReleaseFilesInDirJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.json"), jsonFixture(t, "  "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "not-a-manifest"}`), 0644)
+	files, err := helmReleaseFilesInDir(dir)
+	if err != nil || len(files) != 1 || filepath.Base(files[0]) != "app.json" {
+		t.Errorf("Expected app.json, got %v, %v", files, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// utf8BOM is the byte-order mark some Windows editors write at the start of
+// UTF-8 files.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textFormat is the line ending style and byte-order mark of a text file.
+// Rewritten files keep the format of the original, so a bump in a repository
+// edited on Windows only changes the lines it touches instead of the whole
+// file.
+type textFormat struct {
+	// CRLF is set when most lines end with "\r\n".
+	CRLF bool
+	// BOM is set when the file starts with a UTF-8 byte-order mark.
+	BOM bool
+}
+
+// detectTextFormat returns the textFormat of data. Files with mixed line
+// endings count as CRLF when at least half of their lines are.
+func detectTextFormat(data []byte) textFormat {
+	crlf := bytes.Count(data, []byte("\r\n"))
+	return textFormat{
+		CRLF: crlf > 0 && 2*crlf >= bytes.Count(data, []byte("\n")),
+		BOM:  bytes.HasPrefix(data, utf8BOM),
+	}
+}
+
+// apply returns data, whatever its line endings and byte-order mark, in
+// format f. Line endings are only converted to CRLF; LF files are returned
+// with their lines as they are.
+func (f textFormat) apply(data []byte) []byte {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if f.CRLF {
+		data = bytes.ReplaceAll(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	if f.BOM {
+		data = append(append([]byte{}, utf8BOM...), data...)
+	}
+	return data
+}
+
+// keepTextFormat returns data in the textFormat of the file at path, or
+// unchanged if the file does not exist yet.
+func keepTextFormat(path string, data []byte) []byte {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return data
+	}
+	return detectTextFormat(original).apply(data)
+}
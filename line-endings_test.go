@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTextFormat verifies line ending and byte-order mark detection and
+// conversion.
+func TestTextFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, original string
+		want           textFormat
+	}{
+		{"lf", "a: 1\nb: 2\n", textFormat{}},
+		{"crlf", "a: 1\r\nb: 2\r\n", textFormat{CRLF: true}},
+		{"mostly lf", "a: 1\r\nb: 2\nc: 3\n", textFormat{}},
+		{"bom", "\xEF\xBB\xBFa: 1\r\n", textFormat{CRLF: true, BOM: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := detectTextFormat([]byte(tc.original)); got != tc.want {
+				t.Errorf("detectTextFormat(%q) = %+v, want %+v", tc.original, got, tc.want)
+			}
+		})
+	}
+
+	f := textFormat{CRLF: true, BOM: true}
+	if got := string(f.apply([]byte("a: 1\r\nb: 2\n"))); got != "\xEF\xBB\xBFa: 1\r\nb: 2\r\n" {
+		t.Errorf("Unexpected CRLF output %q", got)
+	}
+	if got := string(textFormat{}.apply([]byte("\xEF\xBB\xBFa: 1\n"))); got != "a: 1\n" {
+		t.Errorf("Unexpected LF output %q", got)
+	}
+}
+
+// TestCRLFPreserved verifies that files re-encoded by a bump (here, the
+// values of a valuesFrom ConfigMap) keep their CRLF line endings and
+// byte-order mark.
+func TestCRLFPreserved(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"helmrelease.yaml", "values.yaml"} {
+		data, err := os.ReadFile(filepath.Join("test_files/values-from", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		data = append([]byte("\xEF\xBB\xBF"), strings.ReplaceAll(string(data), "\n", "\r\n")...)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write fixture copy: %v", err)
+		}
+	}
+
+	reports, err := BumpValuesFromReferences(filepath.Join(dir, "helmrelease.yaml"), map[string]string{"ghcr.io/my-org/worker": "1.0.0"}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Expected the ConfigMap and Secret to be followed, got: %+v", reports)
+	}
+
+	out, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if !strings.HasPrefix(string(out), "\xEF\xBB\xBF") {
+		t.Error("Expected the byte-order mark to be kept")
+	}
+	if strings.Count(string(out), "\n") != strings.Count(string(out), "\r\n") {
+		t.Errorf("Expected only CRLF line endings, got:\n%q", out)
+	}
+	if docs := splitYAMLDocuments(out); len(docs) != 2 {
+		t.Errorf("Expected 2 documents split at a CRLF separator, got: %d", len(docs))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	listFiles []string
+	listDir   string
+)
+
+// imageReference is one image found by `list images`.
+type imageReference struct {
+	File string `json:"file"`
+	// Path is the location of the reference, as reported for changes: a
+	// .spec.values path, or one starting with spec.postRenderers.
+	Path  string `json:"path"`
+	Image string `json:"image"`
+	Tag   string `json:"tag"`
+	// Kind is "block" for repository/tag style blocks and "string" for
+	// "repository:tag" strings.
+	Kind string `json:"kind"`
+}
+
+// listImageReferences returns every image reference recognised by matchers in
+// the .spec.values and .spec.postRenderers of the HelmRelease YAML data,
+// sorted by path and image.
+func listImageReferences(file string, data []byte, matchers []imageMatcher) ([]imageReference, error) {
+	var refs []imageReference
+	collect := func(repos []string, find func(string) []imageMatch) {
+		for _, repo := range repos {
+			for _, m := range find(repo) {
+				ref := imageReference{File: file, Path: m.Path, Image: repo, Kind: "string"}
+				if m.Block != nil {
+					ref.Kind = "block"
+					ref.Tag = fmt.Sprint(m.Block[m.TagKey])
+				} else {
+					ref.Tag = strings.TrimPrefix(m.Value, repo+":")
+				}
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	_, err := rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+		collect(collectImageRepositories(values, matchers), func(repo string) []imageMatch {
+			return findImageBlocks(values, repo, matchers)
+		})
+		if postRenderers != nil {
+			collect(postRenderers.repositories(matchers), func(repo string) []imageMatch {
+				return postRenderers.findImages(repo, matchers)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Path != refs[j].Path {
+			return refs[i].Path < refs[j].Path
+		}
+		return refs[i].Image < refs[j].Image
+	})
+	return refs, nil
+}
+
+// helmReleaseFilesInDir returns the YAML (and JSON) files below dir that hold
+// a HelmRelease, in lexical order. Hidden directories such as .git are skipped.
+func helmReleaseFilesInDir(dir string) ([]string, error) {
+	var files []string
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if manifestKind(data) == "HelmRelease" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// writeImageTable prints refs as an aligned table.
+func writeImageTable(w io.Writer, refs []imageReference) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tPATH\tIMAGE\tTAG\tKIND")
+	for _, r := range refs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.File, r.Path, r.Image, r.Tag, r.Kind)
+	}
+	return tw.Flush()
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Inventory the contents of HelmRelease manifests",
+}
+
+var listImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List every image reference with its current tag, path and file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(listFiles) == 0 && listDir == "" {
+			return fmt.Errorf("--file or --dir is required")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+
+		files, err := expandFileGlobs(listFiles)
+		if err != nil {
+			return err
+		}
+		if listDir != "" {
+			found, err := helmReleaseFilesInDir(listDir)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", listDir, err)
+			}
+			for _, f := range found {
+				files = appendUnique(files, f)
+			}
+		}
+
+		// stdout carries the table or JSON.
+		logOut = os.Stderr
+		refs := []imageReference{}
+		bar := startProgress("list images", "file", len(files))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			fileRefs, err := listImageReferences(file, data, matchers)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			refs = append(refs, fileRefs...)
+			bar.Increment()
+		}
+		bar.Done()
+
+		if outputFormat == outputJSON {
+			return writeJSON(os.Stdout, refs)
+		}
+		return writeImageTable(os.Stdout, refs)
+	},
+}
+
+func init() {
+	listImagesCmd.Flags().StringArrayVarP(&listFiles, "file", "f", nil, "HelmRelease YAML file(s) to inspect; globs are expanded (repeatable)")
+	listImagesCmd.Flags().StringVar(&listDir, "dir", "", "Inspect every HelmRelease YAML file below this directory")
+	listImagesCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text (a table) or json")
+	listImagesCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	listCmd.AddCommand(listImagesCmd)
+	rootCmd.AddCommand(listCmd)
+}
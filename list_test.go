@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListImageReferences verifies that structured blocks, image strings and
+// post-renderer references are listed with their tags and paths.
+func TestListImageReferences(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-post-renderers.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	refs, err := listImageReferences("hr.yaml", data, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, r := range refs {
+		got = append(got, fmt.Sprintf("%s %s:%s %s", r.Path, r.Image, r.Tag, r.Kind))
+	}
+	want := []string{
+		"image ghcr.io/my-org/my-api:1.7.99 block",
+		"spec.postRenderers[0].kustomize.images[0] ghcr.io/my-org/worker:2.0.0 block",
+		"spec.postRenderers[0].kustomize.images[1] ghcr.io/my-org/nginx:1.25.0 block",
+		"spec.postRenderers[0].kustomize.patches[0].patch.spec.template.spec.containers[0].image envoyproxy/envoy:1.27.0 string",
+		"spec.postRenderers[0].kustomize.patches[1].patch[0].value ghcr.io/my-org/my-api:1.7.99 string",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected references:\n got %s\nwant %s", strings.Join(got, "\n    "), strings.Join(want, "\n    "))
+	}
+
+	var table bytes.Buffer
+	if err := writeImageTable(&table, refs[:1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "FILE     PATH   IMAGE                  TAG     KIND\nhr.yaml  image  ghcr.io/my-org/my-api  1.7.99  block\n"; table.String() != want {
+		t.Errorf("Unexpected table:\n%s", table.String())
+	}
+}
+
+// TestHelmReleaseFilesInDir verifies that only HelmRelease YAML files are
+// found, and hidden directories are skipped.
+func TestHelmReleaseFilesInDir(t *testing.T) {
+	dir := t.TempDir()
+	hr, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	files := map[string]string{
+		"apps/my-app.yaml":       string(hr),
+		"apps/kustomization.yml": "kind: Kustomization\n",
+		"apps/README.md":         "kind: HelmRelease\n",
+		".git/hr.yaml":           string(hr),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	found, err := helmReleaseFilesInDir(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{filepath.Join(dir, "apps/my-app.yaml")}; fmt.Sprint(found) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, found)
+	}
+}
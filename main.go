@@ -8,17 +8,247 @@
 //
 //   - bump: Allows users to update one or more image tags in a specified
 //     HelmRelease YAML file. The command supports dry-run mode for previewing
-//     changes without modifying the file.
+//     changes without modifying the file. Image references in
+//     .spec.postRenderers kustomize patches and images are bumped too.
+//     HelmReleases annotated flux-helpers.io/ignore: "true", and values next
+//     to a "# flux-helpers:ignore" comment, are left alone.
+//   - list images: Lists every image reference (with its tag, path and file)
+//     in HelmRelease manifests, as a table or JSON.
+//   - graph images: Maps every image to the HelmReleases and environments
+//     using it, marking uses behind the latest version, as a table, JSON,
+//     Graphviz DOT or Mermaid.
+//   - verify: Checks, without changing anything, that the image tags in
+//     HelmRelease manifests match expected versions, and fails if any differs.
+//   - promote: Applies the current tags of images in one environment's
+//     HelmRelease(s) to another environment's file(s).
+//   - train: Bumps images environment by environment (e.g. dev, staging,
+//     then prod), committing each stage and waiting for it to be healthy in
+//     the cluster or at a webhook before the next one starts.
+//   - bump values: Updates image tags in a plain Helm values file, such as a
+//     chart's values.yaml, with the same matchers as bump.
+//   - bump compose, bump aspire: Update the services.<name>.image strings of
+//     a Docker Compose file and the resources.<name>.image strings of an
+//     Aspire manifest JSON file.
+//   - bump chart: Updates the chart version (and optionally the chart name and
+//     sourceRef) of a HelmRelease; for a .spec.chartRef, the version of the
+//     referenced OCIRepository or HelmChart manifest in the same repository.
+//   - bump chart-deps: Updates the dependency versions in a chart's Chart.yaml,
+//     optionally refreshing Chart.lock with helm dependency update.
+//   - bump source: Updates .spec.ref.tag / .spec.ref.semver of OCIRepository
+//     and GitRepository objects, .spec.version of HelmChart objects and
+//     version pins in HelmRepository URLs.
+//   - set: Sets the interval, target namespace, release name and install or
+//     upgrade remediation retries of a HelmRelease, with --dry-run and --diff.
+//   - plan / apply: Computes a reviewable plan of exact changes from an
+//     updates file, and applies exactly that plan. Dependencies declared in
+//     the updates file order the changes into rollout groups, which apply
+//     --group or --commit applies one at a time.
+//   - rollback: Restores the tags changed by a previous bump or apply run from
+//     the change journal.
+//   - changelog: Writes Markdown release notes of the image updates since a
+//     git ref or date, per service and environment, from the change journal
+//     or git history.
+//   - lock / apply-lock: Snapshots every image and tag of a manifest tree
+//     into a lockfile, and forces the manifests back to it.
+//   - drift: Compares the image tags in git with the live HelmReleases (and
+//     optionally the pods) of a cluster and reports mismatches.
+//   - chart inject-pull-secrets: Injects a conditional imagePullSecrets block
+//     into a Helm chart's workload templates and the matching key into its
+//     values.yaml, with --dry-run and --diff previews; --show-render prints
+//     the rendered manifests of the changed templates.
+//     inject-helm-condition is the deprecated spelling of this command.
+//   - chart inject: Applies built-in or spec-file driven injections
+//     (securityContext, resources, nodeSelector, ...) to chart templates.
+//   - chart inject-resources: Injects a guarded resources block into the
+//     first container of workload templates, with the requests and limits of
+//     a preset (small, medium, large) or flags as values.yaml defaults.
+//   - chart inject-labels: Includes a <prefix>.labels helper with the
+//     standard app.kubernetes.io/* labels in the metadata of workload
+//     templates, adding the helpers to _helpers.tpl where missing.
+//   - chart lint: Runs the helm lint rules on a chart; --fix first completes
+//     Chart.yaml, rewrites deprecated apiVersions and adds values keys the
+//     templates reference, and reports what it fixed.
+//   - chart inspect: Pulls a chart from an OCI registry and lists the images
+//     of its default values with the --set arguments that bump them.
+//   - new helmrelease: Writes a HelmRelease skeleton with current API
+//     versions, optionally with its HelmRepository, GitRepository or
+//     OCIRepository.
+//   - new kustomization, new source git|oci|helm: Write Flux Kustomizations
+//     and sources the same way.
+//   - new image-automation: Writes the ImageRepository and ImagePolicy objects
+//     and $imagepolicy markers for the images of a HelmRelease.
+//   - render: Renders a HelmRelease's chart locally with its .spec.values and
+//     prints the manifests, like `helm template`; without --chart-dir, the
+//     chart of an OCIRepository .spec.chartRef is pulled.
+//   - scan deprecations: Renders a HelmRelease's chart for a Kubernetes
+//     version (--k8s-version) and reports objects using deprecated or removed
+//     apiVersions, failing on removed ones.
+//   - fsck: Parses every YAML file below --dir and reports syntax errors,
+//     duplicate keys, tab indentation and duplicate HelmReleases in a file.
+//   - values merge: Deep-merges values files or HelmRelease .spec.values the
+//     way Helm does, with configurable list semantics.
+//   - test e2e --kind: Applies a bumped HelmRelease to a kind cluster running
+//     Flux and checks that its pods run the new images.
+//   - serve: Exposes bump and list images as an HTTP API with bearer token
+//     authentication and a JSON access log.
+//   - webhook: Receives GHCR, Docker Hub and Harbor push events and bumps,
+//     commits and pushes (or proposes) the manifests mapped to the pushed
+//     images.
+//   - fuzz-verify: Runs the round-trip integrity check used by the fuzz tests
+//     against a real manifest without modifying it.
+//   - completion: Prints a bash, zsh, fish or powershell completion script;
+//     --set values complete to the repositories found in the target file.
+//   - docs man: Writes man pages for every command.
+//   - self-update: Replaces the binary with the latest stable or edge release
+//     for the platform after verifying its signed checksum.
+//   - plugin list: Lists the flux-helpers-bump-<kind> plugins on PATH that
+//     bump hands manifests of other kinds to.
 //
 // Flags for the `bump` command:
-//   - --file (-f): Specifies the path to the HelmRelease YAML file.
+//   - --file (-f): Specifies the path to the HelmRelease YAML file; "-" reads
+//     it from stdin and writes the result to stdout.
 //   - --set: Specifies image updates in the form "repo=version". This flag
-//     can be repeated to update multiple images.
-//   - --dry-run: Enables preview mode to display changes without applying them.
+//     can be repeated to update multiple images. repo may be a glob such as
+//     "ghcr.io/my-org/*", and "repo@path=version" only updates the match at
+//     the given .spec.values path.
+//   - --set-regex: Specifies updates in the form "regex=version", applied to
+//     every repository the regular expression fully matches.
+//   - --set-range: Specifies updates in the form "repo=constraint", bumping
+//     repo to the newest tag in its registry that satisfies the semver
+//     constraint; tags are listed with per-registry rate limiting and cached
+//     on disk (--registry-rate, --registry-concurrency, --tag-cache-ttl).
+//   - --dry-run: Enables preview mode to display changes without applying them,
+//     ending with a table of every change and skipped match per file and path.
+//   - --path: Restricts updates to matches at the given .spec.values path(s),
+//     e.g. "sidecars.logging.image", "images.api" or "containers[1].image";
+//     a path without list indexes selects every item of the lists.
+//   - --config: Reads files, image updates and defaults (dry-run, output format)
+//     from a config file; ./flux-helpers.yaml is used when no flags are given.
+//   - --output (-o): Selects text (default) or json output, or github for
+//     GitHub Actions annotations and a step summary.
+//   - --journal: Records every change in a change journal (default
+//     .flux-helpers/history.json) so it can be undone with `rollback`.
+//   - --strict: Fails, before any file is changed, when a requested image
+//     matches no image block in the target file(s).
+//   - --tag-format: Validates new tags with the semver (default), calver, sha,
+//     none or regex:<pattern> profile instead of requiring semantic versions.
+//   - --preserve-prefix / --preserve-suffix: Replace only the semver core of
+//     the current tags, keeping a prefix such as v or a variant suffix such
+//     as -bookworm.
+//   - --create-values-path: Creates a repository/tag block at the given
+//     .spec.values path for a requested image the values do not reference
+//     yet, e.g. in a HelmRelease without .spec.values.
+//   - --concurrency: Bumps up to this many files at the same time, reporting
+//     them in file order.
+//   - --check-exists: Confirms that every new tag exists in its registry
+//     (a manifest request on the registry v2 API) before changing a file.
+//     Private registries are authenticated to with the docker config, or
+//     --registry-user/--registry-password, or per registry with the docker,
+//     basic, token, credential helper, ECR, GCR and ACR mechanisms of a
+//     --registry-config file.
+//   - --policy: Rejects changes that violate the rules of a policy file
+//     (maximum version jump, no pre-releases, major bumps only with
+//     --allow-major), per file and image.
+//   - --post-hook: Runs shell commands after files were changed, with the
+//     changed files and the JSON report in their environment and on stdin.
+//   - --selector (-l): Only bumps HelmReleases whose labels or annotations
+//     match a label selector, e.g. env=prod.
+//   - --from-file: Reads more updates from a file written by CI, as
+//     repo=version or repo:version lines or a JSON object.
+//   - --rewrites: Normalizes the updates with the tag rules (e.g. strip a "v"
+//     prefix) and registry rules (e.g. ghcr.io → a mirror) of a rewrites file
+//     before anything is matched.
+//   - --sops: Decrypts SOPS-encrypted files with the sops binary and writes
+//     the changes back with `sops set`, re-encrypting them for the file's
+//     recipients; without it, encrypted files are refused.
+//   - --image-policy-markers: Skips references carrying a Flux $imagepolicy
+//     marker (the default), or with =update bumps them with a warning.
+//   - --backup, --backup-dir: Back up each file before rewriting it, as
+//     <file>.bak (or --backup=SUFFIX), optionally below a separate directory.
+//   - --name, --namespace (-n), --kube-context, --kubeconfig: Cluster mode.
+//     Bumps the HelmRelease object in a live cluster with a server-side apply
+//     instead of a file; --dry-run=server has the API server validate the
+//     change without persisting it. --reconcile asks Flux to reconcile the
+//     HelmRelease right after a change.
+//   - --reconcile with --commit and --branch: Once the commit is pushed, asks
+//     Flux to reconcile the changed HelmReleases of the cluster, with the
+//     Kustomization and source that apply them (see RequestGitBumpReconcile).
+//   - --follow-values-from: Also bumps tags inside the ConfigMap and Secret
+//     manifests referenced by .spec.valuesFrom that live next to the file.
+//   - --values-schema: Validates the bumped .spec.values against a chart's
+//     values.schema.json (given a chart directory) or a schema file before
+//     writing; --force turns a violation into a warning.
+//   - --verify-render: Renders a local chart with the old and new values and
+//     fails if the bump changes anything but image references;
+//     --verify-render-warn only warns.
+//   - --matcher-profile: Selects the image reference shapes recognised in
+//     values; "extended" adds registry/repository/tag triples and
+//     imageName/imageTag pairs to the default repository/tag blocks and
+//     "repo:tag" strings. Custom matchers can be declared under `matchers` in
+//     the config file.
+//   - --report, --report-md: Write a JSON or Markdown change report artifact
+//     (per-file and per-image changes, dry-run status, timestamps, git SHA).
+//   - --interactive (-i): Asks before each change which matches to bump,
+//     showing their values paths and current tags, like `git add -p`.
+//   - --metrics-file: Writes Prometheus textfile-collector metrics for the
+//     run (bumps applied and skipped, errors, duration).
+//   - --annotate: Appends a provenance comment such as "# bumped to 1.4.2 by
+//     flux-helpers on 2024-05-01 (build 1234)" to every changed line, from
+//     --annotate-template.
+//   - --annotate-metadata: Records the time, author (--bumped-by) and image
+//     changes of a bump in flux-helpers.io/* annotations of the HelmRelease.
+//   - --commit: Commits the changed files with git; --sign gpg|ssh and
+//     --signing-key (or $FLUX_HELPERS_SIGN and $FLUX_HELPERS_SIGNING_KEY)
+//     sign the commit for repositories that require verified commits.
+//   - --branch, --pull-request: Push the commit to a branch and open a pull
+//     request from it on GitHub, GitLab, Azure DevOps or Bitbucket (see
+//     PullRequestProvider).
+//   - --message-template, --branch-template, --pr-title-template,
+//     --pr-body-template: Go templates for the commit message, branch name
+//     and pull request, with fields such as {{.Images}}, {{.File}} and
+//     {{.Date}}; "@file" reads a template from a file.
+//   - --notify: Posts a summary of the applied bumps, with links to the
+//     changed files on the git hosting service, to Slack (slack://), Microsoft
+//     Teams (teams://) or a generic webhook after a successful run.
+//   - --watch: Keeps running and re-applies the updates whenever one of the
+//     target files is created or modified, until interrupted.
+//
+// Every flag of every command can be defaulted in the global settings file
+// (~/.config/flux-helpers/config.yaml, see globalSettings) or with a
+// FLUX_HELPERS_<FLAG> environment variable, e.g. FLUX_HELPERS_OUTPUT=json;
+// --git-author sets the identity of the commits flux-helpers makes.
 //
 // The `splitArg` helper function is used to parse the "repo=version" format
-// into its components, and the `BumpMultipleTags` function (not included in
-// this code) is responsible for applying the updates to the YAML file.
+// into its components, and `bumpHelmReleaseFile` (see flux-helpers.go) is
+// responsible for applying the updates to the YAML file.
+//
+// Exit codes: 0 when changes were applied (or would be, in dry-run mode), 1 on
+// errors, and the value of --exit-code-on-no-change (default 0) when a command
+// succeeds without changing anything, e.g. because no image block matched.
+//
+// Files are rewritten atomically (temporary file + rename) while holding an
+// advisory "<file>.lock" lock, so concurrent invocations against the same
+// manifest serialize; --lock-timeout bounds how long a command waits. A
+// rewrite that loses keys, changes the kind or shrinks the file by more than
+// --max-shrink percent is refused (see checkRewrite).
+// --sanitize (none, default or strict) and --sanitize-path select the fields
+// removed from a HelmRelease that has to be re-encoded (see
+// sanitizeHelmRelease).
+// --audit-log (or $FLUX_HELPERS_AUDIT_LOG) appends a JSON line to an audit
+// log for every command that rewrites manifests or charts or applies to a
+// cluster, and for every serve request and webhook event, with the user,
+// host, arguments, file checksums and outcome (see commandAuditRecord).
+//
+// Remote operations (registry lookups, git clones and pushes, Kubernetes API
+// requests) are retried with exponential backoff on transient failures
+// (--retries, --retry-backoff) and bounded per request by --registry-timeout,
+// --git-timeout and --kube-timeout. --timeout bounds a whole command, and
+// Ctrl+C cancels the remote operations in flight.
+//
+// Stages that work through many files or repositories (bump, tag listing,
+// list images, lock, verify, drift) draw a progress bar when stderr is a
+// terminal and log how long they took; --quiet (-q) prints nothing but errors
+// and the output of the command.
 //
 // Usage example:
 //
@@ -29,83 +259,502 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	filePath string
-	tagArgs  []string
-	dryRun   bool
-	chartPath string
+	filePath         string
+	tagArgs          []string
+	regexArgs        []string
+	dryRun           bool
+	pathArgs         []string
+	createPathArgs   []string
+	preservePrefix   bool
+	tagFormatArg     string
+	preserveSuffix   bool
+	followValuesFrom bool
+	configPath       string
+	outputFormat     string
+	chartPath        string
+	strict           bool
+	valuesSchemaPath string
+	force            bool
+	matcherProfile   string
+	verifyRenderDir  string
+	verifyRenderWarn bool
+)
+
+// Exit codes. A command that completes without changing anything exits with
+// --exit-code-on-no-change instead of exitCodeChanged.
+const (
+	exitCodeChanged = 0
+	exitCodeError   = 1
+)
+
+var (
+	// exitCodeOnNoChange is the exit code used when a command succeeds but
+	// makes no change (e.g. no image block matched).
+	exitCodeOnNoChange int
+	// noChangesMade is set by commands that completed without changing (or,
+	// in dry-run mode, without planning to change) any file.
+	noChangesMade bool
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "flux-helpers",
 	Short: "Flux YAML and HelmRelease automation tools",
 	Long:  "flux-helpers is a CLI tool for manipulating Flux GitOps manifests such as HelmReleases, including safe and automated image tag updates.",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		auditCommand, auditCmd = cmd.CommandPath(), cmd
+		path, required := globalSettingsPath()
+		settings, err := loadGlobalSettings(path, required, cmd.Root())
+		if err != nil {
+			return err
+		}
+		if err := applySettings(cmd, settings, os.LookupEnv); err != nil {
+			return err
+		}
+		if exitCodeOnNoChange < 0 || exitCodeOnNoChange > 255 || exitCodeOnNoChange == exitCodeError {
+			return fmt.Errorf("invalid --exit-code-on-no-change %d (expected 0 or 2-255)", exitCodeOnNoChange)
+		}
+		if _, err := activeSanitizeRules(); err != nil {
+			return err
+		}
+		if retryAttempts < 0 {
+			return fmt.Errorf("invalid --retries %d (expected 0 or more)", retryAttempts)
+		}
+		if _, _, err := parseGitAuthor(gitAuthor); err != nil {
+			return err
+		}
+		if err := loadRegistryAuth(); err != nil {
+			return err
+		}
+		applyCommandTimeout(cmd)
+		return nil
+	},
 }
 
 var bumpCmd = &cobra.Command{
 	Use:   "bump",
 	Short: "Bump one or more image tags in a HelmRelease file",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if filePath == "" || len(tagArgs) == 0 {
-			return fmt.Errorf("you must specify --file and at least one --set repo=version")
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		startedAt := time.Now()
+		defer func() {
+			// In watch mode, metrics are written after every run instead.
+			if !watch {
+				err = writeRunMetrics(metricsFilePath, "bump", dryRun, startedAt, err)
+			}
+		}()
+
+		if err := appendUpdatesFromFile(); err != nil {
+			return err
+		}
+		explicitConfig := configPath != ""
+		if configPath == "" && filePath == "" && len(tagArgs) == 0 {
+			if _, err := os.Stat(defaultConfigFile); err == nil {
+				configPath = defaultConfigFile
+			}
 		}
 
-		updates := map[string]string{}
-		for _, set := range tagArgs {
-			parts := splitArg(set)
-			if parts == nil {
-				return fmt.Errorf("invalid --set format: %s (expected repo=version)", set)
+		if helmReleaseName != "" {
+			return runClusterBump(cmd)
+		}
+		if serverDryRun {
+			return fmt.Errorf("--dry-run=server requires --name (cluster mode)")
+		}
+		if reconcile {
+			if !commitChanges || (commitBranch == "" && branchTemplate == "") {
+				return fmt.Errorf("--reconcile requires --name (cluster mode), or --commit with --branch or --branch-template")
+			}
+			if pullRequestOpen {
+				return fmt.Errorf("--reconcile cannot be combined with --pull-request, as the change is not merged yet")
 			}
-			updates[parts[0]] = parts[1]
 		}
 
-		err := BumpMultipleTagsUniversalAndSanitize(filePath, updates, dryRun)
+		var sets []updateSet
+		if configPath != "" {
+			if filePath != "" || len(tagArgs) > 0 || len(regexArgs) > 0 || len(rangeArgs) > 0 || len(pathArgs) > 0 || len(createPathArgs) > 0 {
+				return fmt.Errorf("--config cannot be combined with --file, --set, --set-regex, --set-range, --from-file, --path or --create-values-path")
+			}
+
+			cfg, err := loadBumpConfig(configPath)
+			if err != nil {
+				return err
+			}
+			applyBumpConfig(cmd.Flags(), cfg, explicitConfig)
+			sets = cfg.Updates
+			for i := range sets {
+				if cmd.Flags().Changed("values-schema") {
+					sets[i].ValuesSchema = valuesSchemaPath
+				}
+				if cmd.Flags().Changed("force") {
+					sets[i].Force = force
+				}
+				if cmd.Flags().Changed("matcher-profile") {
+					sets[i].MatcherProfile = matcherProfile
+				}
+				if cmd.Flags().Changed("verify-render") {
+					sets[i].VerifyRender = verifyRenderDir
+				}
+				if cmd.Flags().Changed("verify-render-warn") {
+					sets[i].VerifyRenderWarn = verifyRenderWarn
+				}
+				if cmd.Flags().Changed("selector") {
+					sets[i].Selector = selectorArg
+				}
+				if cmd.Flags().Changed("target-name") {
+					sets[i].TargetName = targetNameArg
+				}
+				if cmd.Flags().Changed("target-namespace") {
+					sets[i].TargetNamespace = targetNamespaceArg
+				}
+				if cmd.Flags().Changed("tag-format") {
+					sets[i].TagFormat = tagFormatArg
+				}
+				if cmd.Flags().Changed("preserve-prefix") {
+					sets[i].PreservePrefix = preservePrefix
+				}
+				if cmd.Flags().Changed("preserve-suffix") {
+					sets[i].PreserveSuffix = preserveSuffix
+				}
+			}
+		} else {
+			if filePath == "" || len(tagArgs)+len(regexArgs)+len(rangeArgs) == 0 {
+				return fmt.Errorf("you must specify --file and at least one --set repo=version (or --set-regex, --set-range or --from-file), or --config")
+			}
+
+			updates, regexUpdates, err := parseUpdateArgs(tagArgs, regexArgs)
+			if err != nil {
+				return err
+			}
+			ranges, err := parseRangeArgs(rangeArgs)
+			if err != nil {
+				return err
+			}
+			requested := map[string]string{}
+			for _, m := range []map[string]string{updates, ranges} {
+				for repo, version := range m {
+					requested[repo] = version
+				}
+			}
+			createPaths, err := parseCreateValuesPaths(createPathArgs, requested)
+			if err != nil {
+				return err
+			}
+			sets = []updateSet{{
+				Files:             []string{filePath},
+				Images:            updates,
+				ImagesRegex:       regexUpdates,
+				Ranges:            ranges,
+				Paths:             pathArgs,
+				ValuesSchema:      valuesSchemaPath,
+				Force:             force,
+				MatcherProfile:    matcherProfile,
+				VerifyRender:      verifyRenderDir,
+				VerifyRenderWarn:  verifyRenderWarn,
+				Selector:          selectorArg,
+				TargetName:        targetNameArg,
+				TargetNamespace:   targetNamespaceArg,
+				TagFormat:         tagFormatArg,
+				PreservePrefix:    preservePrefix,
+				PreserveSuffix:    preserveSuffix,
+				CreateValuesPaths: createPaths,
+			}}
+		}
+		if err := validateBumpOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+		if filePath == stdioFile {
+			if err := validateStdioBump(cmd.Flags().Changed); err != nil {
+				return err
+			}
+			logOut = os.Stderr
+			journalPath = ""
+		}
+		if err := resolveImageRanges(newRegistryClient(cmd.Context()), sets); err != nil {
+			return err
+		}
+		if err := applyRewrites(sets, rewritesPath); err != nil {
+			return err
+		}
+		if err := validateUpdateSets(sets); err != nil {
+			return err
+		}
+		if err := setPolicy(sets, policyPath, allowMajor); err != nil {
+			return err
+		}
+		setCheckExists(cmd.Context(), sets, checkExists)
+		if bumpConcurrency < 1 {
+			return fmt.Errorf("invalid --concurrency %d (expected at least 1)", bumpConcurrency)
+		}
+		templates, err := validateCommitFlags(cmd)
+		if err != nil {
+			return err
+		}
+		notify, err := parseNotifyTargets(notifyTargets)
 		if err != nil {
-			return fmt.Errorf("failed to bump tags: %w", err)
+			return err
+		}
+
+		for _, flag := range []string{"annotate-template", "annotate-build"} {
+			if cmd.Flags().Changed(flag) && !annotate {
+				return fmt.Errorf("--%s requires --annotate", flag)
+			}
+		}
+		if annotate {
+			annotator, err := newChangeAnnotator(annotateTemplate, annotateBuild, time.Now())
+			if err != nil {
+				return err
+			}
+			for i := range sets {
+				sets[i].annotator = annotator
+			}
 		}
+		if cmd.Flags().Changed("bumped-by") && !annotateMetadata {
+			return fmt.Errorf("--bumped-by requires --annotate-metadata")
+		}
+		if annotateMetadata {
+			if bumpedBy == "" {
+				bumpedBy = defaultBumpedBy()
+			}
+			provenance := &provenanceAnnotator{now: time.Now(), bumpedBy: bumpedBy}
+			for i := range sets {
+				sets[i].provenance = provenance
+			}
+		}
+
+		if interactive {
+			if watch {
+				return fmt.Errorf("--interactive cannot be combined with --watch")
+			}
+			if bumpConcurrency > 1 {
+				return fmt.Errorf("--interactive cannot be combined with --concurrency")
+			}
+			prompter := newMatchPrompter(os.Stdin, logOut)
+			for i := range sets {
+				sets[i].selectChange = prompter.Select
+			}
+		}
+
+		run := func() error {
+			if strict {
+				unmatched, err := findUnmatchedImages(sets, followValuesFrom)
+				if err != nil {
+					return fmt.Errorf("failed to bump tags: %w", err)
+				}
+				if len(unmatched) > 0 {
+					return fmt.Errorf("--strict: no image block found for %s", strings.Join(unmatched, ", "))
+				}
+			}
+
+			startedAt := time.Now()
+			report, err := runBumpSets(sets, dryRun, followValuesFrom)
+			runStats.applied = report.changeCount()
+			// The report is written even when the run fails, so the artifact
+			// records the error.
+			var reportErr error
+			if reportPath != "" || reportMDPath != "" || outputFormat == outputGitHub {
+				rep := newRunReport("bump", dryRun, startedAt, report.Files, err)
+				reportErr = writeRunReport(rep, reportPath, reportMDPath)
+				if outputFormat == outputGitHub {
+					if sErr := appendGitHubStepSummary(rep); reportErr == nil {
+						reportErr = sErr
+					}
+				}
+			}
+			if !dryRun && journalPath != "" && report != nil {
+				if id, jErr := recordJournalRun(journalPath, "bump", report.Files); jErr != nil {
+					logf("⚠️ Failed to record change journal: %v\n", jErr)
+				} else if id != "" {
+					logf("📝 Recorded run %s in %s\n", id, journalPath)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to bump tags: %w", err)
+			}
+			if reportErr != nil {
+				return reportErr
+			}
+			noChangesMade = report.changeCount() == 0
+			if dryRun && outputFormat == outputText {
+				if err := writeDryRunSummary(logWriter(), report.Files); err != nil {
+					return err
+				}
+			}
+			if !dryRun {
+				if err := runPostHooks(cmd.Context(), postHooks, report); err != nil {
+					return err
+				}
+				if err := commitRun(cmd.Context(), report.Files, templates); err != nil {
+					return fmt.Errorf("failed to commit changes: %w", err)
+				}
+				if reconcile && report.changeCount() > 0 {
+					kc, err := newKubeClient(kubeconfigPath, kubeContext, kubeNamespace)
+					if err != nil {
+						return err
+					}
+					if err := RequestGitBumpReconcile(cmd.Context(), kc, report.Files); err != nil {
+						return err
+					}
+				}
+				sendNotifications(cmd.Context(), notify, "bump", report.Files)
+			}
 
+			switch outputFormat {
+			case outputJSON:
+				return writeJSON(os.Stdout, report)
+			case outputGitHub:
+				return writeGitHubAnnotations(os.Stdout, report.Files, dryRun)
+			}
+			return nil
+		}
+
+		if !watch {
+			return run()
+		}
+		runAndRecord := func() error {
+			startedAt := time.Now()
+			return writeRunMetrics(metricsFilePath, "bump", dryRun, startedAt, run())
+		}
+		if err := watchBumpSets(cmd.Context(), sets, followValuesFrom, runAndRecord); err != nil {
+			return err
+		}
+		// A watch ends on an interrupt, which is not a "no change" outcome.
+		noChangesMade = false
 		return nil
 	},
 }
 
 var injectCmd = &cobra.Command{
-	Use:   "inject-helm-condition",
-	Short: "Inject conditional block into Helm deployment.yaml templates",
+	Use:        "inject-helm-condition",
+	Short:      "Inject conditional block into Helm deployment.yaml templates",
+	Deprecated: "use `flux-helpers chart inject-pull-secrets` instead",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if chartPath == "" {
 			return fmt.Errorf("you must specify --chart pointing to a Helm chart directory")
 		}
 
-		err := InjectImagePullSecrets(chartPath)
+		changed, err := injectImagePullSecrets(chartPath, injectOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to inject: %w", err)
 		}
-
-		fmt.Println("✅ Injection complete")
+		noChangesMade = !changed
 		return nil
 	},
 }
 
-
 func init() {
 	bumpCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
-	bumpCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version (repeatable)")
-	bumpCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
-    
+	bumpCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version; repo may be a glob like ghcr.io/my-org/* (repeatable)")
+	bumpCmd.Flags().StringArrayVar(&postHooks, "post-hook", nil, "Shell command to run after files were changed, with the JSON report on stdin and in $FLUX_HELPERS_HOOK_REPORT (repeatable)")
+	bumpCmd.Flags().StringVarP(&selectorArg, "selector", "l", "", "Only bump HelmReleases whose labels or annotations match this selector, e.g. env=prod")
+	bumpCmd.Flags().StringVar(&targetNameArg, "target-name", "", "Only bump HelmReleases whose metadata.name matches this glob, e.g. api-*")
+	bumpCmd.Flags().StringVar(&targetNamespaceArg, "target-namespace", "", "Only bump HelmReleases whose metadata.namespace matches this glob")
+	bumpCmd.Flags().StringVar(&fromFilePath, "from-file", "", "Read more updates from this file: one repo=version or repo:version per line, or a JSON object of repo: version (- for stdin)")
+	_ = bumpCmd.RegisterFlagCompletionFunc("set", completeSetRepositories)
+	bumpCmd.Flags().StringArrayVar(&regexArgs, "set-regex", nil, "Image update(s) in the form regex=version, matched against whole repository names (repeatable)")
+	bumpCmd.Flags().StringArrayVar(&rangeArgs, "set-range", nil, "Image update(s) in the form repo=constraint, bumped to the newest registry tag satisfying the semver constraint (repeatable)")
+	bumpCmd.Flags().Var(&dryRunFlag{enabled: &dryRun, server: &serverDryRun}, "dry-run", "Preview changes without modifying the file; in cluster mode, =server validates the change on the API server")
+	bumpCmd.Flags().Lookup("dry-run").NoOptDefVal = "true"
+	bumpCmd.Flags().StringVar(&configPath, "config", "", "Path to a bump config file (default: ./"+defaultConfigFile+" when no --file/--set is given)")
+	bumpCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json or github (GitHub Actions annotations and step summary)")
+	bumpCmd.Flags().BoolVar(&followValuesFrom, "follow-values-from", false, "Also bump tags in ConfigMaps/Secrets referenced by .spec.valuesFrom in the same directory")
+	bumpCmd.Flags().StringVar(&journalPath, "journal", defaultJournalPath, "Record changes in this change journal for rollback (empty to disable)")
+	bumpCmd.Flags().StringVar(&helmReleaseName, "name", "", "Bump the HelmRelease with this name in a live cluster instead of a file")
+	bumpCmd.Flags().StringVarP(&kubeNamespace, "namespace", "n", "", "Namespace of the HelmRelease in cluster mode, or of HelmReleases without one with --reconcile (default: the kubeconfig context's namespace)")
+	bumpCmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubeconfig context to use in cluster mode and for --reconcile (default: the current context)")
+	bumpCmd.Flags().BoolVar(&reconcile, "reconcile", false, "Ask Flux to reconcile the HelmRelease right after a change: in cluster mode, or once --commit pushed it to --branch (with the Kustomization and source applying it)")
+	bumpCmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", "", "Path to the kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
+	bumpCmd.Flags().BoolVar(&strict, "strict", false, "Fail without changing anything if a requested image matches no image block")
+	bumpCmd.Flags().StringVar(&valuesSchemaPath, "values-schema", "", "Chart directory or values.schema.json the bumped .spec.values must satisfy before writing")
+	bumpCmd.Flags().BoolVar(&force, "force", false, "Write values that violate --values-schema, with a warning")
+	bumpCmd.Flags().StringVar(&verifyRenderDir, "verify-render", "", "Render this chart directory with the old and new values and fail if anything but image references changes")
+	bumpCmd.Flags().BoolVar(&verifyRenderWarn, "verify-render-warn", false, "Only warn when --verify-render finds changes other than image references")
+	bumpCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended (adds registry keys and imageName/imageTag pairs) or none (config file matchers only)")
+	bumpCmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON change report (files, images, old/new values, timestamps, git SHA) to this file")
+	bumpCmd.Flags().StringVar(&reportMDPath, "report-md", "", "Write the change report as Markdown to this file")
+	bumpCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Ask before each change, showing its values path and current tag")
+	bumpCmd.Flags().StringVar(&metricsFilePath, "metrics-file", "", "Write Prometheus textfile-collector metrics (bumps applied/skipped, errors, duration) to this file")
+	bumpCmd.Flags().BoolVar(&annotate, "annotate", false, "Append a provenance comment to every changed line")
+	bumpCmd.Flags().StringVar(&annotateTemplate, "annotate-template", defaultAnnotateTemplate, "Go template for --annotate comments (fields: .Image, .Path, .OldValue, .NewValue, .Version, .Date, .Build; func: env)")
+	bumpCmd.Flags().StringVar(&annotateBuild, "annotate-build", os.Getenv(annotateBuildEnv), "Build identifier for --annotate comments (default: $"+annotateBuildEnv+")")
+	bumpCmd.Flags().BoolVar(&annotateMetadata, "annotate-metadata", false, "Record the bump in the HelmRelease annotations "+lastBumpAnnotation+", "+bumpedByAnnotation+" and "+imageChangesAnnotation)
+	bumpCmd.Flags().StringVar(&bumpedBy, "bumped-by", "", "Value of the "+bumpedByAnnotation+" annotation (default: $GITHUB_ACTOR or the local user)")
+	addCommitFlags(bumpCmd)
+	addNotifyFlag(bumpCmd)
+	bumpCmd.Flags().BoolVar(&watch, "watch", false, "Keep running and re-apply the updates whenever the target files change")
+	bumpCmd.Flags().StringArrayVar(&pathArgs, "path", nil, "Only update matches at this .spec.values path, e.g. sidecars.logging.image (repeatable)")
+	bumpCmd.Flags().StringVar(&tagFormatArg, "tag-format", tagFormatSemver, "Format new tags must have: semver, calver (e.g. 2024.05.01-build.7), sha (git commit SHAs), none (any tag) or regex:<pattern>")
+	bumpCmd.Flags().BoolVar(&preservePrefix, "preserve-prefix", false, "Keep the text before the semver core of the current tag, e.g. v in v1.2.3, when the new version has none")
+	bumpCmd.Flags().BoolVar(&preserveSuffix, "preserve-suffix", false, "Keep the text after the semver core of the current tag, e.g. -bookworm in 1.2.3-bookworm, when the new version has none")
+	bumpCmd.Flags().StringArrayVar(&createPathArgs, "create-values-path", nil, "Create a repository/tag block at this .spec.values path for a --set image the values do not reference yet, as repo=path or path with a single image (repeatable)")
+	bumpCmd.Flags().IntVar(&bumpConcurrency, "concurrency", bumpConcurrency, "Number of files to bump at the same time; results are reported in file order")
+	addBackupFlags(bumpCmd)
+	addPolicyFlags(bumpCmd)
+	bumpCmd.Flags().StringVar(&rewritesPath, "rewrites", "", "Rewrite the tags and registries of the updates with the rules of this rewrites file")
+	bumpCmd.PersistentFlags().Var(&imagePolicyModeFlag{mode: &imagePolicyMode}, "image-policy-markers", "What to do with references carrying a Flux $imagepolicy marker: skip (leave them to the image-automation-controller) or update (bump them anyway, with a warning)")
+	bumpCmd.Flags().BoolVar(&sopsMode, "sops", false, "Decrypt SOPS-encrypted HelmRelease files with the sops binary and re-encrypt the changed values for the file's recipients")
+	bumpCmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a new image tag does not exist in its registry, before the file is changed")
+
 	injectCmd.Flags().StringVar(&chartPath, "chart", "", "Path to Helm chart directory")
+	rootCmd.PersistentFlags().IntVar(&exitCodeOnNoChange, "exit-code-on-no-change", exitCodeChanged, "Exit code to use when a command succeeds without changing anything, e.g. 2 for CI gating")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "How long to wait for another flux-helpers process to release a file lock")
 	rootCmd.AddCommand(bumpCmd)
 	rootCmd.AddCommand(injectCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := newRunContext()
+	err := rootCmd.ExecuteContext(ctx)
+	cancelCommandTimeout()
+	stop()
+	if aErr := writeAuditLog(os.Args[1:], err, auditedRun()); aErr != nil {
+		if err == nil {
+			err = fmt.Errorf("changes were made, but failed to record them in the audit log: %w", aErr)
+		} else {
+			fmt.Println("❌ failed to record the changes in the audit log:", aErr)
+		}
+	}
+	if err != nil {
+		abortProgress()
+		if outputFormat == outputGitHub {
+			writeGitHubError(os.Stdout, err)
+		}
 		fmt.Println("❌", err)
-		os.Exit(1)
+		os.Exit(exitCodeError)
 	}
+	if noChangesMade && exitCodeOnNoChange != exitCodeChanged {
+		logln("ℹ️ No changes made")
+		os.Exit(exitCodeOnNoChange)
+	}
+}
+
+// parseUpdateArgs parses the --set and --set-regex arguments into maps from
+// repository (or glob, or regular expression) to version.
+func parseUpdateArgs(setArgs, setRegexArgs []string) (map[string]string, map[string]string, error) {
+	updates := map[string]string{}
+	for _, set := range setArgs {
+		parts := splitArg(set)
+		if parts == nil {
+			return nil, nil, fmt.Errorf("invalid --set format: %s (expected repo=version)", set)
+		}
+		updates[parts[0]] = parts[1]
+	}
+
+	regexUpdates := map[string]string{}
+	for _, set := range setRegexArgs {
+		parts := splitRegexArg(set)
+		if parts == nil {
+			return nil, nil, fmt.Errorf("invalid --set-regex format: %s (expected regex=version)", set)
+		}
+		regexUpdates[parts[0]] = parts[1]
+	}
+	return updates, regexUpdates, nil
 }
 
 // splitArg splits "repo=version" into [repo, version]
@@ -116,3 +765,13 @@ func splitArg(s string) []string {
 	}
 	return parts
 }
+
+// splitRegexArg splits "regex=version" into [regex, version] at the last "=",
+// since the version never contains one but the expression might.
+func splitRegexArg(s string) []string {
+	i := strings.LastIndex(s, "=")
+	if i <= 0 || strings.TrimSpace(s[:i]) == "" || strings.TrimSpace(s[i+1:]) == "" {
+		return nil
+	}
+	return []string{s[:i], s[i+1:]}
+}
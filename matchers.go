@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// imageMatcher describes one shape of image reference in a values tree.
+//
+// A block matcher (TagKey set) matches maps holding the repository under
+// RepositoryKey (default "repository") and the tag under TagKey. With
+// RegistryKey, the registry is a separate key and the image name is
+// "<registry>/<repository>".
+//
+// A string matcher (TagKey empty) matches "repository:tag" strings stored
+// under one of Keys, or under any key when Keys is empty.
+//
+// Custom matchers can be declared under `matchers` in config and updates
+// files, e.g.:
+//
+//	matchers:
+//	  - name: container-image
+//	    keys: [containerImage]
+//	  - name: version-key
+//	    repositoryKey: repository
+//	    tagKey: version
+type imageMatcher struct {
+	Name          string   `json:"name"`
+	RepositoryKey string   `json:"repositoryKey,omitempty"`
+	RegistryKey   string   `json:"registryKey,omitempty"`
+	TagKey        string   `json:"tagKey,omitempty"`
+	Keys          []string `json:"keys,omitempty"`
+}
+
+// isBlock reports whether m matches structured blocks rather than strings.
+func (m imageMatcher) isBlock() bool {
+	return m.TagKey != ""
+}
+
+// blockImage returns the image name of block according to m, or "" if block
+// does not have the shape m describes.
+func (m imageMatcher) blockImage(block map[string]interface{}) string {
+	repositoryKey := m.RepositoryKey
+	if repositoryKey == "" {
+		repositoryKey = "repository"
+	}
+	repo, ok := block[repositoryKey].(string)
+	if !ok || repo == "" {
+		return ""
+	}
+	if m.RegistryKey == "" {
+		return repo
+	}
+	registry, ok := block[m.RegistryKey].(string)
+	if !ok || registry == "" {
+		return ""
+	}
+	return strings.TrimSuffix(registry, "/") + "/" + repo
+}
+
+// validate checks that m describes either a block or a string matcher.
+func (m imageMatcher) validate() error {
+	if m.isBlock() {
+		if len(m.Keys) > 0 {
+			return fmt.Errorf("matcher %q: keys cannot be combined with tagKey", m.Name)
+		}
+		return nil
+	}
+	if m.RepositoryKey != "" || m.RegistryKey != "" {
+		return fmt.Errorf("matcher %q: repositoryKey and registryKey require tagKey", m.Name)
+	}
+	return nil
+}
+
+// acceptsKey reports whether a string matcher applies to a value stored under key.
+func (m imageMatcher) acceptsKey(key string) bool {
+	if len(m.Keys) == 0 {
+		return true
+	}
+	for _, k := range m.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Built-in matchers.
+var (
+	// repositoryTagMatcher matches `repository: ...` + `tag: ...` blocks.
+	repositoryTagMatcher = imageMatcher{Name: "repository-tag", RepositoryKey: "repository", TagKey: "tag"}
+	// registryRepositoryTagMatcher matches blocks that keep the registry in a
+	// separate `registry` key, as Bitnami charts do.
+	registryRepositoryTagMatcher = imageMatcher{Name: "registry-repository-tag", RegistryKey: "registry", RepositoryKey: "repository", TagKey: "tag"}
+	// imageNameTagMatcher matches `imageName: ...` + `imageTag: ...` pairs.
+	imageNameTagMatcher = imageMatcher{Name: "imageName-imageTag", RepositoryKey: "imageName", TagKey: "imageTag"}
+	// imageStringMatcher matches "repository:tag" strings under any key, e.g.
+	// `image: ghcr.io/my-org/my-api:1.0.0` or Aspire-style image maps.
+	imageStringMatcher = imageMatcher{Name: "image-string"}
+)
+
+// defaultMatcherProfile is the matcher profile used when none is given.
+const defaultMatcherProfile = "default"
+
+// noMatcherProfile selects no built-in matcher, so only custom matchers apply.
+const noMatcherProfile = "none"
+
+// matcherProfiles are the named sets of matchers selectable with
+// --matcher-profile. "default" keeps the historical behaviour; "extended"
+// also recognises separate registry keys and imageName/imageTag pairs.
+var matcherProfiles = map[string][]imageMatcher{
+	defaultMatcherProfile: {repositoryTagMatcher, imageStringMatcher},
+	"extended":            {repositoryTagMatcher, registryRepositoryTagMatcher, imageNameTagMatcher, imageStringMatcher},
+	noMatcherProfile:      nil,
+}
+
+// lookupMatcherProfile returns the matchers of the named profile; an empty
+// name selects the default profile.
+func lookupMatcherProfile(name string) ([]imageMatcher, error) {
+	if name == "" {
+		name = defaultMatcherProfile
+	}
+	matchers, ok := matcherProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(matcherProfiles))
+		for n := range matcherProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown matcher profile %q (expected one of: %s)", name, strings.Join(names, ", "))
+	}
+	return matchers, nil
+}
+
+// setMatchers returns the matchers used for an update set: those of its
+// matcher profile followed by its custom matchers. The "none" profile is
+// typically used to restrict string matching to the keys of custom matchers.
+func setMatchers(profile string, custom []imageMatcher) ([]imageMatcher, error) {
+	matchers, err := lookupMatcherProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range custom {
+		if err := m.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(matchers)+len(custom) == 0 {
+		return nil, fmt.Errorf("matcher profile %q needs custom matchers", noMatcherProfile)
+	}
+	return append(append([]imageMatcher(nil), matchers...), custom...), nil
+}
+
+// shareMatchers adds the file-level matchers of a config or updates file to
+// each of its update sets, ahead of the sets' own matchers.
+func shareMatchers(sets []updateSet, matchers []imageMatcher) {
+	if len(matchers) == 0 {
+		return
+	}
+	for i := range sets {
+		sets[i].Matchers = append(append([]imageMatcher(nil), matchers...), sets[i].Matchers...)
+	}
+}
+
+// matchersOrDefault returns matchers, or the default profile's matchers when
+// matchers is empty.
+func matchersOrDefault(matchers []imageMatcher) []imageMatcher {
+	if len(matchers) == 0 {
+		return matcherProfiles[defaultMatcherProfile]
+	}
+	return matchers
+}
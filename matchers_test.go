@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMatcherProfiles verifies that the extended profile recognises plain
+// "image: repo:tag" scalars, imageName/imageTag pairs and registry keys, while
+// the default profile keeps matching only repository/tag blocks and strings.
+func TestMatcherProfiles(t *testing.T) {
+	newValues := func() map[string]interface{} {
+		return map[string]interface{}{
+			"api": map[string]interface{}{"image": "ghcr.io/my-org/api:1.0.0"},
+			"worker": map[string]interface{}{
+				"imageName": "ghcr.io/my-org/worker",
+				"imageTag":  "1.0.0",
+			},
+			"redis": map[string]interface{}{
+				"image": map[string]interface{}{
+					"registry":   "docker.io",
+					"repository": "bitnami/redis",
+					"tag":        "7.2.0",
+				},
+			},
+		}
+	}
+
+	extended, err := lookupMatcherProfile("extended")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	values := newValues()
+	updated, changes, err := applyImageUpdates(values, map[string]string{
+		"ghcr.io/my-org/api":      "1.1.0",
+		"ghcr.io/my-org/worker":   "1.1.0",
+		"docker.io/bitnami/redis": "7.4.0",
+	}, bumpOptions{Matchers: extended})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("Expected 3 updated images, got %d: %v", updated, changes)
+	}
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if got, want := strings.Join(paths, ","), "redis.image.tag,api.image,worker.imageTag"; got != want {
+		t.Errorf("Expected changes at %s, got %s", want, got)
+	}
+	if values["worker"].(map[string]interface{})["imageTag"] != "1.1.0" {
+		t.Errorf("Expected imageTag to be bumped, got %v", values["worker"])
+	}
+
+	if got := collectImageRepositories(newValues(), extended); !strings.Contains(strings.Join(got, ","), "docker.io/bitnami/redis") {
+		t.Errorf("Expected the registry-qualified repository to be collected, got %v", got)
+	}
+
+	// The default profile ignores imageName/imageTag pairs and only matches
+	// the registry block by its bare repository.
+	values = newValues()
+	if m := findImageBlocks(values, "ghcr.io/my-org/worker", nil); len(m) != 0 {
+		t.Errorf("Expected no match for imageName/imageTag with the default profile, got %v", m)
+	}
+	if m := findImageBlocks(values, "docker.io/bitnami/redis", nil); len(m) != 0 {
+		t.Errorf("Expected no registry-qualified match with the default profile, got %v", m)
+	}
+	if m := findImageBlocks(values, "bitnami/redis", nil); len(m) != 1 {
+		t.Errorf("Expected the bare repository to match with the default profile, got %v", m)
+	}
+
+	if _, err := lookupMatcherProfile("bogus"); err == nil {
+		t.Errorf("Expected an error for an unknown matcher profile")
+	}
+}
+
+// TestCustomMatchers verifies that matchers declared in a config file extend
+// matching to bespoke layouts, and that with the "none" profile only the keys
+// of custom string matchers are considered.
+func TestCustomMatchers(t *testing.T) {
+	dir := t.TempDir()
+	hr := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    api:
+      containerImage: ghcr.io/my-org/api:1.0.0
+    other:
+      note: ghcr.io/my-org/api:1.0.0
+    worker:
+      repository: ghcr.io/my-org/worker
+      version: 1.0.0
+`
+	file := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(file, []byte(hr), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	config := `matchers:
+  - name: container-image
+    keys: [containerImage]
+  - name: version-key
+    tagKey: version
+updates:
+  - files: [` + file + `]
+    matcherProfile: none
+    images:
+      ghcr.io/my-org/api: 1.1.0
+      ghcr.io/my-org/worker: 1.1.0
+`
+	configPath := filepath.Join(dir, "flux-helpers.yaml")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := loadBumpConfig(configPath)
+	if err != nil {
+		t.Fatalf("Unexpected error loading config: %v", err)
+	}
+	report, err := runBumpSets(cfg.Updates, false, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var paths []string
+	for _, c := range report.Files[0].Changes {
+		paths = append(paths, c.Path)
+	}
+	if got, want := strings.Join(paths, ","), "api.containerImage,worker.version"; got != want {
+		t.Errorf("Expected changes at %s, got %s", want, got)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "note: ghcr.io/my-org/api:1.0.0") {
+		t.Errorf("Expected keys without a matcher to be left alone, got:\n%s", data)
+	}
+
+	bad := strings.Replace(config, "tagKey: version", "registryKey: registry", 1)
+	if err := os.WriteFile(configPath, []byte(bad), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := loadBumpConfig(configPath); err == nil {
+		t.Errorf("Expected an error for a string matcher with registryKey")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var metricsFilePath string
+
+// runStats counts the outcomes of the current run for --metrics-file.
+// bumpTagInValues counts skipped matches; commands set applied from their
+// report.
+var runStats struct {
+	applied int
+	skipped int
+}
+
+// runStatsMu guards runStats.skipped, which is counted by concurrent bumps.
+var runStatsMu sync.Mutex
+
+// countSkipped adds n skipped matches to runStats.
+func countSkipped(n int) {
+	runStatsMu.Lock()
+	runStats.skipped += n
+	runStatsMu.Unlock()
+}
+
+// metricsPrefix is prepended to the name of every metric.
+const metricsPrefix = "flux_helpers_"
+
+// runMetric is one sample written to the metrics file.
+type runMetric struct {
+	name  string
+	help  string
+	kind  string // "counter" or "gauge"
+	value float64
+}
+
+// writeRunMetrics writes the metrics of a run that started at startedAt to
+// path in the Prometheus text format, for the node exporter's textfile
+// collector, and resets runStats.
+//
+// Counters (bumps_applied_total, bumps_skipped_total, errors_total) are added
+// to the values already in the file, so they keep growing across runs; gauges
+// (duration_seconds, last_run_timestamp_seconds) describe the latest run. The
+// file is replaced atomically so the collector never reads a partial file.
+//
+// Parameters:
+//   - path: The metrics file; nothing is written when empty.
+//   - command: The command that ran, used as the "command" label.
+//   - dryRun: Whether the run was a dry-run, used as the "dry_run" label.
+//   - startedAt: When the run started.
+//   - runErr: The outcome of the run; a non-nil error counts as one error.
+//
+// Returns:
+//   - runErr, or an error if runErr is nil and the file cannot be written.
+func writeRunMetrics(path, command string, dryRun bool, startedAt time.Time, runErr error) error {
+	runStatsMu.Lock()
+	stats := runStats
+	runStats.applied, runStats.skipped = 0, 0
+	runStatsMu.Unlock()
+	if path == "" {
+		return runErr
+	}
+
+	errors := 0
+	if runErr != nil {
+		errors = 1
+	}
+	metrics := []runMetric{
+		{name: "bumps_applied_total", help: "Image tag changes applied (or planned, with dry_run=\"true\").", kind: "counter", value: float64(stats.applied)},
+		{name: "bumps_skipped_total", help: "Image matches skipped because they were up to date, invalid, unmatched or deselected.", kind: "counter", value: float64(stats.skipped)},
+		{name: "errors_total", help: "Runs that failed with an error.", kind: "counter", value: float64(errors)},
+		{name: "duration_seconds", help: "Duration of the last run in seconds.", kind: "gauge", value: time.Since(startedAt).Seconds()},
+		{name: "last_run_timestamp_seconds", help: "Unix time at which the last run finished.", kind: "gauge", value: float64(time.Now().Unix())},
+	}
+
+	labels := fmt.Sprintf(`{command=%q,dry_run="%t"}`, command, dryRun)
+	previous := readMetricSamples(path)
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		name := metricsPrefix + m.name
+		series := name + labels
+		value := m.value
+		if m.kind == "counter" {
+			value += previous[series]
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind)
+		// Keep the series of other commands and dry-run modes.
+		for _, other := range sortedSeries(previous, name+"{") {
+			if other != series {
+				fmt.Fprintf(&buf, "%s %s\n", other, strconv.FormatFloat(previous[other], 'g', -1, 64))
+			}
+		}
+		fmt.Fprintf(&buf, "%s %s\n", series, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		if runErr != nil {
+			logf("⚠️ Failed to write metrics file: %v\n", err)
+			return runErr
+		}
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return runErr
+}
+
+// readMetricSamples reads the samples of a metrics file written by
+// writeRunMetrics, keyed by series (name and labels). A missing or malformed
+// file yields no samples.
+func readMetricSamples(path string) map[string]float64 {
+	samples := map[string]float64{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return samples
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			continue
+		}
+		samples[line[:i]] = value
+	}
+	return samples
+}
+
+// sortedSeries returns the series of samples starting with prefix, sorted.
+func sortedSeries(samples map[string]float64, prefix string) []string {
+	var series []string
+	for s := range samples {
+		if strings.HasPrefix(s, prefix) {
+			series = append(series, s)
+		}
+	}
+	sort.Strings(series)
+	return series
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteRunMetrics verifies that counters accumulate across runs per
+// command and dry-run mode, that errors are counted, and that the run's error
+// is passed through.
+func TestWriteRunMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flux_helpers.prom")
+
+	runStats.applied, runStats.skipped = 3, 1
+	if err := writeRunMetrics(path, "bump", false, time.Now(), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if runStats.applied != 0 || runStats.skipped != 0 {
+		t.Errorf("Expected runStats to be reset, got %+v", runStats)
+	}
+
+	runStats.applied = 2
+	if err := writeRunMetrics(path, "bump", false, time.Now(), nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	runErr := errors.New("boom")
+	if err := writeRunMetrics(path, "bump", true, time.Now(), runErr); err != runErr {
+		t.Fatalf("Expected the run error to be returned, got: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{
+		"# TYPE flux_helpers_bumps_applied_total counter",
+		`flux_helpers_bumps_applied_total{command="bump",dry_run="false"} 5`,
+		`flux_helpers_bumps_skipped_total{command="bump",dry_run="false"} 1`,
+		`flux_helpers_errors_total{command="bump",dry_run="false"} 0`,
+		`flux_helpers_errors_total{command="bump",dry_run="true"} 1`,
+		"# TYPE flux_helpers_duration_seconds gauge",
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, data)
+		}
+	}
+}
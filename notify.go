@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyEnv provides a default for --notify, so the webhook URLs, which are
+// secrets, can stay off the command line. Several targets are separated by
+// whitespace.
+const notifyEnv = "FLUX_HELPERS_NOTIFY"
+
+// notifyTargets are the --notify targets of bump and apply.
+var notifyTargets []string
+
+// addNotifyFlag registers --notify on cmd.
+func addNotifyFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&notifyTargets, "notify", nil, "Post a summary of the changes after a successful run to slack://<webhook>, teams://<webhook> or webhook://<url> (repeatable; default: $"+notifyEnv+")")
+}
+
+// notifyTarget is a parsed --notify target: the kind of message to send and
+// the endpoint to post it to.
+type notifyTarget struct {
+	// Kind is "slack", "teams" or "webhook".
+	Kind     string
+	Endpoint string
+}
+
+// parseNotifyTarget parses a --notify target. slack://, teams:// and
+// webhook:// URLs post to the same URL over HTTPS, e.g.
+// slack://hooks.slack.com/services/T000/B000/XXXX; plain http(s):// URLs are
+// generic webhooks.
+func parseNotifyTarget(target string) (notifyTarget, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return notifyTarget{}, fmt.Errorf("invalid --notify %q (expected slack://, teams://, webhook:// or an http(s) URL)", target)
+	}
+	switch u.Scheme {
+	case "slack", "teams", "webhook":
+		kind := u.Scheme
+		u.Scheme = "https"
+		return notifyTarget{Kind: kind, Endpoint: u.String()}, nil
+	case "http", "https":
+		return notifyTarget{Kind: "webhook", Endpoint: u.String()}, nil
+	}
+	return notifyTarget{}, fmt.Errorf("invalid --notify %q: unknown scheme %q (expected slack, teams, webhook, http or https)", target, u.Scheme)
+}
+
+// parseNotifyTargets parses the --notify targets, or those of $FLUX_HELPERS_NOTIFY
+// when none are given.
+func parseNotifyTargets(targets []string) ([]notifyTarget, error) {
+	if len(targets) == 0 {
+		targets = strings.Fields(os.Getenv(notifyEnv))
+	}
+	parsed := make([]notifyTarget, 0, len(targets))
+	for _, target := range targets {
+		t, err := parseNotifyTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, t)
+	}
+	return parsed, nil
+}
+
+// notifiedFile is a changed file in a notification, with a link to it on the
+// git hosting service when one is known.
+type notifiedFile struct {
+	File    string      `json:"file"`
+	URL     string      `json:"url,omitempty"`
+	Changes []tagChange `json:"changes"`
+}
+
+// notification is the summary of a run posted to the --notify targets; it is
+// the body of generic webhooks.
+type notification struct {
+	Command string         `json:"command"`
+	Title   string         `json:"title"`
+	Files   []notifiedFile `json:"files"`
+}
+
+// newNotification summarizes the changed files of a command's run. Files are
+// linked to the origin remote of their repository: to the commit just made
+// when --commit is set, and to the checked out branch otherwise. Files outside
+// a git repository, or of an unknown hosting service, are not linked.
+func newNotification(command string, files []fileReport) notification {
+	n := notification{Command: command}
+	count := 0
+	for _, f := range files {
+		if len(f.Changes) == 0 {
+			continue
+		}
+		count += len(f.Changes)
+		n.Files = append(n.Files, notifiedFile{File: f.File, URL: gitFileURL(f.File), Changes: f.Changes})
+	}
+	n.Title = fmt.Sprintf("flux-helpers %s: %d image update(s) in %d file(s)", command, count, len(n.Files))
+	return n
+}
+
+// gitFileURL returns the web URL of file on the hosting service of its
+// repository's origin remote, or "" when it cannot be told.
+func gitFileURL(file string) string {
+	dir := filepath.Dir(file)
+	top, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+	remote, err := runGit(dir, "remote", "get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	repo, err := parseRemoteURL(remote)
+	if err != nil {
+		return ""
+	}
+	ref, err := runGit(dir, "rev-parse", "HEAD")
+	if !commitChanges {
+		ref, err = currentBranch(dir)
+	}
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return ""
+	}
+	// --show-toplevel resolves symlinks, so the file must too.
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return repo.fileURL(ref, filepath.ToSlash(rel))
+}
+
+// fileURL returns the web URL of file (relative to the repository root) at
+// ref, a branch or commit SHA, or "" for an unknown hosting service.
+func (r remoteRepo) fileURL(ref, file string) string {
+	switch {
+	case r.Host == "dev.azure.com":
+		parts := strings.SplitN(r.Path, "/", 3)
+		if len(parts) != 3 {
+			return ""
+		}
+		version := "GB" + ref
+		if isCommitSHA(ref) {
+			version = "GC" + ref
+		}
+		return fmt.Sprintf("https://dev.azure.com/%s/%s/_git/%s?path=/%s&version=%s", parts[0], parts[1], parts[2], url.QueryEscape(file), url.QueryEscape(version))
+	case r.Host == "bitbucket.org":
+		return fmt.Sprintf("https://%s/%s/src/%s/%s", r.Host, r.Path, ref, file)
+	case strings.Contains(r.Host, "gitlab"):
+		return fmt.Sprintf("https://%s/%s/-/blob/%s/%s", r.Host, r.Path, ref, file)
+	case strings.Contains(r.Host, "github"):
+		return fmt.Sprintf("https://%s/%s/blob/%s/%s", r.Host, r.Path, ref, file)
+	}
+	return ""
+}
+
+// isCommitSHA reports whether ref looks like a full git commit SHA.
+func isCommitSHA(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	return strings.Trim(ref, "0123456789abcdef") == ""
+}
+
+// text formats n as a message for kind: Slack mrkdwn (with <url|text>
+// links) or Markdown for Teams.
+func (n notification) text(kind string) string {
+	link := func(text, url string) string {
+		switch {
+		case url == "":
+			return "`" + text + "`"
+		case kind == "slack":
+			return "<" + url + "|" + text + ">"
+		}
+		return "[" + text + "](" + url + ")"
+	}
+	var b strings.Builder
+	for _, f := range n.Files {
+		fmt.Fprintf(&b, "• %s\n", link(f.File, f.URL))
+		for _, c := range f.Changes {
+			fmt.Fprintf(&b, "    %s `%s`: %s → %s\n", c.Image, c.Path, dashIfEmpty(c.OldValue), c.NewValue)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// payload returns the JSON body posted to a target of kind: a Slack message,
+// a Teams MessageCard, or n itself for generic webhooks.
+func (n notification) payload(kind string) interface{} {
+	switch kind {
+	case "slack":
+		return map[string]interface{}{
+			"text": "*" + n.Title + "*\n" + n.text(kind),
+		}
+	case "teams":
+		return map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  n.Title,
+			"title":    n.Title,
+			// Teams needs a blank line between Markdown paragraphs.
+			"text": strings.ReplaceAll(n.text(kind), "\n", "\n\n"),
+		}
+	}
+	return n
+}
+
+// sendNotifications posts a summary of the changes in files to every target
+// after a successful run. Runs that change nothing are not announced, and a
+// target that cannot be reached is only logged, as the changes are made by
+// then.
+//
+// Parameters:
+//   - ctx: Cancels the requests.
+//   - targets: The parsed --notify targets.
+//   - command: The command that made the changes, e.g. "bump".
+//   - files: The files of the run.
+func sendNotifications(ctx context.Context, targets []notifyTarget, command string, files []fileReport) {
+	if len(targets) == 0 || len(changedFiles(files)) == 0 {
+		return
+	}
+	n := newNotification(command, files)
+	for _, t := range targets {
+		if err := postJSON(ctx, t.Endpoint, nil, n.payload(t.Kind), nil); err != nil {
+			// The endpoint is a secret, so only the kind is named.
+			logf("⚠️ Failed to send %s notification: %v\n", t.Kind, redactEndpoint(err, t.Endpoint))
+			continue
+		}
+		logf("📣 Sent %s notification\n", t.Kind)
+	}
+}
+
+// redactEndpoint replaces endpoint in the message of err, as webhook URLs
+// embed their credentials.
+func redactEndpoint(err error, endpoint string) string {
+	msg := err.Error()
+	if u, perr := url.Parse(endpoint); perr == nil {
+		msg = strings.ReplaceAll(msg, endpoint, u.Scheme+"://"+u.Host+"/…")
+	}
+	return msg
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseNotifyTarget verifies the --notify schemes.
+func TestParseNotifyTarget(t *testing.T) {
+	tests := map[string]notifyTarget{
+		"slack://hooks.slack.com/services/T0/B0/X": {Kind: "slack", Endpoint: "https://hooks.slack.com/services/T0/B0/X"},
+		"teams://example.webhook.office.com/hook":  {Kind: "teams", Endpoint: "https://example.webhook.office.com/hook"},
+		"webhook://ci.example.com/notify?x=1":      {Kind: "webhook", Endpoint: "https://ci.example.com/notify?x=1"},
+		"http://localhost:8080/hook":               {Kind: "webhook", Endpoint: "http://localhost:8080/hook"},
+	}
+	for target, want := range tests {
+		got, err := parseNotifyTarget(target)
+		if err != nil || got != want {
+			t.Errorf("parseNotifyTarget(%q) = %+v, %v; expected %+v", target, got, err, want)
+		}
+	}
+	for _, invalid := range []string{"slack", "discord://example.com/hook", "https://"} {
+		if _, err := parseNotifyTarget(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestRemoteRepoFileURL verifies the file links of each hosting service.
+func TestRemoteRepoFileURL(t *testing.T) {
+	tests := []struct {
+		repo remoteRepo
+		ref  string
+		want string
+	}{
+		{remoteRepo{Host: "github.com", Path: "org/repo"}, "main", "https://github.com/org/repo/blob/main/apps/hr.yaml"},
+		{remoteRepo{Host: "gitlab.com", Path: "group/sub/repo"}, "main", "https://gitlab.com/group/sub/repo/-/blob/main/apps/hr.yaml"},
+		{remoteRepo{Host: "bitbucket.org", Path: "team/repo"}, "main", "https://bitbucket.org/team/repo/src/main/apps/hr.yaml"},
+		{remoteRepo{Host: "dev.azure.com", Path: "org/project/repo"}, "main", "https://dev.azure.com/org/project/_git/repo?path=/apps%2Fhr.yaml&version=GBmain"},
+		{remoteRepo{Host: "dev.azure.com", Path: "org/project/repo"}, strings.Repeat("a", 40), "https://dev.azure.com/org/project/_git/repo?path=/apps%2Fhr.yaml&version=GC" + strings.Repeat("a", 40)},
+		{remoteRepo{Host: "git.example.com", Path: "org/repo"}, "main", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.repo.fileURL(tt.ref, "apps/hr.yaml"); got != tt.want {
+			t.Errorf("fileURL for %s = %q, expected %q", tt.repo.Host, got, tt.want)
+		}
+	}
+}
+
+// TestSendNotifications verifies the Slack and generic webhook payloads, and
+// that runs without changes are not announced.
+func TestSendNotifications(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		// Slack answers with plain text.
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	files := []fileReport{
+		{File: "/nonexistent/hr.yaml", Changes: []tagChange{{Image: "ghcr.io/my-org/my-api", Path: "image.tag", OldValue: "1.0.0", NewValue: "1.1.0"}}},
+		{File: "/nonexistent/other.yaml"},
+	}
+	targets := []notifyTarget{{Kind: "slack", Endpoint: server.URL}, {Kind: "webhook", Endpoint: server.URL}}
+	sendNotifications(context.Background(), targets, "bump", files)
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 notifications, got %d", len(bodies))
+	}
+
+	var slack struct{ Text string }
+	if err := json.Unmarshal([]byte(bodies[0]), &slack); err != nil {
+		t.Fatalf("Invalid Slack payload: %v", err)
+	}
+	if !strings.HasPrefix(slack.Text, "*flux-helpers bump: 1 image update(s) in 1 file(s)*\n") || !strings.Contains(slack.Text, "ghcr.io/my-org/my-api `image.tag`: 1.0.0 → 1.1.0") {
+		t.Errorf("Unexpected Slack message:\n%s", slack.Text)
+	}
+
+	var generic notification
+	if err := json.Unmarshal([]byte(bodies[1]), &generic); err != nil {
+		t.Fatalf("Invalid webhook payload: %v", err)
+	}
+	if generic.Command != "bump" || len(generic.Files) != 1 || generic.Files[0].Changes[0].NewValue != "1.1.0" {
+		t.Errorf("Unexpected webhook payload: %+v", generic)
+	}
+
+	sendNotifications(context.Background(), targets, "bump", files[1:])
+	if len(bodies) != 2 {
+		t.Errorf("Expected a run without changes not to be announced")
+	}
+}
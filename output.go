@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Output formats accepted by --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// logOut receives progress and status messages. It is switched to stderr when
+// stdout carries machine-readable output.
+var logOut io.Writer = os.Stdout
+
+// logWriter returns logOut, or io.Discard with --quiet.
+func logWriter() io.Writer {
+	if quiet {
+		return io.Discard
+	}
+	return logOut
+}
+
+// logf writes a formatted progress message to logOut.
+func logf(format string, args ...interface{}) {
+	if quiet {
+		return
+	}
+	aroundProgress(func() { fmt.Fprintf(logOut, format, args...) })
+}
+
+// logln writes a progress message followed by a newline to logOut.
+func logln(args ...interface{}) {
+	if quiet {
+		return
+	}
+	aroundProgress(func() { fmt.Fprintln(logOut, args...) })
+}
+
+// validateOutputFormat returns an error if format is not a supported --output value.
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q (expected %s or %s)", format, outputText, outputJSON)
+}
+
+// bumpReport is the machine-readable summary of a bump run.
+type bumpReport struct {
+	DryRun bool         `json:"dryRun"`
+	Files  []fileReport `json:"files"`
+}
+
+// changeCount returns the number of changes across all files of the report.
+func (r *bumpReport) changeCount() int {
+	count := 0
+	for _, f := range r.Files {
+		count += len(f.Changes)
+	}
+	return count
+}
+
+// fileReport lists the changes made to a single file. Object ("Kind/name"),
+// Namespace and ValuesKey are set for changes made inside a ConfigMap or Secret
+// referenced by valuesFrom.
+type fileReport struct {
+	File      string      `json:"file"`
+	Object    string      `json:"object,omitempty"`
+	Namespace string      `json:"namespace,omitempty"`
+	ValuesKey string      `json:"valuesKey,omitempty"`
+	Updated   int         `json:"updated"`
+	Changes   []tagChange `json:"changes"`
+	// Skipped lists the requested images that were not bumped, per match.
+	Skipped []skippedMatch `json:"skipped,omitempty"`
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
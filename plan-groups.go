@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// planGroup is one rollout stage of a bump plan: the images whose changes are
+// applied, committed and rolled out together.
+type planGroup struct {
+	Images []string `json:"images"`
+}
+
+// validateDependencies checks the dependencies of an updates file: every image
+// must name at least one image that rolls out before it, and following the
+// dependencies must not lead back to an image.
+func validateDependencies(deps map[string][]string) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(image string, path []string) error
+	visit = func(image string, path []string) error {
+		switch state[image] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, image), " → "))
+		case done:
+			return nil
+		}
+		state[image] = visiting
+		for _, dep := range deps[image] {
+			if err := visit(dep, append(path, image)); err != nil {
+				return err
+			}
+		}
+		state[image] = done
+		return nil
+	}
+	for _, image := range sortedKeys(deps) {
+		if image == "" || len(deps[image]) == 0 {
+			return fmt.Errorf("invalid dependencies of %q (expected an image and the images it depends on)", image)
+		}
+		for _, dep := range deps[image] {
+			if dep == "" {
+				return fmt.Errorf("invalid dependencies of %s: empty image", image)
+			}
+		}
+		if err := visit(image, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupBumpPlan orders the changes of plan into rollout groups by the
+// dependencies of an updates file (image → images that must roll out first),
+// which must have been checked with validateDependencies.
+//
+// An image's depth is 0 without dependencies and otherwise one more than the
+// deepest of its dependencies, whether or not those are bumped by the plan.
+// The changed images are grouped by depth, in increasing order and without
+// empty groups, so every image is in a later group than the images it depends
+// on. Without dependencies, or when every image ends up in the same group,
+// plan.Groups is left empty.
+func groupBumpPlan(plan *bumpPlan, deps map[string][]string) {
+	plan.Groups = nil
+	if len(deps) == 0 {
+		return
+	}
+	depths := map[string]int{}
+	var depth func(image string) int
+	depth = func(image string) int {
+		if d, ok := depths[image]; ok {
+			return d
+		}
+		d := 0
+		for _, dep := range deps[image] {
+			d = max(d, depth(dep)+1)
+		}
+		depths[image] = d
+		return d
+	}
+
+	byDepth := map[int][]string{}
+	seen := map[string]bool{}
+	for _, pf := range plan.Files {
+		for _, c := range pf.Changes {
+			if !seen[c.Image] {
+				seen[c.Image] = true
+				d := depth(c.Image)
+				byDepth[d] = append(byDepth[d], c.Image)
+			}
+		}
+	}
+	if len(byDepth) < 2 {
+		return
+	}
+	levels := make([]int, 0, len(byDepth))
+	for d := range byDepth {
+		levels = append(levels, d)
+	}
+	slices.Sort(levels)
+	for _, d := range levels {
+		plan.Groups = append(plan.Groups, planGroup{Images: byDepth[d]})
+	}
+}
+
+// groupPlans splits plan into one plan per rollout group, holding the changes
+// of the group's images. Files changed by an earlier group are planned
+// without a checksum, as that group rewrites them; their changes are still
+// checked value by value. A plan without groups is returned as is.
+func groupPlans(plan *bumpPlan) []*bumpPlan {
+	if len(plan.Groups) == 0 {
+		return []*bumpPlan{plan}
+	}
+	plans := make([]*bumpPlan, 0, len(plan.Groups))
+	touched := map[string]bool{}
+	for _, group := range plan.Groups {
+		images := map[string]bool{}
+		for _, image := range group.Images {
+			images[image] = true
+		}
+		sub := &bumpPlan{Version: plan.Version, CreatedAt: plan.CreatedAt}
+		for _, pf := range plan.Files {
+			var changes []tagChange
+			for _, c := range pf.Changes {
+				if images[c.Image] {
+					changes = append(changes, c)
+				}
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			sum := pf.SHA256
+			if touched[pf.File] {
+				sum = ""
+			}
+			sub.Files = append(sub.Files, plannedFile{File: pf.File, SHA256: sum, Changes: changes})
+		}
+		for _, pf := range sub.Files {
+			touched[pf.File] = true
+		}
+		plans = append(plans, sub)
+	}
+	return plans
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestValidateDependencies verifies that dependency cycles and empty entries
+// are rejected.
+func TestValidateDependencies(t *testing.T) {
+	if err := validateDependencies(map[string][]string{"api": {"migrator"}, "web": {"api", "migrator"}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, invalid := range []map[string][]string{
+		{"api": {"migrator"}, "migrator": {"api"}},
+		{"api": {"api"}},
+		{"api": nil},
+		{"api": {""}},
+	} {
+		if err := validateDependencies(invalid); err == nil {
+			t.Errorf("Expected %v to be rejected", invalid)
+		}
+	}
+	err := validateDependencies(map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}})
+	if err == nil || !strings.Contains(err.Error(), "a → b → c → a") {
+		t.Errorf("Expected the cycle to be named, got %v", err)
+	}
+}
+
+// TestGroupBumpPlan verifies that images are grouped by the depth of their
+// dependencies, including dependencies the plan does not bump.
+func TestGroupBumpPlan(t *testing.T) {
+	plan := &bumpPlan{Files: []plannedFile{
+		{File: "a.yaml", Changes: []tagChange{{Image: "web"}, {Image: "migrator"}}},
+		{File: "b.yaml", Changes: []tagChange{{Image: "api"}, {Image: "worker"}}},
+	}}
+	deps := map[string][]string{
+		"api": {"migrator"},
+		"web": {"api", "db"},
+		"db":  {"operator"},
+	}
+	groupBumpPlan(plan, deps)
+	want := []planGroup{{Images: []string{"migrator", "worker"}}, {Images: []string{"api"}}, {Images: []string{"web"}}}
+	if !reflect.DeepEqual(plan.Groups, want) {
+		t.Errorf("Expected groups %v, got %v", want, plan.Groups)
+	}
+
+	groupBumpPlan(plan, map[string][]string{"unrelated": {"other"}})
+	if plan.Groups != nil {
+		t.Errorf("Expected no groups when every image rolls out together, got %v", plan.Groups)
+	}
+}
+
+// TestApplyGroupPlans verifies that a grouped plan is applied group by group,
+// including files changed by more than one group.
+func TestApplyGroupPlans(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("test_files", "multiple-bump.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(dir, "multiple-bump.yaml")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("Failed to write fixture copy: %v", err)
+	}
+
+	plan, err := BuildBumpPlan([]updateSet{{
+		Files:  []string{file},
+		Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "envoyproxy/envoy": "1.27.0"},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error building plan: %v", err)
+	}
+	groupBumpPlan(plan, map[string][]string{"ghcr.io/my-org/my-api": {"envoyproxy/envoy"}})
+	groups := groupPlans(plan)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 group plans, got %d", len(groups))
+	}
+	if groups[0].Files[0].SHA256 == "" || groups[1].Files[0].SHA256 != "" {
+		t.Errorf("Expected only the first group to check the file's checksum")
+	}
+
+	if err := ApplyBumpPlan(groups[0]); err != nil {
+		t.Fatalf("Unexpected error applying group 1: %v", err)
+	}
+	data, _ = os.ReadFile(file)
+	if !strings.Contains(string(data), "tag: 1.27.0") || strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected only envoy to be bumped by group 1, got:\n%s", data)
+	}
+	if err := ApplyBumpPlan(groups[1]); err != nil {
+		t.Fatalf("Unexpected error applying group 2: %v", err)
+	}
+	data, _ = os.ReadFile(file)
+	if !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected my-api to be bumped by group 2, got:\n%s", data)
+	}
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// bumpPlanVersion is the schema version written to plan files.
+const bumpPlanVersion = 1
+
+// updateSet is one entry of an updates file: a group of files (paths or globs)
+// and the image versions to apply to them. Image names may be globs
+// ("ghcr.io/my-org/*"); ImagesRegex holds regular expressions over repositories.
+// ValuesSchema is a chart directory or values.schema.json that bumped values
+// must satisfy before they are written, unless Force is set. MatcherProfile
+// names the image reference shapes to recognise (see matcherProfiles), and
+// Matchers adds custom ones (see imageMatcher). VerifyRender is a chart
+// directory rendered before and after the bump to check that only image
+// references change; VerifyRenderWarn downgrades a failed check to a warning.
+// Ranges maps repositories to semver constraints that are resolved to the
+// newest matching tag in the registry before the set is applied (see
+// resolveImageRanges).
+type updateSet struct {
+	Files            []string          `json:"files"`
+	Images           map[string]string `json:"images,omitempty"`
+	ImagesRegex      map[string]string `json:"imagesRegex,omitempty"`
+	Ranges           map[string]string `json:"ranges,omitempty"`
+	Paths            []string          `json:"paths,omitempty"`
+	ValuesSchema     string            `json:"valuesSchema,omitempty"`
+	Force            bool              `json:"force,omitempty"`
+	MatcherProfile   string            `json:"matcherProfile,omitempty"`
+	Matchers         []imageMatcher    `json:"matchers,omitempty"`
+	VerifyRender     string            `json:"verifyRender,omitempty"`
+	VerifyRenderWarn bool              `json:"verifyRenderWarn,omitempty"`
+	// Selector limits the set to the HelmReleases whose labels or
+	// annotations match it, in kubectl label selector syntax.
+	Selector string `json:"selector,omitempty"`
+	// TargetName and TargetNamespace limit the set to the HelmReleases whose
+	// name and namespace match these globs.
+	TargetName      string `json:"targetName,omitempty"`
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	// TagFormat is the validation profile of new tags (see parseTagFormat),
+	// and TagFormats overrides it per image repository.
+	TagFormat  string            `json:"tagFormat,omitempty"`
+	TagFormats map[string]string `json:"tagFormats,omitempty"`
+	// PreservePrefix and PreserveSuffix carry the text around the semver
+	// core of the current tags over to the new ones (see tagAffixes).
+	PreservePrefix bool `json:"preservePrefix,omitempty"`
+	PreserveSuffix bool `json:"preserveSuffix,omitempty"`
+	// CreateValuesPaths maps images to the values path at which a
+	// repository/tag block is created when a HelmRelease does not reference
+	// the image yet.
+	CreateValuesPaths map[string]string `json:"createValuesPaths,omitempty"`
+
+	// selectChange is passed to bumpOptions.Select; it is set by bump
+	// --interactive and never read from files.
+	selectChange func(change tagChange) bool
+	// annotator is passed to bumpOptions.Annotate; it is set by bump
+	// --annotate and never read from files.
+	annotator *changeAnnotator
+	// provenance is passed to bumpOptions.Provenance; it is set by bump
+	// --annotate-metadata and never read from files.
+	provenance *provenanceAnnotator
+	// policy is passed to bumpOptions.Policy; it is set from --policy and
+	// never read from files.
+	policy *bumpPolicy
+	// registry is passed to bumpOptions.Registry; it is set by
+	// --check-exists and never read from files.
+	registry *registryClient
+}
+
+// options returns the bumpOptions for applying the set. The matchers must
+// have been checked with validateUpdateSets.
+func (s updateSet) options(dryRun bool) bumpOptions {
+	matchers, _ := setMatchers(s.MatcherProfile, s.Matchers)
+	selector, _ := parseSelector(s.Selector)
+	format, formats, _ := parseTagFormats(s.TagFormat, s.TagFormats)
+	return bumpOptions{
+		DryRun:          dryRun,
+		Paths:           s.Paths,
+		RegexUpdates:    s.ImagesRegex,
+		Force:           s.Force,
+		Matchers:        matchers,
+		Select:          s.selectChange,
+		Annotate:        s.annotator,
+		Provenance:      s.provenance,
+		Policy:          s.policy,
+		Registry:        s.registry,
+		Selector:        selector,
+		TargetName:      s.TargetName,
+		TargetNamespace: s.TargetNamespace,
+		TagFormat:       format,
+		TagFormats:      formats,
+		Affixes:         tagAffixes{Prefix: s.PreservePrefix, Suffix: s.PreserveSuffix},
+		CreatePaths:     s.CreateValuesPaths,
+	}
+}
+
+// updatesFile is the declarative description of a coordinated release, e.g.:
+//
+//	updates:
+//	  - files: [clusters/dev/my-app.yaml, clusters/staging/*.yaml]
+//	    images:
+//	      ghcr.io/my-org/my-api: 1.4.0
+//	  - files: [clusters/prod/my-app.yaml]
+//	    paths: [sidecar.image]
+//	    images:
+//	      envoyproxy/envoy: 1.27.0
+//
+// File-level matchers (see imageMatcher) apply to every update set.
+// Dependencies maps images to the images that must roll out before them, e.g.
+// "ghcr.io/my-org/api: [ghcr.io/my-org/schema-migrator]"; plan orders the
+// changes into groups by them (see groupBumpPlan).
+type updatesFile struct {
+	Matchers     []imageMatcher      `json:"matchers,omitempty"`
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+	Updates      []updateSet         `json:"updates"`
+}
+
+// bumpPlan is a reviewable, replayable record of the exact changes a set of
+// updates makes. apply executes a plan and nothing else. Groups, when set,
+// orders the changes into rollout stages by image (see groupBumpPlan).
+type bumpPlan struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Files     []plannedFile `json:"files"`
+	Groups    []planGroup   `json:"groups,omitempty"`
+}
+
+// plannedFile holds the changes planned for a single manifest together with the
+// checksum of the content they were computed against. The checksum is empty in
+// the plan of a later rollout group for a file an earlier group changes.
+type plannedFile struct {
+	File    string      `json:"file"`
+	SHA256  string      `json:"sha256"`
+	Changes []tagChange `json:"changes"`
+}
+
+// loadUpdatesFile reads and validates an updates file (YAML or JSON).
+func loadUpdatesFile(path string) (*updatesFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read updates file: %w", err)
+	}
+
+	var uf updatesFile
+	if err := yaml.UnmarshalStrict(data, &uf); err != nil {
+		return nil, fmt.Errorf("invalid updates file %s: %w", path, err)
+	}
+	shareMatchers(uf.Updates, uf.Matchers)
+	if err := validateUpdateSets(uf.Updates); err != nil {
+		return nil, fmt.Errorf("invalid updates file %s: %w", path, err)
+	}
+	if err := validateDependencies(uf.Dependencies); err != nil {
+		return nil, fmt.Errorf("invalid updates file %s: %w", path, err)
+	}
+	return &uf, nil
+}
+
+// validateUpdateSets checks that every update set names files and images, a
+// known matcher profile, valid custom matchers, a valid selector, valid
+// target globs and valid ranges.
+func validateUpdateSets(sets []updateSet) error {
+	for i, set := range sets {
+		if len(set.Files) == 0 || len(set.Images)+len(set.ImagesRegex)+len(set.Ranges) == 0 {
+			return fmt.Errorf("entry %d needs at least one file and one image", i+1)
+		}
+		if _, err := setMatchers(set.MatcherProfile, set.Matchers); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if _, err := parseSelector(set.Selector); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if err := validateTargetPattern("targetName", set.TargetName); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if err := validateTargetPattern("targetNamespace", set.TargetNamespace); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		for key := range set.Images {
+			if image, scope := splitScopedImage(key); image == "" || (scope == "" && strings.Contains(key, scopedImageSeparator)) {
+				return fmt.Errorf("entry %d: invalid image %q (expected repo or repo@values.path)", i+1, key)
+			}
+		}
+		if _, _, err := parseTagFormats(set.TagFormat, set.TagFormats); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if err := validateCreateValuesPaths(set.CreateValuesPaths, set.Images); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		for repo, constraint := range set.Ranges {
+			if err := validateImageRange(repo, constraint); err != nil {
+				return fmt.Errorf("entry %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandFileGlobs resolves a list of file paths and glob patterns. Plain paths
+// are returned as-is; a glob that matches nothing is an error, as is a
+// malformed pattern. Duplicates are removed, preserving first occurrence.
+func expandFileGlobs(patterns []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		// Globs from config files use "/", which Windows globbing does not
+		// take for a separator.
+		pattern = filepath.FromSlash(pattern)
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("glob %q matched no files", pattern)
+			}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of data.
+func fileSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceValueAtPath sets the scalar at a values path to newValue if it
+// currently equals oldValue. Lists along the path are descended into at the
+// index the path gives, or item by item where it gives none (as in plans and
+// journals written before paths carried list indexes).
+//
+// Returns the number of values replaced.
+func replaceValueAtPath(node interface{}, path, oldValue, newValue string) int {
+	return replaceValueAtParts(node, splitValuesPath(path), oldValue, newValue)
+}
+
+// replaceValueAtParts is replaceValueAtPath for a path split with
+// splitValuesPath.
+func replaceValueAtParts(node interface{}, parts []string, oldValue, newValue string) int {
+	if len(parts) == 0 {
+		return 0
+	}
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if len(parts) == 1 {
+			if current, ok := typed[parts[0]].(string); ok && current == oldValue {
+				typed[parts[0]] = newValue
+				return 1
+			}
+			return 0
+		}
+		return replaceValueAtParts(typed[parts[0]], parts[1:], oldValue, newValue)
+
+	case []interface{}:
+		if i, ok := listIndex(parts[0]); ok {
+			if i >= len(typed) {
+				return 0
+			}
+			if len(parts) == 1 {
+				if current, ok := typed[i].(string); ok && current == oldValue {
+					typed[i] = newValue
+					return 1
+				}
+				return 0
+			}
+			return replaceValueAtParts(typed[i], parts[1:], oldValue, newValue)
+		}
+		count := 0
+		for _, item := range typed {
+			count += replaceValueAtParts(item, parts, oldValue, newValue)
+		}
+		return count
+	}
+	return 0
+}
+
+// BuildBumpPlan computes the exact changes the given update sets make without
+// modifying any file.
+//
+// Update sets are applied in order. When several sets target the same file, each
+// one sees the changes planned by the previous ones. Files in which nothing would
+// change are left out of the plan.
+//
+// Returns:
+//   - The plan, with each file's checksum so apply can detect later edits.
+//   - An error if a file cannot be read or parsed, or a glob matches nothing.
+func BuildBumpPlan(sets []updateSet) (*bumpPlan, error) {
+	type fileState struct {
+		hr            *helmReleaseManifest
+		sum           string
+		values        map[string]interface{}
+		postRenderers *postRendererView
+		ignore        *ignoreMarkers
+		anchors       *valueAnchors
+		imagePolicies *imagePolicyMarkers
+		metadata      releaseMetadata
+		pinned        bool
+		changes       []tagChange
+	}
+
+	states := map[string]*fileState{}
+	var order []string
+
+	for _, set := range sets {
+		files, err := expandFileGlobs(set.Files)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			state, ok := states[file]
+			if !ok {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", file, err)
+				}
+				hr, err := decodeHelmRelease(data)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				state = &fileState{hr: hr, sum: fileSHA256(data), pinned: helmReleaseIgnored(data), metadata: helmReleaseMetadata(data)}
+				if state.values, err = helmReleaseValues(hr); err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				state.ignore = findIgnoreMarkers(data, state.values)
+				state.anchors = findValueAnchors(data, helmReleaseValuesNode)
+				state.imagePolicies = findImagePolicyMarkers(data, state.values, helmReleaseValuesNode)
+				if state.postRenderers, err = newPostRendererView(hr); err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				states[file] = state
+				order = append(order, file)
+			}
+
+			logf("📄 %s\n", file)
+			if state.pinned {
+				logf("📌 HelmRelease is pinned with the %s annotation, skipping\n", ignoreAnnotation)
+				continue
+			}
+			opts := set.options(true)
+			if reason := opts.unselectedReason(state.metadata); reason != "" {
+				logf("⏭️ HelmRelease %s, skipping\n", reason)
+				continue
+			}
+			opts.PostRenderers = state.postRenderers
+			opts.Ignore = state.ignore
+			opts.Anchors = state.anchors
+			opts.ImagePolicies = state.imagePolicies
+			_, changes, err := applyImageUpdates(state.values, set.Images, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := opts.Policy.check(file, changes); err != nil {
+				return nil, err
+			}
+			if err := opts.Registry.checkChangesExist(file, changes); err != nil {
+				return nil, err
+			}
+			// Apply in memory so later update sets build on this one.
+			for _, c := range changes {
+				replaced := 0
+				for _, path := range state.anchors.uses(c.Path) {
+					replaced += replaceChangeValue(state.values, state.postRenderers, path, c.OldValue, c.NewValue)
+				}
+				if replaced == 0 {
+					createPlannedImageBlock(state.values, c)
+				}
+			}
+			state.changes = append(state.changes, changes...)
+		}
+	}
+
+	plan := &bumpPlan{Version: bumpPlanVersion, CreatedAt: time.Now().UTC()}
+	for _, file := range order {
+		if state := states[file]; len(state.changes) > 0 {
+			plan.Files = append(plan.Files, plannedFile{File: file, SHA256: state.sum, Changes: state.changes})
+		}
+	}
+	return plan, nil
+}
+
+// ApplyBumpPlan executes exactly the changes recorded in plan.
+//
+// The advisory locks of all files are held for the whole operation. Every file
+// is checked against the checksum recorded in the plan (unless it has none) and
+// every planned value must still hold its old value, or, for an image block
+// the plan creates (see updateSet.CreateValuesPaths), must not exist yet; if
+// anything differs, no file is written. Otherwise each HelmRelease is
+// re-encoded and sanitized as by bump.
+func ApplyBumpPlan(plan *bumpPlan) error {
+	if plan.Version != bumpPlanVersion {
+		return fmt.Errorf("unsupported plan version %d (expected %d)", plan.Version, bumpPlanVersion)
+	}
+
+	files := make([]string, 0, len(plan.Files))
+	for _, pf := range plan.Files {
+		files = append(files, pf.File)
+	}
+	unlock, err := acquireFileLocks(files)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	outputs := make([][]byte, len(plan.Files))
+	for i, pf := range plan.Files {
+		data, err := os.ReadFile(pf.File)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", pf.File, err)
+		}
+		if err := refuseSOPS(pf.File, data); err != nil {
+			return err
+		}
+		if sum := fileSHA256(data); pf.SHA256 != "" && sum != pf.SHA256 {
+			return fmt.Errorf("%s has changed since the plan was created (sha256 %s, planned against %s)", pf.File, sum, pf.SHA256)
+		}
+
+		outputs[i], err = rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+			for _, c := range pf.Changes {
+				if replaceChangeValue(values, postRenderers, c.Path, c.OldValue, c.NewValue) > 0 || createPlannedImageBlock(values, c) {
+					continue
+				}
+				if c.OldValue == "" {
+					return fmt.Errorf("%s cannot be created: it already exists", c.Path)
+				}
+				return fmt.Errorf("%s no longer holds %q", c.Path, c.OldValue)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", pf.File, err)
+		}
+	}
+
+	for i, pf := range plan.Files {
+		if err := writeFileWithBackup(pf.File, outputs[i], 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", pf.File, err)
+		}
+		for _, c := range pf.Changes {
+			logf("🔁 %s %s: %s → %s\n", pf.File, c.Path, c.OldValue, c.NewValue)
+		}
+		logf("✅ Applied %d change(s) to %s\n", len(pf.Changes), pf.File)
+	}
+	return nil
+}
+
+// printBumpPlan writes a human-readable summary of plan to stdout.
+func printBumpPlan(plan *bumpPlan) {
+	total := 0
+	for _, pf := range plan.Files {
+		total += len(pf.Changes)
+	}
+	logf("\n📋 Plan: %d change(s) in %d file(s)\n", total, len(plan.Files))
+	for _, pf := range plan.Files {
+		logf("\n  %s\n", pf.File)
+		for _, c := range pf.Changes {
+			logf("    ~ %s: %s → %s\n", c.Path, c.OldValue, c.NewValue)
+		}
+	}
+	if len(plan.Groups) > 0 {
+		logf("\n🚦 Rollout order:\n")
+		for i, group := range plan.Groups {
+			logf("  %d. %s\n", i+1, strings.Join(group.Images, ", "))
+		}
+	}
+}
+
+var (
+	updatesFilePath string
+	planOutPath     string
+	applyGroup      int
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Compute a reviewable bump plan from an updates file",
+	Long: "plan reads an updates file and records the exact files, values paths and " +
+		"old/new values that a bump would change, without modifying anything. " +
+		"The resulting plan is executed with `flux-helpers apply`.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if updatesFilePath == "" || planOutPath == "" {
+			return fmt.Errorf("you must specify --updates-file and --out")
+		}
+
+		uf, err := loadUpdatesFile(updatesFilePath)
+		if err != nil {
+			return err
+		}
+		if err := resolveImageRanges(newRegistryClient(cmd.Context()), uf.Updates); err != nil {
+			return err
+		}
+		if err := setPolicy(uf.Updates, policyPath, allowMajor); err != nil {
+			return err
+		}
+		setCheckExists(cmd.Context(), uf.Updates, checkExists)
+
+		plan, err := BuildBumpPlan(uf.Updates)
+		if err != nil {
+			return fmt.Errorf("failed to build plan: %w", err)
+		}
+		groupBumpPlan(plan, uf.Dependencies)
+
+		out, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal plan: %w", err)
+		}
+		out = append(out, '\n')
+
+		printBumpPlan(plan)
+		if err := os.WriteFile(planOutPath, out, 0644); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+		logf("\n💾 Plan written to %s\n", planOutPath)
+		noChangesMade = len(plan.Files) == 0
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply PLAN",
+	Short: "Apply exactly the changes recorded in a bump plan",
+	Long: "apply executes a plan written by `flux-helpers plan`. When the plan orders " +
+		"its changes into rollout groups, --group applies a single group, and " +
+		"--commit applies the groups in order with one commit (and pull request) each.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read plan: %w", err)
+		}
+
+		var plan bumpPlan
+		if err := json.Unmarshal(data, &plan); err != nil {
+			return fmt.Errorf("invalid plan %s: %w", args[0], err)
+		}
+
+		policy, err := loadBumpPolicy(policyPath, allowMajor)
+		if err != nil {
+			return err
+		}
+		for _, pf := range plan.Files {
+			if err := policy.check(pf.File, pf.Changes); err != nil {
+				return fmt.Errorf("failed to apply plan: %w", err)
+			}
+		}
+		templates, err := validateCommitFlags(cmd)
+		if err != nil {
+			return err
+		}
+		notify, err := parseNotifyTargets(notifyTargets)
+		if err != nil {
+			return err
+		}
+
+		// Without --group or --commit the whole plan is applied at once, so
+		// either every file is written or none is.
+		stages := []*bumpPlan{&plan}
+		groups := groupPlans(&plan)
+		switch {
+		case cmd.Flags().Changed("group"):
+			if applyGroup < 1 || applyGroup > len(groups) {
+				return fmt.Errorf("invalid --group %d (the plan has %d group(s))", applyGroup, len(groups))
+			}
+			stages = groups[applyGroup-1 : applyGroup]
+		case commitChanges:
+			stages = groups
+		}
+		if len(stages) > 1 && pullRequestOpen && branchTemplate == "" {
+			return fmt.Errorf("--pull-request with %d rollout groups requires --branch-template, so each group gets its own branch", len(stages))
+		}
+
+		startedAt := time.Now()
+		var files []fileReport
+		applied := 0
+		for i, stage := range stages {
+			if len(plan.Groups) > 0 {
+				n := i + 1
+				if cmd.Flags().Changed("group") {
+					n = applyGroup
+				}
+				logf("🚦 Group %d/%d: %s\n", n, len(groups), strings.Join(plan.Groups[n-1].Images, ", "))
+			}
+			if err = ApplyBumpPlan(stage); err != nil {
+				break
+			}
+			reports := make([]fileReport, 0, len(stage.Files))
+			for _, pf := range stage.Files {
+				images := map[string]bool{}
+				for _, c := range pf.Changes {
+					images[c.Image] = true
+				}
+				reports = append(reports, fileReport{File: pf.File, Updated: len(images), Changes: pf.Changes})
+			}
+			files = append(files, reports...)
+			applied++
+			if len(stage.Files) == 0 {
+				continue
+			}
+
+			if journalPath != "" {
+				id, jErr := recordJournalRun(journalPath, "apply", reports)
+				if jErr != nil {
+					return fmt.Errorf("plan applied, but failed to record change journal: %w", jErr)
+				}
+				logf("📝 Recorded run %s in %s\n", id, journalPath)
+			}
+			if err = commitRun(cmd.Context(), reports, templates); err != nil {
+				err = fmt.Errorf("failed to commit changes: %w", err)
+				break
+			}
+		}
+		if reportPath != "" || reportMDPath != "" {
+			if rErr := writeRunReport(newRunReport("apply", false, startedAt, files, err), reportPath, reportMDPath); rErr != nil && err == nil {
+				return rErr
+			}
+		}
+		if err != nil {
+			if len(stages) > 1 && applied > 0 {
+				return fmt.Errorf("failed to apply plan after %d of %d group(s): %w", applied, len(stages), err)
+			}
+			return fmt.Errorf("failed to apply plan: %w", err)
+		}
+		noChangesMade = len(files) == 0
+		sendNotifications(cmd.Context(), notify, "apply", files)
+		return nil
+	},
+}
+
+func init() {
+	planCmd.Flags().StringVar(&updatesFilePath, "updates-file", "", "Path to the updates file describing files and image versions")
+	planCmd.Flags().StringVar(&planOutPath, "out", "", "Path to write the plan JSON to")
+	addPolicyFlags(planCmd)
+	planCmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a new image tag does not exist in its registry")
+	addPolicyFlags(applyCmd)
+	applyCmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON change report to this file")
+	applyCmd.Flags().StringVar(&reportMDPath, "report-md", "", "Write the change report as Markdown to this file")
+	applyCmd.Flags().StringVar(&journalPath, "journal", defaultJournalPath, "Record changes in this change journal for rollback (empty to disable)")
+	applyCmd.Flags().IntVar(&applyGroup, "group", 0, "Only apply this rollout group of the plan (1 is the first)")
+	addCommitFlags(applyCmd)
+	addNotifyFlag(applyCmd)
+	addBackupFlags(applyCmd)
+	rootCmd.AddCommand(planCmd)
+	rootCmd.AddCommand(applyCmd)
+}
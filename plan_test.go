@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBuildAndApplyBumpPlan verifies that a plan records the exact changes of
+// each update set, that applying it performs those changes, and that a plan is
+// refused once its target files have changed.
+func TestBuildAndApplyBumpPlan(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"multiple-bump.yaml", "aspire-test.yaml"} {
+		data, err := os.ReadFile(filepath.Join("test_files", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write fixture copy: %v", err)
+		}
+	}
+	structured := filepath.Join(dir, "multiple-bump.yaml")
+
+	sets := []updateSet{
+		{
+			Files:  []string{filepath.Join(dir, "*.yaml")},
+			Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "ghcr.io/my-org/web-app": "1.8.0"},
+		},
+		{
+			Files:  []string{structured},
+			Paths:  []string{"sidecar.image"},
+			Images: map[string]string{"envoyproxy/envoy": "1.27.0"},
+		},
+	}
+
+	plan, err := BuildBumpPlan(sets)
+	if err != nil {
+		t.Fatalf("Unexpected error building plan: %v", err)
+	}
+	if len(plan.Files) != 2 {
+		t.Fatalf("Expected 2 planned files, got: %d", len(plan.Files))
+	}
+
+	var got []string
+	for _, pf := range plan.Files {
+		for _, c := range pf.Changes {
+			got = append(got, filepath.Base(pf.File)+" "+c.Path+" "+c.OldValue+"->"+c.NewValue)
+		}
+	}
+	want := []string{
+		"aspire-test.yaml images.web ghcr.io/my-org/web-app:1.7.99->ghcr.io/my-org/web-app:1.8.0",
+		"multiple-bump.yaml image.tag 1.7.99->1.8.0",
+		"multiple-bump.yaml sidecar.image.tag 1.26.5->1.27.0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected plan changes:\n%s", strings.Join(got, "\n"))
+	}
+
+	// Planning must not touch the files.
+	data, _ := os.ReadFile(structured)
+	if !strings.Contains(string(data), "tag: 1.7.99") {
+		t.Errorf("Expected plan to leave files untouched")
+	}
+
+	if err := ApplyBumpPlan(plan); err != nil {
+		t.Fatalf("Unexpected error applying plan: %v", err)
+	}
+	data, _ = os.ReadFile(structured)
+	if !strings.Contains(string(data), "tag: 1.8.0") || !strings.Contains(string(data), "tag: 1.27.0") {
+		t.Errorf("Expected planned tags to be applied, got:\n%s", data)
+	}
+	if !strings.Contains(string(data), "tag: 1.45.0") {
+		t.Errorf("Expected unplanned tags to be left alone, got:\n%s", data)
+	}
+
+	if err := ApplyBumpPlan(plan); err == nil {
+		t.Errorf("Expected re-applying a plan to stale files to fail")
+	}
+}
+
+// TestBuildAndApplyBumpPlanCreate verifies that a plan which creates an image
+// block with createValuesPaths can be applied, and only once.
+func TestBuildAndApplyBumpPlanCreate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	manifest := "apiVersion: helm.toolkit.fluxcd.io/v2\nkind: HelmRelease\nmetadata:\n  name: app\nspec:\n  interval: 5m\n  values:\n    image:\n      repository: ghcr.io/acme/api\n      tag: 1.0.0\n"
+	if err := os.WriteFile(file, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sets := []updateSet{{
+		Files:             []string{file},
+		Images:            map[string]string{"ghcr.io/acme/api": "1.1.0", "ghcr.io/acme/worker": "1.0.0"},
+		CreateValuesPaths: map[string]string{"ghcr.io/acme/worker": "worker.image"},
+	}}
+	plan, err := BuildBumpPlan(sets)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.Files) != 1 || len(plan.Files[0].Changes) != 2 {
+		t.Fatalf("Expected two planned changes, got %+v", plan.Files)
+	}
+	if err := ApplyBumpPlan(plan); err != nil {
+		t.Fatalf("Unexpected error applying the plan: %v", err)
+	}
+	data, _ := os.ReadFile(file)
+	if !strings.Contains(string(data), "    worker:\n      image:\n        repository: ghcr.io/acme/worker\n        tag: 1.0.0\n") || !strings.Contains(string(data), "tag: 1.1.0") {
+		t.Errorf("Expected the bump and the created block in:\n%s", data)
+	}
+
+	plan.Files[0].SHA256 = ""
+	if err := ApplyBumpPlan(plan); err == nil {
+		t.Error("Expected a second apply to fail")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// bumpPluginPrefix is the name prefix of bump plugins: a manifest of kind
+// Rollout is handed to an executable named flux-helpers-bump-rollout on PATH.
+const bumpPluginPrefix = "flux-helpers-bump-"
+
+// bumpPluginRequest is written as JSON to a bump plugin's stdin.
+type bumpPluginRequest struct {
+	// Manifest is the document to bump, as read from the file.
+	Manifest string `json:"manifest"`
+	// Updates maps image repositories (or globs) to versions.
+	Updates map[string]string `json:"updates"`
+	// UpdatesRegex maps regular expressions over repositories to versions.
+	UpdatesRegex map[string]string `json:"updatesRegex,omitempty"`
+	// Paths restricts updates to matches at these paths, as given to --path.
+	Paths []string `json:"paths,omitempty"`
+	// DryRun asks the plugin to report changes without returning a manifest.
+	DryRun bool `json:"dryRun"`
+}
+
+// bumpPluginResponse is read as JSON from a bump plugin's stdout.
+type bumpPluginResponse struct {
+	// Manifest is the updated document; empty when nothing changed or in
+	// dry-run mode.
+	Manifest string `json:"manifest,omitempty"`
+	// Changes lists every value the plugin changed (or would change).
+	Changes []tagChange `json:"changes"`
+	// Matched optionally lists the keys of updates and updatesRegex that
+	// select at least one image, changed or not, for --strict. Without it,
+	// only the images in Changes count as matched.
+	Matched []string `json:"matched,omitempty"`
+}
+
+// manifestKind returns the kind of a YAML document, or "" if it has none.
+func manifestKind(data []byte) string {
+	var typeMeta struct {
+		Kind string `json:"kind"`
+	}
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return ""
+	}
+	return typeMeta.Kind
+}
+
+// pluginKindPattern matches the kinds that may name a bump plugin. Anything
+// else, such as a kind holding a "/", would make exec.LookPath run a file of
+// the checkout instead of searching PATH.
+var pluginKindPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+
+// bumpPluginName returns the executable name of the bump plugin for kind.
+func bumpPluginName(kind string) string {
+	return bumpPluginPrefix + strings.ToLower(kind)
+}
+
+// lookupBumpPlugin returns the path of the bump plugin for kind on PATH, or
+// "" if there is none or kind cannot name one. HelmReleases are never handed
+// to plugins.
+func lookupBumpPlugin(kind string) string {
+	if kind == "" || kind == "HelmRelease" || !pluginKindPattern.MatchString(kind) {
+		return ""
+	}
+	path, err := exec.LookPath(bumpPluginName(kind))
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// runBumpPlugin bumps data with the plugin at pluginPath. The plugin reads a
+// bumpPluginRequest on stdin and writes a bumpPluginResponse on stdout; what
+// it prints on stderr is passed through as log output.
+//
+// Parameters:
+//   - pluginPath: The plugin executable.
+//   - data: The manifest to bump.
+//   - updates: Image name to version updates.
+//   - opts: The bump options; DryRun, RegexUpdates and Paths are passed on.
+//
+// Returns:
+//   - A bumpResult built from the plugin's response.
+//   - An error if the plugin fails or its response is not valid.
+func runBumpPlugin(pluginPath string, data []byte, updates map[string]string, opts bumpOptions) (*bumpResult, error) {
+	response, err := callBumpPlugin(pluginPath, data, updates, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &bumpResult{Changes: response.Changes}
+	var images []string
+	for _, c := range response.Changes {
+		images = appendUnique(images, c.Image)
+		if opts.DryRun {
+			logf("[dry-run] Would bump %s at %s: %s → %s\n", c.Image, c.Path, c.OldValue, c.NewValue)
+		} else {
+			logf("🔁 Bumped %s at %s: %s → %s\n", c.Image, c.Path, c.OldValue, c.NewValue)
+		}
+	}
+	result.Updated = len(images)
+	if !opts.DryRun && result.Updated > 0 {
+		if response.Manifest == "" {
+			return nil, fmt.Errorf("plugin %s reported changes but returned no manifest", filepath.Base(pluginPath))
+		}
+		result.Output = []byte(response.Manifest)
+	}
+	return result, nil
+}
+
+// callBumpPlugin runs the plugin at pluginPath with a bumpPluginRequest for
+// data and returns its response.
+func callBumpPlugin(pluginPath string, data []byte, updates map[string]string, opts bumpOptions) (*bumpPluginResponse, error) {
+	request, err := json.Marshal(bumpPluginRequest{
+		Manifest:     string(data),
+		Updates:      updates,
+		UpdatesRegex: opts.RegexUpdates,
+		Paths:        opts.Paths,
+		DryRun:       opts.DryRun,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(pluginPath)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stderr = logOut
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s failed: %w", filepath.Base(pluginPath), err)
+	}
+
+	var response bumpPluginResponse
+	if err := json.Unmarshal(out, &response); err != nil {
+		return nil, fmt.Errorf("plugin %s returned an invalid response: %w", filepath.Base(pluginPath), err)
+	}
+	return &response, nil
+}
+
+// pluginMatchedRequests is matchedImageRequests for a manifest handled by the
+// bump plugin at pluginPath, which is asked for a dry run.
+func pluginMatchedRequests(pluginPath string, data []byte, set updateSet) (map[string]bool, error) {
+	response, err := callBumpPlugin(pluginPath, data, set.Images, set.options(true))
+	if err != nil {
+		return nil, err
+	}
+	matched := map[string]bool{}
+	if response.Matched == nil {
+		for _, c := range response.Changes {
+			response.Matched = append(response.Matched, c.Image)
+		}
+	}
+	for _, key := range response.Matched {
+		if _, ok := set.Images[key]; ok {
+			matched[key] = true
+		}
+		if _, ok := set.ImagesRegex[key]; ok {
+			matched["regex "+key] = true
+		}
+	}
+	return matched, nil
+}
+
+// findBumpPlugins returns the bump plugins on PATH, by type. When several
+// directories hold the same plugin, the first one wins, as for any command.
+func findBumpPlugins() (map[string]string, []string) {
+	plugins := map[string]string{}
+	var shadowed []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, bumpPluginPrefix) || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			pluginType := strings.TrimSuffix(strings.TrimPrefix(name, bumpPluginPrefix), filepath.Ext(name))
+			if _, exists := plugins[pluginType]; exists {
+				shadowed = append(shadowed, path)
+				continue
+			}
+			plugins[pluginType] = path
+		}
+	}
+	return plugins, shadowed
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage bump plugins for custom manifest types",
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the bump plugins found on PATH",
+	Long: "bump hands manifests whose kind it does not support to an executable named " +
+		bumpPluginPrefix + "<kind in lowercase> on PATH, e.g. " + bumpPluginPrefix + "rollout. " +
+		"list shows the plugins found.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plugins, shadowed := findBumpPlugins()
+		if len(plugins) == 0 {
+			logf("No bump plugins found on PATH (executables named %s<type>)\n", bumpPluginPrefix)
+			return nil
+		}
+		types := make([]string, 0, len(plugins))
+		for t := range plugins {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Printf("%s\t%s\n", t, plugins[t])
+		}
+		for _, path := range shadowed {
+			logf("⚠️ %s is shadowed by an earlier plugin of the same type on PATH\n", path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	pluginCmd.AddCommand(pluginListCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
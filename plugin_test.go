@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rolloutManifest is an Argo Rollout, which bump only handles via a plugin.
+const rolloutManifest = `apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: my-api
+spec:
+  template:
+    spec:
+      containers:
+        - name: api
+          image: ghcr.io/my-org/my-api:1.7.0
+`
+
+// rolloutPlugin is a bump plugin for Rollouts that checks it was asked to
+// bump my-api to 1.8.0 and answers with a fixed response.
+const rolloutPlugin = `#!/bin/sh
+request=$(cat)
+case "$request" in
+  *'"ghcr.io/my-org/my-api":"1.8.0"'*) ;;
+  *) echo "unexpected request: $request" >&2; exit 1 ;;
+esac
+echo "bumping rollout" >&2
+cat <<'EOF'
+{"manifest": "kind: Rollout\nimage: ghcr.io/my-org/my-api:1.8.0\n",
+ "changes": [{"image": "ghcr.io/my-org/my-api", "path": "spec.template.spec.containers.image", "oldValue": "ghcr.io/my-org/my-api:1.7.0", "newValue": "ghcr.io/my-org/my-api:1.8.0"}]}
+EOF
+`
+
+// installRolloutPlugin puts the Rollout plugin on PATH for the test and
+// returns its path.
+func installRolloutPlugin(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, bumpPluginName("Rollout"))
+	if err := os.WriteFile(path, []byte(rolloutPlugin), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return path
+}
+
+// TestBumpPlugin verifies that manifests of other kinds are handed to the
+// bump plugin for their kind.
+func TestBumpPlugin(t *testing.T) {
+	installRolloutPlugin(t)
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+
+	result, err := bumpHelmReleaseData([]byte(rolloutManifest), updates, bumpOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 1 || len(result.Changes) != 1 || result.Output != nil {
+		t.Errorf("Expected one change and no output in dry-run, got %+v", result)
+	}
+
+	result, err = bumpHelmReleaseData([]byte(rolloutManifest), updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "kind: Rollout\nimage: ghcr.io/my-org/my-api:1.8.0\n"; string(result.Output) != want {
+		t.Errorf("Expected output %q, got %q", want, result.Output)
+	}
+	if result.Changes[0].NewValue != "ghcr.io/my-org/my-api:1.8.0" {
+		t.Errorf("Unexpected change: %+v", result.Changes[0])
+	}
+
+	_, err = bumpHelmReleaseData([]byte(rolloutManifest), map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}, bumpOptions{})
+	if err == nil || !strings.Contains(err.Error(), "plugin flux-helpers-bump-rollout failed") {
+		t.Errorf("Expected the plugin failure to be reported, got: %v", err)
+	}
+}
+
+// TestBumpPluginMissing verifies the error for a kind without a plugin.
+func TestBumpPluginMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := bumpHelmReleaseData([]byte(rolloutManifest), map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{})
+	if err == nil || !strings.Contains(err.Error(), `unexpected kind "Rollout"`) || !strings.Contains(err.Error(), "flux-helpers-bump-rollout") {
+		t.Errorf("Expected an unexpected kind error naming the plugin, got: %v", err)
+	}
+}
+
+// TestBumpPluginInvalidKind verifies that a kind that is not a plain name
+// cannot run an executable of the checkout as a plugin.
+func TestBumpPluginInvalidKind(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, bumpPluginPrefix), 0755); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(dir, "ran")
+	if err := os.WriteFile(filepath.Join(dir, "evil"), []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	for _, kind := range []string{"/../evil", "../evil", "Roll-out", "1Rollout"} {
+		manifest := "kind: " + kind + "\nimage: foo:0.9.0\n"
+		_, err := bumpHelmReleaseData([]byte(manifest), map[string]string{"foo": "1.0.0"}, bumpOptions{})
+		if err == nil || !strings.Contains(err.Error(), "unexpected kind") {
+			t.Errorf("%s: expected an unexpected kind error, got: %v", kind, err)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected the executable not to run")
+	}
+}
+
+// TestBumpPluginStrict verifies that --strict counts the images a plugin
+// changes as matched.
+func TestBumpPluginStrict(t *testing.T) {
+	installRolloutPlugin(t)
+	file := filepath.Join(t.TempDir(), "rollout.yaml")
+	if err := os.WriteFile(file, []byte(rolloutManifest), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	sets := []updateSet{{Files: []string{file}, Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}}}
+	unmatched, err := findUnmatchedImages(sets, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(unmatched) != 0 {
+		t.Errorf("Expected no unmatched images, got: %v", unmatched)
+	}
+}
+
+// TestFindBumpPlugins verifies plugin discovery and shadowing on PATH.
+func TestFindBumpPlugins(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	for _, f := range []string{
+		filepath.Join(first, "flux-helpers-bump-rollout"),
+		filepath.Join(second, "flux-helpers-bump-rollout"),
+		filepath.Join(second, "flux-helpers-bump-scaledjob.sh"),
+	} {
+		if err := os.WriteFile(f, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to write plugin: %v", err)
+		}
+	}
+	// Not executable, so not a plugin.
+	if err := os.WriteFile(filepath.Join(first, "flux-helpers-bump-notes"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	t.Setenv("PATH", first+string(os.PathListSeparator)+second)
+
+	plugins, shadowed := findBumpPlugins()
+	want := fmt.Sprintf("map[rollout:%s scaledjob:%s]", filepath.Join(first, "flux-helpers-bump-rollout"), filepath.Join(second, "flux-helpers-bump-scaledjob.sh"))
+	if fmt.Sprint(plugins) != want {
+		t.Errorf("Expected %s, got %v", want, plugins)
+	}
+	if len(shadowed) != 1 || shadowed[0] != filepath.Join(second, "flux-helpers-bump-rollout") {
+		t.Errorf("Expected the second rollout plugin to be shadowed, got %v", shadowed)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// policyPath is the policy file given with --policy.
+	policyPath string
+	// allowMajor lifts the rules that set requireAllowMajor (--allow-major).
+	allowMajor bool
+)
+
+// Version jump sizes, from smallest to largest, as used by policyRule.MaxBump.
+const (
+	bumpPatch = "patch"
+	bumpMinor = "minor"
+	bumpMajor = "major"
+)
+
+var bumpSizes = map[string]int{bumpPatch: 0, bumpMinor: 1, bumpMajor: 2}
+
+// bumpPolicy is a policy file restricting which tag changes may be made, e.g.:
+//
+//	rules:
+//	  - name: prod-patch-only
+//	    files: [clusters/prod/**]
+//	    maxBump: patch
+//	  - name: no-prerelease-in-prod
+//	    files: [clusters/prod/**]
+//	    denyPrerelease: true
+//	  - name: majors-need-approval
+//	    requireAllowMajor: true
+//
+// Every rule applies to the changes in the files and of the images it
+// selects; a change must satisfy all of them.
+type bumpPolicy struct {
+	Rules []policyRule `json:"rules"`
+
+	// allowMajor is set from --allow-major and never read from files.
+	allowMajor bool
+}
+
+// policyRule is a single rule of a bumpPolicy.
+type policyRule struct {
+	// Name identifies the rule in violation messages.
+	Name string `json:"name"`
+	// Files restricts the rule to files matching one of these patterns (see
+	// matchPolicyFile). Empty selects every file.
+	Files []string `json:"files,omitempty"`
+	// Images restricts the rule to repositories matching one of these globs.
+	// Empty selects every image.
+	Images []string `json:"images,omitempty"`
+	// MaxBump is the largest version jump allowed: patch, minor or major.
+	MaxBump string `json:"maxBump,omitempty"`
+	// DenyPrerelease forbids new tags with a pre-release part, e.g. 1.2.0-rc.1.
+	DenyPrerelease bool `json:"denyPrerelease,omitempty"`
+	// RequireAllowMajor forbids major bumps unless --allow-major is given.
+	RequireAllowMajor bool `json:"requireAllowMajor,omitempty"`
+}
+
+// loadBumpPolicy reads and validates the policy file, applying --allow-major.
+// It returns nil if file is empty.
+func loadBumpPolicy(file string, allowMajor bool) (*bumpPolicy, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var p bumpPolicy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", file, err)
+	}
+	if len(p.Rules) == 0 {
+		return nil, fmt.Errorf("invalid policy file %s: no rules defined", file)
+	}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("invalid policy file %s: rule %d has no name", file, i+1)
+		}
+		if _, ok := bumpSizes[rule.MaxBump]; rule.MaxBump != "" && !ok {
+			return nil, fmt.Errorf("invalid policy file %s: rule %q: invalid maxBump %q (expected patch, minor or major)", file, rule.Name, rule.MaxBump)
+		}
+		for _, pattern := range append(append([]string(nil), rule.Files...), rule.Images...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid policy file %s: rule %q: invalid pattern %q: %w", file, rule.Name, pattern, err)
+			}
+		}
+	}
+	p.allowMajor = allowMajor
+	return &p, nil
+}
+
+// addPolicyFlags registers --policy and --allow-major on cmd.
+func addPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&policyPath, "policy", "", "Reject tag changes that violate the rules of this policy file")
+	cmd.Flags().BoolVar(&allowMajor, "allow-major", false, "Allow major version bumps that --policy rules with requireAllowMajor reject")
+}
+
+// setPolicy loads the policy file and attaches it to every update set.
+func setPolicy(sets []updateSet, file string, allowMajor bool) error {
+	policy, err := loadBumpPolicy(file, allowMajor)
+	if err != nil {
+		return err
+	}
+	for i := range sets {
+		sets[i].policy = policy
+	}
+	return nil
+}
+
+// check returns an error naming the rule and the change if any change made
+// in file violates the policy. A nil policy allows everything.
+func (p *bumpPolicy) check(file string, changes []tagChange) error {
+	if p == nil {
+		return nil
+	}
+	for _, change := range changes {
+		for _, rule := range p.Rules {
+			if !rule.selects(file, change.Image) {
+				continue
+			}
+			if reason := rule.violation(change, p.allowMajor); reason != "" {
+				return fmt.Errorf("policy %q violated by %s at %s in %s: %s", rule.Name, change.Image, change.Path, file, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// selects reports whether the rule applies to image in file.
+func (r policyRule) selects(file, image string) bool {
+	if len(r.Files) > 0 && !matchesAny(r.Files, file, matchPolicyFile) {
+		return false
+	}
+	if len(r.Images) > 0 && !matchesAny(r.Images, image, func(pattern, image string) bool {
+		ok, _ := path.Match(pattern, image)
+		return ok
+	}) {
+		return false
+	}
+	return true
+}
+
+// matchesAny reports whether match accepts value for any of patterns.
+func matchesAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPolicyFile matches a file path against a policy file pattern. A
+// pattern ending in "/" or "/**" selects everything below that directory;
+// other patterns are globs matched against the whole path.
+func matchPolicyFile(pattern, file string) bool {
+	file = filepath.ToSlash(filepath.Clean(file))
+	if dir, ok := strings.CutSuffix(pattern, "**"); ok && strings.HasSuffix(dir, "/") {
+		pattern = dir
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(file, path.Clean(pattern)+"/")
+	}
+	ok, _ := path.Match(path.Clean(pattern), file)
+	return ok
+}
+
+// violation returns why change breaks the rule, or "".
+func (r policyRule) violation(change tagChange, allowMajor bool) string {
+	oldTag := strings.TrimPrefix(change.OldValue, change.Image+":")
+	newTag := strings.TrimPrefix(change.NewValue, change.Image+":")
+	newVersion, err := semver.NewVersion(newTag)
+	if err != nil {
+		// bump only writes semver tags, but a plan may have been edited.
+		if r.DenyPrerelease || r.MaxBump != "" || r.RequireAllowMajor {
+			return fmt.Sprintf("new tag %q is not a semver version", newTag)
+		}
+		return ""
+	}
+	if r.DenyPrerelease && newVersion.Prerelease() != "" {
+		return fmt.Sprintf("denyPrerelease: %s is a pre-release", newTag)
+	}
+
+	oldVersion, err := semver.NewVersion(oldTag)
+	if err != nil {
+		// Without a current version, e.g. "latest", the jump is unknown.
+		return ""
+	}
+	size := versionBump(oldVersion, newVersion)
+	if r.MaxBump != "" && bumpSizes[size] > bumpSizes[r.MaxBump] {
+		return fmt.Sprintf("maxBump %s: %s → %s is a %s bump", r.MaxBump, oldTag, newTag, size)
+	}
+	if r.RequireAllowMajor && size == bumpMajor && !allowMajor {
+		return fmt.Sprintf("requireAllowMajor: %s → %s is a major bump (use --allow-major)", oldTag, newTag)
+	}
+	return ""
+}
+
+// versionBump classifies the jump between two versions as major, minor or
+// patch, by the most significant component that differs. Downgrades are
+// classified the same way.
+func versionBump(from, to *semver.Version) string {
+	switch {
+	case from.Major() != to.Major():
+		return bumpMajor
+	case from.Minor() != to.Minor():
+		return bumpMinor
+	}
+	return bumpPatch
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `rules:
+  - name: prod-patch-only
+    files: [clusters/prod/**]
+    maxBump: patch
+  - name: no-prerelease-in-prod
+    files: [clusters/prod/]
+    denyPrerelease: true
+  - name: majors-need-approval
+    images: [ghcr.io/my-org/*]
+    requireAllowMajor: true
+`
+
+// TestBumpPolicyCheck verifies which changes each kind of rule rejects.
+func TestBumpPolicyCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(testPolicy), 0644); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		image      string
+		old, new   string
+		allowMajor bool
+		wantRule   string
+	}{
+		{"patch in prod", "clusters/prod/app.yaml", "ghcr.io/my-org/api", "1.2.3", "1.2.4", false, ""},
+		{"minor in prod", "clusters/prod/app.yaml", "ghcr.io/my-org/api", "1.2.3", "1.3.0", false, "prod-patch-only"},
+		{"minor in staging", "clusters/staging/app.yaml", "ghcr.io/my-org/api", "1.2.3", "1.3.0", false, ""},
+		{"pre-release in prod", "clusters/prod/apps/app.yaml", "ghcr.io/my-org/api", "1.2.3", "1.2.4-rc.1", false, "no-prerelease-in-prod"},
+		{"major without flag", "clusters/dev/app.yaml", "ghcr.io/my-org/api", "v1.2.3", "v2.0.0", false, "majors-need-approval"},
+		{"major with flag", "clusters/dev/app.yaml", "ghcr.io/my-org/api", "1.2.3", "2.0.0", true, ""},
+		{"major of another image", "clusters/dev/app.yaml", "docker.io/library/redis", "6.2.0", "7.0.0", false, ""},
+		{"major in prod with flag", "clusters/prod/app.yaml", "ghcr.io/my-org/api", "1.2.3", "2.0.0", true, "prod-patch-only"},
+		{"non-semver current tag", "clusters/prod/app.yaml", "ghcr.io/my-org/api", "latest", "2.0.0", false, ""},
+		{"repo:tag string", "clusters/prod/app.yaml", "ghcr.io/my-org/api", "ghcr.io/my-org/api:1.2.3", "ghcr.io/my-org/api:1.3.0", false, "prod-patch-only"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := loadBumpPolicy(file, tc.allowMajor)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			err = policy.check(tc.file, []tagChange{{Image: tc.image, Path: "image.tag", OldValue: tc.old, NewValue: tc.new}})
+			if tc.wantRule == "" {
+				if err != nil {
+					t.Errorf("Expected no violation, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), `policy "`+tc.wantRule+`" violated`) {
+				t.Errorf("Expected a %s violation, got: %v", tc.wantRule, err)
+			}
+		})
+	}
+}
+
+// TestLoadBumpPolicyInvalid verifies that malformed policy files are rejected.
+func TestLoadBumpPolicyInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no rules":        "rules: []\n",
+		"unnamed rule":    "rules:\n  - maxBump: patch\n",
+		"unknown maxBump": "rules:\n  - name: x\n    maxBump: tiny\n",
+		"unknown field":   "rules:\n  - name: x\n    maxJump: patch\n",
+		"bad pattern":     "rules:\n  - name: x\n    files: ['[']\n",
+	} {
+		file := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy: %v", err)
+		}
+		if _, err := loadBumpPolicy(file, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestBumpRejectsPolicyViolation verifies that a violating bump fails without
+// modifying the file.
+func TestBumpRejectsPolicyViolation(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	policy := &bumpPolicy{Rules: []policyRule{{Name: "patch-only", MaxBump: bumpPatch}}}
+
+	_, err = bumpHelmReleaseFile(file, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{Policy: policy})
+	if err == nil || !strings.Contains(err.Error(), `policy "patch-only" violated`) {
+		t.Fatalf("Expected a policy violation, got: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != string(original) {
+		t.Errorf("Expected the file to be left unchanged, got:\n%s", data)
+	}
+
+	if _, err := bumpHelmReleaseFile(file, map[string]string{"ghcr.io/my-org/my-api": "1.7.100"}, bumpOptions{Policy: policy}); err != nil {
+		t.Errorf("Unexpected error for a patch bump: %v", err)
+	}
+}
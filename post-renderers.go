@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	helmv2beta1 "github.com/fluxcd/helm-controller/api/v2beta1"
+	helmv2beta2 "github.com/fluxcd/helm-controller/api/v2beta2"
+	"sigs.k8s.io/yaml"
+)
+
+// postRenderersPath is the path prefix of changes made in .spec.postRenderers
+// rather than .spec.values, e.g.
+// "spec.postRenderers.kustomize.patches.patch.value".
+const postRenderersPath = "spec.postRenderers"
+
+// kustomizeImageMatchers recognise the entries of a kustomize post-renderer's
+// `images` list (name, newName, newTag). An entry with a newName is only
+// matched by that name; see postRendererView.findImages.
+var kustomizeImageMatchers = []imageMatcher{
+	{Name: "kustomize-image-new-name", RepositoryKey: "newName", TagKey: "newTag"},
+	{Name: "kustomize-image", RepositoryKey: "name", TagKey: "newTag"},
+}
+
+// PostRenderers returns a copy of the .spec.postRenderers of the HelmRelease
+// as generic JSON values, including fields the API types do not know.
+func (m *helmReleaseManifest) PostRenderers() ([]interface{}, error) {
+	spec, _ := m.document["spec"].(map[string]interface{})
+	raw, err := json.Marshal(spec["postRenderers"])
+	if err != nil {
+		return nil, err
+	}
+	var renderers []interface{}
+	if err := json.Unmarshal(raw, &renderers); err != nil {
+		return nil, err
+	}
+	return renderers, nil
+}
+
+// SetPostRenderers replaces the .spec.postRenderers of the HelmRelease, in
+// both the typed object and the document it is written from.
+func (m *helmReleaseManifest) SetPostRenderers(renderers []interface{}) error {
+	raw, err := json.Marshal(renderers)
+	if err != nil {
+		return err
+	}
+	switch hr := m.Object.(type) {
+	case *helmv2beta1.HelmRelease:
+		hr.Spec.PostRenderers = nil
+		err = json.Unmarshal(raw, &hr.Spec.PostRenderers)
+	case *helmv2beta2.HelmRelease:
+		hr.Spec.PostRenderers = nil
+		err = json.Unmarshal(raw, &hr.Spec.PostRenderers)
+	case *helmv2.HelmRelease:
+		hr.Spec.PostRenderers = nil
+		err = json.Unmarshal(raw, &hr.Spec.PostRenderers)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update .spec.postRenderers: %w", err)
+	}
+	spec, ok := m.document["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		m.document["spec"] = spec
+	}
+	if _, had := spec["postRenderers"]; had || len(renderers) > 0 {
+		spec["postRenderers"] = renderers
+	}
+	return nil
+}
+
+// postRendererView exposes the .spec.postRenderers of a HelmRelease to the
+// image matchers. Kustomize patches are strings holding YAML or JSON; the
+// view parses them in place so image references inside them are found and
+// changed like any other value, and sync writes them back.
+type postRendererView struct {
+	// root is {"spec": {"postRenderers": renderers}}, so match paths start
+	// with postRenderersPath.
+	root      map[string]interface{}
+	renderers []interface{}
+	patches   []postRendererPatch
+}
+
+// postRendererPatch remembers how a parsed kustomize patch was written.
+type postRendererPatch struct {
+	// item is the entry of `patches` whose "patch" was parsed.
+	item map[string]interface{}
+	// raw is the patch as written in the manifest.
+	raw string
+	// json is set for patches written as JSON rather than YAML.
+	json bool
+	// parsed is the canonical serialization of the parsed patch, to detect
+	// changes.
+	parsed string
+}
+
+// newPostRendererView returns a view of the .spec.postRenderers of hr, or nil
+// if it has none. Patches that cannot be parsed are left as they are.
+func newPostRendererView(hr *helmReleaseManifest) (*postRendererView, error) {
+	renderers, err := hr.PostRenderers()
+	if err != nil || len(renderers) == 0 {
+		return nil, err
+	}
+	v := &postRendererView{
+		root:      map[string]interface{}{"spec": map[string]interface{}{"postRenderers": renderers}},
+		renderers: renderers,
+	}
+
+	for _, r := range renderers {
+		renderer, _ := r.(map[string]interface{})
+		kustomize, _ := renderer["kustomize"].(map[string]interface{})
+		patches, _ := kustomize["patches"].([]interface{})
+		for _, p := range patches {
+			item, _ := p.(map[string]interface{})
+			raw, ok := item["patch"].(string)
+			if !ok {
+				continue
+			}
+			var parsed interface{}
+			if err := yaml.Unmarshal([]byte(raw), &parsed); err != nil || parsed == nil {
+				continue
+			}
+			trimmed := strings.TrimSpace(raw)
+			patch := postRendererPatch{item: item, raw: raw, json: strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")}
+			if patch.parsed, err = patch.serialize(parsed); err != nil {
+				continue
+			}
+			item["patch"] = parsed
+			v.patches = append(v.patches, patch)
+		}
+	}
+	return v, nil
+}
+
+// serialize writes a parsed patch back in the format it was read in.
+func (p postRendererPatch) serialize(parsed interface{}) (string, error) {
+	if p.json {
+		out, err := json.Marshal(parsed)
+		return string(out), err
+	}
+	out, err := yaml.Marshal(parsed)
+	return string(out), err
+}
+
+// findImages returns the matches of imageName in the post-renderers: image
+// references inside kustomize patches and strategic merge or JSON 6902
+// patches, and the newTag of kustomize `images` entries.
+func (v *postRendererView) findImages(imageName string, matchers []imageMatcher) []imageMatch {
+	matchers = append(append([]imageMatcher(nil), matchersOrDefault(matchers)...), kustomizeImageMatchers...)
+	var matches []imageMatch
+	for _, m := range findImageBlocks(v.root, imageName, matchers) {
+		// An entry renaming another image applies to its new name only.
+		if newName, _ := m.Block["newName"].(string); m.TagKey == "newTag" && newName != "" && newName != imageName {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// repositories returns the image repositories referenced in the
+// post-renderers, for resolving glob and regex updates.
+func (v *postRendererView) repositories(matchers []imageMatcher) []string {
+	matchers = append(append([]imageMatcher(nil), matchersOrDefault(matchers)...), kustomizeImageMatchers...)
+	return collectImageRepositories(v.root, matchers)
+}
+
+// replace is replaceValueAtPath for a path starting with postRenderersPath.
+func (v *postRendererView) replace(path, oldValue, newValue string) int {
+	return replaceValueAtPath(v.root, path, oldValue, newValue)
+}
+
+// sync writes the post-renderers back to hr, re-serializing the patches that
+// changed and restoring the others verbatim. The view must not be used
+// afterwards.
+func (v *postRendererView) sync(hr *helmReleaseManifest) error {
+	for _, p := range v.patches {
+		out, err := p.serialize(p.item["patch"])
+		if err != nil {
+			return fmt.Errorf("failed to serialize post-renderer patch: %w", err)
+		}
+		if out == p.parsed {
+			out = p.raw
+		}
+		p.item["patch"] = out
+	}
+	return hr.SetPostRenderers(v.renderers)
+}
+
+// replaceChangeValue is replaceValueAtPath for a change to a HelmRelease: paths
+// starting with postRenderersPath are replaced in postRenderers (which may be
+// nil), all others in values.
+func replaceChangeValue(values map[string]interface{}, postRenderers *postRendererView, path, oldValue, newValue string) int {
+	if rest, ok := strings.CutPrefix(path, postRenderersPath); ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "[")) {
+		if postRenderers == nil {
+			return 0
+		}
+		return postRenderers.replace(path, oldValue, newValue)
+	}
+	return replaceValueAtPath(values, path, oldValue, newValue)
+}
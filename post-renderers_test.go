@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpPostRenderers verifies that image references in kustomize
+// post-renderer patches and images are bumped along with the values, and
+// that untouched patches are kept verbatim.
+func TestBumpPostRenderers(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-post-renderers.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	updates := map[string]string{
+		"ghcr.io/my-org/my-api": "1.8.0",
+		"envoyproxy/envoy":      "1.28.0",
+		"ghcr.io/my-org/worker": "2.1.0",
+		"ghcr.io/my-org/nginx":  "1.26.0",
+		// Renamed to ghcr.io/my-org/nginx by the images entry.
+		"nginx": "9.9.9",
+	}
+
+	result, err := bumpHelmReleaseData(data, updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 4 {
+		t.Errorf("Expected 4 updated images, got %d: %+v", result.Updated, result.Changes)
+	}
+	var paths []string
+	for _, c := range result.Changes {
+		paths = append(paths, c.Path)
+	}
+	want := "spec.postRenderers[0].kustomize.patches[0].patch.spec.template.spec.containers[0].image," +
+		"image.tag,spec.postRenderers[0].kustomize.patches[1].patch[0].value," +
+		"spec.postRenderers[0].kustomize.images[1].newTag,spec.postRenderers[0].kustomize.images[0].newTag"
+	if got := strings.Join(paths, ","); got != want {
+		t.Errorf("Unexpected change paths:\n got %s\nwant %s", got, want)
+	}
+
+	out := string(result.Output)
+	for _, want := range []string{
+		"tag: 1.8.0",
+		"image: envoyproxy/envoy:1.28.0",
+		"value: ghcr.io/my-org/my-api:1.8.0",
+		"newTag: 2.1.0",
+		"newName: ghcr.io/my-org/nginx\n        newTag: 1.26.0",
+		// Untouched patches are kept as written.
+		`'[{"op": "add", "path": "/metadata/labels/team", "value": "platform"}]'`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "9.9.9") {
+		t.Errorf("Expected the renamed image not to be bumped, got:\n%s", out)
+	}
+
+	// --path restricts the bump to the post-renderers.
+	result, err = bumpHelmReleaseData(data, updates, bumpOptions{DryRun: true, Paths: []string{".spec.postRenderers.kustomize.images"}})
+	if err != nil || len(result.Changes) != 2 {
+		t.Errorf("Expected only the images entries to be selected, got %+v, err %v", result.Changes, err)
+	}
+}
+
+// TestPlanPostRenderers verifies that plans record and apply post-renderer
+// changes.
+func TestPlanPostRenderers(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-post-renderers.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "release.yaml")
+	os.WriteFile(file, data, 0644)
+
+	plan, err := BuildBumpPlan([]updateSet{{Files: []string{file}, Images: map[string]string{"envoyproxy/*": "1.28.0"}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plan.Files) != 1 || len(plan.Files[0].Changes) != 1 {
+		t.Fatalf("Expected one planned change, got %+v", plan.Files)
+	}
+	if err := ApplyBumpPlan(plan); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, _ := os.ReadFile(file)
+	if !strings.Contains(string(out), "image: envoyproxy/envoy:1.28.0") {
+		t.Errorf("Expected the patch to be bumped, got:\n%s", out)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quiet suppresses every progress and status message (set with --quiet);
+// errors and the output of commands, such as tables and JSON, are still
+// written.
+var quiet bool
+
+// progressBarWidth is the number of cells of a progress bar.
+const progressBarWidth = 30
+
+// progress tracks a stage of a command that works through many items, such
+// as the files of a directory or the repositories of a registry. On a
+// terminal it draws a progress bar on stderr, and when the stage is done it
+// logs how long it took.
+type progress struct {
+	mu      sync.Mutex
+	stage   string
+	unit    string
+	total   int
+	done    int
+	started time.Time
+	// out receives the bar; nil when stderr is not a terminal or with
+	// --quiet.
+	out   io.Writer
+	drawn bool
+}
+
+// activeProgress is the progress whose bar logf clears and redraws around
+// its messages, or nil.
+var (
+	activeProgressMu sync.Mutex
+	activeProgress   *progress
+)
+
+// stderrIsTerminal reports whether stderr is an interactive terminal that
+// can draw a progress bar.
+func stderrIsTerminal() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts tracking a stage of total items named unit (e.g.
+// "file"). Call Increment after each item and Done at the end.
+func startProgress(stage, unit string, total int) *progress {
+	p := &progress{stage: stage, unit: unit, total: total, started: time.Now()}
+	if !quiet && total > 1 && stderrIsTerminal() {
+		p.out = os.Stderr
+	}
+	activeProgressMu.Lock()
+	activeProgress = p
+	activeProgressMu.Unlock()
+	p.mu.Lock()
+	p.draw()
+	p.mu.Unlock()
+	return p
+}
+
+// Increment records that one more item is done. It is safe for concurrent
+// use.
+func (p *progress) Increment() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.draw()
+}
+
+// Done removes the bar and, for stages of more than one item, logs how many
+// items the stage worked through and how long it took.
+func (p *progress) Done() {
+	activeProgressMu.Lock()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+	activeProgressMu.Unlock()
+
+	p.mu.Lock()
+	p.clear()
+	done, elapsed := p.done, time.Since(p.started)
+	p.mu.Unlock()
+	if p.total > 1 {
+		logf("⏱️ %s: %d %s(s) in %s\n", p.stage, done, p.unit, formatElapsed(elapsed))
+	}
+}
+
+// abortProgress erases the bar of the active progress, if any, without
+// logging its timing, e.g. before an error is printed.
+func abortProgress() {
+	activeProgressMu.Lock()
+	p := activeProgress
+	activeProgress = nil
+	activeProgressMu.Unlock()
+	if p != nil {
+		p.mu.Lock()
+		p.clear()
+		p.mu.Unlock()
+	}
+}
+
+// draw redraws the bar; p.mu must be held.
+func (p *progress) draw() {
+	if p.out == nil {
+		return
+	}
+	filled := progressBarWidth
+	if p.total > 0 && p.done < p.total {
+		filled = progressBarWidth * p.done / p.total
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	if filled > 0 && filled < progressBarWidth {
+		bar = bar[:filled-1] + ">" + bar[filled:]
+	}
+	fmt.Fprintf(p.out, "\r\033[K⏳ %s [%s] %d/%d %s", p.stage, bar, p.done, p.total, formatElapsed(time.Since(p.started)))
+	p.drawn = true
+}
+
+// clear erases the bar from the terminal; p.mu must be held.
+func (p *progress) clear() {
+	if p.out != nil && p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// aroundProgress calls write with the bar of the active progress, if any,
+// erased, and redraws the bar afterwards, so messages do not run into it.
+func aroundProgress(write func()) {
+	activeProgressMu.Lock()
+	p := activeProgress
+	activeProgressMu.Unlock()
+	if p == nil {
+		write()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	write()
+	p.draw()
+}
+
+// formatElapsed rounds d for display: to milliseconds below a second and to
+// tenths of a second above.
+func formatElapsed(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors and the output of the command, no progress or status messages")
+}
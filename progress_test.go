@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProgress verifies that a stage of several items logs its timing when
+// done, that a single item logs nothing, and that --quiet suppresses both.
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	out := logOut
+	logOut = &buf
+	defer func() { logOut, quiet = out, false }()
+
+	bar := startProgress("bump", "file", 3)
+	for i := 0; i < 3; i++ {
+		logf("✅ file %d\n", i)
+		bar.Increment()
+	}
+	bar.Done()
+	if !strings.Contains(buf.String(), "✅ file 2\n⏱️ bump: 3 file(s) in ") {
+		t.Errorf("Expected the messages followed by the timing, got %q", buf.String())
+	}
+
+	buf.Reset()
+	single := startProgress("bump", "file", 1)
+	single.Increment()
+	single.Done()
+	if buf.Len() != 0 {
+		t.Errorf("Expected no timing for a single file, got %q", buf.String())
+	}
+
+	quiet = true
+	bar = startProgress("verify", "file", 2)
+	logf("✅ quiet\n")
+	bar.Increment()
+	bar.Increment()
+	bar.Done()
+	if buf.Len() != 0 {
+		t.Errorf("Expected --quiet to suppress every message, got %q", buf.String())
+	}
+}
+
+// TestFormatElapsed verifies the rounding of stage timings.
+func TestFormatElapsed(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		1234567 * time.Nanosecond: "1ms",
+		1234 * time.Millisecond:   "1.2s",
+		75 * time.Second:          "1m15s",
+	} {
+		if got := formatElapsed(d); got != want {
+			t.Errorf("formatElapsed(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	promoteFrom   string
+	promoteTo     []string
+	promoteImages []string
+)
+
+// helmReleaseFilesAt resolves paths given to promote: a directory stands for
+// every HelmRelease YAML file below it (see helmReleaseFilesInDir), anything
+// else is a file or glob.
+func helmReleaseFilesAt(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			found, err := helmReleaseFilesInDir(p)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan %s: %w", p, err)
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no HelmRelease found below %s", p)
+			}
+			for _, f := range found {
+				files = appendUnique(files, f)
+			}
+			continue
+		}
+		expanded, err := expandFileGlobs([]string{p})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range expanded {
+			files = appendUnique(files, f)
+		}
+	}
+	return files, nil
+}
+
+// promotedVersions reads the current tag of each image in files, the source
+// environment of a promotion.
+//
+// Returns:
+//   - The tag of every image, to be applied as bump updates.
+//   - An error if an image is not found in files, or is found with different
+//     tags, since it is then unclear which one to promote.
+func promotedVersions(files, images []string) (map[string]string, error) {
+	tags := map[string][]string{}
+	where := map[string][]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		refs, err := listImageReferences(file, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, ref := range refs {
+			tags[ref.Image] = appendUnique(tags[ref.Image], ref.Tag)
+			where[ref.Image] = append(where[ref.Image], fmt.Sprintf("%s (%s: %s)", ref.File, ref.Path, ref.Tag))
+		}
+	}
+
+	versions := map[string]string{}
+	for _, image := range images {
+		switch found := tags[image]; len(found) {
+		case 0:
+			return nil, fmt.Errorf("image %s not found in %s", image, strings.Join(files, ", "))
+		case 1:
+			versions[image] = found[0]
+		default:
+			sort.Strings(found)
+			return nil, fmt.Errorf("image %s has several tags in the source (%s): %s",
+				image, strings.Join(found, ", "), strings.Join(where[image], "; "))
+		}
+	}
+	return versions, nil
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Apply the tags of images in one environment to another",
+	Long: "promote reads the current tag of each --image in the HelmRelease(s) of " +
+		"--from (a file or a directory) and bumps the image to that tag in the " +
+		"HelmRelease(s) of --to, e.g. to promote what runs in staging to prod.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if promoteFrom == "" || len(promoteTo) == 0 || len(promoteImages) == 0 {
+			return fmt.Errorf("--from, --to and at least one --image are required")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+
+		sourceFiles, err := helmReleaseFilesAt([]string{promoteFrom})
+		if err != nil {
+			return err
+		}
+		versions, err := promotedVersions(sourceFiles, promoteImages)
+		if err != nil {
+			return err
+		}
+		targetFiles, err := helmReleaseFilesAt(promoteTo)
+		if err != nil {
+			return err
+		}
+		for _, image := range sortedKeys(versions) {
+			logf("⬆️ Promoting %s %s from %s\n", image, versions[image], promoteFrom)
+		}
+
+		sets := []updateSet{{Files: targetFiles, Images: versions}}
+		if err := setPolicy(sets, policyPath, allowMajor); err != nil {
+			return err
+		}
+		setCheckExists(cmd.Context(), sets, checkExists)
+		unmatched, err := findUnmatchedImages(sets, false)
+		if err != nil {
+			return fmt.Errorf("failed to promote: %w", err)
+		}
+		if len(unmatched) > 0 {
+			return fmt.Errorf("no image block found in %s for %s", strings.Join(promoteTo, ", "), strings.Join(unmatched, ", "))
+		}
+
+		report, err := runBumpSets(sets, dryRun, false)
+		if !dryRun && journalPath != "" && report != nil {
+			if id, jErr := recordJournalRun(journalPath, "promote", report.Files); jErr != nil {
+				logf("⚠️ Failed to record change journal: %v\n", jErr)
+			} else if id != "" {
+				logf("📝 Recorded run %s in %s\n", id, journalPath)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to promote: %w", err)
+		}
+		noChangesMade = report.changeCount() == 0
+
+		if outputFormat == outputJSON {
+			return writeJSON(os.Stdout, report)
+		}
+		return nil
+	},
+}
+
+func init() {
+	promoteCmd.Flags().StringVar(&promoteFrom, "from", "", "HelmRelease file or directory of the source environment")
+	promoteCmd.Flags().StringArrayVar(&promoteTo, "to", nil, "HelmRelease file, glob or directory of the target environment (repeatable)")
+	promoteCmd.Flags().StringArrayVar(&promoteImages, "image", nil, "Image repository to promote (repeatable)")
+	promoteCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview the promotion without modifying files")
+	promoteCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	promoteCmd.Flags().StringVar(&journalPath, "journal", defaultJournalPath, "Record changes in this change journal for rollback (empty to disable)")
+	addBackupFlags(promoteCmd)
+	addPolicyFlags(promoteCmd)
+	promoteCmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a promoted image tag does not exist in its registry")
+	rootCmd.AddCommand(promoteCmd)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPromote verifies that the tag of an image in the source environment is
+// applied to the target environment.
+func TestPromote(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	staging := filepath.Join(dir, "overlays", "staging", "my-app.yaml")
+	prod := filepath.Join(dir, "overlays", "prod", "my-app.yaml")
+	for file, tag := range map[string]string{staging: "1.8.0", prod: "1.7.99"} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		data := strings.Replace(string(original), "tag: 1.7.99", "tag: "+tag, 1)
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	sources, err := helmReleaseFilesAt([]string{filepath.Dir(staging)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	versions, err := promotedVersions(sources, []string{"ghcr.io/my-org/my-api"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if versions["ghcr.io/my-org/my-api"] != "1.8.0" {
+		t.Fatalf("Expected to promote 1.8.0, got %v", versions)
+	}
+
+	if _, err := promotedVersions(sources, []string{"ghcr.io/my-org/missing"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got: %v", err)
+	}
+	both, _ := helmReleaseFilesAt([]string{filepath.Join(dir, "overlays")})
+	if _, err := promotedVersions(both, []string{"ghcr.io/my-org/my-api"}); err == nil || !strings.Contains(err.Error(), "several tags") {
+		t.Errorf("Expected an ambiguity error, got: %v", err)
+	}
+
+	if _, err := runBumpSets([]updateSet{{Files: []string{prod}, Images: versions}}, false, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(prod); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected prod to be promoted to 1.8.0, got:\n%s", data)
+	}
+}
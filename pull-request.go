@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	commitBranch      string
+	pullRequestBase   string
+	pullRequestOpen   bool
+	pullRequestVendor string
+)
+
+// pullRequest describes the pull request opened for a pushed branch.
+type pullRequest struct {
+	SourceBranch string
+	TargetBranch string
+	Title        string
+	Description  string
+}
+
+// PullRequestProvider opens pull requests on a git hosting service. New
+// services are added by registering a pullRequestProviderInfo in
+// pullRequestProviders.
+type PullRequestProvider interface {
+	// CreatePullRequest opens pr and returns its web URL.
+	CreatePullRequest(ctx context.Context, pr pullRequest) (string, error)
+}
+
+// remoteRepo identifies a repository on a git hosting service, parsed from
+// a git remote URL.
+type remoteRepo struct {
+	// Host is the hosting service, e.g. "github.com" or "dev.azure.com".
+	Host string
+	// Path is the repository path without ".git": "owner/repo" on GitHub and
+	// Bitbucket, "group/subgroup/project" on GitLab, and
+	// "organization/project/repo" on Azure DevOps.
+	Path string
+}
+
+// pullRequestProviderInfo registers a PullRequestProvider.
+type pullRequestProviderInfo struct {
+	// TokenEnv is the environment variable holding the API token.
+	TokenEnv string
+	// Detect reports whether a remote host belongs to the service.
+	Detect func(host string) bool
+	// New returns a provider for repo, authenticated with token.
+	New func(repo remoteRepo, token string) (PullRequestProvider, error)
+}
+
+// pullRequestProviders are the supported hosting services, by --pr-provider
+// name.
+var pullRequestProviders = map[string]pullRequestProviderInfo{
+	"github": {
+		TokenEnv: "GITHUB_TOKEN",
+		Detect:   func(host string) bool { return strings.Contains(host, "github") },
+		New:      newGitHubProvider,
+	},
+	"gitlab": {
+		TokenEnv: "GITLAB_TOKEN",
+		Detect:   func(host string) bool { return strings.Contains(host, "gitlab") },
+		New:      newGitLabProvider,
+	},
+	"azure-devops": {
+		TokenEnv: "AZURE_DEVOPS_TOKEN",
+		Detect: func(host string) bool {
+			return host == "dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com")
+		},
+		New: newAzureDevOpsProvider,
+	},
+	"bitbucket": {
+		TokenEnv: "BITBUCKET_TOKEN",
+		Detect:   func(host string) bool { return host == "bitbucket.org" },
+		New:      newBitbucketProvider,
+	},
+}
+
+// pullRequestProviderNames returns the registered provider names, sorted.
+func pullRequestProviderNames() []string {
+	names := make([]string, 0, len(pullRequestProviders))
+	for name := range pullRequestProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseRemoteURL parses an HTTPS, ssh:// or scp-like ("git@host:path") git
+// remote URL. Azure DevOps URLs, which come in several shapes, are
+// normalised to Host "dev.azure.com" and Path "organization/project/repo".
+func parseRemoteURL(remote string) (remoteRepo, error) {
+	var host, path string
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(remote, "@"); ok && !strings.Contains(at, "/") {
+		host, path, ok = strings.Cut(rest, ":")
+		if !ok {
+			return remoteRepo{}, fmt.Errorf("unsupported git remote URL %q", remote)
+		}
+	} else {
+		return remoteRepo{}, fmt.Errorf("unsupported git remote URL %q", remote)
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	segments := strings.Split(path, "/")
+
+	switch {
+	case host == "ssh.dev.azure.com":
+		// git@ssh.dev.azure.com:v3/organization/project/repo
+		if len(segments) != 4 || segments[0] != "v3" {
+			return remoteRepo{}, fmt.Errorf("unsupported Azure DevOps remote URL %q", remote)
+		}
+		return remoteRepo{Host: "dev.azure.com", Path: strings.Join(segments[1:], "/")}, nil
+	case host == "dev.azure.com":
+		// https://dev.azure.com/organization/project/_git/repo
+		if len(segments) != 4 || segments[2] != "_git" {
+			return remoteRepo{}, fmt.Errorf("unsupported Azure DevOps remote URL %q", remote)
+		}
+		return remoteRepo{Host: host, Path: segments[0] + "/" + segments[1] + "/" + segments[3]}, nil
+	case strings.HasSuffix(host, ".visualstudio.com"):
+		// https://organization.visualstudio.com/project/_git/repo
+		if len(segments) != 3 || segments[1] != "_git" {
+			return remoteRepo{}, fmt.Errorf("unsupported Azure DevOps remote URL %q", remote)
+		}
+		org := strings.TrimSuffix(host, ".visualstudio.com")
+		return remoteRepo{Host: "dev.azure.com", Path: org + "/" + segments[0] + "/" + segments[2]}, nil
+	}
+
+	if len(segments) < 2 {
+		return remoteRepo{}, fmt.Errorf("unsupported git remote URL %q", remote)
+	}
+	return remoteRepo{Host: host, Path: path}, nil
+}
+
+// newPullRequestProvider returns the provider for repo: the one named by
+// name, or the one whose Detect matches the host when name is empty. The API
+// token is read from the provider's TokenEnv.
+func newPullRequestProvider(name string, repo remoteRepo) (PullRequestProvider, error) {
+	if name == "" {
+		for _, candidate := range pullRequestProviderNames() {
+			if pullRequestProviders[candidate].Detect(repo.Host) {
+				name = candidate
+				break
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("cannot tell the pull request provider of %s: use --pr-provider (%s)", repo.Host, strings.Join(pullRequestProviderNames(), ", "))
+		}
+	}
+	info, ok := pullRequestProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pull request provider %q: use one of %s", name, strings.Join(pullRequestProviderNames(), ", "))
+	}
+	token := os.Getenv(info.TokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("set %s to open %s pull requests", info.TokenEnv, name)
+	}
+	return info.New(repo, token)
+}
+
+// pullRequestClient is the HTTP client used by the providers.
+var pullRequestClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON posts body as JSON to endpoint with the given headers and decodes
+// the JSON response into out, unless out is nil. A non-2xx status is an error that includes the
+// start of the response body.
+func postJSON(ctx context.Context, endpoint string, headers map[string]string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := pullRequestClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 300 {
+			msg = msg[:300] + "..."
+		}
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// gitHubProvider opens pull requests with the GitHub REST API.
+type gitHubProvider struct {
+	apiURL string
+	repo   string
+	token  string
+}
+
+func newGitHubProvider(repo remoteRepo, token string) (PullRequestProvider, error) {
+	apiURL := "https://api.github.com"
+	if repo.Host != "github.com" {
+		// GitHub Enterprise Server.
+		apiURL = "https://" + repo.Host + "/api/v3"
+	}
+	return &gitHubProvider{apiURL: apiURL, repo: repo.Path, token: token}, nil
+}
+
+func (p *gitHubProvider) CreatePullRequest(ctx context.Context, pr pullRequest) (string, error) {
+	var resp struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err := postJSON(ctx, p.apiURL+"/repos/"+p.repo+"/pulls",
+		map[string]string{"Authorization": "Bearer " + p.token, "Accept": "application/vnd.github+json"},
+		map[string]string{"title": pr.Title, "body": pr.Description, "head": pr.SourceBranch, "base": pr.TargetBranch},
+		&resp)
+	return resp.HTMLURL, err
+}
+
+// gitLabProvider opens merge requests with the GitLab REST API.
+type gitLabProvider struct {
+	apiURL  string
+	project string
+	token   string
+}
+
+func newGitLabProvider(repo remoteRepo, token string) (PullRequestProvider, error) {
+	return &gitLabProvider{apiURL: "https://" + repo.Host + "/api/v4", project: repo.Path, token: token}, nil
+}
+
+func (p *gitLabProvider) CreatePullRequest(ctx context.Context, pr pullRequest) (string, error) {
+	var resp struct {
+		WebURL string `json:"web_url"`
+	}
+	err := postJSON(ctx, p.apiURL+"/projects/"+url.PathEscape(p.project)+"/merge_requests",
+		map[string]string{"PRIVATE-TOKEN": p.token},
+		map[string]string{"title": pr.Title, "description": pr.Description, "source_branch": pr.SourceBranch, "target_branch": pr.TargetBranch},
+		&resp)
+	return resp.WebURL, err
+}
+
+// azureDevOpsProvider opens pull requests with the Azure DevOps Services REST
+// API, authenticated with a personal access token.
+type azureDevOpsProvider struct {
+	apiURL  string
+	org     string
+	project string
+	repo    string
+	token   string
+}
+
+func newAzureDevOpsProvider(repo remoteRepo, token string) (PullRequestProvider, error) {
+	parts := strings.Split(repo.Path, "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected an Azure DevOps repository as organization/project/repo, got %q", repo.Path)
+	}
+	return &azureDevOpsProvider{apiURL: "https://dev.azure.com", org: parts[0], project: parts[1], repo: parts[2], token: token}, nil
+}
+
+func (p *azureDevOpsProvider) CreatePullRequest(ctx context.Context, pr pullRequest) (string, error) {
+	var resp struct {
+		PullRequestID int `json:"pullRequestId"`
+		Repository    struct {
+			WebURL string `json:"webUrl"`
+		} `json:"repository"`
+	}
+	endpoint := fmt.Sprintf("%s/%s/%s/_apis/git/repositories/%s/pullrequests?api-version=7.1",
+		p.apiURL, url.PathEscape(p.org), url.PathEscape(p.project), url.PathEscape(p.repo))
+	err := postJSON(ctx, endpoint,
+		map[string]string{"Authorization": "Basic " + basicAuth("", p.token)},
+		map[string]string{
+			"title":         pr.Title,
+			"description":   pr.Description,
+			"sourceRefName": "refs/heads/" + pr.SourceBranch,
+			"targetRefName": "refs/heads/" + pr.TargetBranch,
+		},
+		&resp)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/pullrequest/%d", resp.Repository.WebURL, resp.PullRequestID), nil
+}
+
+// bitbucketProvider opens pull requests with the Bitbucket Cloud REST API,
+// authenticated with a repository, project or workspace access token.
+type bitbucketProvider struct {
+	apiURL string
+	repo   string
+	token  string
+}
+
+func newBitbucketProvider(repo remoteRepo, token string) (PullRequestProvider, error) {
+	return &bitbucketProvider{apiURL: "https://api.bitbucket.org/2.0", repo: repo.Path, token: token}, nil
+}
+
+func (p *bitbucketProvider) CreatePullRequest(ctx context.Context, pr pullRequest) (string, error) {
+	type branch struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	}
+	var source, destination branch
+	source.Branch.Name = pr.SourceBranch
+	destination.Branch.Name = pr.TargetBranch
+
+	var resp struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	err := postJSON(ctx, p.apiURL+"/repositories/"+p.repo+"/pullrequests",
+		map[string]string{"Authorization": "Bearer " + p.token},
+		map[string]interface{}{"title": pr.Title, "description": pr.Description, "source": source, "destination": destination},
+		&resp)
+	return resp.Links.HTML.Href, err
+}
+
+// remotePullRequestProvider returns the provider for the origin remote of
+// the repository in dir; see newPullRequestProvider.
+func remotePullRequestProvider(dir, name string) (PullRequestProvider, error) {
+	remote, err := runGit(dir, "remote", "get-url", "origin")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the origin remote: %w", err)
+	}
+	repo, err := parseRemoteURL(remote)
+	if err != nil {
+		return nil, err
+	}
+	return newPullRequestProvider(name, repo)
+}
+
+// currentBranch returns the branch checked out in dir.
+func currentBranch(dir string) (string, error) {
+	branch, err := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if branch == "HEAD" {
+		return "", fmt.Errorf("HEAD is detached: use --base to name the pull request's target branch")
+	}
+	return branch, nil
+}
+
+// basicAuth encodes user and password for an HTTP Basic Authorization header.
+func basicAuth(user, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+}
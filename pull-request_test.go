@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseRemoteURL verifies that the usual remote URL shapes of each
+// hosting service are parsed, and that Azure DevOps URLs are normalised.
+func TestParseRemoteURL(t *testing.T) {
+	tests := map[string]remoteRepo{
+		"https://github.com/my-org/gitops.git":                       {Host: "github.com", Path: "my-org/gitops"},
+		"git@github.com:my-org/gitops.git":                           {Host: "github.com", Path: "my-org/gitops"},
+		"ssh://git@gitlab.example.com/platform/apps/gitops.git":      {Host: "gitlab.example.com", Path: "platform/apps/gitops"},
+		"https://my-org@dev.azure.com/my-org/Platform/_git/gitops":   {Host: "dev.azure.com", Path: "my-org/Platform/gitops"},
+		"git@ssh.dev.azure.com:v3/my-org/Platform/gitops":            {Host: "dev.azure.com", Path: "my-org/Platform/gitops"},
+		"https://my-org.visualstudio.com/Platform/_git/gitops":       {Host: "dev.azure.com", Path: "my-org/Platform/gitops"},
+		"git@bitbucket.org:my-workspace/gitops.git":                  {Host: "bitbucket.org", Path: "my-workspace/gitops"},
+		"https://x-token-auth@bitbucket.org/my-workspace/gitops.git": {Host: "bitbucket.org", Path: "my-workspace/gitops"},
+	}
+	for remote, want := range tests {
+		got, err := parseRemoteURL(remote)
+		if err != nil || got != want {
+			t.Errorf("parseRemoteURL(%q) = %+v, %v; want %+v", remote, got, err, want)
+		}
+	}
+	for _, remote := range []string{"/srv/git/gitops.git", "https://dev.azure.com/my-org/gitops"} {
+		if _, err := parseRemoteURL(remote); err == nil {
+			t.Errorf("Expected %q to be rejected", remote)
+		}
+	}
+}
+
+// TestNewPullRequestProvider verifies provider detection and that a missing
+// token is reported.
+func TestNewPullRequestProvider(t *testing.T) {
+	t.Setenv("AZURE_DEVOPS_TOKEN", "pat")
+	t.Setenv("BITBUCKET_TOKEN", "")
+
+	p, err := newPullRequestProvider("", remoteRepo{Host: "dev.azure.com", Path: "my-org/Platform/gitops"})
+	if _, ok := p.(*azureDevOpsProvider); !ok || err != nil {
+		t.Errorf("Expected the Azure DevOps provider, got %T, err %v", p, err)
+	}
+	if _, err := newPullRequestProvider("", remoteRepo{Host: "bitbucket.org", Path: "ws/gitops"}); err == nil {
+		t.Error("Expected an error without BITBUCKET_TOKEN")
+	}
+	if _, err := newPullRequestProvider("", remoteRepo{Host: "git.example.com", Path: "ws/gitops"}); err == nil {
+		t.Error("Expected an error for an unknown host without --pr-provider")
+	}
+}
+
+// TestPullRequestProviders verifies the API request each provider sends and
+// the URL it returns.
+func TestPullRequestProviders(t *testing.T) {
+	pr := pullRequest{SourceBranch: "bump/api-1.4.0", TargetBranch: "main", Title: "Bump api to 1.4.0", Description: "- image.tag 1.3.0 → 1.4.0"}
+
+	tests := []struct {
+		name     string
+		provider func(apiURL string) PullRequestProvider
+		path     string
+		auth     string
+		field    string
+		want     string
+		response string
+		url      string
+	}{
+		{
+			name: "github",
+			provider: func(apiURL string) PullRequestProvider {
+				return &gitHubProvider{apiURL: apiURL, repo: "my-org/gitops", token: "t"}
+			},
+			path:     "/repos/my-org/gitops/pulls",
+			auth:     "Bearer t",
+			field:    "head",
+			want:     "bump/api-1.4.0",
+			response: `{"html_url": "https://github.com/my-org/gitops/pull/7"}`,
+			url:      "https://github.com/my-org/gitops/pull/7",
+		},
+		{
+			name: "gitlab",
+			provider: func(apiURL string) PullRequestProvider {
+				return &gitLabProvider{apiURL: apiURL, project: "platform/gitops", token: "t"}
+			},
+			path:     "/projects/platform%2Fgitops/merge_requests",
+			field:    "source_branch",
+			want:     "bump/api-1.4.0",
+			response: `{"web_url": "https://gitlab.com/platform/gitops/-/merge_requests/7"}`,
+			url:      "https://gitlab.com/platform/gitops/-/merge_requests/7",
+		},
+		{
+			name: "azure-devops",
+			provider: func(apiURL string) PullRequestProvider {
+				return &azureDevOpsProvider{apiURL: apiURL, org: "my-org", project: "Platform", repo: "gitops", token: "pat"}
+			},
+			path:     "/my-org/Platform/_apis/git/repositories/gitops/pullrequests",
+			auth:     "Basic OnBhdA==",
+			field:    "sourceRefName",
+			want:     "refs/heads/bump/api-1.4.0",
+			response: `{"pullRequestId": 7, "repository": {"webUrl": "https://dev.azure.com/my-org/Platform/_git/gitops"}}`,
+			url:      "https://dev.azure.com/my-org/Platform/_git/gitops/pullrequest/7",
+		},
+		{
+			name: "bitbucket",
+			provider: func(apiURL string) PullRequestProvider {
+				return &bitbucketProvider{apiURL: apiURL, repo: "ws/gitops", token: "t"}
+			},
+			path:     "/repositories/ws/gitops/pullrequests",
+			auth:     "Bearer t",
+			field:    "title",
+			want:     "Bump api to 1.4.0",
+			response: `{"links": {"html": {"href": "https://bitbucket.org/ws/gitops/pull-requests/7"}}}`,
+			url:      "https://bitbucket.org/ws/gitops/pull-requests/7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.EscapedPath() != tt.path {
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+				}
+				if tt.auth != "" && r.Header.Get("Authorization") != tt.auth {
+					t.Errorf("Unexpected Authorization header %q", r.Header.Get("Authorization"))
+				}
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if body[tt.field] != tt.want {
+					t.Errorf("Expected %s %q, got body %v", tt.field, tt.want, body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			got, err := tt.provider(server.URL).CreatePullRequest(context.Background(), pr)
+			if err != nil || got != tt.url {
+				t.Errorf("CreatePullRequest() = %q, %v; want %q", got, err, tt.url)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Validation Failed"}`, http.StatusUnprocessableEntity)
+	}))
+	defer server.Close()
+	if _, err := (&gitHubProvider{apiURL: server.URL, repo: "my-org/gitops"}).CreatePullRequest(context.Background(), pr); err == nil {
+		t.Error("Expected an error for a rejected request")
+	}
+}
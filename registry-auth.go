@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Registry authentication settings, set by the global flags.
+var (
+	registryConfigPath string
+	registryUser       string
+	registryPassword   string
+)
+
+// registryPasswordEnv provides --registry-password, so CI does not have to
+// put the password on the command line.
+const registryPasswordEnv = "FLUX_HELPERS_REGISTRY_PASSWORD"
+
+// registryAuths holds the --registry-config rules of the run, loaded by
+// loadRegistryAuth.
+var registryAuths *registryAuthConfig
+
+// Authentication mechanisms of a registryAuth.
+const (
+	// registryAuthDocker uses the docker config.json, as for registries
+	// without a rule.
+	registryAuthDocker = "docker"
+	// registryAuthBasic uses a username and a password from the environment,
+	// or --registry-user and --registry-password.
+	registryAuthBasic = "basic"
+	// registryAuthToken sends a bearer token from the environment with every
+	// request.
+	registryAuthToken = "token"
+	// registryAuthHelper runs a docker credential helper.
+	registryAuthHelper = "helper"
+	// registryAuthECR, registryAuthGCR and registryAuthACR get a short-lived
+	// password from the aws, gcloud and az CLIs.
+	registryAuthECR = "ecr"
+	registryAuthGCR = "gcr"
+	registryAuthACR = "acr"
+	// registryAuthAnonymous never sends credentials.
+	registryAuthAnonymous = "anonymous"
+)
+
+// registryAuthConfig is a --registry-config file, selecting how each
+// registry is authenticated to, e.g.:
+//
+//	registries:
+//	  - host: 123456789012.dkr.ecr.eu-west-1.amazonaws.com
+//	    auth: ecr
+//	  - host: europe-docker.pkg.dev
+//	    auth: gcr
+//	  - host: "*.azurecr.io"
+//	    auth: acr
+//	  - host: ghcr.io
+//	    auth: token
+//	    tokenEnv: GHCR_TOKEN
+//	  - host: registry.example.com
+//	    auth: basic
+//	    username: ci
+//	    passwordEnv: REGISTRY_PASSWORD
+//
+// The first rule whose host (a glob) matches a registry applies.
+type registryAuthConfig struct {
+	Registries []registryAuth `json:"registries"`
+}
+
+// registryAuth is the rule of a registryAuthConfig for the registries
+// matching Host.
+type registryAuth struct {
+	Host string `json:"host"`
+	Auth string `json:"auth"`
+	// Username and PasswordEnv are the credentials of basic auth; without
+	// them --registry-user and --registry-password are used.
+	Username    string `json:"username,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	// TokenEnv names the variable holding the token of token auth.
+	TokenEnv string `json:"tokenEnv,omitempty"`
+	// Helper is the docker-credential-<helper> binary of helper auth.
+	Helper string `json:"helper,omitempty"`
+}
+
+// registryCredential is what flux-helpers authenticates to a registry with.
+// The zero value is anonymous access.
+type registryCredential struct {
+	Username string
+	Password string
+	// IdentityToken is an OAuth2 refresh token, exchanged for an access
+	// token at the registry's token service (as docker logins to ACR store).
+	IdentityToken string
+	// Token is a bearer token sent with every request.
+	Token string
+}
+
+// loadRegistryAuthConfig reads and validates a registry config file. It
+// returns nil if file is empty.
+func loadRegistryAuthConfig(file string) (*registryAuthConfig, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry config: %w", err)
+	}
+	var cfg registryAuthConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid registry config %s: %w", file, err)
+	}
+	for i, rule := range cfg.Registries {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid registry config %s: registry %d: %w", file, i+1, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// validate checks that the rule names a host glob, a known mechanism and
+// the settings the mechanism needs.
+func (r registryAuth) validate() error {
+	if r.Host == "" {
+		return fmt.Errorf("no host")
+	}
+	if _, err := path.Match(r.Host, ""); err != nil {
+		return fmt.Errorf("invalid host %q: %w", r.Host, err)
+	}
+	needs := map[string]string{}
+	switch r.Auth {
+	case registryAuthDocker, registryAuthECR, registryAuthGCR, registryAuthACR, registryAuthAnonymous:
+	case registryAuthBasic:
+		if (r.Username == "") != (r.PasswordEnv == "") {
+			return fmt.Errorf("basic auth needs both username and passwordEnv, or neither to use --registry-user")
+		}
+	case registryAuthToken:
+		needs["tokenEnv"] = r.TokenEnv
+	case registryAuthHelper:
+		needs["helper"] = r.Helper
+	default:
+		return fmt.Errorf("unknown auth %q (expected docker, basic, token, helper, ecr, gcr, acr or anonymous)", r.Auth)
+	}
+	for field, value := range needs {
+		if value == "" {
+			return fmt.Errorf("%s auth needs %s", r.Auth, field)
+		}
+	}
+	return nil
+}
+
+// loadRegistryAuth checks the registry authentication flags and loads
+// --registry-config for the run.
+func loadRegistryAuth() error {
+	if registryPassword != "" && registryUser == "" {
+		return fmt.Errorf("--registry-password requires --registry-user")
+	}
+	var err error
+	registryAuths, err = loadRegistryAuthConfig(registryConfigPath)
+	return err
+}
+
+// rule returns the first rule matching host, or nil.
+func (cfg *registryAuthConfig) rule(host string) *registryAuth {
+	if cfg == nil {
+		return nil
+	}
+	for i, rule := range cfg.Registries {
+		if ok, _ := path.Match(rule.Host, host); ok {
+			return &cfg.Registries[i]
+		}
+	}
+	return nil
+}
+
+// resolveRegistryCredential returns the credential for host: that of the
+// --registry-config rule matching it, otherwise --registry-user and
+// --registry-password when given, otherwise that of the docker config.
+func resolveRegistryCredential(ctx context.Context, host string) (registryCredential, error) {
+	rule := registryAuths.rule(host)
+	if rule == nil {
+		if registryUser != "" {
+			return flagRegistryCredential(), nil
+		}
+		return dockerConfigCredential(ctx, host)
+	}
+
+	switch rule.Auth {
+	case registryAuthBasic:
+		if rule.Username == "" {
+			if registryUser == "" {
+				return registryCredential{}, fmt.Errorf("basic auth for %s needs --registry-user", host)
+			}
+			return flagRegistryCredential(), nil
+		}
+		password := os.Getenv(rule.PasswordEnv)
+		if password == "" {
+			return registryCredential{}, fmt.Errorf("basic auth for %s: $%s is not set", host, rule.PasswordEnv)
+		}
+		return registryCredential{Username: rule.Username, Password: password}, nil
+	case registryAuthToken:
+		token := os.Getenv(rule.TokenEnv)
+		if token == "" {
+			return registryCredential{}, fmt.Errorf("token auth for %s: $%s is not set", host, rule.TokenEnv)
+		}
+		return registryCredential{Token: token}, nil
+	case registryAuthHelper:
+		return credentialHelperCredential(ctx, rule.Helper, host)
+	case registryAuthECR:
+		region, err := ecrRegion(host)
+		if err != nil {
+			return registryCredential{}, err
+		}
+		password, err := runCredentialCommand(ctx, nil, "aws", "ecr", "get-login-password", "--region", region)
+		return registryCredential{Username: "AWS", Password: password}, err
+	case registryAuthGCR:
+		password, err := runCredentialCommand(ctx, nil, "gcloud", "auth", "print-access-token")
+		return registryCredential{Username: "oauth2accesstoken", Password: password}, err
+	case registryAuthACR:
+		password, err := runCredentialCommand(ctx, nil, "az", "acr", "login", "--name", host, "--expose-token", "--output", "tsv", "--query", "accessToken")
+		return registryCredential{Username: "00000000-0000-0000-0000-000000000000", Password: password}, err
+	case registryAuthAnonymous:
+		return registryCredential{}, nil
+	default:
+		return dockerConfigCredential(ctx, host)
+	}
+}
+
+// flagRegistryCredential returns the credential of --registry-user and
+// --registry-password, or $FLUX_HELPERS_REGISTRY_PASSWORD.
+func flagRegistryCredential() registryCredential {
+	password := registryPassword
+	if password == "" {
+		password = os.Getenv(registryPasswordEnv)
+	}
+	return registryCredential{Username: registryUser, Password: password}
+}
+
+// ecrRegion returns the AWS region of an ECR registry host such as
+// 123456789012.dkr.ecr.eu-west-1.amazonaws.com.
+func ecrRegion(host string) (string, error) {
+	parts := strings.Split(host, ".")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] == "dkr" && parts[i+1] == "ecr" {
+			return parts[i+2], nil
+		}
+	}
+	return "", fmt.Errorf("ecr auth: %s is not an ECR registry host", host)
+}
+
+// dockerConfig is the part of a docker config.json that holds registry
+// credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// dockerConfigPath returns the config.json of $DOCKER_CONFIG, or of
+// ~/.docker.
+func dockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// dockerConfigCredential returns the credential `docker login` stored for
+// host: from the credential helper configured for it, from the inline
+// auths, or from the credential store, in this order as in docker. Without
+// a config file or an entry for host, access is anonymous.
+func dockerConfigCredential(ctx context.Context, host string) (registryCredential, error) {
+	file := dockerConfigPath()
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) || file == "" {
+		return registryCredential{}, nil
+	}
+	if err != nil {
+		return registryCredential{}, fmt.Errorf("failed to read docker config: %w", err)
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return registryCredential{}, fmt.Errorf("invalid docker config %s: %w", file, err)
+	}
+
+	if helper := cfg.CredHelpers[dockerConfigHost(host)]; helper != "" {
+		return storedCredential(ctx, helper, host)
+	}
+	for key, entry := range cfg.Auths {
+		if normalizeDockerConfigKey(key) != host {
+			continue
+		}
+		cred := registryCredential{Username: entry.Username, Password: entry.Password, IdentityToken: entry.IdentityToken}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return registryCredential{}, fmt.Errorf("invalid auth for %s in %s: %w", key, file, err)
+			}
+			cred.Username, cred.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		if cred.Username != "" || cred.IdentityToken != "" {
+			return cred, nil
+		}
+	}
+	if cfg.CredsStore != "" {
+		return storedCredential(ctx, cfg.CredsStore, host)
+	}
+	return registryCredential{}, nil
+}
+
+// storedCredential returns the credential a docker credential helper holds
+// for host, or anonymous access if it holds none.
+func storedCredential(ctx context.Context, helper, host string) (registryCredential, error) {
+	cred, err := credentialHelperCredential(ctx, helper, dockerConfigHost(host))
+	if errors.Is(err, errCredentialsNotFound) {
+		return registryCredential{}, nil
+	}
+	return cred, err
+}
+
+// dockerConfigHost returns the name docker stores the credentials of host
+// under, which for Docker Hub is its legacy index URL.
+func dockerConfigHost(host string) string {
+	if host == dockerHubRegistry {
+		return "https://index.docker.io/v1/"
+	}
+	return host
+}
+
+// normalizeDockerConfigKey strips the scheme and path old docker versions
+// wrote into auths keys, except from the Docker Hub index URL.
+func normalizeDockerConfigKey(key string) string {
+	if key == "https://index.docker.io/v1/" || key == "index.docker.io" || key == "docker.io" {
+		return dockerHubRegistry
+	}
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	host, _, _ := strings.Cut(key, "/")
+	return host
+}
+
+// errCredentialsNotFound is returned by credentialHelperCredential when the
+// helper holds no credentials for the registry.
+var errCredentialsNotFound = errors.New("credentials not found")
+
+// credentialHelperCredential runs `docker-credential-<helper> get` for
+// serverURL, as docker does.
+func credentialHelperCredential(ctx context.Context, helper, serverURL string) (registryCredential, error) {
+	out, err := runCredentialCommand(ctx, strings.NewReader(serverURL), "docker-credential-"+helper, "get")
+	if err != nil {
+		if strings.Contains(err.Error(), "credentials not found") {
+			return registryCredential{}, fmt.Errorf("%w for %s in docker-credential-%s", errCredentialsNotFound, serverURL, helper)
+		}
+		return registryCredential{}, err
+	}
+	var result struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		return registryCredential{}, fmt.Errorf("invalid output of docker-credential-%s: %w", helper, err)
+	}
+	// Helpers return identity tokens with this placeholder username.
+	if result.Username == "<token>" {
+		return registryCredential{IdentityToken: result.Secret}, nil
+	}
+	return registryCredential{Username: result.Username, Password: result.Secret}, nil
+}
+
+// runCredentialCommand runs a credential helper or cloud CLI with stdin and
+// returns its trimmed stdout. It is bounded by --registry-timeout.
+func runCredentialCommand(ctx context.Context, stdin *strings.Reader, name string, args ...string) (string, error) {
+	bin, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("registry authentication needs %s on the PATH: %w", name, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, registryTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Credential helpers report errors on stdout.
+		msg := bytes.TrimSpace(append(stderr.Bytes(), stdout.Bytes()...))
+		return "", fmt.Errorf("%s %s failed: %w: %s", name, args[0], err, msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// credential returns the credential for host, resolving it once per client
+// since helpers and cloud CLIs are slow.
+func (c *registryClient) credential(host string) (registryCredential, error) {
+	c.mu.Lock()
+	cred, ok := c.credentials[host]
+	c.mu.Unlock()
+	if ok {
+		return cred, nil
+	}
+	cred, err := resolveRegistryCredential(c.ctx, host)
+	if err != nil {
+		return registryCredential{}, fmt.Errorf("failed to get credentials for %s: %w", host, err)
+	}
+	c.mu.Lock()
+	if c.credentials == nil {
+		c.credentials = map[string]registryCredential{}
+	}
+	c.credentials[host] = cred
+	c.mu.Unlock()
+	return cred, nil
+}
+
+// initialAuthorization returns the Authorization header sent to ref's
+// registry before it asks for authentication: the bearer token of token
+// auth, or nothing. Other credentials are only resolved once the registry
+// asks for them, so public registries never run a helper.
+func (c *registryClient) initialAuthorization(ref imageRegistryRef) (string, error) {
+	if rule := registryAuths.rule(ref.Host); rule == nil || rule.Auth != registryAuthToken {
+		return "", nil
+	}
+	cred, err := c.credential(ref.Host)
+	if err != nil || cred.Token == "" {
+		return "", err
+	}
+	return "Bearer " + cred.Token, nil
+}
+
+// authorize answers the WWW-Authenticate challenge of ref's registry with
+// its credential: a Bearer challenge with a token from the registry's token
+// service, a Basic one with the username and password.
+func (c *registryClient) authorize(challenge string, ref imageRegistryRef) (string, error) {
+	cred, err := c.credential(ref.Host)
+	if err != nil {
+		return "", err
+	}
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		token, err := c.fetchToken(params, ref, cred)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	case strings.EqualFold(scheme, "Basic") && cred.Username != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password)), nil
+	}
+	return "", fmt.Errorf("%s requires authentication (%s); configure credentials with docker login, --registry-user or --registry-config", ref.Host, challenge)
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&registryConfigPath, "registry-config", "", "File selecting the authentication of each registry (docker, basic, token, helper, ecr, gcr, acr)")
+	flags.StringVar(&registryUser, "registry-user", "", "Username for registries without a --registry-config rule (instead of the docker config)")
+	flags.StringVar(&registryPassword, "registry-password", "", "Password for --registry-user (default: $"+registryPasswordEnv+")")
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCredentialHelper is a docker-credential-test binary holding ci:s3cret
+// for every registry but unknown.example.com.
+const fakeCredentialHelper = `#!/bin/sh
+read host
+case "$host" in
+  unknown.example.com) echo "credentials not found in native keychain"; exit 1 ;;
+  *) echo '{"ServerURL":"'$host'","Username":"ci","Secret":"s3cret"}' ;;
+esac
+`
+
+// newPrivateTestRegistry serves my-org/private:1.0.0 to clients presenting
+// ci:s3cret to its token endpoint, or the static token "ghp_static". With
+// basic set, it asks for basic auth instead of a token.
+func newPrivateTestRegistry(t *testing.T, basic bool) string {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "ci" || pass != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"private"}`)
+			return
+		}
+		switch auth := r.Header.Get("Authorization"); {
+		case basic && auth == "Basic "+base64.StdEncoding.EncodeToString([]byte("ci:s3cret")):
+		case !basic && (auth == "Bearer private" || auth == "Bearer ghp_static"):
+		case basic:
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		default:
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/my-org/private/manifests/1.0.0" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// withRegistryAuth sets the registry authentication flags for a test.
+func withRegistryAuth(t *testing.T, user, password string, cfg *registryAuthConfig) {
+	t.Helper()
+	oldUser, oldPassword, oldAuths := registryUser, registryPassword, registryAuths
+	registryUser, registryPassword, registryAuths = user, password, cfg
+	t.Cleanup(func() { registryUser, registryPassword, registryAuths = oldUser, oldPassword, oldAuths })
+}
+
+// TestRegistryAuthMechanisms verifies that each authentication mechanism
+// gets access to a private repository, and that none is anonymous.
+func TestRegistryAuthMechanisms(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker-credential-test"), []byte(fakeCredentialHelper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GHCR_TOKEN", "ghp_static")
+	t.Setenv("REGISTRY_PASSWORD", "s3cret")
+	oldRate := registryRate
+	registryRate = 0
+	t.Cleanup(func() { registryRate = oldRate })
+	host := newPrivateTestRegistry(t, false)
+	basicHost := newPrivateTestRegistry(t, true)
+
+	writeDockerConfig := func(config string) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("DOCKER_CONFIG", dir)
+	}
+	rules := func(rule registryAuth) *registryAuthConfig {
+		rule.Host = "127.0.0.1:*"
+		return &registryAuthConfig{Registries: []registryAuth{rule}}
+	}
+	for _, tc := range []struct {
+		name       string
+		host       string
+		user       string
+		cfg        *registryAuthConfig
+		docker     string
+		wantDenied bool
+	}{
+		{name: "anonymous", host: host, docker: `{}`, wantDenied: true},
+		{name: "docker auths", host: host, docker: fmt.Sprintf(`{"auths":{"http://%s/v2/":{"auth":%q}}}`, host, base64.StdEncoding.EncodeToString([]byte("ci:s3cret")))},
+		{name: "docker credHelpers", host: host, docker: fmt.Sprintf(`{"credHelpers":{%q:"test"}}`, host)},
+		{name: "docker credsStore", host: host, docker: `{"credsStore":"test"}`},
+		{name: "flags", host: host, user: "ci", docker: `{}`},
+		{name: "flags basic", host: basicHost, user: "ci", docker: `{}`},
+		{name: "basic rule", host: host, cfg: rules(registryAuth{Auth: registryAuthBasic, Username: "ci", PasswordEnv: "REGISTRY_PASSWORD"})},
+		{name: "token rule", host: host, cfg: rules(registryAuth{Auth: registryAuthToken, TokenEnv: "GHCR_TOKEN"})},
+		{name: "helper rule", host: host, cfg: rules(registryAuth{Auth: registryAuthHelper, Helper: "test"})},
+		{name: "anonymous rule", host: host, user: "ci", cfg: rules(registryAuth{Auth: registryAuthAnonymous}), wantDenied: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeDockerConfig(tc.docker)
+			withRegistryAuth(t, tc.user, "s3cret", tc.cfg)
+			err := newRegistryClient(context.Background()).tagExists(tc.host+"/my-org/private", "1.0.0")
+			if tc.wantDenied {
+				if err == nil || !strings.Contains(err.Error(), "denied anonymous access") {
+					t.Errorf("Expected access to be denied, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	// Wrong credentials are reported as such.
+	withRegistryAuth(t, "ci", "wrong", nil)
+	if err := newRegistryClient(context.Background()).tagExists(host+"/my-org/private", "1.0.0"); err == nil || !strings.Contains(err.Error(), "rejected the credentials") {
+		t.Errorf("Expected the credentials to be rejected, got %v", err)
+	}
+	// A credential store without an entry means anonymous access.
+	writeDockerConfig(`{"credsStore":"test"}`)
+	if cred, err := dockerConfigCredential(context.Background(), "unknown.example.com"); err != nil || cred != (registryCredential{}) {
+		t.Errorf("Expected anonymous access, got %+v, %v", cred, err)
+	}
+}
+
+// TestLoadRegistryAuthConfig verifies validation of registry config files.
+func TestLoadRegistryAuthConfig(t *testing.T) {
+	dir := t.TempDir()
+	for name, tc := range map[string]struct {
+		config string
+		want   string
+	}{
+		"valid":       {config: "registries:\n  - host: '*.azurecr.io'\n    auth: acr\n  - host: ghcr.io\n    auth: token\n    tokenEnv: GHCR_TOKEN\n"},
+		"unknown":     {config: "registries:\n  - host: ghcr.io\n    auth: oauth\n", want: `unknown auth "oauth"`},
+		"no host":     {config: "registries:\n  - auth: gcr\n", want: "no host"},
+		"no tokenEnv": {config: "registries:\n  - host: ghcr.io\n    auth: token\n", want: "token auth needs tokenEnv"},
+		"half basic":  {config: "registries:\n  - host: ghcr.io\n    auth: basic\n    username: ci\n", want: "needs both username and passwordEnv"},
+		"password":    {config: "registries:\n  - host: ghcr.io\n    auth: basic\n    password: hunter2\n", want: "unknown field"},
+	} {
+		file := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".yaml")
+		if err := os.WriteFile(file, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := loadRegistryAuthConfig(file)
+		if tc.want == "" {
+			if err != nil || cfg.rule("my.azurecr.io").Auth != registryAuthACR || cfg.rule("quay.io") != nil {
+				t.Errorf("%s: unexpected result %+v, %v", name, cfg, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tc.want, err)
+		}
+	}
+
+	if region, err := ecrRegion("123456789012.dkr.ecr.eu-west-1.amazonaws.com"); err != nil || region != "eu-west-1" {
+		t.Errorf("Unexpected ECR region %q: %v", region, err)
+	}
+	if _, err := ecrRegion("ghcr.io"); err == nil {
+		t.Error("Expected a non-ECR host to be rejected")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Settings of registry tag queries, set by the global flags.
+var (
+	// registryRate is how many requests per second are sent to a single
+	// registry host; 0 means no limit.
+	registryRate = 5.0
+	// registryConcurrency is how many repositories are listed at the same
+	// time.
+	registryConcurrency = 4
+	// tagCacheTTL is how long listed tags are reused from the on-disk cache;
+	// 0 disables the cache.
+	tagCacheTTL = 10 * time.Minute
+)
+
+// rangeArgs are the --set-range arguments of bump.
+var rangeArgs []string
+
+// tagListPageSize is the number of tags asked for per tags/list request.
+const tagListPageSize = 1000
+
+// nextLinkPattern extracts the URL of the next page from a Link header.
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// hostThrottle spaces the requests to each host evenly, so a run listing
+// many repositories stays below the rate limits of registries such as GHCR
+// instead of collecting 429s. A nil hostThrottle does not wait. It is safe
+// for concurrent use.
+type hostThrottle struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// newHostThrottle returns a hostThrottle allowing perSecond requests per
+// second and host, or nil when perSecond is not positive.
+func newHostThrottle(perSecond float64) *hostThrottle {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &hostThrottle{interval: time.Duration(float64(time.Second) / perSecond), next: map[string]time.Time{}}
+}
+
+// wait blocks until the next request to host may be sent, or ctx is done.
+func (t *hostThrottle) wait(ctx context.Context, host string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.next[host] = at.Add(t.interval)
+	t.mu.Unlock()
+
+	if delay := time.Until(at); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	return nil
+}
+
+// tagCache keeps the tag lists of repositories on disk for ttl, one JSON
+// file per repository, so repeated CI runs reuse them. A nil tagCache caches
+// nothing.
+type tagCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// tagCacheEntry is a cached tag list.
+type tagCacheEntry struct {
+	Repository string    `json:"repository"`
+	Fetched    time.Time `json:"fetched"`
+	Tags       []string  `json:"tags"`
+}
+
+// newTagCache returns a tagCache below the user cache directory, or nil if
+// ttl is not positive or there is no cache directory.
+func newTagCache(ttl time.Duration) *tagCache {
+	if ttl <= 0 {
+		return nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	return &tagCache{dir: filepath.Join(dir, "flux-helpers", "tags"), ttl: ttl, now: time.Now}
+}
+
+// path returns the cache file of repository.
+func (c *tagCache) path(repository string) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(repository))))
+}
+
+// get returns the cached tags of repository if they are younger than the
+// TTL.
+func (c *tagCache) get(repository string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(repository))
+	if err != nil {
+		return nil, false
+	}
+	var entry tagCacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.Repository != repository || c.now().Sub(entry.Fetched) > c.ttl {
+		return nil, false
+	}
+	return entry.Tags, true
+}
+
+// put stores the tags of repository. Failures only cost a cache miss later,
+// so they are logged and otherwise ignored.
+func (c *tagCache) put(repository string, tags []string) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(tagCacheEntry{Repository: repository, Fetched: c.now(), Tags: tags})
+	if err == nil {
+		if err = os.MkdirAll(c.dir, 0755); err == nil {
+			err = writeFileAtomic(c.path(repository), data, 0644)
+		}
+	}
+	if err != nil {
+		logf("⚠️ Failed to cache the tags of %s: %v\n", repository, err)
+	}
+}
+
+// listTags returns the tags of repository, from the cache if it holds a
+// fresh list, otherwise from the registry's tags/list API, following its
+// pagination.
+func (c *registryClient) listTags(repository string) ([]string, error) {
+	if tags, ok := c.tagCache.get(repository); ok {
+		return tags, nil
+	}
+	ref := parseImageRepository(repository)
+	auth, err := c.initialAuthorization(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the tags of %s: %w", repository, err)
+	}
+	tags := []string{}
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=%d", ref.baseURL(), ref.Name, tagListPageSize)
+	for next != "" {
+		resp, err := c.registryRequest(ref, next, "application/json", &auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tags of %s: %w", repository, err)
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag list for %s: %w", repository, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if m := nextLinkPattern.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			link, err := resp.Request.URL.Parse(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Link header from %s: %w", ref.Host, err)
+			}
+			next = link.String()
+		}
+	}
+	c.tagCache.put(repository, tags)
+	return tags, nil
+}
+
+// newestMatchingTag returns the highest tag that is a semantic version
+// satisfying constraint. As in Masterminds/semver, pre-releases only match
+// constraints that mention a pre-release.
+func newestMatchingTag(tags []string, constraint *semver.Constraints) (string, bool) {
+	var best *semver.Version
+	bestTag := ""
+	for _, tag := range tags {
+		v, err := semver.NewVersion(tag)
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		if best == nil || v.GreaterThan(best) || (v.Equal(best) && tag < bestTag) {
+			best, bestTag = v, tag
+		}
+	}
+	return bestTag, best != nil
+}
+
+// parseRangeArgs parses and validates --set-range arguments of the form
+// repo=constraint.
+func parseRangeArgs(args []string) (map[string]string, error) {
+	ranges := map[string]string{}
+	for _, arg := range args {
+		parts := splitArg(arg)
+		if parts == nil {
+			return nil, fmt.Errorf("invalid --set-range format: %s (expected repo=constraint)", arg)
+		}
+		if err := validateImageRange(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+		ranges[parts[0]] = parts[1]
+	}
+	return ranges, nil
+}
+
+// validateImageRange checks that repo names a single repository, whose tags
+// can be listed, and that constraint is a semver constraint.
+func validateImageRange(repo, constraint string) error {
+	if strings.ContainsAny(repo, "*?[@") || strings.LastIndex(repo, ":") > strings.LastIndex(repo, "/") {
+		return fmt.Errorf("invalid range image %q (expected a plain repository)", repo)
+	}
+	if _, err := semver.NewConstraint(constraint); err != nil {
+		return fmt.Errorf("invalid range %q for %s: %w", constraint, repo, err)
+	}
+	return nil
+}
+
+// resolveImageRanges replaces the Ranges of every update set with Images
+// entries holding the newest tag of each repository that satisfies its
+// constraint. The repositories are listed concurrently (--registry-
+// concurrency), with per-registry rate limiting and the on-disk tag cache
+// of client; each repository is listed once however many sets name it.
+//
+// Parameters:
+//   - client: The registry client to list tags with.
+//   - sets: The update sets to resolve, modified in place.
+//
+// Returns:
+//   - An error naming every repository whose tags cannot be listed or that
+//     has no tag satisfying its constraint.
+func resolveImageRanges(client *registryClient, sets []updateSet) error {
+	var repos []string
+	for _, set := range sets {
+		for repo := range set.Ranges {
+			repos = appendUnique(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		return nil
+	}
+	sort.Strings(repos)
+
+	tags := make([][]string, len(repos))
+	errs := make([]error, len(repos))
+	bar := startProgress("list tags", "repository", len(repos))
+	forEachConcurrently(len(repos), registryConcurrency, func(i int) {
+		defer bar.Increment()
+		tags[i], errs[i] = client.listTags(repos[i])
+	})
+	bar.Done()
+	listed := map[string][]string{}
+	var failures []string
+	for i, repo := range repos {
+		if errs[i] != nil {
+			failures = append(failures, errs[i].Error())
+			continue
+		}
+		listed[repo] = tags[i]
+	}
+
+	for i := range sets {
+		for _, repo := range sortedKeys(sets[i].Ranges) {
+			repoTags, ok := listed[repo]
+			if !ok {
+				continue
+			}
+			constraint, err := semver.NewConstraint(sets[i].Ranges[repo])
+			if err != nil {
+				return fmt.Errorf("invalid range %q for %s: %w", sets[i].Ranges[repo], repo, err)
+			}
+			tag, ok := newestMatchingTag(repoTags, constraint)
+			if !ok {
+				failures = append(failures, fmt.Sprintf("no tag of %s satisfies %s", repo, sets[i].Ranges[repo]))
+				continue
+			}
+			logf("🎯 Resolved %s %s to %s\n", repo, sets[i].Ranges[repo], tag)
+			if sets[i].Images == nil {
+				sets[i].Images = map[string]string{}
+			}
+			sets[i].Images[repo] = tag
+		}
+		sets[i].Ranges = nil
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to resolve image ranges:\n  %s", strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.Float64Var(&registryRate, "registry-rate", registryRate, "Requests per second sent to a single registry (0: no limit)")
+	flags.IntVar(&registryConcurrency, "registry-concurrency", registryConcurrency, "How many repositories are queried for tags at the same time")
+	flags.DurationVar(&tagCacheTTL, "tag-cache-ttl", tagCacheTTL, "How long listed tags are reused from the on-disk cache (0: no cache)")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTagRegistry serves the tags of my-org/app two per page, requiring a
+// token like ghcr.io does, and counts the tags/list requests.
+func newTestTagRegistry(t *testing.T, tags []string) (string, *atomic.Int32) {
+	t.Helper()
+	var lists atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			fmt.Fprint(w, `{"token":"secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/my-org/app/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+		lists.Add(1)
+		start := 0
+		fmt.Sscan(r.URL.Query().Get("last"), &start)
+		end := min(start+2, len(tags))
+		if end < len(tags) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/my-org/app/tags/list?n=2&last=%d>; rel="next"`, end))
+		}
+		fmt.Fprintf(w, `{"name":"my-org/app","tags":["%s"]}`, strings.Join(tags[start:end], `","`))
+	}))
+	t.Cleanup(srv.Close)
+	return strings.Replace(strings.TrimPrefix(srv.URL, "http://"), "127.0.0.1", "localhost", 1) + "/my-org/app", &lists
+}
+
+// TestResolveImageRanges verifies that ranges resolve to the newest
+// matching tag across all pages of the tag list, and that the tag cache is
+// used until its TTL expires.
+func TestResolveImageRanges(t *testing.T) {
+	repo, lists := newTestTagRegistry(t, []string{"1.2.0", "latest", "1.3.0", "1.4.0-rc.1", "v1.3.7", "2.0.0"})
+	now := time.Now()
+	client := newRegistryClient(context.Background())
+	client.tagCache = &tagCache{dir: t.TempDir(), ttl: time.Minute, now: func() time.Time { return now }}
+
+	sets := []updateSet{
+		{Files: []string{"a.yaml"}, Ranges: map[string]string{repo: "~1.3"}},
+		{Files: []string{"b.yaml"}, Images: map[string]string{"nginx": "1.25"}, Ranges: map[string]string{repo: ">=1.0.0"}},
+	}
+	if err := resolveImageRanges(client, sets); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sets[0].Images[repo] != "v1.3.7" || sets[1].Images[repo] != "2.0.0" || sets[1].Images["nginx"] != "1.25" {
+		t.Errorf("Unexpected images %v, %v", sets[0].Images, sets[1].Images)
+	}
+	if sets[0].Ranges != nil || sets[1].Ranges != nil {
+		t.Error("Expected the ranges to be cleared")
+	}
+	if n := lists.Load(); n != 3 {
+		t.Errorf("Expected the 3 pages to be listed once, got %d requests", n)
+	}
+
+	// A fresh cache answers without a request; an expired one does not.
+	sets = []updateSet{{Files: []string{"a.yaml"}, Ranges: map[string]string{repo: "1.2.x"}}}
+	if err := resolveImageRanges(client, sets); err != nil || sets[0].Images[repo] != "1.2.0" || lists.Load() != 3 {
+		t.Errorf("Expected a cached 1.2.0, got %v after %d requests: %v", sets[0].Images, lists.Load(), err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := client.listTags(repo); err != nil || lists.Load() != 6 {
+		t.Errorf("Expected the expired cache to be refreshed, got %d requests: %v", lists.Load(), err)
+	}
+
+	sets = []updateSet{{Files: []string{"a.yaml"}, Ranges: map[string]string{repo: "^3"}}}
+	if err := resolveImageRanges(client, sets); err == nil || !strings.Contains(err.Error(), "no tag of "+repo+" satisfies ^3") {
+		t.Errorf("Expected an unsatisfiable range to fail, got %v", err)
+	}
+}
+
+// TestValidateImageRange verifies that ranges need a plain repository and
+// a semver constraint.
+func TestValidateImageRange(t *testing.T) {
+	if err := validateImageRange("localhost:5000/my-org/app", ">=1.2 <2"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, tc := range [][2]string{
+		{"ghcr.io/my-org/*", "^1"},
+		{"ghcr.io/my-org/app:1.0.0", "^1"},
+		{"ghcr.io/my-org/app", "one"},
+	} {
+		if err := validateImageRange(tc[0], tc[1]); err == nil {
+			t.Errorf("Expected %s=%s to be rejected", tc[0], tc[1])
+		}
+	}
+}
+
+// TestHostThrottle verifies that requests to one host are spaced by the
+// rate limit while other hosts are not held up.
+func TestHostThrottle(t *testing.T) {
+	if newHostThrottle(0) != nil {
+		t.Error("Expected a rate of 0 to disable the throttle")
+	}
+	throttle := newHostThrottle(50)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := throttle.wait(context.Background(), "ghcr.io"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected 3 requests at 50/s to take at least 40ms, took %s", elapsed)
+	}
+	start = time.Now()
+	if err := throttle.wait(context.Background(), "quay.io"); err != nil || time.Since(start) > 10*time.Millisecond {
+		t.Errorf("Expected another host not to wait: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	throttle.wait(ctx, "ghcr.io")
+	if err := throttle.wait(ctx, "ghcr.io"); err == nil {
+		t.Error("Expected a cancelled wait to fail")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// checkExists is set by --check-exists.
+var checkExists bool
+
+// dockerHubRegistry is the registry host of images without one, e.g. "nginx".
+const dockerHubRegistry = "registry-1.docker.io"
+
+// manifestMediaTypes are accepted when asking a registry for a manifest, so
+// that image indexes and single-platform manifests are both found.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// registryClient asks container registries whether image tags exist, using
+// the Docker Registry HTTP API V2 with bearer tokens, which are anonymous
+// unless credentials are configured (see resolveRegistryCredential). Results are
+// cached, so every tag is looked up once per run; it is safe for concurrent
+// use. Requests are bound to the context of the run and retried on transient
+// failures (see doHTTP).
+type registryClient struct {
+	ctx  context.Context
+	http *http.Client
+	// throttle spaces the requests to each registry (see --registry-rate).
+	throttle *hostThrottle
+	// tagCache, if set, keeps tag lists across runs (see listTags).
+	tagCache *tagCache
+
+	mu      sync.Mutex
+	results map[string]error
+	// credentials caches the credential of each registry host (see
+	// credential).
+	credentials map[string]registryCredential
+}
+
+// newRegistryClient returns a registryClient for the run with context ctx,
+// with the --registry-timeout request timeout, the --registry-rate limit and
+// the --tag-cache-ttl tag cache.
+func newRegistryClient(ctx context.Context) *registryClient {
+	return &registryClient{
+		ctx:      ctx,
+		http:     &http.Client{Timeout: registryTimeout},
+		throttle: newHostThrottle(registryRate),
+		tagCache: newTagCache(tagCacheTTL),
+		results:  map[string]error{},
+	}
+}
+
+// imageRegistryRef is an image repository split into the registry host and
+// the repository name on it.
+type imageRegistryRef struct {
+	Host string
+	Name string
+}
+
+// parseImageRepository splits repository like Docker does: the first path
+// component is a registry host if it contains "." or ":" or is "localhost";
+// otherwise the image lives on Docker Hub, where single-component names are
+// below "library/".
+func parseImageRepository(repository string) imageRegistryRef {
+	host, name, found := strings.Cut(repository, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		host, name = dockerHubRegistry, repository
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubRegistry
+	}
+	if host == dockerHubRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	return imageRegistryRef{Host: host, Name: name}
+}
+
+// baseURL returns the registry API root; loopback registries are assumed to
+// speak plain HTTP, as Docker does.
+func (r imageRegistryRef) baseURL() string {
+	hostname := r.Host
+	if i := strings.LastIndex(hostname, ":"); i >= 0 {
+		hostname = hostname[:i]
+	}
+	if hostname == "localhost" || hostname == "127.0.0.1" || hostname == "[::1]" {
+		return "http://" + r.Host
+	}
+	return "https://" + r.Host
+}
+
+// tagExists reports an error unless repository:tag exists in its registry.
+func (c *registryClient) tagExists(repository, tag string) error {
+	key := repository + ":" + tag
+	c.mu.Lock()
+	err, done := c.results[key]
+	c.mu.Unlock()
+	if done {
+		return err
+	}
+
+	err = c.lookupManifest(parseImageRepository(repository), tag)
+	if err != nil {
+		err = fmt.Errorf("image %s: %w", key, err)
+	}
+	c.mu.Lock()
+	c.results[key] = err
+	c.mu.Unlock()
+	return err
+}
+
+// lookupManifest asks the registry for the manifest of tag with a HEAD
+// request (falling back to GET for registries that do not support it),
+// authenticating when the registry asks for it.
+func (c *registryClient) lookupManifest(ref imageRegistryRef, tag string) error {
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", ref.baseURL(), ref.Name, url.PathEscape(tag))
+	auth, err := c.initialAuthorization(ref)
+	if err != nil {
+		return err
+	}
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		resp, err := c.manifestRequest(ref, method, manifestURL, auth)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && auth == "" {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if auth, err = c.authorize(challenge, ref); err != nil {
+				return err
+			}
+			if resp, err = c.manifestRequest(ref, method, manifestURL, auth); err != nil {
+				return err
+			}
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusNotFound:
+			return fmt.Errorf("tag not found in %s", ref.Host)
+		case http.StatusMethodNotAllowed:
+			continue
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("%s denied access to %s (%s)", ref.Host, ref.Name, resp.Status)
+		default:
+			return fmt.Errorf("unexpected response from %s: %s", ref.Host, resp.Status)
+		}
+	}
+	return fmt.Errorf("%s does not support manifest lookups", ref.Host)
+}
+
+// manifestRequest sends a manifest request and closes the response body.
+func (c *registryClient) manifestRequest(ref imageRegistryRef, method, manifestURL, auth string) (*http.Response, error) {
+	resp, err := doHTTP(c.ctx, c.http, "registry request", func(ctx context.Context) (*http.Request, error) {
+		if err := c.throttle.wait(ctx, ref.Host); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// fetchToken obtains a pull token from the realm of a Bearer
+// WWW-Authenticate challenge with the given parameters: anonymously, with
+// the username and password of cred, or in exchange for its identity token.
+func (c *registryClient) fetchToken(params string, ref imageRegistryRef, cred registryCredential) (string, error) {
+	attrs := parseAuthParams(params)
+	if attrs["realm"] == "" {
+		return "", fmt.Errorf("%s sent an authentication challenge without a realm", ref.Host)
+	}
+	tokenURL, err := url.Parse(attrs["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %q: %w", attrs["realm"], err)
+	}
+	query := tokenURL.Query()
+	if attrs["service"] != "" {
+		query.Set("service", attrs["service"])
+	}
+	scope := attrs["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Name + ":pull"
+	}
+	query.Set("scope", scope)
+
+	resp, err := doHTTP(c.ctx, c.http, "registry token request", func(ctx context.Context) (*http.Request, error) {
+		if err := c.throttle.wait(ctx, tokenURL.Host); err != nil {
+			return nil, err
+		}
+		if cred.IdentityToken != "" {
+			// The OAuth2 refresh token grant of the distribution token spec.
+			form := url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {cred.IdentityToken},
+				"service":       {query.Get("service")},
+				"scope":         {scope},
+				"client_id":     {"flux-helpers"},
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL.String(), strings.NewReader(form.Encode()))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return req, nil
+		}
+		getURL := *tokenURL
+		getURL.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if cred.Username != "" {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		if cred.Username != "" || cred.IdentityToken != "" {
+			return "", fmt.Errorf("%s rejected the credentials for %s", tokenURL.Host, ref.Host)
+		}
+		return "", fmt.Errorf("%s denied anonymous access to %s; configure credentials with docker login, --registry-user or --registry-config", ref.Host, ref.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token from %s: %s", tokenURL.Host, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid registry token response: %w", err)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	return body.Token, nil
+}
+
+// parseAuthParams parses the comma-separated key="value" parameters of a
+// WWW-Authenticate challenge.
+func parseAuthParams(params string) map[string]string {
+	attrs := map[string]string{}
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(strings.TrimLeft(params, " ,"), "=")
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		attrs[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return attrs
+}
+
+// setCheckExists attaches a shared registryClient to every update set when
+// enabled.
+func setCheckExists(ctx context.Context, sets []updateSet, enabled bool) {
+	if !enabled {
+		return
+	}
+	client := newRegistryClient(ctx)
+	for i := range sets {
+		sets[i].registry = client
+	}
+}
+
+// checkChangesExist returns an error if the new tag of any change does not
+// exist in its registry. A nil client checks nothing.
+func (c *registryClient) checkChangesExist(file string, changes []tagChange) error {
+	if c == nil {
+		return nil
+	}
+	for _, change := range changes {
+		tag := strings.TrimPrefix(change.NewValue, change.Image+":")
+		if err := c.tagExists(change.Image, tag); err != nil {
+			return fmt.Errorf("--check-exists: %s (%s in %s)", err, change.Path, file)
+		}
+	}
+	return nil
+}
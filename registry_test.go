@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRegistry serves the manifests of tags, requiring a bearer token from
+// its /token endpoint like ghcr.io and Docker Hub do. It counts manifest
+// requests.
+func newTestRegistry(t *testing.T, tags map[string]bool) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:my-org/my-api:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token":"secret"}`)
+			return
+		}
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tag := strings.TrimPrefix(r.URL.Path, "/v2/my-org/my-api/manifests/")
+		if !tags[tag] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// TestParseImageRepository verifies the registry host and name of common
+// repository spellings.
+func TestParseImageRepository(t *testing.T) {
+	for repo, want := range map[string]imageRegistryRef{
+		"nginx":                     {Host: dockerHubRegistry, Name: "library/nginx"},
+		"bitnami/redis":             {Host: dockerHubRegistry, Name: "bitnami/redis"},
+		"docker.io/nginx":           {Host: dockerHubRegistry, Name: "library/nginx"},
+		"ghcr.io/my-org/my-api":     {Host: "ghcr.io", Name: "my-org/my-api"},
+		"localhost:5000/my-api":     {Host: "localhost:5000", Name: "my-api"},
+		"registry.local/team/a/app": {Host: "registry.local", Name: "team/a/app"},
+	} {
+		if got := parseImageRepository(repo); got != want {
+			t.Errorf("%s: expected %+v, got %+v", repo, want, got)
+		}
+	}
+}
+
+// TestRegistryTagExists verifies tag lookups through the token flow and that
+// results are cached.
+func TestRegistryTagExists(t *testing.T) {
+	srv, requests := newTestRegistry(t, map[string]bool{"1.8.0": true})
+	repo := strings.TrimPrefix(srv.URL, "http://") + "/my-org/my-api"
+	client := newRegistryClient(context.Background())
+
+	if err := client.tagExists(repo, "1.8.0"); err != nil {
+		t.Errorf("Expected 1.8.0 to exist, got: %v", err)
+	}
+	if err := client.tagExists(repo, "1.9.0"); err == nil || !strings.Contains(err.Error(), "tag not found") {
+		t.Errorf("Expected 1.9.0 to be missing, got: %v", err)
+	}
+	before := requests.Load()
+	if err := client.tagExists(repo, "1.8.0"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if requests.Load() != before {
+		t.Errorf("Expected a cached result, got %d more request(s)", requests.Load()-before)
+	}
+}
+
+// TestBumpCheckExists verifies that a bump to a missing tag fails without
+// modifying the file.
+func TestBumpCheckExists(t *testing.T) {
+	srv, _ := newTestRegistry(t, map[string]bool{"1.8.0": true})
+	repo := strings.TrimPrefix(srv.URL, "http://") + "/my-org/my-api"
+
+	original := "apiVersion: helm.toolkit.fluxcd.io/v2\nkind: HelmRelease\nmetadata:\n  name: my-app\nspec:\n  values:\n    image:\n      repository: " + repo + "\n      tag: 1.7.0\n"
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	opts := bumpOptions{Registry: newRegistryClient(context.Background())}
+
+	_, err := bumpHelmReleaseFile(file, map[string]string{repo: "1.9.0"}, opts)
+	if err == nil || !strings.Contains(err.Error(), "--check-exists: image "+repo+":1.9.0") {
+		t.Fatalf("Expected a missing tag error, got: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != original {
+		t.Errorf("Expected the file to be left unchanged, got:\n%s", data)
+	}
+
+	if _, err := bumpHelmReleaseFile(file, map[string]string{repo: "1.8.0"}, opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected the file to be bumped, got:\n%s", data)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Retry and timeout settings of remote operations (registries, git remotes
+// and the Kubernetes API), set by the global flags.
+var (
+	// commandTimeout bounds a whole command; 0 means no limit.
+	commandTimeout time.Duration
+	// retryAttempts is how many times a failed remote operation is retried
+	// when the failure looks transient.
+	retryAttempts = 3
+	// retryBackoff is the wait before the first retry; it doubles with
+	// every retry, up to maxRetryBackoff.
+	retryBackoff = time.Second
+	// registryTimeout bounds a single registry request.
+	registryTimeout = 30 * time.Second
+	// gitTimeout bounds a single git clone or push.
+	gitTimeout = 2 * time.Minute
+	// kubeTimeout bounds a single Kubernetes API request.
+	kubeTimeout = 30 * time.Second
+)
+
+// maxRetryBackoff caps the wait between two retries.
+const maxRetryBackoff = 30 * time.Second
+
+// cancelCommandTimeout releases the --timeout context of the command.
+var cancelCommandTimeout context.CancelFunc = func() {}
+
+// retryableError marks the failure of a remote operation as transient, so
+// retryRemote tries the operation again.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// transient marks err as retryable; nil stays nil.
+func transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// retryRemote runs op until it succeeds, fails with an error that is not
+// retryable, or has been retried retryAttempts times, waiting with
+// exponential backoff in between. Cancellation of ctx (Ctrl+C or --timeout)
+// stops the waiting and is reported as the error.
+func retryRemote(ctx context.Context, what string, op func(ctx context.Context) error) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op(ctx)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || attempt >= retryAttempts {
+			return err
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", what, context.Cause(ctx))
+		}
+		logf("⏳ %s failed (%v), retrying in %s (%d/%d)\n", what, err, backoff, attempt+1, retryAttempts)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", what, context.Cause(ctx))
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying: rate
+// limiting and the gateway errors of an overloaded or restarting server.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// doHTTP sends the request built by newRequest with client, retrying
+// transport errors and retryableStatus responses (see retryRemote). A
+// response with a retryableStatus that is still returned after the last
+// retry is an error.
+func doHTTP(ctx context.Context, client *http.Client, what string, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	var resp *http.Response
+	err := retryRemote(ctx, what, func(ctx context.Context) error {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return err
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			return transient(err)
+		}
+		if retryableStatus(resp.StatusCode) {
+			resp.Body.Close()
+			return transient(fmt.Errorf("unexpected response: %s", resp.Status))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// retryableKubeError reports whether a Kubernetes API error is transient.
+func retryableKubeError(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) || apierrors.IsUnexpectedServerError(err)
+}
+
+// kubeCall runs a Kubernetes API request with retryRemote, retrying the
+// errors retryableKubeError accepts.
+func kubeCall(ctx context.Context, what string, call func(ctx context.Context) error) error {
+	return retryRemote(ctx, what, func(ctx context.Context) error {
+		err := call(ctx)
+		if err != nil && retryableKubeError(err) {
+			return transient(err)
+		}
+		return err
+	})
+}
+
+// gitTransientErrors are fragments of git errors caused by the network or
+// the remote server rather than by the repository.
+var gitTransientErrors = []string{
+	"Could not resolve host",
+	"Connection timed out",
+	"Connection refused",
+	"Connection reset",
+	"Operation timed out",
+	"The remote end hung up unexpectedly",
+	"RPC failed",
+	"early EOF",
+	"returned error: 5",
+	"returned error: 429",
+}
+
+// runGitRemote is runGit for commands that talk to a remote (clone, push):
+// each attempt is bounded by gitTimeout, and network failures are retried
+// (see retryRemote).
+func runGitRemote(ctx context.Context, dir string, args ...string) (string, error) {
+	var out string
+	err := retryRemote(ctx, "git "+args[0], func(ctx context.Context) error {
+		attemptCtx, cancel := context.WithTimeout(ctx, gitTimeout)
+		defer cancel()
+		gitArgs := args
+		if dir != "" {
+			gitArgs = append([]string{"-C", dir}, args...)
+		}
+		cmd := exec.CommandContext(attemptCtx, "git", gitArgs...)
+		output, err := cmd.CombinedOutput()
+		out = strings.TrimSpace(string(output))
+		if err == nil {
+			return nil
+		}
+		if attemptCtx.Err() != nil && ctx.Err() == nil {
+			return transient(fmt.Errorf("timed out after %s", gitTimeout))
+		}
+		err = fmt.Errorf("%w: %s", err, out)
+		for _, fragment := range gitTransientErrors {
+			if strings.Contains(out, fragment) {
+				return transient(err)
+			}
+		}
+		return err
+	})
+	return out, err
+}
+
+// newRunContext returns the context commands run with: it is canceled by
+// SIGINT or SIGTERM, so that long registry scans and pushes stop cleanly. A
+// second signal kills the process as usual.
+func newRunContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// applyCommandTimeout bounds the context of cmd by --timeout.
+func applyCommandTimeout(cmd *cobra.Command) {
+	if commandTimeout <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeoutCause(cmd.Context(), commandTimeout, fmt.Errorf("--timeout of %s exceeded", commandTimeout))
+	cmd.SetContext(ctx)
+	cancelCommandTimeout = cancel
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.DurationVar(&commandTimeout, "timeout", 0, "Abort the command after this long, e.g. 10m (default: no limit)")
+	flags.IntVar(&retryAttempts, "retries", retryAttempts, "How many times a remote operation (registry, git, Kubernetes API) is retried after a transient failure")
+	flags.DurationVar(&retryBackoff, "retry-backoff", retryBackoff, "Wait before the first retry; doubled for every further retry (up to 30s)")
+	flags.DurationVar(&registryTimeout, "registry-timeout", registryTimeout, "Timeout of a single registry request")
+	flags.DurationVar(&gitTimeout, "git-timeout", gitTimeout, "Timeout of a single git clone or push")
+	flags.DurationVar(&kubeTimeout, "kube-timeout", kubeTimeout, "Timeout of a single Kubernetes API request")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetries makes retryRemote wait only briefly for the test.
+func fastRetries(t *testing.T, attempts int) {
+	t.Helper()
+	oldAttempts, oldBackoff := retryAttempts, retryBackoff
+	retryAttempts, retryBackoff = attempts, time.Millisecond
+	t.Cleanup(func() { retryAttempts, retryBackoff = oldAttempts, oldBackoff })
+}
+
+// TestRetryRemote verifies that transient failures are retried up to
+// --retries times and other failures are not.
+func TestRetryRemote(t *testing.T) {
+	fastRetries(t, 2)
+
+	calls := 0
+	err := retryRemote(context.Background(), "op", func(context.Context) error {
+		calls++
+		return transient(errors.New("connection reset"))
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Expected 3 attempts and an error, got %d attempts and %v", calls, err)
+	}
+
+	calls = 0
+	err = retryRemote(context.Background(), "op", func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return transient(errors.New("connection reset"))
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Expected success on the second attempt, got %d attempts and %v", calls, err)
+	}
+
+	calls = 0
+	err = retryRemote(context.Background(), "op", func(context.Context) error {
+		calls++
+		return errors.New("denied")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %d attempts and %v", calls, err)
+	}
+}
+
+// TestRetryRemoteCanceled verifies that cancellation stops the retries.
+func TestRetryRemoteCanceled(t *testing.T) {
+	fastRetries(t, 5)
+	retryBackoff = time.Hour
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	calls := 0
+	err := retryRemote(ctx, "registry request", func(context.Context) error {
+		calls++
+		cancel(errors.New("interrupted"))
+		return transient(errors.New("timeout"))
+	})
+	if err == nil || !strings.Contains(err.Error(), "registry request: interrupted") || calls != 1 {
+		t.Errorf("Expected the cancellation to be reported after one attempt, got %d attempts and %v", calls, err)
+	}
+}
+
+// TestDoHTTPRetriesStatus verifies that rate limiting and gateway errors are
+// retried.
+func TestDoHTTPRetriesStatus(t *testing.T) {
+	fastRetries(t, 3)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	}
+	resp, err := doHTTP(context.Background(), srv.Client(), "request", newRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests.Load() != 3 {
+		t.Errorf("Expected 200 after 3 requests, got %s after %d", resp.Status, requests.Load())
+	}
+
+	retryAttempts = 0
+	requests.Store(0)
+	if _, err := doHTTP(context.Background(), srv.Client(), "request", newRequest); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the 503 to be reported without retries, got: %v", err)
+	}
+}
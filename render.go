@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+var (
+	renderChartDir  string
+	renderShowOnly  []string
+	renderNamespace string
+)
+
+// renderedManifest is one rendered template of a chart.
+type renderedManifest struct {
+	// Name is the template path, e.g. "my-chart/templates/deployment.yaml".
+	Name    string
+	Content string
+}
+
+// ReleaseIdentity returns the Helm release name and namespace helm-controller
+// uses for the HelmRelease (.spec.releaseName and .spec.targetNamespace, with
+// the same defaults as Flux). The namespace is "default" when the manifest
+// sets none.
+func (m *helmReleaseManifest) ReleaseIdentity() (name, namespace string) {
+	hr, ok := m.Object.(interface {
+		GetReleaseName() string
+		GetReleaseNamespace() string
+	})
+	if !ok {
+		return "", "default"
+	}
+	name, namespace = hr.GetReleaseName(), hr.GetReleaseNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	return name, namespace
+}
+
+// renderChart renders ch with values the way `helm template` does for a new
+// release, and returns the non-empty manifests sorted by template path.
+// NOTES.txt and partials are left out. caps sets the cluster capabilities the
+// templates see; nil uses Helm's defaults.
+func renderChart(ch *chart.Chart, values map[string]interface{}, releaseName, namespace string, caps *chartutil.Capabilities) ([]renderedManifest, error) {
+	renderValues, err := chartutil.ToRenderValues(ch, values, chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, caps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare render values: %w", err)
+	}
+
+	rendered, err := engine.Render(ch, renderValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	var manifests []renderedManifest
+	for name, content := range rendered {
+		base := path.Base(name)
+		if base == "NOTES.txt" || strings.HasPrefix(base, "_") || strings.TrimSpace(content) == "" {
+			continue
+		}
+		manifests = append(manifests, renderedManifest{Name: name, Content: content})
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests, nil
+}
+
+// RenderHelmRelease renders the chart in chartDir with the .spec.values of the
+// HelmRelease in hrPath, as helm-controller would install it. Without
+// chartDir, the chart of a HelmRelease referencing an OCIRepository with
+// .spec.chartRef is pulled from its registry, see loadChartRefChart.
+//
+// Values from .spec.valuesFrom are not resolved; only the inline values are
+// merged over the chart's defaults.
+//
+// Parameters:
+//   - hrPath: The path to the HelmRelease YAML file.
+//   - chartDir: The chart directory (or packaged chart) the HelmRelease
+//     installs, or empty to follow its .spec.chartRef.
+//   - namespace: Overrides the release namespace when not empty.
+//
+// Returns:
+//   - The rendered manifests, sorted by template path.
+//   - An error if the HelmRelease or the chart cannot be loaded, or the chart
+//     fails to render.
+func RenderHelmRelease(hrPath, chartDir, namespace string) ([]renderedManifest, error) {
+	return renderHelmRelease(context.Background(), hrPath, chartDir, namespace, nil)
+}
+
+// renderHelmRelease is RenderHelmRelease for a cluster with the capabilities
+// caps; nil uses Helm's defaults.
+func renderHelmRelease(ctx context.Context, hrPath, chartDir, namespace string, caps *chartutil.Capabilities) ([]renderedManifest, error) {
+	data, err := os.ReadFile(hrPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hrPath, err)
+	}
+	values, err := helmReleaseValues(hr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ch *chart.Chart
+	if chartDir == "" {
+		ch, err = loadChartRefChart(ctx, hrPath, hr)
+	} else if ch, err = loader.Load(chartDir); err != nil {
+		err = fmt.Errorf("failed to load chart %s: %w", chartDir, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	releaseName, releaseNamespace := hr.ReleaseIdentity()
+	if namespace != "" {
+		releaseNamespace = namespace
+	}
+	return renderChart(ch, values, releaseName, releaseNamespace, caps)
+}
+
+// selectManifests returns the manifests whose template path (relative to the
+// chart, e.g. "templates/deployment.yaml") or file name matches one of
+// patterns (path.Match globs); all manifests when patterns is empty.
+func selectManifests(manifests []renderedManifest, patterns []string) ([]renderedManifest, error) {
+	if len(patterns) == 0 {
+		return manifests, nil
+	}
+	var selected []renderedManifest
+	for _, m := range manifests {
+		_, name, _ := strings.Cut(m.Name, "/")
+		ok, err := templateSelected(name, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			selected = append(selected, m)
+		}
+	}
+	return selected, nil
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a HelmRelease's chart locally with its values",
+	Long: "Merge the .spec.values of a HelmRelease with a local copy of its chart and " +
+		"print the rendered manifests, like `helm template`, to preview the effect of " +
+		"a bump before Flux applies it. Without --chart-dir, the chart of a " +
+		"HelmRelease using .spec.chartRef is pulled from the OCIRepository it " +
+		"references.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("you must specify --file")
+		}
+
+		manifests, err := renderHelmRelease(cmd.Context(), filePath, renderChartDir, renderNamespace, nil)
+		if err != nil {
+			return fmt.Errorf("failed to render: %w", err)
+		}
+		manifests, err = selectManifests(manifests, renderShowOnly)
+		if err != nil {
+			return err
+		}
+		if len(manifests) == 0 && len(renderShowOnly) > 0 {
+			return fmt.Errorf("no rendered template matches --show-only %s", strings.Join(renderShowOnly, ", "))
+		}
+
+		for _, m := range manifests {
+			fmt.Printf("---\n# Source: %s\n%s\n", m.Name, strings.TrimSpace(m.Content))
+		}
+		return nil
+	},
+}
+
+func init() {
+	renderCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
+	renderCmd.Flags().StringVar(&renderChartDir, "chart-dir", "", "Path to the chart directory (or packaged chart) the HelmRelease installs (default: pull the chart of its .spec.chartRef)")
+	renderCmd.Flags().StringArrayVar(&renderShowOnly, "show-only", nil, "Only print templates matching this path or glob, e.g. templates/deployment.yaml (repeatable)")
+	renderCmd.Flags().StringVarP(&renderNamespace, "namespace", "n", "", "Release namespace (default: .spec.targetNamespace or the HelmRelease's namespace)")
+	rootCmd.AddCommand(renderCmd)
+}
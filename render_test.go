@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRenderHelmRelease verifies that the chart is rendered with the
+// HelmRelease's values over the chart defaults and its release name.
+func TestRenderHelmRelease(t *testing.T) {
+	manifests, err := RenderHelmRelease("test_files/helmrelease-v2.yaml", "test_files/test_chart", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(manifests) != 1 || manifests[0].Name != "test-chart/templates/deployment.yaml" {
+		t.Fatalf("Expected only the deployment to be rendered, got: %v", manifests)
+	}
+	content := manifests[0].Content
+	for _, want := range []string{`image: "ghcr.io/my-org/my-api:1.7.99"`, "app.kubernetes.io/instance: my-app", "imagePullPolicy: IfNotPresent"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected rendered manifest to contain %q, got:\n%s", want, content)
+		}
+	}
+
+	selected, err := selectManifests(manifests, []string{"templates/service.yaml"})
+	if err != nil || len(selected) != 0 {
+		t.Errorf("Expected no manifest for an unknown template, got %v, err %v", selected, err)
+	}
+	selected, err = selectManifests(manifests, []string{"deploy*"})
+	if err != nil || len(selected) != 1 {
+		t.Errorf("Expected the deployment to be selected by base name, got %v, err %v", selected, err)
+	}
+}
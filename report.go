@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	reportPath   string
+	reportMDPath string
+)
+
+// runReport is the change report artifact written with --report (JSON) and
+// --report-md (Markdown), meant to be attached to release pull requests.
+type runReport struct {
+	Command    string        `json:"command"`
+	DryRun     bool          `json:"dryRun"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt time.Time     `json:"finishedAt"`
+	GitSHA     string        `json:"gitSHA,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Summary    reportSummary `json:"summary"`
+	Images     []imageReport `json:"images"`
+	Files      []fileReport  `json:"files"`
+}
+
+// reportSummary counts what a run changed (or would change, in dry-run mode).
+type reportSummary struct {
+	Files   int `json:"files"`
+	Images  int `json:"images"`
+	Changes int `json:"changes"`
+}
+
+// imageReport groups the changes of a run by image.
+type imageReport struct {
+	Image     string   `json:"image"`
+	OldValues []string `json:"oldValues"`
+	NewValues []string `json:"newValues"`
+	Files     []string `json:"files"`
+}
+
+// newRunReport builds the report of a run of command that started at
+// startedAt and produced files. runErr, if not nil, is recorded so that a
+// failed run still leaves an artifact behind.
+func newRunReport(command string, dryRun bool, startedAt time.Time, files []fileReport, runErr error) *runReport {
+	r := &runReport{
+		Command:    command,
+		DryRun:     dryRun,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: time.Now().UTC(),
+		GitSHA:     gitHeadSHA(),
+		Images:     []imageReport{},
+		Files:      []fileReport{},
+	}
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+
+	byImage := map[string]*imageReport{}
+	for _, f := range files {
+		if len(f.Changes) == 0 {
+			continue
+		}
+		r.Files = append(r.Files, f)
+		r.Summary.Changes += len(f.Changes)
+		for _, c := range f.Changes {
+			img, ok := byImage[c.Image]
+			if !ok {
+				img = &imageReport{Image: c.Image}
+				byImage[c.Image] = img
+			}
+			img.OldValues = appendUnique(img.OldValues, c.OldValue)
+			img.NewValues = appendUnique(img.NewValues, c.NewValue)
+			img.Files = appendUnique(img.Files, f.File)
+		}
+	}
+	r.Summary.Files = len(r.Files)
+	r.Summary.Images = len(byImage)
+
+	names := make([]string, 0, len(byImage))
+	for name := range byImage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.Images = append(r.Images, *byImage[name])
+	}
+	return r
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// gitHeadSHA returns the commit checked out in the working directory, or ""
+// when it is not a git repository or git is not installed.
+func gitHeadSHA() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// markdown renders the report as a Markdown document suitable for a pull
+// request description or comment.
+func (r *runReport) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## flux-helpers %s report\n\n", r.Command)
+	fmt.Fprintf(&b, "- **Started:** %s\n", r.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- **Finished:** %s\n", r.FinishedAt.Format(time.RFC3339))
+	if r.GitSHA != "" {
+		fmt.Fprintf(&b, "- **Git SHA:** `%s`\n", r.GitSHA)
+	}
+	if r.DryRun {
+		b.WriteString("- **Dry run:** yes, no file was modified\n")
+	}
+	fmt.Fprintf(&b, "- **Summary:** %d change(s) to %d image(s) in %d file(s)\n", r.Summary.Changes, r.Summary.Images, r.Summary.Files)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "- **Error:** %s\n", markdownCell(r.Error))
+	}
+
+	if len(r.Files) == 0 {
+		b.WriteString("\nNo changes.\n")
+		return b.String()
+	}
+
+	b.WriteString("\n| File | Image | Path | Old | New |\n| --- | --- | --- | --- | --- |\n")
+	for _, f := range r.Files {
+		file := f.File
+		if f.Object != "" {
+			file += " (" + f.Object + ")"
+		}
+		for _, c := range f.Changes {
+			fmt.Fprintf(&b, "| `%s` | `%s` | `%s` | `%s` | `%s` |\n",
+				markdownCell(file), markdownCell(c.Image), markdownCell(c.Path), markdownCell(c.OldValue), markdownCell(c.NewValue))
+		}
+	}
+	return b.String()
+}
+
+// markdownCell escapes s for use inside a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// writeRunReport writes r as JSON to jsonPath and as Markdown to mdPath;
+// empty paths are skipped.
+func writeRunReport(r *runReport, jsonPath, mdPath string) error {
+	if jsonPath != "" {
+		f, err := os.Create(jsonPath)
+		if err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		err = writeJSON(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		logf("📄 Report written to %s\n", jsonPath)
+	}
+	if mdPath != "" {
+		if err := os.WriteFile(mdPath, []byte(r.markdown()), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		logf("📄 Markdown report written to %s\n", mdPath)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunReport verifies that the change report groups changes by image,
+// counts them, and is written as JSON and Markdown.
+func TestRunReport(t *testing.T) {
+	files := []fileReport{
+		{File: "dev/app.yaml", Updated: 2, Changes: []tagChange{
+			{Image: "ghcr.io/my-org/api", Path: "image.tag", OldValue: "1.0.0", NewValue: "1.1.0"},
+			{Image: "envoyproxy/envoy", Path: "sidecar.image.tag", OldValue: "1.26.5", NewValue: "1.27.0"},
+		}},
+		{File: "prod/app.yaml", Updated: 1, Changes: []tagChange{
+			{Image: "ghcr.io/my-org/api", Path: "image.tag", OldValue: "0.9.0", NewValue: "1.1.0"},
+		}},
+		{File: "staging/app.yaml"},
+	}
+
+	r := newRunReport("bump", true, time.Now(), files, nil)
+	if r.Summary != (reportSummary{Files: 2, Images: 2, Changes: 3}) {
+		t.Errorf("Unexpected summary: %+v", r.Summary)
+	}
+	if len(r.Images) != 2 || r.Images[1].Image != "ghcr.io/my-org/api" {
+		t.Fatalf("Expected images grouped and sorted, got: %+v", r.Images)
+	}
+	api := r.Images[1]
+	if strings.Join(api.OldValues, ",") != "1.0.0,0.9.0" || strings.Join(api.NewValues, ",") != "1.1.0" || len(api.Files) != 2 {
+		t.Errorf("Unexpected image report: %+v", api)
+	}
+
+	dir := t.TempDir()
+	jsonPath, mdPath := filepath.Join(dir, "report.json"), filepath.Join(dir, "report.md")
+	if err := writeRunReport(r, jsonPath, mdPath); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(jsonPath)
+	var decoded runReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	if !decoded.DryRun || decoded.Command != "bump" || len(decoded.Files) != 2 {
+		t.Errorf("Unexpected decoded report: %+v", decoded)
+	}
+
+	md, _ := os.ReadFile(mdPath)
+	for _, want := range []string{"## flux-helpers bump report", "**Dry run:** yes", "| `prod/app.yaml` | `ghcr.io/my-org/api` | `image.tag` | `0.9.0` | `1.1.0` |"} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("Expected Markdown report to contain %q, got:\n%s", want, md)
+		}
+	}
+
+	failed := newRunReport("apply", false, time.Now(), nil, errors.New("plan is stale"))
+	if failed.Error != "plan is stale" || !strings.Contains(failed.markdown(), "No changes.") {
+		t.Errorf("Expected the error to be recorded, got: %+v", failed)
+	}
+}
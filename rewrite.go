@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// rewritesPath is the rewrites file given with --rewrites.
+var rewritesPath string
+
+// rewriteRules is a rewrites file normalizing the updates CI passes to bump
+// to the conventions of the manifests, e.g.:
+//
+//	tags:
+//	  - match: 'v(\d+\.\d+\.\d+.*)'
+//	    replace: '$1'
+//	  - match: 'main-([0-9a-f]{7})[0-9a-f]*'
+//	    replace: 'main-$1'
+//	registries:
+//	  - from: ghcr.io
+//	    to: internal-registry.example.com
+//
+// Tag rules rewrite the version of every update: the first rule whose match
+// covers the whole version replaces it, with $1-style references to its
+// groups. Registry rules replace a leading repository prefix of the images
+// of --set and updates files, so updates can name the upstream registry while
+// the manifests reference a mirror.
+type rewriteRules struct {
+	Tags       []tagRewrite      `json:"tags,omitempty"`
+	Registries []registryRewrite `json:"registries,omitempty"`
+}
+
+// tagRewrite replaces versions fully matching Match with Replace.
+type tagRewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// registryRewrite replaces the repository prefix From with To. From matches
+// whole path components: "ghcr.io" matches "ghcr.io/my-org/api" but not
+// "ghcr.io.example.com/api".
+type registryRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// loadRewriteRules reads and validates a rewrites file. It returns nil if
+// file is empty.
+func loadRewriteRules(file string) (*rewriteRules, error) {
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrites file: %w", err)
+	}
+
+	var r rewriteRules
+	if err := yaml.UnmarshalStrict(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid rewrites file %s: %w", file, err)
+	}
+	if len(r.Tags)+len(r.Registries) == 0 {
+		return nil, fmt.Errorf("invalid rewrites file %s: no rules defined", file)
+	}
+	for i := range r.Tags {
+		rule := &r.Tags[i]
+		if rule.Match == "" {
+			return nil, fmt.Errorf("invalid rewrites file %s: tag rule %d has no match", file, i+1)
+		}
+		if rule.re, err = regexp.Compile("^(?:" + rule.Match + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid rewrites file %s: tag rule %d: %w", file, i+1, err)
+		}
+	}
+	for i, rule := range r.Registries {
+		if rule.From == "" || rule.To == "" || strings.HasSuffix(rule.From, "/") || strings.HasSuffix(rule.To, "/") {
+			return nil, fmt.Errorf("invalid rewrites file %s: registry rule %d needs from and to without a trailing /", file, i+1)
+		}
+	}
+	return &r, nil
+}
+
+// tag returns version rewritten by the first tag rule matching it.
+func (r *rewriteRules) tag(version string) string {
+	for _, rule := range r.Tags {
+		if rule.re.MatchString(version) {
+			return rule.re.ReplaceAllString(version, rule.Replace)
+		}
+	}
+	return version
+}
+
+// repository returns image with the prefix of the first registry rule
+// matching it replaced.
+func (r *rewriteRules) repository(image string) string {
+	for _, rule := range r.Registries {
+		if rest, ok := strings.CutPrefix(image, rule.From); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			return rule.To + rest
+		}
+	}
+	return image
+}
+
+// apply rewrites the images and versions of set in place. The keys of
+// ImagesRegex are regular expressions and only have their versions
+// rewritten.
+func (r *rewriteRules) apply(set *updateSet) error {
+	if len(set.Images) > 0 {
+		images := make(map[string]string, len(set.Images))
+		for _, image := range sortedKeys(set.Images) {
+			version := set.Images[image]
+			newImage, newVersion := r.repository(image), r.tag(version)
+			if prev, ok := images[newImage]; ok && prev != newVersion {
+				return fmt.Errorf("rewrites map two updates to %s with different versions: %s and %s", newImage, prev, newVersion)
+			}
+			if newImage != image || newVersion != version {
+				logf("🔧 Rewrote %s=%s to %s=%s\n", image, version, newImage, newVersion)
+			}
+			images[newImage] = newVersion
+		}
+		set.Images = images
+	}
+	for pattern, version := range set.ImagesRegex {
+		if newVersion := r.tag(version); newVersion != version {
+			logf("🔧 Rewrote %s=%s to %s=%s\n", pattern, version, pattern, newVersion)
+			set.ImagesRegex[pattern] = newVersion
+		}
+	}
+	return nil
+}
+
+// applyRewrites loads the rewrites file and rewrites the updates of every
+// set with it.
+func applyRewrites(sets []updateSet, file string) error {
+	rules, err := loadRewriteRules(file)
+	if err != nil || rules == nil {
+		return err
+	}
+	for i := range sets {
+		if err := rules.apply(&sets[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRewrites = `tags:
+  - match: 'v(\d+\.\d+\.\d+.*)'
+    replace: '$1'
+  - match: 'main-([0-9a-f]{7})[0-9a-f]*'
+    replace: 'main-$1'
+registries:
+  - from: ghcr.io
+    to: internal-registry.example.com
+`
+
+// TestApplyRewrites verifies that tag and registry rules rewrite the updates
+// before they are matched against a manifest using the mirror.
+func TestApplyRewrites(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rewrites.yaml")
+	file := filepath.Join(dir, "hr.yaml")
+	os.WriteFile(rules, []byte(testRewrites), 0644)
+	os.WriteFile(file, []byte(strings.ReplaceAll(serveManifest, "ghcr.io", "internal-registry.example.com")), 0644)
+
+	sets := []updateSet{{
+		Files: []string{file},
+		Images: map[string]string{
+			"ghcr.io/my-org/my-api":      "v1.8.0",
+			"ghcr.io.example.com/worker": "main-4f2a9c1d8e",
+			"docker.io/library/nginx":    "latest",
+			"ghcr.io/my-org/*":           "v2",
+		},
+		ImagesRegex: map[string]string{"ghcr\\.io/.*": "v1.9.0"},
+	}}
+	if err := applyRewrites(sets, rules); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"internal-registry.example.com/my-org/my-api": "1.8.0",
+		"ghcr.io.example.com/worker":                  "main-4f2a9c1",
+		"docker.io/library/nginx":                     "latest",
+		"internal-registry.example.com/my-org/*":      "v2",
+	}
+	for image, version := range want {
+		if sets[0].Images[image] != version {
+			t.Errorf("Expected %s=%s, got: %v", image, version, sets[0].Images)
+		}
+	}
+	if sets[0].ImagesRegex["ghcr\\.io/.*"] != "1.9.0" {
+		t.Errorf("Expected the regex update's version to be rewritten, got: %v", sets[0].ImagesRegex)
+	}
+
+	delete(sets[0].Images, "internal-registry.example.com/my-org/*")
+	sets[0].ImagesRegex = nil
+	if _, err := runBumpSets(sets, false, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected the mirrored image to be bumped, got:\n%s", data)
+	}
+
+	conflict := []updateSet{{Images: map[string]string{
+		"ghcr.io/my-org/my-api":                       "1.8.0",
+		"internal-registry.example.com/my-org/my-api": "1.7.0",
+	}}}
+	if err := applyRewrites(conflict, rules); err == nil {
+		t.Errorf("Expected updates rewritten to the same image with different versions to be rejected")
+	}
+
+	for _, invalid := range []string{"tags:\n  - match: '('\n", "registries:\n  - from: ghcr.io/\n    to: mirror\n", "{}\n"} {
+		os.WriteFile(rules, []byte(invalid), 0644)
+		if _, err := loadRewriteRules(rules); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
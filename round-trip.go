@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// roundTripVerifyVersion is the tag used when VerifyRoundTrip is asked to
+// exercise every image found in a manifest rather than explicit updates.
+const roundTripVerifyVersion = "0.0.0-verify.1"
+
+// RoundTripError is returned by VerifyRoundTrip when the manifest written by the
+// bump pipeline differs structurally from the expected result.
+type RoundTripError struct {
+	Differences []string
+}
+
+func (e *RoundTripError) Error() string {
+	return fmt.Sprintf("round-trip produced %d structural difference(s):\n  - %s",
+		len(e.Differences), strings.Join(e.Differences, "\n  - "))
+}
+
+// VerifyRoundTrip runs the same integrity check as the fuzz tests against a real
+// HelmRelease manifest: parse → bump → serialize → re-parse → structural compare.
+//
+// The manifest is bumped through the regular write path (bumpHelmReleaseData) and
+// the output is parsed again. Independently, the original document is parsed into
+// a generic map, bumped in place with BumpTagInValuesUniversal and sanitized. The
+// two results must be identical; anything else means the write path lost, added or
+// rewrote data it should not have touched.
+//
+// Parameters:
+//   - data: The raw bytes of the HelmRelease manifest.
+//   - updates: Image name to version updates to apply. When empty, every image
+//     repository found in .spec.values is bumped to a synthetic version.
+//
+// Returns:
+//   - nil if the round-trip preserved the document.
+//   - A *RoundTripError listing each differing path on structural corruption.
+//   - Any other error if the manifest could not be parsed or bumped at all.
+func VerifyRoundTrip(data []byte, updates map[string]string) error {
+	var expected map[string]interface{}
+	if err := yaml.Unmarshal(data, &expected); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	spec, _ := expected["spec"].(map[string]interface{})
+	values, ok := spec["values"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("manifest has no .spec.values map")
+	}
+
+	if len(updates) == 0 {
+		updates = map[string]string{}
+		for _, repo := range collectImageRepositories(values, nil) {
+			updates[repo] = roundTripVerifyVersion
+		}
+	}
+
+	expectedCount := 0
+	for imageName, newVersion := range updates {
+		updated, err := BumpTagInValuesUniversal(values, imageName, newVersion, false)
+		if err != nil {
+			return fmt.Errorf("error updating image %s: %w", imageName, err)
+		}
+		if updated {
+			expectedCount++
+		}
+	}
+	sanitizeHelmRelease(expected)
+
+	result, err := bumpHelmReleaseData(data, updates, bumpOptions{})
+	if err != nil {
+		return err
+	}
+	if result.Updated != expectedCount {
+		return &RoundTripError{Differences: []string{
+			fmt.Sprintf("expected %d updated image(s), bump reported %d", expectedCount, result.Updated),
+		}}
+	}
+	if result.Output == nil {
+		// Nothing was updated, so nothing would have been written.
+		return nil
+	}
+
+	var actual map[string]interface{}
+	if err := yaml.Unmarshal(result.Output, &actual); err != nil {
+		return &RoundTripError{Differences: []string{fmt.Sprintf("output no longer parses: %v", err)}}
+	}
+
+	// Manifests re-encoded by the write path are sanitized, those written in
+	// place are not; either is fine.
+	sanitizeHelmRelease(actual)
+	if diffs := diffStructures("", expected, actual); len(diffs) > 0 {
+		return &RoundTripError{Differences: diffs}
+	}
+	return nil
+}
+
+// diffStructures compares two generic YAML/JSON structures and returns a
+// human-readable description of every path at which they differ.
+func diffStructures(path string, expected, actual interface{}) []string {
+	label := path
+	if label == "" {
+		label = "."
+	}
+
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a map, got %T", label, actual)}
+		}
+		keys := make([]string, 0, len(exp)+len(act))
+		for k := range exp {
+			keys = append(keys, k)
+		}
+		for k := range act {
+			if _, seen := exp[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			ev, eOk := exp[k]
+			av, aOk := act[k]
+			switch {
+			case !aOk:
+				diffs = append(diffs, fmt.Sprintf("%s: missing from output", child))
+			case !eOk:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected in output", child))
+			default:
+				diffs = append(diffs, diffStructures(child, ev, av)...)
+			}
+		}
+		return diffs
+
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a list, got %T", label, actual)}
+		}
+		if len(exp) != len(act) {
+			return []string{fmt.Sprintf("%s: expected %d list item(s), got %d", label, len(exp), len(act))}
+		}
+		var diffs []string
+		for i := range exp {
+			diffs = append(diffs, diffStructures(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i])...)
+		}
+		return diffs
+
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", label, expected, actual)}
+		}
+		return nil
+	}
+}
+
+var fuzzVerifyCmd = &cobra.Command{
+	Use:   "fuzz-verify",
+	Short: "Check that bumping a manifest round-trips without structural corruption",
+	Long: "fuzz-verify runs the round-trip integrity check used by the fuzz tests " +
+		"(parse → bump → serialize → re-parse → compare) against a real manifest. " +
+		"The file itself is never modified.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("you must specify --file")
+		}
+
+		updates := map[string]string{}
+		for _, set := range tagArgs {
+			parts := splitArg(set)
+			if parts == nil {
+				return fmt.Errorf("invalid --set format: %s (expected repo=version)", set)
+			}
+			updates[parts[0]] = parts[1]
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+
+		if err := VerifyRoundTrip(data, updates); err != nil {
+			var rtErr *RoundTripError
+			if errors.As(err, &rtErr) {
+				return fmt.Errorf("%s failed round-trip verification: %w", filePath, err)
+			}
+			return fmt.Errorf("failed to verify %s: %w", filePath, err)
+		}
+
+		logf("✅ %s round-trips cleanly\n", filePath)
+		return nil
+	},
+}
+
+func init() {
+	fuzzVerifyCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
+	fuzzVerifyCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version (default: every image found)")
+	rootCmd.AddCommand(fuzzVerifyCmd)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestVerifyRoundTrip checks that VerifyRoundTrip accepts the sample manifests,
+// including fields the API types do not know, whether the manifest is patched
+// in place or re-encoded.
+func TestVerifyRoundTrip(t *testing.T) {
+	for _, fixture := range []string{
+		"test_files/multiple-bump.yaml",
+		"test_files/aspire-test.yaml",
+		"test_files/helmrelease-v2.yaml",
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			if err := VerifyRoundTrip(data, nil); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("unknown field kept in place", func(t *testing.T) {
+		data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		data = []byte(strings.Replace(string(data), "  interval: 5m0s\n", "  interval: 5m0s\n  notAHelmReleaseField: true\n", 1))
+		if err := VerifyRoundTrip(data, map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("unknown field kept on re-encode", func(t *testing.T) {
+		data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		data = []byte(strings.Replace(string(data), "  interval: 5m0s\n", "  interval: 5m0s\n  notAHelmReleaseField: true\n", 1))
+		// A block scalar tag cannot be rewritten in place, so the manifest is
+		// re-encoded from its unstructured document.
+		data = []byte(strings.Replace(string(data), "tag: 1.7.99\n", "tag: >-\n        1.7.99\n", 1))
+
+		if err := VerifyRoundTrip(data, map[string]string{"ghcr.io/my-org/my-api": "2.0.0"}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+// TestEncodeHelmReleaseKeepsUnknownFields verifies that a re-encoded
+// HelmRelease keeps its status, fields the API types do not know (also inside
+// post-renderers) and exact numbers.
+func TestEncodeHelmReleaseKeepsUnknownFields(t *testing.T) {
+	data := []byte(`apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  interval: 5m
+  futureField: {enabled: true, maxHistory: 1000000}
+  postRenderers:
+    - kustomize:
+        images:
+          - name: nginx
+            newTag: "1.0.0"
+        futureOption: keep
+  values:
+    image: {repository: ghcr.io/my-org/my-api, tag: "1.7.99"}
+status:
+  observedGeneration: 3
+  history:
+    - chartVersion: 1.0.0
+      futureStatusField: keep
+`)
+	hr, err := decodeHelmRelease(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	values, err := helmReleaseValues(hr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	values["image"].(map[string]interface{})["tag"] = "1.8.0"
+	view, err := newPostRendererView(hr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := view.sync(hr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, err := encodeHelmRelease(hr, values)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{"futureField:\n    enabled: true\n    maxHistory: 1000000", "futureOption: keep", "futureStatusField: keep", "observedGeneration: 3", "tag: 1.8.0"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Sanitize modes of --sanitize.
+const (
+	sanitizeNone    = "none"
+	sanitizeDefault = "default"
+	sanitizeStrict  = "strict"
+)
+
+var (
+	// sanitizeMode is the --sanitize mode used when a HelmRelease is
+	// re-encoded.
+	sanitizeMode = sanitizeDefault
+	// sanitizePaths are the --sanitize-path fields removed on top of those of
+	// the mode.
+	sanitizePaths []string
+)
+
+// sanitizeRule is a field removed from a re-encoded HelmRelease.
+type sanitizeRule struct {
+	// Path holds the keys leading to the field, e.g. metadata, generation.
+	Path []string
+	// IfEmpty only removes the field when it holds an empty mapping.
+	IfEmpty bool
+}
+
+// defaultSanitizeRules drop what the API types add to a manifest they
+// marshal: a null creationTimestamp and an empty status.
+var defaultSanitizeRules = []sanitizeRule{
+	{Path: []string{"metadata", "creationTimestamp"}},
+	{Path: []string{"status"}, IfEmpty: true},
+}
+
+// sanitizeModeRules are the fields each --sanitize mode removes. Strict also
+// drops the server-side fields of manifests exported from a cluster.
+var sanitizeModeRules = map[string][]sanitizeRule{
+	sanitizeNone:    nil,
+	sanitizeDefault: defaultSanitizeRules,
+	sanitizeStrict: {
+		{Path: []string{"metadata", "creationTimestamp"}},
+		{Path: []string{"metadata", "generation"}},
+		{Path: []string{"metadata", "managedFields"}},
+		{Path: []string{"metadata", "resourceVersion"}},
+		{Path: []string{"metadata", "uid"}},
+		{Path: []string{"metadata", "selfLink"}},
+		{Path: []string{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"}},
+		{Path: []string{"status"}},
+	},
+}
+
+// activeSanitizeRules returns the rules of --sanitize and --sanitize-path.
+//
+// Returns:
+//   - The rules, in the order they apply.
+//   - An error if the mode is unknown or a path is invalid.
+func activeSanitizeRules() ([]sanitizeRule, error) {
+	rules, ok := sanitizeModeRules[sanitizeMode]
+	if !ok {
+		return nil, fmt.Errorf("invalid --sanitize %q (expected %s, %s or %s)", sanitizeMode, sanitizeNone, sanitizeDefault, sanitizeStrict)
+	}
+	rules = append([]sanitizeRule(nil), rules...)
+	for _, path := range sanitizePaths {
+		keys, err := parseSanitizePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --sanitize-path %q: %w", path, err)
+		}
+		rules = append(rules, sanitizeRule{Path: keys})
+	}
+	return rules, nil
+}
+
+// parseSanitizePath splits a JSON path such as .metadata.generation into its
+// keys. Keys holding dots or slashes are written in brackets, as in
+// .metadata.annotations["example.com/owner"]; the leading dot is optional.
+// List indexes are not supported.
+func parseSanitizePath(path string) ([]string, error) {
+	rest := strings.TrimPrefix(path, ".")
+	var keys []string
+	for rest != "" {
+		if strings.HasPrefix(rest, "[") {
+			if !strings.HasPrefix(rest, `["`) {
+				return nil, fmt.Errorf("expected a quoted key after [")
+			}
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf(`missing "] after %s`, rest)
+			}
+			keys = append(keys, rest[2:end])
+			rest = rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			keys = append(keys, rest[:end])
+			rest = rest[end:]
+		}
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("trailing dot")
+			}
+		}
+	}
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	if len(keys) == 1 && (keys[0] == "apiVersion" || keys[0] == "kind" || keys[0] == "metadata" || keys[0] == "spec") {
+		return nil, fmt.Errorf("%s cannot be removed", keys[0])
+	}
+	return keys, nil
+}
+
+// applySanitizeRules removes the fields of rules from obj. Mappings left
+// empty by a removal, such as annotations that only held the removed one,
+// are removed too.
+func applySanitizeRules(obj map[string]interface{}, rules []sanitizeRule) {
+	for _, rule := range rules {
+		removeSanitizedField(obj, rule.Path, rule.IfEmpty)
+	}
+}
+
+// removeSanitizedField removes the field at path below obj, reporting
+// whether obj was left empty by the removal.
+func removeSanitizedField(obj map[string]interface{}, path []string, ifEmpty bool) bool {
+	value, ok := obj[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		if m, isMap := value.(map[string]interface{}); ifEmpty && (!isMap || len(m) > 0) {
+			return false
+		}
+		delete(obj, path[0])
+		return len(obj) == 0
+	}
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if removeSanitizedField(child, path[1:], ifEmpty) {
+		delete(obj, path[0])
+		return len(obj) == 0
+	}
+	return false
+}
+
+// warnUnsanitized warns that the fields of the YAML data selected by a
+// non-default --sanitize or by --sanitize-path were kept, as they are when an
+// edit is made in place: only re-encoded HelmReleases are sanitized. The
+// default mode is silent, since keeping its fields is what an in-place edit
+// is for.
+func warnUnsanitized(data []byte) {
+	if sanitizeMode == sanitizeDefault && len(sanitizePaths) == 0 {
+		return
+	}
+	rules, err := activeSanitizeRules()
+	if err != nil {
+		return
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return
+	}
+	var kept []string
+	for _, rule := range rules {
+		if hasSanitizedField(obj, rule) {
+			kept = append(kept, formatSanitizePath(rule.Path))
+		}
+	}
+	if len(kept) > 0 {
+		logf("⚠️ The edit was made in place, so --sanitize and --sanitize-path did not remove %s\n", strings.Join(kept, ", "))
+	}
+}
+
+// hasSanitizedField reports whether obj holds a field that rule removes.
+func hasSanitizedField(obj map[string]interface{}, rule sanitizeRule) bool {
+	last := len(rule.Path) - 1
+	for _, key := range rule.Path[:last] {
+		child, ok := obj[key].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		obj = child
+	}
+	value, ok := obj[rule.Path[last]]
+	if !ok {
+		return false
+	}
+	if m, isMap := value.(map[string]interface{}); rule.IfEmpty && (!isMap || len(m) > 0) {
+		return false
+	}
+	return true
+}
+
+// formatSanitizePath writes keys as a JSON path in the syntax of
+// parseSanitizePath.
+func formatSanitizePath(keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		if strings.ContainsAny(key, "./[]") {
+			fmt.Fprintf(&b, "[%q]", key)
+		} else {
+			b.WriteString("." + key)
+		}
+	}
+	return b.String()
+}
+
+// sanitizedKey reports whether the dotted key, e.g. "status", is removed
+// unconditionally by the active sanitize rules, so the rewrite guard does not
+// refuse a rewrite for losing it.
+func sanitizedKey(key string) bool {
+	rules, err := activeSanitizeRules()
+	if err != nil {
+		return false
+	}
+	for _, rule := range rules {
+		if !rule.IfEmpty && strings.Join(rule.Path, ".") == key {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&sanitizeMode, "sanitize", sanitizeDefault, "Fields removed from a HelmRelease that has to be re-encoded: none, default (creationTimestamp and an empty status) or strict (also generation, managedFields, resourceVersion, uid, last-applied-configuration and status)")
+	rootCmd.PersistentFlags().StringArrayVar(&sanitizePaths, "sanitize-path", nil, `Also remove this field from re-encoded HelmReleases, as a JSON path such as .metadata.labels["example.com/team"] (can be repeated)`)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TestParseSanitizePath verifies the JSON path syntax of --sanitize-path.
+func TestParseSanitizePath(t *testing.T) {
+	tests := map[string][]string{
+		".metadata.generation":                    {"metadata", "generation"},
+		"status":                                  {"status"},
+		`.metadata.labels["example.com/team"]`:    {"metadata", "labels", "example.com/team"},
+		`metadata["annotations"]["a.b/c"]`:        {"metadata", "annotations", "a.b/c"},
+		`.metadata.annotations["x.io/y"].ignored`: {"metadata", "annotations", "x.io/y", "ignored"},
+	}
+	for path, want := range tests {
+		got, err := parseSanitizePath(path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseSanitizePath(%q) = %v, %v; expected %v", path, got, err, want)
+		}
+	}
+	for _, invalid := range []string{"", ".", "metadata.", "a..b", `a[b]`, `a["b`, "spec", ".kind"} {
+		if _, err := parseSanitizePath(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestSanitizeHelmReleaseModes verifies the fields removed by each --sanitize
+// mode and by --sanitize-path.
+func TestSanitizeHelmReleaseModes(t *testing.T) {
+	manifest := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app
+  creationTimestamp: null
+  generation: 3
+  uid: 0b6f
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+  labels:
+    example.com/team: payments
+    app: web
+spec:
+  interval: 5m
+status: {}
+`
+	oldMode, oldPaths := sanitizeMode, sanitizePaths
+	defer func() { sanitizeMode, sanitizePaths = oldMode, oldPaths }()
+
+	tests := []struct {
+		mode  string
+		paths []string
+		want  []string
+		kept  []string
+	}{
+		{sanitizeNone, nil, nil, []string{"creationTimestamp", "status", "generation"}},
+		{sanitizeDefault, nil, []string{"creationTimestamp", "status"}, []string{"generation", "uid", "last-applied-configuration"}},
+		{sanitizeStrict, nil, []string{"creationTimestamp", "status", "generation", "uid", "annotations", "last-applied-configuration"}, []string{"example.com/team"}},
+		{sanitizeDefault, []string{`.metadata.labels["example.com/team"]`}, []string{"example.com/team"}, []string{"app: web", "generation"}},
+	}
+	for _, tt := range tests {
+		sanitizeMode, sanitizePaths = tt.mode, tt.paths
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+			t.Fatal(err)
+		}
+		sanitizeHelmRelease(obj)
+		out, _ := yaml.Marshal(obj)
+		for _, field := range tt.want {
+			if strings.Contains(string(out), field) {
+				t.Errorf("%s %v: expected %s to be removed, got:\n%s", tt.mode, tt.paths, field, out)
+			}
+		}
+		for _, field := range tt.kept {
+			if !strings.Contains(string(out), field) {
+				t.Errorf("%s %v: expected %s to be kept, got:\n%s", tt.mode, tt.paths, field, out)
+			}
+		}
+	}
+
+	sanitizeMode = "aggressive"
+	if _, err := activeSanitizeRules(); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+// TestCheckRewriteSanitizedStatus verifies that the rewrite guard accepts the
+// removal of a non-empty status only when --sanitize=strict removes it.
+func TestCheckRewriteSanitizedStatus(t *testing.T) {
+	original := "kind: HelmRelease\nspec:\n  interval: 5m\nstatus:\n  observedGeneration: 2\n"
+	updated := "kind: HelmRelease\nspec:\n  interval: 10m\n"
+
+	oldMode := sanitizeMode
+	defer func() { sanitizeMode = oldMode }()
+
+	sanitizeMode = sanitizeDefault
+	if err := checkRewrite([]byte(original), []byte(updated)); err == nil || !strings.Contains(err.Error(), "lose status") {
+		t.Errorf("Expected losing status to be refused, got %v", err)
+	}
+	sanitizeMode = sanitizeStrict
+	if err := checkRewrite([]byte(original), []byte(updated)); err != nil {
+		t.Errorf("Unexpected error with --sanitize=strict: %v", err)
+	}
+}
+
+// TestBumpWarnsUnsanitized verifies that an in-place edit warns about the
+// fields a non-default --sanitize or --sanitize-path would have removed, and
+// stays silent in the default mode.
+func TestBumpWarnsUnsanitized(t *testing.T) {
+	data := strings.Replace(chartRefHelmRelease, "metadata:\n", "metadata:\n  creationTimestamp: null\n  generation: 3\n", 1) + "status:\n  observedGeneration: 3\n"
+
+	oldMode, oldPaths, out := sanitizeMode, sanitizePaths, logOut
+	defer func() { sanitizeMode, sanitizePaths, logOut = oldMode, oldPaths, out }()
+
+	tests := []struct {
+		mode  string
+		paths []string
+		want  string
+	}{
+		{sanitizeDefault, nil, ""},
+		{sanitizeStrict, nil, "did not remove .metadata.creationTimestamp, .metadata.generation, .status"},
+		{sanitizeNone, []string{".metadata.generation", `.metadata.labels["example.com/team"]`}, "did not remove .metadata.generation\n"},
+	}
+	for _, tt := range tests {
+		sanitizeMode, sanitizePaths = tt.mode, tt.paths
+		var buf bytes.Buffer
+		logOut = &buf
+		result, err := bumpHelmReleaseData([]byte(data), map[string]string{"nginx": "1.26.0"}, bumpOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.mode, err)
+		}
+		if !strings.Contains(string(result.Output), "generation: 3") {
+			t.Errorf("%s: expected an in-place edit, got:\n%s", tt.mode, result.Output)
+		}
+		if tt.want == "" && strings.Contains(buf.String(), "⚠️") {
+			t.Errorf("%s: unexpected warning: %s", tt.mode, buf.String())
+		}
+		if tt.want != "" && !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%s: expected warning %q, got: %q", tt.mode, tt.want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	helmv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// API versions of the Flux objects written by `new` that have no API types
+// in this module. OCIRepository is not served as v1 by the source-controller
+// release matching helm-controller v2.
+const (
+	sourceAPIVersion        = "source.toolkit.fluxcd.io/v1"
+	ociRepositoryAPIVersion = "source.toolkit.fluxcd.io/v1beta2"
+	kustomizationAPIVersion = "kustomize.toolkit.fluxcd.io/v1"
+	// helmChartLayerType is the media type of the chart layer of an OCI
+	// artifact pushed with `helm push`.
+	helmChartLayerType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+var (
+	scaffoldName      string
+	scaffoldNamespace string
+	scaffoldInterval  string
+	scaffoldOutput    string
+
+	scaffoldChart           string
+	scaffoldChartVersion    string
+	scaffoldSourceRef       string
+	scaffoldSourceKind      string
+	scaffoldSourceURL       string
+	scaffoldTargetNamespace string
+
+	scaffoldURL    string
+	scaffoldBranch string
+	scaffoldTag    string
+	scaffoldSemver string
+
+	kustomizationSourceKind string
+	kustomizationPath       string
+	kustomizationPrune      bool
+	kustomizationWait       bool
+	kustomizationDependsOn  []string
+)
+
+// helmReleaseScaffold describes the HelmRelease written by
+// `new helmrelease`, and optionally its source.
+type helmReleaseScaffold struct {
+	Name      string
+	Namespace string
+	Interval  string
+	// Chart defaults to Name. It does not apply to OCIRepository sources,
+	// whose artifact is the chart.
+	Chart string
+	// Version is the chart version or semver range; for OCIRepository
+	// sources it is the semver range of the repository's tags.
+	Version string
+	// SourceKind is HelmRepository, GitRepository or OCIRepository.
+	SourceKind      string
+	SourceName      string
+	SourceNamespace string
+	// SourceURL, when set, adds the source object to the manifests.
+	SourceURL       string
+	TargetNamespace string
+}
+
+// sourceKinds are the chart sources `new helmrelease` can reference.
+var sourceKinds = []string{"HelmRepository", "GitRepository", "OCIRepository"}
+
+// manifests returns the HelmRelease, preceded by its source when SourceURL
+// is set.
+func (s helmReleaseScaffold) manifests() ([]map[string]interface{}, error) {
+	interval, err := parseScaffoldInterval(s.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if s.Version != "" {
+		if _, err := semver.NewConstraint(s.Version); err != nil {
+			return nil, fmt.Errorf("invalid --version %q: %w", s.Version, err)
+		}
+	}
+
+	hr := helmv2.HelmRelease{
+		TypeMeta:   metav1.TypeMeta{APIVersion: helmv2.GroupVersion.String(), Kind: helmv2.HelmReleaseKind},
+		ObjectMeta: metav1.ObjectMeta{Name: s.Name, Namespace: s.Namespace},
+		Spec: helmv2.HelmReleaseSpec{
+			Interval:        interval,
+			TargetNamespace: s.TargetNamespace,
+		},
+	}
+	source := sourceScaffold{Kind: s.SourceKind, Name: s.SourceName, Namespace: s.SourceNamespace, Interval: s.Interval, URL: s.SourceURL}
+	switch s.SourceKind {
+	case "HelmRepository", "GitRepository":
+		chart := s.Chart
+		if chart == "" {
+			chart = s.Name
+		}
+		hr.Spec.Chart = &helmv2.HelmChartTemplate{Spec: helmv2.HelmChartTemplateSpec{
+			Chart:     chart,
+			Version:   s.Version,
+			SourceRef: helmv2.CrossNamespaceObjectReference{Kind: s.SourceKind, Name: s.SourceName, Namespace: s.SourceNamespace},
+		}}
+	case "OCIRepository":
+		if s.Chart != "" {
+			return nil, fmt.Errorf("--chart does not apply to OCIRepository sources, whose artifact is the chart")
+		}
+		hr.Spec.ChartRef = &helmv2.CrossNamespaceSourceReference{Kind: s.SourceKind, Name: s.SourceName, Namespace: s.SourceNamespace}
+		source.Semver, source.HelmChart = s.Version, true
+	default:
+		return nil, fmt.Errorf("unsupported source kind %q (expected %s)", s.SourceKind, strings.Join(sourceKinds, ", "))
+	}
+
+	release, err := manifestMap(hr)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the interval as written rather than as "5m0s".
+	release["spec"].(map[string]interface{})["interval"] = s.Interval
+
+	if s.SourceURL == "" {
+		return []map[string]interface{}{release}, nil
+	}
+	sourceManifest, err := source.manifest()
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{sourceManifest, release}, nil
+}
+
+// sourceScaffold describes the Flux source written by `new source`, or with
+// a HelmRelease.
+type sourceScaffold struct {
+	// Kind is HelmRepository, GitRepository or OCIRepository.
+	Kind      string
+	Name      string
+	Namespace string
+	Interval  string
+	URL       string
+	// Branch, Tag and Semver select the revision of a GitRepository (default:
+	// the main branch) or OCIRepository (default: the latest tag); at most
+	// one is set.
+	Branch string
+	Tag    string
+	Semver string
+	// HelmChart is set for an OCIRepository holding a Helm chart, whose chart
+	// layer is selected.
+	HelmChart bool
+}
+
+// manifest returns the source object.
+func (s sourceScaffold) manifest() (map[string]interface{}, error) {
+	if _, err := parseScaffoldInterval(s.Interval); err != nil {
+		return nil, err
+	}
+	if s.URL == "" {
+		return nil, fmt.Errorf("the %s needs a URL", s.Kind)
+	}
+	set := 0
+	for _, v := range []string{s.Branch, s.Tag, s.Semver} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("--branch, --tag and --semver cannot be combined")
+	}
+	if s.Semver != "" {
+		if _, err := semver.NewConstraint(s.Semver); err != nil {
+			return nil, fmt.Errorf("invalid --semver %q: %w", s.Semver, err)
+		}
+	}
+
+	apiVersion := sourceAPIVersion
+	spec := map[string]interface{}{"interval": s.Interval, "url": s.URL}
+	switch s.Kind {
+	case "HelmRepository":
+		if set > 0 {
+			return nil, fmt.Errorf("a HelmRepository has no revision; set the chart version on the HelmRelease")
+		}
+		if strings.HasPrefix(s.URL, "oci://") {
+			spec["type"] = "oci"
+		}
+	case "GitRepository":
+		ref := map[string]interface{}{"branch": "main"}
+		switch {
+		case s.Branch != "":
+			ref = map[string]interface{}{"branch": s.Branch}
+		case s.Tag != "":
+			ref = map[string]interface{}{"tag": s.Tag}
+		case s.Semver != "":
+			ref = map[string]interface{}{"semver": s.Semver}
+		}
+		spec["ref"] = ref
+	case "OCIRepository":
+		if !strings.HasPrefix(s.URL, "oci://") {
+			return nil, fmt.Errorf("the URL of an OCIRepository must start with oci://")
+		}
+		if s.Branch != "" {
+			return nil, fmt.Errorf("an OCIRepository has no branches; use --tag or --semver")
+		}
+		apiVersion = ociRepositoryAPIVersion
+		ref := map[string]interface{}{"tag": "latest"}
+		switch {
+		case s.Tag != "":
+			ref = map[string]interface{}{"tag": s.Tag}
+		case s.Semver != "":
+			ref = map[string]interface{}{"semver": s.Semver}
+		}
+		spec["ref"] = ref
+		if s.HelmChart {
+			spec["layerSelector"] = map[string]interface{}{"mediaType": helmChartLayerType, "operation": "copy"}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported source kind %q (expected %s)", s.Kind, strings.Join(sourceKinds, ", "))
+	}
+	return objectManifest(apiVersion, s.Kind, s.Name, s.Namespace, spec), nil
+}
+
+// kustomizationScaffold describes the Flux Kustomization written by
+// `new kustomization`.
+type kustomizationScaffold struct {
+	Name      string
+	Namespace string
+	Interval  string
+	// SourceKind is GitRepository, OCIRepository or Bucket.
+	SourceKind      string
+	SourceName      string
+	SourceNamespace string
+	// Path is the directory of the source to apply.
+	Path            string
+	Prune           bool
+	Wait            bool
+	TargetNamespace string
+	// DependsOn lists Kustomizations as [namespace/]name.
+	DependsOn []string
+}
+
+// kustomizationSourceKinds are the sources a Kustomization can apply.
+var kustomizationSourceKinds = []string{"GitRepository", "OCIRepository", "Bucket"}
+
+// manifest returns the Kustomization.
+func (k kustomizationScaffold) manifest() (map[string]interface{}, error) {
+	if _, err := parseScaffoldInterval(k.Interval); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(kustomizationSourceKinds, k.SourceKind) {
+		return nil, fmt.Errorf("unsupported source kind %q (expected %s)", k.SourceKind, strings.Join(kustomizationSourceKinds, ", "))
+	}
+	path := k.Path
+	if path == "" {
+		path = "./"
+	}
+	spec := map[string]interface{}{
+		"interval":  k.Interval,
+		"path":      path,
+		"prune":     k.Prune,
+		"sourceRef": map[string]interface{}{"kind": k.SourceKind, "name": k.SourceName, "namespace": k.SourceNamespace},
+	}
+	if k.Wait {
+		spec["wait"] = true
+	}
+	if k.TargetNamespace != "" {
+		spec["targetNamespace"] = k.TargetNamespace
+	}
+	var dependsOn []interface{}
+	for _, dep := range k.DependsOn {
+		namespace, name, err := parseSourceRef(dep, k.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --depends-on %q: %w", dep, err)
+		}
+		ref := map[string]interface{}{"name": name}
+		if namespace != k.Namespace {
+			ref["namespace"] = namespace
+		}
+		dependsOn = append(dependsOn, ref)
+	}
+	if len(dependsOn) > 0 {
+		spec["dependsOn"] = dependsOn
+	}
+	return objectManifest(kustomizationAPIVersion, "Kustomization", k.Name, k.Namespace, spec), nil
+}
+
+// manifestMap converts a typed object to its generic form, without the empty
+// status and creationTimestamp of typed objects.
+func manifestMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	applySanitizeRules(m, defaultSanitizeRules)
+	return m, nil
+}
+
+// objectManifest returns a Kubernetes object in generic form.
+func objectManifest(apiVersion, kind, name, namespace string, spec map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}
+}
+
+// parseScaffoldInterval parses a reconciliation interval such as "5m".
+func parseScaffoldInterval(interval string) (metav1.Duration, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return metav1.Duration{}, fmt.Errorf("invalid --interval %q (expected a duration such as 5m)", interval)
+	}
+	return metav1.Duration{Duration: d}, nil
+}
+
+// parseSourceRef parses an object reference of the form [namespace/]name,
+// such as --source-ref; the namespace defaults to namespace.
+func parseSourceRef(ref, namespace string) (string, string, error) {
+	name := ref
+	if ns, n, ok := strings.Cut(ref, "/"); ok {
+		namespace, name = ns, n
+	}
+	if err := validateObjectName("reference", name, namespace); err != nil {
+		return "", "", err
+	}
+	return namespace, name, nil
+}
+
+// validateObjectName checks that the name and namespace of the object
+// described by what are valid Kubernetes names.
+func validateObjectName(what, name, namespace string) error {
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		return fmt.Errorf("invalid %s name %q: %s", what, name, strings.Join(msgs, "; "))
+	}
+	if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+		return fmt.Errorf("invalid %s namespace %q: %s", what, namespace, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// encodeManifests returns objects as a multi-document YAML stream.
+func encodeManifests(objects []map[string]interface{}) ([]byte, error) {
+	var docs []string
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(data))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// writeManifests writes objects to stdout when out is "-", and otherwise to
+// the new file out, which must not exist yet.
+func writeManifests(out string, objects []map[string]interface{}) error {
+	data, err := encodeManifests(objects)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifests: %w", err)
+	}
+	var w io.Writer = os.Stdout
+	if out != stdioFile {
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists", out)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if out != stdioFile {
+		logf("✅ Wrote %d manifest(s) to %s\n", len(objects), out)
+	}
+	return nil
+}
+
+var newCmd = &cobra.Command{
+	Use:   "new",
+	Short: "Generate Flux manifests",
+	Long: "Generate well-formed Flux manifests with current API versions: " +
+		"HelmReleases, Kustomizations and their sources.",
+}
+
+// validateScaffoldTarget checks --name, --namespace and --target-namespace of
+// a `new` command generating a what.
+func validateScaffoldTarget(what string) error {
+	if err := validateObjectName(what, scaffoldName, scaffoldNamespace); err != nil {
+		return err
+	}
+	if scaffoldTargetNamespace != "" {
+		if msgs := validation.IsDNS1123Label(scaffoldTargetNamespace); len(msgs) > 0 {
+			return fmt.Errorf("invalid --target-namespace %q: %s", scaffoldTargetNamespace, strings.Join(msgs, "; "))
+		}
+	}
+	return nil
+}
+
+var newHelmReleaseCmd = &cobra.Command{
+	Use:   "helmrelease",
+	Short: "Generate a HelmRelease, and optionally its chart source",
+	Long: "Write a well-formed HelmRelease skeleton with current Flux API versions. " +
+		"With --source-url the HelmRepository, GitRepository or OCIRepository it " +
+		"references is written too.",
+	Example: "  flux-helpers new helmrelease --name app --namespace apps --chart app --source-ref flux-system/charts --interval 5m",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateScaffoldTarget("HelmRelease"); err != nil {
+			return err
+		}
+		sourceNamespace, sourceName, err := parseSourceRef(scaffoldSourceRef, scaffoldNamespace)
+		if err != nil {
+			return fmt.Errorf("invalid --source-ref: %w", err)
+		}
+
+		objects, err := helmReleaseScaffold{
+			Name:            scaffoldName,
+			Namespace:       scaffoldNamespace,
+			Interval:        scaffoldInterval,
+			Chart:           scaffoldChart,
+			Version:         scaffoldChartVersion,
+			SourceKind:      scaffoldSourceKind,
+			SourceName:      sourceName,
+			SourceNamespace: sourceNamespace,
+			SourceURL:       scaffoldSourceURL,
+			TargetNamespace: scaffoldTargetNamespace,
+		}.manifests()
+		if err != nil {
+			return err
+		}
+		return writeManifests(scaffoldOutput, objects)
+	},
+}
+
+var newKustomizationCmd = &cobra.Command{
+	Use:   "kustomization",
+	Short: "Generate a Flux Kustomization",
+	Long: "Write a Flux Kustomization that applies a directory of a GitRepository, " +
+		"OCIRepository or Bucket, with pruning enabled by default.",
+	Example: "  flux-helpers new kustomization --name apps --source-ref flux-system --path ./clusters/prod/apps --depends-on infrastructure",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateScaffoldTarget("Kustomization"); err != nil {
+			return err
+		}
+		sourceNamespace, sourceName, err := parseSourceRef(scaffoldSourceRef, scaffoldNamespace)
+		if err != nil {
+			return fmt.Errorf("invalid --source-ref: %w", err)
+		}
+
+		obj, err := kustomizationScaffold{
+			Name:            scaffoldName,
+			Namespace:       scaffoldNamespace,
+			Interval:        scaffoldInterval,
+			SourceKind:      kustomizationSourceKind,
+			SourceName:      sourceName,
+			SourceNamespace: sourceNamespace,
+			Path:            kustomizationPath,
+			Prune:           kustomizationPrune,
+			Wait:            kustomizationWait,
+			TargetNamespace: scaffoldTargetNamespace,
+			DependsOn:       kustomizationDependsOn,
+		}.manifest()
+		if err != nil {
+			return err
+		}
+		return writeManifests(scaffoldOutput, []map[string]interface{}{obj})
+	},
+}
+
+var newSourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Generate Flux sources",
+}
+
+// newSourceCommand returns the `new source` subcommand generating sources of
+// kind.
+func newSourceCommand(use, kind, example string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     use,
+		Short:   "Generate a " + kind,
+		Example: example,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateObjectName(kind, scaffoldName, scaffoldNamespace); err != nil {
+				return err
+			}
+			obj, err := sourceScaffold{
+				Kind:      kind,
+				Name:      scaffoldName,
+				Namespace: scaffoldNamespace,
+				Interval:  scaffoldInterval,
+				URL:       scaffoldURL,
+				Branch:    scaffoldBranch,
+				Tag:       scaffoldTag,
+				Semver:    scaffoldSemver,
+			}.manifest()
+			if err != nil {
+				return err
+			}
+			return writeManifests(scaffoldOutput, []map[string]interface{}{obj})
+		},
+	}
+	addScaffoldFlags(cmd, kind)
+	cmd.Flags().StringVar(&scaffoldURL, "url", "", "URL of the "+kind)
+	_ = cmd.MarkFlagRequired("url")
+	return cmd
+}
+
+// addScaffoldFlags registers the flags shared by the `new` commands, which
+// generate a what.
+func addScaffoldFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().StringVar(&scaffoldName, "name", "", "Name of the "+what)
+	cmd.Flags().StringVar(&scaffoldNamespace, "namespace", "flux-system", "Namespace of the "+what)
+	cmd.Flags().StringVar(&scaffoldInterval, "interval", "10m", "Reconciliation interval of the "+what)
+	cmd.Flags().StringVar(&scaffoldOutput, "output", stdioFile, "File to write the manifests to, or - for stdout")
+	_ = markLocalSettings(cmd, "output")
+	_ = cmd.MarkFlagRequired("name")
+}
+
+func init() {
+	addScaffoldFlags(newHelmReleaseCmd, "HelmRelease (and its source)")
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldChart, "chart", "", "Chart name, or its path in a GitRepository (default: --name)")
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldChartVersion, "version", "", "Chart version or semver range, e.g. 1.x (default: the latest version)")
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldSourceRef, "source-ref", "", "Chart source as [namespace/]name, e.g. flux-system/charts")
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldSourceKind, "source-kind", "HelmRepository", "Kind of the chart source: "+strings.Join(sourceKinds, ", "))
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldSourceURL, "source-url", "", "Also write the chart source, with this URL")
+	newHelmReleaseCmd.Flags().StringVar(&scaffoldTargetNamespace, "target-namespace", "", "Namespace to install the release into (default: the HelmRelease's)")
+	_ = newHelmReleaseCmd.MarkFlagRequired("source-ref")
+	newCmd.AddCommand(newHelmReleaseCmd)
+
+	addScaffoldFlags(newKustomizationCmd, "Kustomization")
+	newKustomizationCmd.Flags().StringVar(&scaffoldSourceRef, "source-ref", "", "Source as [namespace/]name, e.g. flux-system/flux-system")
+	newKustomizationCmd.Flags().StringVar(&kustomizationSourceKind, "source-kind", "GitRepository", "Kind of the source: "+strings.Join(kustomizationSourceKinds, ", "))
+	newKustomizationCmd.Flags().StringVar(&kustomizationPath, "path", "./", "Directory of the source to apply")
+	newKustomizationCmd.Flags().BoolVar(&kustomizationPrune, "prune", true, "Delete objects removed from the source")
+	newKustomizationCmd.Flags().BoolVar(&kustomizationWait, "wait", false, "Wait for the applied objects to become ready")
+	newKustomizationCmd.Flags().StringArrayVar(&kustomizationDependsOn, "depends-on", nil, "Kustomization to apply first, as [namespace/]name (repeatable)")
+	newKustomizationCmd.Flags().StringVar(&scaffoldTargetNamespace, "target-namespace", "", "Namespace to apply the objects in")
+	_ = newKustomizationCmd.MarkFlagRequired("source-ref")
+	newCmd.AddCommand(newKustomizationCmd)
+
+	gitCmd := newSourceCommand("git", "GitRepository",
+		"  flux-helpers new source git --name podinfo --url https://github.com/stefanprodan/podinfo --tag 6.7.0")
+	gitCmd.Flags().StringVar(&scaffoldBranch, "branch", "", "Branch to follow (default: main)")
+	gitCmd.Flags().StringVar(&scaffoldTag, "tag", "", "Tag to check out")
+	gitCmd.Flags().StringVar(&scaffoldSemver, "semver", "", "Semver range of tags to follow, e.g. 1.x")
+	ociCmd := newSourceCommand("oci", "OCIRepository",
+		"  flux-helpers new source oci --name manifests --url oci://ghcr.io/my-org/manifests --semver '>=1.0.0'")
+	ociCmd.Flags().StringVar(&scaffoldTag, "tag", "", "Tag to pull (default: latest)")
+	ociCmd.Flags().StringVar(&scaffoldSemver, "semver", "", "Semver range of tags to follow, e.g. 1.x")
+	helmCmd := newSourceCommand("helm", "HelmRepository",
+		"  flux-helpers new source helm --name charts --url https://charts.example.com")
+	newSourceCmd.AddCommand(gitCmd, ociCmd, helmCmd)
+	newCmd.AddCommand(newSourceCmd)
+	rootCmd.AddCommand(newCmd)
+}
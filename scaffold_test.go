@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelmReleaseScaffold verifies the generated HelmRelease and source, and
+// that the HelmRelease reads back with the helm-controller API types.
+func TestHelmReleaseScaffold(t *testing.T) {
+	objects, err := helmReleaseScaffold{
+		Name: "app", Namespace: "apps", Interval: "5m", Version: "1.x",
+		SourceKind: "HelmRepository", SourceName: "charts", SourceNamespace: "flux-system",
+		SourceURL: "oci://ghcr.io/my-org/charts",
+	}.manifests()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := encodeManifests(objects)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: charts
+  namespace: flux-system
+spec:
+  interval: 5m
+  type: oci
+  url: oci://ghcr.io/my-org/charts
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app
+  namespace: apps
+spec:
+  chart:
+    spec:
+      chart: app
+      sourceRef:
+        kind: HelmRepository
+        name: charts
+        namespace: flux-system
+      version: 1.x
+  interval: 5m
+`
+	if string(data) != want {
+		t.Errorf("Unexpected manifests:\n%s\nwant:\n%s", data, want)
+	}
+
+	_, release, _ := strings.Cut(string(data), "---\n")
+	hr, err := decodeHelmRelease([]byte(release))
+	if err != nil {
+		t.Fatalf("Failed to decode the HelmRelease: %v", err)
+	}
+	if spec := hr.ChartSpec(); spec == nil || *spec.Chart != "app" || *spec.SourceName != "charts" {
+		t.Errorf("Unexpected chart spec: %+v", spec)
+	}
+}
+
+// TestHelmReleaseScaffoldOCIRepository verifies that OCIRepository sources are
+// referenced with .spec.chartRef.
+func TestHelmReleaseScaffoldOCIRepository(t *testing.T) {
+	scaffold := helmReleaseScaffold{
+		Name: "app", Namespace: "apps", Interval: "10m",
+		SourceKind: "OCIRepository", SourceName: "app", SourceNamespace: "apps",
+		SourceURL: "oci://ghcr.io/my-org/charts/app",
+	}
+	objects, err := scaffold.manifests()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ := encodeManifests(objects)
+	for _, want := range []string{"apiVersion: " + ociRepositoryAPIVersion, "tag: latest", "chartRef:\n    kind: OCIRepository"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %q in:\n%s", want, data)
+		}
+	}
+
+	scaffold.Chart = "app"
+	if _, err := scaffold.manifests(); err == nil {
+		t.Errorf("Expected --chart to be rejected for OCIRepository sources")
+	}
+	scaffold.Chart, scaffold.Interval = "", "often"
+	if _, err := scaffold.manifests(); err == nil {
+		t.Errorf("Expected an invalid interval to be rejected")
+	}
+}
+
+// TestWriteManifestsKeepsExistingFiles verifies that an existing file is not
+// overwritten.
+func TestWriteManifestsKeepsExistingFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	objects := []map[string]interface{}{{"kind": "HelmRelease"}}
+	if err := writeManifests(file, objects); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := writeManifests(file, objects); err == nil {
+		t.Errorf("Expected an error for an existing file")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "kind: HelmRelease\n" {
+		t.Errorf("Unexpected file content: %q", data)
+	}
+}
+
+// TestKustomizationScaffold verifies the generated Kustomization, including
+// dependencies in other namespaces.
+func TestKustomizationScaffold(t *testing.T) {
+	obj, err := kustomizationScaffold{
+		Name: "apps", Namespace: "flux-system", Interval: "10m",
+		SourceKind: "GitRepository", SourceName: "flux-system", SourceNamespace: "flux-system",
+		Path: "./clusters/prod/apps", Prune: true, DependsOn: []string{"infrastructure", "data/db"},
+	}.manifest()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ := encodeManifests([]map[string]interface{}{obj})
+	want := `apiVersion: kustomize.toolkit.fluxcd.io/v1
+kind: Kustomization
+metadata:
+  name: apps
+  namespace: flux-system
+spec:
+  dependsOn:
+  - name: infrastructure
+  - name: db
+    namespace: data
+  interval: 10m
+  path: ./clusters/prod/apps
+  prune: true
+  sourceRef:
+    kind: GitRepository
+    name: flux-system
+    namespace: flux-system
+`
+	if string(data) != want {
+		t.Errorf("Unexpected manifest:\n%s\nwant:\n%s", data, want)
+	}
+
+	if _, err := (kustomizationScaffold{Name: "apps", Interval: "10m", SourceKind: "HelmRepository"}).manifest(); err == nil {
+		t.Errorf("Expected a HelmRepository source to be rejected")
+	}
+}
+
+// TestSourceScaffold verifies the revision of generated sources and that
+// invalid combinations are rejected.
+func TestSourceScaffold(t *testing.T) {
+	for _, tc := range []struct {
+		source sourceScaffold
+		want   string
+	}{
+		{sourceScaffold{Kind: "GitRepository", URL: "https://github.com/my-org/gitops"}, "ref:\n    branch: main"},
+		{sourceScaffold{Kind: "GitRepository", URL: "https://github.com/my-org/gitops", Semver: "1.x"}, "ref:\n    semver: 1.x"},
+		{sourceScaffold{Kind: "OCIRepository", URL: "oci://ghcr.io/my-org/manifests"}, "ref:\n    tag: latest"},
+		{sourceScaffold{Kind: "HelmRepository", URL: "oci://ghcr.io/my-org/charts"}, "type: oci"},
+	} {
+		tc.source.Name, tc.source.Namespace, tc.source.Interval = "src", "flux-system", "1m"
+		obj, err := tc.source.manifest()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.source.Kind, err)
+			continue
+		}
+		if data, _ := encodeManifests([]map[string]interface{}{obj}); !strings.Contains(string(data), tc.want) {
+			t.Errorf("%s: expected %q in:\n%s", tc.source.Kind, tc.want, data)
+		}
+	}
+
+	for _, invalid := range []sourceScaffold{
+		{Kind: "GitRepository", URL: "https://github.com/my-org/gitops", Branch: "main", Tag: "v1"},
+		{Kind: "OCIRepository", URL: "https://ghcr.io/my-org/manifests"},
+		{Kind: "OCIRepository", URL: "oci://ghcr.io/my-org/manifests", Branch: "main"},
+		{Kind: "HelmRepository", URL: "https://charts.example.com", Tag: "1.0.0"},
+		{Kind: "Bucket", URL: "s3://bucket"},
+	} {
+		invalid.Name, invalid.Namespace, invalid.Interval = "src", "flux-system", "1m"
+		if _, err := invalid.manifest(); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// errNotPatchable is returned by patchManifestScalars when an edit cannot be
+// written by replacing scalars in place.
+var errNotPatchable = errors.New("edit cannot be applied in place")
+
+// scalarPatch replaces the text of a single scalar node.
+type scalarPatch struct {
+	node  *yamlv3.Node
+	value string
+	// literal writes value as it is, e.g. a number, instead of formatting it
+	// as a string in the style of node.
+	literal bool
+}
+
+// writeHelmRelease returns the HelmRelease YAML data with the edits made to
+// values and to hr's post-renderers. When every edit changes a string
+// scalar, only those scalars are rewritten in data, so the rest of the file
+// keeps its key order, scalar styles, comments, anchors and formatting; a
+// scalar shared through YAML aliases is rewritten once, at its anchor.
+// Otherwise, e.g. when keys were added or an edited value is a block scalar,
+// the manifest is re-encoded with encodeHelmRelease, which expands aliases
+// and sanitizes it, and a JSON manifest is written back as JSON (see
+// encodeJSONManifest). Fields that --sanitize or --sanitize-path select but an
+// in-place edit keeps are reported with warnUnsanitized.
+func writeHelmRelease(data []byte, hr *helmReleaseManifest, values map[string]interface{}) ([]byte, error) {
+	out, err := patchManifestScalars(data, hr, values)
+	if err == nil {
+		warnUnsanitized(data)
+		return out, nil
+	}
+	if !errors.Is(err, errNotPatchable) {
+		return nil, err
+	}
+	warnExpandedAnchors(data)
+	if out, err = encodeHelmRelease(hr, values); err != nil || !isJSONManifest(data) {
+		return out, err
+	}
+	return encodeJSONManifest(out, data)
+}
+
+// patchManifestScalars compares the .spec.values and .spec.postRenderers in
+// data with values and those of hr, and rewrites every changed scalar in
+// place. It returns an error wrapping errNotPatchable if the differences are
+// not all string scalar changes that can be located in data.
+func patchManifestScalars(data []byte, hr *helmReleaseManifest, values map[string]interface{}) ([]byte, error) {
+	var original struct {
+		Spec struct {
+			Values        interface{} `json:"values"`
+			PostRenderers interface{} `json:"postRenderers"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &original); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	spec := yamlMappingValue(yamlDocumentRoot(&doc), "spec")
+
+	var patches []scalarPatch
+	var edited interface{}
+	if values != nil {
+		edited = values
+	}
+	if err := diffScalars(yamlMappingValue(spec, "values"), original.Spec.Values, edited, &patches); err != nil {
+		return nil, err
+	}
+	renderers, err := hr.PostRenderers()
+	if err != nil {
+		return nil, err
+	}
+	if original.Spec.PostRenderers != nil || len(renderers) > 0 {
+		// Compare in the generic form both sides would have after a JSON
+		// round trip.
+		var editedRenderers interface{}
+		raw, err := json.Marshal(renderers)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &editedRenderers); err != nil {
+			return nil, err
+		}
+		if err := diffScalars(yamlMappingValue(spec, "postRenderers"), original.Spec.PostRenderers, editedRenderers, &patches); err != nil {
+			return nil, err
+		}
+	}
+	return applyScalarPatches(data, patches)
+}
+
+// diffScalars walks node together with the generic values old (parsed from
+// node) and edited, and records a patch for every string scalar that
+// differs.
+//
+// Aliases are followed to their anchored node, so a scalar shared through
+// aliases is patched once however many of its uses were edited, and merge
+// keys ("<<: *defaults") are resolved like the parser resolves them. Edits
+// that give a shared scalar different values fail, as they cannot be written
+// without breaking the alias.
+func diffScalars(node *yamlv3.Node, old, edited interface{}, patches *[]scalarPatch) error {
+	if reflect.DeepEqual(old, edited) {
+		return nil
+	}
+	if node == nil {
+		return errNotPatchable
+	}
+	if node.Kind == yamlv3.AliasNode {
+		return diffScalars(node.Alias, old, edited, patches)
+	}
+
+	switch e := edited.(type) {
+	case map[string]interface{}:
+		o, ok := old.(map[string]interface{})
+		if !ok || len(o) != len(e) || node.Kind != yamlv3.MappingNode {
+			return errNotPatchable
+		}
+		for key, value := range e {
+			if _, exists := o[key]; !exists {
+				return errNotPatchable
+			}
+			if reflect.DeepEqual(o[key], value) {
+				continue
+			}
+			child, err := resolveMappingValue(node, key)
+			if err != nil {
+				return err
+			}
+			if err := diffScalars(child, o[key], value, patches); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []interface{}:
+		o, ok := old.([]interface{})
+		if !ok || len(o) != len(e) || node.Kind != yamlv3.SequenceNode || len(node.Content) != len(e) {
+			return errNotPatchable
+		}
+		for i := range e {
+			if err := diffScalars(node.Content[i], o[i], e[i], patches); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case string:
+		if node.Kind != yamlv3.ScalarNode {
+			return errNotPatchable
+		}
+		for _, p := range *patches {
+			if p.node != node {
+				continue
+			}
+			if p.value != e {
+				return fmt.Errorf("the value at line %d is shared through a YAML alias and cannot be changed to both %q and %q", node.Line, p.value, e)
+			}
+			return nil
+		}
+		*patches = append(*patches, scalarPatch{node: node, value: e})
+		return nil
+	}
+	return errNotPatchable
+}
+
+// resolveMappingValue returns the node holding the value of key in a mapping
+// node. A key of the mapping itself takes precedence over the mappings merged
+// in with "<<", which are searched in order, following aliases.
+func resolveMappingValue(node *yamlv3.Node, key string) (*yamlv3.Node, error) {
+	var found *yamlv3.Node
+	var merged []*yamlv3.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if k.Kind != yamlv3.ScalarNode {
+			return nil, errNotPatchable
+		}
+		if k.Tag == "!!merge" {
+			if v.Kind == yamlv3.SequenceNode {
+				merged = append(merged, v.Content...)
+			} else {
+				merged = append(merged, v)
+			}
+			continue
+		}
+		if k.Value == key {
+			found = v
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	for _, m := range merged {
+		if m.Kind == yamlv3.AliasNode {
+			m = m.Alias
+		}
+		if m == nil || m.Kind != yamlv3.MappingNode {
+			return nil, errNotPatchable
+		}
+		if v, err := resolveMappingValue(m, key); err == nil {
+			return v, nil
+		}
+	}
+	return nil, errNotPatchable
+}
+
+// warnExpandedAnchors warns that re-encoding the YAML data expands its
+// anchors and aliases into copies.
+func warnExpandedAnchors(data []byte) {
+	var doc yamlv3.Node
+	if yamlv3.Unmarshal(data, &doc) != nil || !hasYAMLAnchors(&doc) {
+		return
+	}
+	logln("⚠️ The edit cannot be made in place, so YAML anchors and aliases are expanded in the rewritten file")
+}
+
+// hasYAMLAnchors reports whether node or any node below it has an anchor.
+func hasYAMLAnchors(node *yamlv3.Node) bool {
+	if node.Anchor != "" {
+		return true
+	}
+	for _, child := range node.Content {
+		if hasYAMLAnchors(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueAnchors maps the values paths of the scalars shared through YAML
+// aliases or merge keys to the path of their anchor, so a bump reports the
+// change to a shared scalar once, where it is written (see bumpTagInValues).
+// A nil valueAnchors shares nothing.
+type valueAnchors struct {
+	// anchors maps every path of a shared scalar, the anchor's included, to
+	// the anchor path; paths lists the paths sharing each anchor path.
+	anchors map[string]string
+	paths   map[string][]string
+}
+
+// findValueAnchors collects the scalars shared through aliases or merge keys
+// in the values found at the node that locate returns for the root of the
+// YAML data. A scalar whose anchor lies outside the values is reported at the
+// first of its paths in the values.
+//
+// It returns nil if no scalar is shared.
+func findValueAnchors(data []byte, locate func(root *yamlv3.Node) *yamlv3.Node) *valueAnchors {
+	if !strings.Contains(string(data), "*") {
+		return nil
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	defined := map[*yamlv3.Node]string{}
+	aliased := map[*yamlv3.Node][]string{}
+	var walk func(node *yamlv3.Node, path string, viaAlias bool)
+	walk = func(node *yamlv3.Node, path string, viaAlias bool) {
+		if node != nil && node.Kind == yamlv3.AliasNode {
+			node, viaAlias = node.Alias, true
+		}
+		if node == nil {
+			return
+		}
+		switch node.Kind {
+		case yamlv3.ScalarNode:
+			if viaAlias {
+				aliased[node] = append(aliased[node], path)
+			} else {
+				defined[node] = path
+			}
+		case yamlv3.MappingNode:
+			keys, merged := mappingKeys(node)
+			for _, key := range keys {
+				if child, err := resolveMappingValue(node, key); err == nil {
+					walk(child, joinValuesPath(path, key), viaAlias || merged[key])
+				}
+			}
+		case yamlv3.SequenceNode:
+			for i, item := range node.Content {
+				walk(item, indexValuesPath(path, i), viaAlias)
+			}
+		}
+	}
+	walk(locate(yamlDocumentRoot(&doc)), "", false)
+
+	a := &valueAnchors{anchors: map[string]string{}, paths: map[string][]string{}}
+	for node, uses := range aliased {
+		anchor, ok := defined[node]
+		if ok {
+			uses = append(uses, anchor)
+		} else if len(uses) < 2 {
+			continue
+		}
+		sort.Strings(uses)
+		if !ok {
+			anchor = uses[0]
+		}
+		for _, path := range uses {
+			a.anchors[path] = anchor
+		}
+		a.paths[anchor] = uses
+	}
+	if len(a.anchors) == 0 {
+		return nil
+	}
+	return a
+}
+
+// mappingKeys returns the keys of a mapping node, its own first and then
+// those merged in with "<<" that it does not override, following aliases.
+// merged holds the latter.
+func mappingKeys(node *yamlv3.Node) (keys []string, merged map[string]bool) {
+	merged = map[string]bool{}
+	seen := map[string]bool{}
+	var sources []*yamlv3.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		switch {
+		case k.Tag == "!!merge" && v.Kind == yamlv3.SequenceNode:
+			sources = append(sources, v.Content...)
+		case k.Tag == "!!merge":
+			sources = append(sources, v)
+		case k.Kind == yamlv3.ScalarNode && !seen[k.Value]:
+			seen[k.Value] = true
+			keys = append(keys, k.Value)
+		}
+	}
+	for _, m := range sources {
+		if m.Kind == yamlv3.AliasNode {
+			m = m.Alias
+		}
+		if m == nil || m.Kind != yamlv3.MappingNode {
+			continue
+		}
+		inherited, _ := mappingKeys(m)
+		for _, key := range inherited {
+			if !seen[key] {
+				seen[key] = true
+				merged[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, merged
+}
+
+// resolve returns the anchor path of the scalar at path, or path itself if
+// the scalar is not shared.
+func (a *valueAnchors) resolve(path string) string {
+	if a == nil {
+		return path
+	}
+	if anchor, ok := a.anchors[path]; ok {
+		return anchor
+	}
+	return path
+}
+
+// uses returns every path of the scalar whose anchor path is anchor: anchor
+// alone if the scalar is not shared.
+func (a *valueAnchors) uses(anchor string) []string {
+	if a == nil || len(a.paths[anchor]) == 0 {
+		return []string{anchor}
+	}
+	return a.paths[anchor]
+}
+
+// applyScalarPatches replaces the text of each patched scalar in data, keeping
+// its quoting style where the new value allows it.
+func applyScalarPatches(data []byte, patches []scalarPatch) ([]byte, error) {
+	type edit struct {
+		start, end int
+		text       string
+	}
+	lineStarts := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	edits := make([]edit, 0, len(patches))
+	for _, p := range patches {
+		if p.node.Line < 1 || p.node.Line > len(lineStarts) {
+			return nil, errNotPatchable
+		}
+		start := lineStarts[p.node.Line-1]
+		// Columns count characters, not bytes.
+		for col := 1; col < p.node.Column; col++ {
+			if start >= len(data) || data[start] == '\n' {
+				return nil, errNotPatchable
+			}
+			_, size := utf8.DecodeRune(data[start:])
+			start += size
+		}
+		// The position of an anchored scalar is that of its "&anchor".
+		if p.node.Anchor != "" {
+			anchor := "&" + p.node.Anchor
+			if !strings.HasPrefix(string(data[start:]), anchor) {
+				return nil, errNotPatchable
+			}
+			start += len(anchor)
+			for start < len(data) && (data[start] == ' ' || data[start] == '\t') {
+				start++
+			}
+		}
+		end, ok := scalarEnd(data, start, p.node)
+		if !ok {
+			return nil, errNotPatchable
+		}
+		text := p.value
+		if !p.literal {
+			text = formatScalar(p.node, p.value)
+		}
+		edits = append(edits, edit{start: start, end: end, text: text})
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte(nil), data...)
+	for i, e := range edits {
+		if i > 0 && e.end > edits[i-1].start {
+			return nil, errNotPatchable
+		}
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return out, nil
+}
+
+// scalarEnd returns the offset just past the scalar node starting at start in
+// data, for single-line plain and quoted scalars.
+func scalarEnd(data []byte, start int, node *yamlv3.Node) (int, bool) {
+	switch node.Style {
+	case 0:
+		end := start + len(node.Value)
+		if end > len(data) || string(data[start:end]) != node.Value {
+			return 0, false
+		}
+		return end, true
+	case yamlv3.DoubleQuotedStyle:
+		if start >= len(data) || data[start] != '"' {
+			return 0, false
+		}
+		for i := start + 1; i < len(data) && data[i] != '\n'; i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, true
+			}
+		}
+	case yamlv3.SingleQuotedStyle:
+		if start >= len(data) || data[start] != '\'' {
+			return 0, false
+		}
+		for i := start + 1; i < len(data) && data[i] != '\n'; i++ {
+			if data[i] == '\'' {
+				if i+1 < len(data) && data[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// yaml11BoolsAndNulls are the plain scalars YAML 1.1 parsers, such as the one
+// Helm uses, read as a bool or null although YAML 1.2 reads them as strings.
+var yaml11BoolsAndNulls = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"n": true, "N": true, "no": true, "No": true, "NO": true,
+	"true": true, "True": true, "TRUE": true, "false": true, "False": true, "FALSE": true,
+	"on": true, "On": true, "ON": true, "off": true, "Off": true, "OFF": true,
+	"~": true, "null": true, "Null": true, "NULL": true,
+}
+
+// formatScalar renders the string value in the style of node. A plain scalar
+// stays plain only if value reads back as the same string, under YAML 1.1 as
+// well, so a tag such as "1.10" does not turn into a number and "on" does not
+// turn into a bool; otherwise it is double-quoted.
+func formatScalar(node *yamlv3.Node, value string) string {
+	switch node.Style {
+	case yamlv3.SingleQuotedStyle:
+		if !strings.ContainsAny(value, "\n") {
+			return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+		}
+	case 0:
+		var parsed yamlv3.Node
+		if value != "" && !yaml11BoolsAndNulls[value] && yamlv3.Unmarshal([]byte(value), &parsed) == nil {
+			if root := yamlDocumentRoot(&parsed); root.Kind == yamlv3.ScalarNode && root.Style == 0 &&
+				root.Value == value && root.ShortTag() == "!!str" {
+				return value
+			}
+		}
+	}
+	var quoted strings.Builder
+	enc := json.NewEncoder(&quoted)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(value)
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
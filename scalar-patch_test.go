@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// unorderedManifest has keys out of alphabetical order, comments, numbers and
+// quoted scalars that a re-encode would rewrite.
+const unorderedManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app # the app
+spec:
+  interval: 5m
+  chart:
+    spec:
+      chart: my-chart
+      version: "1.0.0"
+  values:
+    # API image
+    image:
+      tag: 1.7.99 # pinned
+      repository: ghcr.io/my-org/my-api
+    service:
+      port: 8080
+      ratio: 0.5e3
+    images:
+      web: 'ghcr.io/my-org/web-app:1.7.99'
+      worker: "ghcr.io/my-org/worker:1.7.99"
+    legacy:
+      repository: ghcr.io/my-org/legacy
+      tag: "1.9.0"
+`
+
+// TestBumpKeepsUntouchedValues verifies that a bump only rewrites the changed
+// scalars, keeping order, comments, number formats and quoting elsewhere.
+func TestBumpKeepsUntouchedValues(t *testing.T) {
+	updates := map[string]string{
+		"ghcr.io/my-org/my-api":  "1.8.0",
+		"ghcr.io/my-org/web-app": "1.8.0",
+		"ghcr.io/my-org/worker":  "1.8.0",
+		"ghcr.io/my-org/legacy":  "1.10.0",
+	}
+	result, err := bumpHelmReleaseData([]byte(unorderedManifest), updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := unorderedManifest
+	for old, new := range map[string]string{
+		"tag: 1.7.99 # pinned":            "tag: 1.8.0 # pinned",
+		"'ghcr.io/my-org/web-app:1.7.99'": "'ghcr.io/my-org/web-app:1.8.0'",
+		`"ghcr.io/my-org/worker:1.7.99"`:  `"ghcr.io/my-org/worker:1.8.0"`,
+		`tag: "1.9.0"`:                    `tag: "1.10.0"`,
+	} {
+		want = strings.Replace(want, old, new, 1)
+	}
+	if string(result.Output) != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", result.Output, want)
+	}
+}
+
+// TestBumpReencodesWhenNotPatchable verifies the fallback to re-encoding the
+// manifest for values that cannot be rewritten in place.
+func TestBumpReencodesWhenNotPatchable(t *testing.T) {
+	data := strings.Replace(unorderedManifest, "tag: 1.7.99 # pinned", "tag: >-\n        1.7.99", 1)
+	result, err := bumpHelmReleaseData([]byte(data), map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := string(result.Output)
+	if !strings.Contains(out, "tag: 1.8.0") || strings.Contains(out, "# API image") {
+		t.Errorf("Expected a re-encoded manifest, got:\n%s", out)
+	}
+}
+
+// anchoredManifest shares image references through YAML anchors, aliases and
+// merge keys.
+const anchoredManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    images:
+      api: &api ghcr.io/my-org/my-api:1.7.99
+    worker:
+      image: *api
+    defaults: &defaults
+      image:
+        repository: ghcr.io/my-org/web-app
+        tag: &webTag "1.7.99"
+    web:
+      <<: *defaults
+      replicas: 2
+    canary:
+      image:
+        repository: ghcr.io/my-org/web-app
+        tag: *webTag
+`
+
+// TestBumpKeepsAnchors verifies that a scalar shared through anchors, aliases
+// and merge keys is rewritten once, at its anchor, keeping the aliases.
+func TestBumpKeepsAnchors(t *testing.T) {
+	result, err := bumpHelmReleaseData([]byte(anchoredManifest), map[string]string{
+		"ghcr.io/my-org/my-api":  "1.8.0",
+		"ghcr.io/my-org/web-app": "1.8.0",
+	}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if paths := changePaths(result.Changes); !reflect.DeepEqual(paths, []string{"images.api", "defaults.image.tag"}) {
+		t.Errorf("Expected one change per shared value, at its anchor, got: %v", paths)
+	}
+	want := strings.NewReplacer("my-api:1.7.99", "my-api:1.8.0", `&webTag "1.7.99"`, `&webTag "1.8.0"`).Replace(anchoredManifest)
+	if string(result.Output) != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", result.Output, want)
+	}
+
+	// Bumping only an alias still changes the anchored scalar it shares.
+	result, err = bumpHelmReleaseData([]byte(anchoredManifest), map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{Paths: []string{"worker.image"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := strings.Replace(anchoredManifest, "my-api:1.7.99", "my-api:1.8.0", 1); string(result.Output) != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", result.Output, want)
+	}
+	if paths := changePaths(result.Changes); !reflect.DeepEqual(paths, []string{"images.api"}) {
+		t.Errorf("Expected the change at the anchor, got: %v", paths)
+	}
+}
+
+// changePaths returns the paths of changes, in order.
+func changePaths(changes []tagChange) []string {
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
+
+// TestBumpReportsAnchorOnce verifies that a value used through several
+// aliases is bumped, logged and reported once.
+func TestBumpReportsAnchorOnce(t *testing.T) {
+	data := strings.Replace(chartRefHelmRelease, `      tag: "1.25.0"
+`, `      tag: &img "1.25.0"
+    sidecar:
+      repository: nginx
+      tag: *img
+    jobs:
+      - image:
+          repository: nginx
+          tag: *img
+      - image:
+          repository: nginx
+          tag: *img
+`, 1)
+
+	var buf bytes.Buffer
+	out := logOut
+	logOut = &buf
+	defer func() { logOut = out }()
+
+	result, err := bumpHelmReleaseData([]byte(data), map[string]string{"nginx": "1.26.0"}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []tagChange{{Image: "nginx", Path: "image.tag", OldValue: "1.25.0", NewValue: "1.26.0"}}
+	if result.Updated != 1 || !reflect.DeepEqual(result.Changes, want) {
+		t.Errorf("Expected a single change at the anchor, got: %+v", result.Changes)
+	}
+	if n := strings.Count(buf.String(), "Bumped"); n != 1 {
+		t.Errorf("Expected one log line for the shared tag, got %d:\n%s", n, buf.String())
+	}
+	if want := strings.Replace(data, `&img "1.25.0"`, `&img "1.26.0"`, 1); string(result.Output) != want {
+		t.Errorf("Unexpected output:\n%s\nwant:\n%s", result.Output, want)
+	}
+}
+
+// TestFormatScalar verifies how new values are quoted.
+func TestFormatScalar(t *testing.T) {
+	tests := []struct {
+		old, value, want string
+	}{
+		{"tag: 1.7.99", "1.8.0", "1.8.0"},
+		{"tag: v1", "1.0", `"1.0"`},
+		{"tag: 1.9", "1.10", `"1.10"`},
+		{"tag: 1.9", "1.11", `"1.11"`},
+		{"tag: 'a'", "it's", "'it''s'"},
+		{`tag: "a"`, "b<c", `"b<c"`},
+		{"tag: latest", "true", `"true"`},
+		{"tag: latest", "", `""`},
+		{"tag: latest", "yes", `"yes"`},
+		{"tag: latest", "No", `"No"`},
+		{"tag: latest", "on", `"on"`},
+		{"tag: latest", "OFF", `"OFF"`},
+		{"tag: latest", "y", `"y"`},
+		{"tag: latest", "N", `"N"`},
+		{"tag: latest", "~", `"~"`},
+		{"tag: latest", "Null", `"Null"`},
+		{"tag: latest", "only", "only"},
+	}
+	for _, tt := range tests {
+		var doc yamlv3.Node
+		if err := yamlv3.Unmarshal([]byte(tt.old), &doc); err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.old, err)
+		}
+		if got := formatScalar(yamlMappingValue(yamlDocumentRoot(&doc), "tag"), tt.value); got != tt.want {
+			t.Errorf("formatScalar(%q, %q) = %s, want %s", tt.old, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	scanChartDir    string
+	scanKubeVersion string
+	scanNamespace   string
+	scanStrict      bool
+)
+
+// deprecationFinding is a rendered object that uses a deprecated or removed
+// apiVersion of its kind, see apiDeprecations.
+type deprecationFinding struct {
+	// Template is the template path, e.g. "my-chart/templates/pdb.yaml".
+	Template    string `json:"template"`
+	Kind        string `json:"kind"`
+	Name        string `json:"name,omitempty"`
+	APIVersion  string `json:"apiVersion"`
+	Replacement string `json:"replacement,omitempty"`
+	// DeprecatedIn and RemovedIn are Kubernetes minor versions, e.g. "1.21".
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn"`
+	// Removed is set when the target Kubernetes version no longer serves the
+	// apiVersion, so applying the object fails.
+	Removed bool `json:"removed"`
+}
+
+// Status returns "removed" or "deprecated".
+func (f deprecationFinding) Status() string {
+	if f.Removed {
+		return "removed"
+	}
+	return "deprecated"
+}
+
+// kubeMinorVersion parses a Kubernetes version such as "1.29", "v1.29.3" or
+// "1.29.0-eks" and returns its major and minor version.
+func kubeMinorVersion(version string) (*semver.Version, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version %q: %w", version, err)
+	}
+	return semver.New(v.Major(), v.Minor(), 0, "", ""), nil
+}
+
+// kubeCapabilities returns the capabilities of a cluster running the
+// Kubernetes version kubeVersion, for charts that pick their apiVersions with
+// .Capabilities: Helm's defaults with that KubeVersion, the kinds of
+// apiDeprecations as "<apiVersion>/<kind>" while served, and without the
+// group versions all of whose kinds it lists are removed.
+func kubeCapabilities(kubeVersion *semver.Version) (*chartutil.Capabilities, error) {
+	kv, err := chartutil.ParseKubeVersion(kubeVersion.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version %s: %w", kubeVersion, err)
+	}
+	caps := chartutil.DefaultCapabilities.Copy()
+	caps.KubeVersion = *kv
+
+	// served records, per group version of apiDeprecations, whether any of
+	// its kinds is still served.
+	served := map[string]bool{}
+	var kinds chartutil.VersionSet
+	for _, d := range apiDeprecations {
+		removedIn, err := kubeMinorVersion(d.RemovedIn)
+		if err != nil {
+			return nil, err
+		}
+		if d.Replacement != "" && !kinds.Has(d.Replacement+"/"+d.Kind) {
+			kinds = append(kinds, d.Replacement+"/"+d.Kind)
+		}
+		if kubeVersion.LessThan(removedIn) {
+			served[d.APIVersion] = true
+			kinds = append(kinds, d.APIVersion+"/"+d.Kind)
+		} else if !served[d.APIVersion] {
+			served[d.APIVersion] = false
+		}
+	}
+	var versions chartutil.VersionSet
+	for _, v := range caps.APIVersions {
+		if isServed, listed := served[v]; !listed || isServed {
+			versions = append(versions, v)
+		}
+	}
+	caps.APIVersions = append(versions, kinds...)
+	return caps, nil
+}
+
+// ScanDeprecations returns the objects of the rendered manifests whose
+// apiVersion is deprecated or removed in the Kubernetes version kubeVersion,
+// in template order. Objects that use an apiVersion deprecated in a later
+// version are not reported.
+//
+// Parameters:
+//   - manifests: The rendered templates, e.g. from renderHelmRelease.
+//   - kubeVersion: The Kubernetes version of the target cluster.
+//
+// Returns:
+//   - The deprecated and removed objects.
+//   - An error if a rendered document is not valid YAML.
+func ScanDeprecations(manifests []renderedManifest, kubeVersion *semver.Version) ([]deprecationFinding, error) {
+	findings := []deprecationFinding{}
+	for _, m := range manifests {
+		for _, doc := range splitYAMLDocuments([]byte(m.Content)) {
+			var obj struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Metadata   struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}
+			if err := yaml.Unmarshal(doc, &obj); err != nil {
+				return nil, fmt.Errorf("%s: invalid rendered YAML: %w", m.Name, err)
+			}
+			d := findAPIDeprecation(obj.Kind, obj.APIVersion)
+			if d == nil {
+				continue
+			}
+			deprecatedIn, err := kubeMinorVersion(d.DeprecatedIn)
+			if err != nil {
+				return nil, err
+			}
+			removedIn, err := kubeMinorVersion(d.RemovedIn)
+			if err != nil {
+				return nil, err
+			}
+			if kubeVersion.LessThan(deprecatedIn) {
+				continue
+			}
+			findings = append(findings, deprecationFinding{
+				Template:     m.Name,
+				Kind:         d.Kind,
+				Name:         obj.Metadata.Name,
+				APIVersion:   d.APIVersion,
+				Replacement:  d.Replacement,
+				DeprecatedIn: d.DeprecatedIn,
+				RemovedIn:    d.RemovedIn,
+				Removed:      !kubeVersion.LessThan(removedIn),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// writeDeprecationTable prints findings as an aligned table.
+func writeDeprecationTable(w io.Writer, findings []deprecationFinding) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEMPLATE\tKIND\tNAME\tAPIVERSION\tSTATUS\tREPLACEMENT")
+	for _, f := range findings {
+		status := fmt.Sprintf("%s in %s", f.Status(), f.DeprecatedIn)
+		if f.Removed {
+			status = fmt.Sprintf("%s in %s", f.Status(), f.RemovedIn)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Template, f.Kind, dashIfEmpty(f.Name), f.APIVersion, status, dashIfEmpty(f.Replacement))
+	}
+	return tw.Flush()
+}
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan what a HelmRelease deploys for problems",
+}
+
+var scanDeprecationsCmd = &cobra.Command{
+	Use:   "deprecations",
+	Short: "Find deprecated and removed Kubernetes APIs in a HelmRelease's rendered chart",
+	Long: `Render a local copy of a HelmRelease's chart with its .spec.values for a
+cluster running --k8s-version, and report every object that uses a deprecated
+or removed apiVersion of its kind, so a cluster upgrade is not blocked by Flux
+failing to apply the release.
+
+The chart sees the Kubernetes version in .Capabilities.KubeVersion, and
+.Capabilities.APIVersions lacks the apiVersions removed in it, so charts that
+choose their apiVersions by capability render as they would on the cluster.
+
+The command fails if an object uses an apiVersion the version no longer
+serves, or a deprecated one with --strict.`,
+	Example: `  flux-helpers scan deprecations -f hr.yaml --chart-dir ./chart --k8s-version 1.29
+  flux-helpers scan deprecations -f hr.yaml --chart-dir ./chart --k8s-version 1.32 --strict -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" || scanKubeVersion == "" {
+			return fmt.Errorf("you must specify --file and --k8s-version")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		kubeVersion, err := kubeMinorVersion(scanKubeVersion)
+		if err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+
+		caps, err := kubeCapabilities(kubeVersion)
+		if err != nil {
+			return err
+		}
+		manifests, err := renderHelmRelease(cmd.Context(), filePath, scanChartDir, scanNamespace, caps)
+		if err != nil {
+			return fmt.Errorf("failed to render: %w", err)
+		}
+		findings, err := ScanDeprecations(manifests, kubeVersion)
+		if err != nil {
+			return err
+		}
+
+		if outputFormat == outputJSON {
+			if err := writeJSON(os.Stdout, findings); err != nil {
+				return err
+			}
+		} else if len(findings) > 0 {
+			if err := writeDeprecationTable(os.Stdout, findings); err != nil {
+				return err
+			}
+		}
+		removed := 0
+		for _, f := range findings {
+			if f.Removed {
+				removed++
+			}
+		}
+		version := fmt.Sprintf("%d.%d", kubeVersion.Major(), kubeVersion.Minor())
+		if removed > 0 || (scanStrict && len(findings) > 0) {
+			return fmt.Errorf("%d object(s) use APIs removed and %d use APIs deprecated in Kubernetes %s", removed, len(findings)-removed, version)
+		}
+		if len(findings) > 0 {
+			logf("⚠️ %d object(s) use APIs deprecated in Kubernetes %s\n", len(findings), version)
+			return nil
+		}
+		logf("🎉 %s uses no deprecated APIs in Kubernetes %s\n", filePath, version)
+		return nil
+	},
+}
+
+func init() {
+	flags := scanDeprecationsCmd.Flags()
+	flags.StringVarP(&filePath, "file", "f", "", "Path to HelmRelease YAML file")
+	flags.StringVar(&scanChartDir, "chart-dir", "", "Path to the chart directory (or packaged chart) the HelmRelease installs (default: pull the chart of its .spec.chartRef)")
+	flags.StringVar(&scanKubeVersion, "k8s-version", "", "Kubernetes version of the target cluster, e.g. 1.29")
+	flags.StringVarP(&scanNamespace, "namespace", "n", "", "Release namespace (default: .spec.targetNamespace or the HelmRelease's namespace)")
+	flags.BoolVar(&scanStrict, "strict", false, "Fail on deprecated APIs too, not only removed ones")
+	flags.StringVarP(&outputFormat, "output", "o", outputText, "Output format: text (a table) or json")
+	scanCmd.AddCommand(scanDeprecationsCmd)
+	rootCmd.AddCommand(scanCmd)
+}
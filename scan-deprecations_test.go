@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestScanDeprecations verifies that the chart is rendered for the target
+// Kubernetes version, so capability checks pick the served apiVersion, and
+// that removed and deprecated apiVersions are reported as such.
+func TestScanDeprecations(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "legacy")
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: legacy\nversion: 0.1.0\n",
+		"templates/pdb.yaml": `{{- if .Capabilities.APIVersions.Has "policy/v1beta1/PodDisruptionBudget" }}
+apiVersion: policy/v1beta1
+{{- else }}
+apiVersion: policy/v1
+{{- end }}
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  minAvailable: 1
+`,
+		"templates/cronjob.yaml": `apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: {{ .Release.Name }}-cleanup
+spec:
+  schedule: "@daily"
+---
+apiVersion: flowcontrol.apiserver.k8s.io/v1beta3
+kind: FlowSchema
+metadata:
+  name: {{ .Release.Name }}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(version string) []deprecationFinding {
+		t.Helper()
+		kubeVersion, err := kubeMinorVersion(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caps, err := kubeCapabilities(kubeVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests, err := renderHelmRelease(context.Background(), "test_files/helmrelease-v2.yaml", dir, "", caps)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		findings, err := ScanDeprecations(manifests, kubeVersion)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return findings
+	}
+
+	findings := scan("v1.22.4")
+	if len(findings) != 2 {
+		t.Fatalf("Expected the CronJob and the PodDisruptionBudget to be deprecated in 1.22, got %+v", findings)
+	}
+	for _, f := range findings {
+		if f.Removed {
+			t.Errorf("Expected %s %s to be deprecated, not removed, in 1.22", f.Kind, f.APIVersion)
+		}
+	}
+
+	findings = scan("1.29")
+	want := map[string]bool{"CronJob": true, "FlowSchema": false}
+	if len(findings) != len(want) {
+		t.Fatalf("Expected the PodDisruptionBudget to render as policy/v1 in 1.29, got %+v", findings)
+	}
+	for _, f := range findings {
+		removed, ok := want[f.Kind]
+		if !ok || f.Removed != removed {
+			t.Errorf("Unexpected finding %+v", f)
+		}
+		if f.Kind == "CronJob" && (f.Name != "my-app-cleanup" || f.Replacement != "batch/v1") {
+			t.Errorf("Expected the CronJob's name and replacement, got %+v", f)
+		}
+	}
+
+	if findings := scan("1.20"); len(findings) != 0 {
+		t.Errorf("Expected nothing deprecated in 1.20, got %+v", findings)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// selectorArg is the --selector of bump.
+	selectorArg string
+	// targetNameArg and targetNamespaceArg are the --target-name and
+	// --target-namespace of bump.
+	targetNameArg      string
+	targetNamespaceArg string
+)
+
+// releaseMetadata is what the HelmRelease filters of bump are matched
+// against.
+type releaseMetadata struct {
+	Name      string
+	Namespace string
+	// Labels holds the labels and annotations, see helmReleaseMetadata.
+	Labels labels.Set
+}
+
+// parseSelector parses a --selector (or the selector of an update set) in
+// kubectl label selector syntax, e.g. "env=prod,tier!=canary". An empty
+// selector selects everything and is returned as nil.
+func parseSelector(s string) (labels.Selector, error) {
+	if s == "" {
+		return nil, nil
+	}
+	selector, err := labels.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+	}
+	return selector, nil
+}
+
+// helmReleaseMetadata returns the name, namespace, labels and annotations of
+// the manifest YAML data. Labels and annotations are returned as one set,
+// which a selector is matched against; a label wins over an annotation with
+// the same key.
+func helmReleaseMetadata(data []byte) releaseMetadata {
+	var meta struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	set := labels.Set{}
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return releaseMetadata{Labels: set}
+	}
+	for k, v := range meta.Metadata.Annotations {
+		set[k] = v
+	}
+	for k, v := range meta.Metadata.Labels {
+		set[k] = v
+	}
+	return releaseMetadata{Name: meta.Metadata.Name, Namespace: meta.Metadata.Namespace, Labels: set}
+}
+
+// validateTargetPattern checks a --target-name or --target-namespace glob.
+func validateTargetPattern(flag, pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", flag, pattern, err)
+	}
+	return nil
+}
+
+// matchesTarget reports whether value matches the glob pattern; an empty
+// pattern matches everything.
+func matchesTarget(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// unselectedReason returns why the filters of opts (--selector,
+// --target-name and --target-namespace) leave out the HelmRelease with meta,
+// or "" if it is to be bumped. A HelmRelease without a namespace only
+// matches an empty --target-namespace.
+func (opts bumpOptions) unselectedReason(meta releaseMetadata) string {
+	switch {
+	case !selects(opts.Selector, meta.Labels):
+		return fmt.Sprintf("does not match selector %s", opts.Selector)
+	case !matchesTarget(opts.TargetName, meta.Name):
+		return fmt.Sprintf("name %q does not match --target-name %s", meta.Name, opts.TargetName)
+	case !matchesTarget(opts.TargetNamespace, meta.Namespace):
+		return fmt.Sprintf("namespace %q does not match --target-namespace %s", meta.Namespace, opts.TargetNamespace)
+	}
+	return ""
+}
+
+// selects reports whether selector matches the metadata; a nil selector
+// matches everything.
+func selects(selector labels.Selector, metadata labels.Set) bool {
+	return selector == nil || selector.Matches(metadata)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestBumpSelector verifies that only HelmReleases whose labels or
+// annotations match the selector are bumped.
+func TestBumpSelector(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	data := []byte(strings.Replace(string(original), "  namespace: apps\n", "  namespace: apps\n  labels:\n    env: staging\n  annotations:\n    team: payments\n", 1))
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+
+	for _, tc := range []struct {
+		selector string
+		bumped   bool
+	}{
+		{"env=staging", true},
+		{"env=staging,team=payments", true},
+		{"env in (prod)", false},
+		{"env!=staging", false},
+	} {
+		t.Run(tc.selector, func(t *testing.T) {
+			selector, err := parseSelector(tc.selector)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			result, err := bumpHelmReleaseData(data, updates, bumpOptions{Selector: selector})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if bumped := result.Updated == 1; bumped != tc.bumped {
+				t.Errorf("Expected bumped=%v, got %+v", tc.bumped, result)
+			}
+			if !tc.bumped && (!result.Unselected || len(result.Skipped) != 1 || result.Skipped[0].Reason != skipUnselected) {
+				t.Errorf("Expected the HelmRelease to be skipped as unselected, got %+v", result)
+			}
+		})
+	}
+
+	if _, err := parseSelector("env==="); err == nil {
+		t.Error("Expected an invalid selector to be rejected")
+	}
+}
+
+// TestBumpTargetFilters verifies that --target-name and --target-namespace
+// restrict bump to the HelmReleases whose name and namespace match.
+func TestBumpTargetFilters(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	meta := helmReleaseMetadata(data)
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+
+	for _, tc := range []struct {
+		name, namespace string
+		bumped          bool
+	}{
+		{meta.Name, "", true},
+		{"", meta.Namespace, true},
+		{meta.Name[:2] + "*", meta.Namespace, true},
+		{"other", "", false},
+		{meta.Name, "other", false},
+	} {
+		t.Run(tc.name+"/"+tc.namespace, func(t *testing.T) {
+			result, err := bumpHelmReleaseData(data, updates, bumpOptions{TargetName: tc.name, TargetNamespace: tc.namespace})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if bumped := result.Updated == 1; bumped != tc.bumped || result.Unselected == tc.bumped {
+				t.Errorf("Expected bumped=%v, got %+v", tc.bumped, result)
+			}
+		})
+	}
+
+	if err := validateUpdateSets([]updateSet{{Files: []string{"hr.yaml"}, Images: updates, TargetName: "api-["}}); err == nil {
+		t.Error("Expected an invalid --target-name glob to be rejected")
+	}
+}
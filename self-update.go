@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+)
+
+// Set at release time with -ldflags "-X main.version=... -X
+// main.releaseSigningKey=...".
+var (
+	// version is the release this binary was built as; "dev" for local
+	// builds.
+	version = "dev"
+	// releaseSigningKey is the base64 Ed25519 public key the checksums file
+	// of a release is signed with.
+	releaseSigningKey = ""
+)
+
+// Release assets self-update downloads besides the binary.
+const (
+	releaseChecksumsAsset = "checksums.txt"
+	releaseSignatureAsset = "checksums.txt.sig"
+)
+
+// releaseChannels are the --channel values of self-update: stable follows
+// full releases, edge also pre-releases.
+var releaseChannels = []string{"stable", "edge"}
+
+var (
+	// releaseAPIURL is the GitHub API URL of the repository releases are
+	// published in.
+	releaseAPIURL = "https://api.github.com/repos/pat-nel87/flux-helpers"
+
+	updateChannel string
+	updateCheck   bool
+	updateForce   bool
+)
+
+// releaseDownloadTimeout bounds a single release download.
+const releaseDownloadTimeout = 5 * time.Minute
+
+// githubRelease is the part of a GitHub release self-update reads.
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Draft      bool   `json:"draft"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the asset called name, or "".
+func (r *githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// releaseAssetName is the name of the release binary for a platform, e.g.
+// flux-helpers_linux_amd64 or flux-helpers_windows_amd64.exe.
+func releaseAssetName(goos, goarch string) string {
+	name := "flux-helpers_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// releaseClient downloads release metadata and assets.
+type releaseClient struct {
+	ctx     context.Context
+	http    *http.Client
+	baseURL string
+}
+
+// get returns the body of url, retried like other remote operations.
+func (c *releaseClient) get(url, accept string) ([]byte, error) {
+	resp, err := doHTTP(c.ctx, c.http, "download "+url, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, c.baseURL) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected response: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease returns the newest release of channel: the latest full
+// release for stable, or the newest release including pre-releases for
+// edge.
+func (c *releaseClient) latestRelease(channel string) (*githubRelease, error) {
+	var releases []githubRelease
+	switch channel {
+	case "stable":
+		data, err := c.get(c.baseURL+"/releases/latest", "application/vnd.github+json")
+		if err != nil {
+			return nil, err
+		}
+		var release githubRelease
+		if err := json.Unmarshal(data, &release); err != nil {
+			return nil, fmt.Errorf("invalid release metadata: %w", err)
+		}
+		releases = append(releases, release)
+	case "edge":
+		data, err := c.get(c.baseURL+"/releases?per_page=20", "application/vnd.github+json")
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &releases); err != nil {
+			return nil, fmt.Errorf("invalid release metadata: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown channel %q (expected %s)", channel, strings.Join(releaseChannels, " or "))
+	}
+	for i := range releases {
+		if !releases[i].Draft {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no %s release found", channel)
+}
+
+// verifyReleaseChecksums checks the Ed25519 signature of the checksums file
+// against the base64 public key.
+func verifyReleaseChecksums(checksums, signature []byte, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release signing key")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, signature) {
+		return fmt.Errorf("the signature of %s does not match the release signing key", releaseChecksumsAsset)
+	}
+	return nil
+}
+
+// verifyReleaseBinary checks that the SHA-256 of binary is listed for name
+// in the checksums file, in the `sha256sum` format.
+func verifyReleaseBinary(checksums []byte, name string, binary []byte) error {
+	sum := sha256.Sum256(binary)
+	want := ""
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			want = fields[0]
+		}
+	}
+	if want == "" {
+		return fmt.Errorf("%s lists no checksum for %s", releaseChecksumsAsset, name)
+	}
+	if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %x", name, want, sum)
+	}
+	return nil
+}
+
+// newerRelease reports whether tag is a newer version than current. A
+// current that is not a version (a local build) is never older.
+func newerRelease(current, tag string) (bool, error) {
+	latest, err := semver.NewVersion(tag)
+	if err != nil {
+		return false, fmt.Errorf("release %q is not a version", tag)
+	}
+	installed, err := semver.NewVersion(current)
+	if err != nil {
+		return false, nil
+	}
+	return latest.GreaterThan(installed), nil
+}
+
+// SelfUpdate replaces the running binary with the latest release of channel
+// for the current platform, after verifying the signature of the release's
+// checksums file and the checksum of the binary.
+//
+// Parameters:
+//   - c: The client to download the release with.
+//   - channel: stable or edge.
+//   - exe: The path of the binary to replace.
+//   - checkOnly: If true, only report whether an update is available.
+//   - force: Install the release even if it is not newer, e.g. over a local
+//     build.
+//
+// Returns:
+//   - The release tag that was (or would be) installed, or "" if the binary
+//     is up to date.
+//   - An error if the release cannot be found, downloaded or verified, or
+//     the binary cannot be replaced.
+func SelfUpdate(c *releaseClient, channel, exe string, checkOnly, force bool) (string, error) {
+	release, err := c.latestRelease(channel)
+	if err != nil {
+		return "", err
+	}
+	newer, err := newerRelease(version, release.TagName)
+	if err != nil {
+		return "", err
+	}
+	if !newer && !force {
+		if _, err := semver.NewVersion(version); err != nil {
+			logf("ℹ️ This is a %s build; pass --force to replace it with %s\n", version, release.TagName)
+		} else {
+			logf("✅ flux-helpers %s is up to date (latest %s release: %s)\n", version, channel, release.TagName)
+		}
+		return "", nil
+	}
+	if checkOnly {
+		logf("⬆️ flux-helpers %s is available (installed: %s)\n", release.TagName, version)
+		return release.TagName, nil
+	}
+
+	if releaseSigningKey == "" {
+		return "", fmt.Errorf("this build has no release signing key, so releases cannot be verified; download %s manually", release.TagName)
+	}
+	name := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	urls := map[string]string{}
+	for _, asset := range []string{name, releaseChecksumsAsset, releaseSignatureAsset} {
+		if urls[asset] = release.assetURL(asset); urls[asset] == "" {
+			return "", fmt.Errorf("release %s has no %s asset", release.TagName, asset)
+		}
+	}
+	checksums, err := c.get(urls[releaseChecksumsAsset], "")
+	if err != nil {
+		return "", err
+	}
+	signature, err := c.get(urls[releaseSignatureAsset], "")
+	if err != nil {
+		return "", err
+	}
+	if err := verifyReleaseChecksums(checksums, signature, releaseSigningKey); err != nil {
+		return "", err
+	}
+	logf("⬇️ Downloading %s %s\n", name, release.TagName)
+	binary, err := c.get(urls[name], "")
+	if err != nil {
+		return "", err
+	}
+	if err := verifyReleaseBinary(checksums, name, binary); err != nil {
+		return "", err
+	}
+
+	if err := replaceExecutable(exe, binary, runtime.GOOS == "windows"); err != nil {
+		return "", err
+	}
+	logf("✅ Updated flux-helpers %s → %s\n", version, release.TagName)
+	return release.TagName, nil
+}
+
+// writeExecutable writes the new binary; tests replace it to inject failures.
+var writeExecutable = writeFileAtomic
+
+// replaceExecutable replaces the binary at exe with binary. With moveAside,
+// as needed on Windows where a running executable cannot be replaced but can
+// be renamed, exe is first renamed to exe.old, and renamed back if the new
+// binary cannot be written, so a failed update never leaves no binary behind.
+func replaceExecutable(exe string, binary []byte, moveAside bool) error {
+	old := exe + ".old"
+	if moveAside {
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("failed to move the old binary aside: %w", err)
+		}
+	}
+	if err := writeExecutable(exe, binary, 0755); err != nil {
+		err = fmt.Errorf("failed to replace %s: %w", exe, err)
+		if moveAside {
+			if rErr := os.Rename(old, exe); rErr != nil {
+				return fmt.Errorf("%w; restoring the old binary from %s also failed: %v", err, old, rErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Replace this binary with the latest release",
+	Long: `Download the latest release binary for this platform, verify the Ed25519
+signature of the release checksums and the checksum of the binary, and replace
+the running binary with it. --channel edge follows pre-releases too.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate this binary: %w", err)
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return fmt.Errorf("failed to locate this binary: %w", err)
+		}
+		c := &releaseClient{ctx: cmd.Context(), http: &http.Client{Timeout: releaseDownloadTimeout}, baseURL: releaseAPIURL}
+		tag, err := SelfUpdate(c, updateChannel, exe, updateCheck, updateForce)
+		if err != nil {
+			return fmt.Errorf("self-update failed: %w", err)
+		}
+		noChangesMade = tag == "" || updateCheck
+		return nil
+	},
+}
+
+func init() {
+	selfUpdateCmd.Flags().StringVar(&updateChannel, "channel", "stable", "Release channel: stable or edge (pre-releases too)")
+	selfUpdateCmd.Flags().BoolVar(&updateCheck, "check", false, "Only report whether a newer release is available")
+	selfUpdateCmd.Flags().BoolVar(&updateForce, "force", false, "Install the latest release even if it is not newer, e.g. over a local build")
+	rootCmd.AddCommand(selfUpdateCmd)
+	rootCmd.Version = version
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// newTestReleases serves a stable v1.2.0 and an edge v1.3.0-rc.1 release of
+// binary, with checksums signed by the returned key unless signature is
+// set.
+func newTestReleases(t *testing.T, binary []byte, signature []byte) (*releaseClient, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	checksums := fmt.Sprintf("%x  %s\n%x  flux-helpers_other_arch\n", sha256.Sum256(binary), name, sha256.Sum256([]byte("other")))
+	if signature == nil {
+		signature = ed25519.Sign(priv, []byte(checksums))
+	}
+
+	var srv *httptest.Server
+	release := func(tag string, prerelease bool) string {
+		return fmt.Sprintf(`{"tag_name":%q,"prerelease":%t,"assets":[
+			{"name":%q,"browser_download_url":"%s/download/%s/bin"},
+			{"name":"checksums.txt","browser_download_url":"%s/download/%s/checksums.txt"},
+			{"name":"checksums.txt.sig","browser_download_url":"%s/download/%s/checksums.txt.sig"}]}`,
+			tag, prerelease, name, srv.URL, tag, srv.URL, tag, srv.URL, tag)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/releases/latest":
+			fmt.Fprint(w, release("v1.2.0", false))
+		case r.URL.Path == "/releases":
+			fmt.Fprintf(w, "[%s,%s]", release("v1.3.0-rc.1", true), release("v1.2.0", false))
+		case strings.HasSuffix(r.URL.Path, "/bin"):
+			w.Write(binary)
+		case strings.HasSuffix(r.URL.Path, "/checksums.txt"):
+			fmt.Fprint(w, checksums)
+		case strings.HasSuffix(r.URL.Path, "/checksums.txt.sig"):
+			w.Write(signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &releaseClient{ctx: context.Background(), http: srv.Client(), baseURL: srv.URL}, pub
+}
+
+// withVersion sets the version and signing key of the binary for the test.
+func withVersion(t *testing.T, v string, key ed25519.PublicKey) {
+	t.Helper()
+	oldVersion, oldKey := version, releaseSigningKey
+	version, releaseSigningKey = v, base64.StdEncoding.EncodeToString(key)
+	t.Cleanup(func() { version, releaseSigningKey = oldVersion, oldKey })
+}
+
+// TestSelfUpdate verifies that a newer release of the channel replaces the
+// binary and an installed latest release does not.
+func TestSelfUpdate(t *testing.T) {
+	c, key := newTestReleases(t, []byte("new binary"), nil)
+	exe := filepath.Join(t.TempDir(), "flux-helpers")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	withVersion(t, "v1.2.0", key)
+	tag, err := SelfUpdate(c, "stable", exe, false, false)
+	if err != nil || tag != "" {
+		t.Fatalf("Expected no update from the latest stable release, got %q, %v", tag, err)
+	}
+	if tag, err := SelfUpdate(c, "edge", exe, true, false); err != nil || tag != "v1.3.0-rc.1" {
+		t.Fatalf("Expected --check to report v1.3.0-rc.1, got %q, %v", tag, err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "old binary" {
+		t.Fatalf("Expected --check to leave the binary alone, got %q", data)
+	}
+
+	tag, err = SelfUpdate(c, "edge", exe, false, false)
+	if err != nil || tag != "v1.3.0-rc.1" {
+		t.Fatalf("Expected an update to v1.3.0-rc.1, got %q, %v", tag, err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "new binary" {
+		t.Errorf("Expected the binary to be replaced, got %q", data)
+	}
+}
+
+// TestSelfUpdateDevBuild verifies that a local build is only replaced with
+// --force.
+func TestSelfUpdateDevBuild(t *testing.T) {
+	c, key := newTestReleases(t, []byte("new binary"), nil)
+	exe := filepath.Join(t.TempDir(), "flux-helpers")
+	os.WriteFile(exe, []byte("dev binary"), 0755)
+	withVersion(t, "dev", key)
+
+	if tag, err := SelfUpdate(c, "stable", exe, false, false); err != nil || tag != "" {
+		t.Fatalf("Expected a dev build not to be replaced, got %q, %v", tag, err)
+	}
+	if tag, err := SelfUpdate(c, "stable", exe, false, true); err != nil || tag != "v1.2.0" {
+		t.Fatalf("Expected --force to install v1.2.0, got %q, %v", tag, err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "new binary" {
+		t.Errorf("Expected the binary to be replaced, got %q", data)
+	}
+}
+
+// TestSelfUpdateVerification verifies that a bad signature or checksum
+// leaves the binary in place.
+func TestSelfUpdateVerification(t *testing.T) {
+	fastRetries(t, 0)
+	for name, setup := range map[string]func() (*releaseClient, ed25519.PublicKey){
+		"signature": func() (*releaseClient, ed25519.PublicKey) {
+			return newTestReleases(t, []byte("new binary"), make([]byte, ed25519.SignatureSize))
+		},
+		"wrong key": func() (*releaseClient, ed25519.PublicKey) {
+			c, _ := newTestReleases(t, []byte("new binary"), nil)
+			other, _, _ := ed25519.GenerateKey(rand.Reader)
+			return c, other
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, key := setup()
+			exe := filepath.Join(t.TempDir(), "flux-helpers")
+			os.WriteFile(exe, []byte("old binary"), 0755)
+			withVersion(t, "v1.0.0", key)
+			if _, err := SelfUpdate(c, "stable", exe, false, false); err == nil || !strings.Contains(err.Error(), "signature") {
+				t.Errorf("Expected a signature error, got %v", err)
+			}
+			if data, _ := os.ReadFile(exe); string(data) != "old binary" {
+				t.Errorf("Expected the binary to be kept, got %q", data)
+			}
+		})
+	}
+
+	checksums := []byte(fmt.Sprintf("%x  flux-helpers_linux_amd64\n", sha256.Sum256([]byte("good"))))
+	if err := verifyReleaseBinary(checksums, "flux-helpers_linux_amd64", []byte("good")); err != nil {
+		t.Errorf("Expected a matching checksum, got %v", err)
+	}
+	if err := verifyReleaseBinary(checksums, "flux-helpers_linux_amd64", []byte("tampered")); err == nil {
+		t.Error("Expected a checksum mismatch")
+	}
+	if err := verifyReleaseBinary(checksums, "flux-helpers_darwin_arm64", []byte("good")); err == nil {
+		t.Error("Expected an error for a platform without a checksum")
+	}
+}
+
+// TestReplaceExecutableRestores verifies that a binary moved aside is renamed
+// back when the new binary cannot be written.
+func TestReplaceExecutableRestores(t *testing.T) {
+	exe := filepath.Join(t.TempDir(), "flux-helpers")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := writeExecutable
+	writeExecutable = func(string, []byte, os.FileMode) error { return errors.New("disk full") }
+	t.Cleanup(func() { writeExecutable = saved })
+
+	err := replaceExecutable(exe, []byte("new binary"), true)
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected the write failure, got %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "old binary" {
+		t.Errorf("Expected the old binary to be restored, got %q", data)
+	}
+	if _, err := os.Stat(exe + ".old"); !os.IsNotExist(err) {
+		t.Errorf("Expected no binary left aside, got %v", err)
+	}
+
+	writeExecutable = saved
+	if err := replaceExecutable(exe, []byte("new binary"), true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "new binary" {
+		t.Errorf("Expected the binary to be replaced, got %q", data)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serveTokenEnv provides the --token of serve, so it does not have to be put
+// on the command line.
+const serveTokenEnv = "FLUX_HELPERS_SERVE_TOKEN"
+
+// maxServeRequestBytes limits the size of request bodies.
+const maxServeRequestBytes = 1 << 20
+
+var (
+	serveAddr       string
+	serveRoot       string
+	serveToken      string
+	serveAccessLog  string
+	serveAllowRepos []string
+)
+
+// serveBumpRequest is the body of POST /bump. Files are relative to the
+// server's --root, or to the root of the Git checkout when Git is set.
+type serveBumpRequest struct {
+	Files       []string          `json:"files"`
+	Images      map[string]string `json:"images,omitempty"`
+	ImagesRegex map[string]string `json:"imagesRegex,omitempty"`
+	Paths       []string          `json:"paths,omitempty"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	Git         *serveGitTarget   `json:"git,omitempty"`
+}
+
+// serveGitTarget asks the server to bump a fresh clone of a repository and
+// push the commit, instead of files below its --root.
+type serveGitTarget struct {
+	URL string `json:"url"`
+	// Branch is checked out; the remote's default branch when empty.
+	Branch string `json:"branch,omitempty"`
+	// PushBranch receives the commit; Branch (or the default branch) when
+	// empty.
+	PushBranch string `json:"pushBranch,omitempty"`
+	// Message is the commit message; it describes the changes when empty.
+	Message string `json:"message,omitempty"`
+}
+
+// serveBumpResponse is the body of a successful POST /bump.
+type serveBumpResponse struct {
+	DryRun bool         `json:"dryRun"`
+	Files  []fileReport `json:"files"`
+	// Commit and Branch are set when changes were pushed to a Git target.
+	Commit string `json:"commit,omitempty"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// serveError is the body of a failed request.
+type serveError struct {
+	Error string `json:"error"`
+}
+
+// accessRecord is written to the access log, one JSON line per request.
+type accessRecord struct {
+	Time       time.Time         `json:"time"`
+	Remote     string            `json:"remote"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Status     int               `json:"status"`
+	DurationMS int64             `json:"durationMs"`
+	Files      []string          `json:"files,omitempty"`
+	Images     map[string]string `json:"images,omitempty"`
+	Repo       string            `json:"repo,omitempty"`
+	DryRun     bool              `json:"dryRun,omitempty"`
+	Changes    int               `json:"changes,omitempty"`
+	Commit     string            `json:"commit,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// bumpServer serves bump and list images over HTTP.
+type bumpServer struct {
+	// root confines the files of requests without a Git target.
+	root  string
+	token string
+	// allowRepos are path.Match patterns of the Git URLs requests may
+	// target; Git targets are refused when it is empty.
+	allowRepos []string
+
+	accessMu sync.Mutex
+	access   io.Writer
+
+	// mu serializes requests, which share the process-wide logging and
+	// metrics state of bump.
+	mu sync.Mutex
+}
+
+// handler returns the routes of the server: POST /bump and GET /images,
+// which require the bearer token, and GET /healthz, which does not.
+func (s *bumpServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /bump", s.handle(s.bump))
+	mux.HandleFunc("GET /images", s.handle(s.images))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// handle wraps an endpoint with authentication, JSON encoding of its result
+// and access logging.
+func (s *bumpServer) handle(endpoint func(r *http.Request, rec *accessRecord) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &accessRecord{Time: start.UTC(), Remote: r.RemoteAddr, Method: r.Method, Path: r.URL.Path}
+
+		status, body := http.StatusUnauthorized, interface{}(serveError{Error: "missing or invalid bearer token"})
+		if s.authorized(r) {
+			s.mu.Lock()
+			status, body = endpoint(r, rec)
+			s.mu.Unlock()
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="flux-helpers"`)
+		}
+		if e, ok := body.(serveError); ok {
+			rec.Error = e.Error
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+
+		rec.Status = status
+		rec.DurationMS = time.Since(start).Milliseconds()
+		s.writeAccess(rec)
+	}
+}
+
+// authorized reports whether r carries the server's bearer token.
+func (s *bumpServer) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// writeAccess appends rec to the access log.
+func (s *bumpServer) writeAccess(rec *accessRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+	_, _ = s.access.Write(append(line, '\n'))
+}
+
+// auditArgs describes req as the arguments of the equivalent bump, for its
+// audit record; the arguments of the server would only reveal its token.
+func (req serveBumpRequest) auditArgs() []string {
+	args := []string{"bump"}
+	for _, file := range req.Files {
+		args = append(args, "--file", file)
+	}
+	for _, image := range sortedKeys(req.Images) {
+		args = append(args, "--set", image+"="+req.Images[image])
+	}
+	for _, regex := range sortedKeys(req.ImagesRegex) {
+		args = append(args, "--set-regex", regex+"="+req.ImagesRegex[regex])
+	}
+	for _, path := range req.Paths {
+		args = append(args, "--path", path)
+	}
+	if req.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if req.Git != nil {
+		args = append(args, "--repo", req.Git.URL)
+	}
+	return args
+}
+
+// bump handles POST /bump.
+//
+// The files a request writes are recorded in the --audit-log as a run of
+// serve, one record per request; a request whose record cannot be written
+// fails.
+func (s *bumpServer) bump(r *http.Request, rec *accessRecord) (status int, body interface{}) {
+	var req serveBumpRequest
+	defer func() {
+		var runErr error
+		if e, ok := body.(serveError); ok {
+			runErr = errors.New(e.Error)
+		}
+		if err := writeAuditLog(req.auditArgs(), runErr, !req.DryRun); err != nil {
+			status, body = http.StatusInternalServerError, serveError{Error: fmt.Sprintf("changes were made, but failed to record them in the audit log: %v", err)}
+		}
+	}()
+
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxServeRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, serveError{Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+	rec.Files, rec.Images, rec.DryRun = req.Files, req.Images, req.DryRun
+
+	root := s.root
+	if req.Git != nil {
+		rec.Repo = req.Git.URL
+		if !s.repoAllowed(req.Git.URL) {
+			return http.StatusForbidden, serveError{Error: fmt.Sprintf("repository %s is not allowed (see --allow-repo)", req.Git.URL)}
+		}
+		dir, err := cloneRepository(r.Context(), req.Git.URL, req.Git.Branch)
+		if err != nil {
+			return http.StatusBadGateway, serveError{Error: err.Error()}
+		}
+		defer os.RemoveAll(dir)
+		root = dir
+	}
+
+	files, err := confinePaths(root, req.Files)
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+	sets := []updateSet{{Files: files, Images: req.Images, ImagesRegex: req.ImagesRegex, Paths: req.Paths}}
+	if err := validateUpdateSets(sets); err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+
+	report, err := runBumpSets(sets, req.DryRun, false)
+	if err != nil {
+		return http.StatusUnprocessableEntity, serveError{Error: relativeError(root, err)}
+	}
+	resp := serveBumpResponse{DryRun: req.DryRun, Files: relativeReports(root, report.Files)}
+	rec.Changes = report.changeCount()
+
+	if req.Git != nil && !req.DryRun && rec.Changes > 0 {
+		resp.Commit, resp.Branch, err = pushBump(r.Context(), root, req.Git, report.Files)
+		if err != nil {
+			return http.StatusBadGateway, serveError{Error: err.Error()}
+		}
+		rec.Commit = resp.Commit
+	}
+	return http.StatusOK, resp
+}
+
+// images handles GET /images?file=...&dir=..., listing the image references
+// of the files (globs allowed) and of the HelmReleases below the directories.
+func (s *bumpServer) images(r *http.Request, rec *accessRecord) (int, interface{}) {
+	query := r.URL.Query()
+	files, err := confinePaths(s.root, query["file"])
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+	dirs, err := confinePaths(s.root, query["dir"])
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+	if len(files)+len(dirs) == 0 {
+		return http.StatusBadRequest, serveError{Error: "file or dir is required"}
+	}
+	matchers, err := setMatchers(query.Get("matcherProfile"), nil)
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+	rec.Files = append(slices.Clone(query["file"]), query["dir"]...)
+
+	files, err = expandFileGlobs(files)
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: relativeError(s.root, err)}
+	}
+	for _, dir := range dirs {
+		found, err := helmReleaseFilesInDir(dir)
+		if err != nil {
+			return http.StatusBadRequest, serveError{Error: relativeError(s.root, err)}
+		}
+		for _, f := range found {
+			files = appendUnique(files, f)
+		}
+	}
+
+	refs := []imageReference{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return http.StatusBadRequest, serveError{Error: relativeError(s.root, err)}
+		}
+		fileRefs, err := listImageReferences(relativePath(s.root, file), data, matchers)
+		if err != nil {
+			return http.StatusUnprocessableEntity, serveError{Error: fmt.Sprintf("%s: %v", relativePath(s.root, file), err)}
+		}
+		refs = append(refs, fileRefs...)
+	}
+	return http.StatusOK, refs
+}
+
+// repoAllowed reports whether url matches an --allow-repo pattern.
+func (s *bumpServer) repoAllowed(url string) bool {
+	for _, pattern := range s.allowRepos {
+		if ok, _ := path.Match(pattern, url); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// confinePaths joins each relative path (or glob) of a request to root,
+// rejecting absolute paths and paths that lead outside root.
+func confinePaths(root string, paths []string) ([]string, error) {
+	var resolved []string
+	for _, p := range paths {
+		if p == "" || filepath.IsAbs(p) || !filepath.IsLocal(p) {
+			return nil, fmt.Errorf("invalid path %q: paths must be relative and stay below the root", p)
+		}
+		resolved = append(resolved, filepath.Join(root, p))
+	}
+	return resolved, nil
+}
+
+// relativePath returns file relative to root, for responses that should not
+// reveal where the server keeps its files.
+func relativePath(root, file string) string {
+	if rel, err := filepath.Rel(root, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// relativeReports returns the reports with their files relative to root.
+func relativeReports(root string, reports []fileReport) []fileReport {
+	out := make([]fileReport, len(reports))
+	for i, r := range reports {
+		r.File = relativePath(root, r.File)
+		out[i] = r
+	}
+	return out
+}
+
+// relativeError returns the message of err with root removed from the paths
+// it mentions.
+func relativeError(root string, err error) string {
+	return strings.ReplaceAll(err.Error(), root+string(filepath.Separator), "")
+}
+
+// cloneRepository makes a shallow clone of branch (or the default branch) of
+// url in a new temporary directory, which the caller removes.
+func cloneRepository(ctx context.Context, url, branch string) (string, error) {
+	dir, err := os.MkdirTemp("", "flux-helpers-serve-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	if _, err := runGitRemote(ctx, "", append(args, "--", url, dir)...); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to clone %s: %v", url, err)
+	}
+	return dir, nil
+}
+
+// pushBump commits the changed files of the checkout at dir and pushes the
+// commit to the target's push branch.
+//
+// Returns the commit SHA and the branch it was pushed to.
+func pushBump(ctx context.Context, dir string, target *serveGitTarget, files []fileReport) (string, string, error) {
+	branch := target.PushBranch
+	if branch == "" {
+		branch = target.Branch
+	}
+	if branch == "" {
+		var err error
+		if branch, err = currentBranch(dir); err != nil {
+			return "", "", err
+		}
+	}
+	message := target.Message
+	if message == "" {
+		message = defaultCommitMessage(relativeReports(dir, files))
+	}
+	sha, err := gitCommitFiles(changedFiles(files), message, commitSigning{})
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := runGitRemote(ctx, dir, "push", "--quiet", "origin", "HEAD:refs/heads/"+branch); err != nil {
+		return "", "", fmt.Errorf("git push failed: %w", err)
+	}
+	logf("⬆️ Pushed %s to %s of %s\n", shortSHA(sha), branch, target.URL)
+	return sha, branch, nil
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve bump and list images as an HTTP API",
+	Long: "Run an HTTP server exposing POST /bump and GET /images, so platforms can " +
+		"trigger bumps without shelling out. Requests authenticate with a bearer token " +
+		"and are recorded in an access log; files they change are also recorded in " +
+		"the --audit-log of every command.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token := serveToken
+		if token == "" {
+			token = os.Getenv(serveTokenEnv)
+		}
+		if token == "" {
+			return fmt.Errorf("--token (or $%s) is required", serveTokenEnv)
+		}
+		root, err := filepath.Abs(serveRoot)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range serveAllowRepos {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid --allow-repo %q: %w", pattern, err)
+			}
+		}
+
+		var access io.Writer = os.Stderr
+		if serveAccessLog != "" {
+			f, err := os.OpenFile(serveAccessLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open access log: %w", err)
+			}
+			defer f.Close()
+			access = f
+		}
+
+		srv := &http.Server{
+			Addr:              serveAddr,
+			Handler:           (&bumpServer{root: root, token: token, allowRepos: serveAllowRepos, access: access}).handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdown)
+		}()
+
+		logf("🌐 Serving %s on %s\n", root, serveAddr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&serveRoot, "root", ".", "Directory that request file paths are relative to and confined below")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer token clients must send (default: $"+serveTokenEnv+")")
+	serveCmd.Flags().StringVar(&serveAccessLog, "access-log", "", "Append a JSON line per request to this file (default: stderr)")
+	serveCmd.Flags().StringArrayVar(&serveAllowRepos, "allow-repo", nil, "Git URL (or glob) that POST /bump may clone and push to (repeatable; none by default)")
+	rootCmd.AddCommand(serveCmd)
+}
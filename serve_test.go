@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const serveManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.0
+`
+
+// newTestServer serves a directory holding apps/hr.yaml and returns the
+// server, the directory and the access log.
+func newTestServer(t *testing.T, allowRepos ...string) (*httptest.Server, string, *bytes.Buffer) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "apps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "apps", "hr.yaml"), []byte(serveManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	access := &bytes.Buffer{}
+	srv := httptest.NewServer((&bumpServer{root: root, token: "secret", allowRepos: allowRepos, access: access}).handler())
+	t.Cleanup(srv.Close)
+	return srv, root, access
+}
+
+// serveRequest sends a request with the test token and decodes the JSON
+// response into out.
+func serveRequest(t *testing.T, method, url, body string, out interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestServeBump verifies POST /bump and GET /images on files below the root,
+// authentication and the access log.
+func TestServeBump(t *testing.T) {
+	srv, root, access := newTestServer(t)
+
+	resp, err := http.Post(srv.URL+"/bump", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	var result serveBumpResponse
+	status := serveRequest(t, http.MethodPost, srv.URL+"/bump", `{"files":["apps/*.yaml"],"images":{"ghcr.io/my-org/my-api":"1.8.0"}}`, &result)
+	if status != http.StatusOK || len(result.Files) != 1 || result.Files[0].File != "apps/hr.yaml" || len(result.Files[0].Changes) != 1 {
+		t.Fatalf("Unexpected response %d: %+v", status, result)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "apps", "hr.yaml")); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected the file to be bumped, got:\n%s", data)
+	}
+
+	var refs []imageReference
+	if status := serveRequest(t, http.MethodGet, srv.URL+"/images?dir=apps", "", &refs); status != http.StatusOK || len(refs) != 1 || refs[0].Tag != "1.8.0" {
+		t.Errorf("Unexpected images response %d: %+v", status, refs)
+	}
+
+	var failure serveError
+	if status := serveRequest(t, http.MethodPost, srv.URL+"/bump", `{"files":["../hr.yaml"],"images":{"a":"1"}}`, &failure); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a path outside the root, got %d: %+v", status, failure)
+	}
+	if status := serveRequest(t, http.MethodPost, srv.URL+"/bump", `{"files":["apps/hr.yaml"],"images":{"a":"1"},"git":{"url":"https://example.com/repo.git"}}`, &failure); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a repository that is not allowed, got %d: %+v", status, failure)
+	}
+
+	var records []accessRecord
+	for _, line := range strings.Split(strings.TrimSpace(access.String()), "\n") {
+		var rec accessRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Invalid access log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 5 || records[0].Status != http.StatusUnauthorized || records[1].Changes != 1 || records[4].Repo != "https://example.com/repo.git" {
+		t.Errorf("Unexpected access log:\n%s", access)
+	}
+}
+
+// TestServeAuditLog verifies that a bump request that changes files is
+// recorded in the audit log of the command with only its own files, and
+// with its own arguments instead of the server's.
+func TestServeAuditLog(t *testing.T) {
+	oldPath := auditLogPath
+	auditLogPath = filepath.Join(t.TempDir(), "audit.jsonl")
+	auditTrail.files = nil
+	defer func() {
+		auditLogPath = oldPath
+		auditTrail.files = nil
+	}()
+	srv, root, _ := newTestServer(t)
+
+	for _, tag := range []string{"1.8.0", "1.8.0", "1.9.0"} {
+		body := `{"files":["apps/hr.yaml"],"images":{"ghcr.io/my-org/my-api":"` + tag + `"}}`
+		if status := serveRequest(t, http.MethodPost, srv.URL+"/bump", body, nil); status != http.StatusOK {
+			t.Fatalf("Unexpected status %d", status)
+		}
+	}
+
+	data, err := os.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per request that changed files, got:\n%s", data)
+	}
+	for i, line := range lines {
+		var record commandAuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		if record.Outcome != "success" || len(record.Files) != 1 || record.Files[0].Path != filepath.Join(root, "apps", "hr.yaml") {
+			t.Errorf("Unexpected record: %+v", record)
+		}
+		tag := []string{"1.8.0", "1.9.0"}[i]
+		if want := []string{"bump", "--file", "apps/hr.yaml", "--set", "ghcr.io/my-org/my-api=" + tag}; !reflect.DeepEqual(record.Args, want) {
+			t.Errorf("Expected args %v, got %v", want, record.Args)
+		}
+	}
+}
+
+// initTestRemote returns a bare repository whose app.yaml is manifest, and
+// sets up the environment for commits in clones of it.
+func initTestRemote(t *testing.T, manifest string) string {
+	file := initTestRepo(t)
+	work := filepath.Dir(file)
+	if err := os.WriteFile(file, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	for _, args := range [][]string{
+		{"-C", work, "commit", "--quiet", "-am", "add release"},
+		{"clone", "--quiet", "--bare", work, remote},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	return remote
+}
+
+// TestServeBumpGit verifies that a Git target is cloned, bumped, committed
+// and pushed.
+func TestServeBumpGit(t *testing.T) {
+	remote := initTestRemote(t, serveManifest)
+	srv, _, _ := newTestServer(t, filepath.Dir(remote)+"/*.git")
+	var result serveBumpResponse
+	body := `{"files":["app.yaml"],"images":{"ghcr.io/my-org/my-api":"1.8.0"},"git":{"url":"` + remote + `","pushBranch":"bump/my-api"}}`
+	if status := serveRequest(t, http.MethodPost, srv.URL+"/bump", body, &result); status != http.StatusOK {
+		t.Fatalf("Unexpected status %d", status)
+	}
+	if result.Commit == "" || result.Branch != "bump/my-api" {
+		t.Fatalf("Expected a pushed commit, got: %+v", result)
+	}
+	out, err := exec.Command("git", "-C", remote, "show", "bump/my-api:app.yaml").Output()
+	if err != nil || !strings.Contains(string(out), "tag: 1.8.0") {
+		t.Errorf("Expected the bump on the pushed branch, got: %v\n%s", err, out)
+	}
+	if out, _ := exec.Command("git", "-C", remote, "log", "-1", "--format=%B", "bump/my-api").Output(); !strings.Contains(string(out), "- app.yaml: image.tag") {
+		t.Errorf("Expected the commit message to name files relative to the repository, got:\n%s", out)
+	}
+}
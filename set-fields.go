@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxReleaseNameLength is the longest .spec.releaseName Flux accepts, as Helm
+// release names are used in labels and Secret names.
+const maxReleaseNameLength = 53
+
+var (
+	setInterval        string
+	setTargetNamespace string
+	setReleaseName     string
+	setInstallRetries  int
+	setUpgradeRetries  int
+	setDiff            bool
+)
+
+// helmReleaseSettings describes an edit of the fields of a HelmRelease outside
+// .spec.values. Empty strings and nil retries are left unchanged.
+type helmReleaseSettings struct {
+	Interval        string
+	TargetNamespace string
+	ReleaseName     string
+	InstallRetries  *int
+	UpgradeRetries  *int
+}
+
+// helmReleaseField is a field to set: its path below the manifest root and
+// its new value, written as a number when number is set.
+type helmReleaseField struct {
+	path   []string
+	value  string
+	number bool
+}
+
+// fields returns the fields s sets, in a stable order.
+func (s helmReleaseSettings) fields() []helmReleaseField {
+	var fields []helmReleaseField
+	add := func(value string, number bool, path ...string) {
+		if value != "" {
+			fields = append(fields, helmReleaseField{path: path, value: value, number: number})
+		}
+	}
+	retries := func(n *int) string {
+		if n == nil {
+			return ""
+		}
+		return strconv.Itoa(*n)
+	}
+	add(s.Interval, false, "spec", "interval")
+	add(s.TargetNamespace, false, "spec", "targetNamespace")
+	add(s.ReleaseName, false, "spec", "releaseName")
+	add(retries(s.InstallRetries), true, "spec", "install", "remediation", "retries")
+	add(retries(s.UpgradeRetries), true, "spec", "upgrade", "remediation", "retries")
+	return fields
+}
+
+// validate checks the new values as Flux would: the interval must be a
+// duration, the target namespace a DNS label, the release name a DNS
+// subdomain of at most maxReleaseNameLength characters, and retries must not
+// be negative (-1 means retry forever).
+func (s helmReleaseSettings) validate() error {
+	if s.Interval != "" {
+		if d, err := time.ParseDuration(s.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid --interval %q (expected a positive duration such as 10m)", s.Interval)
+		}
+	}
+	if s.TargetNamespace != "" {
+		if errs := validation.IsDNS1123Label(s.TargetNamespace); len(errs) > 0 {
+			return fmt.Errorf("invalid --target-namespace %q: %s", s.TargetNamespace, strings.Join(errs, "; "))
+		}
+	}
+	if s.ReleaseName != "" {
+		if errs := validation.IsDNS1123Subdomain(s.ReleaseName); len(errs) > 0 {
+			return fmt.Errorf("invalid --release-name %q: %s", s.ReleaseName, strings.Join(errs, "; "))
+		}
+		if len(s.ReleaseName) > maxReleaseNameLength {
+			return fmt.Errorf("invalid --release-name %q: must be no more than %d characters", s.ReleaseName, maxReleaseNameLength)
+		}
+	}
+	for flag, n := range map[string]*int{"install-retries": s.InstallRetries, "upgrade-retries": s.UpgradeRetries} {
+		if n != nil && *n < -1 {
+			return fmt.Errorf("invalid --%s %d (expected -1 or more)", flag, *n)
+		}
+	}
+	if len(s.fields()) == 0 {
+		return fmt.Errorf("nothing to set (expected --interval, --target-namespace, --release-name, --install-retries or --upgrade-retries)")
+	}
+	return nil
+}
+
+// setHelmReleaseFields sets the fields of the HelmRelease manifest data.
+// When every field already exists as a scalar, only those scalars are
+// rewritten, so the rest of the file keeps its formatting; fields that have
+// to be added are inserted into the parsed document, which is encoded again
+// (keeping comments and key order), or as JSON for a JSON manifest.
+//
+// Returns:
+//   - The updated manifest, or nil when nothing changes.
+//   - The changes; Image holds "HelmRelease/<name>" and Path the field, e.g.
+//     "spec.install.remediation.retries".
+//   - An error if data is not a HelmRelease or a field along a path is not a
+//     mapping.
+func setHelmReleaseFields(data []byte, fields []helmReleaseField) ([]byte, []tagChange, error) {
+	if kind := manifestKind(data); kind != "HelmRelease" {
+		return nil, nil, fmt.Errorf("unexpected kind %q (expected HelmRelease)", kind)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	root := yamlDocumentRoot(&doc)
+	name := yamlMappingValue(yamlMappingValue(root, "metadata"), "name")
+	object := "HelmRelease"
+	if name != nil {
+		object += "/" + name.Value
+	}
+
+	var changes []tagChange
+	var patches []scalarPatch
+	added := false
+	for _, field := range fields {
+		path := strings.Join(field.path, ".")
+		node := root
+		for _, key := range field.path[:len(field.path)-1] {
+			if child := yamlMappingValue(node, key); child != nil && child.Kind != yamlv3.MappingNode {
+				return nil, nil, errorAtNode(child, fmt.Errorf("cannot set %s: %s is not a mapping", path, key))
+			}
+			node = ensureYAMLMapping(node, key)
+		}
+		leaf := field.path[len(field.path)-1]
+		tag := "!!str"
+		if field.number {
+			tag = "!!int"
+		}
+
+		existing := yamlMappingValue(node, leaf)
+		if existing == nil {
+			node.Content = append(node.Content,
+				&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: leaf},
+				&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: tag, Value: field.value})
+			changes = append(changes, tagChange{Image: object, Path: path, NewValue: field.value})
+			added = true
+			continue
+		}
+		if existing.Kind != yamlv3.ScalarNode {
+			return nil, nil, errorAtNode(existing, fmt.Errorf("cannot set %s: it is not a scalar", path))
+		}
+		if existing.Value == field.value {
+			continue
+		}
+		changes = append(changes, tagChange{Image: object, Path: path, OldValue: existing.Value, NewValue: field.value})
+		patches = append(patches, scalarPatch{node: existing, value: field.value, literal: field.number})
+	}
+	if len(changes) == 0 {
+		return nil, nil, nil
+	}
+
+	if !added {
+		out, err := applyScalarPatches(data, patches)
+		if err == nil {
+			return out, changes, nil
+		}
+		if !errors.Is(err, errNotPatchable) {
+			return nil, nil, err
+		}
+	}
+	for _, p := range patches {
+		p.node.Value = p.value
+		if p.literal {
+			p.node.Tag, p.node.Style = "!!int", 0
+		}
+	}
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if isJSONManifest(data) {
+		out, err := encodeJSONManifest(buf.Bytes(), data)
+		return out, changes, err
+	}
+	return detectTextFormat(data).apply(buf.Bytes()), changes, nil
+}
+
+// SetHelmReleaseFile applies settings to the HelmRelease in filePath.
+//
+// The file is written atomically under its advisory lock, unless dryRun is
+// set or nothing changes.
+//
+// Parameters:
+//   - filePath: The path to the HelmRelease manifest.
+//   - settings: The fields to set.
+//   - dryRun: If true, changes are only reported.
+//   - diff: If true, a unified diff of the file is printed when it changes.
+//
+// Returns:
+//   - The changes made (or that would be made), see setHelmReleaseFields.
+//   - An error if settings are invalid, or the file cannot be read, parsed
+//     or written.
+func SetHelmReleaseFile(filePath string, settings helmReleaseSettings, dryRun, diff bool) ([]tagChange, error) {
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		unlock, err := acquireFileLock(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+	out, changes, err := setHelmReleaseFields(data, settings.fields())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	if len(changes) == 0 {
+		logf("✅ %s already has these settings, skipping\n", filePath)
+		return nil, nil
+	}
+
+	for _, c := range changes {
+		if dryRun {
+			logf("[dry-run] Would set %s %s: %s → %s\n", c.Image, c.Path, dashIfEmpty(c.OldValue), c.NewValue)
+		} else {
+			logf("🔁 Set %s %s: %s → %s\n", c.Image, c.Path, dashIfEmpty(c.OldValue), c.NewValue)
+		}
+	}
+	if diff {
+		fmt.Print(unifiedDiff("a/"+filePath, "b/"+filePath, data, out))
+	}
+	if dryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", len(changes))
+		return changes, nil
+	}
+	if err := writeFileWithBackup(filePath, out, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Updated %d field(s) in %s\n", len(changes), filePath)
+	return changes, nil
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set the interval, target namespace, release name or retries of a HelmRelease",
+	Long: `Set the fields of a HelmRelease outside .spec.values that are routinely edited
+by hand: .spec.interval, .spec.targetNamespace, .spec.releaseName and the
+remediation retries of .spec.install and .spec.upgrade. Only the given flags are
+changed; existing fields are rewritten in place and missing ones are added.`,
+	Example: `  flux-helpers set -f clusters/prod/my-app.yaml --interval 10m --upgrade-retries 3
+  flux-helpers set -f hr.yaml --target-namespace apps --release-name my-app --dry-run --diff`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" {
+			return fmt.Errorf("you must specify --file")
+		}
+		settings := helmReleaseSettings{
+			Interval:        setInterval,
+			TargetNamespace: setTargetNamespace,
+			ReleaseName:     setReleaseName,
+		}
+		if cmd.Flags().Changed("install-retries") {
+			settings.InstallRetries = &setInstallRetries
+		}
+		if cmd.Flags().Changed("upgrade-retries") {
+			settings.UpgradeRetries = &setUpgradeRetries
+		}
+
+		changes, err := SetHelmReleaseFile(filePath, settings, dryRun, setDiff)
+		if err != nil {
+			return fmt.Errorf("failed to set fields: %w", err)
+		}
+		noChangesMade = len(changes) == 0
+		return nil
+	},
+}
+
+func init() {
+	flags := setCmd.Flags()
+	flags.StringVarP(&filePath, "file", "f", "", "Path to the HelmRelease manifest")
+	flags.StringVar(&setInterval, "interval", "", "New .spec.interval, e.g. 10m")
+	flags.StringVar(&setTargetNamespace, "target-namespace", "", "New .spec.targetNamespace")
+	flags.StringVar(&setReleaseName, "release-name", "", "New .spec.releaseName")
+	flags.IntVar(&setInstallRetries, "install-retries", 0, "New .spec.install.remediation.retries (-1 to retry forever)")
+	flags.IntVar(&setUpgradeRetries, "upgrade-retries", 0, "New .spec.upgrade.remediation.retries (-1 to retry forever)")
+	flags.BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+	flags.BoolVar(&setDiff, "diff", false, "Print a unified diff of the file when it changes")
+	_ = markLocalSettings(setCmd, "interval", "target-namespace", "release-name", "install-retries", "upgrade-retries")
+	rootCmd.AddCommand(setCmd)
+}
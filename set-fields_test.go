@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSetHelmReleaseFields verifies that existing fields are rewritten in
+// place, that missing ones are added, and that retries are written as
+// numbers.
+func TestSetHelmReleaseFields(t *testing.T) {
+	manifest := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app # keep me
+spec:
+  interval: "5m"
+  upgrade:
+    remediation:
+      retries: 1
+  values:
+    image: {repository: nginx, tag: "1.0.0"}
+`
+	three := 3
+	settings := helmReleaseSettings{Interval: "10m", UpgradeRetries: &three}
+	out, changes, err := setHelmReleaseFields([]byte(manifest), settings.fields())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := strings.Replace(strings.Replace(manifest, `"5m"`, `"10m"`, 1), "retries: 1", "retries: 3", 1)
+	if string(out) != want {
+		t.Errorf("Expected an in-place edit, got:\n%s", out)
+	}
+	if len(changes) != 2 || changes[0].Image != "HelmRelease/app" || changes[1].Path != "spec.upgrade.remediation.retries" || changes[1].OldValue != "1" {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+
+	zero := 0
+	settings = helmReleaseSettings{TargetNamespace: "apps", InstallRetries: &zero}
+	out, changes, err = setHelmReleaseFields([]byte(manifest), settings.fields())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{"  name: app # keep me\n", "  targetNamespace: apps\n", "  install:\n    remediation:\n      retries: 0\n"} {
+		if !strings.Contains(string(out), line) {
+			t.Errorf("Expected %q in:\n%s", line, out)
+		}
+	}
+	if len(changes) != 2 || changes[0].OldValue != "" {
+		t.Errorf("Unexpected changes: %+v", changes)
+	}
+
+	if out, changes, err := setHelmReleaseFields([]byte(manifest), helmReleaseSettings{Interval: "5m"}.fields()); out != nil || changes != nil || err != nil {
+		t.Errorf("Expected no change, got %q, %+v, %v", out, changes, err)
+	}
+	if _, _, err := setHelmReleaseFields([]byte(strings.Replace(manifest, "  upgrade:\n    remediation:\n      retries: 1\n", "  upgrade: true\n", 1)), helmReleaseSettings{UpgradeRetries: &three}.fields()); err == nil {
+		t.Error("Expected a non-mapping parent to be rejected")
+	}
+}
+
+// TestSetHelmReleaseFieldsJSON verifies that JSON manifests stay JSON when
+// fields are added.
+func TestSetHelmReleaseFieldsJSON(t *testing.T) {
+	manifest := `{
+  "apiVersion": "helm.toolkit.fluxcd.io/v2",
+  "kind": "HelmRelease",
+  "metadata": {"name": "app"},
+  "spec": {"interval": "5m"}
+}
+`
+	out, _, err := setHelmReleaseFields([]byte(manifest), helmReleaseSettings{Interval: "1h", ReleaseName: "my-app"}.fields())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !isJSONManifest(out) || !strings.Contains(string(out), `"interval": "1h"`) || !strings.Contains(string(out), `"releaseName": "my-app"`) {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
+
+// TestHelmReleaseSettingsValidate verifies the checks of the new values.
+func TestHelmReleaseSettingsValidate(t *testing.T) {
+	minusTwo := -2
+	for _, invalid := range []helmReleaseSettings{
+		{},
+		{Interval: "soon"},
+		{TargetNamespace: "Apps"},
+		{ReleaseName: strings.Repeat("a", maxReleaseNameLength+1)},
+		{InstallRetries: &minusTwo},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+	forever := -1
+	if err := (helmReleaseSettings{Interval: "1h30m", ReleaseName: "my-app", UpgradeRetries: &forever}).validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
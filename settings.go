@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// globalSettingsEnv overrides the path of the global settings file.
+const globalSettingsEnv = "FLUX_HELPERS_GLOBAL_CONFIG"
+
+// settingsEnvPrefix prefixes the environment variables that set flags, e.g.
+// FLUX_HELPERS_REGISTRY_CONFIG for --registry-config.
+const settingsEnvPrefix = "FLUX_HELPERS_"
+
+// localSettingAnnotation marks flags whose meaning differs from the flags of
+// the same name of other commands, e.g. the --output file of lock next to
+// the --output format of bump. Only the commands section of the settings file
+// sets them.
+const localSettingAnnotation = "flux-helpers/local-setting"
+
+// unsettableFlags are never set by settings: secrets, which have their own
+// environment variables and do not belong in a file, and --help.
+var unsettableFlags = map[string]bool{
+	"help":              true,
+	"registry-password": true,
+	"token":             true,
+	"secret":            true,
+}
+
+// globalSettings holds flag defaults from the global settings file, e.g.:
+//
+//	output: json
+//	registry-config: /etc/flux-helpers/registries.yaml
+//	policy: /etc/flux-helpers/policy.yaml
+//	git-author: CI Bot <ci@example.com>
+//	retries: 5
+//	commands:
+//	  bump:
+//	    check-exists: true
+//	  lock:
+//	    output: images.lock
+//
+// Keys are flag names. Top-level keys apply to every command with the flag,
+// and the keys below a command path (e.g. "bump" or "chart lint") to that
+// command only, taking precedence over the top-level ones. Lists set flags
+// that can be repeated.
+type globalSettings struct {
+	Path     string
+	Defaults map[string]interface{}
+	Commands map[string]map[string]interface{}
+}
+
+// globalSettingsPath returns the path of the global settings file:
+// $FLUX_HELPERS_GLOBAL_CONFIG, otherwise flux-helpers/config.yaml below
+// $XDG_CONFIG_HOME or ~/.config. The second result reports whether the path
+// was set explicitly, in which case the file must exist.
+func globalSettingsPath() (string, bool) {
+	if path := os.Getenv(globalSettingsEnv); path != "" {
+		return path, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "flux-helpers", "config.yaml"), false
+}
+
+// loadGlobalSettings reads the settings file at path and checks that every key
+// is a flag of root or of the command it is listed under.
+//
+// Returns:
+//   - The settings, or nil when the file does not exist and required is
+//     false.
+//   - An error if the file cannot be read or parsed, or names an unknown
+//     command or flag.
+func loadGlobalSettings(path string, required bool, root *cobra.Command) (*globalSettings, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	settings := &globalSettings{Path: path, Defaults: raw, Commands: map[string]map[string]interface{}{}}
+	if commands, ok := raw["commands"]; ok {
+		delete(raw, "commands")
+		sections, ok := commands.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid settings file %s: commands must be a mapping of command paths", path)
+		}
+		for name, section := range sections {
+			keys, ok := section.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid settings file %s: commands.%s must be a mapping of flags", path, name)
+			}
+			settings.Commands[strings.Join(strings.Fields(name), " ")] = keys
+		}
+	}
+	if err := settings.validate(root); err != nil {
+		return nil, fmt.Errorf("invalid settings file %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// validate checks the keys of the settings against the flags of the commands
+// below root.
+func (s *globalSettings) validate(root *cobra.Command) error {
+	known := map[string]bool{}
+	commands := map[string]*cobra.Command{}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		cmd.PersistentFlags().VisitAll(func(f *pflag.Flag) { known[f.Name] = true })
+		commands[settingsCommandName(cmd)] = cmd
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(root)
+
+	for _, key := range sortedKeys(s.Defaults) {
+		if !known[key] || unsettableFlags[key] {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	for _, name := range sortedKeys(s.Commands) {
+		cmd, ok := commands[name]
+		if !ok || name == "" {
+			return fmt.Errorf("unknown command %q", name)
+		}
+		for _, key := range sortedKeys(s.Commands[name]) {
+			if commandFlag(cmd, key) == nil || unsettableFlags[key] {
+				return fmt.Errorf("unknown setting %q for %s", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// settingsCommandName returns the path of cmd below the root command, e.g.
+// "chart lint", as the commands section of the settings file names it.
+func settingsCommandName(cmd *cobra.Command) string {
+	return strings.TrimPrefix(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()), " ")
+}
+
+// commandFlag returns the flag called name of cmd, including the persistent
+// flags it inherits, or nil.
+func commandFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f
+	}
+	for c := cmd; c != nil; c = c.Parent() {
+		if f := c.PersistentFlags().Lookup(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// settingsEnvName returns the environment variable that sets the flag name,
+// e.g. FLUX_HELPERS_CHECK_EXISTS for --check-exists.
+func settingsEnvName(name string) string {
+	return settingsEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applySettings sets the flags of cmd that were not given on the command line
+// from, in order of precedence, their FLUX_HELPERS_* environment variable,
+// the section of cmd in settings and the top-level keys of settings. Flags
+// marked with localSettingAnnotation are only set by the section of cmd. The
+// flags are not marked as changed, so settings rank below command-specific
+// files such as bump --config.
+//
+// Parameters:
+//   - cmd: The command about to run, with its flags parsed.
+//   - settings: The global settings; nil for none.
+//   - lookupEnv: Looks up environment variables, e.g. os.LookupEnv.
+//
+// Returns:
+//   - An error if a value is not valid for its flag.
+func applySettings(cmd *cobra.Command, settings *globalSettings, lookupEnv func(string) (string, bool)) error {
+	var section map[string]interface{}
+	if settings != nil {
+		section = settings.Commands[settingsCommandName(cmd)]
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || unsettableFlags[f.Name] {
+			return
+		}
+		_, local := f.Annotations[localSettingAnnotation]
+		env := settingsEnvName(f.Name)
+		if value, ok := lookupEnv(env); ok && !local {
+			values := []string{value}
+			if _, isSlice := f.Value.(pflag.SliceValue); isSlice {
+				values = strings.Split(value, ",")
+			}
+			if setErr := setFlagValues(f, values); setErr != nil {
+				err = fmt.Errorf("invalid $%s: %w", env, setErr)
+			}
+			return
+		}
+
+		value, ok := section[f.Name]
+		if !ok && !local && settings != nil {
+			value, ok = settings.Defaults[f.Name]
+		}
+		if !ok {
+			return
+		}
+		values, valuesErr := settingValues(value)
+		if valuesErr == nil {
+			valuesErr = setFlagValues(f, values)
+		}
+		if valuesErr != nil {
+			err = fmt.Errorf("invalid setting %q in %s: %w", f.Name, settings.Path, valuesErr)
+		}
+	})
+	return err
+}
+
+// settingValues converts a value of the settings file to flag arguments: a
+// scalar to one argument and a list to one per item.
+func settingValues(value interface{}) ([]string, error) {
+	items, isList := value.([]interface{})
+	if !isList {
+		items = []interface{}{value}
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			values = append(values, v)
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		case nil:
+			values = append(values, "")
+		default:
+			return nil, fmt.Errorf("expected a scalar or a list of scalars")
+		}
+	}
+	return values, nil
+}
+
+// setFlagValues sets f to values, replacing the default of repeatable flags.
+func setFlagValues(f *pflag.Flag, values []string) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.Replace(values)
+	}
+	if len(values) != 1 {
+		return fmt.Errorf("--%s takes a single value", f.Name)
+	}
+	return f.Value.Set(values[0])
+}
+
+// markLocalSettings marks the flags names of cmd with localSettingAnnotation.
+//
+// Returns:
+//   - An error if cmd has no flag of one of the names.
+func markLocalSettings(cmd *cobra.Command, names ...string) error {
+	for _, name := range names {
+		if err := cmd.Flags().SetAnnotation(name, localSettingAnnotation, []string{"true"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// TestApplySettings verifies the precedence of command-line flags, FLUX_HELPERS_*
+// environment variables, command sections and top-level settings, and that
+// flags marked local are only set by their command's section.
+func TestApplySettings(t *testing.T) {
+	var output, policy, lockOutput, author string
+	var retries int
+	var hooks []string
+	root := &cobra.Command{Use: "flux-helpers"}
+	root.PersistentFlags().StringVar(&author, "git-author", "", "")
+	root.PersistentFlags().IntVar(&retries, "retries", 3, "")
+	bump := &cobra.Command{Use: "bump", RunE: func(*cobra.Command, []string) error { return nil }}
+	bump.Flags().StringVarP(&output, "output", "o", outputText, "")
+	bump.Flags().StringVar(&policy, "policy", "", "")
+	bump.Flags().StringArrayVar(&hooks, "post-hook", nil, "")
+	lock := &cobra.Command{Use: "lock", RunE: func(*cobra.Command, []string) error { return nil }}
+	lock.Flags().StringVarP(&lockOutput, "output", "o", "", "")
+	if err := markLocalSettings(lock, "output"); err != nil {
+		t.Fatal(err)
+	}
+	if err := markLocalSettings(lock, "outptu"); err == nil {
+		t.Error("Expected an error for a misspelled flag")
+	}
+	root.AddCommand(bump, lock)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	settings := `output: json
+policy: /etc/policy.yaml
+git-author: CI Bot <ci@example.com>
+retries: 5
+commands:
+  bump:
+    policy: strict.yaml
+    post-hook: [make lint, make test]
+  lock:
+    output: images.lock
+`
+	if err := os.WriteFile(path, []byte(settings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadGlobalSettings(path, true, root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	env := map[string]string{"FLUX_HELPERS_RETRIES": "7"}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := bump.ParseFlags([]string{"--git-author", "Jane <jane@example.com>"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applySettings(bump, cfg, lookupEnv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output != outputJSON || policy != "strict.yaml" || retries != 7 || author != "Jane <jane@example.com>" {
+		t.Errorf("Unexpected bump settings: output=%q policy=%q retries=%d author=%q", output, policy, retries, author)
+	}
+	if !reflect.DeepEqual(hooks, []string{"make lint", "make test"}) {
+		t.Errorf("Expected the post-hook list, got %q", hooks)
+	}
+	if bump.Flags().Changed("output") {
+		t.Error("Expected settings not to mark flags as changed")
+	}
+
+	if err := lock.ParseFlags(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applySettings(lock, cfg, lookupEnv); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lockOutput != "images.lock" {
+		t.Errorf("Expected only the lock section to set lock's --output, got %q", lockOutput)
+	}
+
+	env["FLUX_HELPERS_RETRIES"] = "many"
+	if err := applySettings(lock, cfg, lookupEnv); err == nil || !strings.Contains(err.Error(), "FLUX_HELPERS_RETRIES") {
+		t.Errorf("Expected an invalid environment variable to fail, got %v", err)
+	}
+
+	for _, invalid := range []string{"outptu: json\n", "commands:\n  bunp:\n    output: json\n", "commands:\n  lock:\n    policy: x\n", "token: secret\n"} {
+		if err := os.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadGlobalSettings(path, true, root); err == nil {
+			t.Errorf("Expected settings %q to be rejected", invalid)
+		}
+	}
+	if cfg, err := loadGlobalSettings(filepath.Join(t.TempDir(), "missing.yaml"), false, root); cfg != nil || err != nil {
+		t.Errorf("Expected a missing default settings file to be ignored, got %v, %v", cfg, err)
+	}
+}
+
+// TestReservedEnvNames verifies that no flag reads one of the environment
+// variables flux-helpers sets or reads for another purpose, such as the
+// report of a post-bump hook, which a bump run by the hook would take for
+// its --report.
+func TestReservedEnvNames(t *testing.T) {
+	reserved := map[string]bool{
+		hookChangedFilesEnv: true,
+		hookReportEnv:       true,
+		annotateBuildEnv:    true,
+		globalSettingsEnv:   true,
+		serveTokenEnv:       true,
+		webhookSecretEnv:    true,
+	}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if env := settingsEnvName(f.Name); reserved[env] && !unsettableFlags[f.Name] {
+				t.Errorf("--%s of %s is set by $%s", f.Name, cmd.CommandPath(), env)
+			}
+		})
+		for _, sub := range cmd.Commands() {
+			walk(sub)
+		}
+	}
+	walk(rootCmd)
+}
+
+// TestParseGitAuthor verifies that --git-author is split into its name and
+// email.
+func TestParseGitAuthor(t *testing.T) {
+	name, email, err := parseGitAuthor("CI Bot <ci@example.com>")
+	if err != nil || name != "CI Bot" || email != "ci@example.com" {
+		t.Errorf("Unexpected result: %q %q %v", name, email, err)
+	}
+	for _, invalid := range []string{"ci@example.com", "<ci@example.com>", "CI Bot <>"} {
+		if _, _, err := parseGitAuthor(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
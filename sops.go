@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// sopsMode makes bump decrypt SOPS-encrypted HelmRelease files with the sops
+// binary and write the changes back with `sops set`, which re-encrypts them
+// for the file's own recipients.
+var sopsMode bool
+
+// errSOPSEncrypted is returned for SOPS-encrypted files that would be
+// rewritten: re-encoding them breaks their MAC, and their encrypted values
+// cannot be bumped anyway.
+var errSOPSEncrypted = errors.New("file is SOPS-encrypted, refusing to rewrite it")
+
+// sopsEncrypted reports whether a document of data carries SOPS metadata: a
+// top-level "sops" mapping with a "mac", as written by `sops --encrypt`.
+func sopsEncrypted(data []byte) bool {
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yamlv3.Node
+		if err := dec.Decode(&doc); err != nil {
+			return false
+		}
+		if yamlMappingValue(yamlMappingValue(yamlDocumentRoot(&doc), "sops"), "mac") != nil {
+			return true
+		}
+	}
+}
+
+// refuseSOPS returns errSOPSEncrypted, naming file, if data is SOPS-encrypted.
+func refuseSOPS(file string, data []byte) error {
+	if sopsEncrypted(data) {
+		return fmt.Errorf("%s: %w", file, errSOPSEncrypted)
+	}
+	return nil
+}
+
+// readBumpTarget reads the HelmRelease manifest at file for bump. A
+// SOPS-encrypted file is decrypted with the sops binary when sopsMode is set,
+// and refused otherwise.
+//
+// Returns:
+//   - The (decrypted) manifest.
+//   - Whether the file is SOPS-encrypted, so that changes must be written
+//     with writeSOPSChanges.
+//   - An error if the file cannot be read or decrypted, or is encrypted and
+//     sopsMode is not set.
+func readBumpTarget(file string) ([]byte, bool, error) {
+	data, err := readManifestFile(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !sopsEncrypted(data) {
+		return data, false, nil
+	}
+	if !sopsMode {
+		return nil, false, fmt.Errorf("%w (pass --sops to decrypt and re-encrypt it with the sops binary)", errSOPSEncrypted)
+	}
+	if file == stdioFile {
+		return nil, false, fmt.Errorf("--sops cannot be used with --file %s", stdioFile)
+	}
+	plain, err := runSOPS("--decrypt", file)
+	if err != nil {
+		return nil, false, err
+	}
+	return plain, true, nil
+}
+
+// sopsSetPath returns the `sops set` index of the scalar that change updates
+// in the HelmRelease manifest data, such as ["spec"]["values"]["image"]["tag"].
+// Values paths are relative to .spec.values, post-renderer paths to the
+// manifest. Changes inside strings, such as those of post-renderer patches,
+// have no index.
+func sopsSetPath(data []byte, change tagChange) (string, error) {
+	path := change.Path
+	if !strings.HasPrefix(path, postRenderersPath+".") && !strings.HasPrefix(path, postRenderersPath+"[") {
+		path = joinValuesPath("spec.values", path)
+	}
+	parts := splitValuesPath(path)
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	node := yamlDocumentRoot(&doc)
+	var index strings.Builder
+	for _, part := range parts {
+		if node != nil && node.Kind == yamlv3.AliasNode {
+			node = node.Alias
+		}
+		switch {
+		case node == nil:
+		case node.Kind == yamlv3.MappingNode:
+			node = yamlMappingValue(node, part)
+			key, _ := json.Marshal(part)
+			fmt.Fprintf(&index, "[%s]", key)
+			continue
+		case node.Kind == yamlv3.SequenceNode:
+			if i, ok := listIndex(part); ok && i < len(node.Content) {
+				node = node.Content[i]
+				fmt.Fprintf(&index, "[%d]", i)
+				continue
+			}
+		}
+		node = nil
+		break
+	}
+	if node == nil || node.Kind != yamlv3.ScalarNode || node.Value != change.OldValue {
+		return "", fmt.Errorf("cannot write %s of a SOPS-encrypted file with sops set", change.Path)
+	}
+	return index.String(), nil
+}
+
+// writeSOPSChanges writes changes, computed on data (the decrypted content of
+// file), to the SOPS-encrypted file with one `sops set` per change. sops
+// re-encrypts each value for the recipients in the file's metadata and
+// updates its MAC, and leaves the rest of the file as it is.
+func writeSOPSChanges(file string, data []byte, changes []tagChange) error {
+	var sets [][2]string
+	for _, c := range changes {
+		index, err := sopsSetPath(data, c)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(c.NewValue)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, [2]string{index, string(value)})
+	}
+	if err := backupFile(file); err != nil {
+		return err
+	}
+	before, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	// Record what sops wrote, even if a later set fails.
+	written := 0
+	defer func() {
+		if after, err := os.ReadFile(file); err == nil && written > 0 {
+			recordAuditedFile(file, before, after)
+		}
+	}()
+	for _, set := range sets {
+		if _, err := runSOPS("set", file, set[0], set[1]); err != nil {
+			return err
+		}
+		written++
+	}
+	return nil
+}
+
+// runSOPS runs the sops binary with args and returns its stdout.
+func runSOPS(args ...string) ([]byte, error) {
+	sops, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, fmt.Errorf("--sops needs sops on the PATH: %w", err)
+	}
+	cmd := exec.Command(sops, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sops %s failed: %w: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sopsHelmRelease is a HelmRelease as written by `sops --encrypt` with an
+// encrypted_regex that leaves the image values in the clear.
+const sopsHelmRelease = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.0
+    containers:
+      - name: worker
+        image: ghcr.io/my-org/worker:1.0.0
+    password: ENC[AES256_GCM,data:cGFzcw==,iv:aXY=,tag:dGFn,type:str]
+sops:
+  age:
+    - recipient: age1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq
+  lastmodified: "2026-01-01T00:00:00Z"
+  mac: ENC[AES256_GCM,data:bWFj,iv:aXY=,tag:dGFn,type:str]
+  encrypted_regex: ^password$
+  version: 3.9.0
+`
+
+// fakeSOPS is a sops binary that "decrypts" by dropping the sops metadata
+// and records its set commands next to itself.
+const fakeSOPS = `#!/bin/sh
+case "$1" in
+  --decrypt) sed '/^sops:/,$d' "$2" ;;
+  set) echo "$3 $4" >> "$0.log" ;;
+  *) echo "unexpected arguments: $*" >&2; exit 1 ;;
+esac
+`
+
+// TestSOPSEncryptedRefused verifies that SOPS-encrypted files are detected
+// and left untouched without --sops.
+func TestSOPSEncryptedRefused(t *testing.T) {
+	if !sopsEncrypted([]byte(sopsHelmRelease)) {
+		t.Fatal("Expected the sops metadata to be detected")
+	}
+	if sopsEncrypted([]byte("sops:\n  version: 3.9.0\n")) {
+		t.Error("Expected a sops key without a mac not to count as encrypted")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hr.yaml")
+	if err := os.WriteFile(file, []byte(sopsHelmRelease), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+	if _, err := bumpHelmReleaseFile(file, updates, bumpOptions{}); !errors.Is(err, errSOPSEncrypted) || !strings.Contains(err.Error(), "--sops") {
+		t.Errorf("Expected the encrypted HelmRelease to be refused, got: %v", err)
+	}
+	if _, err := BumpValuesFile(file, updates, bumpOptions{}); !errors.Is(err, errSOPSEncrypted) {
+		t.Errorf("Expected the encrypted values file to be refused, got: %v", err)
+	}
+	if out, _ := os.ReadFile(file); string(out) != sopsHelmRelease {
+		t.Errorf("Expected the file to be left untouched, got:\n%s", out)
+	}
+}
+
+// TestSOPSMode verifies that with --sops the file is decrypted with sops and
+// every change is written back with sops set, which is audited.
+func TestSOPSMode(t *testing.T) {
+	oldPath := auditLogPath
+	auditLogPath = filepath.Join(t.TempDir(), "audit.jsonl")
+	auditTrail.files = nil
+	t.Cleanup(func() {
+		auditLogPath = oldPath
+		auditTrail.files = nil
+	})
+	bin := t.TempDir()
+	sops := filepath.Join(bin, "sops")
+	if err := os.WriteFile(sops, []byte(fakeSOPS), 0755); err != nil {
+		t.Fatalf("Failed to write sops: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	sopsMode = true
+	t.Cleanup(func() { sopsMode = false })
+
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	if err := os.WriteFile(file, []byte(sopsHelmRelease), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0", "ghcr.io/my-org/worker": "1.1.0"}
+	result, err := bumpHelmReleaseFile(file, updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 2 {
+		t.Errorf("Expected 2 updates, got: %+v", result)
+	}
+
+	log, _ := os.ReadFile(sops + ".log")
+	want := `["spec"]["values"]["image"]["tag"] "1.8.0"` + "\n" +
+		`["spec"]["values"]["containers"][0]["image"] "ghcr.io/my-org/worker:1.1.0"` + "\n"
+	if string(log) != want {
+		t.Errorf("Expected sops set calls:\n%s\ngot:\n%s", want, log)
+	}
+	if out, _ := os.ReadFile(file); string(out) != sopsHelmRelease {
+		t.Errorf("Expected the file to be written by sops only, got:\n%s", out)
+	}
+	if len(auditTrail.files) != 1 || auditTrail.files[0].Path != file || auditTrail.files[0].SHA256Before == "" {
+		t.Errorf("Expected the sops writes to be audited, got %+v", auditTrail.files)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	sourceTag    string
+	sourceSemver string
+	sourceName   string
+)
+
+// sourceAPIGroup is the API group of the Flux source objects bump source edits.
+const sourceAPIGroup = "source.toolkit.fluxcd.io"
+
+// sourceBump describes an update of the Flux source objects in a file.
+type sourceBump struct {
+	// Tag is the new .spec.ref.tag of OCIRepository and GitRepository
+	// objects, and the new version pinned in the .spec.url of HelmRepository
+	// objects.
+	Tag string
+	// Semver is the new .spec.ref.semver range of OCIRepository and
+	// GitRepository objects.
+	Semver string
+	// Name restricts the update to the objects with this name.
+	Name string
+	// Kind restricts the update to the objects of this kind.
+	Kind string
+}
+
+// urlVersionPin matches a version pinned as a path segment of a URL, e.g. the
+// "v1.2.0" in "oci://ghcr.io/my-org/charts/v1.2.0" or
+// "https://charts.example.com/1.2.0/".
+var urlVersionPin = regexp.MustCompile(`/v?\d+\.\d+\.\d+(-[a-zA-Z0-9.-]+)?(\+[a-zA-Z0-9.-]+)?(/|$)`)
+
+// refPrecedence lists, per kind, the .spec.ref fields Flux prefers over tag and
+// semver, highest first.
+var refPrecedence = map[string][]string{
+	"OCIRepository": {"digest", "semver", "tag"},
+	"GitRepository": {"commit", "name", "semver", "tag", "branch"},
+}
+
+// BumpSourceFile updates the OCIRepository, GitRepository, HelmRepository and
+// HelmChart objects in a (possibly multi-document) YAML file.
+//
+// For OCIRepository and GitRepository objects, .spec.ref.tag and/or
+// .spec.ref.semver are set; a warning is printed when a field Flux gives
+// precedence to (e.g. digest or commit) is also set. For HelmRepository
+// objects, the version pinned as a path segment of .spec.url is replaced by
+// bump.Tag. For HelmChart objects, .spec.version is set to bump.Tag or
+// bump.Semver. Other documents are left untouched.
+//
+// The file is written atomically under its advisory lock, unless dryRun is set
+// or nothing changes.
+//
+// Parameters:
+//   - filePath: The path to the source manifest file.
+//   - bump: The new tag and/or semver range, and an optional object name.
+//   - dryRun: If true, changes are only reported.
+//
+// Returns:
+//   - The changes made (or that would be made); Image holds "Kind/name" and
+//     Path the field, e.g. "spec.ref.tag".
+//   - An error if the semver range is invalid, no source object matches, or
+//     the file cannot be read or written.
+func BumpSourceFile(filePath string, bump sourceBump, dryRun bool) ([]tagChange, error) {
+	if bump.Tag == "" && bump.Semver == "" {
+		return nil, fmt.Errorf("nothing to update (expected a tag or semver range)")
+	}
+	if bump.Semver != "" {
+		if _, err := semver.NewConstraint(bump.Semver); err != nil {
+			return nil, fmt.Errorf("invalid semver range %q: %w", bump.Semver, err)
+		}
+	}
+
+	if !dryRun {
+		unlock, err := acquireFileLock(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+
+	var changes []tagChange
+	found := 0
+	docs := splitYAMLDocuments(data)
+	for i, doc := range docs {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil || obj == nil {
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if !strings.HasPrefix(apiVersion, sourceAPIGroup+"/") || (bump.Name != "" && name != bump.Name) || (bump.Kind != "" && kind != bump.Kind) {
+			continue
+		}
+
+		spec, _ := obj["spec"].(map[string]interface{})
+		if spec == nil {
+			continue
+		}
+		object := kind + "/" + name
+
+		var docChanges []tagChange
+		set := func(parent map[string]interface{}, key, path, value string) {
+			old, _ := parent[key].(string)
+			if value == "" || old == value {
+				return
+			}
+			parent[key] = value
+			docChanges = append(docChanges, tagChange{Image: object, Path: path, OldValue: old, NewValue: value})
+		}
+
+		switch kind {
+		case "OCIRepository", "GitRepository":
+			found++
+			ref, _ := spec["ref"].(map[string]interface{})
+			if ref == nil {
+				ref = map[string]interface{}{}
+				spec["ref"] = ref
+			}
+			set(ref, "tag", "spec.ref.tag", bump.Tag)
+			set(ref, "semver", "spec.ref.semver", bump.Semver)
+
+			updated := "tag"
+			if bump.Semver != "" {
+				updated = "semver"
+			}
+			for _, field := range refPrecedence[kind] {
+				if field == updated {
+					break
+				}
+				if v, ok := ref[field].(string); ok && v != "" {
+					logf("⚠️ %s sets .spec.ref.%s (%s), which takes precedence over .spec.ref.%s\n", object, field, v, updated)
+				}
+			}
+
+		case "HelmRepository":
+			found++
+			if bump.Tag == "" {
+				logf("ℹ️ %s has no ref, skipping semver update\n", object)
+				continue
+			}
+			url, _ := spec["url"].(string)
+			loc := urlVersionPin.FindStringIndex(url)
+			if loc == nil {
+				logf("⚠️ %s .spec.url %s has no version pin, skipping\n", object, url)
+				continue
+			}
+			pin := url[loc[0]:loc[1]]
+			suffix := ""
+			if strings.HasSuffix(pin, "/") {
+				suffix = "/"
+			}
+			set(spec, "url", "spec.url", url[:loc[0]]+"/"+bump.Tag+suffix+url[loc[1]:])
+
+		case "HelmChart":
+			found++
+			version := bump.Tag
+			if bump.Semver != "" {
+				version = bump.Semver
+			}
+			set(spec, "version", "spec.version", version)
+		}
+
+		if len(docChanges) == 0 {
+			if kind == "OCIRepository" || kind == "GitRepository" || kind == "HelmRepository" || kind == "HelmChart" {
+				logf("✅ %s already up to date, skipping\n", object)
+			}
+			continue
+		}
+		for _, c := range docChanges {
+			if dryRun {
+				logf("[dry-run] Would set %s %s: %s → %s\n", c.Image, c.Path, c.OldValue, c.NewValue)
+			} else {
+				logf("🔁 Set %s %s: %s → %s\n", c.Image, c.Path, c.OldValue, c.NewValue)
+			}
+		}
+		changes = append(changes, docChanges...)
+
+		newDoc, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", object, err)
+		}
+		docs[i] = newDoc
+	}
+
+	if found == 0 {
+		kinds := "OCIRepository, GitRepository, HelmRepository or HelmChart"
+		if bump.Kind != "" {
+			kinds = bump.Kind
+		}
+		if bump.Name != "" {
+			return nil, fmt.Errorf("no %s named %s in %s", kinds, bump.Name, filePath)
+		}
+		return nil, fmt.Errorf("no %s in %s", kinds, filePath)
+	}
+
+	if dryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", len(changes))
+		return changes, nil
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := writeFileWithBackup(filePath, joinYAMLDocuments(docs), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Updated %d source field(s) in %s\n", len(changes), filePath)
+	return changes, nil
+}
+
+var bumpSourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Bump the tag or semver range of Flux source manifests",
+	Long: "Update .spec.ref.tag and/or .spec.ref.semver of the OCIRepository and " +
+		"GitRepository objects in a file, the version pinned in the .spec.url " +
+		"of HelmRepository objects, and .spec.version of HelmChart objects.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filePath == "" || (sourceTag == "" && sourceSemver == "") {
+			return fmt.Errorf("you must specify --file and --tag or --semver")
+		}
+
+		changes, err := BumpSourceFile(filePath, sourceBump{Tag: sourceTag, Semver: sourceSemver, Name: sourceName}, dryRun)
+		if err != nil {
+			return fmt.Errorf("failed to bump source: %w", err)
+		}
+		noChangesMade = len(changes) == 0
+		return nil
+	},
+}
+
+func init() {
+	bumpSourceCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to the source manifest file")
+	bumpSourceCmd.Flags().StringVar(&sourceTag, "tag", "", "New .spec.ref.tag, or version pinned in a HelmRepository .spec.url")
+	bumpSourceCmd.Flags().StringVar(&sourceSemver, "semver", "", "New .spec.ref.semver range")
+	bumpSourceCmd.Flags().StringVar(&sourceName, "name", "", "Only update the source object with this name")
+	bumpSourceCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+
+	bumpCmd.AddCommand(bumpSourceCmd)
+}
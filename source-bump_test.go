@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpSourceFile verifies that OCIRepository and GitRepository refs and
+// HelmRepository URL pins are bumped, that unrelated documents are left
+// untouched and that --name restricts the update.
+func TestBumpSourceFile(t *testing.T) {
+	original, err := os.ReadFile("test_files/sources/sources.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "sources.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	changes, err := BumpSourceFile(file, sourceBump{Tag: "v1.9.0"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("Expected 3 changes, got: %v", changes)
+	}
+
+	data, _ := os.ReadFile(file)
+	docs := splitYAMLDocuments(data)
+	if len(docs) != 4 {
+		t.Fatalf("Expected 4 documents, got %d", len(docs))
+	}
+	if !strings.Contains(string(docs[0]), "tag: v1.9.0") || !strings.Contains(string(docs[1]), "tag: v1.9.0") {
+		t.Errorf("Expected OCIRepository and GitRepository refs to be bumped, got:\n%s", data)
+	}
+	if !strings.Contains(string(docs[2]), "url: oci://ghcr.io/my-org/charts/v1.9.0") {
+		t.Errorf("Expected HelmRepository URL pin to be bumped, got:\n%s", docs[2])
+	}
+	if !strings.Contains(string(docs[3]), "tag: v1.8.0") {
+		t.Errorf("Expected ConfigMap to be left untouched, got:\n%s", docs[3])
+	}
+
+	changes, err = BumpSourceFile(file, sourceBump{Semver: ">=1.9.0", Name: "podinfo"}, false)
+	if err != nil || len(changes) != 1 || changes[0].Image != "OCIRepository/podinfo" {
+		t.Errorf("Expected only podinfo's semver to change, got %v, err %v", changes, err)
+	}
+
+	if _, err := BumpSourceFile(file, sourceBump{Semver: "not a range"}, true); err == nil {
+		t.Errorf("Expected an error for an invalid semver range")
+	}
+	if _, err := BumpSourceFile(file, sourceBump{Tag: "v2.0.0", Name: "missing"}, true); err == nil {
+		t.Errorf("Expected an error when no source object matches")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdioFile is the --file value that reads the manifest from stdin and
+// writes the result to stdout.
+const stdioFile = "-"
+
+// The streams used for --file -; tests replace them.
+var (
+	manifestIn  io.Reader = os.Stdin
+	manifestOut io.Writer = os.Stdout
+)
+
+// stdinManifest caches what was read from manifestIn, since stdin can only be
+// read once but a run may read the manifest several times (e.g. for --strict).
+var stdinManifest []byte
+
+// readManifestFile reads the manifest at path, or from stdin when path is
+// stdioFile.
+func readManifestFile(path string) ([]byte, error) {
+	if path != stdioFile {
+		return os.ReadFile(path)
+	}
+	if stdinManifest == nil {
+		data, err := io.ReadAll(manifestIn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		stdinManifest = data
+	}
+	return stdinManifest, nil
+}
+
+// validateStdioBump checks that the bump flags in use can be combined with
+// --file -. Everything that needs a file on disk, or stdout, is rejected.
+func validateStdioBump(changed func(flag string) bool) error {
+	for _, flag := range []string{"watch", "follow-values-from", "interactive", "commit", "journal", "backup", "backup-dir", "post-hook"} {
+		if changed(flag) {
+			return fmt.Errorf("--%s cannot be combined with --file -", flag)
+		}
+	}
+	if outputFormat == outputJSON {
+		return fmt.Errorf("--output json cannot be combined with --file -: stdout carries the manifest")
+	}
+	return nil
+}
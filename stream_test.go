@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// useStdio replaces the --file - streams for the test.
+func useStdio(t *testing.T, in string) *bytes.Buffer {
+	t.Helper()
+	out := &bytes.Buffer{}
+	oldIn, oldOut := manifestIn, manifestOut
+	manifestIn, manifestOut, stdinManifest = strings.NewReader(in), out, nil
+	t.Cleanup(func() { manifestIn, manifestOut, stdinManifest = oldIn, oldOut, nil })
+	return out
+}
+
+// TestBumpStdio verifies that --file - reads stdin and writes the result to
+// stdout, including when nothing changed, and nothing in dry-run mode.
+func TestBumpStdio(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	out := useStdio(t, string(data))
+	result, err := bumpHelmReleaseFile(stdioFile, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 1 || !strings.Contains(out.String(), "tag: 1.8.0") {
+		t.Errorf("Expected the bumped manifest on stdout, got:\n%s", out.String())
+	}
+
+	// stdin is read once; later reads in the same run see the same manifest.
+	if again, err := readManifestFile(stdioFile); err != nil || string(again) != string(data) {
+		t.Errorf("Expected the cached manifest, got %q, %v", again, err)
+	}
+
+	out = useStdio(t, string(data))
+	if _, err := bumpHelmReleaseFile(stdioFile, map[string]string{"ghcr.io/my-org/other": "1.8.0"}, bumpOptions{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.String() != string(data) {
+		t.Errorf("Expected the manifest to pass through unchanged, got:\n%s", out.String())
+	}
+
+	out = useStdio(t, string(data))
+	if _, err := bumpHelmReleaseFile(stdioFile, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{DryRun: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output in dry-run mode, got:\n%s", out.String())
+	}
+}
+
+// TestValidateStdioBump verifies that flags needing a file or stdout are
+// rejected with --file -.
+func TestValidateStdioBump(t *testing.T) {
+	defer func(old string) { outputFormat = old }(outputFormat)
+	outputFormat = outputText
+
+	none := func(string) bool { return false }
+	if err := validateStdioBump(none); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err := validateStdioBump(func(flag string) bool { return flag == "commit" })
+	if err == nil || !strings.Contains(err.Error(), "--commit cannot be combined with --file -") {
+		t.Errorf("Expected --commit to be rejected, got: %v", err)
+	}
+	outputFormat = outputJSON
+	if err := validateStdioBump(none); err == nil {
+		t.Errorf("Expected --output json to be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Reasons a requested image was not bumped at a path, as reported in
+// skippedMatch.Reason.
+const (
+	// skipNoMatch: no image block references the image.
+	skipNoMatch = "no-match"
+	// skipPathFilter: the match is not selected by --path.
+	skipPathFilter = "path-filter"
+	// skipPinned: the match is pinned with a flux-helpers:ignore comment, or
+	// the whole HelmRelease with the ignore annotation.
+	skipPinned = "pinned"
+	// skipImagePolicy: the match carries an $imagepolicy marker and is left
+	// to the image-automation-controller.
+	skipImagePolicy = "image-policy"
+	// skipUnselected: the HelmRelease does not match --selector.
+	skipUnselected = "selector"
+	// skipUpToDate: the match already has the new version.
+	skipUpToDate = "up-to-date"
+	// skipInvalidVersion: the new version is not a valid version.
+	skipInvalidVersion = "invalid-version"
+	// skipDeselected: the change was declined in --interactive mode.
+	skipDeselected = "deselected"
+)
+
+// skippedMatch is a requested image that was not bumped at Path (empty when
+// no match was found), and why.
+type skippedMatch struct {
+	Image   string `json:"image"`
+	Path    string `json:"path,omitempty"`
+	Current string `json:"current,omitempty"`
+	Wanted  string `json:"wanted"`
+	Reason  string `json:"reason"`
+}
+
+// because returns m with Reason set to reason.
+func (m skippedMatch) because(reason string) skippedMatch {
+	m.Reason = reason
+	return m
+}
+
+// skipLog collects the skipped matches of one manifest. A nil *skipLog only
+// counts them for the run metrics.
+type skipLog struct {
+	matches []skippedMatch
+}
+
+// record counts m as skipped and, unless l is nil, keeps it.
+func (l *skipLog) record(m skippedMatch) {
+	countSkipped(1)
+	if l != nil {
+		l.matches = append(l.matches, m)
+	}
+}
+
+// list returns the recorded matches; it is nil-safe.
+func (l *skipLog) list() []skippedMatch {
+	if l == nil {
+		return nil
+	}
+	return l.matches
+}
+
+// valuePath returns the values path of the scalar a bump of m changes: the
+// tag of a structured block, or the image string itself.
+func (m imageMatch) valuePath() string {
+	if m.Block != nil {
+		return joinValuesPath(m.Path, m.TagKey)
+	}
+	return m.Path
+}
+
+// currentValue returns the current tag of a structured block, or the whole
+// image string.
+func (m imageMatch) currentValue() string {
+	if m.Block != nil {
+		tag, _ := m.Block[m.TagKey].(string)
+		return tag
+	}
+	return m.Value
+}
+
+// writeDryRunSummary prints every change and skipped match of files as an
+// aligned table, followed by the totals.
+func writeDryRunSummary(w io.Writer, files []fileReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tPATH\tIMAGE\tCURRENT\tNEW\tRESULT")
+	changes, skipped, changedFiles := 0, 0, 0
+	for _, f := range files {
+		file := f.File
+		if f.Object != "" {
+			file += " (" + f.Object + ")"
+		}
+		for _, c := range f.Changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", file, c.Path, c.Image, c.OldValue, c.NewValue, "would bump")
+		}
+		for _, m := range f.Skipped {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", file, dashIfEmpty(m.Path), m.Image, dashIfEmpty(m.Current), m.Wanted, "skipped: "+m.Reason)
+		}
+		changes += len(f.Changes)
+		skipped += len(f.Skipped)
+		if len(f.Changes) > 0 {
+			changedFiles++
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "🧪 %d change(s) in %d of %d file(s), %d match(es) skipped\n", changes, changedFiles, len(files), skipped)
+	return err
+}
+
+// dashIfEmpty returns s, or "-" for an empty table cell.
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const summaryManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.0
+    canary:
+      image:
+        repository: ghcr.io/my-org/my-api
+        tag: 1.8.0
+    legacy:
+      image: ghcr.io/my-org/worker:0.9.0 # flux-helpers:ignore
+`
+
+// TestDryRunSummary verifies that skipped matches are reported with their
+// path and reason, and printed along with the changes.
+func TestDryRunSummary(t *testing.T) {
+	result, err := bumpHelmReleaseData([]byte(summaryManifest), map[string]string{
+		"ghcr.io/my-org/my-api": "1.8.0",
+		"ghcr.io/my-org/worker": "1.0.0",
+		"nginx":                 "1.25.0",
+	}, bumpOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []skippedMatch{
+		{Image: "ghcr.io/my-org/my-api", Path: "canary.image.tag", Current: "1.8.0", Wanted: "1.8.0", Reason: skipUpToDate},
+		{Image: "ghcr.io/my-org/worker", Path: "legacy.image", Current: "ghcr.io/my-org/worker:0.9.0", Wanted: "1.0.0", Reason: skipPinned},
+		{Image: "nginx", Wanted: "1.25.0", Reason: skipNoMatch},
+	}
+	if len(result.Skipped) != len(want) {
+		t.Fatalf("Expected %d skipped matches, got: %+v", len(want), result.Skipped)
+	}
+	for i := range want {
+		if result.Skipped[i] != want[i] {
+			t.Errorf("Skipped match %d: expected %+v, got %+v", i, want[i], result.Skipped[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeDryRunSummary(&out, []fileReport{{File: "hr.yaml", Changes: result.Changes, Skipped: result.Skipped}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, line := range []string{
+		"hr.yaml  image.tag         ghcr.io/my-org/my-api  1.7.0                        1.8.0   would bump",
+		"hr.yaml  -                 nginx                  -                            1.25.0  skipped: no-match",
+		"1 change(s) in 1 of 1 file(s), 3 match(es) skipped",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+}
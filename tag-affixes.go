@@ -0,0 +1,45 @@
+package main
+
+import "regexp"
+
+// tagCorePattern splits a tag into the prefix before its semver core, the
+// MAJOR.MINOR.PATCH core and the suffix after it, e.g. "v1.2.3-amd64" into
+// "v", "1.2.3" and "-amd64".
+var tagCorePattern = regexp.MustCompile(`^([^0-9]*)(\d+\.\d+\.\d+)(.*)$`)
+
+// tagAffixes selects the parts of the current tag that a bump carries over
+// to the new one (see --preserve-prefix and --preserve-suffix).
+type tagAffixes struct {
+	// Prefix keeps the text before the semver core, such as "v".
+	Prefix bool
+	// Suffix keeps the text after the semver core, such as a variant like
+	// "-bookworm" or "-amd64".
+	Suffix bool
+}
+
+// apply returns the tag to bump oldTag to for the requested newVersion: the
+// semver core of newVersion with the prefix and suffix of oldTag carried over
+// as selected. A prefix or suffix given in newVersion itself wins, and tags
+// without a semver core are returned unchanged.
+//
+// For example, with Suffix set, bumping "1.2.3-bookworm" to "1.2.4" yields
+// "1.2.4-bookworm", and with Prefix and Suffix set, bumping "v1.2.3-amd64" to
+// "1.2.4" yields "v1.2.4-amd64".
+func (a tagAffixes) apply(oldTag, newVersion string) string {
+	if !a.Prefix && !a.Suffix {
+		return newVersion
+	}
+	old := tagCorePattern.FindStringSubmatch(oldTag)
+	requested := tagCorePattern.FindStringSubmatch(newVersion)
+	if old == nil || requested == nil {
+		return newVersion
+	}
+	prefix, core, suffix := requested[1], requested[2], requested[3]
+	if a.Prefix && prefix == "" {
+		prefix = old[1]
+	}
+	if a.Suffix && suffix == "" {
+		suffix = old[3]
+	}
+	return prefix + core + suffix
+}
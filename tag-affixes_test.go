@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+// TestTagAffixes verifies which parts of the current tag are carried over to
+// the new one.
+func TestTagAffixes(t *testing.T) {
+	tests := []struct {
+		affixes    tagAffixes
+		oldTag     string
+		newVersion string
+		want       string
+	}{
+		{tagAffixes{}, "1.2.3-bookworm", "1.2.4", "1.2.4"},
+		{tagAffixes{Suffix: true}, "1.2.3-bookworm", "1.2.4", "1.2.4-bookworm"},
+		{tagAffixes{Suffix: true}, "v1.2.3-amd64", "1.2.4", "1.2.4-amd64"},
+		{tagAffixes{Prefix: true, Suffix: true}, "v1.2.3-amd64", "1.2.4", "v1.2.4-amd64"},
+		{tagAffixes{Prefix: true}, "v1.2.3", "1.2.4", "v1.2.4"},
+		{tagAffixes{Prefix: true, Suffix: true}, "v1.2.3-amd64", "1.2.4-slim", "v1.2.4-slim"},
+		{tagAffixes{Prefix: true, Suffix: true}, "latest", "1.2.4", "1.2.4"},
+	}
+	for _, tt := range tests {
+		if got := tt.affixes.apply(tt.oldTag, tt.newVersion); got != tt.want {
+			t.Errorf("%+v.apply(%q, %q) = %q, want %q", tt.affixes, tt.oldTag, tt.newVersion, got, tt.want)
+		}
+	}
+}
+
+// TestBumpPreservesSuffix verifies that blocks and repository:tag strings keep
+// their variant suffix when bumped with Affixes.Suffix set.
+func TestBumpPreservesSuffix(t *testing.T) {
+	values := map[string]interface{}{
+		"image":  map[string]interface{}{"repository": "python", "tag": "3.11.4-bookworm"},
+		"images": map[string]interface{}{"worker": "python:3.11.4-slim"},
+	}
+	changes, err := bumpTagInValues(values, "python", "3.12.1", bumpOptions{Affixes: tagAffixes{Suffix: true}})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("Expected two changes, got %+v, %v", changes, err)
+	}
+	if tag := values["image"].(map[string]interface{})["tag"]; tag != "3.12.1-bookworm" {
+		t.Errorf("Expected the block to keep its suffix, got %v", tag)
+	}
+	if image := values["images"].(map[string]interface{})["worker"]; image != "python:3.12.1-slim" {
+		t.Errorf("Expected the string to keep its suffix, got %v", image)
+	}
+}
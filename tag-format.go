@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Names of the tag format profiles of --tag-format.
+const (
+	tagFormatSemver = "semver"
+	tagFormatCalver = "calver"
+	tagFormatSHA    = "sha"
+	tagFormatNone   = "none"
+	// tagFormatRegexPrefix starts a custom format, as in "regex:^build-\d+$".
+	tagFormatRegexPrefix = "regex:"
+)
+
+var (
+	// calverPattern matches calendar versions with a two or four digit year,
+	// a month and an optional day and modifier, e.g. 2024.05, 24.5.1 or
+	// 2024.05.01-build.7.
+	calverPattern = regexp.MustCompile(`^v?(\d{2}|\d{4})\.\d{1,2}(\.\d{1,2})?([.+-][0-9A-Za-z.-]+)?$`)
+	// shaPattern matches abbreviated or full git commit SHAs, optionally
+	// prefixed with "sha-" as written by docker/metadata-action.
+	shaPattern = regexp.MustCompile(`^(sha-)?[0-9a-f]{7,40}$`)
+	// ociTagPattern matches every valid OCI image tag.
+	ociTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// tagFormat is a validation profile for new image tags: a bump to a tag the
+// profile rejects is skipped as an invalid version.
+type tagFormat struct {
+	// Name is the profile as given, e.g. "calver" or "regex:^build-\d+$".
+	Name    string
+	pattern *regexp.Regexp
+}
+
+// parseTagFormat parses a --tag-format profile: semver (the default for an
+// empty name), calver, sha, none (any valid OCI tag) or regex:<pattern>,
+// which must match the whole tag.
+func parseTagFormat(name string) (tagFormat, error) {
+	switch name {
+	case "", tagFormatSemver:
+		return tagFormat{Name: tagFormatSemver}, nil
+	case tagFormatCalver:
+		return tagFormat{Name: name, pattern: calverPattern}, nil
+	case tagFormatSHA:
+		return tagFormat{Name: name, pattern: shaPattern}, nil
+	case tagFormatNone:
+		return tagFormat{Name: name, pattern: ociTagPattern}, nil
+	}
+	expr, ok := strings.CutPrefix(name, tagFormatRegexPrefix)
+	if !ok {
+		return tagFormat{}, fmt.Errorf("invalid tag format %q (expected semver, calver, sha, none or regex:<pattern>)", name)
+	}
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return tagFormat{}, fmt.Errorf("invalid tag format %q: %w", name, err)
+	}
+	return tagFormat{Name: name, pattern: re}, nil
+}
+
+// valid reports whether tag is valid in the profile. The zero tagFormat is
+// the semver profile.
+func (f tagFormat) valid(tag string) bool {
+	if f.pattern == nil {
+		return isValidSemver(tag)
+	}
+	return f.pattern.MatchString(tag)
+}
+
+// String returns the name of the profile.
+func (f tagFormat) String() string {
+	if f.Name == "" {
+		return tagFormatSemver
+	}
+	return f.Name
+}
+
+// parseTagFormats parses the default profile and the per-repository profiles
+// of an update set.
+func parseTagFormats(name string, perImage map[string]string) (tagFormat, map[string]tagFormat, error) {
+	format, err := parseTagFormat(name)
+	if err != nil {
+		return tagFormat{}, nil, err
+	}
+	var formats map[string]tagFormat
+	for _, repo := range sortedKeys(perImage) {
+		f, err := parseTagFormat(perImage[repo])
+		if err != nil {
+			return tagFormat{}, nil, fmt.Errorf("%s: %w", repo, err)
+		}
+		if formats == nil {
+			formats = map[string]tagFormat{}
+		}
+		formats[repo] = f
+	}
+	return format, formats, nil
+}
+
+// tagFormatFor returns the tag format profile of imageName: its entry in
+// TagFormats, or TagFormat.
+func (o bumpOptions) tagFormatFor(imageName string) tagFormat {
+	if f, ok := o.TagFormats[imageName]; ok {
+		return f
+	}
+	return o.TagFormat
+}
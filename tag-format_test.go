@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+// TestTagFormats verifies the tags each --tag-format profile accepts.
+func TestTagFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		valid  []string
+		bad    []string
+	}{
+		{"", []string{"1.2.3", "v1.2.3-rc.1"}, []string{"2024.05", "latest"}},
+		{"calver", []string{"2024.05.01-build.7", "24.5", "2024.05", "v2024.5.1"}, []string{"1.2.3", "abc1234"}},
+		{"sha", []string{"abc1234", "sha-0123456789abcdef0123456789abcdef01234567"}, []string{"1.2.3", "ABC1234", "abc12"}},
+		{"none", []string{"latest", "1.2.3", "main-abc1234"}, []string{"", "-bad", "has:colon"}},
+		{`regex:build-\d+`, []string{"build-7"}, []string{"build-7-x", "xbuild-7"}},
+	}
+	for _, tt := range tests {
+		format, err := parseTagFormat(tt.format)
+		if err != nil {
+			t.Fatalf("parseTagFormat(%q): %v", tt.format, err)
+		}
+		for _, tag := range tt.valid {
+			if !format.valid(tag) {
+				t.Errorf("Expected %s to accept %q", format, tag)
+			}
+		}
+		for _, tag := range tt.bad {
+			if format.valid(tag) {
+				t.Errorf("Expected %s to reject %q", format, tag)
+			}
+		}
+	}
+
+	for _, invalid := range []string{"date", "regex:("} {
+		if _, err := parseTagFormat(invalid); err == nil {
+			t.Errorf("Expected tag format %q to be rejected", invalid)
+		}
+	}
+}
+
+// TestBumpTagFormat verifies that bumps are validated with the profile of
+// each image: the set-wide one or the image's override.
+func TestBumpTagFormat(t *testing.T) {
+	set := updateSet{
+		Files:      []string{"hr.yaml"},
+		Images:     map[string]string{"api": "2024.05.01-build.7", "worker": "abc1234"},
+		TagFormat:  "calver",
+		TagFormats: map[string]string{"worker": "sha"},
+	}
+	if err := validateUpdateSets([]updateSet{set}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	values := map[string]interface{}{
+		"api":    map[string]interface{}{"image": map[string]interface{}{"repository": "api", "tag": "2024.04.30-build.3"}},
+		"worker": map[string]interface{}{"image": map[string]interface{}{"repository": "worker", "tag": "0123abc"}},
+	}
+	updated, _, err := applyImageUpdates(values, set.Images, set.options(false))
+	if err != nil || updated != 2 {
+		t.Fatalf("Expected both images to be bumped, got %d, %v", updated, err)
+	}
+
+	changes, err := bumpTagInValues(values, "api", "1.2.3", set.options(false))
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected a semver tag to be rejected by the calver profile, got %+v, %v", changes, err)
+	}
+
+	set.TagFormats = map[string]string{"worker": "date"}
+	if err := validateUpdateSets([]updateSet{set}); err == nil {
+		t.Error("Expected an invalid per-image tag format to be rejected")
+	}
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Defaults of a stage's wait.
+const (
+	defaultTrainTimeout  = 10 * time.Minute
+	defaultTrainInterval = 15 * time.Second
+)
+
+// Outcomes of a train stage.
+const (
+	trainBumped    = "bumped"
+	trainUnchanged = "unchanged"
+	trainHealthy   = "healthy"
+	trainUnhealthy = "unhealthy"
+	trainFailed    = "failed"
+)
+
+var trainConfigPath string
+
+// trainHTTPClient sends the health checks of webhook waits.
+var trainHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// trainConfig describes a release train, e.g.:
+//
+//	images:
+//	  ghcr.io/my-org/my-api: 1.4.0
+//	stages:
+//	  - name: dev
+//	    files: [clusters/dev]
+//	    wait:
+//	      kube: {context: dev}
+//	  - name: staging
+//	    files: [clusters/staging]
+//	    wait:
+//	      webhook: {url: https://status.example.com/staging}
+//	      timeout: 20m
+//	  - name: prod
+//	    files: [clusters/prod]
+//
+// The images are bumped in the files of each stage in turn (directories stand
+// for every HelmRelease below them, see helmReleaseFilesAt), and the train
+// waits for a stage to be healthy before it moves on to the next. Matchers
+// (see imageMatcher) extend the image reference shapes recognised in every
+// stage.
+type trainConfig struct {
+	MatcherProfile string            `json:"matcherProfile,omitempty"`
+	Matchers       []imageMatcher    `json:"matchers,omitempty"`
+	Images         map[string]string `json:"images"`
+	Stages         []trainStage      `json:"stages"`
+}
+
+// trainStage is one environment of a release train.
+type trainStage struct {
+	Name  string     `json:"name"`
+	Files []string   `json:"files"`
+	Wait  *trainWait `json:"wait,omitempty"`
+}
+
+// trainWait is how a stage is judged healthy after its commit: by the
+// HelmReleases in a cluster (Kube), by a health endpoint (Webhook), or both.
+// Timeout and Interval are durations such as "10m".
+type trainWait struct {
+	Kube     *trainKubeWait    `json:"kube,omitempty"`
+	Webhook  *trainWebhookWait `json:"webhook,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"`
+	Interval string            `json:"interval,omitempty"`
+
+	timeout, interval time.Duration
+}
+
+// trainKubeWait waits for HelmReleases to run the bumped values and be
+// Ready. HelmReleases lists them as "namespace/name"; by default they are
+// the HelmReleases of the stage's changed files.
+type trainKubeWait struct {
+	Kubeconfig   string   `json:"kubeconfig,omitempty"`
+	Context      string   `json:"context,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+	HelmReleases []string `json:"helmReleases,omitempty"`
+}
+
+// trainWebhookWait waits for a GET of URL to return a 2xx status. Header
+// values are expanded with environment variables, e.g. "Bearer $TOKEN".
+type trainWebhookWait struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// trainReport is the machine-readable result of train.
+type trainReport struct {
+	DryRun bool               `json:"dryRun"`
+	Stages []trainStageReport `json:"stages"`
+}
+
+// trainStageReport is the outcome of one stage: bumped (no wait, or a dry
+// run), unchanged, healthy, unhealthy or failed. Stages after a failure are
+// not listed.
+type trainStageReport struct {
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Files  []fileReport `json:"files"`
+}
+
+// loadTrainConfig reads and validates a train config file.
+func loadTrainConfig(path string) (*trainConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read train config: %w", err)
+	}
+	var cfg trainConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid train config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid train config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// validate checks the config and parses the durations of its waits.
+func (c *trainConfig) validate() error {
+	if len(c.Images) == 0 {
+		return fmt.Errorf("no images defined")
+	}
+	if len(c.Stages) == 0 {
+		return fmt.Errorf("no stages defined")
+	}
+	if _, err := setMatchers(c.MatcherProfile, c.Matchers); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i := range c.Stages {
+		stage := &c.Stages[i]
+		if stage.Name == "" {
+			return fmt.Errorf("stage %d has no name", i+1)
+		}
+		if names[stage.Name] {
+			return fmt.Errorf("stage %q is defined twice", stage.Name)
+		}
+		names[stage.Name] = true
+		if len(stage.Files) == 0 {
+			return fmt.Errorf("stage %q has no files", stage.Name)
+		}
+		if stage.Wait == nil {
+			continue
+		}
+		if err := stage.Wait.validate(); err != nil {
+			return fmt.Errorf("stage %q: %w", stage.Name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the wait and parses its durations.
+func (w *trainWait) validate() error {
+	if w.Kube == nil && w.Webhook == nil {
+		return fmt.Errorf("wait needs kube or webhook")
+	}
+	if w.Webhook != nil && !strings.HasPrefix(w.Webhook.URL, "http://") && !strings.HasPrefix(w.Webhook.URL, "https://") {
+		return fmt.Errorf("invalid webhook url %q (expected http:// or https://)", w.Webhook.URL)
+	}
+	if w.Kube != nil {
+		for _, hr := range w.Kube.HelmReleases {
+			if namespace, name, ok := strings.Cut(hr, "/"); !ok || namespace == "" || name == "" {
+				return fmt.Errorf("invalid HelmRelease %q (expected namespace/name)", hr)
+			}
+		}
+	}
+	var err error
+	if w.timeout, err = parseTrainDuration("timeout", w.Timeout, defaultTrainTimeout); err != nil {
+		return err
+	}
+	w.interval, err = parseTrainDuration("interval", w.Interval, defaultTrainInterval)
+	return err
+}
+
+// parseTrainDuration parses a positive duration, or returns def for "".
+func parseTrainDuration(field, s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (expected a duration such as 10m)", field, s)
+	}
+	return d, nil
+}
+
+// hasWaits reports whether any stage waits for health.
+func (c *trainConfig) hasWaits() bool {
+	for _, stage := range c.Stages {
+		if stage.Wait != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// RunTrain bumps the images of cfg in the files of each stage in order.
+// After a stage is bumped, its changes are recorded in the change journal
+// and committed (see commitRun), and the train waits for the stage to be
+// healthy before it moves on. A stage without changes is not waited for.
+//
+// Parameters:
+//   - ctx: The context for commits and health checks.
+//   - cfg: The validated train config.
+//   - dryRun: Preview the bump of every stage without writing, committing or
+//     waiting.
+//   - templates: The commit templates.
+//
+// Returns:
+//   - The report of the stages that were run, including the one that failed.
+//   - An error if a stage cannot be bumped or committed, or does not become
+//     healthy; the stages after it are not run.
+func RunTrain(ctx context.Context, cfg *trainConfig, dryRun bool, templates *commitTemplates) (*trainReport, error) {
+	report := &trainReport{DryRun: dryRun, Stages: []trainStageReport{}}
+	matchers, err := setMatchers(cfg.MatcherProfile, cfg.Matchers)
+	if err != nil {
+		return report, err
+	}
+
+	for i, stage := range cfg.Stages {
+		logf("🚂 Stage %d/%d: %s\n", i+1, len(cfg.Stages), stage.Name)
+		result, err := runTrainStage(ctx, cfg, stage, matchers, dryRun, templates)
+		report.Stages = append(report.Stages, result)
+		if err != nil {
+			return report, fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// runTrainStage runs a single stage of RunTrain. matchers are those of cfg,
+// used to read the image references a kube wait expects.
+func runTrainStage(ctx context.Context, cfg *trainConfig, stage trainStage, matchers []imageMatcher, dryRun bool, templates *commitTemplates) (trainStageReport, error) {
+	result := trainStageReport{Name: stage.Name, Status: trainFailed, Files: []fileReport{}}
+	fail := func(err error) (trainStageReport, error) {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	files, err := helmReleaseFilesAt(stage.Files)
+	if err != nil {
+		return fail(err)
+	}
+	sets := []updateSet{{Files: files, Images: cfg.Images, MatcherProfile: cfg.MatcherProfile, Matchers: cfg.Matchers}}
+	if err := validateUpdateSets(sets); err != nil {
+		return fail(err)
+	}
+	if err := setPolicy(sets, policyPath, allowMajor); err != nil {
+		return fail(err)
+	}
+	setCheckExists(ctx, sets, checkExists)
+
+	bumped, err := runBumpSets(sets, dryRun, false)
+	if bumped != nil {
+		result.Files = bumped.Files
+	}
+	if !dryRun && journalPath != "" && bumped != nil {
+		if id, jErr := recordJournalRun(journalPath, "train", bumped.Files); jErr != nil {
+			logf("⚠️ Failed to record change journal: %v\n", jErr)
+		} else if id != "" {
+			logf("📝 Recorded run %s in %s\n", id, journalPath)
+		}
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to bump tags: %w", err))
+	}
+	if bumped.changeCount() == 0 {
+		logf("✅ Stage %s is up to date\n", stage.Name)
+		result.Status = trainUnchanged
+		return result, nil
+	}
+	result.Status = trainBumped
+	if dryRun {
+		if stage.Wait != nil {
+			logf("⏭️ Dry run: not waiting for stage %s\n", stage.Name)
+		}
+		return result, nil
+	}
+	if err := commitRun(ctx, bumped.Files, templates); err != nil {
+		return fail(fmt.Errorf("failed to commit changes: %w", err))
+	}
+	if stage.Wait == nil {
+		return result, nil
+	}
+
+	if err := waitForTrainStage(ctx, stage, bumped.Files, matchers); err != nil {
+		result.Status = trainUnhealthy
+		return fail(err)
+	}
+	result.Status = trainHealthy
+	logf("💚 Stage %s is healthy\n", stage.Name)
+	return result, nil
+}
+
+// waitForTrainStage polls the checks of stage.Wait every interval until they
+// all pass, or fails once the timeout has passed.
+func waitForTrainStage(ctx context.Context, stage trainStage, files []fileReport, matchers []imageMatcher) error {
+	wait := stage.Wait
+	var checks []func(ctx context.Context) (string, error)
+	if wait.Kube != nil {
+		kc, err := newKubeClient(wait.Kube.Kubeconfig, wait.Kube.Context, wait.Kube.Namespace)
+		if err != nil {
+			return err
+		}
+		targets, err := trainTargets(wait.Kube.HelmReleases, files, kc.Namespace, matchers)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("no HelmRelease to wait for")
+		}
+		checks = append(checks, func(ctx context.Context) (string, error) {
+			return checkHelmReleasesRolledOut(ctx, kc, targets)
+		})
+		logf("⏳ Waiting up to %s for %d HelmRelease(s) in context %s\n", wait.timeout, len(targets), dashIfEmpty(kc.Context))
+	}
+	if wait.Webhook != nil {
+		checks = append(checks, func(ctx context.Context) (string, error) {
+			return checkTrainWebhook(ctx, wait.Webhook)
+		})
+		logf("⏳ Waiting up to %s for %s\n", wait.timeout, wait.Webhook.URL)
+	}
+
+	deadline := time.Now().Add(wait.timeout)
+	for {
+		pending := ""
+		for _, check := range checks {
+			reason, err := check(ctx)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				pending = reason
+				break
+			}
+		}
+		if pending == "" {
+			return nil
+		}
+		if !time.Now().Add(wait.interval).Before(deadline) {
+			return fmt.Errorf("not healthy after %s: %s", wait.timeout, pending)
+		}
+		logf("⌛ %s\n", pending)
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(wait.interval):
+		}
+	}
+}
+
+// trainTarget is a HelmRelease a kube wait checks, with the image references
+// it must run when it was bumped from a file.
+type trainTarget struct {
+	Namespace string
+	Name      string
+	File      string
+	Refs      []imageReference
+}
+
+func (t trainTarget) String() string {
+	return t.Namespace + "/" + t.Name
+}
+
+// trainTargets returns the HelmReleases a kube wait checks: those listed, or
+// else the HelmReleases of the changed files, with the image references they
+// now hold. HelmReleases without a namespace are looked up in namespace.
+func trainTargets(listed []string, files []fileReport, namespace string, matchers []imageMatcher) ([]trainTarget, error) {
+	var targets []trainTarget
+	if len(listed) > 0 {
+		for _, hr := range listed {
+			ns, name, _ := strings.Cut(hr, "/")
+			targets = append(targets, trainTarget{Namespace: ns, Name: name})
+		}
+		return targets, nil
+	}
+
+	for _, f := range files {
+		// ConfigMaps and Secrets bumped through valuesFrom carry an Object.
+		if f.Object != "" || len(f.Changes) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(f.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		hr, err := decodeHelmRelease(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.File, err)
+		}
+		meta, ok := hr.Object.(interface {
+			GetName() string
+			GetNamespace() string
+		})
+		if !ok || meta.GetName() == "" {
+			return nil, fmt.Errorf("%s: HelmRelease has no name", f.File)
+		}
+		refs, err := listImageReferences(f.File, data, matchers)
+		if err != nil {
+			return nil, err
+		}
+		target := trainTarget{Namespace: meta.GetNamespace(), Name: meta.GetName(), File: f.File, Refs: refs}
+		if target.Namespace == "" {
+			target.Namespace = namespace
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// checkHelmReleasesRolledOut reports the first of targets that has not
+// rolled out yet.
+//
+// Returns:
+//   - "" if every HelmRelease holds the image tags of its file, has been
+//     reconciled at its latest generation and is Ready; otherwise why not.
+//   - An error if a request fails for another reason than a missing
+//     HelmRelease.
+func checkHelmReleasesRolledOut(ctx context.Context, kc *kubeClient, targets []trainTarget) (string, error) {
+	for _, target := range targets {
+		var obj *unstructured.Unstructured
+		err := kubeCall(ctx, "get HelmRelease", func(ctx context.Context) (err error) {
+			obj, err = kc.Client.Resource(helmReleaseResource()).Namespace(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("HelmRelease %s is not in the cluster", target), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get HelmRelease %s: %w", target, err)
+		}
+		if reason, err := helmReleaseRolledOut(obj, target); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+// helmReleaseRolledOut reports why a live HelmRelease has not rolled out the
+// image references of target, or "" if it has.
+func helmReleaseRolledOut(obj *unstructured.Unstructured, target trainTarget) (string, error) {
+	if len(target.Refs) > 0 {
+		live, err := json.Marshal(obj.Object)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode HelmRelease %s: %w", target, err)
+		}
+		liveRefs, err := listImageReferences(target.File, live, nil)
+		if err != nil {
+			return "", fmt.Errorf("live HelmRelease %s: %w", target, err)
+		}
+		liveTags := map[string]string{}
+		for _, ref := range liveRefs {
+			liveTags[ref.Path+"\x00"+ref.Image] = ref.Tag
+		}
+		for _, ref := range target.Refs {
+			if tag := liveTags[ref.Path+"\x00"+ref.Image]; tag != ref.Tag {
+				return fmt.Sprintf("HelmRelease %s has %s:%s at %s (waiting for %s)", target, ref.Image, dashIfEmpty(tag), ref.Path, ref.Tag), nil
+			}
+		}
+	}
+
+	generation := obj.GetGeneration()
+	observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observed < generation {
+		return fmt.Sprintf("HelmRelease %s has not reconciled generation %d yet", target, generation), nil
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == string(metav1.ConditionTrue) {
+			return "", nil
+		}
+		return fmt.Sprintf("HelmRelease %s is not ready: %v", target, condition["message"]), nil
+	}
+	return fmt.Sprintf("HelmRelease %s has no Ready condition yet", target), nil
+}
+
+// checkTrainWebhook sends a GET to the health endpoint of a webhook wait.
+//
+// Returns:
+//   - "" for a 2xx response; otherwise the status and the start of the body.
+//   - An error if the request cannot be built.
+func checkTrainWebhook(ctx context.Context, hook *trainWebhookWait) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hook.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook url: %w", err)
+	}
+	for _, k := range sortedKeys(hook.Headers) {
+		req.Header.Set(k, os.ExpandEnv(hook.Headers[k]))
+	}
+	resp, err := trainHTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s is not reachable: %v", hook.URL, err), nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return "", nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 300))
+	reason := fmt.Sprintf("%s returned %s", hook.URL, resp.Status)
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		reason += ": " + msg
+	}
+	return reason, nil
+}
+
+// writeTrainSummary prints the outcome of each stage.
+func writeTrainSummary(w io.Writer, report *trainReport) {
+	for _, stage := range report.Stages {
+		files := map[string]bool{}
+		changes := 0
+		for _, f := range stage.Files {
+			if len(f.Changes) > 0 {
+				files[f.File] = true
+				changes += len(f.Changes)
+			}
+		}
+		fmt.Fprintf(w, "%-12s %-10s %d change(s) in %d file(s)\n", stage.Name, stage.Status, changes, len(files))
+	}
+}
+
+var trainCmd = &cobra.Command{
+	Use:   "train",
+	Short: "Bump images environment by environment, waiting for each to be healthy",
+	Long: `Run a release train: bump the images of a train config in the files of each
+stage in order (e.g. dev, then staging, then prod), committing each stage
+separately and waiting for it to be healthy before the next one starts.
+
+A stage is healthy once its wait passes:
+
+  - kube: every HelmRelease bumped by the stage (or listed in helmReleases)
+    holds the new image tags in the cluster, has reconciled its latest
+    generation and is Ready;
+  - webhook: a GET of the url returns a 2xx status.
+
+Both are polled every interval (default 15s) until the timeout (default 10m).
+The cluster only sees a stage once it is pushed, so waits need --commit and
+--branch (or --branch-template). The train stops at the first stage that
+fails; the stages before it stay committed.`,
+	Example: `  flux-helpers train --config train.yaml --commit --branch main
+  flux-helpers train --config train.yaml --dry-run -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if trainConfigPath == "" {
+			return fmt.Errorf("--config is required")
+		}
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+		cfg, err := loadTrainConfig(trainConfigPath)
+		if err != nil {
+			return err
+		}
+		templates, err := validateCommitFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if pullRequestOpen {
+			return fmt.Errorf("train cannot open pull requests: each stage must be deployed before the next one starts")
+		}
+		if cfg.hasWaits() && !dryRun && (!commitChanges || (commitBranch == "" && branchTemplate == "")) {
+			return fmt.Errorf("waiting for a stage requires --commit and --branch (or --branch-template), so the stage reaches the cluster")
+		}
+
+		report, err := RunTrain(cmd.Context(), cfg, dryRun, templates)
+		if outputFormat == outputJSON {
+			if jErr := writeJSON(os.Stdout, report); jErr != nil && err == nil {
+				return jErr
+			}
+		} else {
+			writeTrainSummary(logWriter(), report)
+		}
+		if err != nil {
+			return fmt.Errorf("release train stopped: %w", err)
+		}
+		noChangesMade = true
+		for _, stage := range report.Stages {
+			if stage.Status != trainUnchanged {
+				noChangesMade = false
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	trainCmd.Flags().StringVar(&trainConfigPath, "config", "", "Path to the train config describing the images and stages")
+	trainCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview the bump of every stage without writing, committing or waiting")
+	trainCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json")
+	trainCmd.Flags().StringVar(&journalPath, "journal", defaultJournalPath, "Record changes in this change journal for rollback (empty to disable)")
+	trainCmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a new image tag does not exist in its registry")
+	addPolicyFlags(trainCmd)
+	addBackupFlags(trainCmd)
+	addCommitFlags(trainCmd)
+	rootCmd.AddCommand(trainCmd)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// TestLoadTrainConfig verifies the validation of train configs and the
+// defaults of waits.
+func TestLoadTrainConfig(t *testing.T) {
+	dir := t.TempDir()
+	valid := "images: {nginx: 1.26.0}\nstages:\n  - name: dev\n    files: [dev]\n    wait: {webhook: {url: 'http://localhost/health'}}\n  - name: prod\n    files: [prod]\n"
+	writeTestFiles(t, dir, map[string]string{"train.yaml": valid})
+	cfg, err := loadTrainConfig(filepath.Join(dir, "train.yaml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w := cfg.Stages[0].Wait; w.timeout != defaultTrainTimeout || w.interval != defaultTrainInterval {
+		t.Errorf("Expected the default timeout and interval, got %s and %s", w.timeout, w.interval)
+	}
+	if !cfg.hasWaits() {
+		t.Error("Expected the config to have waits")
+	}
+
+	invalid := map[string]string{
+		"no images":       "stages: [{name: dev, files: [dev]}]\n",
+		"no stages":       "images: {nginx: 1.26.0}\n",
+		"duplicate stage": "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a]}, {name: dev, files: [b]}]\n",
+		"empty wait":      "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a], wait: {timeout: 1m}}]\n",
+		"bad timeout":     "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a], wait: {kube: {}, timeout: soon}}]\n",
+		"bad helmRelease": "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a], wait: {kube: {helmReleases: [app]}}}]\n",
+		"unknown field":   "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a], waitFor: {}}]\n",
+		"bad webhook":     "images: {nginx: 1.26.0}\nstages: [{name: dev, files: [a], wait: {webhook: {url: localhost}}}]\n",
+		"no files":        "images: {nginx: 1.26.0}\nstages: [{name: dev}]\n",
+	}
+	for name, config := range invalid {
+		writeTestFiles(t, dir, map[string]string{"invalid.yaml": config})
+		if _, err := loadTrainConfig(filepath.Join(dir, "invalid.yaml")); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestRunTrain verifies that stages are bumped in order, that a stage is
+// waited for until its webhook reports it healthy, and that the train stops
+// at a stage that does not become healthy.
+func TestRunTrain(t *testing.T) {
+	saved := journalPath
+	journalPath = ""
+	t.Cleanup(func() { journalPath = saved })
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/down":
+			http.Error(w, "dev is degraded", http.StatusServiceUnavailable)
+		case calls.Add(1) < 3:
+			http.Error(w, "rolling out", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	newTrain := func(url string) (*trainConfig, string) {
+		dir := t.TempDir()
+		writeTestFiles(t, dir, map[string]string{
+			"dev/app.yaml":  chartRefHelmRelease,
+			"prod/app.yaml": chartRefHelmRelease,
+		})
+		cfg := &trainConfig{
+			Images: map[string]string{"nginx": "1.26.0"},
+			Stages: []trainStage{
+				{Name: "dev", Files: []string{filepath.Join(dir, "dev")}, Wait: &trainWait{Webhook: &trainWebhookWait{URL: url}, Interval: "10ms", Timeout: "5s"}},
+				{Name: "prod", Files: []string{filepath.Join(dir, "prod")}},
+			},
+		}
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		return cfg, dir
+	}
+
+	cfg, dir := newTrain(srv.URL + "/health")
+	report, err := RunTrain(context.Background(), cfg, false, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(report.Stages) != 2 || report.Stages[0].Status != trainHealthy || report.Stages[1].Status != trainBumped {
+		t.Errorf("Unexpected stages: %+v", report.Stages)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected the webhook to be polled until healthy, got %d calls", calls.Load())
+	}
+	for _, env := range []string{"dev", "prod"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, env, "app.yaml")); !strings.Contains(string(data), `tag: "1.26.0"`) {
+			t.Errorf("Expected %s to be bumped, got:\n%s", env, data)
+		}
+	}
+
+	report, err = RunTrain(context.Background(), cfg, false, nil)
+	if err != nil || report.Stages[0].Status != trainUnchanged || report.Stages[1].Status != trainUnchanged {
+		t.Errorf("Expected an up to date train to be unchanged, got %+v, %v", report.Stages, err)
+	}
+
+	cfg, dir = newTrain(srv.URL + "/down")
+	cfg.Stages[0].Wait.timeout = 50 * cfg.Stages[0].Wait.interval
+	report, err = RunTrain(context.Background(), cfg, false, nil)
+	if err == nil || !strings.Contains(err.Error(), "dev is degraded") {
+		t.Errorf("Expected the dev stage to fail, got %v", err)
+	}
+	if len(report.Stages) != 1 || report.Stages[0].Status != trainUnhealthy {
+		t.Errorf("Expected the train to stop at dev, got %+v", report.Stages)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "prod", "app.yaml")); string(data) != chartRefHelmRelease {
+		t.Errorf("Expected prod to be left untouched, got:\n%s", data)
+	}
+}
+
+// TestCheckHelmReleasesRolledOut verifies that a HelmRelease is only rolled
+// out once it holds the new tags, has reconciled them and is Ready.
+func TestCheckHelmReleasesRolledOut(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yaml")
+	writeTestFiles(t, dir, map[string]string{"app.yaml": strings.Replace(chartRefHelmRelease, `"1.25.0"`, `"1.26.0"`, 1)})
+	files := []fileReport{{File: file, Updated: 1, Changes: []tagChange{{Image: "nginx", Path: "image.tag", OldValue: "1.25.0", NewValue: "1.26.0"}}}}
+	targets, err := trainTargets(nil, files, "default", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(targets) != 1 || targets[0].String() != "apps/app" || len(targets[0].Refs) != 1 {
+		t.Fatalf("Unexpected targets: %+v", targets)
+	}
+
+	live := func(tag string, observed int64, ready string) *kubeClient {
+		hr := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "helm.toolkit.fluxcd.io/v2",
+			"kind":       "HelmRelease",
+			"metadata":   map[string]interface{}{"name": "app", "namespace": "apps", "generation": int64(2)},
+			"spec": map[string]interface{}{
+				"values": map[string]interface{}{
+					"image": map[string]interface{}{"repository": "nginx", "tag": tag},
+				},
+			},
+			"status": map[string]interface{}{
+				"observedGeneration": observed,
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": ready, "message": "upgrade in progress"},
+				},
+			},
+		}}
+		client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{helmReleaseResource(): "HelmReleaseList"}, hr)
+		return &kubeClient{Client: client, Context: "test", Namespace: "default"}
+	}
+
+	tests := []struct {
+		name string
+		kc   *kubeClient
+		want string
+	}{
+		{"old tag", live("1.25.0", 2, "True"), "has nginx:1.25.0 at image"},
+		{"not reconciled", live("1.26.0", 1, "True"), "has not reconciled generation 2"},
+		{"not ready", live("1.26.0", 2, "False"), "is not ready: upgrade in progress"},
+		{"rolled out", live("1.26.0", 2, "True"), ""},
+	}
+	for _, tt := range tests {
+		reason, err := checkHelmReleasesRolledOut(context.Background(), tt.kc, targets)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if (tt.want == "") != (reason == "") || !strings.Contains(reason, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, reason)
+		}
+	}
+
+	missing := []trainTarget{{Namespace: "apps", Name: "other"}}
+	if reason, err := checkHelmReleasesRolledOut(context.Background(), live("1.26.0", 2, "True"), missing); err != nil || !strings.Contains(reason, "not in the cluster") {
+		t.Errorf("Expected a missing HelmRelease to be pending, got %q, %v", reason, err)
+	}
+}
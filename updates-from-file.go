@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// fromFilePath is the --from-file of bump: a list of image updates written
+// by CI, read in addition to --set.
+var fromFilePath string
+
+// parseUpdatesList parses the image updates of a --from-file. The data is
+// either a JSON object mapping repositories to versions, or one update per
+// line in the form repo=version or repo:version (an image reference as
+// printed by docker build). Blank lines and lines starting with # are
+// skipped.
+//
+// Returns:
+//   - The updates as --set arguments, in file order (sorted by repository
+//     for JSON).
+//   - An error naming the line or key that is not a valid update.
+func parseUpdatesList(data []byte) ([]string, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("{")) {
+		var updates map[string]string
+		if err := json.Unmarshal(trimmed, &updates); err != nil {
+			return nil, fmt.Errorf("invalid JSON updates (expected an object of repo: version strings): %w", err)
+		}
+		var pairs []string
+		for _, repo := range sortedKeys(updates) {
+			pair := repo + "=" + updates[repo]
+			if splitArg(pair) == nil {
+				return nil, fmt.Errorf("invalid update %q: %q (expected a repository and a version)", repo, updates[repo])
+			}
+			pairs = append(pairs, pair)
+		}
+		return pairs, nil
+	}
+
+	var pairs []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pair := line
+		if !strings.Contains(line, "=") {
+			// An image reference: the tag follows the last colon after the
+			// last slash, which is not the port of a registry.
+			if i := strings.LastIndex(line, ":"); i > strings.LastIndex(line, "/") {
+				pair = line[:i] + "=" + line[i+1:]
+			}
+		}
+		if splitArg(pair) == nil {
+			return nil, fmt.Errorf("line %d: invalid update %q (expected repo=version or repo:version)", n, line)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, scanner.Err()
+}
+
+// appendUpdatesFromFile adds the updates of --from-file, if set, to the
+// --set arguments. "-" reads them from stdin.
+func appendUpdatesFromFile() error {
+	if fromFilePath == "" {
+		return nil
+	}
+	var data []byte
+	var err error
+	if fromFilePath == stdioFile {
+		if filePath == stdioFile {
+			return fmt.Errorf("--from-file - and --file - cannot both read stdin")
+		}
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fromFilePath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read --from-file: %w", err)
+	}
+	pairs, err := parseUpdatesList(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fromFilePath, err)
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("%s holds no image updates", fromFilePath)
+	}
+	tagArgs = append(tagArgs, pairs...)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseUpdatesList verifies the line and JSON formats of --from-file.
+func TestParseUpdatesList(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{"lines", "# built images\nghcr.io/my-org/my-api=1.8.0\n\nlocalhost:5000/my-org/web-app:1.8.0\r\n", "ghcr.io/my-org/my-api=1.8.0,localhost:5000/my-org/web-app=1.8.0"},
+		{"json", `{"ghcr.io/my-org/web-app": "1.8.0", "ghcr.io/my-org/my-api": "1.7.0"}`, "ghcr.io/my-org/my-api=1.7.0,ghcr.io/my-org/web-app=1.8.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pairs, err := parseUpdatesList([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.Join(pairs, ","); got != tc.want {
+				t.Errorf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	for _, data := range []string{"ghcr.io/my-org/my-api\n", "localhost:5000/my-org/my-api\n", `{"ghcr.io/my-org/my-api": 1}`, `{"ghcr.io/my-org/my-api": ""}`} {
+		if _, err := parseUpdatesList([]byte(data)); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// BumpValuesFile updates the image tags in a plain Helm values file, such as
+// a chart's values.yaml, with the same matchers and options as the
+// .spec.values of a HelmRelease.
+//
+// Only the changed scalars are rewritten, as for HelmReleases (see
+// writeHelmRelease); if that is not possible the values are re-encoded. The
+// file is written atomically under its advisory lock, unless opts.DryRun is
+// set or nothing changes.
+//
+// Parameters:
+//   - filePath: The path to the values YAML file.
+//   - updates: A map where the keys are image names and the values are the new tags to apply.
+//   - opts: The bump options; post-renderers, --values-schema and
+//     --verify-render do not apply to values files.
+//
+// Returns:
+//   - The result of the bump.
+//   - An error if the file cannot be read, parsed or written, is not a values
+//     map, or a change is rejected by opts.Policy or opts.Registry.
+func BumpValuesFile(filePath string, updates map[string]string, opts bumpOptions) (*bumpResult, error) {
+	if !opts.DryRun {
+		unlock, err := acquireFileLock(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if sopsEncrypted(data) {
+		return nil, errSOPSEncrypted
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values: %w", err)
+	}
+	if values == nil {
+		return nil, fmt.Errorf("%s holds no values map", filePath)
+	}
+	valuesRoot := func(root *yamlv3.Node) *yamlv3.Node { return root }
+	opts.Ignore = findIgnoreMarkersAt(data, values, valuesRoot)
+	opts.Anchors = findValueAnchors(data, valuesRoot)
+	opts.ImagePolicies = findImagePolicyMarkers(data, values, valuesRoot)
+
+	result := &bumpResult{}
+	result.Updated, result.Changes, err = applyImageUpdates(values, updates, opts)
+	if err != nil {
+		return nil, locateValuesError(data, err, valuesRoot)
+	}
+	if err := opts.Policy.check(filePath, result.Changes); err != nil {
+		return nil, err
+	}
+	if err := opts.Registry.checkChangesExist(filePath, result.Changes); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		logf("🧪 Dry-run complete. %d potential updates found.\n", result.Updated)
+		return result, nil
+	}
+	if result.Updated == 0 {
+		logln("ℹ️ No image tags were updated.")
+		return result, nil
+	}
+
+	if result.Output, err = writeValues(data, values, yaml.Marshal); err != nil {
+		return nil, err
+	}
+	if err := writeFileWithBackup(filePath, result.Output, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write updated file: %w", err)
+	}
+	logf("✅ Updated %d image(s) in %s\n", result.Updated, filePath)
+	return result, nil
+}
+
+// writeValues returns the YAML (or JSON) data with the edits made to values,
+// rewriting only the changed scalars when possible and encoding values with
+// encode otherwise.
+func writeValues(data []byte, values map[string]interface{}, encode func(interface{}) ([]byte, error)) ([]byte, error) {
+	var original interface{}
+	if err := yaml.Unmarshal(data, &original); err != nil {
+		return nil, fmt.Errorf("failed to parse values: %w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse values: %w", err)
+	}
+
+	var patches []scalarPatch
+	err := diffScalars(yamlDocumentRoot(&doc), original, values, &patches)
+	if err == nil {
+		var out []byte
+		if out, err = applyScalarPatches(data, patches); err == nil {
+			return out, nil
+		}
+	}
+	if !errors.Is(err, errNotPatchable) {
+		return nil, err
+	}
+	warnExpandedAnchors(data)
+	out, err := encode(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	return out, nil
+}
+
+var bumpValuesCmd = &cobra.Command{
+	Use:   "values",
+	Short: "Bump image tags in a plain Helm values file",
+	Long: "Update image tags in a Helm values file such as charts/app/values.yaml, " +
+		"which has no HelmRelease around it, with the same image matching as bump.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := appendUpdatesFromFile(); err != nil {
+			return err
+		}
+		if filePath == "" || len(tagArgs)+len(regexArgs) == 0 {
+			return fmt.Errorf("you must specify --file and at least one --set repo=version (or --set-regex or --from-file)")
+		}
+		updates, regexUpdates, err := parseUpdateArgs(tagArgs, regexArgs)
+		if err != nil {
+			return err
+		}
+		matchers, err := setMatchers(matcherProfile, nil)
+		if err != nil {
+			return err
+		}
+		opts := bumpOptions{DryRun: dryRun, Paths: pathArgs, RegexUpdates: regexUpdates, Matchers: matchers}
+		if opts.Policy, err = loadBumpPolicy(policyPath, allowMajor); err != nil {
+			return err
+		}
+		if checkExists {
+			opts.Registry = newRegistryClient(cmd.Context())
+		}
+
+		result, err := BumpValuesFile(filePath, updates, opts)
+		if err != nil {
+			return fmt.Errorf("failed to bump values: %w", err)
+		}
+		noChangesMade = len(result.Changes) == 0
+		return nil
+	},
+}
+
+func init() {
+	bumpValuesCmd.Flags().StringVarP(&filePath, "file", "f", "", "Path to the values YAML file")
+	bumpValuesCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Image update(s) in the form repo=version; repo may be a glob like ghcr.io/my-org/* (repeatable)")
+	bumpValuesCmd.Flags().StringVar(&fromFilePath, "from-file", "", "Read more updates from this file: one repo=version or repo:version per line, or a JSON object of repo: version (- for stdin)")
+	bumpValuesCmd.Flags().StringArrayVar(&regexArgs, "set-regex", nil, "Image update(s) in the form regex=version, matched against whole repository names (repeatable)")
+	bumpValuesCmd.Flags().StringArrayVar(&pathArgs, "path", nil, "Only update matches at this values path (repeatable)")
+	bumpValuesCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview changes without modifying the file")
+	bumpValuesCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	bumpValuesCmd.Flags().BoolVar(&checkExists, "check-exists", false, "Fail if a new image tag does not exist in its registry, before the file is changed")
+	addPolicyFlags(bumpValuesCmd)
+	bumpCmd.AddCommand(bumpValuesCmd)
+}
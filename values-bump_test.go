@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const chartValues = `# Default values for my-app.
+replicaCount: 2
+
+image:
+  repository: ghcr.io/my-org/my-api
+  tag: "1.7.99" # set by CI
+  pullPolicy: IfNotPresent
+
+sidecar:
+  image: ghcr.io/my-org/envoy:1.26.5
+`
+
+// TestBumpValuesFile verifies that a plain values file is bumped in place,
+// keeping its comments and formatting.
+func TestBumpValuesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(file, []byte(chartValues), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := BumpValuesFile(file, map[string]string{
+		"ghcr.io/my-org/my-api": "1.8.0",
+		"ghcr.io/my-org/envoy":  "1.27.0",
+	}, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Updated != 2 {
+		t.Errorf("Expected 2 updated images, got %d", result.Updated)
+	}
+
+	want := strings.NewReplacer(`"1.7.99"`, `"1.8.0"`, "envoy:1.26.5", "envoy:1.27.0").Replace(chartValues)
+	if data, _ := os.ReadFile(file); string(data) != want {
+		t.Errorf("Unexpected values file:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+// TestBumpValuesFileDryRun verifies that dry-run mode reports changes without
+// writing, and that files without a values map are rejected.
+func TestBumpValuesFileDryRun(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(file, []byte(chartValues), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := BumpValuesFile(file, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Changes) != 1 || result.Changes[0].Path != "image.tag" {
+		t.Errorf("Expected a change at image.tag, got: %+v", result.Changes)
+	}
+	if data, _ := os.ReadFile(file); string(data) != chartValues {
+		t.Errorf("Expected the file to be left unchanged in dry-run mode")
+	}
+
+	empty := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(empty, []byte("# nothing yet\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := BumpValuesFile(empty, map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{}); err == nil {
+		t.Errorf("Expected an error for a file without values")
+	}
+}
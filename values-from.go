@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultValuesKey is the data key Flux reads from a valuesFrom ConfigMap or
+// Secret when the reference does not set valuesKey.
+const defaultValuesKey = "values.yaml"
+
+// valuesReference is a single entry of a HelmRelease's .spec.valuesFrom.
+type valuesReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	ValuesKey  string `json:"valuesKey,omitempty"`
+	TargetPath string `json:"targetPath,omitempty"`
+	Optional   bool   `json:"optional,omitempty"`
+}
+
+// documentSeparator matches a YAML document separator line, ending in LF or
+// CRLF.
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*(#[^\r\n]*)?\r?$`)
+
+// splitYAMLDocuments splits a (possibly multi-document) YAML stream into its
+// documents. Empty documents are kept so that joinYAMLDocuments can rebuild the
+// stream with the same number of documents.
+func splitYAMLDocuments(data []byte) [][]byte {
+	locs := documentSeparator.FindAllIndex(data, -1)
+	docs := make([][]byte, 0, len(locs)+1)
+	start := 0
+	for _, loc := range locs {
+		docs = append(docs, data[start:loc[0]])
+		start = loc[1]
+		if start < len(data) && data[start] == '\n' {
+			start++
+		}
+	}
+	return append(docs, data[start:])
+}
+
+// joinYAMLDocuments is the inverse of splitYAMLDocuments.
+func joinYAMLDocuments(docs [][]byte) []byte {
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteString("\n")
+			}
+			buf.WriteString("---\n")
+		}
+		buf.Write(doc)
+	}
+	return buf.Bytes()
+}
+
+// BumpValuesFromReferences follows the .spec.valuesFrom references of a
+// HelmRelease to ConfigMap and Secret manifests stored next to it and bumps the
+// image tags inside the referenced values.
+//
+// Every *.yaml and *.yml file in the HelmRelease's directory is searched for a ConfigMap or Secret document whose
+// name matches the reference and whose namespace matches the HelmRelease. The
+// values stored under the reference's valuesKey (default "values.yaml") are
+// parsed, bumped with the same logic as .spec.values and written back: as
+// plain text for ConfigMap data and Secret stringData, base64-encoded for
+// Secret data.
+//
+// References with a targetPath hold a single value rather than a values tree
+// and are skipped with a warning.
+//
+// Parameters:
+//   - hrPath: The path to the HelmRelease YAML file.
+//   - updates: A map where the keys are image names and the values are the new tags to apply.
+//   - opts: The bump options (dry-run, path selectors) used for .spec.values.
+//
+// Returns:
+//   - One fileReport per referenced object that was found, listing the changes
+//     applied (or that would be applied in dry-run mode).
+//   - An error if a manifest cannot be read, parsed or written.
+func BumpValuesFromReferences(hrPath string, updates map[string]string, opts bumpOptions) ([]fileReport, error) {
+	return editValuesFromReferences(hrPath, opts.DryRun, func(values map[string]interface{}, report *fileReport) error {
+		var err error
+		opts.Skips = &skipLog{}
+		report.Updated, report.Changes, err = applyImageUpdates(values, updates, opts)
+		if err != nil {
+			return err
+		}
+		report.Skipped = opts.Skips.list()
+		if err := opts.Policy.check(report.File, report.Changes); err != nil {
+			return err
+		}
+		return opts.Registry.checkChangesExist(report.File, report.Changes)
+	})
+}
+
+// editValuesFromReferences follows the .spec.valuesFrom references of the
+// HelmRelease at hrPath to the ConfigMap and Secret manifests stored next to
+// it and passes the values of each one found to edit, see
+// editValuesReferenceInFile.
+//
+// Returns:
+//   - One fileReport per referenced object that was found.
+//   - An error if a manifest cannot be read, parsed or written, or edit fails.
+func editValuesFromReferences(hrPath string, dryRun bool, edit func(values map[string]interface{}, report *fileReport) error) ([]fileReport, error) {
+	data, err := os.ReadFile(hrPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var hr struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			ValuesFrom []valuesReference `json:"valuesFrom"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &hr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HelmRelease: %w", err)
+	}
+	if len(hr.Spec.ValuesFrom) == 0 {
+		logln("ℹ️ HelmRelease has no .spec.valuesFrom references")
+		return nil, nil
+	}
+
+	candidates, err := siblingManifestFiles(hrPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []fileReport
+	for _, ref := range hr.Spec.ValuesFrom {
+		if ref.Kind != "ConfigMap" && ref.Kind != "Secret" {
+			logf("⚠️ Unsupported valuesFrom kind %q for %s, skipping\n", ref.Kind, ref.Name)
+			continue
+		}
+		if ref.TargetPath != "" {
+			logf("⚠️ valuesFrom %s/%s uses targetPath %s, skipping\n", ref.Kind, ref.Name, ref.TargetPath)
+			continue
+		}
+		if ref.ValuesKey == "" {
+			ref.ValuesKey = defaultValuesKey
+		}
+
+		found := false
+		for _, file := range candidates {
+			report, err := editValuesReferenceInFile(file, hr.Metadata.Namespace, ref, dryRun, edit)
+			if err != nil {
+				return reports, err
+			}
+			if report != nil {
+				found = true
+				reports = append(reports, *report)
+				break
+			}
+		}
+
+		if !found {
+			if ref.Optional {
+				logf("ℹ️ Optional valuesFrom %s/%s not found next to %s\n", ref.Kind, ref.Name, hrPath)
+			} else {
+				logf("⚠️ valuesFrom %s/%s not found next to %s\n", ref.Kind, ref.Name, hrPath)
+			}
+		}
+	}
+
+	return reports, nil
+}
+
+// siblingManifestFiles lists the YAML files in the directory of path.
+func siblingManifestFiles(path string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list manifests next to %s: %w", path, err)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// editValuesReferenceInFile looks for the ConfigMap or Secret described by ref
+// in file, decodes the values stored under ref.ValuesKey and passes them to
+// edit. If edit records any change in the report and dryRun is false, the
+// values are encoded again and the file is atomically rewritten under its
+// advisory lock, leaving its other documents untouched.
+//
+// Returns:
+//   - The fileReport filled in by edit, or nil if the referenced object is not in file.
+//   - An error if the file cannot be read or written, the object is malformed, or edit fails.
+func editValuesReferenceInFile(file, namespace string, ref valuesReference, dryRun bool, edit func(values map[string]interface{}, report *fileReport) error) (*fileReport, error) {
+	if !dryRun {
+		unlock, err := acquireFileLock(file)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if ref.ValuesKey == "" {
+		ref.ValuesKey = defaultValuesKey
+	}
+
+	docs := splitYAMLDocuments(data)
+	for i, doc := range docs {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil || obj == nil {
+			continue
+		}
+
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		objNamespace, _ := metadata["namespace"].(string)
+		if obj["kind"] != ref.Kind || metadata["name"] != ref.Name || (objNamespace != "" && objNamespace != namespace) {
+			continue
+		}
+
+		logf("🔗 Following valuesFrom %s/%s in %s\n", ref.Kind, ref.Name, file)
+		report := &fileReport{
+			File:      file,
+			Object:    ref.Kind + "/" + ref.Name,
+			Namespace: namespace,
+			ValuesKey: ref.ValuesKey,
+		}
+		if _, ok := obj["sops"]; ok {
+			logf("⚠️ %s/%s in %s is SOPS-encrypted, skipping\n", ref.Kind, ref.Name, file)
+			return report, nil
+		}
+
+		field, encoded := "data", ref.Kind == "Secret"
+		if ref.Kind == "Secret" {
+			if stringData, ok := obj["stringData"].(map[string]interface{}); ok {
+				if _, ok := stringData[ref.ValuesKey]; ok {
+					field, encoded = "stringData", false
+				}
+			}
+		}
+
+		dataMap, _ := obj[field].(map[string]interface{})
+		rawValues, ok := dataMap[ref.ValuesKey].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s in %s has no %s key %q", ref.Kind, ref.Name, file, field, ref.ValuesKey)
+		}
+		if encoded {
+			decoded, err := base64.StdEncoding.DecodeString(rawValues)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s/%s %s.%s: %w", ref.Kind, ref.Name, field, ref.ValuesKey, err)
+			}
+			rawValues = string(decoded)
+		}
+
+		var values map[string]interface{}
+		if err := yaml.Unmarshal([]byte(rawValues), &values); err != nil || values == nil {
+			logf("⚠️ %s/%s %s.%s is not a values map, skipping\n", ref.Kind, ref.Name, field, ref.ValuesKey)
+			return report, nil
+		}
+
+		if err := edit(values, report); err != nil {
+			return nil, err
+		}
+
+		if dryRun || len(report.Changes) == 0 {
+			return report, nil
+		}
+
+		newValues, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal values for %s/%s: %w", ref.Kind, ref.Name, err)
+		}
+		if encoded {
+			dataMap[ref.ValuesKey] = base64.StdEncoding.EncodeToString(newValues)
+		} else {
+			dataMap[ref.ValuesKey] = string(newValues)
+		}
+
+		newDoc, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s/%s: %w", ref.Kind, ref.Name, err)
+		}
+		docs[i] = newDoc
+
+		if err := writeFileWithBackup(file, joinYAMLDocuments(docs), 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file, err)
+		}
+		logf("✅ Updated %d value(s) in %s/%s (%s)\n", len(report.Changes), ref.Kind, ref.Name, file)
+		return report, nil
+	}
+
+	return nil, nil
+}
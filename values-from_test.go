@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpValuesFromReferences verifies that valuesFrom references are followed
+// to sibling ConfigMap and Secret manifests and that the values inside them are
+// bumped, decoding and re-encoding base64 Secret data.
+func TestBumpValuesFromReferences(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"helmrelease.yaml", "values.yaml"} {
+		data, err := os.ReadFile(filepath.Join("test_files/values-from", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write fixture copy: %v", err)
+		}
+	}
+
+	updates := map[string]string{"ghcr.io/my-org/worker": "1.0.0"}
+	reports, err := BumpValuesFromReferences(filepath.Join(dir, "helmrelease.yaml"), updates, bumpOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Updated != 1 || reports[1].Updated != 1 {
+		t.Errorf("Expected one update each in the ConfigMap and Secret, got: %+v", reports)
+	}
+
+	out, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	docs := splitYAMLDocuments(out)
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents to be preserved, got: %d", len(docs))
+	}
+	if !strings.Contains(string(docs[0]), "worker: ghcr.io/my-org/worker:1.0.0") {
+		t.Errorf("Expected ConfigMap values to be bumped, got:\n%s", docs[0])
+	}
+
+	wantSecret := base64.StdEncoding.EncodeToString([]byte("worker:\n  image:\n    repository: ghcr.io/my-org/worker\n    tag: 1.0.0\n"))
+	if !strings.Contains(string(docs[1]), wantSecret) {
+		t.Errorf("Expected Secret values to be bumped and re-encoded, got:\n%s", docs[1])
+	}
+}
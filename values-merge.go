@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// List strategies of values merge, selected with --lists.
+const (
+	// listsReplace replaces a list with the overlay's, as Helm does.
+	listsReplace = "replace"
+	// listsAppend appends the overlay's items to the list.
+	listsAppend = "append"
+	// listsMergeByName deep-merges the map items that share a "name" with an
+	// item of the overlay, and appends the other overlay items.
+	listsMergeByName = "merge-by-name"
+)
+
+var (
+	mergeOutputPath string
+	mergeLists      string
+)
+
+// validateListStrategy returns an error if lists is not a --lists strategy.
+func validateListStrategy(lists string) error {
+	switch lists {
+	case listsReplace, listsAppend, listsMergeByName:
+		return nil
+	}
+	return fmt.Errorf("unsupported list strategy %q (expected %s, %s or %s)", lists, listsReplace, listsAppend, listsMergeByName)
+}
+
+// mergeValues deep-merges overlay into base the way Helm coalesces values:
+// maps are merged key by key, a null in overlay deletes the key, and any
+// other value of overlay replaces that of base. Lists are combined according
+// to lists. base is modified in place and returned.
+func mergeValues(base, overlay map[string]interface{}, lists string) map[string]interface{} {
+	if base == nil {
+		base = map[string]interface{}{}
+	}
+	for key, value := range overlay {
+		if value == nil {
+			delete(base, key)
+			continue
+		}
+		base[key] = mergeValue(base[key], value, lists)
+	}
+	return base
+}
+
+// mergeValue returns the merge of overlay over base, see mergeValues.
+func mergeValue(base, overlay interface{}, lists string) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		if b, ok := base.(map[string]interface{}); ok {
+			return mergeValues(b, o, lists)
+		}
+		return mergeValues(nil, o, lists)
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok {
+			return o
+		}
+		switch lists {
+		case listsAppend:
+			return append(b, o...)
+		case listsMergeByName:
+			return mergeListByName(b, o, lists)
+		}
+		return o
+	}
+	return overlay
+}
+
+// mergeListByName merges the map items of overlay into the items of base
+// with the same "name", and appends the overlay items that have none.
+func mergeListByName(base, overlay []interface{}, lists string) []interface{} {
+	index := map[string]int{}
+	for i, item := range base {
+		if name, ok := listItemName(item); ok {
+			index[name] = i
+		}
+	}
+	for _, item := range overlay {
+		name, ok := listItemName(item)
+		if i, found := index[name]; ok && found {
+			base[i] = mergeValue(base[i], item, lists)
+			continue
+		}
+		base = append(base, item)
+	}
+	return base
+}
+
+// listItemName returns the "name" of a map list item.
+func listItemName(item interface{}) (string, bool) {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok
+}
+
+// loadValuesLayer reads a layer of values merge: a values file, or a
+// HelmRelease manifest whose .spec.values are used.
+func loadValuesLayer(file string) (map[string]interface{}, error) {
+	data, err := readManifestFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if manifestKind(data) == "HelmRelease" {
+		hr, err := decodeHelmRelease(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		values, err := helmReleaseValues(hr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return values, nil
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse values: %w", file, err)
+	}
+	return values, nil
+}
+
+// MergeValuesFiles merges the values of files, each over the result of the
+// ones before it, like `helm install -f base.yaml -f overlay.yaml`.
+//
+// Parameters:
+//   - files: The values files or HelmRelease manifests, base first.
+//   - lists: The list strategy, see mergeValues.
+//
+// Returns:
+//   - The merged values.
+//   - An error if a file cannot be read or parsed.
+func MergeValuesFiles(files []string, lists string) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, file := range files {
+		values, err := loadValuesLayer(file)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeValues(merged, values, lists)
+	}
+	return merged, nil
+}
+
+// valuesCmd groups the commands that work on plain Helm values.
+var valuesCmd = &cobra.Command{
+	Use:   "values",
+	Short: "Helm values helpers",
+}
+
+var valuesMergeCmd = &cobra.Command{
+	Use:   "merge BASE OVERLAY...",
+	Short: "Deep-merge layered values files the way Helm does",
+	Long: `Merge values files (or the .spec.values of HelmRelease manifests) in order,
+each over the result of the ones before it, and print the effective values.
+
+Maps are merged key by key, a null deletes the key, and other values replace
+those below them. Lists are replaced by default, as in Helm; --lists append
+concatenates them and --lists merge-by-name merges the items that share a
+"name" (such as containers or env entries).`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateListStrategy(mergeLists); err != nil {
+			return err
+		}
+		merged, err := MergeValuesFiles(args, mergeLists)
+		if err != nil {
+			return fmt.Errorf("failed to merge values: %w", err)
+		}
+		out, err := yaml.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("failed to marshal merged values: %w", err)
+		}
+		if mergeOutputPath == "" || mergeOutputPath == stdioFile {
+			_, err := os.Stdout.Write(out)
+			return err
+		}
+		if err := writeFileAtomic(mergeOutputPath, out, 0644); err != nil {
+			return fmt.Errorf("failed to write merged values: %w", err)
+		}
+		logf("💾 Wrote merged values of %s to %s\n", strings.Join(args, ", "), mergeOutputPath)
+		return nil
+	},
+}
+
+func init() {
+	valuesMergeCmd.Flags().StringVarP(&mergeOutputPath, "output", "o", "", "Write the merged values to this file (default: stdout)")
+	_ = markLocalSettings(valuesMergeCmd, "output")
+	valuesMergeCmd.Flags().StringVar(&mergeLists, "lists", listsReplace, "How lists are merged: replace (as Helm does), append or merge-by-name")
+
+	valuesCmd.AddCommand(valuesMergeCmd)
+	rootCmd.AddCommand(valuesCmd)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TestMergeValuesFiles verifies Helm-style deep merging of a HelmRelease and
+// a values overlay, with each list strategy.
+func TestMergeValuesFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "hr.yaml")
+	overlay := filepath.Join(dir, "overlay.yaml")
+	if err := os.WriteFile(base, []byte(`apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    replicas: 2
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.7.0
+    debug:
+      enabled: true
+    containers:
+      - name: app
+        env: prod
+      - name: proxy
+`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(overlay, []byte(`image:
+  tag: 1.8.0
+debug: null
+containers:
+  - name: app
+    env: canary
+  - name: sidecar
+`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := map[string]string{
+		listsReplace: `containers:
+- env: canary
+  name: app
+- name: sidecar
+`,
+		listsAppend: `containers:
+- env: prod
+  name: app
+- name: proxy
+- env: canary
+  name: app
+- name: sidecar
+`,
+		listsMergeByName: `containers:
+- env: canary
+  name: app
+- name: proxy
+- name: sidecar
+`,
+	}
+	for lists, containers := range tests {
+		t.Run(lists, func(t *testing.T) {
+			merged, err := MergeValuesFiles([]string{base, overlay}, lists)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var want map[string]interface{}
+			if err := yaml.Unmarshal([]byte(`replicas: 2
+image:
+  repository: ghcr.io/my-org/my-api
+  tag: 1.8.0
+`+containers), &want); err != nil {
+				t.Fatalf("Failed to parse expected values: %v", err)
+			}
+			if !reflect.DeepEqual(merged, want) {
+				got, _ := yaml.Marshal(merged)
+				t.Errorf("Unexpected merged values:\n%s", got)
+			}
+		})
+	}
+
+	if err := validateListStrategy("zip"); err == nil {
+		t.Errorf("Expected an unknown list strategy to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// valuesSchema is the JSON Schema that the values of bumped HelmReleases must
+// satisfy, taken either from a chart directory or from a values.schema.json
+// file.
+type valuesSchema struct {
+	// Source is the chart directory or schema file the schema was loaded from.
+	Source string
+	// chart is set when the schema was loaded from a chart directory; its
+	// default values are merged in before validation and subchart schemas
+	// are checked too, as Helm does at install time.
+	chart *chart.Chart
+	// schema is the raw JSON Schema when it was loaded from a single file.
+	schema []byte
+}
+
+// loadValuesSchema loads the values schema at path, which is either a Helm
+// chart directory (or packaged chart) shipping a values.schema.json, or a
+// values.schema.json file.
+//
+// Parameters:
+//   - path: The chart directory, chart archive or schema file.
+//
+// Returns:
+//   - The loaded schema.
+//   - An error if path cannot be read, the chart has no values.schema.json or
+//     the schema is not valid JSON.
+func loadValuesSchema(path string) (*valuesSchema, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values schema: %w", err)
+	}
+
+	if info.IsDir() || filepath.Ext(path) == ".tgz" {
+		chrt, err := loader.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chart %s: %w", path, err)
+		}
+		if len(chrt.Schema) == 0 {
+			return nil, fmt.Errorf("chart %s has no values.schema.json", path)
+		}
+		return &valuesSchema{Source: path, chart: chrt}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values schema: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("values schema %s is not valid JSON", path)
+	}
+	return &valuesSchema{Source: path, schema: data}, nil
+}
+
+// Validate checks values against the schema. When the schema comes from a
+// chart, values are first merged over the chart's default values so that
+// required keys provided by the chart are not reported.
+func (s *valuesSchema) Validate(values map[string]interface{}) error {
+	if s.chart == nil {
+		return chartutil.ValidateAgainstSingleSchema(values, s.schema)
+	}
+
+	merged, err := chartutil.CoalesceValues(s.chart, values)
+	if err != nil {
+		return fmt.Errorf("failed to merge chart default values: %w", err)
+	}
+	return chartutil.ValidateAgainstSchema(s.chart, merged)
+}
+
+// checkValuesSchema validates bumped values against opts.Schema, if any.
+//
+// A violation is an error, unless opts.Force is set, in which case it is only
+// reported as a warning.
+func checkValuesSchema(values map[string]interface{}, opts bumpOptions) error {
+	if opts.Schema == nil {
+		return nil
+	}
+	err := opts.Schema.Validate(values)
+	if err == nil {
+		return nil
+	}
+	if opts.Force {
+		logf("⚠️ Updated values violate the schema of %s, writing anyway (--force):\n%v\n", opts.Schema.Source, err)
+		return nil
+	}
+	return fmt.Errorf("updated values violate the schema of %s (use --force to write anyway): %w", opts.Schema.Source, err)
+}
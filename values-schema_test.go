@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBumpValuesSchema verifies that a bump violating the values schema is
+// refused without touching the file, that --force writes it anyway, and that
+// chart directories are validated with the chart's default values merged in.
+func TestBumpValuesSchema(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "helmrelease.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	schemaFile := "test_files/values-schema/values.schema.json"
+	set := updateSet{
+		Files:        []string{file},
+		Images:       map[string]string{"ghcr.io/my-org/my-api": "1.8.0-rc.1"},
+		ValuesSchema: schemaFile,
+	}
+	if _, err := runBumpSets([]updateSet{set}, false, false); err == nil || !strings.Contains(err.Error(), "violate the schema") {
+		t.Fatalf("Expected a schema violation error, got: %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != string(original) {
+		t.Errorf("Expected the file to be left untouched, got:\n%s", data)
+	}
+
+	set.Force = true
+	if _, err := runBumpSets([]updateSet{set}, false, false); err != nil {
+		t.Fatalf("Unexpected error with Force: %v", err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "tag: 1.8.0-rc.1") {
+		t.Errorf("Expected the tag to be written with Force, got:\n%s", data)
+	}
+
+	set = updateSet{Files: []string{file}, Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, ValuesSchema: schemaFile}
+	if _, err := runBumpSets([]updateSet{set}, false, false); err != nil {
+		t.Errorf("Unexpected error for a valid tag: %v", err)
+	}
+
+	// A chart directory: the schema requires image.pullPolicy, which only the
+	// chart's values.yaml provides.
+	chartDir := copyTestChart(t)
+	schema := `{"type":"object","properties":{"image":{"type":"object","required":["pullPolicy"],"properties":{"pullPolicy":{"type":"string"}}}}}`
+	if err := os.WriteFile(filepath.Join(chartDir, "values.schema.json"), []byte(schema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	s, err := loadValuesSchema(chartDir)
+	if err != nil {
+		t.Fatalf("Failed to load chart schema: %v", err)
+	}
+	values := map[string]interface{}{"image": map[string]interface{}{"repository": "nginx", "tag": "1.0.0"}}
+	if err := s.Validate(values); err != nil {
+		t.Errorf("Expected chart defaults to satisfy the schema, got: %v", err)
+	}
+	values["image"].(map[string]interface{})["pullPolicy"] = 3
+	if err := s.Validate(values); err == nil {
+		t.Errorf("Expected a violation for a non-string pullPolicy")
+	}
+
+	if _, err := loadValuesSchema("test_files/test_chart"); err == nil {
+		t.Errorf("Expected an error for a chart without values.schema.json")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// maxRenderDifferences caps the unexpected differences listed in a
+// verification failure.
+const maxRenderDifferences = 20
+
+// renderImageLine matches a rendered line that sets a container image, e.g.
+// `image: "ghcr.io/my-org/my-api:1.4.0"` or `- image: nginx:1.25.0`.
+var renderImageLine = regexp.MustCompile(`^\s*(-\s+)?["']?image["']?:\s`)
+
+// renderVerifier checks that a bump changes nothing but image references in
+// the manifests a chart renders.
+type renderVerifier struct {
+	// ChartDir is the chart directory (or packaged chart) rendered.
+	ChartDir string
+	// Warn reports unexpected differences as a warning instead of an error.
+	Warn  bool
+	chart *chart.Chart
+	// mu serializes renders, which share the loaded chart, for --concurrency.
+	mu sync.Mutex
+}
+
+// loadRenderVerifier loads the chart in chartDir for render verification.
+func loadRenderVerifier(chartDir string, warn bool) (*renderVerifier, error) {
+	ch, err := loader.Load(chartDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart %s: %w", chartDir, err)
+	}
+	return &renderVerifier{ChartDir: chartDir, Warn: warn, chart: ch}, nil
+}
+
+// renderDifferences renders the chart with before and after and returns
+// every difference that is not an image reference, as "template: -line" or
+// "template: +line".
+func (v *renderVerifier) renderDifferences(releaseName, namespace string, before, after map[string]interface{}) ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	oldManifests, err := renderChart(v.chart, before, releaseName, namespace, nil)
+	if err != nil {
+		return nil, fmt.Errorf("with the current values: %w", err)
+	}
+	newManifests, err := renderChart(v.chart, after, releaseName, namespace, nil)
+	if err != nil {
+		return nil, fmt.Errorf("with the updated values: %w", err)
+	}
+
+	oldByName := map[string]string{}
+	for _, m := range oldManifests {
+		oldByName[m.Name] = m.Content
+	}
+	newByName := map[string]string{}
+	for _, m := range newManifests {
+		newByName[m.Name] = m.Content
+	}
+	names := make([]string, 0, len(oldByName)+len(newByName))
+	for name := range oldByName {
+		names = append(names, name)
+	}
+	for name := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var differences []string
+	for _, name := range names {
+		oldContent, inOld := oldByName[name]
+		newContent, inNew := newByName[name]
+		switch {
+		case !inOld:
+			differences = append(differences, name+": template is now rendered")
+			continue
+		case !inNew:
+			differences = append(differences, name+": template is no longer rendered")
+			continue
+		case oldContent == newContent:
+			continue
+		}
+		for _, op := range diffLines(splitLines(oldContent), splitLines(newContent)) {
+			if op.kind != ' ' && !renderImageLine.MatchString(op.line) {
+				differences = append(differences, fmt.Sprintf("%s: %c%s", name, op.kind, strings.TrimRight(op.line, "\n")))
+			}
+		}
+	}
+	return differences, nil
+}
+
+// checkRender verifies, with opts.VerifyRender, that going from before to
+// after only changes image references in the rendered chart of the release.
+//
+// Unexpected differences are an error, or a warning when the verifier is in
+// warn mode.
+func checkRender(releaseName, namespace string, before, after map[string]interface{}, opts bumpOptions) error {
+	v := opts.VerifyRender
+	if v == nil {
+		return nil
+	}
+	differences, err := v.renderDifferences(releaseName, namespace, before, after)
+	if err != nil {
+		return fmt.Errorf("failed to render %s for verification: %w", v.ChartDir, err)
+	}
+	if len(differences) == 0 {
+		logf("🔍 Rendered %s: only image references change\n", v.ChartDir)
+		return nil
+	}
+
+	listed := differences
+	if len(listed) > maxRenderDifferences {
+		listed = append(listed[:maxRenderDifferences:maxRenderDifferences], fmt.Sprintf("... and %d more", len(differences)-maxRenderDifferences))
+	}
+	summary := "  " + strings.Join(listed, "\n  ")
+	if v.Warn {
+		logf("⚠️ Rendered %s changes more than image references:\n%s\n", v.ChartDir, summary)
+		return nil
+	}
+	return fmt.Errorf("rendered %s changes more than image references (use --verify-render-warn to only warn):\n%s", v.ChartDir, summary)
+}
+
+// verifyBumpRender runs checkRender for the changes a bump made (or, in
+// dry-run mode, would make) to the .spec.values of hr. The changes are
+// replayed on a fresh copy of the values, so hr must not have been re-encoded
+// yet.
+func verifyBumpRender(hr *helmReleaseManifest, changes []tagChange, opts bumpOptions) error {
+	before, err := helmReleaseValues(hr)
+	if err != nil {
+		return err
+	}
+	after, err := helmReleaseValues(hr)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		replaceValueAtPath(after, c.Path, c.OldValue, c.NewValue)
+	}
+	releaseName, namespace := hr.ReleaseIdentity()
+	return checkRender(releaseName, namespace, before, after, opts)
+}
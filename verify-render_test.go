@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVerifyRender verifies that a bump which only changes image references
+// in the rendered chart passes, and one whose tag flows into other fields
+// fails, or only warns in warn mode.
+func TestVerifyRender(t *testing.T) {
+	data, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	updates := map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}
+
+	verifier, err := loadRenderVerifier("test_files/test_chart", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, dryRun := range []bool{true, false} {
+		if _, err := bumpHelmReleaseData(data, updates, bumpOptions{DryRun: dryRun, VerifyRender: verifier}); err != nil {
+			t.Errorf("Expected an image-only change to pass (dry-run %t), got: %v", dryRun, err)
+		}
+	}
+
+	// A chart that also uses the tag as a label and an environment variable.
+	chartDir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: leaky-chart\nversion: 0.1.0\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+  labels:
+    app.kubernetes.io/version: {{ .Values.image.tag | quote }}
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+          env:
+            - name: FEATURE_SET
+              value: {{ .Values.image.tag | quote }}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(chartDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifier, err = loadRenderVerifier(chartDir, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = bumpHelmReleaseData(data, updates, bumpOptions{DryRun: true, VerifyRender: verifier})
+	if err == nil {
+		t.Fatal("Expected the verification to fail when the tag flows into other fields")
+	}
+	for _, want := range []string{`-    app.kubernetes.io/version: "1.7.99"`, `+              value: "1.8.0"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to list %q, got: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "image:") {
+		t.Errorf("Expected image lines to be allowed, got: %v", err)
+	}
+
+	verifier.Warn = true
+	result, err := bumpHelmReleaseData(data, updates, bumpOptions{VerifyRender: verifier})
+	if err != nil || result.Output == nil {
+		t.Errorf("Expected warn mode to write the bump, got %v, err %v", result, err)
+	}
+}
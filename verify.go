@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyFiles []string
+	verifyDir   string
+)
+
+// versionCheck is the outcome of comparing one image reference with the
+// version it is expected to have.
+type versionCheck struct {
+	File string `json:"file"`
+	// Path is the location of the checked scalar, as reported for changes;
+	// it is empty when the image was not found in any file.
+	Path     string `json:"path,omitempty"`
+	Image    string `json:"image"`
+	Expected string `json:"expected"`
+	// Actual is the current tag, without a digest.
+	Actual string `json:"actual,omitempty"`
+	OK     bool   `json:"ok"`
+}
+
+// verifyUpdateSets compares the image references in the files of every
+// update set with the versions of the set, without changing anything. Images
+// are matched like bump matches them, including globs, regular expressions
+// and --path selectors; pinned references (see findIgnoreMarkers) are not
+// checked. An explicitly named image that is not referenced (or pinned) in any
+// file of its set fails with an empty Path.
+//
+// Returns:
+//   - One versionCheck per checked reference, in file order.
+//   - An error if a file cannot be read or parsed, or a pattern is malformed.
+func verifyUpdateSets(sets []updateSet) ([]versionCheck, error) {
+	checks := []versionCheck{}
+	for _, set := range sets {
+		files, err := expandFileGlobs(set.Files)
+		if err != nil {
+			return nil, err
+		}
+		found := map[string]bool{}
+		bar := startProgress("verify", "file", len(files))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file: %w", err)
+			}
+			fileChecks, err := verifyHelmRelease(file, data, set, found)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			checks = append(checks, fileChecks...)
+			bar.Increment()
+		}
+		bar.Done()
+		for _, image := range sortedKeys(set.Images) {
+			if !isImageGlob(image) && !found[image] {
+				checks = append(checks, versionCheck{File: strings.Join(files, ", "), Image: image, Expected: set.Images[image]})
+			}
+		}
+	}
+	return checks, nil
+}
+
+// verifyHelmRelease checks the image references of the HelmRelease YAML data
+// against the versions of set, recording every image it references, checked
+// or pinned, in found.
+func verifyHelmRelease(file string, data []byte, set updateSet, found map[string]bool) ([]versionCheck, error) {
+	if helmReleaseIgnored(data) {
+		logf("📌 %s is pinned with %s, skipping\n", file, ignoreAnnotation)
+		return nil, nil
+	}
+	opts := set.options(true)
+
+	var checks []versionCheck
+	_, err := rewriteHelmReleaseValues(data, func(values map[string]interface{}, postRenderers *postRendererView) error {
+		ignore := findIgnoreMarkers(data, values)
+		resolved, err := resolveImagePatterns(set.Images, set.ImagesRegex, func() []string {
+			repos := collectImageRepositories(values, opts.Matchers)
+			if postRenderers != nil {
+				repos = append(repos, postRenderers.repositories(opts.Matchers)...)
+			}
+			return repos
+		})
+		if err != nil {
+			return err
+		}
+		claimed := scopedPaths(resolved)
+		for _, key := range sortedKeys(resolved) {
+			image, scope := splitScopedImage(key)
+			matches := findImageBlocks(values, image, opts.Matchers)
+			if postRenderers != nil {
+				matches = append(matches, postRenderers.findImages(image, opts.Matchers)...)
+			}
+			for _, m := range matches {
+				if !updateSelects(m, scope, opts.Paths, claimed[image]) {
+					continue
+				}
+				found[key] = true
+				if ignore.ignores(m) {
+					continue
+				}
+				check := versionCheck{File: file, Path: m.Path, Image: image, Expected: resolved[key]}
+				if m.Block != nil {
+					check.Path = joinValuesPath(m.Path, m.TagKey)
+					check.Actual = fmt.Sprint(m.Block[m.TagKey])
+				} else {
+					check.Actual = strings.TrimPrefix(m.Value, image+":")
+				}
+				check.Actual, _, _ = strings.Cut(check.Actual, "@")
+				check.OK = check.Actual == check.Expected
+				checks = append(checks, check)
+			}
+		}
+		return nil
+	})
+	return checks, err
+}
+
+// printVersionChecks logs every check and returns the number that failed.
+func printVersionChecks(checks []versionCheck) int {
+	failed := 0
+	for _, c := range checks {
+		switch {
+		case c.OK:
+			logf("✅ %s: %s %s is at %s\n", c.File, c.Path, c.Image, c.Actual)
+		case c.Path == "":
+			failed++
+			logf("❌ %s: %s is not referenced, expected %s\n", c.File, c.Image, c.Expected)
+		default:
+			failed++
+			logf("❌ %s: %s %s is at %s, expected %s\n", c.File, c.Path, c.Image, c.Actual, c.Expected)
+		}
+	}
+	return failed
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that manifests already contain the expected image versions",
+	Long: "Compare the image tags in HelmRelease manifests with expected versions, " +
+		"without changing anything, and fail if any differs: a post-merge check that " +
+		"a bump landed everywhere.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return err
+		}
+		var sets []updateSet
+		if updatesFilePath != "" {
+			if len(verifyFiles)+len(tagArgs)+len(regexArgs)+len(pathArgs) > 0 || verifyDir != "" {
+				return fmt.Errorf("--updates-file cannot be combined with --file, --dir, --set, --set-regex or --path")
+			}
+			uf, err := loadUpdatesFile(updatesFilePath)
+			if err != nil {
+				return err
+			}
+			if err := resolveImageRanges(newRegistryClient(cmd.Context()), uf.Updates); err != nil {
+				return err
+			}
+			sets = uf.Updates
+		} else {
+			if len(verifyFiles) == 0 && verifyDir == "" || len(tagArgs)+len(regexArgs) == 0 {
+				return fmt.Errorf("you must specify --file or --dir and at least one --set repo=version (or --set-regex), or --updates-file")
+			}
+			updates, regexUpdates, err := parseUpdateArgs(tagArgs, regexArgs)
+			if err != nil {
+				return err
+			}
+			files := verifyFiles
+			if verifyDir != "" {
+				found, err := helmReleaseFilesInDir(verifyDir)
+				if err != nil {
+					return fmt.Errorf("failed to scan %s: %w", verifyDir, err)
+				}
+				files = append(files, found...)
+			}
+			sets = []updateSet{{Files: files, Images: updates, ImagesRegex: regexUpdates, Paths: pathArgs, MatcherProfile: matcherProfile}}
+			if err := validateUpdateSets(sets); err != nil {
+				return err
+			}
+		}
+
+		if outputFormat == outputJSON {
+			logOut = os.Stderr
+		}
+		checks, err := verifyUpdateSets(sets)
+		if err != nil {
+			return fmt.Errorf("failed to verify: %w", err)
+		}
+		failed := printVersionChecks(checks)
+		if outputFormat == outputJSON {
+			if err := writeJSON(os.Stdout, checks); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d image reference(s) do not have the expected version", failed, len(checks))
+		}
+		if len(checks) == 0 {
+			return fmt.Errorf("no image references matched the expected versions")
+		}
+		logf("🎉 All %d image reference(s) have the expected version\n", len(checks))
+		return nil
+	},
+}
+
+func init() {
+	verifyCmd.Flags().StringArrayVarP(&verifyFiles, "file", "f", nil, "HelmRelease YAML file(s) to check; globs are expanded (repeatable)")
+	verifyCmd.Flags().StringVar(&verifyDir, "dir", "", "Check every HelmRelease YAML file below this directory")
+	verifyCmd.Flags().StringArrayVar(&tagArgs, "set", nil, "Expected version(s) in the form repo=version; repo may be a glob like ghcr.io/my-org/* (repeatable)")
+	verifyCmd.Flags().StringArrayVar(&regexArgs, "set-regex", nil, "Expected version(s) in the form regex=version, matched against whole repository names (repeatable)")
+	verifyCmd.Flags().StringArrayVar(&pathArgs, "path", nil, "Only check matches at this .spec.values path (repeatable)")
+	verifyCmd.Flags().StringVar(&updatesFilePath, "updates-file", "", "Check the files and versions of this updates file instead")
+	verifyCmd.Flags().StringVar(&matcherProfile, "matcher-profile", defaultMatcherProfile, "Image reference shapes to recognise: default, extended or none")
+	verifyCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text or json (the checks)")
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const verifyManifest = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+  values:
+    image:
+      repository: ghcr.io/my-org/my-api
+      tag: 1.4.0
+    images:
+      worker: ghcr.io/my-org/worker:1.3.9
+      legacy: ghcr.io/my-org/legacy:0.9.0 # flux-helpers:ignore
+`
+
+// TestVerifyUpdateSets verifies that mismatched references and images missing
+// from every file fail, and that pinned references are skipped.
+func TestVerifyUpdateSets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	if err := os.WriteFile(file, []byte(verifyManifest), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	checks, err := verifyUpdateSets([]updateSet{{
+		Files: []string{file},
+		Images: map[string]string{
+			"ghcr.io/my-org/*":      "1.4.0",
+			"ghcr.io/my-org/legacy": "1.0.0",
+			"ghcr.io/my-org/web":    "2.0.0",
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []versionCheck{
+		{File: file, Path: "image.tag", Image: "ghcr.io/my-org/my-api", Expected: "1.4.0", Actual: "1.4.0", OK: true},
+		{File: file, Path: "images.worker", Image: "ghcr.io/my-org/worker", Expected: "1.4.0", Actual: "1.3.9"},
+		{File: file, Image: "ghcr.io/my-org/web", Expected: "2.0.0"},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("Expected %d checks, got: %+v", len(want), checks)
+	}
+	for i := range want {
+		if checks[i] != want[i] {
+			t.Errorf("Check %d: expected %+v, got %+v", i, want[i], checks[i])
+		}
+	}
+	if failed := printVersionChecks(checks); failed != 2 {
+		t.Errorf("Expected 2 failed checks, got %d", failed)
+	}
+	if data, _ := os.ReadFile(file); string(data) != verifyManifest {
+		t.Errorf("Expected the file to be left unchanged")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long watch mode waits after the last file event before
+// re-applying the updates, so a tool regenerating many manifests triggers a
+// single run.
+var watchDebounce = 500 * time.Millisecond
+
+var watch bool
+
+// bumpWatcher re-runs a bump whenever the manifests it targets change.
+type bumpWatcher struct {
+	// patterns are the cleaned file paths and globs of the update sets.
+	patterns []string
+	// dirs are the directories watched for events.
+	dirs []string
+	// anyYAML also makes changes to any YAML file in dirs trigger a run, for
+	// valuesFrom ConfigMaps and Secrets stored next to the HelmReleases.
+	anyYAML bool
+	// snapshot holds the checksum of every YAML file in dirs after the last
+	// run, so the watcher ignores the events caused by its own writes.
+	snapshot map[string]string
+}
+
+// newBumpWatcher returns a watcher for the files of sets.
+func newBumpWatcher(sets []updateSet, followValuesFrom bool) (*bumpWatcher, error) {
+	w := &bumpWatcher{anyYAML: followValuesFrom}
+	seenDirs := map[string]bool{}
+	for _, set := range sets {
+		for _, pattern := range set.Files {
+			pattern = filepath.Clean(pattern)
+			dir := filepath.Dir(pattern)
+			if strings.ContainsAny(dir, "*?[") {
+				return nil, fmt.Errorf("--watch does not support globs in directory names: %s", pattern)
+			}
+			w.patterns = append(w.patterns, pattern)
+			if !seenDirs[dir] {
+				seenDirs[dir] = true
+				w.dirs = append(w.dirs, dir)
+			}
+		}
+	}
+	return w, nil
+}
+
+// relevant reports whether an event on path should trigger a run.
+func (w *bumpWatcher) relevant(path string) bool {
+	path = filepath.Clean(path)
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".yaml" && ext != ".yml" {
+		return false
+	}
+	if w.anyYAML {
+		return true
+	}
+	for _, pattern := range w.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// changed reports whether the content of path differs from the last snapshot.
+func (w *bumpWatcher) changed(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return !os.IsNotExist(err) || w.snapshot[filepath.Clean(path)] != ""
+	}
+	return w.snapshot[filepath.Clean(path)] != fileSHA256(data)
+}
+
+// takeSnapshot records the checksum of every YAML file in the watched
+// directories.
+func (w *bumpWatcher) takeSnapshot() {
+	w.snapshot = map[string]string{}
+	for _, dir := range w.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || !w.relevant(path) {
+				continue
+			}
+			if data, err := os.ReadFile(path); err == nil {
+				w.snapshot[filepath.Clean(path)] = fileSHA256(data)
+			}
+		}
+	}
+}
+
+// watchBumpSets runs bump once and then again every time one of the files of
+// sets is created or modified by another process, until ctx is cancelled or
+// the process is interrupted. Errors of individual runs are reported and do
+// not stop the watch.
+//
+// Parameters:
+//   - ctx: Stops the watch when cancelled.
+//   - sets: The update sets whose files are watched.
+//   - followValuesFrom: Also re-run when another YAML file in the watched
+//     directories changes.
+//   - run: Applies the updates once.
+//
+// Returns:
+//   - An error if the watch cannot be set up or fails.
+func watchBumpSets(ctx context.Context, sets []updateSet, followValuesFrom bool, run func() error) error {
+	w, err := newBumpWatcher(sets, followValuesFrom)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+	for _, dir := range w.dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runOnce := func() {
+		if err := run(); err != nil {
+			logln("❌", err)
+		}
+		w.takeSnapshot()
+		logf("👀 Watching %s for changes (Ctrl+C to stop)\n", strings.Join(w.dirs, ", "))
+	}
+	runOnce()
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			logln("👋 Stopped watching")
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logf("⚠️ File watcher error: %v\n", err)
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			if !w.relevant(event.Name) || !w.changed(event.Name) {
+				continue
+			}
+			if timer == nil {
+				timer = time.NewTimer(watchDebounce)
+			} else {
+				timer.Reset(watchDebounce)
+			}
+			fire = timer.C
+
+		case <-fire:
+			fire = nil
+			logln("🔄 Manifests changed, re-applying updates")
+			runOnce()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWatchBumpSets verifies that watch mode re-applies the updates when a
+// target file is rewritten by another process, and that its own writes do not
+// trigger further runs.
+func TestWatchBumpSets(t *testing.T) {
+	original, err := os.ReadFile("test_files/helmrelease-v2.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "helmrelease.yaml")
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	defer func(d time.Duration) { watchDebounce = d }(watchDebounce)
+	watchDebounce = 50 * time.Millisecond
+
+	sets := []updateSet{{Files: []string{file}, Images: map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}}}
+	runs := make(chan int, 10)
+	count := 0
+	run := func() error {
+		_, err := runBumpSets(sets, false, false)
+		count++
+		runs <- count
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watchBumpSets(ctx, sets, false, run) }()
+
+	waitForRun := func(want int) {
+		t.Helper()
+		select {
+		case got := <-runs:
+			if got != want {
+				t.Fatalf("Expected run %d, got run %d", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for run %d", want)
+		}
+	}
+
+	waitForRun(1)
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Fatalf("Expected the initial run to bump the tag, got:\n%s", data)
+	}
+
+	// Simulate a tool regenerating the manifest with the old tag.
+	if err := os.WriteFile(file, original, 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	waitForRun(2)
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), "tag: 1.8.0") {
+		t.Errorf("Expected the tag to be bumped again, got:\n%s", data)
+	}
+
+	select {
+	case got := <-runs:
+		t.Errorf("Expected no run after the watcher's own write, got run %d", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// webhookSecretEnv provides the default for --secret, so the secret does
+// not have to be put on the command line.
+const webhookSecretEnv = "FLUX_HELPERS_WEBHOOK_SECRET"
+
+// defaultWebhookBranchTemplate names the branch a push event's bump is
+// pushed to when neither --branch nor --branch-template is given.
+const defaultWebhookBranchTemplate = "flux-helpers/{{ slug .Image }}-{{ .Version }}"
+
+// maxWebhookQueue is the number of accepted events waiting to be bumped
+// before further events are refused.
+const maxWebhookQueue = 16
+
+var (
+	webhookConfigPath string
+	webhookSecret     string
+	webhookRepo       string
+)
+
+// webhookConfig maps the image repositories of registry push events to the
+// manifests bumped when a new tag is pushed, e.g.:
+//
+//	rules:
+//	  - repository: ghcr.io/my-org/my-api
+//	    tags: '^\d+\.\d+\.\d+$'
+//	    files: [clusters/dev/my-app.yaml]
+//	  - repository: my-org/*
+//	    files: [clusters/dev/*.yaml]
+type webhookConfig struct {
+	Rules []webhookRule `json:"rules"`
+}
+
+// webhookRule bumps Files when a tag of Repository is pushed.
+type webhookRule struct {
+	// Repository is the pushed image repository as the registry reports it,
+	// or a path.Match glob of it.
+	Repository string `json:"repository"`
+	// Tags, when set, is a regular expression pushed tags must match, e.g.
+	// to skip branch builds.
+	Tags string `json:"tags,omitempty"`
+	// Files are the manifests to bump, relative to the repository root;
+	// globs are allowed.
+	Files []string `json:"files"`
+	// Paths restricts the bump to these value paths, like --path.
+	Paths []string `json:"paths,omitempty"`
+
+	tags *regexp.Regexp
+}
+
+// loadWebhookConfig reads and validates a webhook config file.
+func loadWebhookConfig(file string) (*webhookConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+	var cfg webhookConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid webhook config %s: %w", file, err)
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("invalid webhook config %s: no rules defined", file)
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Repository == "" || len(rule.Files) == 0 {
+			return nil, fmt.Errorf("invalid webhook config %s: rule %d needs a repository and files", file, i+1)
+		}
+		if _, err := path.Match(rule.Repository, ""); err != nil {
+			return nil, fmt.Errorf("invalid webhook config %s: rule %d: invalid repository %q: %w", file, i+1, rule.Repository, err)
+		}
+		if _, err := confinePaths("", rule.Files); err != nil {
+			return nil, fmt.Errorf("invalid webhook config %s: rule %d: %w", file, i+1, err)
+		}
+		if rule.Tags != "" {
+			if rule.tags, err = regexp.Compile(rule.Tags); err != nil {
+				return nil, fmt.Errorf("invalid webhook config %s: rule %d: invalid tags pattern: %w", file, i+1, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// match returns the rules that apply to push.
+func (c *webhookConfig) match(push imagePush) []webhookRule {
+	var rules []webhookRule
+	for _, rule := range c.Rules {
+		if ok, _ := path.Match(rule.Repository, push.Repository); !ok {
+			continue
+		}
+		if rule.tags != nil && !rule.tags.MatchString(push.Tag) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// imagePush is a tag pushed to an image repository.
+type imagePush struct {
+	Repository string
+	Tag        string
+}
+
+func (p imagePush) String() string {
+	return p.Repository + ":" + p.Tag
+}
+
+// webhookSource receives the push events of one registry. New registries are
+// added by registering a webhookSource in webhookSources.
+type webhookSource struct {
+	// Authorized reports whether a request carries secret the way the
+	// registry sends it.
+	Authorized func(r *http.Request, body []byte, secret string) bool
+	// Parse returns the tags pushed according to an event. Events that are
+	// not about pushed tags return none.
+	Parse func(r *http.Request, body []byte) ([]imagePush, error)
+}
+
+// webhookSources are the supported registries, by the name in the
+// /hooks/{source} path.
+var webhookSources = map[string]webhookSource{
+	"github":    {Authorized: githubSignatureValid, Parse: parseGitHubPackageEvent},
+	"dockerhub": {Authorized: queryTokenValid, Parse: parseDockerHubEvent},
+	"harbor":    {Authorized: authHeaderValid, Parse: parseHarborEvent},
+}
+
+// githubSignatureValid checks the X-Hub-Signature-256 HMAC GitHub signs
+// webhook deliveries with.
+func githubSignatureValid(r *http.Request, body []byte, secret string) bool {
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// queryTokenValid checks the token query parameter, for registries such as
+// Docker Hub that can neither sign deliveries nor send headers.
+func queryTokenValid(r *http.Request, body []byte, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(secret)) == 1
+}
+
+// authHeaderValid checks the Authorization header, which Harbor sends as
+// configured in the webhook's "Auth Header", with or without "Bearer ".
+func authHeaderValid(r *http.Request, body []byte, secret string) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// parseGitHubPackageEvent reads the "package" and "registry_package" events
+// GitHub sends when a container image is published to ghcr.io.
+func parseGitHubPackageEvent(r *http.Request, body []byte) ([]imagePush, error) {
+	switch r.Header.Get("X-GitHub-Event") {
+	case "package", "registry_package":
+	default:
+		return nil, nil
+	}
+	type githubPackage struct {
+		Name        string `json:"name"`
+		PackageType string `json:"package_type"`
+		Owner       struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+		PackageVersion struct {
+			ContainerMetadata struct {
+				Tag struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+	}
+	var event struct {
+		Action          string         `json:"action"`
+		Package         *githubPackage `json:"package"`
+		RegistryPackage *githubPackage `json:"registry_package"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid GitHub package event: %w", err)
+	}
+	pkg := event.Package
+	if pkg == nil {
+		pkg = event.RegistryPackage
+	}
+	if event.Action != "published" || pkg == nil || !strings.EqualFold(pkg.PackageType, "container") {
+		return nil, nil
+	}
+	tag := pkg.PackageVersion.ContainerMetadata.Tag.Name
+	if tag == "" || pkg.Name == "" || pkg.Owner.Login == "" {
+		return nil, nil
+	}
+	return []imagePush{{Repository: strings.ToLower("ghcr.io/" + pkg.Owner.Login + "/" + pkg.Name), Tag: tag}}, nil
+}
+
+// parseDockerHubEvent reads a Docker Hub push webhook. Repositories are named
+// as on Docker Hub, without "docker.io/".
+func parseDockerHubEvent(r *http.Request, body []byte) ([]imagePush, error) {
+	var event struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid Docker Hub event: %w", err)
+	}
+	if event.PushData.Tag == "" || event.Repository.RepoName == "" {
+		return nil, nil
+	}
+	return []imagePush{{Repository: event.Repository.RepoName, Tag: event.PushData.Tag}}, nil
+}
+
+// parseHarborEvent reads a Harbor PUSH_ARTIFACT event, whose resource URLs
+// name the registry host, project and repository.
+func parseHarborEvent(r *http.Request, body []byte) ([]imagePush, error) {
+	var event struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid Harbor event: %w", err)
+	}
+	if event.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	var pushes []imagePush
+	for _, res := range event.EventData.Resources {
+		if res.Tag == "" {
+			continue
+		}
+		repository, _, _ := strings.Cut(res.ResourceURL, "@")
+		if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			repository = repository[:i]
+		}
+		if repository != "" {
+			pushes = append(pushes, imagePush{Repository: repository, Tag: res.Tag})
+		}
+	}
+	return pushes, nil
+}
+
+// webhookResponse lists the pushes of an event that will be bumped.
+type webhookResponse struct {
+	Accepted []string `json:"accepted"`
+}
+
+// webhookServer receives registry push events and bumps, commits and pushes
+// the manifests the config maps the pushed images to, one event at a time.
+type webhookServer struct {
+	// repo is the Git URL of the manifests, cloned afresh for every event.
+	repo      string
+	config    *webhookConfig
+	secret    string
+	templates *commitTemplates
+	jobs      chan []imagePush
+}
+
+// handler returns the routes of the server: POST /hooks/{source} for every
+// webhookSource, and GET /healthz.
+func (s *webhookServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /hooks/{source}", s.receive)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// receive authenticates and parses an event and queues its pushes that
+// match a rule. Events are acknowledged before they are bumped, as
+// registries give up on slow webhooks.
+func (s *webhookServer) receive(w http.ResponseWriter, r *http.Request) {
+	status, body := s.accept(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *webhookServer) accept(r *http.Request) (int, interface{}) {
+	source, ok := webhookSources[r.PathValue("source")]
+	if !ok {
+		return http.StatusNotFound, serveError{Error: fmt.Sprintf("unknown webhook source %q", r.PathValue("source"))}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxServeRequestBytes))
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+	if !source.Authorized(r, body, s.secret) {
+		logf("⚠️ Refused %s webhook from %s: missing or invalid secret\n", r.PathValue("source"), r.RemoteAddr)
+		return http.StatusUnauthorized, serveError{Error: "missing or invalid secret"}
+	}
+	pushes, err := source.Parse(r, body)
+	if err != nil {
+		return http.StatusBadRequest, serveError{Error: err.Error()}
+	}
+
+	var matched []imagePush
+	resp := webhookResponse{Accepted: []string{}}
+	for _, push := range pushes {
+		if len(s.config.match(push)) > 0 {
+			matched = append(matched, push)
+			resp.Accepted = append(resp.Accepted, push.String())
+		}
+	}
+	if len(matched) == 0 {
+		return http.StatusOK, resp
+	}
+	select {
+	case s.jobs <- matched:
+	default:
+		return http.StatusServiceUnavailable, serveError{Error: "too many events waiting to be bumped"}
+	}
+	logf("📥 Received %s\n", strings.Join(resp.Accepted, ", "))
+	return http.StatusAccepted, resp
+}
+
+// run bumps the queued events until ctx is done.
+func (s *webhookServer) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pushes := <-s.jobs:
+			s.process(ctx, pushes)
+		}
+	}
+}
+
+// process bumps the pushes of an event and records the bump in the
+// --audit-log, one record per event, as the server may run for months.
+func (s *webhookServer) process(ctx context.Context, pushes []imagePush) {
+	err := s.bump(ctx, pushes)
+	if err != nil {
+		logf("❌ Failed to bump %s: %v\n", pushes[0], err)
+	}
+	if err := writeAuditLog(s.auditArgs(pushes), err, true); err != nil {
+		logf("❌ Failed to record the bump of %s in the audit log: %v\n", pushes[0], err)
+	}
+}
+
+// auditArgs describes the bump of pushes as the arguments of the equivalent
+// bump, for its audit record; the arguments of the server would only reveal
+// its secret.
+func (s *webhookServer) auditArgs(pushes []imagePush) []string {
+	args := []string{"bump", "--repo", s.repo}
+	for _, push := range pushes {
+		args = append(args, "--set", push.Repository+"="+push.Tag)
+	}
+	return args
+}
+
+// bump clones the repository, bumps the files of every rule matching the
+// pushes, and commits and pushes the changes as bump --commit would.
+func (s *webhookServer) bump(ctx context.Context, pushes []imagePush) error {
+	dir, err := cloneRepository(ctx, s.repo, pullRequestBase)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var sets []updateSet
+	for _, push := range pushes {
+		for _, rule := range s.config.match(push) {
+			files, err := confinePaths(dir, rule.Files)
+			if err != nil {
+				return err
+			}
+			sets = append(sets, updateSet{Files: files, Images: map[string]string{push.Repository: push.Tag}, Paths: rule.Paths})
+		}
+	}
+	report, err := runBumpSets(sets, false, false)
+	if err != nil {
+		return errors.New(relativeError(dir, err))
+	}
+	if report.changeCount() == 0 {
+		logf("✅ %s: nothing to change\n", pushes[0])
+		return nil
+	}
+	if err := commitReports(ctx, dir, report.Files, s.templates); err != nil {
+		return errors.New(relativeError(dir, err))
+	}
+	return nil
+}
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Bump manifests when registries report pushed image tags",
+	Long: "Run an HTTP server receiving GHCR (GitHub), Docker Hub and Harbor push events. " +
+		"Pushed tags of the image repositories in --config are bumped in a fresh clone of " +
+		"--repo, committed, pushed and optionally proposed as a pull request.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret := webhookSecret
+		if secret == "" {
+			secret = os.Getenv(webhookSecretEnv)
+		}
+		if secret == "" {
+			return fmt.Errorf("--secret (or $%s) is required", webhookSecretEnv)
+		}
+		cfg, err := loadWebhookConfig(webhookConfigPath)
+		if err != nil {
+			return err
+		}
+		signing := commitSigning{Format: commitSign, Key: commitKey}
+		if err := signing.validate(); err != nil {
+			return err
+		}
+		if commitMessage != "" && messageTemplate != "" {
+			return fmt.Errorf("--commit-message and --message-template cannot be combined")
+		}
+		if commitBranch != "" && branchTemplate != "" {
+			return fmt.Errorf("--branch and --branch-template cannot be combined")
+		}
+		for _, flag := range []string{"pr-provider", "pr-title-template", "pr-body-template"} {
+			if cmd.Flags().Changed(flag) && !pullRequestOpen {
+				return fmt.Errorf("--%s requires --pull-request", flag)
+			}
+		}
+		if commitBranch == "" && branchTemplate == "" {
+			branchTemplate = defaultWebhookBranchTemplate
+		}
+		templates, err := loadCommitTemplates()
+		if err != nil {
+			return err
+		}
+		commitChanges = true
+
+		hooks := &webhookServer{
+			repo: webhookRepo, config: cfg, secret: secret, templates: templates,
+			jobs: make(chan []imagePush, maxWebhookQueue),
+		}
+		srv := &http.Server{Addr: serveAddr, Handler: hooks.handler(), ReadHeaderTimeout: 10 * time.Second}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdown)
+		}()
+		go hooks.run(ctx)
+
+		logf("🪝 Receiving push events for %s on %s\n", webhookRepo, serveAddr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	webhookCmd.Flags().StringVar(&webhookConfigPath, "config", "webhook.yaml", "Config file mapping image repositories to the manifests to bump")
+	webhookCmd.Flags().StringVar(&webhookRepo, "repo", "", "Git URL of the repository holding the manifests")
+	webhookCmd.Flags().StringVar(&webhookSecret, "secret", "", "Secret registries authenticate with (default: $"+webhookSecretEnv+")")
+	webhookCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	webhookCmd.Flags().StringVar(&commitMessage, "commit-message", "", "Commit message (default: describes the bumped images)")
+	webhookCmd.Flags().StringVar(&commitSign, "sign", os.Getenv(commitSignEnv), "Sign the commits: gpg or ssh (default: $"+commitSignEnv+")")
+	webhookCmd.Flags().StringVar(&commitKey, "signing-key", os.Getenv(commitKeyEnv), "GPG key ID or SSH key file for --sign (default: $"+commitKeyEnv+", then git's user.signingKey)")
+	webhookCmd.Flags().StringVar(&commitBranch, "branch", "", "Push the commits to this branch (default: --branch-template "+defaultWebhookBranchTemplate+")")
+	webhookCmd.Flags().StringVar(&messageTemplate, "message-template", "", "Go template for the commit message (fields: .Images, .Image, .Version, .File, .Files, .Changes, .Date; funcs: env, join, slug); @file reads it from a file")
+	webhookCmd.Flags().StringVar(&branchTemplate, "branch-template", "", "Go template for the branch the commits are pushed to, e.g. bump/{{slug .Image}}-{{.Version}}; @file reads it from a file")
+	webhookCmd.Flags().StringVar(&prTitleTemplate, "pr-title-template", "", "Go template for the pull request title (also .Message); @file reads it from a file")
+	webhookCmd.Flags().StringVar(&prBodyTemplate, "pr-body-template", "", "Go template for the pull request description (also .Message); @file reads it from a file")
+	webhookCmd.Flags().BoolVar(&pullRequestOpen, "pull-request", false, "Open a pull request from the pushed branch (token from $GITHUB_TOKEN, $GITLAB_TOKEN, $AZURE_DEVOPS_TOKEN or $BITBUCKET_TOKEN)")
+	webhookCmd.Flags().StringVar(&pullRequestBase, "base", "", "Branch to bump and target of the pull request (default: the default branch of --repo)")
+	webhookCmd.Flags().StringVar(&pullRequestVendor, "pr-provider", "", "Pull request provider: github, gitlab, azure-devops or bitbucket (default: detected from the origin remote)")
+	_ = webhookCmd.MarkFlagRequired("repo")
+	rootCmd.AddCommand(webhookCmd)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const githubPackageEvent = `{
+  "action": "published",
+  "package": {
+    "name": "my-api",
+    "package_type": "CONTAINER",
+    "owner": {"login": "My-Org"},
+    "package_version": {"container_metadata": {"tag": {"name": "1.8.0"}}}
+  }
+}`
+
+// TestWebhookSources verifies that the push events of each registry are
+// parsed into the pushed repositories and tags.
+func TestWebhookSources(t *testing.T) {
+	for _, tc := range []struct {
+		source string
+		event  string
+		body   string
+		want   []imagePush
+	}{
+		{"github", "package", githubPackageEvent, []imagePush{{"ghcr.io/my-org/my-api", "1.8.0"}}},
+		{"github", "ping", `{"zen": "Keep it logically awesome."}`, nil},
+		{"github", "package", `{"action": "updated", "package": {"name": "my-api"}}`, nil},
+		{"dockerhub", "", `{"push_data": {"tag": "2.0.1"}, "repository": {"repo_name": "my-org/worker"}}`, []imagePush{{"my-org/worker", "2.0.1"}}},
+		{"harbor", "", `{"type": "PUSH_ARTIFACT", "event_data": {"resources": [
+			{"tag": "3.1.0", "resource_url": "harbor.example.com:8443/apps/web:3.1.0"},
+			{"tag": "", "resource_url": "harbor.example.com:8443/apps/web@sha256:abc"}]}}`, []imagePush{{"harbor.example.com:8443/apps/web", "3.1.0"}}},
+		{"harbor", "", `{"type": "DELETE_ARTIFACT"}`, nil},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hooks/"+tc.source, nil)
+		r.Header.Set("X-GitHub-Event", tc.event)
+		got, err := webhookSources[tc.source].Parse(r, []byte(tc.body))
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", tc.source, tc.event, err)
+			continue
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("%s %s: expected %v, got %v", tc.source, tc.event, tc.want, got)
+		}
+	}
+}
+
+// TestWebhookReceive verifies authentication and that only pushes matching a
+// rule are queued.
+func TestWebhookReceive(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "webhook.yaml")
+	os.WriteFile(cfgFile, []byte("rules:\n  - repository: ghcr.io/my-org/*\n    tags: '^\\d+\\.\\d+\\.\\d+$'\n    files: [app.yaml]\n"), 0644)
+	cfg, err := loadWebhookConfig(cfgFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s := &webhookServer{config: cfg, secret: "secret", jobs: make(chan []imagePush, 1)}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	post := func(source, body, signature string) (int, webhookResponse) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/hooks/"+source, strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "package")
+		req.Header.Set("X-Hub-Signature-256", signature)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out webhookResponse
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if status, _ := post("github", githubPackageEvent, "sha256=00"); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad signature, got %d", status)
+	}
+	if status, _ := post("quay", githubPackageEvent, ""); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown source, got %d", status)
+	}
+	if status, resp := post("github", githubPackageEvent, sign(githubPackageEvent)); status != http.StatusAccepted || len(resp.Accepted) != 1 {
+		t.Errorf("Expected the push to be accepted, got %d: %+v", status, resp)
+	}
+	if pushes := <-s.jobs; len(pushes) != 1 || pushes[0].String() != "ghcr.io/my-org/my-api:1.8.0" {
+		t.Errorf("Unexpected queued pushes: %v", pushes)
+	}
+	branchBuild := strings.Replace(githubPackageEvent, "1.8.0", "main-4f2a9c1", 1)
+	if status, resp := post("github", branchBuild, sign(branchBuild)); status != http.StatusOK || len(resp.Accepted) != 0 {
+		t.Errorf("Expected a tag not matching the rule to be ignored, got %d: %+v", status, resp)
+	}
+}
+
+// TestWebhookBump verifies that a push is bumped in a clone of the repository
+// and pushed to the branch of the default branch template, and that every
+// event is recorded in the audit log.
+func TestWebhookBump(t *testing.T) {
+	remote := initTestRemote(t, serveManifest)
+	defer func(changes bool, tmpl string) { commitChanges, branchTemplate = changes, tmpl }(commitChanges, branchTemplate)
+	commitChanges, branchTemplate = true, defaultWebhookBranchTemplate
+	templates, err := loadCommitTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &webhookServer{
+		repo:      remote,
+		config:    &webhookConfig{Rules: []webhookRule{{Repository: "ghcr.io/my-org/my-api", Files: []string{"*.yaml"}}}},
+		templates: templates,
+	}
+	oldPath := auditLogPath
+	auditLogPath = filepath.Join(t.TempDir(), "audit.jsonl")
+	auditTrail.files = nil
+	defer func() {
+		auditLogPath = oldPath
+		auditTrail.files = nil
+	}()
+	s.process(context.Background(), []imagePush{{"ghcr.io/my-org/my-api", "1.8.0"}})
+	missing := *s
+	missing.repo = filepath.Join(t.TempDir(), "missing.git")
+	missing.process(context.Background(), []imagePush{{"ghcr.io/my-org/my-api", "1.9.0"}})
+	branch := "flux-helpers/ghcr.io/my-org/my-api-1.8.0"
+	out, err := exec.Command("git", "-C", remote, "show", branch+":app.yaml").Output()
+	if err != nil || !strings.Contains(string(out), "tag: 1.8.0") {
+		t.Errorf("Expected the bump on %s, got: %v\n%s", branch, err, out)
+	}
+	if out, _ := exec.Command("git", "-C", remote, "log", "-1", "--format=%B", branch).Output(); !strings.Contains(string(out), "- app.yaml: image.tag") {
+		t.Errorf("Expected the commit message to name files relative to the repository, got:\n%s", out)
+	}
+
+	data, err := os.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per event, got:\n%s", data)
+	}
+	var first, second commandAuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Outcome != "success" || len(first.Files) != 1 || strings.Join(first.Args, " ") != "bump --repo "+remote+" --set ghcr.io/my-org/my-api=1.8.0" {
+		t.Errorf("Unexpected record of the bump: %+v", first)
+	}
+	if second.Outcome != "failure" || len(second.Files) != 0 {
+		t.Errorf("Expected the event failing to clone to be recorded, got %+v", second)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// defaultMaxShrink is the default of --max-shrink, in percent.
+const defaultMaxShrink = 50
+
+// maxShrinkPercent is how much smaller than the original, in percent, a
+// rewritten file may be (--max-shrink); 100 disables the size check.
+var maxShrinkPercent = defaultMaxShrink
+
+// guardedSections are the mappings whose keys a rewrite must keep besides
+// the document root.
+var guardedSections = []string{"spec"}
+
+// checkRewrite compares the new content of a file with its original before
+// it is written, to catch edits that damage a manifest instead of changing a
+// value, such as a sanitization that drops spec.postRenderers:
+//
+//   - the new content must parse as YAML, with as many documents as before;
+//   - each document must keep its kind and the keys of its root and spec
+//     mappings (keys holding nothing, e.g. an empty status, and keys removed
+//     by --sanitize or --sanitize-path may go);
+//   - the file must not shrink by more than --max-shrink percent.
+//
+// Originals that do not parse as YAML are not checked.
+//
+// Returns:
+//   - An error explaining the first problem found.
+func checkRewrite(original, updated []byte) error {
+	oldDocs, err := parseYAMLDocuments(original)
+	if err != nil {
+		return nil
+	}
+	newDocs, err := parseYAMLDocuments(updated)
+	if err != nil {
+		return fmt.Errorf("the new content no longer parses as YAML: %w", err)
+	}
+	if len(newDocs) != len(oldDocs) {
+		return fmt.Errorf("it would have %d YAML document(s) instead of %d", len(newDocs), len(oldDocs))
+	}
+
+	for i, oldDoc := range oldDocs {
+		newDoc := newDocs[i]
+		where := ""
+		if len(oldDocs) > 1 {
+			where = fmt.Sprintf(" in document %d", i+1)
+		}
+		if kind := yamlMappingValue(oldDoc, "kind"); kind != nil && kind.Kind == yamlv3.ScalarNode {
+			newKind := yamlMappingValue(newDoc, "kind")
+			if newKind == nil || newKind.Value != kind.Value {
+				got := "no kind"
+				if newKind != nil {
+					got = "kind " + newKind.Value
+				}
+				return fmt.Errorf("it would no longer be a %s%s (%s)", kind.Value, where, got)
+			}
+		}
+		lost := lostMappingKeys(oldDoc, newDoc, "")
+		for _, section := range guardedSections {
+			lost = append(lost, lostMappingKeys(yamlMappingValue(oldDoc, section), yamlMappingValue(newDoc, section), section+".")...)
+		}
+		lost = slices.DeleteFunc(lost, sanitizedKey)
+		if len(lost) > 0 {
+			return fmt.Errorf("it would lose %s%s", strings.Join(lost, ", "), where)
+		}
+	}
+
+	if maxShrinkPercent < 100 && len(original) > 0 {
+		shrink := (len(original) - len(updated)) * 100 / len(original)
+		if shrink > maxShrinkPercent {
+			return fmt.Errorf("it would shrink by %d%% (from %d to %d bytes), more than --max-shrink %d%%", shrink, len(original), len(updated), maxShrinkPercent)
+		}
+	}
+	return nil
+}
+
+// parseYAMLDocuments parses every document of data, returning the root node
+// of each one that is not empty.
+func parseYAMLDocuments(data []byte) ([]*yamlv3.Node, error) {
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	var docs []*yamlv3.Node
+	for {
+		var doc yamlv3.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if root := yamlDocumentRoot(&doc); root.Kind != yamlv3.DocumentNode {
+			docs = append(docs, root)
+		}
+	}
+}
+
+// lostMappingKeys returns the keys of the mapping old, prefixed with prefix,
+// that are missing from the mapping updated, except for keys that held
+// nothing (null or an empty string, mapping or list). Either node may be nil
+// or not a mapping, in which case nothing is reported; a section that
+// disappears altogether is reported by the check of its parent.
+func lostMappingKeys(old, updated *yamlv3.Node, prefix string) []string {
+	if old == nil || updated == nil || old.Kind != yamlv3.MappingNode || updated.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	var lost []string
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		key, value := old.Content[i].Value, old.Content[i+1]
+		if yamlMappingValue(updated, key) == nil && !emptyYAMLNode(value) {
+			lost = append(lost, prefix+key)
+		}
+	}
+	return lost
+}
+
+// emptyYAMLNode reports whether n holds nothing: null, an empty string, or
+// an empty mapping or list.
+func emptyYAMLNode(n *yamlv3.Node) bool {
+	for n.Kind == yamlv3.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	switch n.Kind {
+	case yamlv3.MappingNode, yamlv3.SequenceNode:
+		return len(n.Content) == 0
+	case yamlv3.ScalarNode:
+		return n.Tag == "!!null" || n.Value == ""
+	}
+	return false
+}
+
+func init() {
+	rootCmd.PersistentFlags().IntVar(&maxShrinkPercent, "max-shrink", defaultMaxShrink, "Refuse to rewrite a manifest that would shrink by more than this percentage (100 to disable)")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckRewrite verifies the structure and size checks of a rewrite.
+func TestCheckRewrite(t *testing.T) {
+	original := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: app
+  creationTimestamp: null
+spec:
+  interval: 5m
+  postRenderers:
+    - kustomize:
+        images:
+          - name: nginx
+            newTag: "1.0.0"
+  values:
+    image: {repository: nginx, tag: "1.0.0"}
+status: {}
+`
+	tests := []struct {
+		name    string
+		updated string
+		wantErr string
+	}{
+		{"value change", strings.ReplaceAll(original, "1.0.0", "1.1.0"), ""},
+		{"empty keys removed", strings.Replace(original, "status: {}\n", "", 1), ""},
+		{"lost spec key", strings.Replace(original, "  postRenderers:\n    - kustomize:\n        images:\n          - name: nginx\n            newTag: \"1.0.0\"\n", "", 1), "spec.postRenderers"},
+		{"lost top-level key", strings.Replace(original, "metadata:\n  name: app\n  creationTimestamp: null\n", "", 1), "lose metadata"},
+		{"kind changed", strings.Replace(original, "kind: HelmRelease", "kind: ConfigMap", 1), "no longer be a HelmRelease"},
+		{"unparsable", original + "  bad: [\n", "no longer parses"},
+		{"extra document", original + "---\nkind: ConfigMap\n", "2 YAML document(s) instead of 1"},
+		{"shrunk", "apiVersion: v2\nkind: HelmRelease\nmetadata: {name: a}\nspec: {interval: 1m, postRenderers: [], values: {}}\n", "shrink by"},
+	}
+	for _, tt := range tests {
+		err := checkRewrite([]byte(original), []byte(tt.updated))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	if err := checkRewrite([]byte("not: [yaml"), []byte("x: 1\n")); err != nil {
+		t.Errorf("Expected an unparsable original not to be checked, got %v", err)
+	}
+}
+
+// TestWriteFileWithBackupGuard verifies that a damaging rewrite leaves the
+// file untouched.
+func TestWriteFileWithBackupGuard(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hr.yaml")
+	original := "kind: HelmRelease\nspec:\n  postRenderers: [{kustomize: {}}]\n  values: {}\n"
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := writeFileWithBackup(file, []byte("kind: HelmRelease\nspec:\n  values: {}\n  interval: 1m\n"), 0644)
+	if err == nil || !strings.Contains(err.Error(), "refusing to rewrite") {
+		t.Fatalf("Expected the rewrite to be refused, got %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != original {
+		t.Errorf("Expected the file to be left as it was, got:\n%s", data)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// yamlPositionError is an error about the YAML node at Line and Column of a
+// manifest; callers prefix it with the file name.
+type yamlPositionError struct {
+	Line, Column int
+	Err          error
+}
+
+func (e *yamlPositionError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *yamlPositionError) Unwrap() error {
+	return e.Err
+}
+
+// valuesPathError is an error about the value at Path of a values tree,
+// which locateValuesError turns into a yamlPositionError when the YAML source
+// is at hand.
+type valuesPathError struct {
+	// Path is the dot-separated values path of the value, as in tagChange.
+	Path string
+	Err  error
+}
+
+func (e *valuesPathError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *valuesPathError) Unwrap() error {
+	return e.Err
+}
+
+// errorAtNode returns err located at node, or err itself if node is nil.
+func errorAtNode(node *yamlv3.Node, err error) error {
+	if node == nil {
+		return err
+	}
+	return &yamlPositionError{Line: node.Line, Column: node.Column, Err: err}
+}
+
+// findYAMLPath returns the node at the values path below node, or nil. Lists
+// are descended into at the index the path gives, or searched item by item.
+func findYAMLPath(node *yamlv3.Node, path string) *yamlv3.Node {
+	if path == "" {
+		return node
+	}
+	return findYAMLParts(node, splitValuesPath(path))
+}
+
+// findYAMLParts is findYAMLPath for a path split with splitValuesPath.
+func findYAMLParts(node *yamlv3.Node, parts []string) *yamlv3.Node {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	if len(parts) == 0 {
+		return node
+	}
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		return findYAMLParts(yamlMappingValue(node, parts[0]), parts[1:])
+	case yamlv3.SequenceNode:
+		if i, ok := listIndex(parts[0]); ok {
+			if i >= len(node.Content) {
+				return nil
+			}
+			return findYAMLParts(node.Content[i], parts[1:])
+		}
+		for _, item := range node.Content {
+			if found := findYAMLParts(item, parts); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// locateValuesError locates a valuesPathError in err at its node below the
+// node that locate returns for the root of the YAML data, such as
+// .spec.values of a HelmRelease. Other errors, and paths that cannot be
+// found, are returned unchanged.
+func locateValuesError(data []byte, err error, locate func(root *yamlv3.Node) *yamlv3.Node) error {
+	var pathErr *valuesPathError
+	if !errors.As(err, &pathErr) {
+		return err
+	}
+	var doc yamlv3.Node
+	if yamlv3.Unmarshal(data, &doc) != nil {
+		return err
+	}
+	return errorAtNode(findYAMLPath(locate(yamlDocumentRoot(&doc)), pathErr.Path), err)
+}
+
+// helmReleaseValuesNode returns the .spec.values node of the HelmRelease at
+// root, or nil.
+func helmReleaseValuesNode(root *yamlv3.Node) *yamlv3.Node {
+	return yamlMappingValue(yamlMappingValue(root, "spec"), "values")
+}
+
+// locateDecodeError locates an error unmarshaling data into obj at the YAML
+// node that causes it. Errors of custom unmarshalers (such as that of
+// durations) do not name the field, so the node is isolated instead: the
+// entries of a mapping or list are left out one at a time until the rest
+// decodes, descending into the entry that was left out. YAML syntax errors
+// already carry their line and are returned unchanged, as are errors that
+// cannot be isolated.
+func locateDecodeError(data []byte, obj interface{}, err error) error {
+	var doc yamlv3.Node
+	if yamlv3.Unmarshal(data, &doc) != nil {
+		return err
+	}
+	decodes := func() bool {
+		out, mErr := yamlv3.Marshal(&doc)
+		return mErr == nil && yaml.Unmarshal(out, reflect.New(reflect.TypeOf(obj).Elem()).Interface()) == nil
+	}
+	if decodes() {
+		return err
+	}
+
+	var culprit *yamlv3.Node
+	for node := yamlDocumentRoot(&doc); node.Kind == yamlv3.MappingNode || node.Kind == yamlv3.SequenceNode; {
+		step := 1
+		if node.Kind == yamlv3.MappingNode {
+			step = 2
+		}
+		found := -1
+		for i := 0; i+step <= len(node.Content) && found < 0; i += step {
+			content := node.Content
+			node.Content = append(slices.Clone(content[:i]), content[i+step:]...)
+			if decodes() {
+				found = i
+			}
+			node.Content = content
+		}
+		if found < 0 {
+			break
+		}
+		culprit = node.Content[found+step-1]
+		node = culprit
+	}
+	return errorAtNode(culprit, err)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestErrorPositions verifies that decoding errors and image blocks with a
+// missing or non-string tag are reported with their YAML line and column.
+func TestErrorPositions(t *testing.T) {
+	const header = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: my-app
+spec:
+`
+	tests := []struct {
+		name         string
+		spec         string
+		line, column int
+		message      string
+	}{
+		{
+			name:    "invalid duration",
+			spec:    "  interval: 5\n  values: {}\n",
+			line:    6,
+			column:  13,
+			message: "failed to unmarshal HelmRelease",
+		},
+		{
+			name:    "wrong type in a list",
+			spec:    "  valuesFrom:\n    - kind: ConfigMap\n      name: app\n    - kind: ConfigMap\n      name: [other]\n",
+			line:    10,
+			column:  13,
+			message: "cannot unmarshal array",
+		},
+		{
+			name:    "numeric tag",
+			spec:    "  values:\n    image:\n      repository: ghcr.io/my-org/my-api\n      tag: 1.10\n",
+			line:    9,
+			column:  12,
+			message: "tag of ghcr.io/my-org/my-api at image is 1.1, not a string",
+		},
+		{
+			name:    "missing tag",
+			spec:    "  values:\n    sidecars:\n      - image:\n          repository: ghcr.io/my-org/my-api\n",
+			line:    9,
+			column:  11,
+			message: "image block for ghcr.io/my-org/my-api at sidecars[0].image has no tag",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bumpHelmReleaseData([]byte(header+tt.spec), map[string]string{"ghcr.io/my-org/my-api": "1.8.0"}, bumpOptions{DryRun: true})
+			var posErr *yamlPositionError
+			if !errors.As(err, &posErr) {
+				t.Fatalf("Expected a positioned error, got: %v", err)
+			}
+			if posErr.Line != tt.line || posErr.Column != tt.column || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected line %d, column %d: %s; got: %v", tt.line, tt.column, tt.message, err)
+			}
+		})
+	}
+
+	// A syntax error already names its line and is left alone.
+	_, err := decodeHelmRelease([]byte(header + "  values:\n    a: [\n"))
+	if err == nil || !strings.Contains(err.Error(), "yaml: line") {
+		t.Errorf("Expected a YAML syntax error, got: %v", err)
+	}
+}